@@ -0,0 +1,382 @@
+// Package bench measures tunnel performance end to end. It runs a server,
+// a client and an echo backend in one process and drives load through the
+// tunnel the way visitors would, so changes to the framing, multiplexing
+// or proxy code can be compared before and after.
+package bench
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+
+	"drip/internal/client/tcp"
+	"drip/internal/server/ports"
+	"drip/internal/server/proxy"
+	servertcp "drip/internal/server/tcp"
+	servertls "drip/internal/server/tls"
+	"drip/internal/server/tunnel"
+	"drip/internal/shared/protocol"
+)
+
+// Modes that can be benchmarked.
+const (
+	ModeHTTP = "http"
+	ModeTCP  = "tcp"
+)
+
+const (
+	domain    = "bench.localhost"
+	subdomain = "bench"
+
+	tcpPortMin = 42000
+	tcpPortMax = 42999
+)
+
+// Config describes one benchmark run.
+type Config struct {
+	Mode        string        // ModeHTTP or ModeTCP
+	Duration    time.Duration // how long to generate load
+	Concurrency int           // concurrent visitors
+	PayloadSize int           // bytes sent and echoed back per request
+	Logger      *zap.Logger   // nil discards logs
+}
+
+// Result summarizes a run. Latencies are per request for HTTP and per
+// round trip for TCP.
+type Result struct {
+	Mode        string        `json:"mode"`
+	Concurrency int           `json:"concurrency"`
+	PayloadSize int           `json:"payload_size"`
+	Elapsed     time.Duration `json:"elapsed_ns"`
+	Requests    int64         `json:"requests"`
+	Errors      int64         `json:"errors"`
+	Bytes       int64         `json:"bytes"` // payload bytes in both directions
+	FirstError  string        `json:"first_error,omitempty"`
+
+	P50 time.Duration `json:"p50_ns"`
+	P90 time.Duration `json:"p90_ns"`
+	P99 time.Duration `json:"p99_ns"`
+	Max time.Duration `json:"max_ns"`
+}
+
+// RequestsPerSecond returns the completed requests per second.
+func (r *Result) RequestsPerSecond() float64 {
+	if r.Elapsed <= 0 {
+		return 0
+	}
+	return float64(r.Requests) / r.Elapsed.Seconds()
+}
+
+// Throughput returns the payload bytes moved per second.
+func (r *Result) Throughput() float64 {
+	if r.Elapsed <= 0 {
+		return 0
+	}
+	return float64(r.Bytes) / r.Elapsed.Seconds()
+}
+
+// Run starts the server, client and backend, generates load for
+// cfg.Duration and tears everything down again.
+func Run(ctx context.Context, cfg Config) (*Result, error) {
+	if cfg.Mode != ModeHTTP && cfg.Mode != ModeTCP {
+		return nil, fmt.Errorf("unknown benchmark mode %q (use %s or %s)", cfg.Mode, ModeHTTP, ModeTCP)
+	}
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = 1
+	}
+	if cfg.PayloadSize <= 0 {
+		cfg.PayloadSize = 1
+	}
+	logger := cfg.Logger
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	backend, err := startBackend(cfg.Mode)
+	if err != nil {
+		return nil, err
+	}
+	defer backend.Close()
+
+	srv, err := startServer(logger)
+	if err != nil {
+		return nil, err
+	}
+	defer srv.close()
+
+	tunnelType := protocol.TunnelTypeHTTP
+	if cfg.Mode == ModeTCP {
+		tunnelType = protocol.TunnelTypeTCP
+	}
+	client := tcp.NewTunnelClient(&tcp.ConnectorConfig{
+		ServerAddr: srv.addr,
+		TunnelType: tunnelType,
+		LocalHost:  "127.0.0.1",
+		LocalPort:  backend.Addr().(*net.TCPAddr).Port,
+		Subdomain:  subdomain,
+		Insecure:   true,
+	}, logger)
+	if err := client.Connect(); err != nil {
+		return nil, fmt.Errorf("failed to connect bench client: %w", err)
+	}
+	defer client.Close()
+
+	var visit visitor
+	switch cfg.Mode {
+	case ModeHTTP:
+		visit = newHTTPVisitor(srv.addr, cfg.PayloadSize)
+	case ModeTCP:
+		u, err := url.Parse(client.GetURL())
+		if err != nil {
+			return nil, fmt.Errorf("unexpected tunnel URL %q: %w", client.GetURL(), err)
+		}
+		visit = newTCPVisitor(net.JoinHostPort("127.0.0.1", u.Port()), cfg.PayloadSize)
+	}
+
+	return drive(ctx, cfg, visit)
+}
+
+// visitor is called once per worker to set up its connection. It returns
+// a function that does one request through the tunnel and reports the
+// payload bytes moved, and one that releases the connection.
+type visitor func() (request func() (int64, error), closeFn func(), err error)
+
+// drive runs cfg.Concurrency workers until the duration elapses.
+func drive(ctx context.Context, cfg Config, visit visitor) (*Result, error) {
+	ctx, cancel := context.WithTimeout(ctx, cfg.Duration)
+	defer cancel()
+
+	var (
+		requests, errs, moved atomic.Int64
+		mu                    sync.Mutex
+		latencies             []time.Duration
+		wg                    sync.WaitGroup
+		firstErr              error
+		errOnce               sync.Once
+	)
+	fail := func(err error) {
+		errs.Add(1)
+		errOnce.Do(func() { firstErr = err })
+	}
+
+	start := time.Now()
+	for range cfg.Concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			request, closeFn, err := visit()
+			if err != nil {
+				fail(err)
+				return
+			}
+			defer closeFn()
+
+			local := make([]time.Duration, 0, 1024)
+			for ctx.Err() == nil {
+				t := time.Now()
+				n, err := request()
+				if err != nil {
+					if ctx.Err() == nil {
+						fail(err)
+					}
+					return
+				}
+				local = append(local, time.Since(t))
+				requests.Add(1)
+				moved.Add(n)
+			}
+
+			mu.Lock()
+			latencies = append(latencies, local...)
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	res := &Result{
+		Mode:        cfg.Mode,
+		Concurrency: cfg.Concurrency,
+		PayloadSize: cfg.PayloadSize,
+		Elapsed:     time.Since(start),
+		Requests:    requests.Load(),
+		Errors:      errs.Load(),
+		Bytes:       moved.Load(),
+	}
+	if firstErr != nil {
+		res.FirstError = firstErr.Error()
+	}
+	if len(latencies) == 0 {
+		return res, fmt.Errorf("no request completed through the tunnel: %w", firstErr)
+	}
+
+	slices.Sort(latencies)
+	res.P50 = percentile(latencies, 0.50)
+	res.P90 = percentile(latencies, 0.90)
+	res.P99 = percentile(latencies, 0.99)
+	res.Max = latencies[len(latencies)-1]
+	return res, nil
+}
+
+// percentile returns the q-th percentile of sorted latencies.
+func percentile(sorted []time.Duration, q float64) time.Duration {
+	i := int(q*float64(len(sorted))+0.5) - 1
+	return sorted[max(0, min(i, len(sorted)-1))]
+}
+
+type server struct {
+	addr     string
+	listener *servertcp.Listener
+}
+
+func startServer(logger *zap.Logger) (*server, error) {
+	cert, err := servertls.SelfSigned(domain, "*."+domain, "127.0.0.1")
+	if err != nil {
+		return nil, err
+	}
+	alloc, err := ports.NewAllocator(tcpPortMin, tcpPortMax)
+	if err != nil {
+		return nil, err
+	}
+
+	manager := tunnel.NewManager(logger)
+	handler := proxy.NewHandler(proxy.HandlerConfig{
+		Manager:      manager,
+		Logger:       logger,
+		ServerDomain: domain,
+		TunnelDomain: domain,
+	})
+	listener := servertcp.NewListener(servertcp.ListenerConfig{
+		Address: "127.0.0.1:0",
+		TLSConfig: &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			MinVersion:   tls.VersionTLS13,
+		},
+		Manager:      manager,
+		Logger:       logger,
+		PortAlloc:    alloc,
+		Domain:       domain,
+		TunnelDomain: domain,
+		HTTPHandler:  handler,
+	})
+	if err := listener.Start(); err != nil {
+		return nil, err
+	}
+
+	return &server{addr: listener.Addr().String(), listener: listener}, nil
+}
+
+func (s *server) close() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_ = s.listener.Shutdown(ctx)
+}
+
+// startBackend starts the local app the tunnel forwards to: an HTTP server
+// that echoes request bodies, or a TCP echo server.
+func startBackend(mode string) (net.Listener, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("failed to start bench backend: %w", err)
+	}
+
+	if mode == ModeHTTP {
+		srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// HTTP/1.x handlers must read the body before writing.
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+			_, _ = w.Write(body)
+		})}
+		go func() { _ = srv.Serve(ln) }()
+		return ln, nil
+	}
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				_, _ = io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return ln, nil
+}
+
+func newHTTPVisitor(serverAddr string, size int) visitor {
+	payload := bytes.Repeat([]byte("d"), size)
+	target := "https://" + subdomain + "." + domain + "/echo"
+
+	return func() (func() (int64, error), func(), error) {
+		transport := &http.Transport{
+			DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, network, serverAddr)
+			},
+			TLSClientConfig:     &tls.Config{InsecureSkipVerify: true},
+			MaxIdleConnsPerHost: 1,
+		}
+		client := &http.Client{Transport: transport, Timeout: 30 * time.Second}
+
+		request := func() (int64, error) {
+			resp, err := client.Post(target, "application/octet-stream", bytes.NewReader(payload))
+			if err != nil {
+				return 0, err
+			}
+			defer resp.Body.Close()
+			n, err := io.Copy(io.Discard, resp.Body)
+			if err != nil {
+				return 0, err
+			}
+			if resp.StatusCode != http.StatusOK || n != int64(size) {
+				return 0, fmt.Errorf("unexpected response: %s, %d bytes", resp.Status, n)
+			}
+			return int64(size) + n, nil
+		}
+		return request, transport.CloseIdleConnections, nil
+	}
+}
+
+func newTCPVisitor(addr string, size int) visitor {
+	payload := bytes.Repeat([]byte("d"), size)
+
+	return func() (func() (int64, error), func(), error) {
+		conn, err := net.DialTimeout("tcp", addr, 10*time.Second)
+		if err != nil {
+			return nil, nil, err
+		}
+		buf := make([]byte, size)
+
+		request := func() (int64, error) {
+			_ = conn.SetDeadline(time.Now().Add(30 * time.Second))
+			if _, err := conn.Write(payload); err != nil {
+				return 0, err
+			}
+			if _, err := io.ReadFull(conn, buf); err != nil {
+				return 0, err
+			}
+			return int64(2 * size), nil
+		}
+		return request, func() { _ = conn.Close() }, nil
+	}
+}
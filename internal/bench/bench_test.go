@@ -0,0 +1,58 @@
+package bench
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRun(t *testing.T) {
+	if testing.Short() {
+		t.Skip("starts a server and client")
+	}
+
+	for _, mode := range []string{ModeHTTP, ModeTCP} {
+		t.Run(mode, func(t *testing.T) {
+			res, err := Run(context.Background(), Config{
+				Mode:        mode,
+				Duration:    300 * time.Millisecond,
+				Concurrency: 4,
+				PayloadSize: 2048,
+			})
+			if err != nil {
+				t.Fatalf("Run() error: %v", err)
+			}
+			if res.Requests == 0 || res.Errors != 0 {
+				t.Errorf("Run() = %d requests, %d errors, want requests and no errors", res.Requests, res.Errors)
+			}
+			if res.Bytes != res.Requests*2*2048 {
+				t.Errorf("Bytes = %d, want %d", res.Bytes, res.Requests*2*2048)
+			}
+			if res.P50 <= 0 || res.P50 > res.P99 || res.P99 > res.Max {
+				t.Errorf("latencies out of order: p50 %v, p99 %v, max %v", res.P50, res.P99, res.Max)
+			}
+		})
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	sorted := make([]time.Duration, 100)
+	for i := range sorted {
+		sorted[i] = time.Duration(i+1) * time.Millisecond
+	}
+
+	tests := []struct {
+		q    float64
+		want time.Duration
+	}{
+		{0.50, 50 * time.Millisecond},
+		{0.99, 99 * time.Millisecond},
+		{1, 100 * time.Millisecond},
+		{0, time.Millisecond},
+	}
+	for _, tt := range tests {
+		if got := percentile(sorted, tt.q); got != tt.want {
+			t.Errorf("percentile(%v) = %v, want %v", tt.q, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,238 @@
+// Package cache answers conditional requests for unchanged local responses
+// on the client, so revalidations from many viewers do not all reach a slow
+// development server.
+package cache
+
+import (
+	"container/list"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultMaxEntries bounds how many URLs the cache remembers.
+const DefaultMaxEntries = 4096
+
+// notModifiedHeaders are copied from the stored response into a 304, as
+// listed in RFC 9110 section 15.4.5.
+var notModifiedHeaders = []string{
+	"Cache-Control", "Content-Location", "Date", "ETag", "Expires", "Last-Modified", "Vary",
+}
+
+type entry struct {
+	key          string
+	etag         string
+	lastModified time.Time
+	header       http.Header
+	storedAt     time.Time
+}
+
+// Transport remembers the validators of cacheable GET responses and
+// answers If-None-Match / If-Modified-Since requests with a 304 itself
+// while the entry is younger than the TTL. Only validators are stored,
+// never bodies.
+type Transport struct {
+	next       http.RoundTripper
+	ttl        time.Duration
+	maxEntries int
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+// NewTransport wraps next with a validator cache holding entries for ttl.
+func NewTransport(next http.RoundTripper, ttl time.Duration) *Transport {
+	return &Transport{
+		next:       next,
+		ttl:        ttl,
+		maxEntries: DefaultMaxEntries,
+		entries:    make(map[string]*list.Element),
+		lru:        list.New(),
+	}
+}
+
+// Stats returns how many conditional requests were answered locally and
+// how many had to be forwarded.
+func (t *Transport) Stats() (hits, misses uint64) {
+	return t.hits.Load(), t.misses.Load()
+}
+
+func cacheKey(req *http.Request) string {
+	return req.Host + req.URL.RequestURI()
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	key := cacheKey(req)
+
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		// Writes may change the resource.
+		t.remove(key)
+		return t.next.RoundTrip(req)
+	}
+
+	if isConditional(req) {
+		if e := t.lookup(key); e != nil && notModified(req, e) {
+			t.hits.Add(1)
+			return notModifiedResponse(req, e), nil
+		}
+		t.misses.Add(1)
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case req.Method != http.MethodGet:
+	case resp.StatusCode == http.StatusOK && cacheable(req, resp):
+		t.store(key, resp.Header)
+	case resp.StatusCode == http.StatusNotModified:
+		// The app confirmed the validators; keep them fresh.
+		t.touch(key)
+	default:
+		t.remove(key)
+	}
+	return resp, nil
+}
+
+func isConditional(req *http.Request) bool {
+	return req.Header.Get("If-None-Match") != "" || req.Header.Get("If-Modified-Since") != ""
+}
+
+// cacheable reports whether the response validators may be reused for
+// other visitors.
+func cacheable(req *http.Request, resp *http.Response) bool {
+	if req.Header.Get("Authorization") != "" || req.Header.Get("Cookie") != "" {
+		return false
+	}
+	if resp.Header.Get("Set-Cookie") != "" {
+		return false
+	}
+	cc := strings.ToLower(resp.Header.Get("Cache-Control"))
+	if strings.Contains(cc, "no-store") || strings.Contains(cc, "private") {
+		return false
+	}
+	// Representations that vary on request headers need a key per
+	// variant, which is not worth it here.
+	if v := resp.Header.Get("Vary"); v != "" && !strings.EqualFold(v, "Accept-Encoding") {
+		return false
+	}
+	return resp.Header.Get("ETag") != "" || resp.Header.Get("Last-Modified") != ""
+}
+
+// notModified evaluates the request preconditions against e. If-None-Match
+// takes precedence over If-Modified-Since (RFC 9110 section 13.2.2).
+func notModified(req *http.Request, e *entry) bool {
+	if inm := req.Header.Get("If-None-Match"); inm != "" {
+		if e.etag == "" {
+			return false
+		}
+		for _, tag := range strings.Split(inm, ",") {
+			tag = strings.TrimSpace(tag)
+			if tag == "*" || weakMatch(tag, e.etag) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if e.lastModified.IsZero() {
+		return false
+	}
+	since, err := http.ParseTime(req.Header.Get("If-Modified-Since"))
+	return err == nil && !e.lastModified.After(since)
+}
+
+func weakMatch(a, b string) bool {
+	return strings.TrimPrefix(a, "W/") == strings.TrimPrefix(b, "W/")
+}
+
+func notModifiedResponse(req *http.Request, e *entry) *http.Response {
+	header := make(http.Header)
+	for _, k := range notModifiedHeaders {
+		if v := e.header.Values(k); len(v) > 0 {
+			header[k] = v
+		}
+	}
+	header.Set("Date", time.Now().UTC().Format(http.TimeFormat))
+	return &http.Response{
+		Status:        "304 Not Modified",
+		StatusCode:    http.StatusNotModified,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          http.NoBody,
+		ContentLength: 0,
+		Request:       req,
+	}
+}
+
+func (t *Transport) lookup(key string) *entry {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	el, ok := t.entries[key]
+	if !ok {
+		return nil
+	}
+	e := el.Value.(*entry)
+	if time.Since(e.storedAt) > t.ttl {
+		t.lru.Remove(el)
+		delete(t.entries, key)
+		return nil
+	}
+	t.lru.MoveToFront(el)
+	return e
+}
+
+func (t *Transport) store(key string, header http.Header) {
+	e := &entry{
+		key:      key,
+		etag:     header.Get("ETag"),
+		header:   header.Clone(),
+		storedAt: time.Now(),
+	}
+	if lm, err := http.ParseTime(header.Get("Last-Modified")); err == nil {
+		e.lastModified = lm
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if el, ok := t.entries[key]; ok {
+		el.Value = e
+		t.lru.MoveToFront(el)
+		return
+	}
+	t.entries[key] = t.lru.PushFront(e)
+	for t.lru.Len() > t.maxEntries {
+		oldest := t.lru.Back()
+		t.lru.Remove(oldest)
+		delete(t.entries, oldest.Value.(*entry).key)
+	}
+}
+
+func (t *Transport) touch(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if el, ok := t.entries[key]; ok {
+		el.Value.(*entry).storedAt = time.Now()
+	}
+}
+
+func (t *Transport) remove(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if el, ok := t.entries[key]; ok {
+		t.lru.Remove(el)
+		delete(t.entries, key)
+	}
+}
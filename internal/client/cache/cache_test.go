@@ -0,0 +1,86 @@
+package cache
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTransportAnswersRevalidation(t *testing.T) {
+	var calls atomic.Int32
+	etag := `"v1"`
+	app := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if r.Method == http.MethodGet {
+			w.Header().Set("ETag", etag)
+		}
+		_, _ = w.Write([]byte("asset"))
+	}))
+	defer app.Close()
+
+	client := &http.Client{Transport: NewTransport(http.DefaultTransport, time.Minute)}
+	do := func(method, inm string) int {
+		req, _ := http.NewRequest(method, app.URL+"/app.js", nil)
+		if inm != "" {
+			req.Header.Set("If-None-Match", inm)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("%s request failed: %v", method, err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	steps := []struct {
+		name       string
+		method     string
+		inm        string
+		wantStatus int
+		wantCalls  int32
+	}{
+		{"first fetch reaches the app", http.MethodGet, "", http.StatusOK, 1},
+		{"matching revalidation is answered locally", http.MethodGet, `W/"v1"`, http.StatusNotModified, 1},
+		{"stale validator reaches the app", http.MethodGet, `"v0"`, http.StatusOK, 2},
+		{"write invalidates", http.MethodPost, "", http.StatusOK, 3},
+		{"revalidation after a write reaches the app", http.MethodGet, `"v1"`, http.StatusOK, 4},
+	}
+	for _, s := range steps {
+		if got := do(s.method, s.inm); got != s.wantStatus {
+			t.Errorf("%s: status = %d, want %d", s.name, got, s.wantStatus)
+		}
+		if got := calls.Load(); got != s.wantCalls {
+			t.Errorf("%s: app calls = %d, want %d", s.name, got, s.wantCalls)
+		}
+	}
+}
+
+func TestCacheable(t *testing.T) {
+	tests := []struct {
+		name       string
+		reqHeader  http.Header
+		respHeader http.Header
+		want       bool
+	}{
+		{"etag", nil, http.Header{"Etag": {`"a"`}}, true},
+		{"last modified", nil, http.Header{"Last-Modified": {"Mon, 02 Jan 2006 15:04:05 GMT"}}, true},
+		{"no validators", nil, http.Header{}, false},
+		{"no-store", nil, http.Header{"Etag": {`"a"`}, "Cache-Control": {"no-store"}}, false},
+		{"sets a cookie", nil, http.Header{"Etag": {`"a"`}, "Set-Cookie": {"s=1"}}, false},
+		{"authorized request", http.Header{"Authorization": {"Bearer x"}}, http.Header{"Etag": {`"a"`}}, false},
+		{"varies", nil, http.Header{"Etag": {`"a"`}, "Vary": {"Accept-Language"}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := &http.Request{Header: tt.reqHeader}
+			if req.Header == nil {
+				req.Header = http.Header{}
+			}
+			if got := cacheable(req, &http.Response{Header: tt.respHeader}); got != tt.want {
+				t.Errorf("cacheable() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -28,7 +28,7 @@ Examples:
   drip attach tcp 5432     Attach to TCP tunnel on port 5432
 
 Press Ctrl+C to detach (tunnel will continue running).`,
-	Aliases:       []string{"logs", "tail"},
+	Aliases:       []string{"tail"},
 	Args:          cobra.MaximumNArgs(2),
 	RunE:          runAttach,
 	SilenceUsage:  true,
@@ -62,8 +62,8 @@ func runAttach(_ *cobra.Command, args []string) error {
 
 	if len(args) == 2 {
 		tunnelType := args[0]
-		if tunnelType != "http" && tunnelType != "https" && tunnelType != "tcp" {
-			return fmt.Errorf("invalid tunnel type: %s (must be 'http', 'https', or 'tcp')", tunnelType)
+		if tunnelType != "http" && tunnelType != "https" && tunnelType != "tcp" && tunnelType != "tls" {
+			return fmt.Errorf("invalid tunnel type: %s (must be 'http', 'https', 'tcp', or 'tls')", tunnelType)
 		}
 
 		port, err := strconv.Atoi(args[1])
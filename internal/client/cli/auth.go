@@ -0,0 +1,265 @@
+package cli
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"drip/internal/client/credstore"
+	"drip/internal/shared/ui"
+	"drip/pkg/config"
+
+	"github.com/charmbracelet/x/term"
+	"github.com/spf13/cobra"
+)
+
+var authFile bool
+
+var authCmd = &cobra.Command{
+	Use:   "auth",
+	Short: "Manage the auth token",
+	Long: `Keep the auth token in the operating system's credential store instead of
+the config file:
+
+  macOS    Keychain
+  Linux    Secret Service (GNOME Keyring, KWallet) through secret-tool
+  Windows  DPAPI-encrypted file in ~/.drip/credentials
+
+Tokens are stored per server, so each profile can have its own. On headless
+machines without a credential store, use --file to keep the token in
+~/.drip/config.yaml as before.
+
+Examples:
+  drip auth login                          Prompt for the token of the current server
+  drip auth login --server tunnel.example.com:443
+  echo "$TOKEN" | drip auth login          Read the token from stdin
+  drip --profile staging auth login --file Store it in the config file
+  drip auth status
+  drip auth logout`,
+}
+
+var authLoginCmd = &cobra.Command{
+	Use:           "login",
+	Short:         "Store the auth token for a server",
+	Args:          cobra.NoArgs,
+	RunE:          runAuthLogin,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+}
+
+var authLogoutCmd = &cobra.Command{
+	Use:           "logout",
+	Short:         "Remove the stored auth token for a server",
+	Args:          cobra.NoArgs,
+	RunE:          runAuthLogout,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+}
+
+var authStatusCmd = &cobra.Command{
+	Use:           "status",
+	Short:         "Show where the auth token comes from",
+	Args:          cobra.NoArgs,
+	RunE:          runAuthStatus,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+}
+
+func init() {
+	authLoginCmd.Flags().BoolVar(&authFile, "file", false, "Store the token in the config file instead of the credential store")
+
+	authCmd.AddCommand(authLoginCmd, authLogoutCmd, authStatusCmd)
+	rootCmd.AddCommand(authCmd)
+}
+
+// loadAuthConfig returns the raw config file and the server the auth
+// commands act on: --server, or else the server of the selected profile.
+// A missing config file is only an error without --server.
+func loadAuthConfig() (*config.ClientConfig, string, error) {
+	raw, err := config.LoadClientConfig("")
+	if err != nil {
+		if serverURL == "" || config.ConfigExists("") {
+			return nil, "", err
+		}
+		return &config.ClientConfig{TLS: true}, serverURL, nil
+	}
+	if serverURL != "" {
+		return raw, serverURL, nil
+	}
+	cfg, err := raw.WithProfile(profileName)
+	if err != nil {
+		return nil, "", err
+	}
+	return raw, cfg.Server, nil
+}
+
+func runAuthLogin(_ *cobra.Command, _ []string) error {
+	raw, server, err := loadAuthConfig()
+	if err != nil {
+		return err
+	}
+
+	token := authToken
+	if token == "" {
+		if token, err = readToken(server); err != nil {
+			return err
+		}
+	}
+	if token == "" {
+		return fmt.Errorf("token is empty")
+	}
+
+	var where string
+	if authFile {
+		if !setFileToken(raw, server, token) {
+			if raw.Server != "" {
+				return fmt.Errorf("server %s is not in the configuration; set it with 'drip config set --server' or add a profile", server)
+			}
+			raw.Server, raw.Token = server, token
+		}
+		where = config.DefaultClientConfigPath()
+	} else {
+		store, err := credstore.New()
+		if err != nil {
+			return fmt.Errorf("%w; use --file to keep the token in the config file", err)
+		}
+		if err := store.Set(server, token); err != nil {
+			return fmt.Errorf("failed to store the token: %w", err)
+		}
+		// The plaintext copy would take precedence over the stored one.
+		setFileToken(raw, server, "")
+		if raw.Server == "" && len(raw.Profiles) == 0 {
+			raw.Server = server
+		}
+		raw.TokenStore = config.TokenStoreKeychain
+		where = store.Name()
+	}
+
+	if err := raw.Validate(); err != nil {
+		return err
+	}
+	if err := config.SaveClientConfig(raw, ""); err != nil {
+		return fmt.Errorf("failed to save configuration: %w", err)
+	}
+
+	fmt.Println(ui.Success("Token for " + server + " stored in " + where))
+	return nil
+}
+
+func runAuthLogout(_ *cobra.Command, _ []string) error {
+	raw, server, err := loadAuthConfig()
+	if err != nil {
+		return err
+	}
+
+	removed := false
+	if store, err := credstore.New(); err == nil {
+		switch err := store.Delete(server); {
+		case err == nil:
+			removed = true
+		case !errors.Is(err, credstore.ErrNotFound):
+			return fmt.Errorf("failed to remove the token: %w", err)
+		}
+	}
+	if fileToken(raw, server) != "" {
+		setFileToken(raw, server, "")
+		if err := config.SaveClientConfig(raw, ""); err != nil {
+			return fmt.Errorf("failed to save configuration: %w", err)
+		}
+		removed = true
+	}
+
+	if !removed {
+		fmt.Println(ui.Muted("No token stored for " + server))
+		return nil
+	}
+	fmt.Println(ui.Success("Token for " + server + " removed"))
+	return nil
+}
+
+func runAuthStatus(_ *cobra.Command, _ []string) error {
+	raw, server, err := loadAuthConfig()
+	if err != nil {
+		return err
+	}
+
+	store, storeErr := credstore.New()
+	backend := "unavailable"
+	if storeErr == nil {
+		backend = store.Name()
+	}
+
+	source := "none"
+	switch {
+	case authToken != "":
+		source = "--token flag"
+	case fileToken(raw, server) != "":
+		source = "config file"
+	case storeErr == nil:
+		if _, err := store.Get(server); err == nil {
+			source = backend
+		} else if !errors.Is(err, credstore.ErrNotFound) {
+			source = "error: " + err.Error()
+		}
+	}
+
+	fmt.Println(ui.KeyValue("Server", server))
+	fmt.Println(ui.KeyValue("Token", source))
+	fmt.Println(ui.KeyValue("Store", backend))
+	if source == "none" {
+		fmt.Println(ui.Muted("Run 'drip auth login' to store a token."))
+	}
+	return nil
+}
+
+// readToken prompts for the token without echoing it, or reads one line
+// from stdin when it is not a terminal.
+func readToken(server string) (string, error) {
+	if !term.IsTerminal(os.Stdin.Fd()) {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return "", fmt.Errorf("failed to read the token from stdin: %w", err)
+		}
+		return strings.TrimSpace(line), nil
+	}
+
+	fmt.Print(ui.Muted("Token for " + server + ": "))
+	b, err := term.ReadPassword(os.Stdin.Fd())
+	fmt.Println()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+// setFileToken sets the config file token of every entry, top-level or
+// profile, for server. It reports whether any entry matched.
+func setFileToken(raw *config.ClientConfig, server, token string) bool {
+	matched := false
+	if raw.Server == server {
+		raw.Token = token
+		matched = true
+	}
+	for _, p := range raw.Profiles {
+		if p.Server == server {
+			p.Token = token
+			matched = true
+		}
+	}
+	return matched
+}
+
+// fileToken returns the config file token for server, if any.
+func fileToken(raw *config.ClientConfig, server string) string {
+	if raw.Server == server && raw.Token != "" {
+		return raw.Token
+	}
+	for _, p := range raw.Profiles {
+		if p.Server == server && p.Token != "" {
+			return p.Token
+		}
+	}
+	return ""
+}
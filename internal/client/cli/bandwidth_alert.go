@@ -0,0 +1,115 @@
+package cli
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"drip/internal/client/tcp"
+	"drip/internal/shared/stats"
+	"drip/internal/shared/ui"
+
+	"go.uber.org/zap"
+)
+
+// bandwidthAlertInterval is how often tunnels without a live display check
+// their traffic against the alert.
+const bandwidthAlertInterval = 5 * time.Second
+
+// bandwidthAlert warns once the traffic of a tunnel session, in and out
+// together, passes a threshold, which matters on metered connections. With
+// pause it also stops forwarding traffic until the tunnel is restarted.
+type bandwidthAlert struct {
+	limit int64
+	pause bool
+	fired atomic.Bool
+}
+
+// newBandwidthAlert builds the alert for --alert-bandwidth and
+// --alert-pause. It returns nil when no threshold is set.
+func newBandwidthAlert(threshold string, pause bool) (*bandwidthAlert, error) {
+	if threshold == "" {
+		if pause {
+			return nil, fmt.Errorf("--alert-pause needs --alert-bandwidth")
+		}
+		return nil, nil
+	}
+	limit, err := parseBandwidth(threshold)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --alert-bandwidth %q: use a size like 500MB or 1GB", threshold)
+	}
+	if limit <= 0 {
+		return nil, fmt.Errorf("--alert-bandwidth must be positive")
+	}
+	return &bandwidthAlert{limit: limit, pause: pause}, nil
+}
+
+// threshold returns the alert threshold in bytes, 0 without an alert.
+func (a *bandwidthAlert) threshold() int64 {
+	if a == nil {
+		return 0
+	}
+	return a.limit
+}
+
+// check reports whether total has passed the threshold for the first time.
+func (a *bandwidthAlert) check(total int64) bool {
+	if a == nil || total < a.limit {
+		return false
+	}
+	return a.fired.CompareAndSwap(false, true)
+}
+
+// paused reports whether the alert has paused the tunnel.
+func (a *bandwidthAlert) paused() bool {
+	return a != nil && a.pause && a.fired.Load()
+}
+
+// apply pauses client if the alert already did so for the session, e.g.
+// after a reconnect.
+func (a *bandwidthAlert) apply(client tcp.TunnelClient, logger *zap.Logger) {
+	if !a.paused() {
+		return
+	}
+	if err := client.SetPaused(true); err != nil {
+		logger.Warn("Server did not pause the tunnel", zap.Error(err))
+	}
+}
+
+// trigger logs the alert and pauses client if asked to, returning the
+// message to show.
+func (a *bandwidthAlert) trigger(client tcp.TunnelClient, total int64, logger *zap.Logger) string {
+	logger.Warn("Bandwidth alert",
+		zap.Int64("bytes", total),
+		zap.Int64("threshold", a.limit),
+		zap.Bool("paused", a.pause),
+	)
+	msg := fmt.Sprintf("Session traffic passed %s (%s so far)", stats.FormatBytes(a.limit), stats.FormatBytes(total))
+	if a.pause {
+		a.apply(client, logger)
+		msg += "; tunnel paused, restart it to resume"
+	}
+	return msg
+}
+
+// watch checks the traffic of client until stop is closed, for tunnels
+// without a live display such as those of a multi-tunnel 'drip start'.
+func (a *bandwidthAlert) watch(client tcp.TunnelClient, name string, logger *zap.Logger, stop <-chan struct{}) {
+	if a == nil {
+		return
+	}
+	ticker := time.NewTicker(bandwidthAlertInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		total := client.GetStats().GetTotalBytes()
+		if a.check(total) {
+			fmt.Println(ui.Warning(fmt.Sprintf("%s: %s", name, a.trigger(client, total, logger))))
+			return
+		}
+	}
+}
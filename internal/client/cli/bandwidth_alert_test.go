@@ -0,0 +1,40 @@
+package cli
+
+import "testing"
+
+func TestBandwidthAlert(t *testing.T) {
+	tests := []struct {
+		threshold string
+		pause     bool
+		wantLimit int64
+		wantErr   bool
+	}{
+		{"", false, 0, false},
+		{"1GB", false, 1 << 30, false},
+		{"500M", true, 500 << 20, false},
+		{"", true, 0, true},
+		{"0", false, 0, true},
+		{"lots", false, 0, true},
+	}
+	for _, tt := range tests {
+		a, err := newBandwidthAlert(tt.threshold, tt.pause)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("newBandwidthAlert(%q, %v) error = %v, wantErr %v", tt.threshold, tt.pause, err, tt.wantErr)
+			continue
+		}
+		if got := a.threshold(); got != tt.wantLimit {
+			t.Errorf("newBandwidthAlert(%q).threshold() = %d, want %d", tt.threshold, got, tt.wantLimit)
+		}
+	}
+
+	a, _ := newBandwidthAlert("1K", true)
+	if a.check(1023) || a.paused() {
+		t.Error("alert fired below the threshold")
+	}
+	if !a.check(1024) || !a.paused() {
+		t.Error("alert did not fire at the threshold")
+	}
+	if a.check(4096) {
+		t.Error("alert fired twice")
+	}
+}
@@ -0,0 +1,135 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	json "github.com/goccy/go-json"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+
+	"drip/internal/bench"
+	"drip/internal/shared/stats"
+	"drip/internal/shared/ui"
+	"drip/internal/shared/utils"
+)
+
+var (
+	benchMode        string
+	benchDuration    time.Duration
+	benchConcurrency int
+	benchSize        string
+	benchJSON        bool
+)
+
+var benchCmd = &cobra.Command{
+	Use:   "bench",
+	Short: "Measure tunnel throughput and latency on this machine",
+	Long: `Run a server, a client and an echo backend in this process and push
+load through an HTTP or TCP tunnel between them. Reports requests per
+second, throughput and latency percentiles.
+
+Nothing leaves the machine, so the numbers show the cost of drip itself
+and are comparable between builds.
+
+Example:
+  drip bench                                  # HTTP and TCP, 10s each
+  drip bench --mode tcp --size 64K -c 8       # Bulk TCP round trips
+  drip bench --mode http --json > before.json`,
+	Args:          cobra.NoArgs,
+	RunE:          runBench,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+}
+
+func init() {
+	benchCmd.Flags().StringVar(&benchMode, "mode", "all", "Tunnel type to benchmark: http, tcp or all")
+	benchCmd.Flags().DurationVar(&benchDuration, "duration", 10*time.Second, "How long to generate load per tunnel type")
+	benchCmd.Flags().IntVarP(&benchConcurrency, "concurrency", "c", 32, "Concurrent visitors")
+	benchCmd.Flags().StringVar(&benchSize, "size", "1K", "Payload sent and echoed back per request (e.g., 512, 1K, 1M)")
+	benchCmd.Flags().BoolVar(&benchJSON, "json", false, "Print results as JSON")
+	rootCmd.AddCommand(benchCmd)
+}
+
+func runBench(_ *cobra.Command, _ []string) error {
+	modes := []string{bench.ModeHTTP, bench.ModeTCP}
+	switch benchMode {
+	case "all":
+	case bench.ModeHTTP, bench.ModeTCP:
+		modes = []string{benchMode}
+	default:
+		return fmt.Errorf("invalid --mode %q: use http, tcp or all", benchMode)
+	}
+
+	size, err := parseBandwidth(benchSize)
+	if err != nil || size <= 0 {
+		return fmt.Errorf("invalid --size %q", benchSize)
+	}
+	if benchDuration <= 0 || benchConcurrency <= 0 {
+		return fmt.Errorf("--duration and --concurrency must be positive")
+	}
+
+	var logger *zap.Logger
+	if verbose {
+		if err := utils.InitLogger(true); err != nil {
+			return fmt.Errorf("failed to initialize logger: %w", err)
+		}
+		logger = utils.GetLogger()
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	var results []*bench.Result
+	for _, mode := range modes {
+		if !benchJSON {
+			fmt.Println(ui.Muted(fmt.Sprintf("Benchmarking %s tunnel for %s with %d visitors...", mode, benchDuration, benchConcurrency)))
+		}
+		res, err := bench.Run(ctx, bench.Config{
+			Mode:        mode,
+			Duration:    benchDuration,
+			Concurrency: benchConcurrency,
+			PayloadSize: int(size),
+			Logger:      logger,
+		})
+		if err != nil {
+			return fmt.Errorf("%s benchmark failed: %w", mode, err)
+		}
+		results = append(results, res)
+		if !benchJSON {
+			fmt.Println(renderBenchResult(res))
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	if benchJSON {
+		data, err := json.MarshalIndent(results, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+	}
+	return nil
+}
+
+func renderBenchResult(r *bench.Result) string {
+	latency := func(d time.Duration) string {
+		return d.Round(time.Microsecond).String()
+	}
+	return ui.Info(
+		fmt.Sprintf("%s tunnel", r.Mode),
+		"",
+		ui.KeyValue("Requests", fmt.Sprintf("%d in %s (%d errors)", r.Requests, r.Elapsed.Round(time.Millisecond), r.Errors)),
+		ui.KeyValue("Rate", fmt.Sprintf("%.0f req/s", r.RequestsPerSecond())),
+		ui.KeyValue("Throughput", stats.FormatSpeed(int64(r.Throughput()))),
+		ui.KeyValue("Latency p50", latency(r.P50)),
+		ui.KeyValue("Latency p90", latency(r.P90)),
+		ui.KeyValue("Latency p99", latency(r.P99)),
+		ui.KeyValue("Latency max", latency(r.Max)),
+	)
+}
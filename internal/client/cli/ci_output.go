@@ -0,0 +1,162 @@
+package cli
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"drip/internal/client/middleware"
+	"drip/internal/client/tcp"
+	"drip/internal/shared/protocol"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// readyProbeHeader marks the request --wait-ready sends through the
+	// tunnel. The client answers it itself, so the local app never sees it.
+	readyProbeHeader = "X-Drip-Ready-Probe"
+
+	readyTimeout       = 30 * time.Second
+	readyProbeInterval = 500 * time.Millisecond
+	readyProbeTimeout  = 5 * time.Second
+)
+
+// publishURL writes the public URL wherever CI picks it up: the --url-file
+// env file and, under GitHub Actions, the step's $GITHUB_OUTPUT.
+func publishURL(publicURL, urlFile string) error {
+	if urlFile != "" {
+		if err := os.WriteFile(urlFile, []byte("DRIP_URL="+publicURL+"\n"), 0644); err != nil {
+			return fmt.Errorf("failed to write --url-file: %w", err)
+		}
+	}
+
+	if os.Getenv("GITHUB_ACTIONS") == "true" {
+		if path := os.Getenv("GITHUB_OUTPUT"); path != "" {
+			f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+			if err != nil {
+				return fmt.Errorf("failed to open $GITHUB_OUTPUT: %w", err)
+			}
+			_, err = fmt.Fprintf(f, "url=%s\n", publicURL)
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+			if err != nil {
+				return fmt.Errorf("failed to write $GITHUB_OUTPUT: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// readyProbe verifies that a tunnel is reachable through the server.
+type readyProbe struct {
+	nonce string
+}
+
+func newReadyProbe() *readyProbe {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return &readyProbe{nonce: hex.EncodeToString(b)}
+}
+
+// attach answers probe requests on the client so that an HTTP probe
+// succeeds only after a full round trip through the server.
+func (p *readyProbe) attach(cfg *tcp.ConnectorConfig, logger *zap.Logger) {
+	if p == nil || !cfg.TunnelType.IsHTTP() {
+		return
+	}
+	if cfg.Middleware == nil {
+		cfg.Middleware = middleware.NewChain(logger)
+	}
+	cfg.Middleware.OnRequest(func(req *http.Request) (*http.Response, error) {
+		if req.Header.Get(readyProbeHeader) != p.nonce {
+			return nil, nil
+		}
+		header := make(http.Header)
+		header.Set(readyProbeHeader, p.nonce)
+		return &http.Response{StatusCode: http.StatusNoContent, Header: header}, nil
+	})
+}
+
+// wait blocks until the public URL answers the probe or readyTimeout
+// passes. TCP tunnels only check that the public port accepts connections.
+func (p *readyProbe) wait(cfg *tcp.ConnectorConfig, publicURL string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), readyTimeout)
+	defer cancel()
+
+	check := p.checkHTTP(cfg, publicURL)
+	if cfg.TunnelType == protocol.TunnelTypeTCP {
+		check = p.checkTCP(publicURL)
+	}
+
+	ticker := time.NewTicker(readyProbeInterval)
+	defer ticker.Stop()
+
+	var lastErr error
+	for {
+		if lastErr = check(ctx); lastErr == nil {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("tunnel not reachable after %s: %w", readyTimeout, lastErr)
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p *readyProbe) checkHTTP(cfg *tcp.ConnectorConfig, publicURL string) func(context.Context) error {
+	client := &http.Client{
+		Timeout: readyProbeTimeout,
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: cfg.Insecure},
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	return func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, publicURL, nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set(readyProbeHeader, p.nonce)
+		if cfg.AuthBearer != "" {
+			req.Header.Set("Authorization", "Bearer "+cfg.AuthBearer)
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.Header.Get(readyProbeHeader) != p.nonce {
+			return fmt.Errorf("probe answered with %s before reaching the client", resp.Status)
+		}
+		return nil
+	}
+}
+
+func (p *readyProbe) checkTCP(publicURL string) func(context.Context) error {
+	return func(ctx context.Context) error {
+		u, err := url.Parse(publicURL)
+		if err != nil {
+			return err
+		}
+		d := net.Dialer{Timeout: readyProbeTimeout}
+		conn, err := d.DialContext(ctx, "tcp", u.Host)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+}
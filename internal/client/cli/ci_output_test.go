@@ -0,0 +1,40 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPublishURL(t *testing.T) {
+	dir := t.TempDir()
+	urlFile := filepath.Join(dir, "drip.env")
+	output := filepath.Join(dir, "github_output")
+	if err := os.WriteFile(output, []byte("other=1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("GITHUB_ACTIONS", "true")
+	t.Setenv("GITHUB_OUTPUT", output)
+
+	if err := publishURL("https://app.example.com", urlFile); err != nil {
+		t.Fatalf("publishURL() error = %v", err)
+	}
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{urlFile, "DRIP_URL=https://app.example.com\n"},
+		{output, "other=1\nurl=https://app.example.com\n"},
+	}
+	for _, tt := range tests {
+		got, err := os.ReadFile(tt.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != tt.want {
+			t.Errorf("%s = %q, want %q", filepath.Base(tt.path), got, tt.want)
+		}
+	}
+}
@@ -5,8 +5,10 @@ import (
 	"fmt"
 	"net"
 	"os"
+	"strconv"
 	"strings"
 
+	"drip/internal/shared/labels"
 	"drip/internal/shared/ui"
 	"drip/pkg/config"
 	"github.com/spf13/cobra"
@@ -66,10 +68,11 @@ var configValidateCmd = &cobra.Command{
 }
 
 var (
-	configFull   bool
-	configForce  bool
-	configServer string
-	configToken  string
+	configFull        bool
+	configForce       bool
+	configServer      string
+	configToken       string
+	configFingerprint string
 )
 
 func init() {
@@ -83,6 +86,7 @@ func init() {
 
 	configSetCmd.Flags().StringVar(&configServer, "server", "", "Server address (e.g., tunnel.example.com:443)")
 	configSetCmd.Flags().StringVar(&configToken, "token", "", "Authentication token")
+	configSetCmd.Flags().StringVar(&configFingerprint, "server-fingerprint", "", "Pinned server public key hash (sha256/<base64>, \"none\" to clear)")
 
 	configResetCmd.Flags().BoolVar(&configForce, "force", false, "Force reset without confirmation")
 
@@ -122,7 +126,7 @@ func runConfigInit(_ *cobra.Command, _ []string) error {
 }
 
 func runConfigShow(_ *cobra.Command, _ []string) error {
-	cfg, err := config.LoadClientConfig("")
+	cfg, err := loadClientConfig("")
 	if err != nil {
 		return err
 	}
@@ -146,17 +150,23 @@ func runConfigShow(_ *cobra.Command, _ []string) error {
 	}
 
 	fmt.Println(ui.RenderConfigShow(cfg.Server, displayToken, !configFull, cfg.TLS, config.DefaultClientConfigPath()))
+	if cfg.ServerFingerprint != "" {
+		fmt.Println(ui.KeyValue("Server Fingerprint", cfg.ServerFingerprint))
+	}
+	for _, r := range cfg.Regions {
+		fmt.Println(ui.KeyValue("Region "+r.Name, r.Server))
+	}
+	if len(cfg.Profiles) > 0 {
+		fmt.Println(ui.KeyValue("Profile", cfg.Profile))
+	}
 
 	// Show tunnels if configured
 	if len(cfg.Tunnels) > 0 {
 		fmt.Println()
 		fmt.Println(ui.Title("Configured Tunnels"))
 		for _, t := range cfg.Tunnels {
-			addr := t.Address
-			if addr == "" {
-				addr = "127.0.0.1"
-			}
-			fmt.Printf("  %-12s %-6s %s:%d", t.Name, t.Type, addr, t.Port)
+			addr := net.JoinHostPort(getAddress(t), strconv.Itoa(t.Port))
+			fmt.Printf("  %-12s %-6s %s", t.Name, t.Type, addr)
 			if t.Subdomain != "" {
 				fmt.Printf("  subdomain=%s", t.Subdomain)
 			}
@@ -169,6 +179,18 @@ func runConfigShow(_ *cobra.Command, _ []string) error {
 			if len(t.DenyIPs) > 0 {
 				fmt.Printf("  deny=%s", strings.Join(t.DenyIPs, ","))
 			}
+			if len(t.AllowCountries) > 0 {
+				fmt.Printf("  allow_countries=%s", strings.Join(t.AllowCountries, ","))
+			}
+			if len(t.DenyCountries) > 0 {
+				fmt.Printf("  deny_countries=%s", strings.Join(t.DenyCountries, ","))
+			}
+			if t.AlertBandwidth != "" {
+				fmt.Printf("  alert_bandwidth=%s", t.AlertBandwidth)
+			}
+			if len(t.Labels) > 0 {
+				fmt.Printf("  labels=%s", labels.Format(t.Labels))
+			}
 			fmt.Println()
 		}
 	}
@@ -184,23 +206,55 @@ func runConfigSet(_ *cobra.Command, _ []string) error {
 		}
 	}
 
+	// Write into the profile the other commands would read: --profile, or
+	// else the current one.
+	server, token, fingerprint := &cfg.Server, &cfg.Token, &cfg.ServerFingerprint
+	name := profileName
+	if name == "" {
+		name = cfg.Profile
+	}
+	if name != "" && name != config.DefaultProfile {
+		p := cfg.Profiles[name]
+		if p == nil {
+			return fmt.Errorf("profile '%s' not found", name)
+		}
+		server, token, fingerprint = &p.Server, &p.Token, &p.ServerFingerprint
+	}
+
 	modified := false
 	var updates []string
 
 	if configServer != "" {
-		cfg.Server = configServer
+		*server = configServer
 		modified = true
 		updates = append(updates, "Server updated: "+configServer)
 	}
 
 	if configToken != "" {
-		cfg.Token = configToken
+		*token = configToken
 		modified = true
 		updates = append(updates, "Token updated")
 	}
 
+	if configFingerprint != "" {
+		if configFingerprint == "none" {
+			*fingerprint = ""
+			updates = append(updates, "Server fingerprint cleared")
+		} else {
+			if _, err := config.ParseFingerprint(configFingerprint); err != nil {
+				return err
+			}
+			*fingerprint = configFingerprint
+			updates = append(updates, "Server fingerprint pinned")
+		}
+		modified = true
+	}
+
 	if !modified {
-		return fmt.Errorf("no changes specified. Use --server or --token")
+		return fmt.Errorf("no changes specified. Use --server, --token or --server-fingerprint")
+	}
+	if name != "" && name != config.DefaultProfile {
+		updates = append(updates, "Profile: "+name)
 	}
 
 	if err := config.SaveClientConfig(cfg, ""); err != nil {
@@ -242,18 +296,28 @@ func runConfigReset(_ *cobra.Command, _ []string) error {
 }
 
 func runConfigValidate(_ *cobra.Command, _ []string) error {
-	cfg, err := config.LoadClientConfig("")
+	raw, err := config.LoadClientConfig("")
 	if err != nil {
 		fmt.Println(ui.Error("Failed to load configuration"))
 		return err
 	}
+	cfg, err := raw.WithProfile(profileName)
+	if err != nil {
+		return err
+	}
 
-	serverValid, serverMsg := validateServerAddress(cfg.Server)
-	tokenSet := cfg.Token != ""
+	server := cfg.Server
+	if server == "" && len(cfg.Regions) > 0 {
+		server = cfg.Regions[0].Server
+	}
+	serverValid, serverMsg := validateServerAddress(server)
+	tokenSet := cfg.Token != "" || cfg.TokenStore == config.TokenStoreKeychain
 	tlsEnabled := cfg.TLS
 
 	tokenMsg := "Token is set"
-	if !tokenSet {
+	if cfg.Token == "" && tokenSet {
+		tokenMsg = "Token is kept in the system credential store"
+	} else if !tokenSet {
 		tokenMsg = "Token is not set (authentication may fail)"
 	}
 
@@ -0,0 +1,45 @@
+package cli
+
+import (
+	"testing"
+
+	"drip/pkg/config"
+)
+
+func TestConfigSetWritesSelectedProfile(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	initial := &config.ClientConfig{
+		Server: "tunnel.example.com:443",
+		Token:  "default-token",
+		TLS:    true,
+		Profiles: map[string]*config.Profile{
+			"staging": {Server: "staging.example.com:443", Token: "staging-token"},
+		},
+	}
+	if err := config.SaveClientConfig(initial, ""); err != nil {
+		t.Fatalf("SaveClientConfig() error = %v", err)
+	}
+
+	oldProfile, oldToken := profileName, configToken
+	t.Cleanup(func() { profileName, configToken = oldProfile, oldToken })
+	profileName, configToken = "staging", "new-token"
+
+	if err := runConfigSet(nil, nil); err != nil {
+		t.Fatalf("runConfigSet() error = %v", err)
+	}
+	cfg, err := config.LoadClientConfig("")
+	if err != nil {
+		t.Fatalf("LoadClientConfig() error = %v", err)
+	}
+	if cfg.Token != "default-token" {
+		t.Errorf("default token = %q, want it left alone", cfg.Token)
+	}
+	if got := cfg.Profiles["staging"].Token; got != "new-token" {
+		t.Errorf("staging token = %q, want new-token", got)
+	}
+
+	profileName = "missing"
+	if err := runConfigSet(nil, nil); err == nil {
+		t.Error("runConfigSet() with an unknown profile succeeded")
+	}
+}
@@ -0,0 +1,147 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+
+	json "github.com/goccy/go-json"
+	"github.com/spf13/cobra"
+
+	"drip/internal/conformance"
+	servertls "drip/internal/server/tls"
+	"drip/internal/shared/ui"
+)
+
+var (
+	conformanceClient  bool
+	conformanceListen  string
+	conformanceVectors bool
+	conformanceJSON    bool
+)
+
+var conformanceCmd = &cobra.Command{
+	Use:   "protocol-test",
+	Short: "Check that a server or client speaks the drip protocol",
+	Long: `Check a server or client against the drip tunnel protocol: the golden
+frame encodings, the registration and control stream handshakes, the
+multiplexed session and a request carried through the tunnel.
+
+By default the server from your configuration or --server is checked,
+with a short-lived HTTP tunnel. With --client, a mock server waits for
+one client to connect and checks it instead; point any client at it with
+--insecure. Exits non-zero if a check fails, so it can gate upgrades and
+third-party implementations in CI.
+
+Example:
+  drip protocol-test                                  Check the configured server
+  drip protocol-test -s tunnel.example.com:443 -t T   Check another server
+  drip protocol-test --client --listen :9443          Check the next client that connects
+  drip protocol-test --vectors                        Only check this build's frame encoding`,
+	Args:          cobra.NoArgs,
+	RunE:          runConformance,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+}
+
+func init() {
+	conformanceCmd.Flags().BoolVar(&conformanceClient, "client", false, "Check a client instead of a server")
+	conformanceCmd.Flags().StringVar(&conformanceListen, "listen", "127.0.0.1:8443", "Address the mock server listens on with --client")
+	conformanceCmd.Flags().BoolVar(&conformanceVectors, "vectors", false, "Only check the golden frame encodings, without a peer")
+	conformanceCmd.Flags().BoolVar(&conformanceJSON, "json", false, "Print results as JSON")
+	rootCmd.AddCommand(conformanceCmd)
+}
+
+func runConformance(_ *cobra.Command, _ []string) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	results := conformance.CheckVectors()
+	switch {
+	case conformanceVectors:
+	case conformanceClient:
+		res, err := checkConformanceClient(ctx)
+		if err != nil {
+			return err
+		}
+		results = append(results, res...)
+	default:
+		serverAddr, token, err := resolveServer("protocol-test")
+		if err != nil {
+			return err
+		}
+		if !conformanceJSON {
+			fmt.Println(ui.Muted("Checking " + serverAddr + "..."))
+		}
+		results = append(results, conformance.CheckServer(ctx, conformance.ServerConfig{
+			Addr:     serverAddr,
+			Token:    token,
+			Insecure: insecure,
+			Version:  Version,
+		})...)
+	}
+
+	if conformanceJSON {
+		data, err := json.MarshalIndent(results, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+	} else {
+		printConformanceResults(results)
+	}
+
+	if failed := conformance.Count(results, conformance.StatusFail); failed > 0 {
+		return fmt.Errorf("%d of %d conformance checks failed", failed, len(results))
+	}
+	return nil
+}
+
+func checkConformanceClient(ctx context.Context) ([]conformance.Result, error) {
+	host, _, err := net.SplitHostPort(conformanceListen)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --listen address %q: %w", conformanceListen, err)
+	}
+	if host == "" {
+		host = "localhost"
+	}
+	cert, err := servertls.SelfSigned(host, "localhost", "127.0.0.1")
+	if err != nil {
+		return nil, err
+	}
+	ln, err := net.Listen("tcp", conformanceListen)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", conformanceListen, err)
+	}
+	defer ln.Close()
+
+	if !conformanceJSON {
+		fmt.Println(ui.Muted(fmt.Sprintf("Waiting for a client on %s, e.g. drip http 3000 --server %s --insecure", ln.Addr(), ln.Addr())))
+	}
+	return conformance.CheckClient(ctx, conformance.ClientConfig{
+		Listener:    ln,
+		Certificate: cert,
+		Version:     Version,
+	}), nil
+}
+
+func printConformanceResults(results []conformance.Result) {
+	for _, r := range results {
+		var status string
+		switch r.Status {
+		case conformance.StatusPass:
+			status = ui.Success("pass")
+		case conformance.StatusFail:
+			status = ui.Error("fail")
+		default:
+			status = ui.Warning("skip")
+		}
+		fmt.Printf("%s %s %s\n", status, r.Name, ui.Muted(r.Detail))
+	}
+	fmt.Println(ui.Muted(fmt.Sprintf("%d checks: %d passed, %d failed, %d skipped", len(results),
+		conformance.Count(results, conformance.StatusPass),
+		conformance.Count(results, conformance.StatusFail),
+		conformance.Count(results, conformance.StatusSkip))))
+}
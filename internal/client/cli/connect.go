@@ -0,0 +1,314 @@
+package cli
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"drip/internal/client/p2p"
+	"drip/internal/client/proxy"
+	"drip/internal/shared/e2e"
+	"drip/internal/shared/mux"
+	"drip/internal/shared/netutil"
+	"drip/internal/shared/pool"
+	"drip/internal/shared/protocol"
+	"drip/internal/shared/ui"
+	"drip/pkg/config"
+
+	"github.com/spf13/cobra"
+)
+
+// p2pConnectTimeout bounds rendezvous plus hole punching before a
+// connection falls back to the relay.
+const p2pConnectTimeout = 8 * time.Second
+
+var (
+	connectLocalPort    int
+	connectLocalAddress string
+)
+
+var connectCmd = &cobra.Command{
+	Use:   "connect <tunnel-name|host:port>",
+	Short: "Consume a remote TCP tunnel through a local port",
+	Long: `Expose a remote TCP tunnel as a local listener.
+
+Every local connection is forwarded to the tunnel's public address. Given
+a tunnel name instead of host:port, connections go through the configured
+drip server (authenticated with your token) without needing the tunnel's
+public port. With
+--e2e-key, traffic is encrypted end to end with the exposing client
+(started with 'drip tcp <port> --e2e-key'), so the relay server only
+sees ciphertext. The relay can still try to guess the key offline, so use
+a random one, e.g. from 'openssl rand -hex 32'.
+
+With --p2p, each connection first tries a direct peer-to-peer path to an
+exposing client started with 'drip tcp <port> --p2p', coordinated by the
+configured drip server, and falls back to the relay if NAT traversal fails.
+
+Example:
+  drip connect tunnel.example.com:20001 --local 5432
+  drip connect mydb --local 5432
+  drip connect tunnel.example.com:20001 --local 5432 --e2e-key $KEY
+  drip connect tunnel.example.com:20001 --local 5432 --p2p`,
+	Args:          cobra.ExactArgs(1),
+	RunE:          runConnect,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+}
+
+func init() {
+	connectCmd.Flags().IntVarP(&connectLocalPort, "local", "l", 0, "Local port to listen on (required)")
+	connectCmd.Flags().StringVarP(&connectLocalAddress, "address", "a", "127.0.0.1", "Local address to listen on")
+	connectCmd.Flags().BoolVar(&p2pMode, "p2p", false, "Try a direct peer-to-peer connection before using the server relay")
+	connectCmd.Flags().StringVar(&e2eKey, "e2e-key", getEnvString("DRIP_E2E_KEY", ""), "End-to-end encryption key shared with the exposing client (env: DRIP_E2E_KEY)")
+	rootCmd.AddCommand(connectCmd)
+}
+
+func runConnect(_ *cobra.Command, args []string) error {
+	remoteAddr := args[0]
+	var (
+		remotePort int
+		route      *serverRoute
+	)
+	if strings.Contains(remoteAddr, ":") {
+		_, portStr, err := net.SplitHostPort(remoteAddr)
+		if err != nil {
+			return fmt.Errorf("invalid tunnel address %q: expected host:port or a tunnel name", remoteAddr)
+		}
+		if remotePort, err = strconv.Atoi(portStr); err != nil {
+			return fmt.Errorf("invalid tunnel port %q", portStr)
+		}
+	} else {
+		if p2pMode {
+			return fmt.Errorf("--p2p needs the tunnel's host:port, not a tunnel name")
+		}
+		server, token, tlsConfig, err := consumerServer("connecting by tunnel name")
+		if err != nil {
+			return err
+		}
+		proxyDialer, err := resolveProxy()
+		if err != nil {
+			return err
+		}
+		route = &serverRoute{server: server, token: token, tlsConfig: tlsConfig, tunnel: remoteAddr, proxy: proxyDialer}
+	}
+	if connectLocalPort < 1 || connectLocalPort > 65535 {
+		return fmt.Errorf("--local must be a port between 1 and 65535")
+	}
+	if e2eKey != "" {
+		if err := e2e.ValidateSecret(e2eKey); err != nil {
+			return err
+		}
+	}
+
+	var rv *p2p.Rendezvous
+	if p2pMode {
+		var err error
+		if rv, err = newRendezvous(); err != nil {
+			return err
+		}
+	}
+
+	listenAddr := net.JoinHostPort(connectLocalAddress, strconv.Itoa(connectLocalPort))
+	ln, err := net.Listen("tcp", listenAddr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", listenAddr, err)
+	}
+	defer ln.Close()
+
+	mode := "relayed"
+	if p2pMode {
+		mode = "direct, relay fallback"
+	}
+	if route != nil {
+		mode = "through " + route.server
+	}
+	if e2eKey != "" {
+		mode += ", end-to-end encrypted"
+	}
+	fmt.Println(ui.SuccessBox("Connected",
+		ui.KeyValue("Local", listenAddr),
+		ui.KeyValue("Remote", remoteAddr),
+		ui.KeyValue("Mode", mode),
+	))
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go func() {
+		<-ctx.Done()
+		_ = ln.Close()
+	}()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, net.ErrClosed) {
+				fmt.Println(ui.RenderShuttingDown())
+				return nil
+			}
+			return err
+		}
+		go forwardConnect(ctx, conn, remoteAddr, remotePort, rv, route)
+	}
+}
+
+func forwardConnect(ctx context.Context, local net.Conn, remoteAddr string, remotePort int, rv *p2p.Rendezvous, route *serverRoute) {
+	defer local.Close()
+
+	var remote net.Conn
+	if rv != nil {
+		punchCtx, cancel := context.WithTimeout(ctx, p2pConnectTimeout)
+		conn, err := p2p.Dial(punchCtx, rv, remotePort)
+		cancel()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, ui.Muted(fmt.Sprintf("Direct connection unavailable, using relay: %v", err)))
+		} else {
+			remote = conn
+		}
+	}
+
+	if remote == nil && route != nil {
+		conn, err := route.dial(ctx)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, ui.Error(fmt.Sprintf("Connect to tunnel %s failed: %v", remoteAddr, err)))
+			return
+		}
+		remote = conn
+	}
+
+	if remote == nil {
+		conn, err := net.DialTimeout("tcp", remoteAddr, 10*time.Second)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, ui.Error(fmt.Sprintf("Dial %s failed: %v", remoteAddr, err)))
+			return
+		}
+		remote = conn
+	}
+	defer remote.Close()
+
+	if e2eKey != "" {
+		secured, err := e2e.Client(remote, e2eKey)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, ui.Error(err.Error()))
+			return
+		}
+		remote = secured
+	}
+
+	_ = netutil.PipeWithBufferSize(ctx, local, remote, pool.SizeLarge)
+}
+
+// newRendezvous builds the rendezvous settings from the same server, token and
+// TLS options used for exposing tunnels.
+func newRendezvous() (*p2p.Rendezvous, error) {
+	server, token, tlsConfig, err := consumerServer("--p2p")
+	if err != nil {
+		return nil, err
+	}
+	return &p2p.Rendezvous{
+		ServerAddr: server,
+		TLSConfig:  tlsConfig,
+		Token:      token,
+	}, nil
+}
+
+// consumerServer resolves the drip server, token and TLS settings a
+// consumer uses, from the same flags and config as exposing tunnels. need
+// names what requires the server, for the error when none is configured.
+func consumerServer(need string) (string, string, *tls.Config, error) {
+	server, token := serverURL, authToken
+	if server == "" {
+		cfg, err := loadClientConfig("")
+		if err != nil || cfg.Server == "" {
+			return "", "", nil, fmt.Errorf("%s needs a drip server: run 'drip config init' or pass --server", need)
+		}
+		server, token = cfg.Server, cfg.Token
+	}
+
+	host, _, err := net.SplitHostPort(server)
+	if err != nil {
+		return "", "", nil, fmt.Errorf("invalid server address %q: %w", server, err)
+	}
+
+	fingerprint, err := resolveServerFingerprint()
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	var tlsConfig *tls.Config
+	switch {
+	case fingerprint != "":
+		pin, _ := config.ParseFingerprint(fingerprint)
+		tlsConfig = config.GetClientTLSConfigPinned(host, pin)
+	case insecure:
+		tlsConfig = config.GetClientTLSConfigInsecure()
+	default:
+		tlsConfig = config.GetClientTLSConfig(host)
+	}
+	return server, token, tlsConfig, nil
+}
+
+// serverRoute reaches a TCP tunnel by name through the drip server's own
+// port, for tunnels whose public port is unknown or not reachable.
+type serverRoute struct {
+	server    string
+	token     string
+	tlsConfig *tls.Config
+	tunnel    string
+	proxy     *proxy.Dialer
+}
+
+// dial opens a connection to the tunnel through the server. Once it
+// returns, the connection carries the tunnel's raw TCP stream.
+func (r *serverRoute) dial(ctx context.Context) (net.Conn, error) {
+	dialCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	conn, err := r.proxy.DialTLSContext(dialCtx, r.server, r.tlsConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	_ = conn.SetDeadline(time.Now().Add(10 * time.Second))
+	req := "GET " + protocol.ConnectPath + "?tunnel=" + url.QueryEscape(r.tunnel) + " HTTP/1.1\r\n" +
+		"Host: " + r.server + "\r\n" +
+		"Upgrade: " + protocol.ConnectUpgrade + "\r\n" +
+		"Connection: Upgrade\r\n"
+	if r.token != "" {
+		req += "Authorization: Bearer " + r.token + "\r\n"
+	}
+	if _, err := io.WriteString(conn, req+"\r\n"); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 256))
+		_ = conn.Close()
+		return nil, fmt.Errorf("server refused tunnel %q: %s: %s", r.tunnel, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	_ = conn.SetDeadline(time.Time{})
+
+	if br.Buffered() > 0 {
+		return mux.NewBufferedConn(conn, br), nil
+	}
+	return conn, nil
+}
@@ -5,23 +5,31 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
 	"time"
 
 	"drip/internal/shared/ui"
-	"drip/pkg/config"
 	json "github.com/goccy/go-json"
 )
 
 // DaemonInfo stores information about a running daemon process
 type DaemonInfo struct {
 	PID        int       `json:"pid"`
-	Type       string    `json:"type"`       // "http" or "tcp"
+	Type       string    `json:"type"`       // "http", "https", "tcp" or "tls"
 	Port       int       `json:"port"`       // Local port being tunneled
 	Subdomain  string    `json:"subdomain"`  // Subdomain if specified
 	Server     string    `json:"server"`     // Server address
 	URL        string    `json:"url"`        // Tunnel URL
 	StartTime  time.Time `json:"start_time"` // When the daemon started
 	Executable string    `json:"executable"` // Path to the executable
+
+	Labels map[string]string `json:"labels,omitempty"` // From --label
+
+	// Traffic of the session, recorded every few seconds while connected
+	BytesIn  int64 `json:"bytes_in,omitempty"`
+	BytesOut int64 `json:"bytes_out,omitempty"`
+	SpeedIn  int64 `json:"speed_in,omitempty"`
+	SpeedOut int64 `json:"speed_out,omitempty"`
 }
 
 // getDaemonDir returns the directory for storing daemon info
@@ -198,30 +206,40 @@ func StartDaemon(tunnelType string, port int, args []string) error {
 	_ = devNull.Close()
 
 	localHost := parseFlagValue(cleanArgs, "--address", "-a", "127.0.0.1")
-	displayHost := localHost
-	if displayHost == "127.0.0.1" {
-		displayHost = "localhost"
-	}
-	forwardAddr := fmt.Sprintf("%s:%d", displayHost, port)
+	forwardAddr := displayLocalAddr(localHost, port)
 
 	serverAddr := parseFlagValue(cleanArgs, "--server", "-s", "")
 	if serverAddr == "" {
-		if cfg, err := config.LoadClientConfig(""); err == nil {
+		if cfg, err := loadClientConfig(""); err == nil {
 			serverAddr = cfg.Server
 		}
 	}
 
 	var url string
 
-	info, err := waitForDaemonInfo(tunnelType, port, cmd.Process.Pid, 30*time.Second)
+	// With --wait-ready the child only records its URL once the tunnel is
+	// reachable, so give it time to probe and fail if it never does.
+	waitReady := slices.Contains(cleanArgs, "--wait-ready")
+	timeout := 30 * time.Second
+	if waitReady {
+		timeout += readyTimeout
+	}
+
+	info, err := waitForDaemonInfo(tunnelType, port, cmd.Process.Pid, timeout)
 	if err == nil && info != nil && info.PID == cmd.Process.Pid && info.URL != "" {
 		url = info.URL
 		if info.Server != "" {
 			serverAddr = info.Server
 		}
 	}
+	if waitReady && url == "" {
+		return fmt.Errorf("tunnel did not become ready, see %s", logPath)
+	}
 
 	fmt.Println(ui.RenderDaemonStarted(tunnelType, port, cmd.Process.Pid, logPath, url, forwardAddr, serverAddr))
+	// The child has no say over this terminal's desktop session, so the
+	// parent shares the URL itself.
+	shareURL(url, copyURL, openURL)
 
 	return nil
 }
@@ -0,0 +1,107 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"drip/internal/shared/ui"
+)
+
+// errNoDesktop is returned on Linux and BSD machines without a graphical
+// session, e.g. over SSH, where there is no browser or clipboard to use.
+var errNoDesktop = errors.New("no graphical session (DISPLAY and WAYLAND_DISPLAY are unset)")
+
+// openBrowser opens url in the default browser without waiting for it.
+func openBrowser(url string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", url)
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", url)
+	default:
+		if !hasDesktop() {
+			return errNoDesktop
+		}
+		cmd = exec.Command("xdg-open", url)
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	go func() { _ = cmd.Wait() }()
+	return nil
+}
+
+// copyToClipboard places text on the system clipboard.
+func copyToClipboard(text string) error {
+	name, args, err := clipboardCommand()
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(name, args...)
+	cmd.Stdin = strings.NewReader(text)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		if msg := strings.TrimSpace(string(out)); msg != "" {
+			return fmt.Errorf("%s: %s", name, msg)
+		}
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
+
+// clipboardCommand returns the command that copies its stdin to the
+// clipboard on this machine.
+func clipboardCommand() (string, []string, error) {
+	switch runtime.GOOS {
+	case "darwin":
+		return "pbcopy", nil, nil
+	case "windows":
+		return "clip", nil, nil
+	}
+	if !hasDesktop() {
+		return "", nil, errNoDesktop
+	}
+	candidates := [][]string{
+		{"xclip", "-selection", "clipboard"},
+		{"xsel", "--clipboard", "--input"},
+	}
+	if os.Getenv("WAYLAND_DISPLAY") != "" {
+		candidates = append([][]string{{"wl-copy"}}, candidates...)
+	}
+	for _, c := range candidates {
+		if _, err := exec.LookPath(c[0]); err == nil {
+			return c[0], c[1:], nil
+		}
+	}
+	return "", nil, errors.New("no clipboard tool found, install wl-clipboard, xclip or xsel")
+}
+
+func hasDesktop() bool {
+	return os.Getenv("DISPLAY") != "" || os.Getenv("WAYLAND_DISPLAY") != ""
+}
+
+// shareURL copies url to the clipboard and opens it in the browser as
+// asked by --copy and --open. Failures are only reported: the tunnel works
+// without either.
+func shareURL(url string, copyIt, openIt bool) {
+	if url == "" {
+		return
+	}
+	if copyIt {
+		// TCP and TLS clients want host:port rather than a URL.
+		if err := copyToClipboard(strings.TrimPrefix(strings.TrimPrefix(url, "tcp://"), "tls://")); err != nil {
+			fmt.Println(ui.Warning(fmt.Sprintf("Could not copy the URL: %v", err)))
+		} else {
+			fmt.Println(ui.Muted("URL copied to the clipboard"))
+		}
+	}
+	if openIt {
+		if err := openBrowser(url); err != nil {
+			fmt.Println(ui.Warning(fmt.Sprintf("Could not open a browser: %v", err)))
+		}
+	}
+}
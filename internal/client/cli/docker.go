@@ -0,0 +1,163 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"drip/internal/client/docker"
+	"drip/internal/client/supervisor"
+	"drip/internal/client/tcp"
+	"drip/internal/shared/protocol"
+	"drip/internal/shared/tuning"
+	"drip/internal/shared/ui"
+	"drip/internal/shared/utils"
+
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+var (
+	dockerHost     string
+	dockerPorts    []int
+	dockerType     string
+	dockerInterval time.Duration
+)
+
+var dockerCmd = &cobra.Command{
+	Use:   "docker <container>",
+	Short: "Expose the ports of a running Docker container",
+	Long: `Inspect a running container and open a tunnel for each of its TCP ports.
+
+Published ports are reached through their host binding; ports that are only
+exposed are reached on the container's IP, which works when drip runs on the
+Docker host or on the same Docker network. Tunnels are named after the
+container and port (e.g. web:80), closed when the container stops, reopened
+when it starts again, and drip exits once the container is removed.
+
+Example:
+  drip docker web
+  drip docker web --port 80 --port 8081
+  drip docker postgres --type tcp`,
+	Args:          cobra.ExactArgs(1),
+	RunE:          runDocker,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+}
+
+func init() {
+	dockerCmd.Flags().StringVar(&dockerHost, "docker-host", "", "Docker daemon address, unix:// or tcp:// (default: $DOCKER_HOST or the local socket)")
+	dockerCmd.Flags().IntSliceVarP(&dockerPorts, "port", "p", nil, "Container ports to expose (default: all TCP ports, repeatable)")
+	dockerCmd.Flags().StringVarP(&dockerType, "type", "t", "http", "Tunnel type for every port: http, https or tcp")
+	dockerCmd.Flags().DurationVar(&dockerInterval, "interval", docker.DefaultInterval, "How often to check the container")
+	rootCmd.AddCommand(dockerCmd)
+}
+
+func runDocker(_ *cobra.Command, args []string) error {
+	container := args[0]
+
+	var tunnelType protocol.TunnelType
+	switch dockerType {
+	case "http":
+		tunnelType = protocol.TunnelTypeHTTP
+	case "https":
+		tunnelType = protocol.TunnelTypeHTTPS
+	case "tcp":
+		tunnelType = protocol.TunnelTypeTCP
+	default:
+		return fmt.Errorf("invalid --type %q: must be http, https or tcp", dockerType)
+	}
+	for _, p := range dockerPorts {
+		if p < 1 || p > 65535 {
+			return fmt.Errorf("invalid --port %d: must be between 1 and 65535", p)
+		}
+	}
+	if dockerInterval < time.Second {
+		return fmt.Errorf("--interval must be at least 1s")
+	}
+
+	serverAddr, token, err := resolveServer("docker " + container)
+	if err != nil {
+		return err
+	}
+	fingerprint, err := resolveServerFingerprint()
+	if err != nil {
+		return err
+	}
+	proxyDialer, err := resolveProxy()
+	if err != nil {
+		return err
+	}
+
+	client, err := docker.NewClient(dockerHost)
+	if err != nil {
+		return err
+	}
+	ctr, err := client.Inspect(context.Background(), container)
+	if errors.Is(err, docker.ErrNotFound) {
+		return fmt.Errorf("container %q not found", container)
+	}
+	if err != nil {
+		return err
+	}
+	if !ctr.State.Running {
+		return fmt.Errorf("container %q is not running", ctr.Name)
+	}
+
+	tuning.ApplyMode(tuning.ModeClient)
+	if err := utils.InitLogger(verbose); err != nil {
+		return fmt.Errorf("failed to initialize logger: %w", err)
+	}
+	defer utils.Sync()
+
+	logger := utils.GetLogger()
+	defer watchLogLevelSignal(logger)()
+
+	proxyDialer.SetLogger(logger)
+	tunnels := supervisor.New(logger)
+	tunnels.SetProxy(proxyDialer)
+	tunnels.SetEventHandler(func(ev supervisor.Event) {
+		switch {
+		case ev.Up:
+			fmt.Println(ui.KeyValue(ev.Name, ui.URL(ev.URL)))
+		case ev.Err != nil:
+			logger.Warn("Tunnel failed to connect", zap.String("tunnel", ev.Name), zap.Error(ev.Err))
+		}
+	})
+
+	base := tcp.ConnectorConfig{
+		ServerAddr:        serverAddr,
+		Token:             token,
+		TunnelType:        tunnelType,
+		Insecure:          insecure,
+		ServerFingerprint: fingerprint,
+		FallbackAddrs:     serverFallbacks,
+		DrainTimeout:      drainTimeout,
+		PowerSave:         powerSave,
+		Chaos:             chaosConfig,
+	}
+
+	fmt.Println(ui.Info("Watching Docker container",
+		ui.KeyValue("Container", ctr.Name),
+		ui.KeyValue("Server", serverAddr),
+		ui.KeyValue("Type", dockerType),
+	))
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Watch by ID so a new container reusing the name is not picked up.
+	err = docker.NewWatcher(client, ctr.ID, dockerPorts, dockerInterval, base, tunnels, logger).Run(ctx)
+	tunnels.Close()
+
+	if errors.Is(err, docker.ErrNotFound) {
+		fmt.Println(ui.Muted(fmt.Sprintf("Container %s was removed", ctr.Name)))
+		return nil
+	}
+	fmt.Println(ui.RenderShuttingDown())
+	return err
+}
@@ -0,0 +1,74 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// envAliases are further variables read for a flag, after the one named
+// after it.
+var envAliases = map[string][]string{
+	"server": {"DRIP_SERVER_ADDR"},
+	"token":  {"DRIP_AUTH_TOKEN"},
+}
+
+// envName returns the variable that sets a flag: --tcp-port-min is
+// DRIP_TCP_PORT_MIN.
+func envName(flag string) string {
+	return "DRIP_" + strings.ToUpper(strings.ReplaceAll(flag, "-", "_"))
+}
+
+// envNames returns every variable read for a flag, in order.
+func envNames(flag string) []string {
+	return append([]string{envName(flag)}, envAliases[flag]...)
+}
+
+// skipEnv reports whether a flag has no variable.
+func skipEnv(f *pflag.Flag) bool {
+	return f.Hidden || f.Name == "help"
+}
+
+// applyEnv sets the flags of cmd not given on the command line from their
+// variables, so containers can be configured without building flag
+// strings. A flag set this way counts as given, which keeps the
+// precedence flags, then variables, then the config file, then defaults.
+func applyEnv(cmd *cobra.Command) error {
+	var err error
+	cmd.Flags().VisitAll(func(f *pflag.Flag) {
+		if err != nil || f.Changed || skipEnv(f) {
+			return
+		}
+		for _, name := range envNames(f.Name) {
+			value, ok := os.LookupEnv(name)
+			if !ok || value == "" {
+				continue
+			}
+			if setErr := cmd.Flags().Set(f.Name, value); setErr != nil {
+				err = fmt.Errorf("invalid %s: %w", name, setErr)
+			}
+			return
+		}
+	})
+	return err
+}
+
+// documentEnv adds the variables of each flag to its help text, for flags
+// whose usage does not name them already.
+func documentEnv(cmd *cobra.Command) {
+	document := func(f *pflag.Flag) {
+		if skipEnv(f) || strings.Contains(f.Usage, "(env: ") {
+			return
+		}
+		f.Usage += " (env: " + strings.Join(envNames(f.Name), ", ") + ")"
+	}
+	// Not LocalFlags, which would merge in the parents' flags early.
+	cmd.Flags().VisitAll(document)
+	cmd.PersistentFlags().VisitAll(document)
+	for _, sub := range cmd.Commands() {
+		documentEnv(sub)
+	}
+}
@@ -0,0 +1,51 @@
+package cli
+
+import (
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+func TestApplyEnv(t *testing.T) {
+	t.Setenv("DRIP_TCP_PORT_MIN", "2000")
+	t.Setenv("DRIP_SERVER_ADDR", "tunnel.example.com:443")
+	t.Setenv("DRIP_ALLOW_IP", "10.0.0.0/8,192.168.0.1")
+	t.Setenv("DRIP_TOKEN", "from-env")
+
+	var (
+		portMin       int
+		server, token string
+		allow         []string
+	)
+	cmd := &cobra.Command{Use: "test"}
+	cmd.Flags().IntVar(&portMin, "tcp-port-min", 1000, "")
+	cmd.Flags().StringVar(&server, "server", "", "")
+	cmd.Flags().StringVar(&token, "token", "", "")
+	cmd.Flags().StringSliceVar(&allow, "allow-ip", nil, "")
+	if err := cmd.ParseFlags([]string{"--token", "from-flag"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := applyEnv(cmd); err != nil {
+		t.Fatalf("applyEnv() = %v", err)
+	}
+	if portMin != 2000 || !cmd.Flags().Changed("tcp-port-min") {
+		t.Errorf("tcp-port-min = %d, want 2000 and marked as set", portMin)
+	}
+	if server != "tunnel.example.com:443" {
+		t.Errorf("server = %q, want the DRIP_SERVER_ADDR value", server)
+	}
+	if len(allow) != 2 {
+		t.Errorf("allow-ip = %q, want two entries", allow)
+	}
+	if token != "from-flag" {
+		t.Errorf("token = %q, want the flag to win over DRIP_TOKEN", token)
+	}
+
+	t.Setenv("DRIP_TCP_PORT_MIN", "many")
+	cmd = &cobra.Command{Use: "test"}
+	cmd.Flags().IntVar(&portMin, "tcp-port-min", 1000, "")
+	if err := applyEnv(cmd); err == nil {
+		t.Error("applyEnv() accepted an invalid DRIP_TCP_PORT_MIN")
+	}
+}
@@ -0,0 +1,152 @@
+package cli
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"drip/internal/client/middleware"
+	"drip/internal/client/tcp"
+
+	"go.uber.org/zap"
+)
+
+// exitCondition ends a tunnel on its own once it has served its purpose,
+// so CI jobs do not need a wrapper script to kill drip.
+type exitCondition struct {
+	untilPath   string
+	maxRequests int64
+	maxDuration time.Duration
+
+	requests  atomic.Int64
+	startOnce sync.Once
+	doneOnce  sync.Once
+	done      chan struct{}
+	reason    string
+	err       error
+}
+
+// newExitCondition builds the condition for --until-request and --exit-after.
+// It returns nil when neither flag is set.
+func newExitCondition(untilPath, exitAfter string, httpTunnel bool) (*exitCondition, error) {
+	if untilPath == "" && exitAfter == "" {
+		return nil, nil
+	}
+
+	e := &exitCondition{done: make(chan struct{})}
+
+	if untilPath != "" {
+		if !httpTunnel {
+			return nil, fmt.Errorf("--until-request is only supported for http and https tunnels")
+		}
+		if !strings.HasPrefix(untilPath, "/") {
+			return nil, fmt.Errorf("--until-request must be a path starting with '/'")
+		}
+		e.untilPath = untilPath
+	}
+
+	if exitAfter != "" {
+		n, d, err := parseExitAfter(exitAfter)
+		if err != nil {
+			return nil, err
+		}
+		if n > 0 && !httpTunnel {
+			return nil, fmt.Errorf("--exit-after with a request count is only supported for http and https tunnels; use a duration")
+		}
+		e.maxRequests, e.maxDuration = n, d
+	}
+
+	return e, nil
+}
+
+// parseExitAfter accepts either a request count ("10") or a duration ("5m").
+func parseExitAfter(s string) (int64, time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		if n <= 0 {
+			return 0, 0, fmt.Errorf("--exit-after must be positive")
+		}
+		return n, 0, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid --exit-after %q: want a request count or a duration like 10m", s)
+	}
+	if d <= 0 {
+		return 0, 0, fmt.Errorf("--exit-after must be positive")
+	}
+	return 0, d, nil
+}
+
+// attach makes the tunnel report requests to the condition.
+func (e *exitCondition) attach(cfg *tcp.ConnectorConfig, logger *zap.Logger) {
+	if e == nil || (e.untilPath == "" && e.maxRequests == 0) {
+		return
+	}
+	if cfg.Middleware == nil {
+		cfg.Middleware = middleware.NewChain(logger)
+	}
+	cfg.Middleware.OnRequest(func(req *http.Request) (*http.Response, error) {
+		e.observe(req)
+		return nil, nil
+	})
+}
+
+// start begins the --exit-after duration. Later calls are no-ops so that
+// reconnects do not reset it.
+func (e *exitCondition) start() {
+	if e == nil || e.maxDuration == 0 {
+		return
+	}
+	e.startOnce.Do(func() {
+		time.AfterFunc(e.maxDuration, func() {
+			e.limitReached(fmt.Sprintf("%s elapsed", e.maxDuration))
+		})
+	})
+}
+
+func (e *exitCondition) observe(req *http.Request) {
+	if e.untilPath != "" && req.URL.Path == e.untilPath {
+		e.finish(fmt.Sprintf("received %s %s", req.Method, req.URL.Path), nil)
+		return
+	}
+	if n := e.requests.Add(1); e.maxRequests > 0 && n >= e.maxRequests {
+		e.limitReached(fmt.Sprintf("served %d requests", n))
+	}
+}
+
+// limitReached ends the run once --exit-after is hit. It is a failure only
+// when the run was waiting for --until-request.
+func (e *exitCondition) limitReached(reason string) {
+	var err error
+	if e.untilPath != "" {
+		err = fmt.Errorf("%s without a request to %s", reason, e.untilPath)
+	}
+	e.finish(reason, err)
+}
+
+func (e *exitCondition) finish(reason string, err error) {
+	e.doneOnce.Do(func() {
+		e.reason, e.err = reason, err
+		close(e.done)
+	})
+}
+
+// Done is closed once the condition is met. It is nil, and never fires,
+// for a nil condition.
+func (e *exitCondition) Done() <-chan struct{} {
+	if e == nil {
+		return nil
+	}
+	return e.done
+}
+
+// Result returns why the run ended and whether that counts as a failure.
+// It is only meaningful after Done is closed.
+func (e *exitCondition) Result() (string, error) {
+	return e.reason, e.err
+}
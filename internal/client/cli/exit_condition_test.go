@@ -0,0 +1,71 @@
+package cli
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestExitCondition(t *testing.T) {
+	tests := []struct {
+		name      string
+		until     string
+		exitAfter string
+		paths     []string
+		wantDone  bool
+		wantErr   bool
+	}{
+		{"until request seen", "/done", "", []string{"/", "/done"}, true, false},
+		{"until request not seen yet", "/done", "", []string{"/", "/other"}, false, false},
+		{"request limit", "", "2", []string{"/", "/"}, true, false},
+		{"request limit before until request", "/done", "2", []string{"/", "/"}, true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := newExitCondition(tt.until, tt.exitAfter, true)
+			if err != nil {
+				t.Fatalf("newExitCondition() error = %v", err)
+			}
+			for _, path := range tt.paths {
+				e.observe(httptest.NewRequest("GET", path, nil))
+			}
+
+			select {
+			case <-e.Done():
+				if !tt.wantDone {
+					t.Fatal("condition met, want still waiting")
+				}
+				if _, err := e.Result(); (err != nil) != tt.wantErr {
+					t.Errorf("Result() error = %v, wantErr %v", err, tt.wantErr)
+				}
+			default:
+				if tt.wantDone {
+					t.Fatal("condition not met")
+				}
+			}
+		})
+	}
+}
+
+func TestNewExitConditionValidation(t *testing.T) {
+	tests := []struct {
+		name       string
+		until      string
+		exitAfter  string
+		httpTunnel bool
+	}{
+		{"relative path", "done", "", true},
+		{"until request on tcp", "/done", "", false},
+		{"request count on tcp", "", "10", false},
+		{"zero count", "", "0", true},
+		{"garbage", "", "soon", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newExitCondition(tt.until, tt.exitAfter, tt.httpTunnel); err == nil {
+				t.Errorf("newExitCondition(%q, %q) = nil error, want error", tt.until, tt.exitAfter)
+			}
+		})
+	}
+}
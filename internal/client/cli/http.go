@@ -4,9 +4,15 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"time"
 
+	"drip/internal/client/middleware"
+	"drip/internal/client/notify"
 	"drip/internal/client/tcp"
+	"drip/internal/shared/httputil"
+	"drip/internal/shared/labels"
 	"drip/internal/shared/protocol"
+	"drip/internal/shared/schedule"
 
 	"github.com/spf13/cobra"
 )
@@ -18,27 +24,100 @@ var (
 	localAddress string
 	allowIPs     []string
 	denyIPs      []string
+	allowCountry []string
+	denyCountry  []string
 	authPass     string
 	authBearer   string
 	transport    string
 	bandwidth    string
+	rateLimit    string
+	alertBW      string
+	alertPause   bool
+	requestRules []string
+	visitorRPS   float64
+	visitorBurst int
+	hstsMaxAge   time.Duration
+	tls13Only    bool
+	clientCAFile string
+	signSecret   string
+	requestStore int
+	maxBody      string
+	maxRespBody  string
+	e2eKey       string
+	p2pMode      bool
+	private      bool
+	compressSSE  bool
+	cacheTTL     time.Duration
+	execHooks    []string
+	notifyURLs   []string
+	tunnelTTL    time.Duration
+	scheduleSpec string
+	untilRequest string
+	exitAfter    string
+	urlFile      string
+	waitReady    bool
+	openURL      bool
+	copyURL      bool
+	subStyle     string
+	labelArgs    []string
+	harPath      string
+	harMaxBody   string
+	rewriteHost  bool
+	rewriteHTML  bool
+	cookieFixes  []string
+	corsOrigins  []string
+	backendAddrs []string
+	balance      string
+	healthCheck  string
+	shadowAddr   string
+	maxInFlight  int
+	maxQueue     int
+	retries      int
+	retryBackoff time.Duration
+	retryMethods []string
 )
 
 var httpCmd = &cobra.Command{
-	Use:   "http <port>",
+	Use:   "http <port|host:port>",
 	Short: "Start HTTP tunnel",
 	Long: `Start an HTTP tunnel to expose a local HTTP server.
 
 Example:
   drip http 3000                    Tunnel localhost:3000
+  drip http 3000 --open --copy      Open the URL in a browser and copy it
   drip http 8080 --subdomain myapp  Use custom subdomain
+  drip http 192.168.1.20:8080       Tunnel a service on another machine
+  drip http "[::1]:3000"            Tunnel a service listening on IPv6 localhost
   drip http 3000 --allow-ip 192.168.0.0/16  Only allow IPs from 192.168.x.x
   drip http 3000 --allow-ip 10.0.0.1        Allow single IP
   drip http 3000 --deny-ip 1.2.3.4          Block specific IP
+  drip http 3000 --allow-country DE,AT,CH   Only allow visitors from these countries
   drip http 3000 --auth secret              Enable proxy authentication with password
   drip http 3000 --auth-bearer sk-xxx       Enable proxy authentication with bearer token
   drip http 3000 --transport wss            Use WebSocket over TLS (CDN-friendly)
   drip http 3000 --bandwidth 1M             Limit bandwidth to 1 MB/s
+  drip http 3000 --rate 1MBps               Cap this machine's tunnel traffic at 1 MB/s
+  drip http 3000 --alert-bandwidth 1GB --alert-pause         Stop serving after 1 GB on a metered connection
+  drip http 3000 --rule "deny path=/wp-admin"                Block a path at the edge
+  drip http 3000 --rule "allow method=POST path=/webhook"    Only allow webhook deliveries
+  drip http 3000 --visitor-rps 5 --visitor-burst 20          Rate limit each visitor IP
+  drip http 3000 --max-body 10M                              Refuse uploads over 10 MB with a 413 at the server
+  drip http 3000 --compress-streams                          Compress Server-Sent Events to the server
+  drip http 3000 --cache-ttl 30s                             Answer repeat revalidations without hitting the app
+  drip http 3000 --hook ./mock-api.sh                        Rewrite or mock requests with a script
+  drip http 3000 --rewrite-html                              Fix http://localhost:3000 links for visitors
+  drip http 3000 --cookie-rewrite domain,samesite=none       Keep session cookies working through the tunnel
+  drip http 8080 --cors https://app.vercel.app               Call a local API from a deployed frontend
+  drip http 3000 --notify slack:https://hooks.slack.com/...  Share the URL in a Slack channel
+  drip http 3000 --har session.har                           Record traffic for dev tools or 'drip replay'
+  drip http 3000 --backend 3001,3002 --health-check /healthz Spread requests over three local instances
+  drip http 3000 --shadow 3001                               Mirror requests to a new version on :3001
+  drip http 3000 --max-inflight 20 --max-queue 50            Answer 503 instead of piling up requests on a slow app
+  drip http 3000 --retries 5                                 Ride out app restarts instead of failing with 502
+  drip http 3000 --ttl 2h                                    Preview environment that closes itself after 2 hours
+  drip http 3000 --schedule "Mon-Fri 09:00-18:00 UTC"       Demo that is not reachable overnight
+  drip http 3000 --until-request /done --exit-after 10m      CI: exit 0 on the callback, 1 if it never comes
+  drip http 3000 -d --wait-ready --url-file .drip.env        CI: start in the background once reachable
 
 Configuration:
   First time: Run 'drip config init' to save server and token
@@ -49,11 +128,23 @@ Transport options:
   tcp   - Direct TLS 1.3 connection
   wss   - WebSocket over TLS (works through CDN like Cloudflare)
 
-Bandwidth format:
+Bandwidth format (--bandwidth, --rate):
   1K, 1KB  - 1 kilobyte per second (1024 bytes/s)
   1M, 1MB  - 1 megabyte per second (1048576 bytes/s)
   1G, 1GB  - 1 gigabyte per second
-  1024     - 1024 bytes per second (raw number)`,
+  1024     - 1024 bytes per second (raw number)
+  1MBps    - same as 1M, a "ps" or "/s" suffix is optional
+
+Request rules (--rule, repeatable, first match wins):
+  <allow|deny> [method=GET,POST] [path=/prefix or /glob/*] [ua=regex]
+  If any allow rule is present, unmatched requests are denied.
+
+Hooks (--hook, repeatable):
+  Each hook runs once per request and once per response with a JSON object
+  on stdin: {"phase", "method", "url", "header", "body", "status"}.
+  It may print {"set_header": {...}, "del_header": [...]} to rewrite headers,
+  or, in the request phase, {"response": {"status", "header", "body"}} to
+  answer without contacting the local app. Empty output changes nothing.`,
 	Args:          cobra.ExactArgs(1),
 	RunE:          runHTTP,
 	SilenceUsage:  true,
@@ -62,48 +153,203 @@ Bandwidth format:
 
 func init() {
 	httpCmd.Flags().StringVarP(&subdomain, "subdomain", "n", "", "Custom subdomain (optional)")
+	httpCmd.Flags().StringVar(&subStyle, "subdomain-style", "", "Style of the generated subdomain: hex, words (calm-amber-otter), prefix (<user>-3f9a2c) or prefix:<name> (default: the server's)")
+	httpCmd.Flags().StringArrayVar(&labelArgs, "label", nil, "Label the tunnel with key=value, e.g. team=payments; repeatable, shown by drip list and the server's stats")
 	httpCmd.Flags().BoolVarP(&daemonMode, "daemon", "d", false, "Run in background (daemon mode)")
 	httpCmd.Flags().StringVarP(&localAddress, "address", "a", "127.0.0.1", "Local address to forward to (default: 127.0.0.1)")
 	httpCmd.Flags().StringSliceVar(&allowIPs, "allow-ip", nil, "Allow only these IPs or CIDR ranges (e.g., 192.168.1.1,10.0.0.0/8)")
 	httpCmd.Flags().StringSliceVar(&denyIPs, "deny-ip", nil, "Deny these IPs or CIDR ranges (e.g., 1.2.3.4,192.168.1.0/24)")
+	httpCmd.Flags().StringSliceVar(&allowCountry, "allow-country", nil, "Allow only visitors from these countries (ISO codes, e.g., US,DE); needs a server with a GeoIP database")
+	httpCmd.Flags().StringSliceVar(&denyCountry, "deny-country", nil, "Deny visitors from these countries (ISO codes, e.g., US,DE); needs a server with a GeoIP database")
 	httpCmd.Flags().StringVar(&authPass, "auth", "", "Password for proxy authentication")
 	httpCmd.Flags().StringVar(&authBearer, "auth-bearer", "", "Bearer token for proxy authentication")
 	httpCmd.Flags().StringVar(&transport, "transport", "auto", "Transport protocol: auto, tcp, wss (WebSocket over TLS)")
 	httpCmd.Flags().StringVar(&bandwidth, "bandwidth", "", "Bandwidth limit (e.g., 1M, 500K, 1G)")
+	httpCmd.Flags().StringVar(&rateLimit, "rate", "", "Cap the tunnel's traffic in and out together on this machine, e.g. 1MBps (for shared uplinks)")
+	httpCmd.Flags().StringVar(&alertBW, "alert-bandwidth", "", "Warn once the session's traffic in and out passes this size, e.g. 1GB (for metered connections)")
+	httpCmd.Flags().BoolVar(&alertPause, "alert-pause", false, "Also pause the tunnel when --alert-bandwidth is reached")
+	httpCmd.Flags().Float64Var(&visitorRPS, "visitor-rps", 0, "Requests per second allowed per visitor IP (0 = unlimited)")
+	httpCmd.Flags().IntVar(&visitorBurst, "visitor-burst", 0, "Burst size for --visitor-rps (default: rps rounded up)")
+	httpCmd.Flags().DurationVar(&hstsMaxAge, "hsts", 0, "Have the server add Strict-Transport-Security with this max-age to responses, e.g. 8760h")
+	httpCmd.Flags().BoolVar(&tls13Only, "tls13-only", false, "Have the server refuse visitors that cannot use TLS 1.3")
+	httpCmd.Flags().StringVar(&clientCAFile, "client-ca", "", "Have the server require visitor certificates issued by the CAs in this PEM bundle")
+	httpCmd.Flags().StringVar(&signSecret, "sign-secret", "", "Have the server sign request bodies with this secret (HMAC-SHA256 in X-Drip-Signature) so the local app can verify them")
+	httpCmd.Flags().IntVar(&requestStore, "request-store", 0, "Have the server keep the last N requests, also while this client is away, for 'drip replay --tunnel' with the same token (max 100)")
+	httpCmd.Flags().StringVar(&maxBody, "max-body", "", "Have the server answer requests with larger bodies with a 413 instead of forwarding them, e.g. 10M (cannot exceed the server's limit)")
+	httpCmd.Flags().StringVar(&maxRespBody, "max-response-body", "", "Answer responses of the local service with larger bodies with a 502, e.g. 100M")
+	httpCmd.Flags().BoolVar(&compressSSE, "compress-streams", false, "Compress streaming responses (SSE, NDJSON) between this client and the server")
+	httpCmd.Flags().DurationVar(&cacheTTL, "cache-ttl", 0, "Answer revalidation requests for unchanged responses with 304 on the client for this long (0 = disabled)")
+	httpCmd.Flags().BoolVar(&rewriteHost, "rewrite-host", false, "Point redirects and cookie domains for the local address at the public URL")
+	httpCmd.Flags().BoolVar(&rewriteHTML, "rewrite-html", false, "Like --rewrite-host, and also rewrite local links in HTML pages")
+	httpCmd.Flags().StringSliceVar(&cookieFixes, "cookie-rewrite", nil, "Normalize Set-Cookie attributes for the public host: domain, secure, samesite=<lax|strict|none>")
+	httpCmd.Flags().StringSliceVar(&corsOrigins, "cors", nil, "Answer CORS preflights and add CORS headers for these origins (* for any, https://*.example.com for subdomains)")
+	httpCmd.Flags().Lookup("cors").NoOptDefVal = "*"
+	httpCmd.Flags().StringArrayVar(&execHooks, "hook", nil, "Shell command run for every request and response; reads JSON on stdin and may print header changes or a mock response")
+	httpCmd.Flags().StringSliceVar(&backendAddrs, "backend", nil, "More local addresses (<port|host:port>) to spread requests over, e.g. 3001,3002")
+	httpCmd.Flags().StringVar(&balance, "balance", tcp.BalanceRoundRobin, "How requests are spread over --backend addresses: round-robin, least-conn")
+	httpCmd.Flags().StringVar(&healthCheck, "health-check", "", "Path probed on each backend every 5s, e.g. /healthz; failing backends are skipped (default: TCP connect)")
+	httpCmd.Flags().IntVar(&retries, "retries", 0, "Retry a failed dial to the local service this many times, e.g. while it restarts")
+	httpCmd.Flags().DurationVar(&retryBackoff, "retry-backoff", tcp.DefaultRetryBackoff, "Wait before the first retry, doubled after each")
+	httpCmd.Flags().StringSliceVar(&retryMethods, "retry-methods", nil, "HTTP methods retried (default: GET,HEAD,OPTIONS,PUT,DELETE)")
+	httpCmd.Flags().IntVar(&maxInFlight, "max-inflight", 0, "Most requests forwarded to the local service at once (0 = unlimited)")
+	httpCmd.Flags().IntVar(&maxQueue, "max-queue", 100, "Requests that may wait for --max-inflight; more get a 503 with Retry-After")
+	httpCmd.Flags().StringVar(&shadowAddr, "shadow", "", "Mirror every request to this local <port|host:port> in the background; its responses are discarded")
+	httpCmd.Flags().StringVar(&harPath, "har", "", "Record proxied requests and responses to this HAR file")
+	httpCmd.Flags().StringVar(&harMaxBody, "har-max-body", "1M", "Largest request or response body kept in the HAR file; longer bodies are truncated")
+	httpCmd.Flags().StringArrayVar(&requestRules, "rule", nil, "Request filtering rule evaluated at the server (e.g., \"deny path=/wp-admin\")")
+	httpCmd.Flags().DurationVar(&tunnelTTL, "ttl", 0, "Close the tunnel automatically after this long, e.g. 2h (enforced by the server, 0 = never)")
+	httpCmd.Flags().StringVar(&scheduleSpec, "schedule", "", "Only accept visitors in these windows, e.g. \"Mon-Fri 09:00-18:00 Europe/Berlin\" (enforced by the server)")
+	httpCmd.Flags().StringVar(&untilRequest, "until-request", "", "Exit once a request for this path arrives, e.g. /done (for CI jobs)")
+	httpCmd.Flags().StringVar(&exitAfter, "exit-after", "", "Exit after this many requests or this long, e.g. 10 or 5m; fails if --until-request was not seen")
+	httpCmd.Flags().StringVar(&urlFile, "url-file", "", "Write the public URL to this file as DRIP_URL=<url> once the tunnel is up")
+	httpCmd.Flags().BoolVar(&waitReady, "wait-ready", false, "Only report the URL once it is verified reachable through the server")
+	httpCmd.Flags().BoolVar(&openURL, "open", false, "Open the public URL in the default browser once the tunnel is up")
+	httpCmd.Flags().BoolVar(&copyURL, "copy", false, "Copy the public URL to the clipboard once the tunnel is up")
+	httpCmd.Flags().StringArrayVar(&notifyURLs, "notify", nil, "Post the public URL to a chat webhook when the tunnel is up, e.g. slack:https://hooks.slack.com/... or discord:https://discord.com/api/webhooks/...")
 	httpCmd.Flags().BoolVar(&daemonMarker, "daemon-child", false, "Internal flag for daemon child process")
 	httpCmd.Flags().MarkHidden("daemon-child")
 	rootCmd.AddCommand(httpCmd)
 }
 
 func runHTTP(_ *cobra.Command, args []string) error {
-	port, err := strconv.Atoi(args[0])
-	if err != nil || port < 1 || port > 65535 {
-		return fmt.Errorf("invalid port number: %s", args[0])
+	localHost, port, err := parseLocalTarget(args[0], localAddress)
+	if err != nil {
+		return err
+	}
+	backends, err := parseBackends(localHost)
+	if err != nil {
+		return err
+	}
+	shadow, err := parseShadow(localHost)
+	if err != nil {
+		return err
+	}
+	retry, err := parseRetryPolicy()
+	if err != nil {
+		return err
+	}
+	if err := validateCountryFlags(); err != nil {
+		return err
+	}
+	alert, err := newBandwidthAlert(alertBW, alertPause)
+	if err != nil {
+		return err
+	}
+	style, stylePrefix, err := parseSubdomainStyle()
+	if err != nil {
+		return err
+	}
+	tunnelLabels, err := labels.Parse(labelArgs)
+	if err != nil {
+		return err
 	}
 
 	if daemonMode && !daemonMarker {
-		return StartDaemon("http", port, buildDaemonArgs("http", args, subdomain, localAddress))
+		return StartDaemon("http", port, buildDaemonArgs("http", []string{strconv.Itoa(port)}, subdomain, localHost))
 	}
 
 	if authPass != "" && authBearer != "" {
 		return fmt.Errorf("cannot use --auth and --auth-bearer together")
 	}
+	if authPass != "" && waitReady {
+		return fmt.Errorf("--wait-ready cannot verify a password-protected tunnel; use --auth-bearer")
+	}
 
 	serverAddr, token, err := resolveServerAddrAndToken("http", port)
 	if err != nil {
 		return err
 	}
 
+	fingerprint, err := resolveServerFingerprint()
+	if err != nil {
+		return err
+	}
+	proxyDialer, err := resolveProxy()
+	if err != nil {
+		return err
+	}
+
 	bw, err := parseBandwidth(bandwidth)
 	if err != nil {
 		return err
 	}
+	rate, err := parseBandwidth(rateLimit)
+	if err != nil {
+		return fmt.Errorf("--rate: %w", err)
+	}
+
+	rules, err := httputil.ParseRequestRules(requestRules)
+	if err != nil {
+		return err
+	}
+
+	if visitorRPS < 0 || visitorBurst < 0 {
+		return fmt.Errorf("--visitor-rps and --visitor-burst must not be negative")
+	}
+	edgeTLS, err := parseEdgeTLS()
+	if err != nil {
+		return err
+	}
+	if signSecret != "" {
+		if err := httputil.ValidateSigningSecret(signSecret); err != nil {
+			return fmt.Errorf("--sign-secret: %w", err)
+		}
+	}
+	maxBodySize, err := parseBandwidth(maxBody)
+	if err != nil {
+		return fmt.Errorf("--max-body: %w", err)
+	}
+	maxRespBodySize, err := parseBandwidth(maxRespBody)
+	if err != nil {
+		return fmt.Errorf("--max-response-body: %w", err)
+	}
+	if requestStore < 0 || requestStore > protocol.MaxRequestStore {
+		return fmt.Errorf("--request-store must be between 0 and %d", protocol.MaxRequestStore)
+	}
+	if cacheTTL < 0 {
+		return fmt.Errorf("--cache-ttl must not be negative")
+	}
+	if maxInFlight < 0 || maxQueue < 0 {
+		return fmt.Errorf("--max-inflight and --max-queue must not be negative")
+	}
+
+	if tunnelTTL < 0 {
+		return fmt.Errorf("--ttl must not be negative")
+	}
+	if scheduleSpec != "" {
+		if _, err := schedule.Parse(scheduleSpec); err != nil {
+			return fmt.Errorf("--schedule: %w", err)
+		}
+	}
+
+	exit, err := newExitCondition(untilRequest, exitAfter, true)
+	if err != nil {
+		return err
+	}
+
+	notifyTargets, err := notify.ParseTargets(notifyURLs)
+	if err != nil {
+		return err
+	}
+
+	cookieRewrite, err := middleware.ParseCookieRewrite(cookieFixes)
+	if err != nil {
+		return err
+	}
+	if err := middleware.ValidateCORSOrigins(corsOrigins); err != nil {
+		return err
+	}
+
+	recorder, err := openHARRecorder()
+	if err != nil {
+		return err
+	}
 
 	connConfig := &tcp.ConnectorConfig{
 		ServerAddr: serverAddr,
 		Token:      token,
 		TunnelType: protocol.TunnelTypeHTTP,
-		LocalHost:  localAddress,
+		LocalHost:  localHost,
 		LocalPort:  port,
 		Subdomain:  subdomain,
 		Insecure:   insecure,
@@ -113,6 +359,44 @@ func runHTTP(_ *cobra.Command, args []string) error {
 		AuthBearer: authBearer,
 		Transport:  parseTransport(transport),
 		Bandwidth:  bw,
+		Rate:       rate,
+
+		SubdomainStyle:    style,
+		SubdomainPrefix:   stylePrefix,
+		Labels:            tunnelLabels,
+		AllowCountries:    allowCountry,
+		DenyCountries:     denyCountry,
+		ServerFingerprint: fingerprint,
+		FallbackAddrs:     serverFallbacks,
+		DrainTimeout:      drainTimeout,
+		PowerSave:         powerSave,
+		Chaos:             chaosConfig,
+		Proxy:             proxyDialer,
+		RequestRules:      rules,
+		VisitorRPS:        visitorRPS,
+		VisitorBurst:      visitorBurst,
+		EdgeTLS:           edgeTLS,
+		SigningSecret:     signSecret,
+		RequestStore:      requestStore,
+		MaxRequestBody:    maxBodySize,
+		MaxResponseBody:   maxRespBodySize,
+		CompressStreams:   compressSSE,
+		CacheTTL:          cacheTTL,
+		ExecHooks:         execHooks,
+		HAR:               recorder,
+		RewriteHost:       rewriteHost,
+		RewriteHTML:       rewriteHTML,
+		CookieRewrite:     cookieRewrite,
+		CORSOrigins:       corsOrigins,
+		Backends:          backends,
+		Balance:           balance,
+		HealthCheck:       healthCheck,
+		Shadow:            shadow,
+		MaxInFlight:       maxInFlight,
+		MaxQueue:          maxQueue,
+		Retry:             retry,
+		TTL:               tunnelTTL,
+		Schedule:          scheduleSpec,
 	}
 
 	var daemon *DaemonInfo
@@ -120,7 +404,15 @@ func runHTTP(_ *cobra.Command, args []string) error {
 		daemon = newDaemonInfo("http", port, subdomain, serverAddr)
 	}
 
-	return runTunnelWithUI(connConfig, daemon)
+	return runTunnelWithUI(connConfig, daemon, tunnelOptions{
+		notifyTargets: notifyTargets,
+		exit:          exit,
+		urlFile:       urlFile,
+		waitReady:     waitReady,
+		openURL:       openURL,
+		copyURL:       copyURL,
+		alert:         alert,
+	})
 }
 
 func parseTransport(s string) tcp.TransportType {
@@ -143,6 +435,8 @@ func parseBandwidth(s string) (int64, error) {
 	if s == "" {
 		return 0, nil
 	}
+	// Rates may be written per second, as in 1MBps or 500K/s.
+	s = strings.TrimSuffix(strings.TrimSuffix(s, "/S"), "PS")
 
 	var multiplier int64 = 1
 	switch {
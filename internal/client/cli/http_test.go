@@ -27,6 +27,11 @@ func TestParseBandwidth(t *testing.T) {
 		{" 1M ", 1024 * 1024, false},
 		{"1B", 1, false},
 		{"100B", 100, false},
+		{"1MBps", 1024 * 1024, false},
+		{"1mbps", 1024 * 1024, false},
+		{"500K/s", 500 * 1024, false},
+		{"100Bps", 100, false},
+		{"ps", 0, true},
 		{"invalid", 0, true},
 		{"abc", 0, true},
 		{"-1M", 0, true},
@@ -57,3 +62,44 @@ func TestParseBandwidth(t *testing.T) {
 		})
 	}
 }
+
+func TestParseLocalTarget(t *testing.T) {
+	tests := []struct {
+		arg         string
+		defaultHost string
+		wantHost    string
+		wantPort    int
+		wantErr     bool
+	}{
+		{"3000", "127.0.0.1", "127.0.0.1", 3000, false},
+		{"3000", "[::1]", "::1", 3000, false},
+		{"localhost:8080", "127.0.0.1", "localhost", 8080, false},
+		{"192.168.1.20:80", "127.0.0.1", "192.168.1.20", 80, false},
+		{"[::1]:3000", "127.0.0.1", "::1", 3000, false},
+		{"[fe80::1%eth0]:3000", "127.0.0.1", "fe80::1%eth0", 3000, false},
+		{":3000", "10.0.0.5", "10.0.0.5", 3000, false},
+		{"::1:3000", "127.0.0.1", "", 0, true},
+		{"[::1]", "127.0.0.1", "", 0, true},
+		{"localhost:0", "127.0.0.1", "", 0, true},
+		{"70000", "127.0.0.1", "", 0, true},
+		{"http", "127.0.0.1", "", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.arg, func(t *testing.T) {
+			host, port, err := parseLocalTarget(tt.arg, tt.defaultHost)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("parseLocalTarget(%q) = %q, %d, want error", tt.arg, host, port)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseLocalTarget(%q) error = %v", tt.arg, err)
+			}
+			if host != tt.wantHost || port != tt.wantPort {
+				t.Errorf("parseLocalTarget(%q) = %q, %d, want %q, %d", tt.arg, host, port, tt.wantHost, tt.wantPort)
+			}
+		})
+	}
+}
@@ -4,27 +4,47 @@ import (
 	"fmt"
 	"strconv"
 
+	"drip/internal/client/middleware"
+	"drip/internal/client/notify"
 	"drip/internal/client/tcp"
+	"drip/internal/shared/httputil"
+	"drip/internal/shared/labels"
 	"drip/internal/shared/protocol"
+	"drip/internal/shared/schedule"
 
 	"github.com/spf13/cobra"
 )
 
+var (
+	localCA         string
+	localPin        string
+	localVerify     bool
+	localServerName string
+	localInsecure   bool
+)
+
 var httpsCmd = &cobra.Command{
-	Use:   "https <port>",
+	Use:   "https <port|host:port>",
 	Short: "Start HTTPS tunnel",
 	Long: `Start an HTTPS tunnel to expose a local HTTPS server.
 
 Example:
   drip https 443                    Tunnel localhost:443
   drip https 8443 --subdomain myapp Use custom subdomain
+  drip https "[::1]:8443"           Tunnel a service listening on IPv6 localhost
   drip https 443 --allow-ip 192.168.0.0/16  Only allow IPs from 192.168.x.x
   drip https 443 --allow-ip 10.0.0.1        Allow single IP
   drip https 443 --deny-ip 1.2.3.4          Block specific IP
+  drip https 443 --allow-country DE,AT,CH   Only allow visitors from these countries
   drip https 443 --auth secret              Enable proxy authentication with password
   drip https 443 --auth-bearer sk-xxx       Enable proxy authentication with bearer token
   drip https 443 --transport wss            Use WebSocket over TLS (CDN-friendly)
   drip https 443 --bandwidth 1M             Limit bandwidth to 1 MB/s
+  drip https 443 --rate 1MBps               Cap this machine's tunnel traffic at 1 MB/s
+  drip https 443 --alert-bandwidth 1GB      Warn after 1 GB of traffic
+  drip https 8443 --local-ca internal-ca.pem          Verify the service against an internal CA
+  drip https 8443 --local-pin sha256/47DEQ...         Accept only this service key
+  drip https 10.0.0.5:443 --local-verify --local-server-name api.corp  Verify an internal service by name
 
 Configuration:
   First time: Run 'drip config init' to save server and token
@@ -35,7 +55,7 @@ Transport options:
   tcp   - Direct TLS 1.3 connection
   wss   - WebSocket over TLS (works through CDN like Cloudflare)
 
-Bandwidth format:
+Bandwidth format (--bandwidth, --rate):
   1K, 1KB  - 1 kilobyte per second (1024 bytes/s)
   1M, 1MB  - 1 megabyte per second (1048576 bytes/s)
   1G, 1GB  - 1 gigabyte per second
@@ -48,48 +68,210 @@ Bandwidth format:
 
 func init() {
 	httpsCmd.Flags().StringVarP(&subdomain, "subdomain", "n", "", "Custom subdomain (optional)")
+	httpsCmd.Flags().StringVar(&subStyle, "subdomain-style", "", "Style of the generated subdomain: hex, words (calm-amber-otter), prefix (<user>-3f9a2c) or prefix:<name> (default: the server's)")
+	httpsCmd.Flags().StringArrayVar(&labelArgs, "label", nil, "Label the tunnel with key=value, e.g. team=payments; repeatable, shown by drip list and the server's stats")
 	httpsCmd.Flags().BoolVarP(&daemonMode, "daemon", "d", false, "Run in background (daemon mode)")
 	httpsCmd.Flags().StringVarP(&localAddress, "address", "a", "127.0.0.1", "Local address to forward to (default: 127.0.0.1)")
 	httpsCmd.Flags().StringSliceVar(&allowIPs, "allow-ip", nil, "Allow only these IPs or CIDR ranges (e.g., 192.168.1.1,10.0.0.0/8)")
 	httpsCmd.Flags().StringSliceVar(&denyIPs, "deny-ip", nil, "Deny these IPs or CIDR ranges (e.g., 1.2.3.4,192.168.1.0/24)")
+	httpsCmd.Flags().StringSliceVar(&allowCountry, "allow-country", nil, "Allow only visitors from these countries (ISO codes, e.g., US,DE); needs a server with a GeoIP database")
+	httpsCmd.Flags().StringSliceVar(&denyCountry, "deny-country", nil, "Deny visitors from these countries (ISO codes, e.g., US,DE); needs a server with a GeoIP database")
 	httpsCmd.Flags().StringVar(&authPass, "auth", "", "Password for proxy authentication")
 	httpsCmd.Flags().StringVar(&authBearer, "auth-bearer", "", "Bearer token for proxy authentication")
 	httpsCmd.Flags().StringVar(&transport, "transport", "auto", "Transport protocol: auto, tcp, wss (WebSocket over TLS)")
 	httpsCmd.Flags().StringVar(&bandwidth, "bandwidth", "", "Bandwidth limit (e.g., 1M, 500K, 1G)")
+	httpsCmd.Flags().StringVar(&rateLimit, "rate", "", "Cap the tunnel's traffic in and out together on this machine, e.g. 1MBps (for shared uplinks)")
+	httpsCmd.Flags().StringVar(&alertBW, "alert-bandwidth", "", "Warn once the session's traffic in and out passes this size, e.g. 1GB (for metered connections)")
+	httpsCmd.Flags().BoolVar(&alertPause, "alert-pause", false, "Also pause the tunnel when --alert-bandwidth is reached")
+	httpsCmd.Flags().Float64Var(&visitorRPS, "visitor-rps", 0, "Requests per second allowed per visitor IP (0 = unlimited)")
+	httpsCmd.Flags().IntVar(&visitorBurst, "visitor-burst", 0, "Burst size for --visitor-rps (default: rps rounded up)")
+	httpsCmd.Flags().DurationVar(&hstsMaxAge, "hsts", 0, "Have the server add Strict-Transport-Security with this max-age to responses, e.g. 8760h")
+	httpsCmd.Flags().BoolVar(&tls13Only, "tls13-only", false, "Have the server refuse visitors that cannot use TLS 1.3")
+	httpsCmd.Flags().StringVar(&clientCAFile, "client-ca", "", "Have the server require visitor certificates issued by the CAs in this PEM bundle")
+	httpsCmd.Flags().StringVar(&signSecret, "sign-secret", "", "Have the server sign request bodies with this secret (HMAC-SHA256 in X-Drip-Signature) so the local app can verify them")
+	httpsCmd.Flags().IntVar(&requestStore, "request-store", 0, "Have the server keep the last N requests, also while this client is away, for 'drip replay --tunnel' with the same token (max 100)")
+	httpsCmd.Flags().StringVar(&maxBody, "max-body", "", "Have the server answer requests with larger bodies with a 413 instead of forwarding them, e.g. 10M (cannot exceed the server's limit)")
+	httpsCmd.Flags().StringVar(&maxRespBody, "max-response-body", "", "Answer responses of the local service with larger bodies with a 502, e.g. 100M")
+	httpsCmd.Flags().BoolVar(&compressSSE, "compress-streams", false, "Compress streaming responses (SSE, NDJSON) between this client and the server")
+	httpsCmd.Flags().DurationVar(&cacheTTL, "cache-ttl", 0, "Answer revalidation requests for unchanged responses with 304 on the client for this long (0 = disabled)")
+	httpsCmd.Flags().BoolVar(&rewriteHost, "rewrite-host", false, "Point redirects and cookie domains for the local address at the public URL")
+	httpsCmd.Flags().BoolVar(&rewriteHTML, "rewrite-html", false, "Like --rewrite-host, and also rewrite local links in HTML pages")
+	httpsCmd.Flags().StringSliceVar(&cookieFixes, "cookie-rewrite", nil, "Normalize Set-Cookie attributes for the public host: domain, secure, samesite=<lax|strict|none>")
+	httpsCmd.Flags().StringSliceVar(&corsOrigins, "cors", nil, "Answer CORS preflights and add CORS headers for these origins (* for any, https://*.example.com for subdomains)")
+	httpsCmd.Flags().Lookup("cors").NoOptDefVal = "*"
+	httpsCmd.Flags().StringArrayVar(&execHooks, "hook", nil, "Shell command run for every request and response; reads JSON on stdin and may print header changes or a mock response")
+	httpsCmd.Flags().StringVar(&harPath, "har", "", "Record proxied requests and responses to this HAR file")
+	httpsCmd.Flags().StringVar(&harMaxBody, "har-max-body", "1M", "Largest request or response body kept in the HAR file; longer bodies are truncated")
+	httpsCmd.Flags().StringArrayVar(&requestRules, "rule", nil, "Request filtering rule evaluated at the server (e.g., \"deny path=/wp-admin\")")
+	httpsCmd.Flags().DurationVar(&tunnelTTL, "ttl", 0, "Close the tunnel automatically after this long, e.g. 2h (enforced by the server, 0 = never)")
+	httpsCmd.Flags().StringVar(&scheduleSpec, "schedule", "", "Only accept visitors in these windows, e.g. \"Mon-Fri 09:00-18:00 Europe/Berlin\" (enforced by the server)")
+	httpsCmd.Flags().StringVar(&untilRequest, "until-request", "", "Exit once a request for this path arrives, e.g. /done (for CI jobs)")
+	httpsCmd.Flags().StringVar(&exitAfter, "exit-after", "", "Exit after this many requests or this long, e.g. 10 or 5m; fails if --until-request was not seen")
+	httpsCmd.Flags().StringVar(&urlFile, "url-file", "", "Write the public URL to this file as DRIP_URL=<url> once the tunnel is up")
+	httpsCmd.Flags().BoolVar(&waitReady, "wait-ready", false, "Only report the URL once it is verified reachable through the server")
+	httpsCmd.Flags().BoolVar(&openURL, "open", false, "Open the public URL in the default browser once the tunnel is up")
+	httpsCmd.Flags().BoolVar(&copyURL, "copy", false, "Copy the public URL to the clipboard once the tunnel is up")
+	httpsCmd.Flags().StringArrayVar(&notifyURLs, "notify", nil, "Post the public URL to a chat webhook when the tunnel is up, e.g. slack:https://hooks.slack.com/... or discord:https://discord.com/api/webhooks/...")
+	httpsCmd.Flags().StringSliceVar(&backendAddrs, "backend", nil, "More local addresses (<port|host:port>) to spread requests over, e.g. 8444,8445")
+	httpsCmd.Flags().StringVar(&balance, "balance", tcp.BalanceRoundRobin, "How requests are spread over --backend addresses: round-robin, least-conn")
+	httpsCmd.Flags().StringVar(&healthCheck, "health-check", "", "Path probed on each backend every 5s, e.g. /healthz; failing backends are skipped (default: TCP connect)")
+	httpsCmd.Flags().IntVar(&retries, "retries", 0, "Retry a failed dial to the local service this many times, e.g. while it restarts")
+	httpsCmd.Flags().DurationVar(&retryBackoff, "retry-backoff", tcp.DefaultRetryBackoff, "Wait before the first retry, doubled after each")
+	httpsCmd.Flags().StringSliceVar(&retryMethods, "retry-methods", nil, "HTTP methods retried (default: GET,HEAD,OPTIONS,PUT,DELETE)")
+	httpsCmd.Flags().IntVar(&maxInFlight, "max-inflight", 0, "Most requests forwarded to the local service at once (0 = unlimited)")
+	httpsCmd.Flags().IntVar(&maxQueue, "max-queue", 100, "Requests that may wait for --max-inflight; more get a 503 with Retry-After")
+	httpsCmd.Flags().StringVar(&shadowAddr, "shadow", "", "Mirror every request to this local <port|host:port> in the background; its responses are discarded")
+	httpsCmd.Flags().StringVar(&localCA, "local-ca", "", "Verify the local service against the CAs in this PEM bundle")
+	httpsCmd.Flags().StringVar(&localPin, "local-pin", "", "Require this public key hash (sha256/<base64>) from the local service")
+	httpsCmd.Flags().BoolVar(&localVerify, "local-verify", false, "Verify the local service certificate against the system CAs")
+	httpsCmd.Flags().StringVar(&localServerName, "local-server-name", "", "Host name sent to and verified for the local service (default: the local address)")
+	httpsCmd.Flags().BoolVar(&localInsecure, "local-insecure", false, "Accept any local service certificate (the default)")
 	httpsCmd.Flags().BoolVar(&daemonMarker, "daemon-child", false, "Internal flag for daemon child process")
 	httpsCmd.Flags().MarkHidden("daemon-child")
 	rootCmd.AddCommand(httpsCmd)
 }
 
 func runHTTPS(_ *cobra.Command, args []string) error {
-	port, err := strconv.Atoi(args[0])
-	if err != nil || port < 1 || port > 65535 {
-		return fmt.Errorf("invalid port number: %s", args[0])
+	localHost, port, err := parseLocalTarget(args[0], localAddress)
+	if err != nil {
+		return err
+	}
+	backends, err := parseBackends(localHost)
+	if err != nil {
+		return err
+	}
+	shadow, err := parseShadow(localHost)
+	if err != nil {
+		return err
+	}
+	retry, err := parseRetryPolicy()
+	if err != nil {
+		return err
+	}
+	if err := validateCountryFlags(); err != nil {
+		return err
+	}
+	alert, err := newBandwidthAlert(alertBW, alertPause)
+	if err != nil {
+		return err
+	}
+	style, stylePrefix, err := parseSubdomainStyle()
+	if err != nil {
+		return err
+	}
+	tunnelLabels, err := labels.Parse(labelArgs)
+	if err != nil {
+		return err
 	}
 
 	if daemonMode && !daemonMarker {
-		return StartDaemon("https", port, buildDaemonArgs("https", args, subdomain, localAddress))
+		return StartDaemon("https", port, buildDaemonArgs("https", []string{strconv.Itoa(port)}, subdomain, localHost))
 	}
 
 	if authPass != "" && authBearer != "" {
 		return fmt.Errorf("cannot use --auth and --auth-bearer together")
 	}
+	if authPass != "" && waitReady {
+		return fmt.Errorf("--wait-ready cannot verify a password-protected tunnel; use --auth-bearer")
+	}
 
 	serverAddr, token, err := resolveServerAddrAndToken("https", port)
 	if err != nil {
 		return err
 	}
 
+	fingerprint, err := resolveServerFingerprint()
+	if err != nil {
+		return err
+	}
+	proxyDialer, err := resolveProxy()
+	if err != nil {
+		return err
+	}
+
 	bw, err := parseBandwidth(bandwidth)
 	if err != nil {
 		return err
 	}
+	rate, err := parseBandwidth(rateLimit)
+	if err != nil {
+		return fmt.Errorf("--rate: %w", err)
+	}
+
+	rules, err := httputil.ParseRequestRules(requestRules)
+	if err != nil {
+		return err
+	}
+
+	if visitorRPS < 0 || visitorBurst < 0 {
+		return fmt.Errorf("--visitor-rps and --visitor-burst must not be negative")
+	}
+	edgeTLS, err := parseEdgeTLS()
+	if err != nil {
+		return err
+	}
+	if signSecret != "" {
+		if err := httputil.ValidateSigningSecret(signSecret); err != nil {
+			return fmt.Errorf("--sign-secret: %w", err)
+		}
+	}
+	maxBodySize, err := parseBandwidth(maxBody)
+	if err != nil {
+		return fmt.Errorf("--max-body: %w", err)
+	}
+	maxRespBodySize, err := parseBandwidth(maxRespBody)
+	if err != nil {
+		return fmt.Errorf("--max-response-body: %w", err)
+	}
+	if requestStore < 0 || requestStore > protocol.MaxRequestStore {
+		return fmt.Errorf("--request-store must be between 0 and %d", protocol.MaxRequestStore)
+	}
+	if cacheTTL < 0 {
+		return fmt.Errorf("--cache-ttl must not be negative")
+	}
+
+	if tunnelTTL < 0 {
+		return fmt.Errorf("--ttl must not be negative")
+	}
+	if scheduleSpec != "" {
+		if _, err := schedule.Parse(scheduleSpec); err != nil {
+			return fmt.Errorf("--schedule: %w", err)
+		}
+	}
+
+	exit, err := newExitCondition(untilRequest, exitAfter, true)
+	if err != nil {
+		return err
+	}
+
+	notifyTargets, err := notify.ParseTargets(notifyURLs)
+	if err != nil {
+		return err
+	}
+
+	cookieRewrite, err := middleware.ParseCookieRewrite(cookieFixes)
+	if err != nil {
+		return err
+	}
+	if err := middleware.ValidateCORSOrigins(corsOrigins); err != nil {
+		return err
+	}
+
+	localTLS, err := buildLocalTLS(localHost)
+	if err != nil {
+		return err
+	}
+
+	recorder, err := openHARRecorder()
+	if err != nil {
+		return err
+	}
 
 	connConfig := &tcp.ConnectorConfig{
 		ServerAddr: serverAddr,
 		Token:      token,
 		TunnelType: protocol.TunnelTypeHTTPS,
-		LocalHost:  localAddress,
+		LocalHost:  localHost,
 		LocalPort:  port,
 		Subdomain:  subdomain,
 		Insecure:   insecure,
@@ -99,6 +281,45 @@ func runHTTPS(_ *cobra.Command, args []string) error {
 		AuthBearer: authBearer,
 		Transport:  parseTransport(transport),
 		Bandwidth:  bw,
+		Rate:       rate,
+
+		SubdomainStyle:    style,
+		SubdomainPrefix:   stylePrefix,
+		Labels:            tunnelLabels,
+		AllowCountries:    allowCountry,
+		DenyCountries:     denyCountry,
+		ServerFingerprint: fingerprint,
+		FallbackAddrs:     serverFallbacks,
+		DrainTimeout:      drainTimeout,
+		PowerSave:         powerSave,
+		Chaos:             chaosConfig,
+		Proxy:             proxyDialer,
+		RequestRules:      rules,
+		VisitorRPS:        visitorRPS,
+		VisitorBurst:      visitorBurst,
+		EdgeTLS:           edgeTLS,
+		SigningSecret:     signSecret,
+		RequestStore:      requestStore,
+		MaxRequestBody:    maxBodySize,
+		MaxResponseBody:   maxRespBodySize,
+		CompressStreams:   compressSSE,
+		CacheTTL:          cacheTTL,
+		ExecHooks:         execHooks,
+		HAR:               recorder,
+		RewriteHost:       rewriteHost,
+		RewriteHTML:       rewriteHTML,
+		CookieRewrite:     cookieRewrite,
+		CORSOrigins:       corsOrigins,
+		LocalTLS:          localTLS,
+		Backends:          backends,
+		Balance:           balance,
+		HealthCheck:       healthCheck,
+		Shadow:            shadow,
+		MaxInFlight:       maxInFlight,
+		MaxQueue:          maxQueue,
+		Retry:             retry,
+		TTL:               tunnelTTL,
+		Schedule:          scheduleSpec,
 	}
 
 	var daemon *DaemonInfo
@@ -106,5 +327,31 @@ func runHTTPS(_ *cobra.Command, args []string) error {
 		daemon = newDaemonInfo("https", port, subdomain, serverAddr)
 	}
 
-	return runTunnelWithUI(connConfig, daemon)
+	return runTunnelWithUI(connConfig, daemon, tunnelOptions{
+		notifyTargets: notifyTargets,
+		exit:          exit,
+		urlFile:       urlFile,
+		waitReady:     waitReady,
+		openURL:       openURL,
+		copyURL:       copyURL,
+		alert:         alert,
+	})
+}
+
+// buildLocalTLS collects the --local-* certificate checks for the local
+// service and makes sure they are usable before connecting.
+func buildLocalTLS(localHost string) (tcp.LocalTLS, error) {
+	opts := tcp.LocalTLS{
+		CAFile:     localCA,
+		Pin:        localPin,
+		Verify:     localVerify,
+		ServerName: localServerName,
+	}
+	if localInsecure && opts.Enabled() {
+		return tcp.LocalTLS{}, fmt.Errorf("--local-insecure cannot be combined with --local-ca, --local-pin or --local-verify")
+	}
+	if _, err := opts.Config(localHost); err != nil {
+		return tcp.LocalTLS{}, err
+	}
+	return opts, nil
 }
@@ -0,0 +1,278 @@
+package cli
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"drip/internal/client/tcp"
+	"drip/internal/shared/protocol"
+	"drip/internal/shared/ui"
+	"drip/pkg/config"
+
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+var initForce bool
+
+var initCmd = &cobra.Command{
+	Use:   "init",
+	Short: "Set up drip step by step",
+	Long: `Walk through the first-time setup: the server address, the auth token and
+an optional default tunnel. drip checks that it can reach the server and
+that the token is accepted before it writes ~/.drip/config.yaml.
+
+For servers with a self-signed certificate, the wizard shows the server's
+key fingerprint and offers to pin it.
+
+Use 'drip config set' instead for scripted setups.`,
+	Args:          cobra.NoArgs,
+	RunE:          runInit,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+}
+
+func init() {
+	initCmd.Flags().BoolVar(&initForce, "force", false, "Replace an existing configuration without asking")
+	rootCmd.AddCommand(initCmd)
+}
+
+// prompter reads answers line by line from the terminal.
+type prompter struct {
+	r *bufio.Reader
+}
+
+func (p *prompter) ask(question, def string) (string, error) {
+	if def != "" {
+		fmt.Print(ui.Muted(fmt.Sprintf("%s [%s]: ", question, def)))
+	} else {
+		fmt.Print(ui.Muted(question + ": "))
+	}
+	line, err := p.r.ReadString('\n')
+	if errors.Is(err, io.EOF) && line == "" {
+		return "", fmt.Errorf("setup cancelled")
+	} else if err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	if line = strings.TrimSpace(line); line == "" {
+		return def, nil
+	}
+	return line, nil
+}
+
+func (p *prompter) confirm(question string, def bool) (bool, error) {
+	hint := "y/N"
+	if def {
+		hint = "Y/n"
+	}
+	answer, err := p.ask(question+" ("+hint+")", "")
+	if err != nil {
+		return false, err
+	}
+	switch strings.ToLower(answer) {
+	case "":
+		return def, nil
+	case "y", "yes":
+		return true, nil
+	default:
+		return false, nil
+	}
+}
+
+func runInit(_ *cobra.Command, _ []string) error {
+	p := &prompter{r: bufio.NewReader(os.Stdin)}
+	path := config.DefaultClientConfigPath()
+
+	fmt.Println(ui.Info("Welcome to Drip",
+		ui.Muted("This sets up the server you tunnel through."),
+		ui.Muted("Press Enter to accept the value in [brackets]."),
+	))
+
+	if config.ConfigExists("") && !initForce {
+		ok, err := p.confirm(fmt.Sprintf("A configuration already exists at %s. Replace it?", path), false)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			fmt.Println(ui.Muted("Nothing changed."))
+			return nil
+		}
+	}
+
+	fmt.Println()
+	fmt.Println(ui.Title("1. Server"))
+	var server string
+	for {
+		answer, err := p.ask("Server address", "")
+		if err != nil {
+			return err
+		}
+		server = normalizeServerAddr(answer)
+		if valid, msg := validateServerAddress(server); !valid {
+			fmt.Println(ui.Error(msg))
+			continue
+		}
+		break
+	}
+
+	token, err := p.ask("Authentication token (leave empty if the server has none)", "")
+	if err != nil {
+		return err
+	}
+
+	cfg := &config.ClientConfig{Server: server, Token: token, TLS: true}
+
+	fmt.Println()
+	fmt.Println(ui.Title("2. Connection check"))
+	if ok, err := checkServerForInit(p, cfg); err != nil {
+		return err
+	} else if !ok {
+		save, err := p.confirm("Save the configuration anyway?", false)
+		if err != nil {
+			return err
+		}
+		if !save {
+			return fmt.Errorf("setup cancelled")
+		}
+	}
+
+	fmt.Println()
+	fmt.Println(ui.Title("3. Default tunnel (optional)"))
+	tunnel, err := askInitTunnel(p)
+	if err != nil {
+		return err
+	}
+	if tunnel != nil {
+		cfg.Tunnels = []*config.TunnelConfig{tunnel}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	if err := config.SaveClientConfig(cfg, ""); err != nil {
+		return fmt.Errorf("failed to save configuration: %w", err)
+	}
+
+	fmt.Println()
+	fmt.Println(ui.RenderConfigSaved(path))
+	next := []string{ui.Cyan("drip http 3000") + ui.Muted("   Expose a local port")}
+	if tunnel != nil {
+		next = append([]string{ui.Cyan("drip start "+tunnel.Name) + ui.Muted("   Start your default tunnel")}, next...)
+	}
+	fmt.Println(ui.Muted("Next steps:"))
+	fmt.Println(ui.RenderList(next))
+	return nil
+}
+
+// normalizeServerAddr adds the default TLS port when none is given.
+func normalizeServerAddr(addr string) string {
+	addr = strings.TrimSpace(addr)
+	addr = strings.TrimPrefix(addr, "https://")
+	addr = strings.TrimSuffix(addr, "/")
+	if addr == "" {
+		return ""
+	}
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return net.JoinHostPort(strings.Trim(addr, "[]"), "443")
+	}
+	return addr
+}
+
+// checkServerForInit verifies the TLS certificate, offering to pin
+// self-signed ones, and then registers a throwaway tunnel to check the
+// token. It reports whether every check passed.
+func checkServerForInit(p *prompter, cfg *config.ClientConfig) (bool, error) {
+	host, _, _ := net.SplitHostPort(cfg.Server)
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+
+	conn, err := tls.DialWithDialer(dialer, "tcp", cfg.Server, config.GetClientTLSConfig(host))
+	if err == nil {
+		conn.Close()
+		fmt.Println(ui.Success("Server reachable, certificate valid"))
+	} else {
+		var unknownCA x509.UnknownAuthorityError
+		var hostname x509.HostnameError
+		var invalid x509.CertificateInvalidError
+		if !errors.As(err, &unknownCA) && !errors.As(err, &hostname) && !errors.As(err, &invalid) {
+			fmt.Println(ui.Error("Cannot reach " + cfg.Server + ": " + err.Error()))
+			return false, nil
+		}
+
+		conn, err = tls.DialWithDialer(dialer, "tcp", cfg.Server, config.GetClientTLSConfigInsecure())
+		if err != nil {
+			fmt.Println(ui.Error("Cannot reach " + cfg.Server + ": " + err.Error()))
+			return false, nil
+		}
+		leaf := conn.ConnectionState().PeerCertificates[0]
+		conn.Close()
+
+		fingerprint := config.SPKIFingerprint(leaf)
+		fmt.Println(ui.Warning("The server's certificate is not trusted by this system."))
+		fmt.Println(ui.KeyValue("Fingerprint", fingerprint))
+		trust, err := p.confirm("Trust this server and pin its key? Compare the fingerprint with the server's startup log first", false)
+		if err != nil {
+			return false, err
+		}
+		if !trust {
+			return false, nil
+		}
+		cfg.ServerFingerprint = fingerprint
+		fmt.Println(ui.Success("Server key pinned"))
+	}
+
+	client := tcp.NewTunnelClient(&tcp.ConnectorConfig{
+		ServerAddr:        cfg.Server,
+		Token:             cfg.Token,
+		TunnelType:        protocol.TunnelTypeHTTP,
+		LocalPort:         80,
+		ServerFingerprint: cfg.ServerFingerprint,
+	}, zap.NewNop())
+	if err := client.Connect(); err != nil {
+		fmt.Println(ui.Error("The server rejected a test tunnel: " + err.Error()))
+		return false, nil
+	}
+	_ = client.Close()
+	fmt.Println(ui.Success("Token accepted"))
+	return true, nil
+}
+
+func askInitTunnel(p *prompter) (*config.TunnelConfig, error) {
+	for {
+		answer, err := p.ask("Local port you expose most often (leave empty to skip)", "")
+		if err != nil || answer == "" {
+			return nil, err
+		}
+		port, err := strconv.Atoi(answer)
+		if err != nil || port < 1 || port > 65535 {
+			fmt.Println(ui.Error("Enter a port between 1 and 65535"))
+			continue
+		}
+
+		t := &config.TunnelConfig{Port: port}
+		if t.Type, err = p.ask("Tunnel type (http, https, tcp)", "http"); err != nil {
+			return nil, err
+		}
+		if t.Name, err = p.ask("Tunnel name", "web"); err != nil {
+			return nil, err
+		}
+		if t.Type != "tcp" {
+			if t.Subdomain, err = p.ask("Subdomain (leave empty for a random one)", ""); err != nil {
+				return nil, err
+			}
+		}
+		if err := t.Validate(); err != nil {
+			fmt.Println(ui.Error(err.Error()))
+			continue
+		}
+		return t, nil
+	}
+}
@@ -0,0 +1,22 @@
+package cli
+
+import "testing"
+
+func TestNormalizeServerAddr(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"tunnel.example.com", "tunnel.example.com:443"},
+		{"tunnel.example.com:8443", "tunnel.example.com:8443"},
+		{" https://tunnel.example.com/ ", "tunnel.example.com:443"},
+		{"[2001:db8::1]", "[2001:db8::1]:443"},
+		{"[2001:db8::1]:8443", "[2001:db8::1]:8443"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := normalizeServerAddr(tt.in); got != tt.want {
+			t.Errorf("normalizeServerAddr(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
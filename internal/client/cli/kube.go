@@ -0,0 +1,139 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"drip/internal/client/kube"
+	"drip/internal/client/supervisor"
+	"drip/internal/client/tcp"
+	"drip/internal/shared/tuning"
+	"drip/internal/shared/ui"
+	"drip/internal/shared/utils"
+
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+var (
+	kubeNamespace string
+	kubeInterval  time.Duration
+	kubeAPIServer string
+)
+
+var kubeCmd = &cobra.Command{
+	Use:   "kube",
+	Short: "Expose annotated Kubernetes Services through tunnels",
+	Long: `Run as a controller that watches Kubernetes Services and keeps a tunnel
+open for every Service annotated with drip.io/expose: "true". Tunnels are
+created when the annotation appears and closed when it is removed or the
+Service is deleted.
+
+Annotations:
+  drip.io/expose: "true"      Expose this Service
+  drip.io/port: http          Port name or number (default: first TCP port)
+  drip.io/type: http          Tunnel type: http, https or tcp (default: http)
+  drip.io/subdomain: preview  Requested subdomain
+
+Inside a pod the controller uses its service account, which needs permission
+to list Services. Outside a cluster, point it at 'kubectl proxy'.
+
+Example:
+  drip kube --server tunnel.example.com:443 --token $TOKEN
+  drip kube --namespace staging --api-server http://127.0.0.1:8001`,
+	Args:          cobra.NoArgs,
+	RunE:          runKube,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+}
+
+func init() {
+	kubeCmd.Flags().StringVarP(&kubeNamespace, "namespace", "n", "", "Namespace to watch (default: all namespaces)")
+	kubeCmd.Flags().DurationVar(&kubeInterval, "interval", kube.DefaultInterval, "How often to list Services")
+	kubeCmd.Flags().StringVar(&kubeAPIServer, "api-server", "", "Kubernetes API server URL without authentication, e.g. from 'kubectl proxy' (default: in-cluster)")
+	rootCmd.AddCommand(kubeCmd)
+}
+
+func runKube(_ *cobra.Command, _ []string) error {
+	if kubeInterval < time.Second {
+		return fmt.Errorf("--interval must be at least 1s")
+	}
+
+	serverAddr, token, err := resolveServer("kube")
+	if err != nil {
+		return err
+	}
+	fingerprint, err := resolveServerFingerprint()
+	if err != nil {
+		return err
+	}
+	proxyDialer, err := resolveProxy()
+	if err != nil {
+		return err
+	}
+
+	var client *kube.Client
+	if kubeAPIServer != "" {
+		client, err = kube.NewClient(kubeAPIServer)
+	} else {
+		client, err = kube.NewInClusterClient()
+	}
+	if err != nil {
+		return err
+	}
+
+	tuning.ApplyMode(tuning.ModeClient)
+	if err := utils.InitLogger(verbose); err != nil {
+		return fmt.Errorf("failed to initialize logger: %w", err)
+	}
+	defer utils.Sync()
+
+	logger := utils.GetLogger()
+	defer watchLogLevelSignal(logger)()
+
+	proxyDialer.SetLogger(logger)
+	tunnels := supervisor.New(logger)
+	tunnels.SetProxy(proxyDialer)
+	tunnels.SetEventHandler(func(ev supervisor.Event) {
+		switch {
+		case ev.Up:
+			fmt.Println(ui.KeyValue(ev.Name, ui.URL(ev.URL)))
+		case ev.Err != nil:
+			logger.Warn("Tunnel failed to connect", zap.String("service", ev.Name), zap.Error(ev.Err))
+		}
+	})
+
+	base := tcp.ConnectorConfig{
+		ServerAddr:        serverAddr,
+		Token:             token,
+		Insecure:          insecure,
+		ServerFingerprint: fingerprint,
+		FallbackAddrs:     serverFallbacks,
+		DrainTimeout:      drainTimeout,
+		PowerSave:         powerSave,
+		Chaos:             chaosConfig,
+	}
+
+	scope := kubeNamespace
+	if scope == "" {
+		scope = "all namespaces"
+	}
+	fmt.Println(ui.Info("Watching Kubernetes Services",
+		ui.KeyValue("Server", serverAddr),
+		ui.KeyValue("Namespace", scope),
+		ui.KeyValue("Interval", kubeInterval.String()),
+	))
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	kube.NewController(client, kubeNamespace, kubeInterval, base, tunnels, logger).Run(ctx)
+
+	fmt.Println(ui.RenderShuttingDown())
+	tunnels.Close()
+	return nil
+}
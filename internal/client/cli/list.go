@@ -4,15 +4,24 @@ import (
 	"bufio"
 	"fmt"
 	"os"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
 
+	"drip/internal/client/control"
+	"drip/internal/client/supervisor"
+	"drip/internal/shared/labels"
+	"drip/internal/shared/stats"
 	"drip/internal/shared/ui"
+
 	"github.com/spf13/cobra"
 )
 
-var interactiveMode bool
+var (
+	interactiveMode bool
+	listLabels      []string
+)
 
 var listCmd = &cobra.Command{
 	Use:   "list",
@@ -22,6 +31,7 @@ var listCmd = &cobra.Command{
 Example:
   drip list                     Show all running tunnels
   drip list -i                  Interactive mode (select to attach/stop)
+  drip list --label env=dev     Only tunnels labelled env=dev
 
 This command shows:
   - Tunnel type (HTTP/HTTPS/TCP)
@@ -29,6 +39,8 @@ This command shows:
   - Public URL
   - Process ID (PID)
   - Uptime
+  - Traffic in and out, and its current rate
+  - Labels set with --label
 
 In interactive mode, you can select a tunnel to:
   - Attach: View real-time logs
@@ -41,10 +53,16 @@ In interactive mode, you can select a tunnel to:
 
 func init() {
 	listCmd.Flags().BoolVarP(&interactiveMode, "interactive", "i", false, "Interactive mode for attach/stop")
+	listCmd.Flags().StringArrayVar(&listLabels, "label", nil, "Only list tunnels with this key=value label (repeatable)")
 	rootCmd.AddCommand(listCmd)
 }
 
 func runList(_ *cobra.Command, _ []string) error {
+	selector, err := labels.Parse(listLabels)
+	if err != nil {
+		return err
+	}
+
 	CleanupStaleDaemons()
 
 	daemons, err := ListAllDaemons()
@@ -52,7 +70,23 @@ func runList(_ *cobra.Command, _ []string) error {
 		return fmt.Errorf("failed to list daemons: %w", err)
 	}
 
-	if len(daemons) == 0 {
+	// Tunnels added with 'drip add' live in the multi-tunnel daemon.
+	managed, _ := control.NewClient(getControlSocketPath()).List()
+
+	if len(selector) > 0 {
+		daemons = slices.DeleteFunc(daemons, func(d *DaemonInfo) bool {
+			return !labels.Match(d.Labels, selector)
+		})
+		managed = slices.DeleteFunc(managed, func(t supervisor.Status) bool {
+			return !labels.Match(t.Labels, selector)
+		})
+		if len(daemons) == 0 && len(managed) == 0 {
+			fmt.Println(ui.Muted("No running tunnels labelled " + labels.Format(selector)))
+			return nil
+		}
+	}
+
+	if len(daemons) == 0 && len(managed) == 0 {
 		fmt.Println()
 		fmt.Println(ui.Info(
 			"No Running Tunnels",
@@ -61,11 +95,26 @@ func runList(_ *cobra.Command, _ []string) error {
 			"",
 			ui.Cyan("  drip http 3000 -d"),
 			ui.Cyan("  drip tcp 5432 -d"),
+			ui.Cyan("  drip add http 3000 --name api"),
 		))
 		return nil
 	}
 
-	table := ui.NewTable([]string{"#", "TYPE", "PORT", "URL", "PID", "UPTIME"}).
+	if len(managed) > 0 {
+		fmt.Print(renderManagedTunnels(managed))
+	}
+	if len(daemons) == 0 {
+		fmt.Println(ui.Muted("Commands:"))
+		fmt.Println(ui.RenderList([]string{
+			ui.Cyan("drip add http 3000 --name api") + ui.Muted("  Add a tunnel"),
+			ui.Cyan("drip rm api") + ui.Muted("                    Remove a tunnel"),
+			ui.Cyan("drip pause api") + ui.Muted("                 Pause a tunnel, keeping its URL"),
+			ui.Cyan("drip daemon stop") + ui.Muted("               Stop all added tunnels"),
+		}))
+		return nil
+	}
+
+	table := ui.NewTable([]string{"#", "TYPE", "PORT", "URL", "PID", "UPTIME", "TRAFFIC", "RATE", "LABELS"}).
 		WithTitle("Running Tunnels")
 
 	idx := 1
@@ -93,6 +142,9 @@ func runList(_ *cobra.Command, _ []string) error {
 			ui.URL(d.URL),
 			ui.Muted(fmt.Sprintf("%d", d.PID)),
 			FormatDuration(uptime),
+			formatTraffic(d.BytesIn, d.BytesOut),
+			formatRate(d.SpeedIn, d.SpeedOut),
+			ui.Muted(labels.Format(d.Labels)),
 		})
 		idx++
 	}
@@ -114,6 +166,46 @@ func runList(_ *cobra.Command, _ []string) error {
 	return nil
 }
 
+func renderManagedTunnels(tunnels []supervisor.Status) string {
+	table := ui.NewTable([]string{"NAME", "TYPE", "FORWARD", "URL", "STATUS", "SINCE", "TRAFFIC", "RATE", "LABELS"}).
+		WithTitle("Daemon Tunnels")
+
+	for _, t := range tunnels {
+		status := ui.Success("connected")
+		switch {
+		case !t.Connected:
+			status = ui.Warning("connecting")
+		case t.Paused:
+			status = ui.Warning("paused")
+		}
+		table.AddRow([]string{
+			ui.Highlight(t.Name),
+			strings.ToUpper(t.Type),
+			t.Local,
+			ui.URL(t.URL),
+			status,
+			FormatDuration(time.Since(t.Since)),
+			formatTraffic(t.BytesIn, t.BytesOut),
+			formatRate(t.SpeedIn, t.SpeedOut),
+			ui.Muted(labels.Format(t.Labels)),
+		})
+	}
+	return table.Render()
+}
+
+// formatTraffic shows the bytes a tunnel received and sent.
+func formatTraffic(in, out int64) string {
+	return ui.Cyan(fmt.Sprintf("↓ %s ↑ %s", stats.FormatBytes(in), stats.FormatBytes(out)))
+}
+
+// formatRate shows how fast a tunnel is receiving and sending.
+func formatRate(in, out int64) string {
+	if in == 0 && out == 0 {
+		return ui.Muted("idle")
+	}
+	return fmt.Sprintf("↓ %s ↑ %s", stats.FormatSpeed(in), stats.FormatSpeed(out))
+}
+
 func runInteractiveList(daemons []*DaemonInfo) error {
 	var runningDaemons []*DaemonInfo
 	for _, d := range daemons {
@@ -0,0 +1,49 @@
+//go:build !windows
+
+package cli
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"drip/internal/shared/utils"
+)
+
+// watchLogLevelSignal toggles debug logging on SIGUSR1 so an issue can be
+// reproduced without restarting. A second SIGUSR1 restores the level that
+// was active before. The returned function stops watching.
+func watchLogLevelSignal(logger *zap.Logger) func() {
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGUSR1)
+	done := make(chan struct{})
+
+	go func() {
+		previous := utils.GetLogLevel()
+		for {
+			select {
+			case <-sigCh:
+				current := utils.GetLogLevel()
+				next := zapcore.DebugLevel
+				if current == zapcore.DebugLevel {
+					next = previous
+				} else {
+					previous = current
+				}
+				_ = utils.SetLogLevel("", next.String())
+				logger.Warn("Log level changed by SIGUSR1",
+					zap.String("from", current.String()),
+					zap.String("to", next.String()),
+				)
+			case <-done:
+				signal.Stop(sigCh)
+				return
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
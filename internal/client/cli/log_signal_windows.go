@@ -0,0 +1,11 @@
+//go:build windows
+
+package cli
+
+import "go.uber.org/zap"
+
+// watchLogLevelSignal is a no-op on Windows, which has no SIGUSR1. Use the
+// server admin API to change log levels instead.
+func watchLogLevelSignal(_ *zap.Logger) func() {
+	return func() {}
+}
@@ -0,0 +1,322 @@
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"drip/internal/client/logfile"
+	"drip/internal/client/tcp"
+	"drip/internal/shared/stats"
+	"drip/internal/shared/ui"
+
+	json "github.com/goccy/go-json"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// logsTailBytes bounds how much of a log is read to find its last lines.
+const logsTailBytes = 1 << 20
+
+// logsPollInterval is how often 'drip logs -f' checks for new lines.
+const logsPollInterval = 500 * time.Millisecond
+
+var (
+	logsFollow bool
+	logsTunnel string
+	logsLines  int
+	logsJSON   bool
+)
+
+var logsCmd = &cobra.Command{
+	Use:   "logs",
+	Short: "Show the log of a tunnel",
+	Long: `Show the log a tunnel writes to ~/.drip/logs, also for tunnels that ran
+in the background or have already exited.
+
+Tunnels are named after their 'drip start' or 'drip add' name, their
+--subdomain, or their type and port, e.g. http-3000. Logs are rotated at
+10 MB; rotated files are kept for a week.
+
+Examples:
+  drip logs                        List logs, or show the only one
+  drip logs --tunnel myapp         Show the last 50 lines of myapp's log
+  drip logs -f --tunnel http-3000  Follow the log as it grows
+  drip logs --tunnel db --json     Print raw JSON lines`,
+	Args:          cobra.NoArgs,
+	RunE:          runLogs,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+}
+
+func init() {
+	logsCmd.Flags().BoolVarP(&logsFollow, "follow", "f", false, "Keep printing lines as they are written")
+	logsCmd.Flags().StringVar(&logsTunnel, "tunnel", "", "Name of the tunnel whose log to show")
+	logsCmd.Flags().IntVarP(&logsLines, "lines", "n", 50, "Number of lines to show from the end of the log (0 = all)")
+	logsCmd.Flags().BoolVar(&logsJSON, "json", false, "Print log entries as the raw JSON lines stored in the file")
+	rootCmd.AddCommand(logsCmd)
+}
+
+func runLogs(_ *cobra.Command, _ []string) error {
+	dir := logfile.Dir()
+	name := logsTunnel
+	if name == "" {
+		names, err := logfile.List(dir)
+		if err != nil {
+			return fmt.Errorf("failed to list logs: %w", err)
+		}
+		switch len(names) {
+		case 0:
+			fmt.Println(ui.Info(
+				"No Logs Yet",
+				"",
+				ui.Muted("Tunnels write their logs to "+dir),
+			))
+			return nil
+		case 1:
+			name = names[0]
+		default:
+			printLogList(dir, names)
+			return nil
+		}
+	}
+
+	path := logfile.Path(dir, name)
+	info, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("no log for tunnel '%s' in %s", name, dir)
+		}
+		return err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	start := max(info.Size()-logsTailBytes, 0)
+	data, err := io.ReadAll(io.NewSectionReader(f, start, info.Size()-start))
+	_ = f.Close()
+	if err != nil {
+		return fmt.Errorf("failed to read log: %w", err)
+	}
+	lines := bytes.SplitAfter(data, []byte("\n"))
+	if start > 0 && len(lines) > 0 {
+		// The first line is cut off.
+		lines = lines[1:]
+	}
+	if logsLines > 0 && len(lines) > logsLines {
+		lines = lines[len(lines)-logsLines:]
+	}
+	for _, line := range lines {
+		printLogLine(line)
+	}
+
+	if !logsFollow {
+		return nil
+	}
+	quit := make(chan os.Signal, 1)
+	notifyQuit(quit)
+	return followLog(path, info.Size(), quit)
+}
+
+func printLogList(dir string, names []string) {
+	table := ui.NewTable([]string{"TUNNEL", "SIZE", "LAST WRITE"}).
+		WithTitle("Tunnel logs in " + dir)
+	for _, name := range names {
+		info, err := os.Stat(logfile.Path(dir, name))
+		if err != nil {
+			continue
+		}
+		table.AddRow([]string{
+			ui.Highlight(name),
+			stats.FormatBytes(info.Size()),
+			FormatDuration(time.Since(info.ModTime())) + " ago",
+		})
+	}
+	fmt.Print(table.Render())
+	fmt.Println(ui.Muted(fmt.Sprintf("Use '%s' to show one", ui.Cyan("drip logs --tunnel <name>"))))
+}
+
+// followLog prints lines appended to path from offset on until quit. When
+// the log is rotated it finishes the old file and continues with the new.
+func followLog(path string, offset int64, quit <-chan os.Signal) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+
+	reader := bufio.NewReader(f)
+	var partial []byte
+	drain := func() {
+		for {
+			line, err := reader.ReadBytes('\n')
+			partial = append(partial, line...)
+			if err != nil {
+				return
+			}
+			printLogLine(partial)
+			partial = partial[:0]
+		}
+	}
+
+	ticker := time.NewTicker(logsPollInterval)
+	defer ticker.Stop()
+	for {
+		drain()
+		select {
+		case <-quit:
+			return nil
+		case <-ticker.C:
+		}
+
+		current, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		if open, err := f.Stat(); err == nil && os.SameFile(open, current) {
+			continue
+		}
+		next, err := os.Open(path)
+		if err != nil {
+			continue
+		}
+		drain()
+		if len(partial) > 0 {
+			printLogLine(partial)
+			partial = partial[:0]
+		}
+		_ = f.Close()
+		f = next
+		reader.Reset(f)
+	}
+}
+
+func printLogLine(line []byte) {
+	line = bytes.TrimRight(line, "\r\n")
+	if len(line) == 0 {
+		return
+	}
+	if logsJSON {
+		fmt.Println(string(line))
+		return
+	}
+	fmt.Println(formatLogLine(line))
+}
+
+// formatLogLine renders a JSON log entry as "time LEVEL [logger] message
+// key=value...". Lines that are not JSON are returned as they are.
+func formatLogLine(line []byte) string {
+	var entry map[string]any
+	if err := json.Unmarshal(line, &entry); err != nil {
+		return string(line)
+	}
+
+	str := func(key string) string {
+		s, _ := entry[key].(string)
+		delete(entry, key)
+		return s
+	}
+	ts, level, name, msg := str("ts"), str("level"), str("logger"), str("msg")
+	delete(entry, "caller")
+	delete(entry, "tunnel")
+
+	var b strings.Builder
+	if t, err := time.Parse("2006-01-02T15:04:05.000Z0700", ts); err == nil {
+		ts = t.Local().Format("2006-01-02 15:04:05")
+	}
+	fmt.Fprintf(&b, "%s %-5s ", ts, strings.ToUpper(level))
+	if name != "" {
+		fmt.Fprintf(&b, "[%s] ", name)
+	}
+	b.WriteString(msg)
+
+	keys := make([]string, 0, len(entry))
+	for k := range entry {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	for _, k := range keys {
+		v := entry[k]
+		if s, ok := v.(string); ok {
+			fmt.Fprintf(&b, " %s=%s", k, s)
+			continue
+		}
+		encoded, _ := json.Marshal(v)
+		fmt.Fprintf(&b, " %s=%s", k, encoded)
+	}
+	return b.String()
+}
+
+// tunnelLogName names the log of a tunnel started from the command line:
+// its subdomain, or its type and port.
+func tunnelLogName(cfg *tcp.ConnectorConfig) string {
+	if cfg.Subdomain != "" {
+		return cfg.Subdomain
+	}
+	return fmt.Sprintf("%s-%d", cfg.TunnelType, cfg.LocalPort)
+}
+
+// openTunnelLog makes logger also write to the log file of the tunnel
+// called name, at info level or debug with --verbose. Without the file
+// the tunnel still runs, logging to the console only.
+func openTunnelLog(logger *zap.Logger, name string) (*zap.Logger, func()) {
+	w, err := logfile.Open(logfile.Path(logfile.Dir(), name), logfile.Options{})
+	if err != nil {
+		fmt.Println(ui.Warning(fmt.Sprintf("Not writing a log file: %v", err)))
+		return logger, func() {}
+	}
+	level := zapcore.InfoLevel
+	if verbose {
+		level = zapcore.DebugLevel
+	}
+	return logfile.Tee(logger, w, level).With(zap.String("tunnel", name)), func() { _ = w.Close() }
+}
+
+// tunnelLogs keeps a log file open for each tunnel of a process that runs
+// many, such as the 'drip add' daemon.
+type tunnelLogs struct {
+	base *zap.Logger
+
+	mu      sync.Mutex
+	loggers map[string]*zap.Logger
+	closers []func()
+}
+
+func newTunnelLogs(base *zap.Logger) *tunnelLogs {
+	return &tunnelLogs{base: base, loggers: make(map[string]*zap.Logger)}
+}
+
+// get returns the logger of the tunnel called name, opening its file the
+// first time.
+func (l *tunnelLogs) get(name string) *zap.Logger {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if logger, ok := l.loggers[name]; ok {
+		return logger
+	}
+	logger, closeLog := openTunnelLog(l.base, name)
+	l.loggers[name] = logger
+	l.closers = append(l.closers, closeLog)
+	return logger
+}
+
+func (l *tunnelLogs) Close() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, closeLog := range l.closers {
+		closeLog()
+	}
+	l.closers = nil
+}
@@ -0,0 +1,486 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"time"
+
+	"drip/internal/client/control"
+	"drip/internal/client/supervisor"
+	"drip/internal/shared/labels"
+	"drip/internal/shared/tuning"
+	"drip/internal/shared/ui"
+	"drip/internal/shared/utils"
+
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+var (
+	addName      string
+	addSubdomain string
+	addAddress   string
+	addLabels    []string
+
+	daemonNgrokAPI       string
+	daemonNgrokAPISecret string
+)
+
+var addCmd = &cobra.Command{
+	Use:   "add <type> <port>",
+	Short: "Add a tunnel to the background daemon",
+	Long: `Add a tunnel to the multi-tunnel daemon, starting the daemon if it is not
+running. One daemon process keeps every added tunnel connected until it is
+removed with 'drip rm'.
+
+Examples:
+  drip add http 3000 --name api
+  drip add tcp 5432 --name db --subdomain postgres
+  drip add http 8080 --name web --label team=payments
+  drip rm api
+  drip list`,
+	Args:          cobra.ExactArgs(2),
+	RunE:          runAdd,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+}
+
+var rmCmd = &cobra.Command{
+	Use:           "rm <name>...",
+	Short:         "Remove tunnels from the background daemon",
+	Args:          cobra.MinimumNArgs(1),
+	RunE:          runRm,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+}
+
+var pauseCmd = &cobra.Command{
+	Use:   "pause <name>...",
+	Short: "Stop traffic to daemon tunnels without closing them",
+	Long: `Pause tunnels added with 'drip add'. A paused tunnel keeps its URL,
+subdomain and port: the server answers HTTP visitors with a "paused" page
+(503) and refuses TCP connections until the tunnel is resumed.
+
+Examples:
+  drip pause api
+  drip resume api`,
+	Args:          cobra.MinimumNArgs(1),
+	RunE:          runPause,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+}
+
+var resumeCmd = &cobra.Command{
+	Use:           "resume <name>...",
+	Short:         "Let traffic through paused daemon tunnels again",
+	Args:          cobra.MinimumNArgs(1),
+	RunE:          runPause,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+}
+
+var rulesCmd = &cobra.Command{
+	Use:   "rules <name> [rule]...",
+	Short: "Replace the request filtering rules of a daemon tunnel",
+	Long: `Replace the request filtering rules of an http or https tunnel added with
+'drip add'. The server applies the new rules right away, without
+reconnecting, and they are kept when the tunnel reconnects. Rules use the
+syntax of --rule; giving none removes them all.
+
+Examples:
+  drip rules api "deny path=/wp-admin" "deny ua=bot|crawler"
+  drip rules api "allow method=POST path=/webhook"
+  drip rules api`,
+	Args:          cobra.MinimumNArgs(1),
+	RunE:          runRules,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+}
+
+var daemonCmd = &cobra.Command{
+	Use:   "daemon",
+	Short: "Manage the multi-tunnel daemon",
+	Long: `The multi-tunnel daemon runs the tunnels added with 'drip add' in one
+process and is controlled through a unix socket in ~/.drip/daemons.
+'drip add' starts it on demand; 'drip daemon run' keeps it in the foreground,
+for example under a service manager.`,
+}
+
+var daemonRunCmd = &cobra.Command{
+	Use:   "run",
+	Short: "Run the multi-tunnel daemon in the foreground",
+	Long: `Run the multi-tunnel daemon in the foreground.
+
+With --ngrok-api, the daemon also serves a subset of ngrok's local agent
+API on a loopback address: GET and POST /api/tunnels, and GET and DELETE
+/api/tunnels/<name>. Scripts and libraries written for ngrok can then
+start and stop drip tunnels unchanged. Tunnels they create use the server
+and token of --server/--token or the configuration file.
+
+Requests must send the API secret as a bearer token, and POSTs must be
+JSON. The secret is --ngrok-api-secret, or a random one written to
+~/.drip/daemons/ngrok-api.secret. Requests from browsers are refused.
+
+Example:
+  drip daemon run --ngrok-api 127.0.0.1:4040
+  curl -X POST localhost:4040/api/tunnels \
+    -H "Authorization: Bearer $(cat ~/.drip/daemons/ngrok-api.secret)" \
+    -H 'Content-Type: application/json' \
+    -d '{"name":"web","addr":"3000","proto":"http"}'`,
+	Args:          cobra.NoArgs,
+	RunE:          runDaemonForeground,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+}
+
+var daemonStopCmd = &cobra.Command{
+	Use:           "stop",
+	Short:         "Close every tunnel and stop the multi-tunnel daemon",
+	Args:          cobra.NoArgs,
+	RunE:          runDaemonStop,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+}
+
+func init() {
+	addCmd.Flags().StringVar(&addName, "name", "", "Tunnel name (default: <type>-<port>)")
+	addCmd.Flags().StringVarP(&addSubdomain, "subdomain", "n", "", "Custom subdomain (optional)")
+	addCmd.Flags().StringVarP(&addAddress, "address", "a", "127.0.0.1", "Local address to forward to")
+	addCmd.Flags().StringArrayVar(&addLabels, "label", nil, "Label the tunnel with key=value, e.g. team=payments (repeatable)")
+
+	daemonRunCmd.Flags().StringVar(&daemonNgrokAPI, "ngrok-api", "", "Serve the ngrok-compatible API on this loopback address (e.g., 127.0.0.1:4040)")
+	daemonRunCmd.Flags().StringVar(&daemonNgrokAPISecret, "ngrok-api-secret", "", "Bearer token the ngrok-compatible API requires (default: random, saved in the daemon directory)")
+
+	daemonCmd.AddCommand(daemonRunCmd, daemonStopCmd)
+	rootCmd.AddCommand(addCmd, rmCmd, pauseCmd, resumeCmd, rulesCmd, daemonCmd)
+}
+
+// getControlSocketPath returns the multi-tunnel daemon's control socket.
+func getControlSocketPath() string {
+	return filepath.Join(getDaemonDir(), "control.sock")
+}
+
+func runAdd(_ *cobra.Command, args []string) error {
+	tunnelType := args[0]
+	if tunnelType != "http" && tunnelType != "https" && tunnelType != "tcp" && tunnelType != "tls" {
+		return fmt.Errorf("invalid tunnel type: %s (must be 'http', 'https', 'tcp', or 'tls')", tunnelType)
+	}
+	port, err := strconv.Atoi(args[1])
+	if err != nil || port < 1 || port > 65535 {
+		return fmt.Errorf("invalid port number: %s", args[1])
+	}
+
+	tunnelLabels, err := labels.Parse(addLabels)
+	if err != nil {
+		return err
+	}
+
+	name := addName
+	if name == "" {
+		name = fmt.Sprintf("%s-%d", tunnelType, port)
+	}
+
+	serverAddr, token, err := resolveServer(fmt.Sprintf("add %s %d", tunnelType, port))
+	if err != nil {
+		return err
+	}
+	fingerprint, err := resolveServerFingerprint()
+	if err != nil {
+		return err
+	}
+
+	client, err := ensureMultiDaemon()
+	if err != nil {
+		return err
+	}
+
+	st, err := client.Add(control.TunnelSpec{
+		Name:              name,
+		Type:              tunnelType,
+		Port:              port,
+		Address:           addAddress,
+		Subdomain:         addSubdomain,
+		Labels:            tunnelLabels,
+		Server:            serverAddr,
+		Token:             token,
+		Insecure:          insecure,
+		ServerFingerprint: fingerprint,
+	})
+	if err != nil {
+		return err
+	}
+
+	if !st.Connected {
+		msg := "still connecting"
+		if st.LastError != "" {
+			msg = st.LastError
+		}
+		fmt.Println(ui.WarningBox("Tunnel Added",
+			ui.KeyValue("Name", name),
+			ui.KeyValue("Forward", st.Local),
+			ui.KeyValue("Status", msg),
+			ui.Muted("The daemon keeps retrying; check 'drip list'."),
+		))
+		return nil
+	}
+
+	fmt.Println(ui.SuccessBox("Tunnel Added",
+		ui.KeyValue("Name", name),
+		ui.KeyValue("URL", ui.URL(st.URL)),
+		ui.KeyValue("Forward", st.Local),
+	))
+	return nil
+}
+
+func runRm(_ *cobra.Command, args []string) error {
+	client := control.NewClient(getControlSocketPath())
+	for _, name := range args {
+		if err := client.Remove(name); err != nil {
+			if errors.Is(err, control.ErrNotRunning) {
+				return fmt.Errorf("no tunnels added: the daemon is not running")
+			}
+			return err
+		}
+		fmt.Println(ui.Success("Removed " + name))
+	}
+	return nil
+}
+
+func runPause(cmd *cobra.Command, args []string) error {
+	client := control.NewClient(getControlSocketPath())
+	pause := cmd.Name() == "pause"
+	for _, name := range args {
+		var res control.PauseResult
+		var err error
+		if pause {
+			res, err = client.Pause(name)
+		} else {
+			res, err = client.Resume(name)
+		}
+		if err != nil {
+			if errors.Is(err, control.ErrNotRunning) {
+				return fmt.Errorf("no tunnels added: the daemon is not running")
+			}
+			return err
+		}
+		if res.Warning != "" {
+			fmt.Println(ui.Warning(name + ": " + res.Warning))
+		}
+		if pause {
+			fmt.Println(ui.Success("Paused " + name))
+		} else {
+			fmt.Println(ui.Success("Resumed " + name))
+		}
+	}
+	return nil
+}
+
+func runRules(_ *cobra.Command, args []string) error {
+	name, rules := args[0], args[1:]
+	if err := control.NewClient(getControlSocketPath()).SetRules(name, rules); err != nil {
+		if errors.Is(err, control.ErrNotRunning) {
+			return fmt.Errorf("no tunnels added: the daemon is not running")
+		}
+		return err
+	}
+	if len(rules) == 0 {
+		fmt.Println(ui.Success("Removed the request rules of " + name))
+	} else {
+		fmt.Println(ui.Success(fmt.Sprintf("Set %d request rules on %s", len(rules), name)))
+	}
+	return nil
+}
+
+func runDaemonStop(_ *cobra.Command, _ []string) error {
+	if err := control.NewClient(getControlSocketPath()).Shutdown(); err != nil {
+		return err
+	}
+	fmt.Println(ui.Success("Daemon stopped"))
+	return nil
+}
+
+// ensureMultiDaemon returns a client for the running daemon, starting one
+// in the background if needed.
+func ensureMultiDaemon() (*control.Client, error) {
+	socket := getControlSocketPath()
+	client := control.NewClient(socket)
+	if err := client.Ping(); err == nil {
+		return client, nil
+	} else if !errors.Is(err, control.ErrNotRunning) {
+		return nil, err
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get executable path: %w", err)
+	}
+
+	logDir := getDaemonDir()
+	if err := os.MkdirAll(logDir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create daemon directory: %w", err)
+	}
+	logPath := filepath.Join(logDir, "daemon.log")
+	logFile, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create log file: %w", err)
+	}
+	defer logFile.Close()
+
+	args := append([]string{"daemon", "run"}, proxyArgs()...)
+	if verbose {
+		args = append(args, "--verbose")
+	}
+	cmd := exec.Command(executable, args...)
+	setupDaemonCmd(cmd)
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start daemon: %w", err)
+	}
+	_ = cmd.Process.Release()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		time.Sleep(100 * time.Millisecond)
+		if client.Ping() == nil {
+			return client, nil
+		}
+	}
+	return nil, fmt.Errorf("daemon did not start, see %s", logPath)
+}
+
+func runDaemonForeground(_ *cobra.Command, _ []string) error {
+	tuning.ApplyMode(tuning.ModeClient)
+	if err := utils.InitLogger(verbose); err != nil {
+		return fmt.Errorf("failed to initialize logger: %w", err)
+	}
+	defer utils.Sync()
+
+	logger := utils.GetLogger()
+	defer watchLogLevelSignal(logger)()
+
+	var ngrokLn net.Listener
+	var ngrokDefaults control.TunnelSpec
+	var ngrokSecret string
+	if daemonNgrokAPI != "" {
+		var err error
+		if ngrokLn, ngrokDefaults, err = listenNgrokAPI(daemonNgrokAPI); err != nil {
+			return err
+		}
+		defer ngrokLn.Close()
+		if ngrokSecret, err = ngrokAPISecret(); err != nil {
+			return err
+		}
+	}
+
+	socket := getControlSocketPath()
+	ln, err := control.Listen(socket)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(socket)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	logs := newTunnelLogs(logger)
+	defer logs.Close()
+
+	proxyDialer, err := resolveProxy()
+	if err != nil {
+		return err
+	}
+	proxyDialer.SetLogger(logger)
+
+	tunnels := supervisor.New(logger)
+	tunnels.SetTunnelLogger(logs.get)
+	tunnels.SetProxy(proxyDialer)
+	tunnels.SetEventHandler(func(ev supervisor.Event) {
+		logger := logs.get(ev.Name)
+		switch {
+		case ev.Up:
+			logger.Info("Tunnel connected", zap.String("url", ev.URL))
+		case ev.Err != nil:
+			logger.Warn("Tunnel failed to connect", zap.Error(ev.Err))
+		default:
+			logger.Info("Tunnel disconnected")
+		}
+	})
+
+	logger.Info("Daemon started", zap.String("socket", socket), zap.Int("pid", os.Getpid()))
+	server := control.NewServer(tunnels, stop, logger)
+	if ngrokLn != nil {
+		logger.Info("Serving the ngrok-compatible API", zap.String("address", ngrokLn.Addr().String()))
+		go func() {
+			if err := server.ServeNgrok(ctx, ngrokLn, ngrokDefaults, ngrokSecret); err != nil {
+				logger.Error("ngrok-compatible API stopped", zap.Error(err))
+			}
+		}()
+	}
+	err = server.Serve(ctx, ln)
+	tunnels.Close()
+	logger.Info("Daemon stopped")
+	return err
+}
+
+// ngrokAPISecret returns --ngrok-api-secret, or generates a secret and
+// saves it where only the user can read it, for scripts to pick up.
+func ngrokAPISecret() (string, error) {
+	if daemonNgrokAPISecret != "" {
+		return daemonNgrokAPISecret, nil
+	}
+	secret, err := utils.TryGenerateID()
+	if err != nil {
+		return "", err
+	}
+	dir := getDaemonDir()
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create daemon directory: %w", err)
+	}
+	path := filepath.Join(dir, "ngrok-api.secret")
+	if err := os.WriteFile(path, []byte(secret+"\n"), 0600); err != nil {
+		return "", fmt.Errorf("failed to write ngrok API secret: %w", err)
+	}
+	return secret, nil
+}
+
+// listenNgrokAPI opens the ngrok-compatible API's listener and resolves the
+// server settings of the tunnels created through it. The API can start
+// tunnels to any local port, so it only listens on loopback addresses.
+func listenNgrokAPI(addr string) (net.Listener, control.TunnelSpec, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, control.TunnelSpec{}, fmt.Errorf("invalid --ngrok-api address %q: %w", addr, err)
+	}
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return nil, control.TunnelSpec{}, fmt.Errorf("--ngrok-api must listen on a loopback address, not %q", host)
+	}
+
+	serverAddr, token, err := resolveServer("daemon run --ngrok-api " + addr)
+	if err != nil {
+		return nil, control.TunnelSpec{}, err
+	}
+	fingerprint, err := resolveServerFingerprint()
+	if err != nil {
+		return nil, control.TunnelSpec{}, err
+	}
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, control.TunnelSpec{}, fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+	return ln, control.TunnelSpec{
+		Server:            serverAddr,
+		Token:             token,
+		Insecure:          insecure,
+		ServerFingerprint: fingerprint,
+	}, nil
+}
@@ -0,0 +1,117 @@
+package cli
+
+import (
+	"fmt"
+
+	"drip/internal/shared/ui"
+	"drip/pkg/config"
+
+	"github.com/spf13/cobra"
+)
+
+var profileCmd = &cobra.Command{
+	Use:   "profile",
+	Short: "Switch between server profiles",
+	Long: `Profiles keep the settings for several drip servers in one config file.
+The top-level server, token and tunnels form the "default" profile; every
+other profile replaces the server settings and adds its own tunnels.
+
+Configuration file example (~/.drip/config.yaml):
+  server: tunnel.example.com:443
+  token: your-token
+  profiles:
+    staging:
+      server: staging.internal:8443
+      token: staging-token
+      server_fingerprint: sha256/...
+      tunnels:
+        - name: web
+          type: http
+          port: 3000
+
+Examples:
+  drip profile list             List profiles
+  drip profile use staging      Make staging the current profile
+  drip profile use default      Go back to the top-level settings
+  drip --profile staging http 3000
+  DRIP_PROFILE=staging drip start web`,
+}
+
+var profileListCmd = &cobra.Command{
+	Use:           "list",
+	Short:         "List profiles",
+	Aliases:       []string{"ls"},
+	Args:          cobra.NoArgs,
+	RunE:          runProfileList,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+}
+
+var profileUseCmd = &cobra.Command{
+	Use:           "use <name>",
+	Short:         "Set the current profile",
+	Args:          cobra.ExactArgs(1),
+	RunE:          runProfileUse,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+}
+
+func init() {
+	profileCmd.AddCommand(profileListCmd, profileUseCmd)
+	rootCmd.AddCommand(profileCmd)
+}
+
+func runProfileList(_ *cobra.Command, _ []string) error {
+	cfg, err := config.LoadClientConfig("")
+	if err != nil {
+		return err
+	}
+
+	current := cfg.Profile
+	if current == "" {
+		current = config.DefaultProfile
+	}
+
+	table := ui.NewTable([]string{"", "PROFILE", "SERVER", "TUNNELS"}).WithTitle("Profiles")
+	addRow := func(name, server string, tunnels int) {
+		marker := ""
+		if name == current {
+			marker = ui.Highlight("*")
+		}
+		table.AddRow([]string{marker, ui.Highlight(name), server, fmt.Sprintf("%d", tunnels)})
+	}
+
+	if cfg.Server != "" {
+		addRow(config.DefaultProfile, cfg.Server, len(cfg.Tunnels))
+	}
+	for _, name := range cfg.ProfileNames() {
+		p := cfg.Profiles[name]
+		addRow(name, p.Server, len(p.Tunnels))
+	}
+
+	fmt.Print(table.Render())
+	return nil
+}
+
+func runProfileUse(_ *cobra.Command, args []string) error {
+	cfg, err := config.LoadClientConfig("")
+	if err != nil {
+		return err
+	}
+
+	name := args[0]
+	if _, err := cfg.WithProfile(name); err != nil {
+		return err
+	}
+
+	cfg.Profile = name
+	if name == config.DefaultProfile {
+		cfg.Profile = ""
+	}
+	if err := config.SaveClientConfig(cfg, ""); err != nil {
+		return err
+	}
+
+	fmt.Println(ui.Success("Current profile: " + name))
+	return nil
+}
@@ -0,0 +1,58 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"drip/internal/client/region"
+	"drip/internal/shared/ui"
+	"drip/pkg/config"
+)
+
+// regionProbeTimeout bounds each connection used to time a region.
+const regionProbeTimeout = 3 * time.Second
+
+// serverFallbacks holds the servers of the other regions, in failover order,
+// once selectServer has picked one. It is empty without regions.
+var serverFallbacks []string
+
+// selectServer returns the server for this run: the --region one, or else
+// the region with the lowest connect time. The remaining regions, fastest
+// first, are kept in serverFallbacks. Without regions it is cfg.Server.
+func selectServer(cfg *config.ClientConfig) (string, error) {
+	if len(cfg.Regions) == 0 {
+		if regionName != "" {
+			return "", fmt.Errorf("--region needs regions in the configuration")
+		}
+		return cfg.Server, nil
+	}
+
+	endpoints := make([]region.Endpoint, len(cfg.Regions))
+	for i, r := range cfg.Regions {
+		endpoints[i] = region.Endpoint{Name: r.Name, Addr: r.Server}
+	}
+	results := region.Measure(context.Background(), endpoints, regionProbeTimeout)
+	if regionName != "" {
+		var err error
+		if results, err = region.Prefer(results, regionName); err != nil {
+			return "", err
+		}
+	}
+
+	best := results[0]
+	switch {
+	case best.Err != nil && regionName == "":
+		fmt.Println(ui.Warning("No region is reachable; trying " + best.Name + " first"))
+	case best.Err != nil:
+		fmt.Println(ui.Warning(fmt.Sprintf("Region %s is unreachable: %v", best.Name, best.Err)))
+	default:
+		fmt.Println(ui.Muted(fmt.Sprintf("Using region %s (%s, %s)", best.Name, best.Addr, best.RTT.Round(100*time.Microsecond))))
+	}
+
+	serverFallbacks = serverFallbacks[:0]
+	for _, r := range results[1:] {
+		serverFallbacks = append(serverFallbacks, r.Addr)
+	}
+	return best.Addr, nil
+}
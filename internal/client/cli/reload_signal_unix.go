@@ -0,0 +1,35 @@
+//go:build !windows
+
+package cli
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"go.uber.org/zap"
+)
+
+// watchReloadSignal reloads the server configuration on SIGHUP. The
+// returned function stops watching.
+func watchReloadSignal(logger *zap.Logger, reloader *serverReloader) func() {
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGHUP)
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case <-sigCh:
+				if _, err := reloader.Reload(); err != nil {
+					logger.Error("Configuration reload failed, keeping the running configuration", zap.Error(err))
+				}
+			case <-done:
+				signal.Stop(sigCh)
+				return
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
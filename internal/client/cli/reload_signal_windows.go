@@ -0,0 +1,11 @@
+//go:build windows
+
+package cli
+
+import "go.uber.org/zap"
+
+// watchReloadSignal is a no-op on Windows, which has no SIGHUP. Use the
+// server admin API to reload the configuration instead.
+func watchReloadSignal(_ *zap.Logger, _ *serverReloader) func() {
+	return func() {}
+}
@@ -0,0 +1,176 @@
+package cli
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"time"
+
+	"drip/internal/client/har"
+	"drip/internal/shared/ui"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	replayMethod string
+	replayPath   string
+	replayTunnel string
+	replayList   bool
+)
+
+var replayCmd = &cobra.Command{
+	Use:   "replay <file.har> <port|host:port|url> | replay <id> --tunnel <name>",
+	Short: "Send recorded requests to a local service again",
+	Long: `Send the requests in a HAR file, in the order they were recorded, to a
+local service and compare its status codes with the recorded ones.
+
+Archives written by 'drip http --har' replay as-is. Requests whose body
+was truncated by --har-max-body are skipped.
+
+With --tunnel, requests are taken from the tunnel's request store on the
+server instead, kept with 'drip http --request-store N'. The store survives
+reconnects and also keeps requests that arrived while the client was
+away, so webhooks missed during a restart can be sent again once the
+tunnel is back.
+
+Example:
+  drip replay session.har 3000                      Replay against localhost:3000
+  drip replay session.har https://localhost:8443    Replay against an HTTPS service
+  drip replay session.har 3000 --path /webhook      Only replay webhook deliveries
+  drip replay --list --tunnel myapp                 List the requests the server kept
+  drip replay 42 --tunnel myapp                     Send stored request 42 to the tunnel`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		switch {
+		case replayList:
+			return cobra.NoArgs(cmd, args)
+		case replayTunnel != "":
+			return cobra.ExactArgs(1)(cmd, args)
+		}
+		return cobra.ExactArgs(2)(cmd, args)
+	},
+	RunE:          runReplay,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+}
+
+func init() {
+	replayCmd.Flags().StringVar(&replayMethod, "method", "", "Only replay requests with this method")
+	replayCmd.Flags().StringVar(&replayPath, "path", "", "Only replay requests whose path starts with this prefix")
+	replayCmd.Flags().StringVar(&replayTunnel, "tunnel", "", "Replay from the request store of this tunnel on the server")
+	replayCmd.Flags().BoolVar(&replayList, "list", false, "List the requests in the tunnel's request store")
+	rootCmd.AddCommand(replayCmd)
+}
+
+func runReplay(_ *cobra.Command, args []string) error {
+	if replayList || replayTunnel != "" {
+		return runStoreReplay(args)
+	}
+
+	archive, err := har.Load(args[0])
+	if err != nil {
+		return err
+	}
+
+	base, err := parseReplayTarget(args[1])
+	if err != nil {
+		return err
+	}
+
+	client := &http.Client{
+		Timeout: 30 * time.Second,
+		Transport: &http.Transport{
+			// Local HTTPS services almost always use self-signed certificates.
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	var sent, matched, skipped, failed int
+	for _, entry := range archive.Log.Entries {
+		if ctx.Err() != nil {
+			break
+		}
+		if !replayMatches(&entry) {
+			continue
+		}
+
+		label := entry.Request.Method + " " + entry.Request.URL
+
+		req, err := entry.NewRequest(ctx, base)
+		if err != nil {
+			skipped++
+			fmt.Printf("%s %s\n", ui.Warning("skip"), ui.Muted(label+": "+err.Error()))
+			continue
+		}
+
+		sent++
+		start := time.Now()
+		resp, err := client.Do(req)
+		if err != nil {
+			failed++
+			fmt.Printf("%s %s\n", ui.Error("fail"), ui.Muted(label+": "+err.Error()))
+			continue
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+
+		elapsed := time.Since(start).Round(time.Millisecond)
+		status := strconv.Itoa(resp.StatusCode)
+		if resp.StatusCode == entry.Response.Status {
+			matched++
+			status = ui.Success(status)
+		} else {
+			status = ui.Warning(fmt.Sprintf("%s (recorded %d)", status, entry.Response.Status))
+		}
+		fmt.Printf("%s %s %s\n", status, label, ui.Muted(elapsed.String()))
+	}
+
+	fmt.Println(ui.Muted(fmt.Sprintf("Replayed %d requests: %d matched the recorded status, %d failed, %d skipped",
+		sent, matched, failed, skipped)))
+	return nil
+}
+
+// parseReplayTarget turns a port, host:port or URL into the origin
+// requests are replayed against.
+func parseReplayTarget(arg string) (*url.URL, error) {
+	if strings.Contains(arg, "://") {
+		u, err := url.Parse(arg)
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("invalid replay target %q", arg)
+		}
+		return u, nil
+	}
+
+	host, port, err := parseLocalTarget(arg, "127.0.0.1")
+	if err != nil {
+		return nil, err
+	}
+	return &url.URL{Scheme: "http", Host: net.JoinHostPort(host, strconv.Itoa(port))}, nil
+}
+
+func replayMatches(e *har.Entry) bool {
+	if replayMethod != "" && !strings.EqualFold(e.Request.Method, replayMethod) {
+		return false
+	}
+	if replayPath != "" {
+		u, err := url.Parse(e.Request.URL)
+		if err != nil || !strings.HasPrefix(u.Path, replayPath) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,134 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"time"
+
+	"drip/internal/shared/protocol"
+	"drip/internal/shared/ui"
+)
+
+// runStoreReplay lists (--list) or replays (an id) the requests kept by
+// the request store of --tunnel on the server.
+func runStoreReplay(args []string) error {
+	if replayTunnel == "" {
+		return fmt.Errorf("--list needs --tunnel")
+	}
+	if replayMethod != "" || replayPath != "" {
+		return fmt.Errorf("--method and --path only apply to HAR files")
+	}
+
+	server, token, tlsConfig, err := consumerServer("replaying stored requests")
+	if err != nil {
+		return err
+	}
+	proxyDialer, err := resolveProxy()
+	if err != nil {
+		return err
+	}
+	client := &http.Client{
+		Timeout: 60 * time.Second,
+		Transport: &http.Transport{
+			DialTLSContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				conn, err := proxyDialer.DialTLSContext(ctx, server, tlsConfig)
+				if err != nil {
+					return nil, err
+				}
+				return conn, nil
+			},
+		},
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	q := url.Values{"tunnel": {replayTunnel}}
+	if replayList {
+		var list []protocol.StoredRequest
+		if err := storeRequest(ctx, client, http.MethodGet, server, token, q, &list); err != nil {
+			return err
+		}
+		printStoredRequests(list)
+		return nil
+	}
+
+	id, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil || id <= 0 {
+		return fmt.Errorf("invalid request id %q: see 'drip replay --list --tunnel %s'", args[0], replayTunnel)
+	}
+	q.Set("id", args[0])
+	var result protocol.ReplayResult
+	if err := storeRequest(ctx, client, http.MethodPost, server, token, q, &result); err != nil {
+		return err
+	}
+
+	status := strconv.Itoa(result.Status)
+	if result.Status < http.StatusBadRequest {
+		status = ui.Success(status)
+	} else {
+		status = ui.Warning(status)
+	}
+	fmt.Printf("%s request %d %s\n", status, id, ui.Muted((time.Duration(result.DurationMs) * time.Millisecond).String()))
+	return nil
+}
+
+// storeRequest calls the server's replay endpoint and decodes its answer
+// into out.
+func storeRequest(ctx context.Context, client *http.Client, method, server, token string, q url.Values, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, method, "https://"+server+protocol.ReplayPath+"?"+q.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 256))
+		return fmt.Errorf("server refused: %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func printStoredRequests(list []protocol.StoredRequest) {
+	if len(list) == 0 {
+		fmt.Println(ui.Muted("No stored requests for tunnel " + replayTunnel))
+		return
+	}
+
+	table := ui.NewTable([]string{"ID", "TIME", "REQUEST", "SIZE", "STATUS"})
+	for _, r := range list {
+		size := strconv.FormatInt(r.Size, 10)
+		if r.Truncated {
+			size = "too large to replay"
+		}
+		status := strconv.Itoa(r.Status)
+		if r.Offline {
+			status += " (offline)"
+		}
+		table.AddRow([]string{
+			strconv.FormatInt(r.ID, 10),
+			r.Time.Local().Format(time.DateTime),
+			r.Method + " " + r.URI,
+			size,
+			status,
+		})
+	}
+	table.Print()
+}
@@ -2,12 +2,19 @@ package cli
 
 import (
 	"fmt"
+	"time"
 
+	"drip/internal/client/service"
+	"drip/internal/client/tcp"
+	"drip/internal/shared/chaos"
 	"drip/internal/shared/ui"
 
 	"github.com/spf13/cobra"
 )
 
+// defaultDrainTimeout is the default for --drain-timeout.
+const defaultDrainTimeout = 10 * time.Second
+
 var (
 	// Version information
 	Version      = "dev"
@@ -20,6 +27,19 @@ var (
 	authToken string
 	verbose   bool
 	insecure  bool
+
+	serverFingerprint string
+	profileName       string
+	regionName        string
+	drainTimeout      time.Duration
+	powerSave         bool
+	chaosSpec         string
+	proxyURL          string
+	proxyPAC          string
+	proxyUser         string
+
+	// chaosConfig is --chaos parsed before any command runs.
+	chaosConfig *chaos.Config
 )
 
 var rootCmd = &cobra.Command{
@@ -44,9 +64,26 @@ Features:
   ✓ HTTP and TCP tunnel support
   ✓ Auto-save configuration
   ✓ Custom subdomains
-  ✓ Authentication via token`,
+  ✓ Authentication via token
+
+Environment:
+  Every flag can also be set with a DRIP_ variable named after it, e.g.
+  DRIP_SERVER for --server or DRIP_TCP_PORT_MIN for 'drip server
+  --tcp-port-min'; lists are comma-separated. DRIP_SERVER_ADDR and
+  DRIP_AUTH_TOKEN are accepted for --server and --token too. Flags win
+  over variables, and variables over the config file.`,
 	SilenceUsage:  true,
 	SilenceErrors: true,
+	PersistentPreRunE: func(cmd *cobra.Command, _ []string) error {
+		if err := applyEnv(cmd); err != nil {
+			return err
+		}
+		var err error
+		if chaosConfig, err = chaos.Parse(chaosSpec); err != nil {
+			return fmt.Errorf("invalid --chaos: %w", err)
+		}
+		return nil
+	},
 }
 
 func init() {
@@ -54,6 +91,15 @@ func init() {
 	rootCmd.PersistentFlags().StringVarP(&authToken, "token", "t", "", "Authentication token")
 	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "Verbose output")
 	rootCmd.PersistentFlags().BoolVarP(&insecure, "insecure", "k", false, "Skip TLS verification (testing only, NOT recommended)")
+	rootCmd.PersistentFlags().StringVar(&serverFingerprint, "server-fingerprint", "", "Pinned server public key hash (sha256/<base64>), for self-signed servers")
+	rootCmd.PersistentFlags().StringVar(&regionName, "region", getEnvString("DRIP_REGION", ""), "Region to connect to instead of the closest one, see 'regions' in the config file (env: DRIP_REGION)")
+	rootCmd.PersistentFlags().DurationVar(&drainTimeout, "drain-timeout", getEnvDuration("DRIP_DRAIN_TIMEOUT", defaultDrainTimeout), "How long closing a tunnel connection waits for requests in flight to finish (0 = close right away) (env: DRIP_DRAIN_TIMEOUT)")
+	rootCmd.PersistentFlags().BoolVar(&powerSave, "power-save", false, "Stop heartbeats while a tunnel is idle and rely on TCP keepalive, to save battery on laptops and mobile hotspots")
+	rootCmd.PersistentFlags().StringVar(&chaosSpec, "chaos", getEnvString("DRIP_CHAOS", ""), "Inject faults into tunnel connections for testing, e.g. latency=100ms,jitter=20ms,write-delay=1ms,disconnect=30s (env: DRIP_CHAOS)")
+	rootCmd.PersistentFlags().StringVar(&proxyURL, "proxy", getEnvString("DRIP_PROXY", ""), "Proxy to reach the server through, e.g. http://proxy:8080 or socks5://proxy:1080, or \"direct\" to ignore HTTPS_PROXY (env: DRIP_PROXY)")
+	rootCmd.PersistentFlags().StringVar(&proxyPAC, "proxy-pac", getEnvString("DRIP_PROXY_PAC", ""), "Proxy auto-config (PAC) file URL or path choosing the proxy (env: DRIP_PROXY_PAC)")
+	rootCmd.PersistentFlags().StringVar(&proxyUser, "proxy-user", getEnvString("DRIP_PROXY_USER", ""), "Proxy credentials as user:password, with DOMAIN\\user for NTLM; a Kerberos ticket from kinit is used when the proxy offers Negotiate (env: DRIP_PROXY_USER)")
+	rootCmd.PersistentFlags().StringVar(&profileName, "profile", getEnvString("DRIP_PROFILE", ""), "Config profile to use (default: the current profile, see 'drip profile') (env: DRIP_PROFILE)")
 
 	versionCmd.Flags().BoolVar(&versionPlain, "short", false, "Print version information without styling")
 
@@ -90,12 +136,17 @@ var versionCmd = &cobra.Command{
 
 // Execute runs the root command
 func Execute() error {
+	documentEnv(rootCmd)
+	if service.IsService() {
+		return service.Run(rootCmd.Execute, requestQuit)
+	}
 	return rootCmd.Execute()
 }
 
 // SetVersion sets the version information
 func SetVersion(version, commit, buildTime string) {
 	Version = version
+	tcp.SetClientVersion(version)
 	GitCommit = commit
 	BuildTime = buildTime
 }
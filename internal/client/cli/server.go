@@ -1,19 +1,36 @@
 package cli
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	_ "net/http/pprof"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"syscall"
+	"time"
 
+	"drip/internal/server/abuse"
+	"drip/internal/server/audit"
+	"drip/internal/server/dnspub"
+	"drip/internal/server/federation"
+	"drip/internal/server/geoip"
+	"drip/internal/server/health"
+	"drip/internal/server/hooks"
+	"drip/internal/server/memlimit"
+	"drip/internal/server/p2p"
+	"drip/internal/server/ports"
 	"drip/internal/server/proxy"
 	"drip/internal/server/tcp"
+	servertls "drip/internal/server/tls"
 	"drip/internal/server/tunnel"
 	"drip/internal/shared/constants"
+	"drip/internal/shared/pool"
+	"drip/internal/shared/protocol"
+	"drip/internal/shared/recovery"
 	"drip/internal/shared/tuning"
 	"drip/internal/shared/utils"
 	"drip/pkg/config"
@@ -26,19 +43,84 @@ var (
 	serverPublicPort   int
 	serverDomain       string
 	serverTunnelDomain string
+	serverSubStyle     string
+	serverReserved     string
+	serverBlocked      string
+	serverNoDenylist   bool
 	serverAuthToken    string
 	serverMetricsToken string
 	serverDebug        bool
 	serverTCPPortMin   int
 	serverTCPPortMax   int
+	serverTCPExclude   string
+	serverTCPBind      string
 	serverTLSCert      string
 	serverTLSKey       string
 	serverPprofPort    int
+	serverAdminAddr    string
 	serverTransports   string
 	serverTunnelTypes  string
 	serverConfigFile   string
+	serverProxyProto   bool
+	serverBanThreshold int
+	serverBanDuration  time.Duration
+	serverBanMax       time.Duration
+	serverAuditLog     string
+	serverAuditChain   bool
+	serverGeoIPDB      string
+	serverMaxConns     int
+	serverAcceptRate   int
+	serverAcceptBurst  int
+	serverMaxPerIP     int
+	serverHeaderTO     time.Duration
+	serverMinRate      string
+	serverTokenTunnels int
+	serverTokenPorts   float64
+	serverTokenBW      string
+	serverTLS12        bool
+	serverTLSCurves    string
+	serverTLSALPN      string
+	serverTLSTicketRot time.Duration
+	serverTLSNoTickets bool
+	serverHTTP3        bool
+	serverP2P          bool
+	serverCrashDir     string
+	serverDataDir      string
+	serverWorkerMin    int
+	serverWorkerMax    int
+	serverWorkerQueue  int
+	serverOverload     string
+	serverMemLimit     string
+	serverMemTunnel    string
+	serverMaxHeaders   string
+	serverMaxBody      string
+	serverHookURL      string
+	serverHookToken    string
+	serverHookEvents   string
+	serverDNSProvider  string
+	serverDNSZone      string
+	serverDNSTarget    string
+	serverDNSTTL       time.Duration
+	serverDNSServer    string
+	serverDNSToken     string
+	serverFedPeers     string
+	serverFedToken     string
+	serverFedInsecure  bool
+	serverMinClient    string
+	serverUpgradeURL   string
+	serverSSHPort      int
+	serverSSHHostKey   string
+	serverSSHKeys      string
 )
 
+// defaultUpgradeURL is where clients rejected by --min-client-version are
+// sent unless the operator hosts their own builds.
+const defaultUpgradeURL = "https://github.com/Gouryella/drip/releases"
+
+// shutdownTimeout bounds how long the server waits for connections to drain
+// after a shutdown signal.
+const shutdownTimeout = 30 * time.Second
+
 var serverCmd = &cobra.Command{
 	Use:           "server",
 	Short:         "Start Drip server",
@@ -59,31 +141,618 @@ func init() {
 	serverCmd.Flags().IntVar(&serverPublicPort, "public-port", getEnvInt("DRIP_PUBLIC_PORT", 0), "Public port to display in URLs (env: DRIP_PUBLIC_PORT)")
 	serverCmd.Flags().StringVarP(&serverDomain, "domain", "d", getEnvString("DRIP_DOMAIN", constants.DefaultDomain), "Server domain for client connections (env: DRIP_DOMAIN)")
 	serverCmd.Flags().StringVar(&serverTunnelDomain, "tunnel-domain", getEnvString("DRIP_TUNNEL_DOMAIN", ""), "Domain for tunnel URLs, defaults to --domain (env: DRIP_TUNNEL_DOMAIN)")
+	serverCmd.Flags().StringVar(&serverSubStyle, "subdomain-style", getEnvString("DRIP_SUBDOMAIN_STYLE", utils.SubdomainStyleHex), "Style of generated subdomains: hex (3f9a2c7e), words (calm-amber-otter) or prefix (alice-3f9a2c, falls back to hex); clients may ask for another (env: DRIP_SUBDOMAIN_STYLE)")
+	serverCmd.Flags().StringVar(&serverReserved, "reserved-subdomains", getEnvString("DRIP_RESERVED_SUBDOMAINS", ""), "Subdomains no tunnel may use, besides www, api, admin, mail and the like (env: DRIP_RESERVED_SUBDOMAINS)")
+	serverCmd.Flags().StringVar(&serverBlocked, "blocked-subdomain-words", getEnvString("DRIP_BLOCKED_SUBDOMAIN_WORDS", ""), "Words no part of a subdomain may be, besides the built-in profanity list (env: DRIP_BLOCKED_SUBDOMAIN_WORDS)")
+	serverCmd.Flags().BoolVar(&serverNoDenylist, "no-default-denylist", getEnvBool("DRIP_NO_DEFAULT_DENYLIST", false), "Drop the built-in reserved subdomains and profanity list (env: DRIP_NO_DEFAULT_DENYLIST)")
 	serverCmd.Flags().StringVarP(&serverAuthToken, "token", "t", getEnvString("DRIP_TOKEN", ""), "Authentication token (env: DRIP_TOKEN)")
 	serverCmd.Flags().StringVar(&serverMetricsToken, "metrics-token", getEnvString("DRIP_METRICS_TOKEN", ""), "Metrics and stats token (env: DRIP_METRICS_TOKEN)")
 	serverCmd.Flags().BoolVar(&serverDebug, "debug", false, "Enable debug logging")
 	serverCmd.Flags().IntVar(&serverTCPPortMin, "tcp-port-min", getEnvInt("DRIP_TCP_PORT_MIN", constants.DefaultTCPPortMin), "Minimum TCP tunnel port (env: DRIP_TCP_PORT_MIN)")
 	serverCmd.Flags().IntVar(&serverTCPPortMax, "tcp-port-max", getEnvInt("DRIP_TCP_PORT_MAX", constants.DefaultTCPPortMax), "Maximum TCP tunnel port (env: DRIP_TCP_PORT_MAX)")
+	serverCmd.Flags().StringVar(&serverTCPBind, "tcp-bind", getEnvString("DRIP_TCP_BIND", "0.0.0.0"), "IPs TCP tunnel ports listen on, e.g. 0.0.0.0,:: or * for one dual-stack socket (env: DRIP_TCP_BIND)")
+	serverCmd.Flags().StringVar(&serverTCPExclude, "tcp-port-exclude", getEnvString("DRIP_TCP_PORT_EXCLUDE", ""), "Ports never given to TCP tunnels, e.g. 5432,6000-6010 (env: DRIP_TCP_PORT_EXCLUDE)")
 
 	// TLS options
 	serverCmd.Flags().StringVar(&serverTLSCert, "tls-cert", getEnvString("DRIP_TLS_CERT", ""), "Path to TLS certificate file (env: DRIP_TLS_CERT)")
 	serverCmd.Flags().StringVar(&serverTLSKey, "tls-key", getEnvString("DRIP_TLS_KEY", ""), "Path to TLS private key file (env: DRIP_TLS_KEY)")
+	serverCmd.Flags().BoolVar(&serverTLS12, "tls-allow-tls12", getEnvBool("DRIP_TLS_ALLOW_TLS12", false), "Also accept TLS 1.2 for old clients (env: DRIP_TLS_ALLOW_TLS12)")
+	serverCmd.Flags().StringVar(&serverTLSCurves, "tls-curves", getEnvString("DRIP_TLS_CURVES", ""), "Key exchange curve preference, e.g. X25519,P256 (env: DRIP_TLS_CURVES)")
+	serverCmd.Flags().StringVar(&serverTLSALPN, "tls-alpn", getEnvString("DRIP_TLS_ALPN", ""), "HTTP protocols to advertise to visitors by ALPN, e.g. http/1.1 to turn off HTTP/2; drip clients are always offered drip/1 (default: h2,http/1.1) (env: DRIP_TLS_ALPN)")
+	serverCmd.Flags().DurationVar(&serverTLSTicketRot, "tls-ticket-rotation", getEnvDuration("DRIP_TLS_TICKET_ROTATION", 0), "Session ticket key rotation interval, 0 uses Go's built-in rotation (env: DRIP_TLS_TICKET_ROTATION)")
+	serverCmd.Flags().BoolVar(&serverTLSNoTickets, "tls-disable-tickets", getEnvBool("DRIP_TLS_DISABLE_TICKETS", false), "Disable TLS session resumption (env: DRIP_TLS_DISABLE_TICKETS)")
+	serverCmd.Flags().BoolVar(&serverHTTP3, "http3", getEnvBool("DRIP_HTTP3", false), "Also serve visitors over HTTP/3 on the server port in UDP, advertised with Alt-Svc (env: DRIP_HTTP3)")
 
 	// Performance profiling
 	serverCmd.Flags().IntVar(&serverPprofPort, "pprof", getEnvInt("DRIP_PPROF_PORT", 0), "Enable pprof on specified port (env: DRIP_PPROF_PORT)")
+	serverCmd.Flags().StringVar(&serverAdminAddr, "admin-addr", getEnvString("DRIP_ADMIN_ADDR", ""), "Serve /healthz and /readyz probes on this address, e.g. :9090 (env: DRIP_ADMIN_ADDR)")
+	serverCmd.Flags().IntVar(&serverWorkerMin, "worker-min", getEnvInt("DRIP_WORKER_MIN", 0), "Connection workers kept running, 0 uses 5 per CPU (env: DRIP_WORKER_MIN)")
+	serverCmd.Flags().IntVar(&serverWorkerMax, "worker-max", getEnvInt("DRIP_WORKER_MAX", 0), "Maximum connection workers when autoscaling, 0 uses 4x --worker-min (env: DRIP_WORKER_MAX)")
+	serverCmd.Flags().IntVar(&serverWorkerQueue, "worker-queue", getEnvInt("DRIP_WORKER_QUEUE", 0), "Connections that may wait for a worker, 0 uses 20x --worker-min (env: DRIP_WORKER_QUEUE)")
+	serverCmd.Flags().StringVar(&serverOverload, "worker-overload", getEnvString("DRIP_WORKER_OVERLOAD", "spawn"), "What to do with connections when the worker pool is saturated: spawn, block or reject (env: DRIP_WORKER_OVERLOAD)")
+	serverCmd.Flags().StringVar(&serverMemLimit, "mem-limit", getEnvString("DRIP_MEM_LIMIT", ""), "Memory for buffering visitor traffic before requests get 503, e.g. 2G; each open stream counts as 1M (default: unlimited) (env: DRIP_MEM_LIMIT)")
+	serverCmd.Flags().StringVar(&serverMemTunnel, "mem-per-tunnel", getEnvString("DRIP_MEM_PER_TUNNEL", ""), "Share of --mem-limit a single tunnel may use, e.g. 256M; each open stream counts as 1M (default: unlimited) (env: DRIP_MEM_PER_TUNNEL)")
+	serverCmd.Flags().StringVar(&serverMaxHeaders, "max-header-list-size", getEnvString("DRIP_MAX_HEADER_LIST_SIZE", "256K"), "Largest request or response header block, also advertised to HTTP/2 peers (env: DRIP_MAX_HEADER_LIST_SIZE)")
+	serverCmd.Flags().StringVar(&serverMaxBody, "max-request-body", "", "Largest request body forwarded to a tunnel, e.g. 10M; larger requests get a 413 (default: unlimited)")
+	serverCmd.Flags().StringVar(&serverDataDir, "data-dir", getEnvString("DRIP_DATA_DIR", ""), "Directory for all state the server writes (SSH host key, panic stacks, relative --audit-log paths); its config.yaml is read when --config is not given (env: DRIP_DATA_DIR)")
+	serverCmd.Flags().StringVar(&serverCrashDir, "crash-dir", getEnvString("DRIP_CRASH_DIR", ""), "Directory for recovered panic stacks, 'none' disables (default: ~/.drip/crashes) (env: DRIP_CRASH_DIR)")
 
 	// Transport and tunnel type restrictions
 	serverCmd.Flags().StringVar(&serverTransports, "transports", getEnvString("DRIP_TRANSPORTS", "tcp,wss"), "Allowed transports: tcp,wss (env: DRIP_TRANSPORTS)")
-	serverCmd.Flags().StringVar(&serverTunnelTypes, "tunnel-types", getEnvString("DRIP_TUNNEL_TYPES", "http,https,tcp"), "Allowed tunnel types: http,https,tcp (env: DRIP_TUNNEL_TYPES)")
+	serverCmd.Flags().StringVar(&serverTunnelTypes, "tunnel-types", getEnvString("DRIP_TUNNEL_TYPES", "http,https,tcp,tls"), "Allowed tunnel types: http,https,tcp,tls (env: DRIP_TUNNEL_TYPES)")
+
+	// Load balancer integration
+	serverCmd.Flags().BoolVar(&serverProxyProto, "proxy-protocol", getEnvBool("DRIP_PROXY_PROTOCOL", false), "Require PROXY protocol headers on the listener and TCP tunnel ports (env: DRIP_PROXY_PROTOCOL)")
+
+	// Peer-to-peer rendezvous
+	serverCmd.Flags().BoolVar(&serverP2P, "p2p", getEnvBool("DRIP_P2P", false), "Coordinate direct peer-to-peer connections for TCP tunnels (env: DRIP_P2P)")
+
+	// OpenSSH frontend
+	serverCmd.Flags().IntVar(&serverSSHPort, "ssh-port", getEnvInt("DRIP_SSH_PORT", 0), "Accept tunnels from plain OpenSSH clients on this port, e.g. ssh -R 80:localhost:3000 -p 2222 tunnel@host; 0 disables (env: DRIP_SSH_PORT)")
+	serverCmd.Flags().StringVar(&serverSSHHostKey, "ssh-host-key", getEnvString("DRIP_SSH_HOST_KEY", ""), "SSH host private key, created if missing (default: ~/.drip/ssh_host_ed25519_key) (env: DRIP_SSH_HOST_KEY)")
+	serverCmd.Flags().StringVar(&serverSSHKeys, "ssh-authorized-keys", getEnvString("DRIP_SSH_AUTHORIZED_KEYS", ""), "authorized_keys file whose keys may open SSH tunnels without the token (env: DRIP_SSH_AUTHORIZED_KEYS)")
+
+	// Abuse protection
+	serverCmd.Flags().IntVar(&serverBanThreshold, "ban-threshold", getEnvInt("DRIP_BAN_THRESHOLD", 0), "Handshake/protocol failures per minute before an IP is temporarily banned, 0 disables (env: DRIP_BAN_THRESHOLD)")
+	serverCmd.Flags().DurationVar(&serverBanDuration, "ban-duration", getEnvDuration("DRIP_BAN_DURATION", time.Minute), "Initial ban duration, doubled for repeat offenders (env: DRIP_BAN_DURATION)")
+	serverCmd.Flags().DurationVar(&serverBanMax, "ban-max-duration", getEnvDuration("DRIP_BAN_MAX_DURATION", time.Hour), "Maximum ban duration (env: DRIP_BAN_MAX_DURATION)")
+	serverCmd.Flags().StringVar(&serverAuditLog, "audit-log", getEnvString("DRIP_AUDIT_LOG", ""), "Append registrations, auth failures, admin API changes, bans and quota refusals to this JSON lines file (env: DRIP_AUDIT_LOG)")
+	serverCmd.Flags().BoolVar(&serverAuditChain, "audit-chain", getEnvBool("DRIP_AUDIT_CHAIN", false), "Link audit events with SHA-256 hashes; check with 'drip server verify-audit' (env: DRIP_AUDIT_CHAIN)")
+	serverCmd.Flags().StringVar(&serverGeoIPDB, "geoip-db", getEnvString("DRIP_GEOIP_DB", ""), "MaxMind DB file (e.g. GeoLite2-Country.mmdb) for visitor countries in metrics, the X-Drip-Country header and per-tunnel country rules (env: DRIP_GEOIP_DB)")
+	serverCmd.Flags().IntVar(&serverMaxConns, "max-connections", getEnvInt("DRIP_MAX_CONNECTIONS", 0), "Connections handled at once before new ones are closed, 0 disables (env: DRIP_MAX_CONNECTIONS)")
+	serverCmd.Flags().IntVar(&serverAcceptRate, "accept-rate", getEnvInt("DRIP_ACCEPT_RATE", 0), "New connections accepted per second, 0 disables (env: DRIP_ACCEPT_RATE)")
+	serverCmd.Flags().IntVar(&serverAcceptBurst, "accept-burst", getEnvInt("DRIP_ACCEPT_BURST", 0), "Connections accepted in a burst above --accept-rate, 0 uses --accept-rate (env: DRIP_ACCEPT_BURST)")
+	serverCmd.Flags().IntVar(&serverMaxPerIP, "max-connections-per-ip", 0, "Connections one IP may hold open at once, tunnel clients and TCP tunnel visitors included; 0 disables")
+	serverCmd.Flags().DurationVar(&serverHeaderTO, "header-timeout", 10*time.Second, "Time visitors have to send their request headers")
+	serverCmd.Flags().StringVar(&serverMinRate, "min-transfer-rate", "", "Slowest rate per second visitors may upload request bodies at once --header-timeout has passed, e.g. 1K (default: bodies must arrive within 30s)")
+	serverCmd.Flags().IntVar(&serverTokenTunnels, "max-tunnels-per-token", getEnvInt("DRIP_MAX_TUNNELS_PER_TOKEN", 0), "Tunnels one client token may have open at once, 0 disables (env: DRIP_MAX_TUNNELS_PER_TOKEN)")
+	serverCmd.Flags().Float64Var(&serverTokenPorts, "token-port-share", getEnvFloat("DRIP_TOKEN_PORT_SHARE", 0), "Share (0-1) of each TCP port range one client token may hold, 0 disables (env: DRIP_TOKEN_PORT_SHARE)")
+	serverCmd.Flags().StringVar(&serverTokenBW, "token-bandwidth", getEnvString("DRIP_TOKEN_BANDWIDTH", ""), "Bandwidth all tunnels of one client token share, e.g. 10M (env: DRIP_TOKEN_BANDWIDTH)")
+
+	// Client version enforcement
+	serverCmd.Flags().StringVar(&serverMinClient, "min-client-version", getEnvString("DRIP_MIN_CLIENT_VERSION", ""), "Reject clients older than this release, e.g. v0.9.0 (env: DRIP_MIN_CLIENT_VERSION)")
+	serverCmd.Flags().StringVar(&serverUpgradeURL, "upgrade-url", getEnvString("DRIP_UPGRADE_URL", defaultUpgradeURL), "Download page shown to rejected clients (env: DRIP_UPGRADE_URL)")
+
+	// Extension webhook
+	serverCmd.Flags().StringVar(&serverHookURL, "hook-url", getEnvString("DRIP_HOOK_URL", ""), "Webhook that can accept, deny or reroute tunnels and requests (env: DRIP_HOOK_URL)")
+	serverCmd.Flags().StringVar(&serverHookToken, "hook-token", getEnvString("DRIP_HOOK_TOKEN", ""), "Bearer token sent to --hook-url (env: DRIP_HOOK_TOKEN)")
+	serverCmd.Flags().StringVar(&serverHookEvents, "hook-events", getEnvString("DRIP_HOOK_EVENTS", "register,disconnect"), "Events sent to --hook-url: register,request,disconnect (env: DRIP_HOOK_EVENTS)")
+
+	// Federation
+	serverCmd.Flags().StringVar(&serverFedPeers, "federation-peers", getEnvString("DRIP_FEDERATION_PEERS", ""), "Other servers whose HTTP tunnels are served under this domain, e.g. https://eu.example.com (env: DRIP_FEDERATION_PEERS)")
+	serverCmd.Flags().StringVar(&serverFedToken, "federation-token", getEnvString("DRIP_FEDERATION_TOKEN", ""), "Token shared by all federated servers (env: DRIP_FEDERATION_TOKEN)")
+	serverCmd.Flags().BoolVar(&serverFedInsecure, "federation-insecure", getEnvBool("DRIP_FEDERATION_INSECURE", false), "Skip TLS verification of federation peers (testing only) (env: DRIP_FEDERATION_INSECURE)")
+
+	// DNS publishing
+	serverCmd.Flags().StringVar(&serverDNSProvider, "dns-provider", getEnvString("DRIP_DNS_PROVIDER", ""), "Keep a DNS record for each tunnel hostname while it is connected, for tunnel domains without a wildcard record: cloudflare, route53 or rfc2136 (env: DRIP_DNS_PROVIDER)")
+	serverCmd.Flags().StringVar(&serverDNSZone, "dns-zone", getEnvString("DRIP_DNS_ZONE", ""), "Zone ID or name the records go in (default: found from the tunnel domain) (env: DRIP_DNS_ZONE)")
+	serverCmd.Flags().StringVar(&serverDNSTarget, "dns-target", getEnvString("DRIP_DNS_TARGET", ""), "IPs for A/AAAA records, or a hostname for a CNAME (default: --domain) (env: DRIP_DNS_TARGET)")
+	serverCmd.Flags().DurationVar(&serverDNSTTL, "dns-ttl", getEnvDuration("DRIP_DNS_TTL", time.Minute), "TTL of the records (env: DRIP_DNS_TTL)")
+	serverCmd.Flags().StringVar(&serverDNSServer, "dns-server", getEnvString("DRIP_DNS_SERVER", ""), "Name server taking rfc2136 updates, e.g. ns1.example.com:53 (env: DRIP_DNS_SERVER)")
+	serverCmd.Flags().StringVar(&serverDNSToken, "dns-token", getEnvString("DRIP_DNS_TOKEN", ""), "Cloudflare API token, or rfc2136 TSIG key as [algorithm:]name:secret; route53 uses the usual AWS credentials (env: DRIP_DNS_TOKEN)")
 }
 
 func runServer(cmd *cobra.Command, _ []string) error {
 	// Apply server-mode GC tuning (high throughput, more memory)
 	tuning.ApplyMode(tuning.ModeServer)
 
+	cfg, configPath, err := loadServerConfig(cmd)
+	if err != nil {
+		return err
+	}
+
+	if err := utils.InitServerLogger(cfg.Debug); err != nil {
+		return fmt.Errorf("failed to initialize logger: %w", err)
+	}
+	defer utils.Sync()
+
+	logger := utils.GetLogger()
+	defer watchLogLevelSignal(logger)()
+
+	if configPath != "" {
+		logger.Info("Loaded configuration from file", zap.String("path", configPath))
+	}
+
+	logger.Info("Starting Drip Server",
+		zap.String("version", Version),
+		zap.String("commit", GitCommit),
+	)
+
+	if cfg.PprofPort > 0 {
+		go func() {
+			pprofAddr := fmt.Sprintf("localhost:%d", cfg.PprofPort)
+			logger.Info("Starting pprof server", zap.String("address", pprofAddr))
+			if err := http.ListenAndServe(pprofAddr, nil); err != nil {
+				logger.Error("pprof server failed", zap.Error(err))
+			}
+		}()
+	}
+
+	if err := cfg.Validate(); err != nil {
+		logger.Fatal("Invalid server configuration", zap.Error(err))
+	}
+	if cfg.LogLevel != "" || len(cfg.LogLevels) > 0 {
+		if err := utils.ReplaceLogLevels(serverLogLevel(cfg), cfg.LogLevels); err != nil {
+			logger.Fatal("Invalid log levels", zap.Error(err))
+		}
+	}
+
+	if cfg.DataDir != "" {
+		if err := os.MkdirAll(cfg.DataDir, 0700); err != nil {
+			logger.Fatal("Failed to create data directory", zap.Error(err))
+		}
+		logger.Info("Keeping server state in data directory", zap.String("path", cfg.DataDir))
+	}
+
+	tlsConfig, err := cfg.LoadTLSConfig()
+	if err != nil {
+		logger.Fatal("Failed to load TLS configuration", zap.Error(err))
+	}
+
+	var ticketRotator *servertls.TicketRotator
+	if cfg.TLSEnabled {
+		logger.Info("TLS configuration loaded",
+			zap.String("cert", cfg.TLSCertFile),
+			zap.String("key", cfg.TLSKeyFile),
+			zap.Bool("allow_tls12", cfg.TLSAllowTLS12),
+			zap.Strings("curves", cfg.TLSCurves),
+			zap.Strings("alpn", cfg.TLSALPN),
+		)
+		if leaf := tlsConfig.Certificates[0].Leaf; leaf != nil {
+			logger.Info("Clients can pin this server with --server-fingerprint",
+				zap.String("fingerprint", config.SPKIFingerprint(leaf)),
+			)
+		}
+		if cfg.TLSAllowTLS12 {
+			logger.Warn("TLS 1.2 fallback enabled - only use this for clients that cannot speak TLS 1.3")
+		}
+
+		if cfg.TLSTicketRotation > 0 && !cfg.TLSDisableTickets {
+			ticketRotator, err = servertls.NewTicketRotator(tlsConfig, cfg.TLSTicketRotation, logger)
+			if err != nil {
+				logger.Fatal("Failed to initialize TLS session ticket keys", zap.Error(err))
+			}
+			ticketRotator.Start()
+			logger.Info("TLS session ticket rotation enabled",
+				zap.Duration("interval", cfg.TLSTicketRotation),
+			)
+		}
+	} else {
+		logger.Info("TLS disabled - running in plain TCP mode (for reverse proxy)")
+	}
+
+	tunnelManager := tunnel.NewManager(logger)
+	if !utils.IsSubdomainStyle(cfg.SubdomainStyle) {
+		logger.Fatal("Invalid subdomain style",
+			zap.String("subdomain_style", cfg.SubdomainStyle),
+			zap.Strings("valid", utils.SubdomainStyles),
+		)
+	}
+	tunnelManager.SetSubdomainStyle(cfg.SubdomainStyle)
+	denylist := tunnel.NewDenylist(cfg.ReservedSubdomains, cfg.BlockedSubdomainWords, !cfg.NoDefaultDenylist)
+	tunnelManager.SetDenylist(denylist)
+	if len(cfg.ReservedSubdomains) > 0 || len(cfg.BlockedSubdomainWords) > 0 || cfg.NoDefaultDenylist {
+		logger.Info("Subdomain denylist configured",
+			zap.Int("entries", denylist.Len()),
+			zap.Bool("defaults", !cfg.NoDefaultDenylist),
+		)
+	}
+
+	// The budgets are off by default: every stream reserves its full
+	// buffer size for its whole life, so long-lived websocket or SSE
+	// streams would exhaust a budget sized from the host's memory.
+	memLimit, err := parseBandwidth(cfg.MemLimit)
+	if err != nil {
+		logger.Fatal("Invalid memory limit", zap.Error(err))
+	}
+	memPerTunnel, err := parseBandwidth(cfg.MemPerTunnel)
+	if err != nil {
+		logger.Fatal("Invalid per-tunnel memory limit", zap.Error(err))
+	}
+	memGovernor := memlimit.NewGovernor(memLimit, memPerTunnel)
+	tunnelManager.SetMemoryGovernor(memGovernor)
+	if memGovernor.Enabled() {
+		logger.Info("Memory budget configured",
+			zap.Int64("limit_bytes", memLimit),
+			zap.Int64("per_tunnel_bytes", memPerTunnel),
+		)
+	}
+
+	portAllocator, err := newPortAllocator(cfg)
+	if err != nil {
+		logger.Fatal("Invalid TCP port range", zap.Error(err))
+	}
+
+	// No host: one dual-stack socket takes IPv4 and IPv6 visitors.
+	listenAddr := fmt.Sprintf(":%d", cfg.Port)
+
+	overloadPolicy, err := pool.ParseOverloadPolicy(cfg.WorkerOverload)
+	if err != nil {
+		logger.Fatal("Invalid worker pool configuration", zap.Error(err))
+	}
+
+	maxHeaderListSize, err := parseBandwidth(cfg.MaxHeaderListSize)
+	if err != nil || maxHeaderListSize <= 0 {
+		logger.Fatal("Invalid max header list size",
+			zap.String("max_header_list_size", cfg.MaxHeaderListSize),
+			zap.Error(err),
+		)
+	}
+
+	maxRequestBody, err := parseBandwidth(cfg.MaxRequestBody)
+	if err != nil {
+		logger.Fatal("Invalid max request body",
+			zap.String("max_request_body", cfg.MaxRequestBody),
+			zap.Error(err),
+		)
+	}
+
+	minTransferRate, err := parseBandwidth(cfg.MinTransferRate)
+	if err != nil {
+		logger.Fatal("Invalid minimum transfer rate",
+			zap.String("min_transfer_rate", cfg.MinTransferRate),
+			zap.Error(err),
+		)
+	}
+
+	httpHandler := proxy.NewHandler(proxy.HandlerConfig{
+		Manager:      tunnelManager,
+		Logger:       logger.Named(utils.SubsystemProxy),
+		ServerDomain: cfg.Domain,
+		TunnelDomain: cfg.TunnelDomain,
+		AuthToken:    cfg.AuthToken,
+		MetricsToken: cfg.MetricsToken,
+	})
+	httpHandler.SetAllowedTransports(cfg.AllowedTransports)
+	httpHandler.SetMaxHeaderListSize(int(maxHeaderListSize))
+	httpHandler.SetMaxRequestBody(maxRequestBody)
+	httpHandler.SetAllowedTunnelTypes(cfg.AllowedTunnelTypes)
+
+	listener := tcp.NewListener(tcp.ListenerConfig{
+		Address:      listenAddr,
+		TLSConfig:    tlsConfig,
+		AuthToken:    cfg.AuthToken,
+		Manager:      tunnelManager,
+		Logger:       logger.Named(utils.SubsystemProtocol),
+		PortAlloc:    portAllocator,
+		Domain:       cfg.Domain,
+		TunnelDomain: cfg.TunnelDomain,
+		PublicPort:   cfg.PublicPort,
+		HTTPHandler:  httpHandler,
+		WorkerPool: pool.Config{
+			MinWorkers: cfg.WorkerMin,
+			MaxWorkers: cfg.WorkerMax,
+			QueueSize:  cfg.WorkerQueue,
+			Policy:     overloadPolicy,
+		},
+	})
+	listener.SetAllowedTransports(cfg.AllowedTransports)
+	listener.SetAllowedTunnelTypes(cfg.AllowedTunnelTypes)
+	listener.SetAcceptProxyProtocol(cfg.ProxyProtocol)
+	if chaosConfig.Enabled() {
+		logger.Warn("Chaos mode enabled - connections are deliberately degraded, never use this in production",
+			zap.String("chaos", chaosConfig.String()),
+		)
+		listener.SetChaos(chaosConfig)
+	}
+	if err := tcp.ValidateBindAddrs(cfg.TCPBind); err != nil {
+		logger.Fatal("Invalid TCP bind address", zap.Error(err))
+	}
+	listener.SetBindAddrs(cfg.TCPBind)
+	listener.SetMaxHeaderListSize(int(maxHeaderListSize))
+	listener.SetHeaderTimeout(cfg.HeaderTimeout)
+	if minTransferRate > 0 {
+		listener.SetMinTransferRate(minTransferRate)
+		logger.Info("Minimum transfer rate enabled",
+			zap.String("min_transfer_rate", cfg.MinTransferRate),
+			zap.Duration("header_timeout", cfg.HeaderTimeout),
+		)
+	}
+	listener.SetVersionPolicy(tcp.VersionPolicy{
+		ServerVersion:    Version,
+		MinClientVersion: cfg.MinClientVersion,
+		UpgradeURL:       cfg.UpgradeURL,
+	})
+	httpHandler.SetPanicMetrics(listener.PanicMetrics())
+	httpHandler.SetPortAllocator(portAllocator)
+
+	switch cfg.CrashDir {
+	case "none":
+	case "":
+		dir := cfg.DataPath("", "crashes")
+		if dir == "" {
+			dir = recovery.DefaultCrashDir()
+		}
+		listener.SetPanicDumpDir(dir)
+	default:
+		listener.SetPanicDumpDir(cfg.DataPath(cfg.CrashDir, ""))
+	}
+
+	if cfg.HookURL != "" {
+		webhook, err := hooks.NewWebhook(hooks.WebhookConfig{
+			URL:    cfg.HookURL,
+			Token:  cfg.HookToken,
+			Events: cfg.HookEvents,
+		})
+		if err != nil {
+			logger.Fatal("Invalid hook configuration", zap.Error(err))
+		}
+		listener.SetHooks(webhook)
+		httpHandler.SetHooks(webhook)
+		logger.Info("Extension webhook enabled",
+			zap.Strings("events", cfg.HookEvents),
+		)
+	}
+
+	if cfg.FederationToken != "" {
+		router, err := federation.NewRouter(federation.Config{
+			Peers:    cfg.FederationPeers,
+			Token:    cfg.FederationToken,
+			Insecure: cfg.FederationInsecure,
+		}, logger.Named(utils.SubsystemProxy))
+		if err != nil {
+			logger.Fatal("Invalid federation configuration", zap.Error(err))
+		}
+		httpHandler.SetFederation(router)
+		logger.Info("Federation enabled", zap.Strings("peers", cfg.FederationPeers))
+	}
+
+	var dnsPublisher *dnspub.Publisher
+	if cfg.DNSProvider != "" {
+		target := cfg.DNSTarget
+		if target == "" {
+			target = cfg.Domain
+		}
+		records, err := dnspub.ParseTarget(target, cfg.DNSTTL)
+		if err != nil {
+			logger.Fatal("Invalid DNS target", zap.Error(err))
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		provider, err := dnspub.NewProvider(ctx, dnspub.Options{
+			Provider: cfg.DNSProvider,
+			Zone:     cfg.DNSZone,
+			Server:   cfg.DNSServer,
+			Token:    cfg.DNSToken,
+		}, cfg.TunnelDomain)
+		cancel()
+		if err != nil {
+			logger.Fatal("Invalid DNS publishing configuration", zap.Error(err))
+		}
+		dnsPublisher = dnspub.New(provider, cfg.TunnelDomain, records, logger)
+		tunnelManager.SetDNSPublisher(dnsPublisher)
+		logger.Info("DNS publishing enabled",
+			zap.String("provider", cfg.DNSProvider),
+			zap.String("domain", cfg.TunnelDomain),
+			zap.String("target", target),
+		)
+	}
+
+	if cfg.P2P {
+		broker := p2p.NewBroker()
+		listener.SetP2PBroker(broker)
+		httpHandler.SetP2PBroker(broker)
+		logger.Info("Peer-to-peer rendezvous enabled for TCP tunnels")
+	}
+
+	if cfg.HTTP3 {
+		listener.SetHTTP3(true)
+	}
+
+	if cfg.SSHPort > 0 {
+		hostKeyPath := cfg.DataPath(cfg.SSHHostKey, "ssh_host_ed25519_key")
+		if hostKeyPath == "" {
+			hostKeyPath = tcp.DefaultSSHHostKeyPath()
+		}
+		hostKey, err := tcp.LoadSSHHostKey(hostKeyPath)
+		if err != nil {
+			logger.Fatal("Failed to load SSH host key", zap.Error(err))
+		}
+		sshConfig := &tcp.SSHConfig{
+			Address: fmt.Sprintf(":%d", cfg.SSHPort),
+			HostKey: hostKey,
+		}
+		if cfg.SSHAuthorizedKeys != "" {
+			if sshConfig.AuthorizedKeys, err = tcp.LoadSSHAuthorizedKeys(cfg.SSHAuthorizedKeys); err != nil {
+				logger.Fatal("Failed to load SSH authorized keys", zap.Error(err))
+			}
+		}
+		listener.SetSSH(sshConfig)
+		logger.Info("SSH tunnels enabled",
+			zap.Int("port", cfg.SSHPort),
+			zap.String("host_key", hostKeyPath),
+			zap.Int("authorized_keys", len(sshConfig.AuthorizedKeys)),
+		)
+	}
+
+	banList := abuse.NewBanList(abuse.Config{
+		Threshold:      cfg.BanThreshold,
+		BanDuration:    cfg.BanDuration,
+		MaxBanDuration: cfg.MaxBanDuration,
+	}, logger)
+	banList.SetBlocked(bannedIPs(cfg))
+	listener.SetBanList(banList)
+	httpHandler.SetBanList(banList)
+	if banList.Enabled() {
+		logger.Info("Automatic IP banning enabled",
+			zap.Int("threshold", cfg.BanThreshold),
+			zap.Duration("ban_duration", cfg.BanDuration),
+			zap.Duration("max_ban_duration", cfg.MaxBanDuration),
+		)
+	}
+	if len(cfg.BannedIPs) > 0 {
+		logger.Info("Banned IPs configured", zap.Int("entries", len(cfg.BannedIPs)))
+	}
+
+	if cfg.AuditLog != "" {
+		auditLog, err := audit.Open(cfg.DataPath(cfg.AuditLog, ""), cfg.AuditChain, logger)
+		if err != nil {
+			logger.Fatal("Failed to open audit log", zap.Error(err))
+		}
+		defer auditLog.Close()
+		listener.SetAudit(auditLog)
+		httpHandler.SetAudit(auditLog)
+		banList.SetAudit(auditLog)
+		logger.Info("Audit log enabled",
+			zap.String("path", cfg.DataPath(cfg.AuditLog, "")),
+			zap.Bool("chained", cfg.AuditChain),
+		)
+	}
+
+	if cfg.GeoIPDB != "" {
+		geoDB, err := geoip.Open(cfg.GeoIPDB)
+		if err != nil {
+			logger.Fatal("Failed to load GeoIP database", zap.Error(err))
+		}
+		listener.SetGeoIP(geoDB)
+		httpHandler.SetGeoIP(geoDB)
+		logger.Info("GeoIP lookups enabled", zap.String("path", cfg.GeoIPDB))
+	}
+
+	acceptLimiter := abuse.NewAcceptLimiter(abuse.AcceptConfig{
+		MaxConnections:      cfg.MaxConnections,
+		MaxConnectionsPerIP: cfg.MaxConnectionsPerIP,
+		Rate:                cfg.AcceptRate,
+		Burst:               cfg.AcceptBurst,
+	})
+	if acceptLimiter != nil {
+		logger.Info("Connection limits enabled",
+			zap.Int("max_connections", cfg.MaxConnections),
+			zap.Int("max_connections_per_ip", cfg.MaxConnectionsPerIP),
+			zap.Int("accept_rate", cfg.AcceptRate),
+			zap.Int("accept_burst", cfg.AcceptBurst),
+		)
+	} else {
+		// Admits everything until a reload sets limits.
+		acceptLimiter = &abuse.AcceptLimiter{}
+	}
+	listener.SetAcceptLimiter(acceptLimiter)
+
+	bandwidth, err := parseBandwidth(cfg.Bandwidth)
+	if err != nil {
+		logger.Fatal("Invalid bandwidth configuration", zap.Error(err))
+	}
+	burstMultiplier := cfg.BurstMultiplier
+	if burstMultiplier <= 0 {
+		burstMultiplier = 2.0
+	}
+	listener.SetBandwidth(bandwidth)
+	listener.SetBurstMultiplier(burstMultiplier)
+	if bandwidth > 0 {
+		logger.Info("Bandwidth limit configured",
+			zap.String("bandwidth", cfg.Bandwidth),
+			zap.Int64("bandwidth_bytes_sec", bandwidth),
+			zap.Float64("burst_multiplier", burstMultiplier),
+		)
+	}
+
+	tokenBandwidth, err := parseBandwidth(cfg.TokenBandwidth)
+	if err != nil {
+		logger.Fatal("Invalid token bandwidth configuration", zap.Error(err))
+	}
+	tunnelManager.SetMaxTunnelsPerToken(cfg.MaxTunnelsPerToken)
+	tunnelManager.SetTokenBandwidth(tokenBandwidth, int(float64(tokenBandwidth)*burstMultiplier))
+	if cfg.MaxTunnelsPerToken > 0 || cfg.TokenPortShare > 0 || tokenBandwidth > 0 {
+		logger.Info("Per-token limits enabled",
+			zap.Int("max_tunnels", cfg.MaxTunnelsPerToken),
+			zap.Float64("port_share", cfg.TokenPortShare),
+			zap.Int64("bandwidth_bytes_sec", tokenBandwidth),
+		)
+	}
+
+	running := *cfg
+	reloader := &serverReloader{
+		cmd:           cmd,
+		cfg:           &running,
+		logger:        logger,
+		listener:      listener,
+		handler:       httpHandler,
+		manager:       tunnelManager,
+		portAlloc:     portAllocator,
+		banList:       banList,
+		acceptLimiter: acceptLimiter,
+	}
+	httpHandler.SetReloader(reloader.Reload)
+	defer watchReloadSignal(logger, reloader)()
+
+	var adminServer *http.Server
+	if cfg.AdminAddr != "" {
+		adminServer = &http.Server{
+			Addr:              cfg.AdminAddr,
+			Handler:           health.NewHandler(listener),
+			ReadHeaderTimeout: 5 * time.Second,
+		}
+		go func() {
+			logger.Info("Starting health probe server", zap.String("address", cfg.AdminAddr))
+			if err := adminServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				logger.Error("Health probe server failed", zap.Error(err))
+			}
+		}()
+	}
+
+	if err := listener.Start(); err != nil {
+		logger.Fatal("Failed to start TCP listener", zap.Error(err))
+	}
+
+	protocol := "TCP (plain)"
+	if cfg.TLSEnabled {
+		protocol = "TCP over TLS 1.3"
+		if cfg.TLSAllowTLS12 {
+			protocol = "TCP over TLS 1.2+"
+		}
+	}
+
+	logger.Info("Drip Server started",
+		zap.String("address", listenAddr),
+		zap.String("domain", cfg.Domain),
+		zap.String("tunnel_domain", cfg.TunnelDomain),
+		zap.String("subdomain_style", cfg.SubdomainStyle),
+		zap.String("protocol", protocol),
+		zap.Strings("transports", cfg.AllowedTransports),
+		zap.Strings("tunnel_types", cfg.AllowedTunnelTypes),
+	)
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+
+	<-quit
+
+	logger.Info("Shutting down server...")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := listener.Shutdown(shutdownCtx); err != nil {
+		logger.Error("Error stopping listener", zap.Error(err))
+	}
+	if dnsPublisher != nil {
+		// The tunnels went away with the listener; so do their records.
+		dnsCtx, dnsCancel := context.WithTimeout(context.Background(), 30*time.Second)
+		dnsPublisher.Close(dnsCtx)
+		dnsCancel()
+	}
+	if ticketRotator != nil {
+		ticketRotator.Stop()
+	}
+	// Probes keep reporting "draining" until the listener is fully stopped.
+	if adminServer != nil {
+		_ = adminServer.Close()
+	}
+
+	logger.Info("Server stopped")
+	return nil
+}
+
+// loadServerConfig reads the config file, if there is one, and applies the
+// flags and environment variables that override it. It returns the path of
+// the file read, if any.
+func loadServerConfig(cmd *cobra.Command) (*config.ServerConfig, string, error) {
 	// Load config file if specified or if default exists
 	var cfg *config.ServerConfig
 	configPath := serverConfigFile
+	if configPath == "" && serverDataDir != "" {
+		if path := filepath.Join(serverDataDir, "config.yaml"); config.ServerConfigExists(path) {
+			configPath = path
+		}
+	}
 	if configPath == "" && config.ServerConfigExists("") {
 		configPath = config.DefaultServerConfigPath()
 	}
@@ -91,7 +760,7 @@ func runServer(cmd *cobra.Command, _ []string) error {
 		var err error
 		cfg, err = config.LoadServerConfig(configPath)
 		if err != nil {
-			return fmt.Errorf("failed to load config file: %w", err)
+			return nil, "", fmt.Errorf("failed to load config file: %w", err)
 		}
 	}
 	if cfg == nil {
@@ -130,6 +799,15 @@ func runServer(cmd *cobra.Command, _ []string) error {
 		cfg.TunnelDomain = serverTunnelDomain
 	}
 
+	// SubdomainStyle
+	if cmd.Flags().Changed("subdomain-style") {
+		cfg.SubdomainStyle = serverSubStyle
+	} else if os.Getenv("DRIP_SUBDOMAIN_STYLE") != "" {
+		cfg.SubdomainStyle = serverSubStyle
+	} else if cfg.SubdomainStyle == "" {
+		cfg.SubdomainStyle = serverSubStyle
+	}
+
 	// AuthToken
 	if cmd.Flags().Changed("token") {
 		cfg.AuthToken = serverAuthToken
@@ -167,6 +845,22 @@ func runServer(cmd *cobra.Command, _ []string) error {
 		cfg.TCPPortMax = serverTCPPortMax
 	}
 
+	// TCPBind
+	if cmd.Flags().Changed("tcp-bind") {
+		cfg.TCPBind = parseCommaSeparated(serverTCPBind)
+	} else if os.Getenv("DRIP_TCP_BIND") != "" {
+		cfg.TCPBind = parseCommaSeparated(serverTCPBind)
+	} else if len(cfg.TCPBind) == 0 {
+		cfg.TCPBind = parseCommaSeparated(serverTCPBind)
+	}
+
+	// TCPPortExclude
+	if cmd.Flags().Changed("tcp-port-exclude") {
+		cfg.TCPPortExclude = parseCommaSeparated(serverTCPExclude)
+	} else if os.Getenv("DRIP_TCP_PORT_EXCLUDE") != "" {
+		cfg.TCPPortExclude = parseCommaSeparated(serverTCPExclude)
+	}
+
 	// TLSCertFile
 	if cmd.Flags().Changed("tls-cert") {
 		cfg.TLSCertFile = serverTLSCert
@@ -188,6 +882,217 @@ func runServer(cmd *cobra.Command, _ []string) error {
 		cfg.PprofPort = serverPprofPort
 	}
 
+	// AdminAddr
+	if cmd.Flags().Changed("admin-addr") {
+		cfg.AdminAddr = serverAdminAddr
+	} else if os.Getenv("DRIP_ADMIN_ADDR") != "" {
+		cfg.AdminAddr = serverAdminAddr
+	}
+
+	// WorkerMin
+	if cmd.Flags().Changed("worker-min") {
+		cfg.WorkerMin = serverWorkerMin
+	} else if os.Getenv("DRIP_WORKER_MIN") != "" {
+		cfg.WorkerMin = serverWorkerMin
+	}
+
+	// WorkerMax
+	if cmd.Flags().Changed("worker-max") {
+		cfg.WorkerMax = serverWorkerMax
+	} else if os.Getenv("DRIP_WORKER_MAX") != "" {
+		cfg.WorkerMax = serverWorkerMax
+	}
+
+	// WorkerQueue
+	if cmd.Flags().Changed("worker-queue") {
+		cfg.WorkerQueue = serverWorkerQueue
+	} else if os.Getenv("DRIP_WORKER_QUEUE") != "" {
+		cfg.WorkerQueue = serverWorkerQueue
+	}
+
+	// WorkerOverload
+	if cmd.Flags().Changed("worker-overload") {
+		cfg.WorkerOverload = serverOverload
+	} else if os.Getenv("DRIP_WORKER_OVERLOAD") != "" {
+		cfg.WorkerOverload = serverOverload
+	} else if cfg.WorkerOverload == "" {
+		cfg.WorkerOverload = serverOverload
+	}
+
+	// MemLimit
+	if cmd.Flags().Changed("mem-limit") {
+		cfg.MemLimit = serverMemLimit
+	} else if os.Getenv("DRIP_MEM_LIMIT") != "" {
+		cfg.MemLimit = serverMemLimit
+	}
+
+	// MemPerTunnel
+	if cmd.Flags().Changed("mem-per-tunnel") {
+		cfg.MemPerTunnel = serverMemTunnel
+	} else if os.Getenv("DRIP_MEM_PER_TUNNEL") != "" {
+		cfg.MemPerTunnel = serverMemTunnel
+	} else if cfg.MemPerTunnel == "" {
+		cfg.MemPerTunnel = serverMemTunnel
+	}
+
+	// MaxHeaderListSize
+	if cmd.Flags().Changed("max-header-list-size") {
+		cfg.MaxHeaderListSize = serverMaxHeaders
+	} else if os.Getenv("DRIP_MAX_HEADER_LIST_SIZE") != "" {
+		cfg.MaxHeaderListSize = serverMaxHeaders
+	} else if cfg.MaxHeaderListSize == "" {
+		cfg.MaxHeaderListSize = serverMaxHeaders
+	}
+
+	// MaxRequestBody
+	if cmd.Flags().Changed("max-request-body") {
+		cfg.MaxRequestBody = serverMaxBody
+	}
+
+	// HookURL
+	if cmd.Flags().Changed("hook-url") {
+		cfg.HookURL = serverHookURL
+	} else if os.Getenv("DRIP_HOOK_URL") != "" {
+		cfg.HookURL = serverHookURL
+	}
+
+	// HookToken
+	if cmd.Flags().Changed("hook-token") {
+		cfg.HookToken = serverHookToken
+	} else if os.Getenv("DRIP_HOOK_TOKEN") != "" {
+		cfg.HookToken = serverHookToken
+	}
+
+	// HookEvents
+	if cmd.Flags().Changed("hook-events") {
+		cfg.HookEvents = parseCommaSeparated(serverHookEvents)
+	} else if os.Getenv("DRIP_HOOK_EVENTS") != "" {
+		cfg.HookEvents = parseCommaSeparated(serverHookEvents)
+	} else if len(cfg.HookEvents) == 0 {
+		cfg.HookEvents = parseCommaSeparated(serverHookEvents)
+	}
+
+	// ReservedSubdomains
+	if cmd.Flags().Changed("reserved-subdomains") {
+		cfg.ReservedSubdomains = parseCommaSeparated(serverReserved)
+	} else if os.Getenv("DRIP_RESERVED_SUBDOMAINS") != "" {
+		cfg.ReservedSubdomains = parseCommaSeparated(serverReserved)
+	}
+
+	// BlockedSubdomainWords
+	if cmd.Flags().Changed("blocked-subdomain-words") {
+		cfg.BlockedSubdomainWords = parseCommaSeparated(serverBlocked)
+	} else if os.Getenv("DRIP_BLOCKED_SUBDOMAIN_WORDS") != "" {
+		cfg.BlockedSubdomainWords = parseCommaSeparated(serverBlocked)
+	}
+
+	// NoDefaultDenylist
+	if cmd.Flags().Changed("no-default-denylist") {
+		cfg.NoDefaultDenylist = serverNoDenylist
+	} else if os.Getenv("DRIP_NO_DEFAULT_DENYLIST") != "" {
+		cfg.NoDefaultDenylist = serverNoDenylist
+	}
+
+	// FederationPeers
+	if cmd.Flags().Changed("federation-peers") {
+		cfg.FederationPeers = parseCommaSeparated(serverFedPeers)
+	} else if os.Getenv("DRIP_FEDERATION_PEERS") != "" {
+		cfg.FederationPeers = parseCommaSeparated(serverFedPeers)
+	}
+
+	// FederationToken
+	if cmd.Flags().Changed("federation-token") {
+		cfg.FederationToken = serverFedToken
+	} else if os.Getenv("DRIP_FEDERATION_TOKEN") != "" {
+		cfg.FederationToken = serverFedToken
+	}
+
+	// FederationInsecure
+	if cmd.Flags().Changed("federation-insecure") {
+		cfg.FederationInsecure = serverFedInsecure
+	} else if os.Getenv("DRIP_FEDERATION_INSECURE") != "" {
+		cfg.FederationInsecure = serverFedInsecure
+	}
+
+	// DNSProvider
+	if cmd.Flags().Changed("dns-provider") {
+		cfg.DNSProvider = serverDNSProvider
+	} else if os.Getenv("DRIP_DNS_PROVIDER") != "" {
+		cfg.DNSProvider = serverDNSProvider
+	}
+
+	// DNSZone
+	if cmd.Flags().Changed("dns-zone") {
+		cfg.DNSZone = serverDNSZone
+	} else if os.Getenv("DRIP_DNS_ZONE") != "" {
+		cfg.DNSZone = serverDNSZone
+	}
+
+	// DNSTarget
+	if cmd.Flags().Changed("dns-target") {
+		cfg.DNSTarget = serverDNSTarget
+	} else if os.Getenv("DRIP_DNS_TARGET") != "" {
+		cfg.DNSTarget = serverDNSTarget
+	}
+
+	// DNSTTL
+	if cmd.Flags().Changed("dns-ttl") {
+		cfg.DNSTTL = serverDNSTTL
+	} else if os.Getenv("DRIP_DNS_TTL") != "" {
+		cfg.DNSTTL = serverDNSTTL
+	} else if cfg.DNSTTL == 0 {
+		cfg.DNSTTL = serverDNSTTL
+	}
+
+	// DNSServer
+	if cmd.Flags().Changed("dns-server") {
+		cfg.DNSServer = serverDNSServer
+	} else if os.Getenv("DRIP_DNS_SERVER") != "" {
+		cfg.DNSServer = serverDNSServer
+	}
+
+	// DNSToken
+	if cmd.Flags().Changed("dns-token") {
+		cfg.DNSToken = serverDNSToken
+	} else if os.Getenv("DRIP_DNS_TOKEN") != "" {
+		cfg.DNSToken = serverDNSToken
+	}
+
+	// MinClientVersion
+	if cmd.Flags().Changed("min-client-version") {
+		cfg.MinClientVersion = serverMinClient
+	} else if os.Getenv("DRIP_MIN_CLIENT_VERSION") != "" {
+		cfg.MinClientVersion = serverMinClient
+	}
+	if cfg.MinClientVersion != "" {
+		if _, ok := protocol.CompareVersions(cfg.MinClientVersion, cfg.MinClientVersion); !ok {
+			return nil, "", fmt.Errorf("invalid minimum client version %q (expected e.g. v0.9.0)", cfg.MinClientVersion)
+		}
+	}
+
+	// UpgradeURL
+	if cmd.Flags().Changed("upgrade-url") {
+		cfg.UpgradeURL = serverUpgradeURL
+	} else if os.Getenv("DRIP_UPGRADE_URL") != "" {
+		cfg.UpgradeURL = serverUpgradeURL
+	} else if cfg.UpgradeURL == "" {
+		cfg.UpgradeURL = serverUpgradeURL
+	}
+
+	// DataDir
+	if cmd.Flags().Changed("data-dir") {
+		cfg.DataDir = serverDataDir
+	} else if os.Getenv("DRIP_DATA_DIR") != "" {
+		cfg.DataDir = serverDataDir
+	}
+
+	// CrashDir
+	if cmd.Flags().Changed("crash-dir") {
+		cfg.CrashDir = serverCrashDir
+	} else if os.Getenv("DRIP_CRASH_DIR") != "" {
+		cfg.CrashDir = serverCrashDir
+	}
+
 	// AllowedTransports
 	if cmd.Flags().Changed("transports") {
 		cfg.AllowedTransports = parseCommaSeparated(serverTransports)
@@ -206,162 +1111,228 @@ func runServer(cmd *cobra.Command, _ []string) error {
 		cfg.AllowedTunnelTypes = parseCommaSeparated(serverTunnelTypes)
 	}
 
-	// TLSEnabled
-	if os.Getenv("DRIP_TLS_ENABLED") != "" {
-		cfg.TLSEnabled = os.Getenv("DRIP_TLS_ENABLED") == "true" || os.Getenv("DRIP_TLS_ENABLED") == "1"
-	} else if cfg.TLSCertFile != "" && cfg.TLSKeyFile != "" {
-		if !cfg.TLSEnabled {
-			cfg.TLSEnabled = true
-		}
+	// ProxyProtocol
+	if cmd.Flags().Changed("proxy-protocol") {
+		cfg.ProxyProtocol = serverProxyProto
+	} else if os.Getenv("DRIP_PROXY_PROTOCOL") != "" {
+		cfg.ProxyProtocol = serverProxyProto
 	}
 
-	if cfg.TLSEnabled {
-		if cfg.TLSCertFile == "" {
-			return fmt.Errorf("TLS certificate path is required when TLS is enabled (use --tls-cert flag, DRIP_TLS_CERT environment variable, or config file)")
-		}
-		if cfg.TLSKeyFile == "" {
-			return fmt.Errorf("TLS private key path is required when TLS is enabled (use --tls-key flag, DRIP_TLS_KEY environment variable, or config file)")
-		}
+	// P2P
+	if cmd.Flags().Changed("p2p") {
+		cfg.P2P = serverP2P
+	} else if os.Getenv("DRIP_P2P") != "" {
+		cfg.P2P = serverP2P
 	}
 
-	if err := utils.InitServerLogger(cfg.Debug); err != nil {
-		return fmt.Errorf("failed to initialize logger: %w", err)
+	// SSHPort
+	if cmd.Flags().Changed("ssh-port") {
+		cfg.SSHPort = serverSSHPort
+	} else if os.Getenv("DRIP_SSH_PORT") != "" {
+		cfg.SSHPort = serverSSHPort
 	}
-	defer utils.Sync()
 
-	logger := utils.GetLogger()
+	// SSHHostKey
+	if cmd.Flags().Changed("ssh-host-key") {
+		cfg.SSHHostKey = serverSSHHostKey
+	} else if os.Getenv("DRIP_SSH_HOST_KEY") != "" {
+		cfg.SSHHostKey = serverSSHHostKey
+	}
 
-	if configPath != "" {
-		logger.Info("Loaded configuration from file", zap.String("path", configPath))
+	// SSHAuthorizedKeys
+	if cmd.Flags().Changed("ssh-authorized-keys") {
+		cfg.SSHAuthorizedKeys = serverSSHKeys
+	} else if os.Getenv("DRIP_SSH_AUTHORIZED_KEYS") != "" {
+		cfg.SSHAuthorizedKeys = serverSSHKeys
 	}
 
-	logger.Info("Starting Drip Server",
-		zap.String("version", Version),
-		zap.String("commit", GitCommit),
-	)
+	// BanThreshold
+	if cmd.Flags().Changed("ban-threshold") {
+		cfg.BanThreshold = serverBanThreshold
+	} else if os.Getenv("DRIP_BAN_THRESHOLD") != "" {
+		cfg.BanThreshold = serverBanThreshold
+	}
 
-	if cfg.PprofPort > 0 {
-		go func() {
-			pprofAddr := fmt.Sprintf("localhost:%d", cfg.PprofPort)
-			logger.Info("Starting pprof server", zap.String("address", pprofAddr))
-			if err := http.ListenAndServe(pprofAddr, nil); err != nil {
-				logger.Error("pprof server failed", zap.Error(err))
-			}
-		}()
+	// BanDuration
+	if cmd.Flags().Changed("ban-duration") {
+		cfg.BanDuration = serverBanDuration
+	} else if os.Getenv("DRIP_BAN_DURATION") != "" {
+		cfg.BanDuration = serverBanDuration
+	} else if cfg.BanDuration == 0 {
+		cfg.BanDuration = serverBanDuration
 	}
 
-	// Set public port for display if not specified
-	if cfg.PublicPort == 0 {
-		cfg.PublicPort = cfg.Port
+	// MaxBanDuration
+	if cmd.Flags().Changed("ban-max-duration") {
+		cfg.MaxBanDuration = serverBanMax
+	} else if os.Getenv("DRIP_BAN_MAX_DURATION") != "" {
+		cfg.MaxBanDuration = serverBanMax
+	} else if cfg.MaxBanDuration == 0 {
+		cfg.MaxBanDuration = serverBanMax
 	}
 
-	// Use tunnel domain if not set, fall back to domain
-	if cfg.TunnelDomain == "" {
-		cfg.TunnelDomain = cfg.Domain
+	// AuditLog
+	if cmd.Flags().Changed("audit-log") {
+		cfg.AuditLog = serverAuditLog
+	} else if os.Getenv("DRIP_AUDIT_LOG") != "" {
+		cfg.AuditLog = serverAuditLog
 	}
 
-	if err := cfg.Validate(); err != nil {
-		logger.Fatal("Invalid server configuration", zap.Error(err))
+	// AuditChain
+	if cmd.Flags().Changed("audit-chain") {
+		cfg.AuditChain = serverAuditChain
+	} else if os.Getenv("DRIP_AUDIT_CHAIN") != "" {
+		cfg.AuditChain = serverAuditChain
 	}
 
-	tlsConfig, err := cfg.LoadTLSConfig()
-	if err != nil {
-		logger.Fatal("Failed to load TLS configuration", zap.Error(err))
+	// GeoIPDB
+	if cmd.Flags().Changed("geoip-db") {
+		cfg.GeoIPDB = serverGeoIPDB
+	} else if os.Getenv("DRIP_GEOIP_DB") != "" {
+		cfg.GeoIPDB = serverGeoIPDB
 	}
 
-	if cfg.TLSEnabled {
-		logger.Info("TLS 1.3 configuration loaded",
-			zap.String("cert", cfg.TLSCertFile),
-			zap.String("key", cfg.TLSKeyFile),
-		)
-	} else {
-		logger.Info("TLS disabled - running in plain TCP mode (for reverse proxy)")
+	// MaxConnections
+	if cmd.Flags().Changed("max-connections") {
+		cfg.MaxConnections = serverMaxConns
+	} else if os.Getenv("DRIP_MAX_CONNECTIONS") != "" {
+		cfg.MaxConnections = serverMaxConns
 	}
 
-	tunnelManager := tunnel.NewManager(logger)
+	// AcceptRate
+	if cmd.Flags().Changed("accept-rate") {
+		cfg.AcceptRate = serverAcceptRate
+	} else if os.Getenv("DRIP_ACCEPT_RATE") != "" {
+		cfg.AcceptRate = serverAcceptRate
+	}
 
-	portAllocator, err := tcp.NewPortAllocator(cfg.TCPPortMin, cfg.TCPPortMax)
-	if err != nil {
-		logger.Fatal("Invalid TCP port range", zap.Error(err))
+	// AcceptBurst
+	if cmd.Flags().Changed("accept-burst") {
+		cfg.AcceptBurst = serverAcceptBurst
+	} else if os.Getenv("DRIP_ACCEPT_BURST") != "" {
+		cfg.AcceptBurst = serverAcceptBurst
 	}
 
-	listenAddr := fmt.Sprintf("0.0.0.0:%d", cfg.Port)
+	// MaxConnectionsPerIP
+	if cmd.Flags().Changed("max-connections-per-ip") {
+		cfg.MaxConnectionsPerIP = serverMaxPerIP
+	}
 
-	httpHandler := proxy.NewHandler(proxy.HandlerConfig{
-		Manager:      tunnelManager,
-		Logger:       logger,
-		ServerDomain: cfg.Domain,
-		TunnelDomain: cfg.TunnelDomain,
-		AuthToken:    cfg.AuthToken,
-		MetricsToken: cfg.MetricsToken,
-	})
-	httpHandler.SetAllowedTransports(cfg.AllowedTransports)
-	httpHandler.SetAllowedTunnelTypes(cfg.AllowedTunnelTypes)
+	// HeaderTimeout
+	if cmd.Flags().Changed("header-timeout") || cfg.HeaderTimeout == 0 {
+		cfg.HeaderTimeout = serverHeaderTO
+	}
 
-	listener := tcp.NewListener(tcp.ListenerConfig{
-		Address:      listenAddr,
-		TLSConfig:    tlsConfig,
-		AuthToken:    cfg.AuthToken,
-		Manager:      tunnelManager,
-		Logger:       logger,
-		PortAlloc:    portAllocator,
-		Domain:       cfg.Domain,
-		TunnelDomain: cfg.TunnelDomain,
-		PublicPort:   cfg.PublicPort,
-		HTTPHandler:  httpHandler,
-	})
-	listener.SetAllowedTransports(cfg.AllowedTransports)
-	listener.SetAllowedTunnelTypes(cfg.AllowedTunnelTypes)
+	// MinTransferRate
+	if cmd.Flags().Changed("min-transfer-rate") {
+		cfg.MinTransferRate = serverMinRate
+	}
 
-	bandwidth, err := parseBandwidth(cfg.Bandwidth)
-	if err != nil {
-		logger.Fatal("Invalid bandwidth configuration", zap.Error(err))
+	// MaxTunnelsPerToken
+	if cmd.Flags().Changed("max-tunnels-per-token") {
+		cfg.MaxTunnelsPerToken = serverTokenTunnels
+	} else if os.Getenv("DRIP_MAX_TUNNELS_PER_TOKEN") != "" {
+		cfg.MaxTunnelsPerToken = serverTokenTunnels
 	}
-	burstMultiplier := cfg.BurstMultiplier
-	if burstMultiplier <= 0 {
-		burstMultiplier = 2.0
+
+	// TokenPortShare
+	if cmd.Flags().Changed("token-port-share") {
+		cfg.TokenPortShare = serverTokenPorts
+	} else if os.Getenv("DRIP_TOKEN_PORT_SHARE") != "" {
+		cfg.TokenPortShare = serverTokenPorts
 	}
-	listener.SetBandwidth(bandwidth)
-	listener.SetBurstMultiplier(burstMultiplier)
-	if bandwidth > 0 {
-		logger.Info("Bandwidth limit configured",
-			zap.String("bandwidth", cfg.Bandwidth),
-			zap.Int64("bandwidth_bytes_sec", bandwidth),
-			zap.Float64("burst_multiplier", burstMultiplier),
-		)
+
+	// TokenBandwidth
+	if cmd.Flags().Changed("token-bandwidth") {
+		cfg.TokenBandwidth = serverTokenBW
+	} else if os.Getenv("DRIP_TOKEN_BANDWIDTH") != "" {
+		cfg.TokenBandwidth = serverTokenBW
 	}
 
-	if err := listener.Start(); err != nil {
-		logger.Fatal("Failed to start TCP listener", zap.Error(err))
+	// TLSAllowTLS12
+	if cmd.Flags().Changed("tls-allow-tls12") {
+		cfg.TLSAllowTLS12 = serverTLS12
+	} else if os.Getenv("DRIP_TLS_ALLOW_TLS12") != "" {
+		cfg.TLSAllowTLS12 = serverTLS12
 	}
 
-	protocol := "TCP (plain)"
-	if cfg.TLSEnabled {
-		protocol = "TCP over TLS 1.3"
+	// TLSCurves
+	if cmd.Flags().Changed("tls-curves") {
+		cfg.TLSCurves = parseCommaSeparated(serverTLSCurves)
+	} else if os.Getenv("DRIP_TLS_CURVES") != "" {
+		cfg.TLSCurves = parseCommaSeparated(serverTLSCurves)
 	}
 
-	logger.Info("Drip Server started",
-		zap.String("address", listenAddr),
-		zap.String("domain", cfg.Domain),
-		zap.String("tunnel_domain", cfg.TunnelDomain),
-		zap.String("protocol", protocol),
-		zap.Strings("transports", cfg.AllowedTransports),
-		zap.Strings("tunnel_types", cfg.AllowedTunnelTypes),
-	)
+	// TLSALPN
+	if cmd.Flags().Changed("tls-alpn") {
+		cfg.TLSALPN = parseCommaSeparated(serverTLSALPN)
+	} else if os.Getenv("DRIP_TLS_ALPN") != "" {
+		cfg.TLSALPN = parseCommaSeparated(serverTLSALPN)
+	}
 
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	// TLSTicketRotation
+	if cmd.Flags().Changed("tls-ticket-rotation") {
+		cfg.TLSTicketRotation = serverTLSTicketRot
+	} else if os.Getenv("DRIP_TLS_TICKET_ROTATION") != "" {
+		cfg.TLSTicketRotation = serverTLSTicketRot
+	}
 
-	<-quit
+	// TLSDisableTickets
+	if cmd.Flags().Changed("tls-disable-tickets") {
+		cfg.TLSDisableTickets = serverTLSNoTickets
+	} else if os.Getenv("DRIP_TLS_DISABLE_TICKETS") != "" {
+		cfg.TLSDisableTickets = serverTLSNoTickets
+	}
 
-	logger.Info("Shutting down server...")
+	// HTTP3
+	if cmd.Flags().Changed("http3") {
+		cfg.HTTP3 = serverHTTP3
+	} else if os.Getenv("DRIP_HTTP3") != "" {
+		cfg.HTTP3 = serverHTTP3
+	}
 
-	if err := listener.Stop(); err != nil {
-		logger.Error("Error stopping listener", zap.Error(err))
+	// TLSEnabled
+	if os.Getenv("DRIP_TLS_ENABLED") != "" {
+		cfg.TLSEnabled = os.Getenv("DRIP_TLS_ENABLED") == "true" || os.Getenv("DRIP_TLS_ENABLED") == "1"
+	} else if cfg.TLSCertFile != "" && cfg.TLSKeyFile != "" {
+		if !cfg.TLSEnabled {
+			cfg.TLSEnabled = true
+		}
 	}
 
-	logger.Info("Server stopped")
-	return nil
+	if cfg.TLSEnabled {
+		if cfg.TLSCertFile == "" {
+			return nil, "", fmt.Errorf("TLS certificate path is required when TLS is enabled (use --tls-cert flag, DRIP_TLS_CERT environment variable, or config file)")
+		}
+		if cfg.TLSKeyFile == "" {
+			return nil, "", fmt.Errorf("TLS private key path is required when TLS is enabled (use --tls-key flag, DRIP_TLS_KEY environment variable, or config file)")
+		}
+	}
+
+	// Set public port for display if not specified
+	if cfg.PublicPort == 0 {
+		cfg.PublicPort = cfg.Port
+	}
+
+	// Use tunnel domain if not set, fall back to domain
+	if cfg.TunnelDomain == "" {
+		cfg.TunnelDomain = cfg.Domain
+	}
+
+	return cfg, configPath, nil
+}
+
+// newPortAllocator builds the TCP port allocator from the default range,
+// the named ranges with their tokens, and the exclusion list.
+func newPortAllocator(cfg *config.ServerConfig) (*ports.Allocator, error) {
+	alloc, err := ports.NewAllocator(cfg.TCPPortMin, cfg.TCPPortMax)
+	if err != nil {
+		return nil, err
+	}
+	if err := configurePorts(alloc, &config.ServerConfig{}, cfg); err != nil {
+		return nil, err
+	}
+	return alloc, nil
 }
 
 // getEnvInt returns the environment variable value as int, or defaultVal if not set
@@ -374,6 +1345,16 @@ func getEnvInt(key string, defaultVal int) int {
 	return defaultVal
 }
 
+// getEnvFloat returns the environment variable value as float64, or defaultVal if not set
+func getEnvFloat(key string, defaultVal float64) float64 {
+	if val := os.Getenv(key); val != "" {
+		if f, err := strconv.ParseFloat(val, 64); err == nil {
+			return f
+		}
+	}
+	return defaultVal
+}
+
 // getEnvString returns the environment variable value, or defaultVal if not set
 func getEnvString(key string, defaultVal string) string {
 	if val := os.Getenv(key); val != "" {
@@ -382,6 +1363,26 @@ func getEnvString(key string, defaultVal string) string {
 	return defaultVal
 }
 
+// getEnvBool returns the environment variable value as bool, or defaultVal if not set
+func getEnvBool(key string, defaultVal bool) bool {
+	if val := os.Getenv(key); val != "" {
+		if b, err := strconv.ParseBool(val); err == nil {
+			return b
+		}
+	}
+	return defaultVal
+}
+
+// getEnvDuration returns the environment variable value as time.Duration, or defaultVal if not set
+func getEnvDuration(key string, defaultVal time.Duration) time.Duration {
+	if val := os.Getenv(key); val != "" {
+		if d, err := time.ParseDuration(val); err == nil {
+			return d
+		}
+	}
+	return defaultVal
+}
+
 // parseCommaSeparated splits a comma-separated string into a slice
 func parseCommaSeparated(s string) []string {
 	if s == "" {
@@ -0,0 +1,47 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+
+	"drip/internal/server/audit"
+	"drip/internal/shared/ui"
+
+	"github.com/spf13/cobra"
+)
+
+var serverVerifyAuditCmd = &cobra.Command{
+	Use:   "verify-audit <file>",
+	Short: "Check the hash chain of an audit log",
+	Long: `Check that an audit log written with --audit-chain is intact.
+
+Every event carries a hash of its content and of the event before it, so
+an event that was edited, removed or inserted after the fact breaks the
+chain. Exits with an error naming the first broken event.
+
+Example:
+  drip server verify-audit /var/log/drip/audit.log`,
+	Args:          cobra.ExactArgs(1),
+	RunE:          runServerVerifyAudit,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+}
+
+func init() {
+	serverCmd.AddCommand(serverVerifyAuditCmd)
+}
+
+func runServerVerifyAudit(_ *cobra.Command, args []string) error {
+	f, err := os.Open(args[0])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	n, err := audit.Verify(f)
+	if err != nil {
+		return fmt.Errorf("%s: %w", args[0], err)
+	}
+	fmt.Println(ui.Success(fmt.Sprintf("%s: %d events, chain intact", args[0], n)))
+	return nil
+}
@@ -0,0 +1,217 @@
+package cli
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+
+	"drip/internal/server/abuse"
+	"drip/internal/server/ports"
+	"drip/internal/server/proxy"
+	"drip/internal/server/tcp"
+	"drip/internal/server/tunnel"
+	"drip/internal/shared/netutil"
+	"drip/internal/shared/utils"
+	"drip/pkg/config"
+)
+
+// serverReloader re-reads the server configuration on SIGHUP or through
+// the admin API and applies what can change without dropping tunnels.
+type serverReloader struct {
+	mu  sync.Mutex
+	cmd *cobra.Command
+	// cfg is the configuration the server is running with.
+	cfg    *config.ServerConfig
+	logger *zap.Logger
+
+	listener      *tcp.Listener
+	handler       *proxy.Handler
+	manager       *tunnel.Manager
+	portAlloc     *ports.Allocator
+	banList       *abuse.BanList
+	acceptLimiter *abuse.AcceptLimiter
+}
+
+// Reload reads the configuration again, flags and environment variables
+// included, and applies the fields that changed. An invalid file changes
+// nothing.
+func (r *serverReloader) Reload() (*config.ReloadResult, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	next, configPath, err := loadServerConfig(r.cmd)
+	if err != nil {
+		return nil, err
+	}
+	if configPath == "" {
+		return nil, fmt.Errorf("the server was started without a config file")
+	}
+	if err := next.Validate(); err != nil {
+		return nil, err
+	}
+	if err := checkPortChange(r.cfg, next); err != nil {
+		return nil, err
+	}
+
+	old := *r.cfg
+	result := r.cfg.Reload(next)
+	cfg := r.cfg
+	changed := func(keys ...string) bool {
+		for _, key := range keys {
+			if slices.Contains(result.Applied, key) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if changed("token", "metrics_token") {
+		r.listener.SetAuthToken(cfg.AuthToken)
+		r.handler.SetTokens(cfg.AuthToken, cfg.MetricsToken)
+	}
+	if changed("debug", "log_level", "log_levels") {
+		if err := utils.ReplaceLogLevels(serverLogLevel(cfg), cfg.LogLevels); err != nil {
+			r.logger.Error("Failed to apply log levels", zap.Error(err))
+		}
+	}
+	if changed("tcp_port_min", "tcp_port_max", "tcp_port_ranges", "tcp_port_exclude", "token_port_share") {
+		if err := configurePorts(r.portAlloc, &old, cfg); err != nil {
+			r.logger.Error("Failed to apply TCP port ranges", zap.Error(err))
+		}
+	}
+	if changed("max_connections", "max_connections_per_ip", "accept_rate", "accept_burst") {
+		r.acceptLimiter.Update(abuse.AcceptConfig{
+			MaxConnections:      cfg.MaxConnections,
+			MaxConnectionsPerIP: cfg.MaxConnectionsPerIP,
+			Rate:                cfg.AcceptRate,
+			Burst:               cfg.AcceptBurst,
+		})
+	}
+	if changed("max_tunnels_per_token") {
+		r.manager.SetMaxTunnelsPerToken(cfg.MaxTunnelsPerToken)
+	}
+	if changed("ban_threshold", "ban_duration", "max_ban_duration") {
+		r.banList.Reconfigure(abuse.Config{
+			Threshold:      cfg.BanThreshold,
+			BanDuration:    cfg.BanDuration,
+			MaxBanDuration: cfg.MaxBanDuration,
+		})
+	}
+	if changed("banned_ips") {
+		r.banList.SetBlocked(bannedIPs(cfg))
+	}
+	if changed("max_request_body") {
+		if size, err := parseBandwidth(cfg.MaxRequestBody); err != nil {
+			r.logger.Error("Failed to apply max request body", zap.Error(err))
+		} else {
+			r.handler.SetMaxRequestBody(size)
+		}
+	}
+
+	r.logger.Info("Configuration reloaded",
+		zap.String("path", configPath),
+		zap.Strings("applied", result.Applied),
+	)
+	if len(result.RestartRequired) > 0 {
+		r.logger.Warn("Some configuration changes need a restart",
+			zap.Strings("restart_required", result.RestartRequired),
+		)
+	}
+	return &result, nil
+}
+
+// checkPortChange tries the move from the current port settings to the
+// next on a scratch allocator, so a reload that cannot apply them changes
+// nothing.
+func checkPortChange(cur, next *config.ServerConfig) error {
+	alloc, err := newPortAllocator(cur)
+	if err != nil {
+		return err
+	}
+	return configurePorts(alloc, cur, next)
+}
+
+// serverLogLevel returns the global log level cfg asks for.
+func serverLogLevel(cfg *config.ServerConfig) string {
+	switch {
+	case cfg.LogLevel != "":
+		return cfg.LogLevel
+	case cfg.Debug:
+		return "debug"
+	default:
+		return "info"
+	}
+}
+
+// bannedIPs returns the checker for the permanently banned IPs of cfg, or
+// nil if there are none.
+func bannedIPs(cfg *config.ServerConfig) *netutil.IPAccessChecker {
+	if len(cfg.BannedIPs) == 0 {
+		return nil
+	}
+	return netutil.NewIPAccessChecker(nil, cfg.BannedIPs)
+}
+
+// configurePorts moves alloc from the port settings of old to those of
+// cfg. Ranges that were dropped or moved are removed before the rest are
+// set, so ranges can trade places. Allocated ports stay reserved until
+// their tunnels release them.
+func configurePorts(alloc *ports.Allocator, old, cfg *config.ServerConfig) error {
+	keep := make(map[string]bool)
+	for _, r := range cfg.TCPPortRanges {
+		for _, o := range old.TCPPortRanges {
+			if o.Name == r.Name && o.Min == r.Min && o.Max == r.Max {
+				keep[r.Name] = true
+			}
+		}
+	}
+	assigned := make(map[string]bool)
+	for _, r := range cfg.TCPPortRanges {
+		for _, token := range r.Tokens {
+			assigned[token] = true
+		}
+	}
+	for _, o := range old.TCPPortRanges {
+		if !keep[o.Name] {
+			// The range may already be gone through the admin API.
+			_ = alloc.RemoveRange(o.Name)
+			continue
+		}
+		for _, token := range o.Tokens {
+			// Leave tokens reassigned through the admin API alone.
+			if !assigned[token] && alloc.RangeFor(token) == o.Name {
+				alloc.UnassignToken(token)
+			}
+		}
+	}
+
+	if err := alloc.SetRange(ports.Range{Name: ports.DefaultRange, Min: cfg.TCPPortMin, Max: cfg.TCPPortMax}); err != nil {
+		return err
+	}
+	for _, r := range cfg.TCPPortRanges {
+		if err := alloc.SetRange(ports.Range{Name: r.Name, Min: r.Min, Max: r.Max}); err != nil {
+			return err
+		}
+		for _, token := range r.Tokens {
+			if err := alloc.AssignToken(token, r.Name); err != nil {
+				return err
+			}
+		}
+	}
+
+	included, err := ports.ParseList(strings.Join(old.TCPPortExclude, ","))
+	if err != nil {
+		return err
+	}
+	excluded, err := ports.ParseList(strings.Join(cfg.TCPPortExclude, ","))
+	if err != nil {
+		return err
+	}
+	alloc.Include(included...)
+	alloc.Exclude(excluded...)
+	return alloc.SetTokenShare(cfg.TokenPortShare)
+}
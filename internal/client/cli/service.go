@@ -0,0 +1,203 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"syscall"
+
+	"drip/internal/client/service"
+	"drip/pkg/config"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	serviceName       string
+	serviceConfigPath string
+)
+
+var serviceCmd = &cobra.Command{
+	Use:   "service",
+	Short: "Run tunnels as a system service",
+	Long: `Install drip as a service that runs 'drip start' with a configuration
+file at boot and restarts it if it exits.
+
+  Linux    systemd unit (system-wide as root, otherwise a user unit)
+  macOS    launchd job (LaunchDaemon as root, otherwise a LaunchAgent)
+  Windows  Windows service (needs an elevated prompt)
+
+Examples:
+  drip service install                     Run every tunnel in ~/.drip/config.yaml
+  drip service install web api             Run only the "web" and "api" tunnels
+  drip service install --config /etc/drip/client.yaml --name drip-prod
+  drip service start
+  drip service stop
+  drip service uninstall`,
+}
+
+var serviceInstallCmd = &cobra.Command{
+	Use:           "install [tunnel-names...]",
+	Short:         "Install the service",
+	RunE:          runServiceInstall,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+}
+
+var serviceUninstallCmd = &cobra.Command{
+	Use:           "uninstall",
+	Short:         "Stop and remove the service",
+	Args:          cobra.NoArgs,
+	RunE:          serviceAction("uninstalled", service.Manager.Uninstall),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+}
+
+var serviceStartCmd = &cobra.Command{
+	Use:           "start",
+	Short:         "Start the service",
+	Args:          cobra.NoArgs,
+	RunE:          serviceAction("started", service.Manager.Start),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+}
+
+var serviceStopCmd = &cobra.Command{
+	Use:           "stop",
+	Short:         "Stop the service",
+	Args:          cobra.NoArgs,
+	RunE:          serviceAction("stopped", service.Manager.Stop),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+}
+
+func init() {
+	serviceCmd.PersistentFlags().StringVar(&serviceName, "name", service.DefaultName, "Service name")
+	serviceInstallCmd.Flags().StringVarP(&serviceConfigPath, "config", "c", "", "Configuration file the service runs (default: ~/.drip/config.yaml)")
+
+	serviceCmd.AddCommand(serviceInstallCmd, serviceUninstallCmd, serviceStartCmd, serviceStopCmd)
+	rootCmd.AddCommand(serviceCmd)
+}
+
+func runServiceInstall(_ *cobra.Command, args []string) error {
+	path := serviceConfigPath
+	if path == "" {
+		path = config.DefaultClientConfigPath()
+	}
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+
+	cfg, err := loadClientConfig(path)
+	if err != nil {
+		return err
+	}
+	if len(cfg.Tunnels) == 0 {
+		return fmt.Errorf("no tunnels configured in %s", path)
+	}
+	for _, name := range args {
+		if cfg.GetTunnel(name) == nil {
+			return fmt.Errorf("tunnel '%s' not found. Available tunnels: %s", name, strings.Join(cfg.GetTunnelNames(), ", "))
+		}
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to locate the drip binary: %w", err)
+	}
+	if resolved, err := filepath.EvalSymlinks(exe); err == nil {
+		exe = resolved
+	}
+
+	startArgs := []string{"start", "--config", path}
+	if profileName != "" {
+		startArgs = append(startArgs, "--profile", profileName)
+	}
+	if len(args) == 0 {
+		startArgs = append(startArgs, "--all")
+	} else {
+		startArgs = append(startArgs, args...)
+	}
+
+	m, err := service.New(serviceName)
+	if err != nil {
+		return err
+	}
+	err = m.Install(service.Config{
+		Name:        serviceName,
+		Description: "Drip tunnels (" + serviceName + ")",
+		Executable:  exe,
+		Args:        startArgs,
+		LogPath:     filepath.Join(getDaemonDir(), serviceName+".log"),
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Service %q installed at %s\n", serviceName, m.Path())
+	fmt.Printf("Start it with: drip service start --name %s\n", serviceName)
+	if runtime.GOOS == "linux" && !m.System() {
+		fmt.Println("User services stop at logout; run 'loginctl enable-linger' to keep them running.")
+	}
+	if cfg.TokenStore == config.TokenStoreKeychain {
+		fmt.Println("The token is in the system credential store, which services may not be able to reach;")
+		fmt.Println("if the service cannot connect, store it with 'drip auth login --file'.")
+	}
+	return nil
+}
+
+func serviceAction(done string, action func(service.Manager) error) func(*cobra.Command, []string) error {
+	return func(_ *cobra.Command, _ []string) error {
+		m, err := service.New(serviceName)
+		if err != nil {
+			return err
+		}
+		if err := action(m); err != nil {
+			return err
+		}
+		fmt.Printf("Service %q %s\n", serviceName, done)
+		return nil
+	}
+}
+
+// Windows has no SIGTERM for services, so a stop request from the service
+// manager is delivered to the same channels as the shutdown signals.
+var (
+	quitMu        sync.Mutex
+	quitChans     []chan<- os.Signal
+	quitRequested bool
+)
+
+// notifyQuit relays SIGINT, SIGTERM and service stop requests to ch.
+func notifyQuit(ch chan<- os.Signal) {
+	signal.Notify(ch, syscall.SIGINT, syscall.SIGTERM)
+
+	quitMu.Lock()
+	defer quitMu.Unlock()
+	quitChans = append(quitChans, ch)
+	if quitRequested {
+		sendQuit(ch)
+	}
+}
+
+// requestQuit asks every notifyQuit channel to shut down.
+func requestQuit() {
+	quitMu.Lock()
+	defer quitMu.Unlock()
+	quitRequested = true
+	for _, ch := range quitChans {
+		sendQuit(ch)
+	}
+}
+
+func sendQuit(ch chan<- os.Signal) {
+	select {
+	case ch <- syscall.SIGTERM:
+	default:
+	}
+}
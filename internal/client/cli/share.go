@@ -0,0 +1,111 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+
+	"drip/internal/share"
+	"drip/internal/shared/netutil"
+	"drip/internal/shared/ui"
+	"drip/internal/shared/utils"
+)
+
+var (
+	shareBind string
+	sharePort int
+)
+
+var shareCmd = &cobra.Command{
+	Use:   "share <port|host:port>",
+	Short: "Share a local HTTP service with your local network",
+	Long: `Share a local HTTP service with machines on the same network, without
+a drip server. A server and a client run in this process and visitors
+connect to this machine's LAN address over plain HTTP.
+
+Useful when internet access is restricted but colleagues are on the same
+network. Anyone who can reach the address can use the service.
+
+Example:
+  drip share 3000                      # http://<lan-ip>:<free port>
+  drip share 3000 --port 8080          # Pick the port visitors connect to
+  drip share 3000 --bind 0.0.0.0       # Listen on every interface`,
+	Args:          cobra.ExactArgs(1),
+	RunE:          runShare,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+}
+
+func init() {
+	shareCmd.Flags().StringVar(&shareBind, "bind", "", "Address visitors connect to (default: this machine's LAN IP)")
+	shareCmd.Flags().IntVar(&sharePort, "port", 0, "Port visitors connect to (0 = any free port)")
+	shareCmd.Flags().StringVarP(&localAddress, "address", "a", "127.0.0.1", "Local address to forward to (default: 127.0.0.1)")
+	rootCmd.AddCommand(shareCmd)
+}
+
+func runShare(_ *cobra.Command, args []string) error {
+	host, port, err := parseLocalTarget(args[0], localAddress)
+	if err != nil {
+		return err
+	}
+	if sharePort < 0 || sharePort > 65535 {
+		return fmt.Errorf("invalid --port %d", sharePort)
+	}
+
+	bind := trimBrackets(shareBind)
+	if bind == "" {
+		ip, err := netutil.LANIP()
+		if err != nil {
+			return fmt.Errorf("failed to find a LAN address, use --bind: %w", err)
+		}
+		bind = ip.String()
+	}
+
+	var logger *zap.Logger
+	if verbose {
+		if err := utils.InitLogger(true); err != nil {
+			return fmt.Errorf("failed to initialize logger: %w", err)
+		}
+		logger = utils.GetLogger()
+	}
+
+	s, err := share.Start(share.Config{
+		LocalHost: host,
+		LocalPort: port,
+		Listen:    net.JoinHostPort(bind, strconv.Itoa(sharePort)),
+		Logger:    logger,
+	})
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	url := s.URL()
+	if ip := net.ParseIP(bind); ip != nil && ip.IsUnspecified() {
+		// Visitors cannot use the unspecified address, show the LAN one.
+		if lan, err := netutil.LANIP(); err == nil {
+			url = "http://" + net.JoinHostPort(lan.String(), strconv.Itoa(s.Addr().(*net.TCPAddr).Port))
+		}
+	}
+
+	fmt.Println(ui.Info(
+		"Sharing on your network",
+		"",
+		ui.KeyValue("URL", url),
+		ui.KeyValue("Forwarding", displayLocalAddr(host, port)),
+		"",
+		ui.Muted("Ctrl+C to stop"),
+	))
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	<-ctx.Done()
+	return nil
+}
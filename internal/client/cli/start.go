@@ -2,23 +2,30 @@ package cli
 
 import (
 	"fmt"
+	"net"
 	"os"
-	"os/signal"
+	"strconv"
 	"strings"
 	"sync"
-	"syscall"
 
+	"drip/internal/client/middleware"
+	"drip/internal/client/notify"
 	"drip/internal/client/tcp"
+	"drip/internal/shared/httputil"
+	"drip/internal/shared/labels"
 	"drip/internal/shared/protocol"
+	"drip/internal/shared/schedule"
 	"drip/internal/shared/ui"
 	"drip/internal/shared/utils"
 	"drip/pkg/config"
 
 	"github.com/spf13/cobra"
+	"go.uber.org/zap"
 )
 
 var (
-	startAll bool
+	startAll        bool
+	startConfigPath string
 )
 
 var startCmd = &cobra.Command{
@@ -46,6 +53,14 @@ Configuration file example (~/.drip/config.yaml):
       port: 8080
       subdomain: api
       transport: wss
+      mocks:                          # Answered by drip, not the app
+        - path: /v2/orders/*
+          method: GET
+          status: 200
+          headers:
+            Content-Type: application/json
+          body_file: ./fixtures/order.json
+          delay: 300ms
 
     - name: db
       type: tcp
@@ -61,17 +76,22 @@ Configuration file example (~/.drip/config.yaml):
 
 func init() {
 	startCmd.Flags().BoolVar(&startAll, "all", false, "Start all configured tunnels")
+	startCmd.Flags().StringVarP(&startConfigPath, "config", "c", "", "Configuration file (default: ~/.drip/config.yaml)")
 	rootCmd.AddCommand(startCmd)
 }
 
 func runStart(_ *cobra.Command, args []string) error {
-	cfg, err := config.LoadClientConfig("")
+	cfg, err := loadClientConfig(startConfigPath)
 	if err != nil {
 		return err
 	}
 
 	if len(cfg.Tunnels) == 0 {
-		return fmt.Errorf("no tunnels configured in %s", config.DefaultClientConfigPath())
+		path := startConfigPath
+		if path == "" {
+			path = config.DefaultClientConfigPath()
+		}
+		return fmt.Errorf("no tunnels configured in %s", path)
 	}
 
 	var tunnelsToStart []*config.TunnelConfig
@@ -112,6 +132,10 @@ func runStart(_ *cobra.Command, args []string) error {
 		}
 	}
 
+	if cfg.Server, err = selectServer(cfg); err != nil {
+		return err
+	}
+
 	// Start tunnels
 	if len(tunnelsToStart) == 1 {
 		return startSingleTunnel(cfg, tunnelsToStart[0])
@@ -121,11 +145,8 @@ func runStart(_ *cobra.Command, args []string) error {
 }
 
 func formatTunnelInfo(t *config.TunnelConfig) string {
-	addr := t.Address
-	if addr == "" {
-		addr = "127.0.0.1"
-	}
-	info := fmt.Sprintf("%-12s %s  %s:%d", t.Name, t.Type, addr, t.Port)
+	addr := net.JoinHostPort(getAddress(t), strconv.Itoa(t.Port))
+	info := fmt.Sprintf("%-12s %s  %s", t.Name, t.Type, addr)
 	if t.Subdomain != "" {
 		info += fmt.Sprintf("  (subdomain: %s)", t.Subdomain)
 	}
@@ -138,9 +159,19 @@ func startSingleTunnel(cfg *config.ClientConfig, t *config.TunnelConfig) error {
 		return err
 	}
 
-	fmt.Printf("Starting tunnel '%s' (%s %s:%d)\n", t.Name, t.Type, getAddress(t), t.Port)
+	notifyTargets, err := notify.ParseTargets(t.Notify)
+	if err != nil {
+		return fmt.Errorf("invalid notify target for tunnel '%s': %w", t.Name, err)
+	}
 
-	return runTunnelWithUI(connConfig, nil)
+	alert, err := tunnelAlert(t)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Starting tunnel '%s' (%s %s)\n", t.Name, t.Type, displayLocalAddr(getAddress(t), t.Port))
+
+	return runTunnelWithUI(connConfig, nil, tunnelOptions{notifyTargets: notifyTargets, logName: t.Name, alert: alert})
 }
 
 func startMultipleTunnels(cfg *config.ClientConfig, tunnels []*config.TunnelConfig) error {
@@ -150,6 +181,7 @@ func startMultipleTunnels(cfg *config.ClientConfig, tunnels []*config.TunnelConf
 	defer utils.Sync()
 
 	logger := utils.GetLogger()
+	defer watchLogLevelSignal(logger)()
 
 	fmt.Println(ui.Title("Starting Tunnels"))
 	fmt.Println()
@@ -160,7 +192,7 @@ func startMultipleTunnels(cfg *config.ClientConfig, tunnels []*config.TunnelConf
 
 	// Handle interrupt signal
 	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	notifyQuit(sigChan)
 
 	go func() {
 		<-sigChan
@@ -178,22 +210,43 @@ func startMultipleTunnels(cfg *config.ClientConfig, tunnels []*config.TunnelConf
 				errChan <- err
 				return
 			}
-			fmt.Printf("  Starting %s (%s %s:%d)...\n", tunnel.Name, tunnel.Type, getAddress(tunnel), tunnel.Port)
+			notifyTargets, err := notify.ParseTargets(tunnel.Notify)
+			if err != nil {
+				errChan <- fmt.Errorf("%s: %w", tunnel.Name, err)
+				return
+			}
+			alert, err := tunnelAlert(tunnel)
+			if err != nil {
+				errChan <- err
+				return
+			}
+			fmt.Printf("  Starting %s (%s %s)...\n", tunnel.Name, tunnel.Type, displayLocalAddr(getAddress(tunnel), tunnel.Port))
+
+			logger, closeLog := openTunnelLog(logger, tunnel.Name)
+			defer closeLog()
 
 			client := tcp.NewTunnelClient(connConfig, logger)
 
 			// Connect
 			if err := client.Connect(); err != nil {
+				logger.Warn("Connection failed", zap.Error(err))
 				errChan <- fmt.Errorf("%s: %w", tunnel.Name, err)
 				return
 			}
 
 			fmt.Printf("  ✓ %s: %s\n", tunnel.Name, client.GetURL())
+			logger.Info("Tunnel connected", zap.String("url", client.GetURL()))
+
+			notifier := notify.New(notifyTargets, logger)
+			notifier.TunnelUp(client.GetURL(), displayLocalAddr(getAddress(tunnel), tunnel.Port))
+
+			go alert.watch(client, tunnel.Name, logger, stopChan)
 
 			// Run until stopped
 			select {
 			case <-stopChan:
 				client.Close()
+				notifier.TunnelDown(client.GetURL())
 			}
 		}(t)
 	}
@@ -230,6 +283,94 @@ func buildConnectorConfig(cfg *config.ClientConfig, t *config.TunnelConfig) (*tc
 	if err != nil {
 		return nil, fmt.Errorf("invalid bandwidth for tunnel '%s': %w", t.Name, err)
 	}
+	rate, err := parseBandwidth(t.Rate)
+	if err != nil {
+		return nil, fmt.Errorf("invalid rate for tunnel '%s': %w", t.Name, err)
+	}
+
+	rules, err := httputil.ParseRequestRules(t.Rules)
+	if err != nil {
+		return nil, fmt.Errorf("invalid rules for tunnel '%s': %w", t.Name, err)
+	}
+
+	maxBody, err := parseBandwidth(t.MaxBody)
+	if err != nil {
+		return nil, fmt.Errorf("invalid max_body for tunnel '%s': %w", t.Name, err)
+	}
+	maxRespBody, err := parseBandwidth(t.MaxRespBody)
+	if err != nil {
+		return nil, fmt.Errorf("invalid max_response_body for tunnel '%s': %w", t.Name, err)
+	}
+
+	if err := labels.Validate(t.Labels); err != nil {
+		return nil, fmt.Errorf("invalid labels for tunnel '%s': %w", t.Name, err)
+	}
+	if t.Schedule != "" {
+		if _, err := schedule.Parse(t.Schedule); err != nil {
+			return nil, fmt.Errorf("invalid schedule for tunnel '%s': %w", t.Name, err)
+		}
+	}
+
+	mocks, err := buildMocks(t)
+	if err != nil {
+		return nil, err
+	}
+
+	cookieRewrite, err := middleware.ParseCookieRewrite(t.CookieRewrite)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cookie_rewrite for tunnel '%s': %w", t.Name, err)
+	}
+	if err := middleware.ValidateCORSOrigins(t.CORS); err != nil {
+		return nil, fmt.Errorf("invalid cors for tunnel '%s': %w", t.Name, err)
+	}
+
+	var backends []string
+	for _, b := range t.Backends {
+		host, port, err := parseLocalTarget(b, getAddress(t))
+		if err != nil {
+			return nil, fmt.Errorf("invalid backend for tunnel '%s': %w", t.Name, err)
+		}
+		backends = append(backends, net.JoinHostPort(host, strconv.Itoa(port)))
+	}
+
+	var shadow string
+	if t.Shadow != "" {
+		host, port, err := parseLocalTarget(t.Shadow, getAddress(t))
+		if err != nil {
+			return nil, fmt.Errorf("invalid shadow for tunnel '%s': %w", t.Name, err)
+		}
+		shadow = net.JoinHostPort(host, strconv.Itoa(port))
+	}
+
+	maxQueue := t.MaxQueue
+	if maxQueue == 0 {
+		maxQueue = 100
+	}
+
+	localTLS := tcp.LocalTLS{
+		CAFile:     t.LocalCA,
+		Pin:        t.LocalPin,
+		Verify:     t.LocalVerify,
+		ServerName: t.LocalServerName,
+	}
+	if _, err := localTLS.Config(getAddress(t)); err != nil {
+		return nil, fmt.Errorf("invalid local TLS settings for tunnel '%s': %w", t.Name, err)
+	}
+
+	edgeTLS, err := newEdgeTLSPolicy(t.HSTS, t.TLS13Only, t.ClientCA)
+	if err != nil {
+		return nil, fmt.Errorf("invalid edge TLS settings for tunnel '%s': %w", t.Name, err)
+	}
+
+	fingerprint := serverFingerprint
+	if fingerprint == "" {
+		fingerprint = cfg.ServerFingerprint
+	}
+
+	proxyDialer, err := proxyFromConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
 
 	tunnelType := protocol.TunnelTypeHTTP
 	switch t.Type {
@@ -237,6 +378,8 @@ func buildConnectorConfig(cfg *config.ClientConfig, t *config.TunnelConfig) (*tc
 		tunnelType = protocol.TunnelTypeHTTPS
 	case "tcp":
 		tunnelType = protocol.TunnelTypeTCP
+	case "tls":
+		tunnelType = protocol.TunnelTypeTLS
 	}
 
 	transport := tcp.TransportAuto
@@ -261,12 +404,78 @@ func buildConnectorConfig(cfg *config.ClientConfig, t *config.TunnelConfig) (*tc
 		AuthBearer: t.AuthBearer,
 		Transport:  transport,
 		Bandwidth:  bw,
+		Rate:       rate,
+
+		Labels:            t.Labels,
+		AllowCountries:    t.AllowCountries,
+		DenyCountries:     t.DenyCountries,
+		ServerFingerprint: fingerprint,
+		FallbackAddrs:     serverFallbacks,
+		DrainTimeout:      drainTimeout,
+		PowerSave:         powerSave,
+		Chaos:             chaosConfig,
+		Proxy:             proxyDialer,
+		ProxyProtocol:     t.ProxyProtocol,
+		RequestRules:      rules,
+		VisitorRPS:        t.VisitorRPS,
+		VisitorBurst:      t.VisitorBurst,
+		EdgeTLS:           edgeTLS,
+		SigningSecret:     t.SignSecret,
+		RequestStore:      t.RequestStore,
+		MaxRequestBody:    maxBody,
+		MaxResponseBody:   maxRespBody,
+		E2EKey:            t.E2EKey,
+		P2P:               t.P2P,
+		Private:           t.Private,
+		CompressStreams:   t.CompressStreams,
+		CacheTTL:          t.CacheTTL,
+		ExecHooks:         t.Hooks,
+		Mocks:             mocks,
+		RewriteHost:       t.RewriteHost,
+		RewriteHTML:       t.RewriteHTML,
+		CookieRewrite:     cookieRewrite,
+		CORSOrigins:       t.CORS,
+		LocalTLS:          localTLS,
+		Backends:          backends,
+		Balance:           t.Balance,
+		HealthCheck:       t.HealthCheck,
+		Shadow:            shadow,
+		MaxInFlight:       t.MaxInFlight,
+		MaxQueue:          maxQueue,
+		Retry:             tcp.RetryPolicy{Retries: t.Retries, Backoff: t.RetryBackoff, Methods: t.RetryMethods},
+		TTL:               t.TTL,
+		Schedule:          t.Schedule,
 	}, nil
 }
 
+// buildMocks loads the tunnel's mocks, reading body files relative to the
+// working directory.
+func buildMocks(t *config.TunnelConfig) ([]middleware.Mock, error) {
+	mocks := make([]middleware.Mock, 0, len(t.Mocks))
+	for _, m := range t.Mocks {
+		body := []byte(m.Body)
+		if m.BodyFile != "" {
+			data, err := os.ReadFile(m.BodyFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read body_file for mock %s in tunnel '%s': %w", m.Path, t.Name, err)
+			}
+			body = data
+		}
+		mocks = append(mocks, middleware.Mock{
+			Method: m.Method,
+			Path:   m.Path,
+			Status: m.Status,
+			Header: m.Headers,
+			Body:   body,
+			Delay:  m.Delay,
+		})
+	}
+	return mocks, nil
+}
+
 func getAddress(t *config.TunnelConfig) string {
 	if t.Address != "" {
-		return t.Address
+		return trimBrackets(t.Address)
 	}
 	return "127.0.0.1"
 }
@@ -276,5 +485,21 @@ func validateTunnelBandwidth(t *config.TunnelConfig) error {
 	if err != nil {
 		return fmt.Errorf("invalid bandwidth for tunnel '%s': %w", t.Name, err)
 	}
+	if _, err := parseBandwidth(t.Rate); err != nil {
+		return fmt.Errorf("invalid rate for tunnel '%s': %w", t.Name, err)
+	}
+	if _, err := tunnelAlert(t); err != nil {
+		return err
+	}
 	return nil
 }
+
+// tunnelAlert builds the bandwidth alert of a configured tunnel, nil if it
+// has none.
+func tunnelAlert(t *config.TunnelConfig) (*bandwidthAlert, error) {
+	alert, err := newBandwidthAlert(t.AlertBandwidth, t.AlertPause)
+	if err != nil {
+		return nil, fmt.Errorf("invalid alert_bandwidth for tunnel '%s': %w", t.Name, err)
+	}
+	return alert, nil
+}
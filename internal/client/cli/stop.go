@@ -40,8 +40,8 @@ func runStop(_ *cobra.Command, args []string) error {
 	}
 
 	tunnelType := args[0]
-	if tunnelType != "http" && tunnelType != "https" && tunnelType != "tcp" {
-		return fmt.Errorf("invalid tunnel type: %s (must be 'http', 'https', or 'tcp')", tunnelType)
+	if tunnelType != "http" && tunnelType != "https" && tunnelType != "tcp" && tunnelType != "tls" {
+		return fmt.Errorf("invalid tunnel type: %s (must be 'http', 'https', 'tcp', or 'tls')", tunnelType)
 	}
 
 	port, err := strconv.Atoi(args[1])
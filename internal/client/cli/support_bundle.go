@@ -0,0 +1,335 @@
+package cli
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"drip/internal/client/logfile"
+	"drip/internal/shared/recovery"
+	"drip/internal/shared/ui"
+	"drip/pkg/config"
+
+	json "github.com/goccy/go-json"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// supportLogTail is how much of the end of each daemon log is bundled.
+const supportLogTail = 1 << 20
+
+const redactedValue = "REDACTED"
+
+var (
+	supportOutput       string
+	supportServerConfig string
+	supportCrashDir     string
+)
+
+var supportBundleCmd = &cobra.Command{
+	Use:   "support-bundle",
+	Short: "Collect logs, config and crash data for a bug report",
+	Long: `Write a zip archive with everything useful for a bug report:
+
+  - runtime.json   version, platform and Go runtime statistics
+  - config/        client and server config files, secrets redacted
+  - daemons/       background tunnel info and the tail of their logs
+  - crashes/       stacks of recovered panics
+
+Tokens, passwords and e2e keys are replaced with REDACTED in config files.
+Logs are included as-is, so review the archive before sharing it.
+
+Example:
+  drip support-bundle
+  drip support-bundle -o /tmp/drip-bundle.zip --server-config /etc/drip/config.yaml`,
+	Args:          cobra.NoArgs,
+	RunE:          runSupportBundle,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+}
+
+func init() {
+	supportBundleCmd.Flags().StringVarP(&supportOutput, "output", "o", "", "Output file (default: drip-support-<timestamp>.zip)")
+	supportBundleCmd.Flags().StringVar(&supportServerConfig, "server-config", "", "Server config file to include (default: /etc/drip/config.yaml or ~/.drip/server.yaml)")
+	supportBundleCmd.Flags().StringVar(&supportCrashDir, "crash-dir", getEnvString("DRIP_CRASH_DIR", ""), "Directory with panic dumps (default: ~/.drip/crashes) (env: DRIP_CRASH_DIR)")
+	rootCmd.AddCommand(supportBundleCmd)
+}
+
+func runSupportBundle(_ *cobra.Command, _ []string) error {
+	output := supportOutput
+	if output == "" {
+		output = fmt.Sprintf("drip-support-%s.zip", time.Now().Format("20060102-150405"))
+	}
+
+	f, err := os.OpenFile(output, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create bundle: %w", err)
+	}
+	defer f.Close()
+
+	b := &supportBundle{zw: zip.NewWriter(f)}
+
+	b.addRuntime()
+	b.addConfig("config/client.yaml", config.DefaultClientConfigPath())
+
+	serverConfig := supportServerConfig
+	if serverConfig == "" && config.ServerConfigExists("") {
+		serverConfig = config.DefaultServerConfigPath()
+	}
+	if serverConfig != "" {
+		b.addConfig("config/server.yaml", serverConfig)
+	}
+
+	b.addDaemons()
+	b.addLogs(logfile.Dir())
+
+	crashDir := supportCrashDir
+	if crashDir == "" {
+		crashDir = recovery.DefaultCrashDir()
+	}
+	b.addCrashes(crashDir)
+
+	if len(b.skipped) > 0 {
+		b.addFile("skipped.txt", []byte(strings.Join(b.skipped, "\n")+"\n"))
+	}
+
+	if err := b.zw.Close(); err != nil {
+		return fmt.Errorf("failed to write bundle: %w", err)
+	}
+
+	fmt.Println(ui.SuccessBox("Support bundle created",
+		ui.KeyValue("File", output),
+		ui.KeyValue("Entries", fmt.Sprintf("%d", b.entries)),
+		"",
+		ui.Muted("Logs are not redacted; review the archive before sharing it."),
+	))
+	return nil
+}
+
+// supportBundle accumulates zip entries. Failures to collect one item are
+// recorded in skipped.txt rather than aborting the whole bundle.
+type supportBundle struct {
+	zw      *zip.Writer
+	entries int
+	skipped []string
+}
+
+func (b *supportBundle) skip(name string, err error) {
+	b.skipped = append(b.skipped, fmt.Sprintf("%s: %v", name, err))
+}
+
+func (b *supportBundle) addFile(name string, data []byte) {
+	w, err := b.zw.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: time.Now(),
+	})
+	if err != nil {
+		b.skip(name, err)
+		return
+	}
+	if _, err := w.Write(data); err != nil {
+		b.skip(name, err)
+		return
+	}
+	b.entries++
+}
+
+func (b *supportBundle) addRuntime() {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	hostname, _ := os.Hostname()
+	data, err := json.MarshalIndent(map[string]interface{}{
+		"version":    Version,
+		"git_commit": GitCommit,
+		"build_time": BuildTime,
+		"go_version": runtime.Version(),
+		"os":         runtime.GOOS,
+		"arch":       runtime.GOARCH,
+		"num_cpu":    runtime.NumCPU(),
+		"gomaxprocs": runtime.GOMAXPROCS(0),
+		"goroutines": runtime.NumGoroutine(),
+		"hostname":   hostname,
+		"collected":  time.Now().Format(time.RFC3339),
+		"memory": map[string]interface{}{
+			"heap_alloc":  mem.HeapAlloc,
+			"heap_sys":    mem.HeapSys,
+			"heap_inuse":  mem.HeapInuse,
+			"stack_inuse": mem.StackInuse,
+			"sys":         mem.Sys,
+			"num_gc":      mem.NumGC,
+		},
+	}, "", "  ")
+	if err != nil {
+		b.skip("runtime.json", err)
+		return
+	}
+	b.addFile("runtime.json", data)
+}
+
+func (b *supportBundle) addConfig(name, path string) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			b.skip(name, err)
+		}
+		return
+	}
+	redacted, err := redactYAML(data)
+	if err != nil {
+		// Never fall back to the raw file: it may hold secrets.
+		b.skip(name, err)
+		return
+	}
+	b.addFile(name, redacted)
+}
+
+func (b *supportBundle) addDaemons() {
+	dir := getDaemonDir()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			b.skip("daemons", err)
+		}
+		return
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() {
+			continue
+		}
+		switch filepath.Ext(name) {
+		case ".json":
+			data, err := os.ReadFile(filepath.Join(dir, name))
+			if err != nil {
+				b.skip("daemons/"+name, err)
+				continue
+			}
+			b.addFile("daemons/"+name, data)
+		case ".log":
+			data, err := readTail(filepath.Join(dir, name), supportLogTail)
+			if err != nil {
+				b.skip("daemons/"+name, err)
+				continue
+			}
+			b.addFile("daemons/"+name, data)
+		}
+	}
+}
+
+func (b *supportBundle) addLogs(dir string) {
+	names, err := logfile.List(dir)
+	if err != nil {
+		b.skip("logs", err)
+		return
+	}
+	for _, name := range names {
+		data, err := readTail(logfile.Path(dir, name), supportLogTail)
+		if err != nil {
+			b.skip("logs/"+name+logfile.Ext, err)
+			continue
+		}
+		b.addFile("logs/"+name+logfile.Ext, data)
+	}
+}
+
+func (b *supportBundle) addCrashes(dir string) {
+	dumps, err := recovery.ListDumps(dir)
+	if err != nil {
+		b.skip("crashes", err)
+		return
+	}
+	for _, path := range dumps {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			b.skip("crashes/"+filepath.Base(path), err)
+			continue
+		}
+		b.addFile("crashes/"+filepath.Base(path), data)
+	}
+}
+
+// readTail returns at most the last n bytes of the file at path.
+func readTail(path string, n int64) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() > n {
+		if _, err := f.Seek(-n, io.SeekEnd); err != nil {
+			return nil, err
+		}
+	}
+	return io.ReadAll(f)
+}
+
+// redactYAML replaces the values of secret-bearing keys anywhere in a YAML
+// document, including inside tunnel lists.
+func redactYAML(data []byte) ([]byte, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	redactNode(&doc)
+	return yaml.Marshal(&doc)
+}
+
+func redactNode(n *yaml.Node) {
+	if n.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key, value := n.Content[i], n.Content[i+1]
+			if isSecretKey(key.Value) {
+				switch value.Kind {
+				case yaml.ScalarNode:
+					redactScalar(value)
+					continue
+				case yaml.SequenceNode:
+					for _, item := range value.Content {
+						redactScalar(item)
+					}
+					continue
+				}
+			}
+			redactNode(value)
+		}
+		return
+	}
+	for _, child := range n.Content {
+		redactNode(child)
+	}
+}
+
+func redactScalar(n *yaml.Node) {
+	if n.Kind != yaml.ScalarNode || n.Value == "" {
+		return
+	}
+	n.Value = redactedValue
+	n.Tag = "!!str"
+	n.Style = 0
+}
+
+// isSecretKey reports whether the value of key is a credential. Webhook
+// URLs count: Slack and Discord embed their secret in the URL.
+func isSecretKey(key string) bool {
+	key = strings.ToLower(key)
+	switch key {
+	case "auth", "auth_bearer", "e2e_key", "hook_url", "notify":
+		return true
+	}
+	return strings.Contains(key, "token") ||
+		strings.Contains(key, "secret") ||
+		strings.Contains(key, "password")
+}
@@ -0,0 +1,45 @@
+package cli
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRedactYAML(t *testing.T) {
+	input := `server: tunnel.example.com:443
+token: super-secret-token
+server_fingerprint: sha256/abc
+tunnels:
+  - name: web
+    type: http
+    port: 3000
+    auth: hunter2
+  - name: db
+    type: tcp
+    port: 5432
+    e2e_key: 0123456789abcdef
+    notify:
+      - slack:https://hooks.slack.com/services/T000/B000/slack-secret
+metrics_token: ""
+hook_url: https://hooks.example.com/drip?key=hook-secret
+`
+	out, err := redactYAML([]byte(input))
+	if err != nil {
+		t.Fatalf("redactYAML() error: %v", err)
+	}
+	got := string(out)
+
+	for _, secret := range []string{"super-secret-token", "hunter2", "0123456789abcdef", "hook-secret", "slack-secret"} {
+		if strings.Contains(got, secret) {
+			t.Errorf("redactYAML() output still contains %q:\n%s", secret, got)
+		}
+	}
+	for _, keep := range []string{"tunnel.example.com:443", "sha256/abc", "port: 5432"} {
+		if !strings.Contains(got, keep) {
+			t.Errorf("redactYAML() output lost %q:\n%s", keep, got)
+		}
+	}
+	if strings.Count(got, redactedValue) != 5 {
+		t.Errorf("redactYAML() redacted %d values, want 5:\n%s", strings.Count(got, redactedValue), got)
+	}
+}
@@ -4,14 +4,22 @@ import (
 	"fmt"
 	"strconv"
 
+	"drip/internal/client/notify"
 	"drip/internal/client/tcp"
+	"drip/internal/shared/e2e"
+	"drip/internal/shared/labels"
 	"drip/internal/shared/protocol"
+	"drip/internal/shared/schedule"
 
 	"github.com/spf13/cobra"
 )
 
+// proxyProto is shared by the tcp and tls commands; HTTP tunnels forward the
+// visitor address in X-Forwarded-For instead.
+var proxyProto bool
+
 var tcpCmd = &cobra.Command{
-	Use:   "tcp <port>",
+	Use:   "tcp <port|host:port>",
 	Short: "Start TCP tunnel",
 	Long: `Start a TCP tunnel to expose any TCP service.
 
@@ -19,12 +27,21 @@ Example:
   drip tcp 5432                     Tunnel PostgreSQL
   drip tcp 3306                     Tunnel MySQL
   drip tcp 22                       Tunnel SSH
+  drip tcp "[::1]:5432"             Tunnel a service listening on IPv6 localhost
   drip tcp 6379 --subdomain myredis Tunnel Redis with custom subdomain
   drip tcp 5432 --allow-ip 192.168.0.0/16  Only allow IPs from 192.168.x.x
   drip tcp 22 --allow-ip 10.0.0.1          Allow single IP
   drip tcp 22 --deny-ip 1.2.3.4            Block specific IP
+  drip tcp 22 --deny-country CN,RU         Block visitors from these countries
   drip tcp 22 --transport wss              Use WebSocket over TLS (CDN-friendly)
   drip tcp 22 --bandwidth 1M              Limit bandwidth to 1 MB/s
+  drip tcp 22 --rate 1MBps                Cap this machine's tunnel traffic at 1 MB/s
+  drip tcp 22 --alert-bandwidth 1GB       Warn after 1 GB of traffic
+  drip tcp 25 --proxy-protocol            Send PROXY protocol v2 headers to the local service
+  drip tcp 5432 --e2e-key $KEY            Only accept end-to-end encrypted 'drip connect' consumers
+  drip tcp 5432 --p2p                     Allow direct peer-to-peer connections from 'drip connect --p2p'
+  drip tcp 5432 -n mydb --private         No public port; teammates use 'drip connect mydb'
+  drip tcp 6379 --backend 6380,6381 --balance least-conn  Spread connections over three local instances
 
 Supported Services:
   - Databases: PostgreSQL (5432), MySQL (3306), Redis (6379), MongoDB (27017)
@@ -54,21 +71,61 @@ func init() {
 	tcpCmd.Flags().StringVarP(&localAddress, "address", "a", "127.0.0.1", "Local address to forward to (default: 127.0.0.1)")
 	tcpCmd.Flags().StringSliceVar(&allowIPs, "allow-ip", nil, "Allow only these IPs or CIDR ranges (e.g., 192.168.1.1,10.0.0.0/8)")
 	tcpCmd.Flags().StringSliceVar(&denyIPs, "deny-ip", nil, "Deny these IPs or CIDR ranges (e.g., 1.2.3.4,192.168.1.0/24)")
+	tcpCmd.Flags().StringSliceVar(&allowCountry, "allow-country", nil, "Allow only visitors from these countries (ISO codes, e.g., US,DE); needs a server with a GeoIP database")
+	tcpCmd.Flags().StringSliceVar(&denyCountry, "deny-country", nil, "Deny visitors from these countries (ISO codes, e.g., US,DE); needs a server with a GeoIP database")
 	tcpCmd.Flags().StringVar(&transport, "transport", "auto", "Transport protocol: auto, tcp, wss (WebSocket over TLS)")
 	tcpCmd.Flags().StringVar(&bandwidth, "bandwidth", "", "Bandwidth limit (e.g., 1M, 500K, 1G)")
+	tcpCmd.Flags().StringVar(&rateLimit, "rate", "", "Cap the tunnel's traffic in and out together on this machine, e.g. 1MBps (for shared uplinks)")
+	tcpCmd.Flags().StringVar(&alertBW, "alert-bandwidth", "", "Warn once the session's traffic in and out passes this size, e.g. 1GB (for metered connections)")
+	tcpCmd.Flags().BoolVar(&alertPause, "alert-pause", false, "Also pause the tunnel when --alert-bandwidth is reached")
+	tcpCmd.Flags().BoolVar(&proxyProto, "proxy-protocol", false, "Prepend a PROXY protocol v2 header with the visitor address to each connection")
+	tcpCmd.Flags().StringSliceVar(&backendAddrs, "backend", nil, "More local addresses (<port|host:port>) to spread connections over, e.g. 6380,6381")
+	tcpCmd.Flags().StringVar(&balance, "balance", tcp.BalanceRoundRobin, "How connections are spread over --backend addresses: round-robin, least-conn")
+	tcpCmd.Flags().IntVar(&retries, "retries", 0, "Retry a failed dial to the local service this many times, e.g. while it restarts")
+	tcpCmd.Flags().DurationVar(&retryBackoff, "retry-backoff", tcp.DefaultRetryBackoff, "Wait before the first retry, doubled after each")
+	tcpCmd.Flags().BoolVar(&p2pMode, "p2p", false, "Let 'drip connect --p2p' consumers try a direct connection before using the server relay")
+	tcpCmd.Flags().BoolVar(&private, "private", false, "Do not allocate a public port; only 'drip connect <name>' consumers with this tunnel's token can reach it")
+	tcpCmd.Flags().StringVar(&e2eKey, "e2e-key", getEnvString("DRIP_E2E_KEY", ""), "Encrypt traffic end to end with consumers using 'drip connect --e2e-key' (env: DRIP_E2E_KEY)")
+	tcpCmd.Flags().DurationVar(&tunnelTTL, "ttl", 0, "Close the tunnel automatically after this long, e.g. 2h (enforced by the server, 0 = never)")
+	tcpCmd.Flags().StringVar(&scheduleSpec, "schedule", "", "Only accept visitors in these windows, e.g. \"Mon-Fri 09:00-18:00 Europe/Berlin\" (enforced by the server)")
+	tcpCmd.Flags().StringVar(&exitAfter, "exit-after", "", "Exit after this long, e.g. 5m (for CI jobs)")
+	tcpCmd.Flags().StringVar(&urlFile, "url-file", "", "Write the public URL to this file as DRIP_URL=<url> once the tunnel is up")
+	tcpCmd.Flags().BoolVar(&waitReady, "wait-ready", false, "Only report the URL once it is verified reachable through the server")
+	tcpCmd.Flags().StringArrayVar(&labelArgs, "label", nil, "Label the tunnel with key=value, e.g. team=payments; repeatable, shown by drip list and the server's stats")
+	tcpCmd.Flags().BoolVar(&copyURL, "copy", false, "Copy the public address (host:port) to the clipboard once the tunnel is up")
+	tcpCmd.Flags().StringArrayVar(&notifyURLs, "notify", nil, "Post the public URL to a chat webhook when the tunnel is up, e.g. slack:https://hooks.slack.com/... or discord:https://discord.com/api/webhooks/...")
 	tcpCmd.Flags().BoolVar(&daemonMarker, "daemon-child", false, "Internal flag for daemon child process")
 	tcpCmd.Flags().MarkHidden("daemon-child")
 	rootCmd.AddCommand(tcpCmd)
 }
 
 func runTCP(_ *cobra.Command, args []string) error {
-	port, err := strconv.Atoi(args[0])
-	if err != nil || port < 1 || port > 65535 {
-		return fmt.Errorf("invalid port number: %s", args[0])
+	localHost, port, err := parseLocalTarget(args[0], localAddress)
+	if err != nil {
+		return err
+	}
+	backends, err := parseBackends(localHost)
+	if err != nil {
+		return err
+	}
+	retry, err := parseRetryPolicy()
+	if err != nil {
+		return err
+	}
+	if err := validateCountryFlags(); err != nil {
+		return err
+	}
+	alert, err := newBandwidthAlert(alertBW, alertPause)
+	if err != nil {
+		return err
+	}
+	tunnelLabels, err := labels.Parse(labelArgs)
+	if err != nil {
+		return err
 	}
 
 	if daemonMode && !daemonMarker {
-		return StartDaemon("tcp", port, buildDaemonArgs("tcp", args, subdomain, localAddress))
+		return StartDaemon("tcp", port, buildDaemonArgs("tcp", []string{strconv.Itoa(port)}, subdomain, localHost))
 	}
 
 	serverAddr, token, err := resolveServerAddrAndToken("tcp", port)
@@ -76,16 +133,66 @@ func runTCP(_ *cobra.Command, args []string) error {
 		return err
 	}
 
+	fingerprint, err := resolveServerFingerprint()
+	if err != nil {
+		return err
+	}
+	proxyDialer, err := resolveProxy()
+	if err != nil {
+		return err
+	}
+
 	bw, err := parseBandwidth(bandwidth)
 	if err != nil {
 		return err
 	}
+	rate, err := parseBandwidth(rateLimit)
+	if err != nil {
+		return fmt.Errorf("--rate: %w", err)
+	}
+
+	if e2eKey != "" {
+		if err := e2e.ValidateSecret(e2eKey); err != nil {
+			return err
+		}
+		if proxyProto {
+			return fmt.Errorf("--e2e-key cannot be combined with --proxy-protocol")
+		}
+	}
+
+	if private {
+		if p2pMode {
+			return fmt.Errorf("--private cannot be combined with --p2p")
+		}
+		if waitReady {
+			return fmt.Errorf("--private cannot be combined with --wait-ready")
+		}
+	}
+
+	if tunnelTTL < 0 {
+		return fmt.Errorf("--ttl must not be negative")
+	}
+	if scheduleSpec != "" {
+		if _, err := schedule.Parse(scheduleSpec); err != nil {
+			return fmt.Errorf("--schedule: %w", err)
+		}
+	}
+
+	exit, err := newExitCondition(untilRequest, exitAfter, false)
+	if err != nil {
+		return err
+	}
+
+	notifyTargets, err := notify.ParseTargets(notifyURLs)
+	if err != nil {
+		return err
+	}
 
 	connConfig := &tcp.ConnectorConfig{
 		ServerAddr: serverAddr,
 		Token:      token,
 		TunnelType: protocol.TunnelTypeTCP,
-		LocalHost:  localAddress,
+		LocalHost:  localHost,
 		LocalPort:  port,
 		Subdomain:  subdomain,
 		Insecure:   insecure,
@@ -93,6 +200,26 @@ func runTCP(_ *cobra.Command, args []string) error {
 		DenyIPs:    denyIPs,
 		Transport:  parseTransport(transport),
 		Bandwidth:  bw,
+		Rate:       rate,
+
+		Labels:            tunnelLabels,
+		AllowCountries:    allowCountry,
+		DenyCountries:     denyCountry,
+		ServerFingerprint: fingerprint,
+		FallbackAddrs:     serverFallbacks,
+		DrainTimeout:      drainTimeout,
+		PowerSave:         powerSave,
+		Chaos:             chaosConfig,
+		Proxy:             proxyDialer,
+		ProxyProtocol:     proxyProto,
+		E2EKey:            e2eKey,
+		P2P:               p2pMode,
+		Private:           private,
+		Backends:          backends,
+		Balance:           balance,
+		Retry:             retry,
+		TTL:               tunnelTTL,
+		Schedule:          scheduleSpec,
 	}
 
 	var daemon *DaemonInfo
@@ -100,5 +227,13 @@ func runTCP(_ *cobra.Command, args []string) error {
 		daemon = newDaemonInfo("tcp", port, subdomain, serverAddr)
 	}
 
-	return runTunnelWithUI(connConfig, daemon)
+	return runTunnelWithUI(connConfig, daemon, tunnelOptions{
+		notifyTargets: notifyTargets,
+		exit:          exit,
+		urlFile:       urlFile,
+		waitReady:     waitReady,
+		openURL:       openURL,
+		copyURL:       copyURL,
+		alert:         alert,
+	})
 }
@@ -0,0 +1,188 @@
+package cli
+
+import (
+	"fmt"
+	"strconv"
+
+	"drip/internal/client/notify"
+	"drip/internal/client/tcp"
+	"drip/internal/shared/labels"
+	"drip/internal/shared/protocol"
+	"drip/internal/shared/schedule"
+
+	"github.com/spf13/cobra"
+)
+
+var tlsCmd = &cobra.Command{
+	Use:   "tls <port|host:port>",
+	Short: "Start TLS passthrough tunnel",
+	Long: `Start a tunnel to a local service that terminates TLS itself.
+
+Visitors connect to the server's shared port (443) with the tunnel's host
+name as SNI, and their TLS bytes are forwarded untouched: the local service
+presents its own certificate and the server never sees the plaintext. No
+dedicated public port is allocated.
+
+Example:
+  drip tls 8443                     Tunnel a local HTTPS server as-is
+  drip tls 8883 --subdomain mqtt    Tunnel MQTT over TLS at mqtt.<domain>:443
+  drip tls 8443 --allow-ip 10.0.0.0/8      Only allow IPs from 10.x.x.x
+  drip tls 8443 --proxy-protocol    Send PROXY protocol v2 headers to the local service
+
+Visitors must send SNI, so plain IP addresses do not work. The local
+service's certificate should cover the tunnel's host name.
+
+Note: TLS tunnels need a server that terminates TLS itself; a server
+behind a TLS-terminating reverse proxy rejects them.`,
+	Args:          cobra.ExactArgs(1),
+	RunE:          runTLS,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+}
+
+func init() {
+	tlsCmd.Flags().StringVarP(&subdomain, "subdomain", "n", "", "Custom subdomain (optional)")
+	tlsCmd.Flags().BoolVarP(&daemonMode, "daemon", "d", false, "Run in background (daemon mode)")
+	tlsCmd.Flags().StringVarP(&localAddress, "address", "a", "127.0.0.1", "Local address to forward to (default: 127.0.0.1)")
+	tlsCmd.Flags().StringSliceVar(&allowIPs, "allow-ip", nil, "Allow only these IPs or CIDR ranges (e.g., 192.168.1.1,10.0.0.0/8)")
+	tlsCmd.Flags().StringSliceVar(&denyIPs, "deny-ip", nil, "Deny these IPs or CIDR ranges (e.g., 1.2.3.4,192.168.1.0/24)")
+	tlsCmd.Flags().StringSliceVar(&allowCountry, "allow-country", nil, "Allow only visitors from these countries (ISO codes, e.g., US,DE); needs a server with a GeoIP database")
+	tlsCmd.Flags().StringSliceVar(&denyCountry, "deny-country", nil, "Deny visitors from these countries (ISO codes, e.g., US,DE); needs a server with a GeoIP database")
+	tlsCmd.Flags().StringVar(&transport, "transport", "auto", "Transport protocol: auto, tcp, wss (WebSocket over TLS)")
+	tlsCmd.Flags().StringVar(&bandwidth, "bandwidth", "", "Bandwidth limit (e.g., 1M, 500K, 1G)")
+	tlsCmd.Flags().StringVar(&rateLimit, "rate", "", "Cap the tunnel's traffic in and out together on this machine, e.g. 1MBps (for shared uplinks)")
+	tlsCmd.Flags().StringVar(&alertBW, "alert-bandwidth", "", "Warn once the session's traffic in and out passes this size, e.g. 1GB (for metered connections)")
+	tlsCmd.Flags().BoolVar(&alertPause, "alert-pause", false, "Also pause the tunnel when --alert-bandwidth is reached")
+	tlsCmd.Flags().BoolVar(&proxyProto, "proxy-protocol", false, "Prepend a PROXY protocol v2 header with the visitor address to each connection")
+	tlsCmd.Flags().StringSliceVar(&backendAddrs, "backend", nil, "More local addresses (<port|host:port>) to spread connections over, e.g. 8444,8445")
+	tlsCmd.Flags().StringVar(&balance, "balance", tcp.BalanceRoundRobin, "How connections are spread over --backend addresses: round-robin, least-conn")
+	tlsCmd.Flags().IntVar(&retries, "retries", 0, "Retry a failed dial to the local service this many times, e.g. while it restarts")
+	tlsCmd.Flags().DurationVar(&retryBackoff, "retry-backoff", tcp.DefaultRetryBackoff, "Wait before the first retry, doubled after each")
+	tlsCmd.Flags().DurationVar(&tunnelTTL, "ttl", 0, "Close the tunnel automatically after this long, e.g. 2h (enforced by the server, 0 = never)")
+	tlsCmd.Flags().StringVar(&scheduleSpec, "schedule", "", "Only accept visitors in these windows, e.g. \"Mon-Fri 09:00-18:00 Europe/Berlin\" (enforced by the server)")
+	tlsCmd.Flags().StringVar(&exitAfter, "exit-after", "", "Exit after this long, e.g. 5m (for CI jobs)")
+	tlsCmd.Flags().StringVar(&urlFile, "url-file", "", "Write the public URL to this file as DRIP_URL=<url> once the tunnel is up")
+	tlsCmd.Flags().StringArrayVar(&labelArgs, "label", nil, "Label the tunnel with key=value, e.g. team=payments; repeatable, shown by drip list and the server's stats")
+	tlsCmd.Flags().BoolVar(&copyURL, "copy", false, "Copy the public address (host:port) to the clipboard once the tunnel is up")
+	tlsCmd.Flags().StringArrayVar(&notifyURLs, "notify", nil, "Post the public URL to a chat webhook when the tunnel is up, e.g. slack:https://hooks.slack.com/... or discord:https://discord.com/api/webhooks/...")
+	tlsCmd.Flags().BoolVar(&daemonMarker, "daemon-child", false, "Internal flag for daemon child process")
+	tlsCmd.Flags().MarkHidden("daemon-child")
+	rootCmd.AddCommand(tlsCmd)
+}
+
+func runTLS(_ *cobra.Command, args []string) error {
+	localHost, port, err := parseLocalTarget(args[0], localAddress)
+	if err != nil {
+		return err
+	}
+	backends, err := parseBackends(localHost)
+	if err != nil {
+		return err
+	}
+	retry, err := parseRetryPolicy()
+	if err != nil {
+		return err
+	}
+	if err := validateCountryFlags(); err != nil {
+		return err
+	}
+	alert, err := newBandwidthAlert(alertBW, alertPause)
+	if err != nil {
+		return err
+	}
+	tunnelLabels, err := labels.Parse(labelArgs)
+	if err != nil {
+		return err
+	}
+
+	if daemonMode && !daemonMarker {
+		return StartDaemon("tls", port, buildDaemonArgs("tls", []string{strconv.Itoa(port)}, subdomain, localHost))
+	}
+
+	serverAddr, token, err := resolveServerAddrAndToken("tls", port)
+	if err != nil {
+		return err
+	}
+
+	fingerprint, err := resolveServerFingerprint()
+	if err != nil {
+		return err
+	}
+	proxyDialer, err := resolveProxy()
+	if err != nil {
+		return err
+	}
+
+	bw, err := parseBandwidth(bandwidth)
+	if err != nil {
+		return err
+	}
+	rate, err := parseBandwidth(rateLimit)
+	if err != nil {
+		return fmt.Errorf("--rate: %w", err)
+	}
+
+	if tunnelTTL < 0 {
+		return fmt.Errorf("--ttl must not be negative")
+	}
+	if scheduleSpec != "" {
+		if _, err := schedule.Parse(scheduleSpec); err != nil {
+			return fmt.Errorf("--schedule: %w", err)
+		}
+	}
+
+	exit, err := newExitCondition(untilRequest, exitAfter, false)
+	if err != nil {
+		return err
+	}
+
+	notifyTargets, err := notify.ParseTargets(notifyURLs)
+	if err != nil {
+		return err
+	}
+
+	connConfig := &tcp.ConnectorConfig{
+		ServerAddr: serverAddr,
+		Token:      token,
+		TunnelType: protocol.TunnelTypeTLS,
+		LocalHost:  localHost,
+		LocalPort:  port,
+		Subdomain:  subdomain,
+		Insecure:   insecure,
+		AllowIPs:   allowIPs,
+		DenyIPs:    denyIPs,
+		Transport:  parseTransport(transport),
+		Bandwidth:  bw,
+		Rate:       rate,
+
+		Labels:            tunnelLabels,
+		AllowCountries:    allowCountry,
+		DenyCountries:     denyCountry,
+		ServerFingerprint: fingerprint,
+		FallbackAddrs:     serverFallbacks,
+		DrainTimeout:      drainTimeout,
+		PowerSave:         powerSave,
+		Chaos:             chaosConfig,
+		Proxy:             proxyDialer,
+		ProxyProtocol:     proxyProto,
+		Backends:          backends,
+		Balance:           balance,
+		Retry:             retry,
+		TTL:               tunnelTTL,
+		Schedule:          scheduleSpec,
+	}
+
+	var daemon *DaemonInfo
+	if daemonMarker {
+		daemon = newDaemonInfo("tls", port, subdomain, serverAddr)
+	}
+
+	return runTunnelWithUI(connConfig, daemon, tunnelOptions{
+		notifyTargets: notifyTargets,
+		exit:          exit,
+		urlFile:       urlFile,
+		openURL:       openURL,
+		copyURL:       copyURL,
+		alert:         alert,
+	})
+}
@@ -1,13 +1,75 @@
 package cli
 
 import (
+	"crypto/x509"
+	"errors"
 	"fmt"
+	"net"
 	"os"
+	"os/user"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
+	"drip/internal/client/credstore"
+	"drip/internal/client/har"
+	"drip/internal/client/proxy"
+	"drip/internal/client/tcp"
+	"drip/internal/shared/netutil"
+	"drip/internal/shared/protocol"
+	"drip/internal/shared/utils"
 	"drip/pkg/config"
 )
 
+// parseLocalTarget parses the local service argument of the tunnel commands:
+// a port, which is forwarded to defaultHost, or host:port. IPv6 hosts are
+// written in brackets, e.g. [::1]:3000.
+func parseLocalTarget(arg, defaultHost string) (string, int, error) {
+	host, portStr := trimBrackets(defaultHost), arg
+	if strings.Contains(arg, ":") {
+		h, p, err := net.SplitHostPort(arg)
+		if err != nil {
+			return "", 0, fmt.Errorf("invalid local address %q: use <port> or <host:port>, with IPv6 hosts in brackets", arg)
+		}
+		if h != "" {
+			host = h
+		}
+		portStr = p
+	}
+
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port < 1 || port > 65535 {
+		return "", 0, fmt.Errorf("invalid port number: %s", portStr)
+	}
+	return host, port, nil
+}
+
+// trimBrackets removes the brackets around an IPv6 host such as [::1].
+func trimBrackets(host string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+}
+
+// displayLocalAddr formats the local service address for humans.
+func displayLocalAddr(host string, port int) string {
+	if host == "" || host == "127.0.0.1" {
+		host = "localhost"
+	}
+	return net.JoinHostPort(host, strconv.Itoa(port))
+}
+
+// displayBackends lists the local target and any extra --backend
+// addresses of a tunnel for humans.
+func displayBackends(cfg *tcp.ConnectorConfig) string {
+	addrs := []string{displayLocalAddr(cfg.LocalHost, cfg.LocalPort)}
+	for _, b := range cfg.Backends {
+		host, port, _ := net.SplitHostPort(b)
+		p, _ := strconv.Atoi(port)
+		addrs = append(addrs, displayLocalAddr(host, p))
+	}
+	return strings.Join(addrs, ", ")
+}
+
 func buildDaemonArgs(tunnelType string, args []string, subdomain string, localAddress string) []string {
 	daemonArgs := append([]string{tunnelType}, args...)
 	daemonArgs = append(daemonArgs, "--daemon-child")
@@ -18,9 +80,30 @@ func buildDaemonArgs(tunnelType string, args []string, subdomain string, localAd
 	if localAddress != "127.0.0.1" {
 		daemonArgs = append(daemonArgs, "--address", localAddress)
 	}
+	if subStyle != "" {
+		daemonArgs = append(daemonArgs, "--subdomain-style", subStyle)
+	}
+	for _, label := range labelArgs {
+		daemonArgs = append(daemonArgs, "--label", label)
+	}
 	if serverURL != "" {
 		daemonArgs = append(daemonArgs, "--server", serverURL)
 	}
+	if profileName != "" {
+		daemonArgs = append(daemonArgs, "--profile", profileName)
+	}
+	if regionName != "" {
+		daemonArgs = append(daemonArgs, "--region", regionName)
+	}
+	if chaosSpec != "" {
+		daemonArgs = append(daemonArgs, "--chaos", chaosSpec)
+	}
+	if drainTimeout != defaultDrainTimeout {
+		daemonArgs = append(daemonArgs, "--drain-timeout", drainTimeout.String())
+	}
+	if powerSave {
+		daemonArgs = append(daemonArgs, "--power-save")
+	}
 	if authToken != "" {
 		daemonArgs = append(daemonArgs, "--token", authToken)
 	}
@@ -33,9 +116,147 @@ func buildDaemonArgs(tunnelType string, args []string, subdomain string, localAd
 	if bandwidth != "" {
 		daemonArgs = append(daemonArgs, "--bandwidth", bandwidth)
 	}
+	if rateLimit != "" {
+		daemonArgs = append(daemonArgs, "--rate", rateLimit)
+	}
+	if alertBW != "" {
+		daemonArgs = append(daemonArgs, "--alert-bandwidth", alertBW)
+	}
+	if alertPause {
+		daemonArgs = append(daemonArgs, "--alert-pause")
+	}
+	if len(allowCountry) > 0 {
+		daemonArgs = append(daemonArgs, "--allow-country", strings.Join(allowCountry, ","))
+	}
+	if len(denyCountry) > 0 {
+		daemonArgs = append(daemonArgs, "--deny-country", strings.Join(denyCountry, ","))
+	}
+	for _, rule := range requestRules {
+		daemonArgs = append(daemonArgs, "--rule", rule)
+	}
+	if visitorRPS > 0 {
+		daemonArgs = append(daemonArgs, "--visitor-rps", strconv.FormatFloat(visitorRPS, 'f', -1, 64))
+	}
+	if visitorBurst > 0 {
+		daemonArgs = append(daemonArgs, "--visitor-burst", strconv.Itoa(visitorBurst))
+	}
+	if hstsMaxAge > 0 {
+		daemonArgs = append(daemonArgs, "--hsts", hstsMaxAge.String())
+	}
+	if tls13Only {
+		daemonArgs = append(daemonArgs, "--tls13-only")
+	}
+	if clientCAFile != "" {
+		daemonArgs = append(daemonArgs, "--client-ca", clientCAFile)
+	}
+	if signSecret != "" {
+		daemonArgs = append(daemonArgs, "--sign-secret", signSecret)
+	}
+	if requestStore > 0 {
+		daemonArgs = append(daemonArgs, "--request-store", strconv.Itoa(requestStore))
+	}
+	if maxBody != "" {
+		daemonArgs = append(daemonArgs, "--max-body", maxBody)
+	}
+	if maxRespBody != "" {
+		daemonArgs = append(daemonArgs, "--max-response-body", maxRespBody)
+	}
+	for _, target := range notifyURLs {
+		daemonArgs = append(daemonArgs, "--notify", target)
+	}
+	for _, hook := range execHooks {
+		daemonArgs = append(daemonArgs, "--hook", hook)
+	}
+	if urlFile != "" {
+		daemonArgs = append(daemonArgs, "--url-file", urlFile)
+	}
+	if waitReady {
+		daemonArgs = append(daemonArgs, "--wait-ready")
+	}
+	if untilRequest != "" {
+		daemonArgs = append(daemonArgs, "--until-request", untilRequest)
+	}
+	if exitAfter != "" {
+		daemonArgs = append(daemonArgs, "--exit-after", exitAfter)
+	}
+	if tunnelTTL > 0 {
+		daemonArgs = append(daemonArgs, "--ttl", tunnelTTL.String())
+	}
+	if scheduleSpec != "" {
+		daemonArgs = append(daemonArgs, "--schedule", scheduleSpec)
+	}
+	if rewriteHost {
+		daemonArgs = append(daemonArgs, "--rewrite-host")
+	}
+	if rewriteHTML {
+		daemonArgs = append(daemonArgs, "--rewrite-html")
+	}
+	if len(cookieFixes) > 0 {
+		daemonArgs = append(daemonArgs, "--cookie-rewrite", strings.Join(cookieFixes, ","))
+	}
+	if len(corsOrigins) > 0 {
+		daemonArgs = append(daemonArgs, "--cors="+strings.Join(corsOrigins, ","))
+	}
+	if localCA != "" {
+		daemonArgs = append(daemonArgs, "--local-ca", localCA)
+	}
+	if localPin != "" {
+		daemonArgs = append(daemonArgs, "--local-pin", localPin)
+	}
+	if localVerify {
+		daemonArgs = append(daemonArgs, "--local-verify")
+	}
+	if localServerName != "" {
+		daemonArgs = append(daemonArgs, "--local-server-name", localServerName)
+	}
+	if len(backendAddrs) > 0 {
+		daemonArgs = append(daemonArgs, "--backend", strings.Join(backendAddrs, ","), "--balance", balance)
+	}
+	if healthCheck != "" {
+		daemonArgs = append(daemonArgs, "--health-check", healthCheck)
+	}
+	if maxInFlight > 0 {
+		daemonArgs = append(daemonArgs, "--max-inflight", strconv.Itoa(maxInFlight), "--max-queue", strconv.Itoa(maxQueue))
+	}
+	if retries > 0 {
+		daemonArgs = append(daemonArgs, "--retries", strconv.Itoa(retries), "--retry-backoff", retryBackoff.String())
+	}
+	if len(retryMethods) > 0 {
+		daemonArgs = append(daemonArgs, "--retry-methods", strings.Join(retryMethods, ","))
+	}
+	if shadowAddr != "" {
+		daemonArgs = append(daemonArgs, "--shadow", shadowAddr)
+	}
+	if harPath != "" {
+		daemonArgs = append(daemonArgs, "--har", harPath, "--har-max-body", harMaxBody)
+	}
+	if cacheTTL > 0 {
+		daemonArgs = append(daemonArgs, "--cache-ttl", cacheTTL.String())
+	}
+	if compressSSE {
+		daemonArgs = append(daemonArgs, "--compress-streams")
+	}
+	if proxyProto {
+		daemonArgs = append(daemonArgs, "--proxy-protocol")
+	}
+	if p2pMode {
+		daemonArgs = append(daemonArgs, "--p2p")
+	}
+	if private {
+		daemonArgs = append(daemonArgs, "--private")
+	}
+	// A key from the environment is inherited by the child; only pass it on
+	// the command line when it was given as a flag.
+	if e2eKey != "" && e2eKey != os.Getenv("DRIP_E2E_KEY") {
+		daemonArgs = append(daemonArgs, "--e2e-key", e2eKey)
+	}
 	if insecure {
 		daemonArgs = append(daemonArgs, "--insecure")
 	}
+	if serverFingerprint != "" {
+		daemonArgs = append(daemonArgs, "--server-fingerprint", serverFingerprint)
+	}
+	daemonArgs = append(daemonArgs, proxyArgs()...)
 	if verbose {
 		daemonArgs = append(daemonArgs, "--verbose")
 	}
@@ -43,24 +264,281 @@ func buildDaemonArgs(tunnelType string, args []string, subdomain string, localAd
 	return daemonArgs
 }
 
+// proxyArgs passes the proxy flags on to a daemon. Values from the
+// environment are inherited by the child and are left out.
+func proxyArgs() []string {
+	var args []string
+	if proxyURL != "" && proxyURL != os.Getenv("DRIP_PROXY") {
+		args = append(args, "--proxy", proxyURL)
+	}
+	if proxyPAC != "" && proxyPAC != os.Getenv("DRIP_PROXY_PAC") {
+		args = append(args, "--proxy-pac", proxyPAC)
+	}
+	if proxyUser != "" && proxyUser != os.Getenv("DRIP_PROXY_USER") {
+		args = append(args, "--proxy-user", proxyUser)
+	}
+	return args
+}
+
+// parseBackends resolves --backend addresses, which default to the host
+// of the main local target, and checks --balance and --health-check.
+func parseBackends(localHost string) ([]string, error) {
+	if err := tcp.ValidateBalance(balance); err != nil {
+		return nil, err
+	}
+	if healthCheck != "" && !strings.HasPrefix(healthCheck, "/") {
+		return nil, fmt.Errorf("--health-check must be a path starting with /")
+	}
+	backends := make([]string, 0, len(backendAddrs))
+	for _, arg := range backendAddrs {
+		host, port, err := parseLocalTarget(arg, localHost)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --backend: %w", err)
+		}
+		backends = append(backends, net.JoinHostPort(host, strconv.Itoa(port)))
+	}
+	return backends, nil
+}
+
+// parseShadow resolves --shadow like a --backend address. It returns ""
+// without it.
+func parseShadow(localHost string) (string, error) {
+	if shadowAddr == "" {
+		return "", nil
+	}
+	host, port, err := parseLocalTarget(shadowAddr, localHost)
+	if err != nil {
+		return "", fmt.Errorf("invalid --shadow: %w", err)
+	}
+	return net.JoinHostPort(host, strconv.Itoa(port)), nil
+}
+
+// validateCountryFlags checks the codes given to --allow-country and
+// --deny-country.
+func validateCountryFlags() error {
+	if err := netutil.ValidateCountryCodes(slices.Concat(allowCountry, denyCountry)); err != nil {
+		return fmt.Errorf("--allow-country/--deny-country: %w", err)
+	}
+	return nil
+}
+
+// parseSubdomainStyle checks --subdomain-style: hex, words, prefix for a
+// prefix made from the local user name, or prefix:<name>.
+func parseSubdomainStyle() (style, prefix string, err error) {
+	if subStyle == "" {
+		return "", "", nil
+	}
+	if subdomain != "" {
+		return "", "", fmt.Errorf("cannot use --subdomain and --subdomain-style together")
+	}
+	style, name, hasName := strings.Cut(subStyle, ":")
+	style = strings.ToLower(style)
+	if !utils.IsSubdomainStyle(style) || (hasName && style != utils.SubdomainStylePrefix) {
+		return "", "", fmt.Errorf("invalid --subdomain-style %q: use %s or prefix:<name>", subStyle, strings.Join(utils.SubdomainStyles, ", "))
+	}
+	if style != utils.SubdomainStylePrefix {
+		return style, "", nil
+	}
+	if !hasName {
+		name = localUserName()
+	}
+	prefix = utils.SanitizeSubdomainPrefix(name)
+	if prefix == "" {
+		return "", "", fmt.Errorf("no subdomain prefix in %q: use prefix:<name> with letters or digits", name)
+	}
+	if utils.IsReserved(prefix) {
+		return "", "", fmt.Errorf("subdomain prefix %q is reserved", prefix)
+	}
+	return style, prefix, nil
+}
+
+// localUserName returns the name of the user running drip, without a
+// Windows domain.
+func localUserName() string {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		name := u.Username
+		if i := strings.LastIndexByte(name, '\\'); i >= 0 {
+			name = name[i+1:]
+		}
+		return name
+	}
+	if name := os.Getenv("USER"); name != "" {
+		return name
+	}
+	return os.Getenv("USERNAME")
+}
+
+// parseRetryPolicy checks --retries, --retry-backoff and --retry-methods.
+func parseRetryPolicy() (tcp.RetryPolicy, error) {
+	if retries < 0 || retryBackoff < 0 {
+		return tcp.RetryPolicy{}, fmt.Errorf("--retries and --retry-backoff must not be negative")
+	}
+	return tcp.RetryPolicy{Retries: retries, Backoff: retryBackoff, Methods: retryMethods}, nil
+}
+
+// parseEdgeTLS checks --hsts, --tls13-only and --client-ca. It returns nil
+// without them.
+func parseEdgeTLS() (*protocol.EdgeTLSPolicy, error) {
+	if hstsMaxAge < 0 {
+		return nil, fmt.Errorf("--hsts must not be negative")
+	}
+	return newEdgeTLSPolicy(hstsMaxAge, tls13Only, clientCAFile)
+}
+
+// newEdgeTLSPolicy builds the edge TLS policy asked of the server, reading
+// the visitor CA bundle from caFile. It returns nil if nothing is asked.
+func newEdgeTLSPolicy(hsts time.Duration, tls13 bool, caFile string) (*protocol.EdgeTLSPolicy, error) {
+	if hsts == 0 && !tls13 && caFile == "" {
+		return nil, nil
+	}
+	policy := &protocol.EdgeTLSPolicy{
+		HSTSMaxAge: int64(hsts / time.Second),
+		TLS13Only:  tls13,
+	}
+	if caFile != "" {
+		data, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read client CA: %w", err)
+		}
+		if !x509.NewCertPool().AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no PEM certificates in client CA %s", caFile)
+		}
+		policy.ClientCA = string(data)
+	}
+	return policy, nil
+}
+
+// openHARRecorder starts recording to --har. It returns nil without it.
+func openHARRecorder() (*har.Recorder, error) {
+	if harPath == "" {
+		return nil, nil
+	}
+	limit, err := parseBandwidth(harMaxBody)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --har-max-body %q (use a size like 64K or 1M)", harMaxBody)
+	}
+	return har.NewRecorder(harPath, limit, Version)
+}
+
 func resolveServerAddrAndToken(tunnelType string, port int) (string, string, error) {
+	return resolveServer(fmt.Sprintf("%s %d", tunnelType, port))
+}
+
+// resolveServer is resolveServerAddrAndToken for commands that do not take a
+// port; usage is the command line shown in the "configuration not found" hint.
+func resolveServer(usage string) (string, string, error) {
 	if serverURL != "" {
-		return serverURL, authToken, nil
+		if regionName != "" {
+			return "", "", fmt.Errorf("--region cannot be combined with --server")
+		}
+		token := authToken
+		if token == "" {
+			// A token saved with 'drip auth login --server' is used too.
+			token, _ = storedToken(serverURL)
+		}
+		return serverURL, token, nil
 	}
 
-	cfg, err := config.LoadClientConfig("")
+	cfg, err := loadClientConfig("")
 	if err != nil {
+		if config.ConfigExists("") {
+			return "", "", err
+		}
 		return "", "", fmt.Errorf(`configuration not found.
 
 Please run 'drip config init' first, or use flags:
-  drip %s %d --server SERVER:PORT --token TOKEN`, tunnelType, port)
+  drip %s --server SERVER:PORT --token TOKEN`, usage)
 	}
 
 	if cfg.Server == "" {
 		return "", "", fmt.Errorf("server address is required")
 	}
 
-	return cfg.Server, cfg.Token, nil
+	server, err := selectServer(cfg)
+	if err != nil {
+		return "", "", err
+	}
+	return server, cfg.Token, nil
+}
+
+// loadClientConfig loads the config file at path (default when empty) as
+// seen under --profile, or the current profile when it is not given.
+func loadClientConfig(path string) (*config.ClientConfig, error) {
+	raw, err := config.LoadClientConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := raw.WithProfile(profileName)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.Token == "" && cfg.TokenStore == config.TokenStoreKeychain {
+		token, err := storedToken(cfg.Server)
+		if err != nil && !errors.Is(err, credstore.ErrNotFound) {
+			return nil, fmt.Errorf("failed to read the token for %s: %w (use 'drip auth login --file' on machines without a credential store)", cfg.Server, err)
+		}
+		cfg.Token = token
+	}
+	return cfg, nil
+}
+
+// storedToken returns the token kept in the system credential store for
+// server.
+func storedToken(server string) (string, error) {
+	store, err := credstore.New()
+	if err != nil {
+		return "", err
+	}
+	return store.Get(server)
+}
+
+// resolveServerFingerprint returns the pinned server key for this run. The pin
+// saved in the config file only applies to the configured server, so it is
+// ignored when --server points somewhere else.
+func resolveServerFingerprint() (string, error) {
+	fingerprint := serverFingerprint
+	if fingerprint == "" && serverURL == "" {
+		if cfg, err := loadClientConfig(""); err == nil {
+			fingerprint = cfg.ServerFingerprint
+		}
+	}
+	if fingerprint == "" {
+		return "", nil
+	}
+	if _, err := config.ParseFingerprint(fingerprint); err != nil {
+		return "", err
+	}
+	return fingerprint, nil
+}
+
+// resolveProxy returns the dialer that reaches the server through the
+// proxy chosen by --proxy or --proxy-pac, the config file, or else the
+// HTTPS_PROXY and NO_PROXY variables. Unlike the server pin, the proxy
+// belongs to the network, so the config file's applies to any server.
+func resolveProxy() (*proxy.Dialer, error) {
+	cfg, err := loadClientConfig("")
+	if err != nil {
+		cfg = nil
+	}
+	return proxyFromConfig(cfg)
+}
+
+// proxyFromConfig is resolveProxy with the config file already loaded; cfg
+// may be nil.
+func proxyFromConfig(cfg *config.ClientConfig) (*proxy.Dialer, error) {
+	proxyCfg := proxy.Config{URL: proxyURL, PAC: proxyPAC}
+	if proxyCfg.URL == "" && proxyCfg.PAC == "" && cfg != nil {
+		proxyCfg.URL, proxyCfg.PAC = cfg.Proxy, cfg.ProxyPAC
+	}
+	if proxyUser != "" {
+		proxyCfg.Username, proxyCfg.Password, _ = strings.Cut(proxyUser, ":")
+	}
+	dialer, err := proxy.New(proxyCfg)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy settings: %w", err)
+	}
+	return dialer, nil
 }
 
 func newDaemonInfo(tunnelType string, port int, subdomain string, serverAddr string) *DaemonInfo {
@@ -1,27 +1,62 @@
 package cli
 
 import (
+	"bufio"
+	"errors"
 	"fmt"
 	"os"
-	"os/signal"
 	"strings"
-	"syscall"
 	"time"
 
+	"drip/internal/client/notify"
 	"drip/internal/client/tcp"
+	"drip/internal/shared/constants"
+	"drip/internal/shared/protocol"
+	"drip/internal/shared/stats"
 	"drip/internal/shared/tuning"
 	"drip/internal/shared/ui"
 	"drip/internal/shared/utils"
 
+	"github.com/charmbracelet/x/term"
 	"go.uber.org/zap"
 )
 
 const (
 	maxReconnectAttempts = 5
 	reconnectInterval    = 3 * time.Second
+
+	// daemonStatsInterval is how often a background tunnel records its
+	// traffic for 'drip list'.
+	daemonStatsInterval = 5 * time.Second
+
+	// expiryGrace absorbs the round trip between the server registering the
+	// tunnel and the client starting its own countdown.
+	expiryGrace = 5 * time.Second
 )
 
-func runTunnelWithUI(connConfig *tcp.ConnectorConfig, daemonInfo *DaemonInfo) error {
+// tunnelOptions carries what a run needs beyond the connector configuration.
+type tunnelOptions struct {
+	notifyTargets []notify.Target
+	exit          *exitCondition
+
+	// urlFile and GitHub Actions outputs receive the public URL once it
+	// is known and, with waitReady, reachable through the server.
+	urlFile   string
+	waitReady bool
+
+	// openURL and copyURL hand the public URL to the browser and the
+	// clipboard, see shareURL.
+	openURL bool
+	copyURL bool
+
+	// logName names the log file under ~/.drip/logs, see tunnelLogName.
+	logName string
+
+	// alert warns about, and may pause, a session using a lot of traffic.
+	alert *bandwidthAlert
+}
+
+func runTunnelWithUI(connConfig *tcp.ConnectorConfig, daemonInfo *DaemonInfo, opts tunnelOptions) error {
 	tuning.ApplyMode(tuning.ModeClient)
 
 	if err := utils.InitLogger(verbose); err != nil {
@@ -29,27 +64,125 @@ func runTunnelWithUI(connConfig *tcp.ConnectorConfig, daemonInfo *DaemonInfo) er
 	}
 	defer utils.Sync()
 
-	logger := utils.GetLogger()
+	logName := opts.logName
+	if logName == "" {
+		logName = tunnelLogName(connConfig)
+	}
+	logger, closeLog := openTunnelLog(utils.GetLogger(), logName)
+	defer closeLog()
+	defer watchLogLevelSignal(logger)()
+	connConfig.Proxy.SetLogger(logger)
 
 	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	notifyQuit(quit)
+
+	// The probe must come first so it is answered before other hooks
+	// count it as a request.
+	var probe *readyProbe
+	if opts.waitReady {
+		probe = newReadyProbe()
+		probe.attach(connConfig, logger)
+	}
+	exit := opts.exit
+	exit.attach(connConfig, logger)
+
+	if recorder := connConfig.HAR; recorder != nil {
+		defer func() {
+			if err := recorder.Close(); err != nil {
+				fmt.Println(ui.Warning(err.Error()))
+				return
+			}
+			fmt.Println(ui.Muted(fmt.Sprintf("Recorded %d requests to %s", recorder.Len(), recorder.Path())))
+		}()
+	}
+
+	notifier := notify.New(opts.notifyTargets, logger)
+	var announcedURL, publishedURL, sharedURL string
+	defer func() {
+		if announcedURL != "" {
+			notifier.TunnelDown(announcedURL)
+		}
+	}()
+
+	// Traffic is counted for the whole session, across reconnects.
+	if connConfig.Stats == nil {
+		connConfig.Stats = stats.NewTrafficStats()
+	}
+	if connConfig.Resume == nil {
+		connConfig.Resume = tcp.NewResumeState()
+	}
+	// With --verbose each request is listed with what it transferred.
+	connConfig.StreamStats = verbose
+
+	// expiresAt is the local deadline for a tunnel with a TTL. Reconnects
+	// ask only for what is left of it rather than starting over.
+	var expiresAt time.Time
+
+	// connectedAt is when the tunnel last came up, and lostAt when it
+	// last dropped, until it is back.
+	var connectedAt, lostAt time.Time
 
 	reconnectAttempts := 0
+	failovers := 0
 	for {
+		if !expiresAt.IsZero() {
+			remaining := time.Until(expiresAt)
+			if remaining <= 0 {
+				fmt.Println(ui.RenderTunnelExpired())
+				if daemonInfo != nil {
+					RemoveDaemonInfo(daemonInfo.Type, daemonInfo.Port)
+				}
+				return nil
+			}
+			connConfig.TTL = remaining
+		}
+
+		expiryCh := make(chan struct{}, 1)
+		connConfig.OnExpiry = func(time.Time) {
+			select {
+			case expiryCh <- struct{}{}:
+			default:
+			}
+		}
 		connector := tcp.NewTunnelClient(connConfig, logger)
 
+		if connConfig.Chaos.Enabled() {
+			fmt.Println(ui.Warning("Chaos mode: injecting " + connConfig.Chaos.String() + " into tunnel connections"))
+		}
 		fmt.Println(ui.RenderConnecting(connConfig.ServerAddr, reconnectAttempts, maxReconnectAttempts))
 
 		if err := connector.Connect(); err != nil {
+			logger.Warn("Connection failed", zap.String("server", connConfig.ServerAddr), zap.Error(err))
+			if perr, ok := clientTooOld(err); ok {
+				fmt.Println(ui.RenderUpgradeRequired(Version, perr.MinVersion, perr.UpgradeURL))
+				os.Exit(1)
+			}
 			if isConfigurationError(err) {
 				fmt.Println(ui.Warning(fmt.Sprintf("Configuration error: %v", err)))
 				os.Exit(1)
 			}
+			// Until the tunnel first comes up, a refused subdomain can be
+			// swapped for another one.
+			if publishedURL == "" && connConfig.Subdomain != "" {
+				if name, ok := askForSubdomain(err, connConfig.Subdomain); ok {
+					connConfig.Subdomain = name
+					continue
+				}
+			}
 			if isNonRetryableError(err) {
 				fmt.Println(ui.RenderConnectionFailed(err))
 				os.Exit(1)
 			}
 
+			// Another region is tried right away; only a full round of
+			// failures counts as an attempt.
+			if failovers < len(connConfig.FallbackAddrs) && connConfig.FailOver() {
+				failovers++
+				fmt.Println(ui.RenderConnectionFailed(err))
+				continue
+			}
+			failovers = 0
+
 			reconnectAttempts++
 			if reconnectAttempts >= maxReconnectAttempts {
 				return fmt.Errorf("failed to connect after %d attempts: %w", maxReconnectAttempts, err)
@@ -61,12 +194,32 @@ func runTunnelWithUI(connConfig *tcp.ConnectorConfig, daemonInfo *DaemonInfo) er
 			case <-quit:
 				fmt.Println(ui.RenderShuttingDown())
 				return nil
+			case <-exit.Done():
+				_, err := exit.Result()
+				return err
 			case <-time.After(reconnectInterval):
 				continue
 			}
 		}
 
+		if !lostAt.IsZero() {
+			logger.Info("Tunnel reconnected", zap.Duration("reconnect_latency", time.Since(lostAt)))
+			lostAt = time.Time{}
+		}
+		connectedAt = time.Now()
 		reconnectAttempts = 0
+		failovers = 0
+		exit.start()
+		opts.alert.apply(connector, logger)
+		if connConfig.TTL > 0 {
+			if connector.ExpiresAt().IsZero() {
+				fmt.Println(ui.Warning("Server does not support --ttl; the tunnel will not expire"))
+				connConfig.TTL = 0
+			} else {
+				expiresAt = time.Now().Add(connConfig.TTL)
+			}
+		}
+
 		if assignedSubdomain := connector.GetSubdomain(); assignedSubdomain != "" {
 			connConfig.Subdomain = assignedSubdomain
 			if daemonInfo != nil {
@@ -74,25 +227,53 @@ func runTunnelWithUI(connConfig *tcp.ConnectorConfig, daemonInfo *DaemonInfo) er
 			}
 		}
 
+		if url := connector.GetURL(); url != publishedURL {
+			if probe != nil {
+				fmt.Println(ui.Muted("Waiting for the tunnel to become reachable..."))
+				if err := probe.wait(connConfig, url); err != nil {
+					connector.Close()
+					return err
+				}
+			}
+			if err := publishURL(url, opts.urlFile); err != nil {
+				connector.Close()
+				return err
+			}
+			publishedURL = url
+		}
+
 		if daemonInfo != nil {
 			daemonInfo.URL = connector.GetURL()
+			daemonInfo.Labels = connConfig.Labels
 			if err := SaveDaemonInfo(daemonInfo); err != nil {
 				logger.Warn("Failed to save daemon info", zap.Error(err))
 			}
 		}
 
-		displayAddr := connConfig.LocalHost
-		if displayAddr == "127.0.0.1" {
-			displayAddr = "localhost"
-		}
-
 		status := &ui.TunnelStatus{
 			Type:      string(connConfig.TunnelType),
 			URL:       connector.GetURL(),
-			LocalAddr: fmt.Sprintf("%s:%d", displayAddr, connConfig.LocalPort),
+			LocalAddr: displayBackends(connConfig),
+			ExpiresAt: expiresAt,
+			AlertAt:   opts.alert.threshold(),
 		}
 
 		fmt.Print(ui.RenderTunnelConnected(status))
+		logger.Info("Tunnel connected", zap.String("url", status.URL), zap.String("server", connConfig.ServerAddr))
+
+		if status.URL != announcedURL {
+			if announcedURL != "" {
+				notifier.TunnelDown(announcedURL)
+			}
+			notifier.TunnelUp(status.URL, status.LocalAddr)
+			announcedURL = status.URL
+		}
+		if status.URL != sharedURL {
+			// A new URL after a reconnect is copied again, but only the
+			// first one opens a browser tab.
+			shareURL(status.URL, opts.copyURL, opts.openURL && sharedURL == "")
+			sharedURL = status.URL
+		}
 
 		latencyCh := make(chan time.Duration, 1)
 		connector.SetLatencyCallback(func(latency time.Duration) {
@@ -102,36 +283,96 @@ func runTunnelWithUI(connConfig *tcp.ConnectorConfig, daemonInfo *DaemonInfo) er
 			}
 		})
 
+		streamCh := make(chan protocol.StreamStats, 64)
+		connector.SetStreamStatsCallback(func(stats protocol.StreamStats) {
+			select {
+			case streamCh <- stats:
+			default:
+			}
+		})
+
 		stopDisplay := make(chan struct{})
+		displayDone := make(chan struct{})
 		disconnected := make(chan struct{})
 
+		// The display goroutine records traffic in its own copy of the
+		// daemon info, and is waited for so it cannot write the file
+		// again once the tunnel has removed it.
+		var daemonStats *DaemonInfo
+		if daemonInfo != nil {
+			info := *daemonInfo
+			daemonStats = &info
+		}
+		stop := func() {
+			close(stopDisplay)
+			<-displayDone
+		}
+
 		go func() {
+			defer close(displayDone)
 			renderTicker := time.NewTicker(1 * time.Second)
 			defer renderTicker.Stop()
 
 			var lastLatency time.Duration
+			var lastSaved time.Time
 			lastRenderedLines := 0
 
 			for {
 				select {
 				case latency := <-latencyCh:
 					lastLatency = latency
+				case <-expiryCh:
+					// Print the warning above the live stats; they are
+					// redrawn below it on the next tick.
+					if lastRenderedLines > 0 {
+						fmt.Print(clearLines(lastRenderedLines))
+						lastRenderedLines = 0
+					}
+					fmt.Println(ui.RenderExpiryWarning(expiresAt))
+				case stats := <-streamCh:
+					if lastRenderedLines > 0 {
+						fmt.Print(clearLines(lastRenderedLines))
+						lastRenderedLines = 0
+					}
+					fmt.Println(ui.RenderStreamStats(stats))
 				case <-renderTicker.C:
-					stats := connector.GetStats()
-					if stats == nil {
+					traffic := connector.GetStats()
+					if traffic == nil {
 						continue
 					}
 
-					stats.UpdateSpeed()
-					snapshot := stats.GetSnapshot()
+					traffic.UpdateSpeed()
+					snapshot := traffic.GetSnapshot()
+
+					if opts.alert.check(snapshot.TotalBytes) {
+						if lastRenderedLines > 0 {
+							fmt.Print(clearLines(lastRenderedLines))
+							lastRenderedLines = 0
+						}
+						fmt.Println(ui.Warning(opts.alert.trigger(connector, snapshot.TotalBytes, logger)))
+					}
+					status.Paused = connector.Paused()
+
+					if daemonStats != nil && time.Since(lastSaved) >= daemonStatsInterval {
+						daemonStats.BytesIn = snapshot.TotalBytesIn
+						daemonStats.BytesOut = snapshot.TotalBytesOut
+						daemonStats.SpeedIn = snapshot.SpeedIn
+						daemonStats.SpeedOut = snapshot.SpeedOut
+						if err := SaveDaemonInfo(daemonStats); err != nil {
+							logger.Debug("Failed to save daemon traffic", zap.Error(err))
+						}
+						lastSaved = time.Now()
+					}
 
 					status.Latency = lastLatency
 					status.BytesIn = snapshot.TotalBytesIn
 					status.BytesOut = snapshot.TotalBytesOut
 					status.SpeedIn = float64(snapshot.SpeedIn)
 					status.SpeedOut = float64(snapshot.SpeedOut)
+					status.Queued = snapshot.QueuedRequests
+					status.Rejected = snapshot.RejectedRequests
 
-					if status.Type == "tcp" {
+					if status.Type == "tcp" || status.Type == "tls" {
 						if snapshot.SpeedIn == 0 && snapshot.SpeedOut == 0 {
 							status.TotalRequest = 0
 						} else {
@@ -159,49 +400,79 @@ func runTunnelWithUI(connConfig *tcp.ConnectorConfig, daemonInfo *DaemonInfo) er
 			close(disconnected)
 		}()
 
+		var exitErr error
 		select {
 		case <-quit:
-			close(stopDisplay)
+			stop()
 			fmt.Println()
 			fmt.Println(ui.RenderShuttingDown())
-
-			// Close with timeout (wait for ongoing requests to complete)
-			done := make(chan struct{})
-			go func() {
-				connector.Close()
-				close(done)
-			}()
-
-			select {
-			case <-done:
-				// Closed successfully
-			case <-time.After(2 * time.Second):
-				fmt.Println(ui.Warning("Force closing (timeout)..."))
-			}
-
-			if daemonInfo != nil {
-				RemoveDaemonInfo(daemonInfo.Type, daemonInfo.Port)
+		case <-exit.Done():
+			stop()
+			fmt.Println()
+			reason, err := exit.Result()
+			if err != nil {
+				fmt.Println(ui.Error(fmt.Sprintf("Exit condition failed: %s", reason)))
+			} else {
+				fmt.Println(ui.Success(fmt.Sprintf("Exit condition met: %s", reason)))
 			}
-			fmt.Println(ui.Success("Tunnel closed"))
-			return nil
+			exitErr = err
 		case <-disconnected:
-			close(stopDisplay)
+			stop()
 			fmt.Println()
+			if !expiresAt.IsZero() && time.Until(expiresAt) < expiryGrace {
+				fmt.Println(ui.RenderTunnelExpired())
+				if daemonInfo != nil {
+					RemoveDaemonInfo(daemonInfo.Type, daemonInfo.Port)
+				}
+				return nil
+			}
 			fmt.Println(ui.RenderConnectionLost())
+			logger.Warn("Connection lost")
+			lostAt = time.Now()
 			reconnectAttempts++
 			if reconnectAttempts >= maxReconnectAttempts {
 				return fmt.Errorf("connection lost after %d reconnect attempts", maxReconnectAttempts)
 			}
+			// A tunnel the server issued a resume token for can be taken
+			// back at once, before the server notices it is gone. One that
+			// keeps dropping right away waits like any other.
+			if connConfig.Resume.Token(connConfig.ServerAddr) != "" && time.Since(connectedAt) > reconnectInterval {
+				continue
+			}
 			fmt.Println(ui.RenderRetrying(reconnectInterval))
 
 			select {
 			case <-quit:
 				fmt.Println(ui.RenderShuttingDown())
 				return nil
+			case <-exit.Done():
+				_, err := exit.Result()
+				return err
 			case <-time.After(reconnectInterval):
 				continue
 			}
 		}
+
+		// Close with timeout (wait for ongoing requests to drain)
+		done := make(chan struct{})
+		go func() {
+			connector.Close()
+			close(done)
+		}()
+
+		select {
+		case <-done:
+			// Closed successfully
+		case <-time.After(connConfig.DrainTimeout + 2*time.Second):
+			fmt.Println(ui.Warning("Force closing (timeout)..."))
+		}
+
+		if daemonInfo != nil {
+			RemoveDaemonInfo(daemonInfo.Type, daemonInfo.Port)
+		}
+		fmt.Println(ui.Success("Tunnel closed"))
+		logger.Info("Tunnel closed")
+		return exitErr
 	}
 }
 
@@ -225,7 +496,68 @@ func countRenderedLines(block string) int {
 	return lines
 }
 
+// askForSubdomain asks on the terminal for another subdomain when the server
+// refused the requested one. An empty answer lets the server generate one.
+// It reports false if err is another error or there is no one to ask.
+func askForSubdomain(err error, requested string) (string, bool) {
+	var perr *protocol.Error
+	if !errors.As(err, &perr) || !term.IsTerminal(os.Stdin.Fd()) {
+		return "", false
+	}
+	var reason string
+	switch perr.Code {
+	case constants.ErrCodeSubdomainTaken:
+		reason = "is already in use"
+	case constants.ErrCodeSubdomainReserved:
+		reason = "is reserved or not allowed on this server"
+	case constants.ErrCodeInvalidSubdomain:
+		reason = "is not a valid subdomain"
+	default:
+		return "", false
+	}
+	if perr.Subdomain != "" {
+		requested = perr.Subdomain
+	}
+
+	fmt.Println(ui.Warning(fmt.Sprintf("Subdomain '%s' %s", requested, reason)))
+	reader := bufio.NewReader(os.Stdin)
+	for {
+		fmt.Print(ui.Muted("Another subdomain (empty for a generated one): "))
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			fmt.Println()
+			return "", false
+		}
+		name := strings.ToLower(strings.TrimSpace(line))
+		if name == "" || utils.ValidateSubdomain(name) {
+			return name, true
+		}
+		fmt.Println(ui.Warning("Use 3 to 63 lowercase letters, digits and hyphens, not starting or ending with a hyphen"))
+	}
+}
+
+// clientTooOld returns the server's error if it refused this client version.
+func clientTooOld(err error) (*protocol.Error, bool) {
+	var perr *protocol.Error
+	if errors.As(err, &perr) && perr.Code == constants.ErrCodeClientTooOld {
+		return perr, true
+	}
+	return nil, false
+}
+
 func isNonRetryableError(err error) bool {
+	switch protocol.ErrorCode(err) {
+	case constants.ErrCodeAuthFailed,
+		constants.ErrCodeSubdomainTaken,
+		constants.ErrCodeSubdomainReserved,
+		constants.ErrCodeInvalidSubdomain,
+		constants.ErrCodeTunnelTypeNotAllowed,
+		constants.ErrCodeUnsupported:
+		return true
+	}
+
+	// Servers that predate specific error codes send these as
+	// REGISTRATION_FAILED.
 	errStr := err.Error()
 	return strings.Contains(errStr, "subdomain is already taken") ||
 		strings.Contains(errStr, "subdomain is reserved") ||
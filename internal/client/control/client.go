@@ -0,0 +1,134 @@
+package control
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"drip/internal/client/supervisor"
+
+	json "github.com/goccy/go-json"
+)
+
+// ErrNotRunning is returned when no daemon listens on the socket.
+var ErrNotRunning = errors.New("daemon is not running")
+
+// Client talks to a daemon's control socket.
+type Client struct {
+	socket string
+	http   *http.Client
+}
+
+// NewClient returns a client for the daemon listening on socket.
+func NewClient(socket string) *Client {
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socket)
+		},
+	}
+	// Adding waits for the first connection attempt, so allow for it.
+	return &Client{socket: socket, http: &http.Client{Timeout: connectWait + 5*time.Second, Transport: transport}}
+}
+
+// Ping reports whether the daemon answers.
+func (c *Client) Ping() error {
+	_, err := c.List()
+	return err
+}
+
+// Add starts a tunnel and returns its status after the first attempt.
+func (c *Client) Add(spec TunnelSpec) (supervisor.Status, error) {
+	var st supervisor.Status
+	err := c.do(http.MethodPost, "/tunnels", spec, &st)
+	return st, err
+}
+
+// Remove stops the tunnel called name.
+func (c *Client) Remove(name string) error {
+	return c.do(http.MethodDelete, "/tunnels/"+url.PathEscape(name), nil, nil)
+}
+
+// Pause pauses the tunnel called name, see supervisor.Supervisor.SetPaused.
+func (c *Client) Pause(name string) (PauseResult, error) {
+	var res PauseResult
+	err := c.do(http.MethodPost, "/tunnels/"+url.PathEscape(name)+"/pause", nil, &res)
+	return res, err
+}
+
+// Resume resumes the tunnel called name.
+func (c *Client) Resume(name string) (PauseResult, error) {
+	var res PauseResult
+	err := c.do(http.MethodPost, "/tunnels/"+url.PathEscape(name)+"/resume", nil, &res)
+	return res, err
+}
+
+// SetRules replaces the request filtering rules of the tunnel called name,
+// see RulesSpec.
+func (c *Client) SetRules(name string, rules []string) error {
+	return c.do(http.MethodPut, "/tunnels/"+url.PathEscape(name)+"/rules", RulesSpec{Rules: rules}, nil)
+}
+
+// List returns every tunnel the daemon runs.
+func (c *Client) List() ([]supervisor.Status, error) {
+	var list []supervisor.Status
+	err := c.do(http.MethodGet, "/tunnels", nil, &list)
+	return list, err
+}
+
+// Shutdown asks the daemon to close its tunnels and exit.
+func (c *Client) Shutdown() error {
+	return c.do(http.MethodPost, "/shutdown", nil, nil)
+}
+
+func (c *Client) do(method, path string, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, "http://drip"+path, body)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		if _, statErr := os.Stat(c.socket); os.IsNotExist(statErr) || isConnRefused(err) {
+			return ErrNotRunning
+		}
+		return fmt.Errorf("failed to reach daemon: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		var e errorResponse
+		if json.NewDecoder(resp.Body).Decode(&e) == nil && e.Error != "" {
+			return errors.New(e.Error)
+		}
+		return fmt.Errorf("daemon returned %s", resp.Status)
+	}
+	if out != nil {
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+	return nil
+}
+
+func isConnRefused(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
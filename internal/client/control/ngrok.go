@@ -0,0 +1,310 @@
+package control
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"drip/internal/client/supervisor"
+
+	json "github.com/goccy/go-json"
+	"go.uber.org/zap"
+)
+
+// Error codes in the bodies of the ngrok-compatible API's errors. Clients
+// mostly look at status_code and details.err.
+const (
+	ngrokErrNotFound      = 100
+	ngrokErrInvalidConfig = 102
+	ngrokErrExists        = 103
+	ngrokErrStartFailed   = 104
+)
+
+// ngrokTunnelRequest is the body of POST /api/tunnels in ngrok's local
+// agent API. Options drip has no equivalent for, such as inspect or
+// bind_tls, are accepted and ignored.
+type ngrokTunnelRequest struct {
+	Name      string `json:"name"`
+	Addr      string `json:"addr"`
+	Proto     string `json:"proto"`
+	Subdomain string `json:"subdomain,omitempty"`
+}
+
+type ngrokTunnel struct {
+	Name      string            `json:"name"`
+	URI       string            `json:"uri"`
+	PublicURL string            `json:"public_url"`
+	Proto     string            `json:"proto"`
+	Config    ngrokTunnelConfig `json:"config"`
+}
+
+type ngrokTunnelConfig struct {
+	Addr    string `json:"addr"`
+	Inspect bool   `json:"inspect"`
+}
+
+type ngrokTunnelList struct {
+	Tunnels []ngrokTunnel `json:"tunnels"`
+	URI     string        `json:"uri"`
+}
+
+type ngrokError struct {
+	ErrorCode  int               `json:"error_code"`
+	StatusCode int               `json:"status_code"`
+	Msg        string            `json:"msg"`
+	Details    map[string]string `json:"details,omitempty"`
+}
+
+// NgrokHandler returns a subset of ngrok's local agent API, so scripts and
+// libraries written for ngrok can drive the daemon: GET and POST
+// /api/tunnels, and GET and DELETE /api/tunnels/{name}. Tunnels created
+// through it use the server settings of defaults.
+//
+// Every request must carry secret as a bearer token. Unlike the control
+// socket, a loopback port can be reached by web pages in the user's
+// browser, so requests from a browser or through a rebound DNS name are
+// refused as well.
+func (s *Server) NgrokHandler(defaults TunnelSpec, secret string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/tunnels", s.handleNgrokList)
+	mux.HandleFunc("POST /api/tunnels", s.handleNgrokStart(defaults))
+	mux.HandleFunc("GET /api/tunnels/{name}", s.handleNgrokGet)
+	mux.HandleFunc("DELETE /api/tunnels/{name}", s.handleNgrokStop)
+	return ngrokGuard(mux, secret)
+}
+
+// ServeNgrok serves NgrokHandler on ln until ctx is done.
+func (s *Server) ServeNgrok(ctx context.Context, ln net.Listener, defaults TunnelSpec, secret string) error {
+	srv := &http.Server{Handler: s.NgrokHandler(defaults, secret), ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		<-ctx.Done()
+		_ = srv.Close()
+	}()
+	if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// ngrokGuard only lets through requests that name a loopback host, come
+// from outside a browser and carry secret. POSTs must also be JSON, which
+// a cross-site form or text/plain request cannot send without a preflight.
+func ngrokGuard(next http.Handler, secret string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isLoopbackHost(r.Host) {
+			writeNgrokError(w, http.StatusForbidden, ngrokErrInvalidConfig, fmt.Errorf("host %q is not a loopback address", r.Host))
+			return
+		}
+		if r.Header.Get("Origin") != "" {
+			writeNgrokError(w, http.StatusForbidden, ngrokErrInvalidConfig, errors.New("requests from browsers are not allowed"))
+			return
+		}
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if secret == "" || !ok || subtle.ConstantTimeCompare([]byte(token), []byte(secret)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeNgrokError(w, http.StatusUnauthorized, ngrokErrInvalidConfig, errors.New("missing or invalid API secret"))
+			return
+		}
+		if r.Method == http.MethodPost {
+			if mt, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err != nil || mt != "application/json" {
+				writeNgrokError(w, http.StatusUnsupportedMediaType, ngrokErrInvalidConfig, errors.New("content type must be application/json"))
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// isLoopbackHost reports whether a Host header names this machine. Any
+// other name may be an attacker's domain rebound to 127.0.0.1.
+func isLoopbackHost(hostport string) bool {
+	host := hostport
+	if h, _, err := net.SplitHostPort(hostport); err == nil {
+		host = h
+	}
+	host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// handleNgrokList lists the connected tunnels; like ngrok, tunnels still
+// connecting are left out.
+func (s *Server) handleNgrokList(w http.ResponseWriter, _ *http.Request) {
+	list := ngrokTunnelList{Tunnels: []ngrokTunnel{}, URI: "/api/tunnels"}
+	for _, st := range s.tunnels.List() {
+		if st.Connected {
+			list.Tunnels = append(list.Tunnels, toNgrokTunnel(st))
+		}
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (s *Server) handleNgrokGet(w http.ResponseWriter, r *http.Request) {
+	st, ok := s.tunnelStatus(r.PathValue("name"))
+	if !ok || !st.Connected {
+		writeNgrokError(w, http.StatusNotFound, ngrokErrNotFound, fmt.Errorf("tunnel %q not found", r.PathValue("name")))
+		return
+	}
+	writeJSON(w, http.StatusOK, toNgrokTunnel(st))
+}
+
+func (s *Server) handleNgrokStart(defaults TunnelSpec) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req ngrokTunnelRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&req); err != nil {
+			writeNgrokError(w, http.StatusBadRequest, ngrokErrInvalidConfig, fmt.Errorf("invalid request: %w", err))
+			return
+		}
+		spec, err := req.spec(defaults)
+		if err != nil {
+			writeNgrokError(w, http.StatusBadRequest, ngrokErrInvalidConfig, err)
+			return
+		}
+		cfg, err := spec.connectorConfig()
+		if err != nil {
+			writeNgrokError(w, http.StatusBadRequest, ngrokErrInvalidConfig, err)
+			return
+		}
+
+		if !s.tunnels.Add(spec.Name, cfg) {
+			writeNgrokError(w, http.StatusConflict, ngrokErrExists, fmt.Errorf("tunnel %q already exists", spec.Name))
+			return
+		}
+		s.logger.Info("Tunnel added through the ngrok API", zap.String("name", spec.Name), zap.String("type", spec.Type), zap.Int("port", spec.Port))
+
+		// ngrok only answers once the tunnel is up; scripts read
+		// public_url straight from the reply.
+		st, _ := s.waitFirstAttempt(r.Context(), spec.Name)
+		if !st.Connected {
+			s.tunnels.Remove(spec.Name)
+			msg := "timed out connecting"
+			if st.LastError != "" {
+				msg = st.LastError
+			}
+			writeNgrokError(w, http.StatusBadGateway, ngrokErrStartFailed, fmt.Errorf("tunnel %q failed to start: %s", spec.Name, msg))
+			return
+		}
+		writeJSON(w, http.StatusCreated, toNgrokTunnel(st))
+	}
+}
+
+func (s *Server) handleNgrokStop(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if !s.tunnels.Remove(name) {
+		writeNgrokError(w, http.StatusNotFound, ngrokErrNotFound, fmt.Errorf("tunnel %q not found", name))
+		return
+	}
+	s.logger.Info("Tunnel removed through the ngrok API", zap.String("name", name))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) tunnelStatus(name string) (supervisor.Status, bool) {
+	for _, st := range s.tunnels.List() {
+		if st.Name == name {
+			return st, true
+		}
+	}
+	return supervisor.Status{}, false
+}
+
+// spec turns an ngrok tunnel definition into a TunnelSpec. ngrok's "http"
+// covers local HTTPS services when addr says so.
+func (req *ngrokTunnelRequest) spec(defaults TunnelSpec) (TunnelSpec, error) {
+	if req.Addr == "" {
+		return TunnelSpec{}, fmt.Errorf("addr is required")
+	}
+	scheme, host, port, err := parseNgrokAddr(req.Addr)
+	if err != nil {
+		return TunnelSpec{}, err
+	}
+
+	spec := defaults
+	spec.Address = host
+	spec.Port = port
+	spec.Subdomain = req.Subdomain
+	spec.Labels = nil
+
+	switch req.Proto {
+	case "http", "":
+		spec.Type = "http"
+		if scheme == "https" {
+			spec.Type = "https"
+		}
+	case "tcp", "tls":
+		spec.Type = req.Proto
+	default:
+		return TunnelSpec{}, fmt.Errorf("unsupported proto %q: use http, tcp or tls", req.Proto)
+	}
+
+	spec.Name = req.Name
+	if spec.Name == "" {
+		spec.Name = fmt.Sprintf("%s-%d", spec.Type, port)
+	}
+	return spec, nil
+}
+
+// parseNgrokAddr parses ngrok's addr: a port, host:port or URL.
+func parseNgrokAddr(addr string) (scheme, host string, port int, err error) {
+	hostPort := addr
+	if strings.Contains(addr, "://") {
+		u, perr := url.Parse(addr)
+		if perr != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return "", "", 0, fmt.Errorf("invalid addr %q", addr)
+		}
+		scheme, hostPort = u.Scheme, u.Host
+		if u.Port() == "" {
+			hostPort = net.JoinHostPort(u.Hostname(), map[string]string{"http": "80", "https": "443"}[u.Scheme])
+		}
+	} else if !strings.Contains(addr, ":") {
+		hostPort = net.JoinHostPort("127.0.0.1", addr)
+	}
+
+	host, portStr, err := net.SplitHostPort(hostPort)
+	if err != nil {
+		return "", "", 0, fmt.Errorf("invalid addr %q", addr)
+	}
+	port, err = strconv.Atoi(portStr)
+	if err != nil || port < 1 || port > 65535 {
+		return "", "", 0, fmt.Errorf("invalid port in addr %q", addr)
+	}
+	if host == "" || host == "localhost" {
+		host = "127.0.0.1"
+	}
+	return scheme, host, port, nil
+}
+
+func toNgrokTunnel(st supervisor.Status) ngrokTunnel {
+	t := ngrokTunnel{
+		Name:      st.Name,
+		URI:       "/api/tunnels/" + url.PathEscape(st.Name),
+		PublicURL: st.URL,
+		Proto:     st.Type,
+		Config:    ngrokTunnelConfig{Addr: st.Local},
+	}
+	if st.Type == "http" || st.Type == "https" {
+		// proto is the public URL's scheme, which is https for both.
+		t.Proto = "https"
+		t.Config.Addr = st.Type + "://" + st.Local
+	}
+	return t
+}
+
+func writeNgrokError(w http.ResponseWriter, status, code int, err error) {
+	writeJSON(w, status, ngrokError{
+		ErrorCode:  code,
+		StatusCode: status,
+		Msg:        http.StatusText(status),
+		Details:    map[string]string{"err": err.Error()},
+	})
+}
@@ -0,0 +1,122 @@
+package control
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"drip/internal/client/supervisor"
+
+	"go.uber.org/zap"
+)
+
+func TestNgrokTunnelSpec(t *testing.T) {
+	defaults := TunnelSpec{Server: "tunnel.example.com:443", Token: "secret"}
+
+	tests := []struct {
+		req     ngrokTunnelRequest
+		want    string // name type address:port
+		wantErr bool
+	}{
+		{ngrokTunnelRequest{Addr: "3000", Proto: "http"}, "http-3000 http 127.0.0.1:3000", false},
+		{ngrokTunnelRequest{Name: "web", Addr: "localhost:8080"}, "web http 127.0.0.1:8080", false},
+		{ngrokTunnelRequest{Name: "api", Addr: "https://10.0.0.5", Proto: "http"}, "api https 10.0.0.5:443", false},
+		{ngrokTunnelRequest{Name: "db", Addr: "5432", Proto: "tcp"}, "db tcp 127.0.0.1:5432", false},
+		{ngrokTunnelRequest{Addr: "8443", Proto: "tls"}, "tls-8443 tls 127.0.0.1:8443", false},
+		{ngrokTunnelRequest{Addr: "3000", Proto: "udp"}, "", true},
+		{ngrokTunnelRequest{Addr: "ftp://localhost:21", Proto: "http"}, "", true},
+		{ngrokTunnelRequest{Addr: "99999", Proto: "http"}, "", true},
+		{ngrokTunnelRequest{Proto: "http"}, "", true},
+	}
+	for _, tt := range tests {
+		spec, err := tt.req.spec(defaults)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("spec(%+v) error = %v, wantErr %v", tt.req, err, tt.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		got := fmt.Sprintf("%s %s %s:%d", spec.Name, spec.Type, spec.Address, spec.Port)
+		if got != tt.want {
+			t.Errorf("spec(%+v) = %q, want %q", tt.req, got, tt.want)
+		}
+		if spec.Server != defaults.Server || spec.Token != defaults.Token {
+			t.Errorf("spec(%+v) did not keep the default server settings", tt.req)
+		}
+	}
+}
+
+func TestNgrokHandler(t *testing.T) {
+	tunnels := supervisor.New(zap.NewNop())
+	defer tunnels.Close()
+	h := NewServer(tunnels, func() {}, zap.NewNop()).NgrokHandler(TunnelSpec{Server: "127.0.0.1:1"}, "s3cret")
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		want   int
+	}{
+		{"list", http.MethodGet, "/api/tunnels", "", http.StatusOK},
+		// Nothing listens on port 1, so the tunnel fails to start.
+		{"start unreachable", http.MethodPost, "/api/tunnels", `{"name":"web","addr":"3000","proto":"http"}`, http.StatusBadGateway},
+		{"start udp", http.MethodPost, "/api/tunnels", `{"name":"web","addr":"3000","proto":"udp"}`, http.StatusBadRequest},
+		{"get missing", http.MethodGet, "/api/tunnels/web", "", http.StatusNotFound},
+		{"stop missing", http.MethodDelete, "/api/tunnels/web", "", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+		req.Host = "127.0.0.1:4040"
+		req.Header.Set("Authorization", "Bearer s3cret")
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d (%s)", tt.name, rec.Code, tt.want, rec.Body.String())
+		}
+	}
+
+	if names := tunnels.Names(); len(names) != 0 {
+		t.Errorf("Names() = %v, want a tunnel that failed to start removed", names)
+	}
+}
+
+func TestNgrokHandlerRejectsUntrustedRequests(t *testing.T) {
+	tunnels := supervisor.New(zap.NewNop())
+	defer tunnels.Close()
+	h := NewServer(tunnels, func() {}, zap.NewNop()).NgrokHandler(TunnelSpec{Server: "127.0.0.1:1"}, "s3cret")
+
+	body := `{"name":"web","addr":"3000","proto":"http"}`
+	tests := []struct {
+		name   string
+		header map[string]string
+		host   string
+		want   int
+	}{
+		{"no secret", map[string]string{"Content-Type": "application/json"}, "127.0.0.1:4040", http.StatusUnauthorized},
+		{"wrong secret", map[string]string{"Authorization": "Bearer nope", "Content-Type": "application/json"}, "127.0.0.1:4040", http.StatusUnauthorized},
+		{"rebound host", map[string]string{"Authorization": "Bearer s3cret", "Content-Type": "application/json"}, "evil.example.com:4040", http.StatusForbidden},
+		{"browser origin", map[string]string{"Authorization": "Bearer s3cret", "Content-Type": "application/json", "Origin": "https://evil.example.com"}, "localhost:4040", http.StatusForbidden},
+		{"text/plain", map[string]string{"Authorization": "Bearer s3cret", "Content-Type": "text/plain"}, "[::1]:4040", http.StatusUnsupportedMediaType},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/api/tunnels", strings.NewReader(body))
+		req.Host = tt.host
+		for k, v := range tt.header {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d (%s)", tt.name, rec.Code, tt.want, rec.Body.String())
+		}
+	}
+
+	if names := tunnels.Names(); len(names) != 0 {
+		t.Errorf("Names() = %v, want no tunnel started", names)
+	}
+}
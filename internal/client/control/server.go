@@ -0,0 +1,293 @@
+// Package control is the API of the multi-tunnel daemon. The daemon serves
+// HTTP with JSON bodies on a unix socket that only the owning user can
+// reach; 'drip add', 'drip rm' and 'drip list' are its clients.
+package control
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"drip/internal/client/supervisor"
+	"drip/internal/client/tcp"
+	"drip/internal/shared/httputil"
+	"drip/internal/shared/labels"
+	"drip/internal/shared/protocol"
+
+	json "github.com/goccy/go-json"
+	"go.uber.org/zap"
+)
+
+// connectWait bounds how long an add request waits for the first
+// connection attempt to succeed or fail.
+const connectWait = 15 * time.Second
+
+// TunnelSpec is a tunnel to add. The server settings are resolved by the
+// calling command, so one daemon can serve tunnels to different servers.
+type TunnelSpec struct {
+	Name      string `json:"name"`
+	Type      string `json:"type"`
+	Port      int    `json:"port"`
+	Address   string `json:"address,omitempty"`
+	Subdomain string `json:"subdomain,omitempty"`
+
+	Labels map[string]string `json:"labels,omitempty"`
+
+	Server            string `json:"server"`
+	Token             string `json:"token,omitempty"`
+	Insecure          bool   `json:"insecure,omitempty"`
+	ServerFingerprint string `json:"server_fingerprint,omitempty"`
+}
+
+// PauseResult is the reply to a pause or resume request.
+type PauseResult struct {
+	Paused  bool   `json:"paused"`
+	Warning string `json:"warning,omitempty"`
+}
+
+// RulesSpec replaces the request filtering rules of a tunnel. Rules use
+// the compact syntax of --rule, e.g. "deny path=/wp-admin"; none clears
+// them.
+type RulesSpec struct {
+	Rules []string `json:"rules"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// Server handles control requests for a supervisor.
+type Server struct {
+	tunnels  *supervisor.Supervisor
+	logger   *zap.Logger
+	shutdown func()
+}
+
+// NewServer creates a control server. shutdown is called when a client
+// asks the daemon to exit.
+func NewServer(tunnels *supervisor.Supervisor, shutdown func(), logger *zap.Logger) *Server {
+	return &Server{tunnels: tunnels, logger: logger, shutdown: shutdown}
+}
+
+// Handler returns the HTTP handler for the control API.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /tunnels", s.handleList)
+	mux.HandleFunc("POST /tunnels", s.handleAdd)
+	mux.HandleFunc("DELETE /tunnels/{name}", s.handleRemove)
+	mux.HandleFunc("POST /tunnels/{name}/pause", s.handlePause(true))
+	mux.HandleFunc("POST /tunnels/{name}/resume", s.handlePause(false))
+	mux.HandleFunc("PUT /tunnels/{name}/rules", s.handleRules)
+	mux.HandleFunc("POST /shutdown", s.handleShutdown)
+	return mux
+}
+
+// Listen opens the control socket at path, replacing a stale socket left by
+// a daemon that did not shut down cleanly.
+func Listen(path string) (net.Listener, error) {
+	if err := NewClient(path).Ping(); err == nil {
+		return nil, fmt.Errorf("daemon is already running (%s)", path)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	_ = os.Remove(path)
+
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", path, err)
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
+
+// Serve serves the control API on ln until ctx is done.
+func (s *Server) Serve(ctx context.Context, ln net.Listener) error {
+	srv := &http.Server{Handler: s.Handler(), ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		<-ctx.Done()
+		_ = srv.Close()
+	}()
+	if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+func (s *Server) handleList(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, s.tunnels.List())
+}
+
+func (s *Server) handleAdd(w http.ResponseWriter, r *http.Request) {
+	var spec TunnelSpec
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&spec); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request: %w", err))
+		return
+	}
+	cfg, err := spec.connectorConfig()
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if !s.tunnels.Add(spec.Name, cfg) {
+		writeError(w, http.StatusConflict, fmt.Errorf("tunnel %q already exists", spec.Name))
+		return
+	}
+	s.logger.Info("Tunnel added", zap.String("name", spec.Name), zap.String("type", spec.Type), zap.Int("port", spec.Port))
+
+	st, _ := s.waitFirstAttempt(r.Context(), spec.Name)
+	writeJSON(w, http.StatusCreated, st)
+}
+
+// waitFirstAttempt polls until the tunnel has connected or failed once, so
+// 'drip add' can print the URL or the error.
+func (s *Server) waitFirstAttempt(ctx context.Context, name string) (supervisor.Status, bool) {
+	ctx, cancel := context.WithTimeout(ctx, connectWait)
+	defer cancel()
+
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	var st supervisor.Status
+	for {
+		var found bool
+		for _, t := range s.tunnels.List() {
+			if t.Name == name {
+				st, found = t, true
+			}
+		}
+		if !found || st.Connected || st.LastError != "" {
+			return st, found
+		}
+		select {
+		case <-ctx.Done():
+			return st, found
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Server) handleRemove(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if !s.tunnels.Remove(name) {
+		writeError(w, http.StatusNotFound, fmt.Errorf("tunnel %q not found", name))
+		return
+	}
+	s.logger.Info("Tunnel removed", zap.String("name", name))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlePause answers requests to pause or resume a tunnel. The tunnel is
+// paused even if the server could not be told; the reply carries the
+// reason as a warning.
+func (s *Server) handlePause(paused bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("name")
+		found, err := s.tunnels.SetPaused(name, paused)
+		if !found {
+			writeError(w, http.StatusNotFound, fmt.Errorf("tunnel %q not found", name))
+			return
+		}
+		resp := PauseResult{Paused: paused}
+		if err != nil {
+			resp.Warning = err.Error()
+		}
+		s.logger.Info("Tunnel pause changed", zap.String("name", name), zap.Bool("paused", paused), zap.Error(err))
+		writeJSON(w, http.StatusOK, resp)
+	}
+}
+
+// handleRules replaces the request filtering rules of a tunnel. A
+// connected tunnel sends them to the server right away; one that is not
+// uses them when it next connects.
+func (s *Server) handleRules(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	var spec RulesSpec
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&spec); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request: %w", err))
+		return
+	}
+	rules, err := httputil.ParseRequestRules(spec.Rules)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	found, err := s.tunnels.SetRequestRules(name, rules)
+	if !found {
+		writeError(w, http.StatusNotFound, fmt.Errorf("tunnel %q not found", name))
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err)
+		return
+	}
+	s.logger.Info("Request rules replaced", zap.String("name", name), zap.Int("rules", len(rules)))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleShutdown(w http.ResponseWriter, _ *http.Request) {
+	w.WriteHeader(http.StatusAccepted)
+	go s.shutdown()
+}
+
+func (spec *TunnelSpec) connectorConfig() (tcp.ConnectorConfig, error) {
+	if spec.Name == "" || strings.ContainsAny(spec.Name, "/ \t") {
+		return tcp.ConnectorConfig{}, fmt.Errorf("invalid tunnel name %q", spec.Name)
+	}
+	if spec.Server == "" {
+		return tcp.ConnectorConfig{}, fmt.Errorf("server address is required")
+	}
+	if spec.Port < 1 || spec.Port > 65535 {
+		return tcp.ConnectorConfig{}, fmt.Errorf("invalid port %d", spec.Port)
+	}
+	if err := labels.Validate(spec.Labels); err != nil {
+		return tcp.ConnectorConfig{}, err
+	}
+
+	var tunnelType protocol.TunnelType
+	switch spec.Type {
+	case "http":
+		tunnelType = protocol.TunnelTypeHTTP
+	case "https":
+		tunnelType = protocol.TunnelTypeHTTPS
+	case "tcp":
+		tunnelType = protocol.TunnelTypeTCP
+	case "tls":
+		tunnelType = protocol.TunnelTypeTLS
+	default:
+		return tcp.ConnectorConfig{}, fmt.Errorf("invalid tunnel type %q", spec.Type)
+	}
+
+	return tcp.ConnectorConfig{
+		ServerAddr:        spec.Server,
+		Token:             spec.Token,
+		TunnelType:        tunnelType,
+		LocalHost:         spec.Address,
+		LocalPort:         spec.Port,
+		Subdomain:         spec.Subdomain,
+		Labels:            spec.Labels,
+		Insecure:          spec.Insecure,
+		ServerFingerprint: spec.ServerFingerprint,
+	}, nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, errorResponse{Error: err.Error()})
+}
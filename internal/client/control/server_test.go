@@ -0,0 +1,53 @@
+package control
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"drip/internal/client/supervisor"
+
+	"go.uber.org/zap"
+)
+
+func TestServerAddRemove(t *testing.T) {
+	tunnels := supervisor.New(zap.NewNop())
+	defer tunnels.Close()
+	h := NewServer(tunnels, func() {}, zap.NewNop()).Handler()
+
+	// Nothing listens on port 1, so the first attempt fails quickly.
+	const api = `{"name":"api","type":"http","port":3000,"server":"127.0.0.1:1"}`
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		want   int
+	}{
+		{"add", http.MethodPost, "/tunnels", api, http.StatusCreated},
+		{"add duplicate", http.MethodPost, "/tunnels", api, http.StatusConflict},
+		{"bad type", http.MethodPost, "/tunnels", `{"name":"x","type":"udp","port":53,"server":"127.0.0.1:1"}`, http.StatusBadRequest},
+		{"bad name", http.MethodPost, "/tunnels", `{"name":"a/b","type":"tcp","port":53,"server":"127.0.0.1:1"}`, http.StatusBadRequest},
+		{"list", http.MethodGet, "/tunnels", "", http.StatusOK},
+		{"rules", http.MethodPut, "/tunnels/api/rules", `{"rules":["deny path=/wp-admin"]}`, http.StatusNoContent},
+		{"bad rule", http.MethodPut, "/tunnels/api/rules", `{"rules":["block /wp-admin"]}`, http.StatusBadRequest},
+		{"rules missing", http.MethodPut, "/tunnels/web/rules", `{"rules":[]}`, http.StatusNotFound},
+		{"remove", http.MethodDelete, "/tunnels/api", "", http.StatusNoContent},
+		{"remove missing", http.MethodDelete, "/tunnels/api", "", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d (%s)", tt.name, rec.Code, tt.want, rec.Body.String())
+		}
+	}
+
+	if names := tunnels.Names(); len(names) != 0 {
+		t.Errorf("Names() = %v after remove, want none", names)
+	}
+}
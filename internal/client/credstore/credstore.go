@@ -0,0 +1,29 @@
+// Package credstore keeps auth tokens in the operating system's credential
+// store: the Keychain on macOS, the Secret Service (GNOME Keyring, KWallet)
+// on Linux and DPAPI-encrypted files on Windows. Tokens are stored per
+// server address.
+package credstore
+
+import "errors"
+
+// service is the name tokens are filed under in the credential store.
+const service = "drip"
+
+var (
+	// ErrNotFound is returned when no token is stored for the server.
+	ErrNotFound = errors.New("no token stored for this server")
+
+	// ErrUnavailable is returned when the platform store cannot be used,
+	// e.g. on a headless Linux machine without a Secret Service.
+	ErrUnavailable = errors.New("no system credential store available")
+)
+
+// Store saves secrets by account, which is the server address.
+type Store interface {
+	Get(account string) (string, error)
+	Set(account, secret string) error
+	Delete(account string) error
+
+	// Name describes the backend for status output.
+	Name() string
+}
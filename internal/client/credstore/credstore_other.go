@@ -0,0 +1,8 @@
+//go:build !linux && !darwin && !windows
+
+package credstore
+
+// New reports that this platform has no supported credential store.
+func New() (Store, error) {
+	return nil, ErrUnavailable
+}
@@ -0,0 +1,101 @@
+//go:build windows
+
+package credstore
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// dpapi keeps each token in a file encrypted with DPAPI, which ties it to
+// the current Windows user account.
+type dpapi struct {
+	dir string
+}
+
+// New returns the DPAPI store under %USERPROFILE%\.drip\credentials.
+func New() (Store, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, ErrUnavailable
+	}
+	return dpapi{dir: filepath.Join(home, ".drip", "credentials")}, nil
+}
+
+func (dpapi) Name() string { return "Windows DPAPI" }
+
+func (d dpapi) path(account string) string {
+	sum := sha256.Sum256([]byte(account))
+	return filepath.Join(d.dir, hex.EncodeToString(sum[:8])+".dpapi")
+}
+
+func (d dpapi) Get(account string) (string, error) {
+	data, err := os.ReadFile(d.path(account))
+	if os.IsNotExist(err) {
+		return "", ErrNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	plain, err := unprotect(data)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt token: %w", err)
+	}
+	return string(plain), nil
+}
+
+func (d dpapi) Set(account, secret string) error {
+	data, err := protect([]byte(secret))
+	if err != nil {
+		return fmt.Errorf("failed to encrypt token: %w", err)
+	}
+	if err := os.MkdirAll(d.dir, 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(d.path(account), data, 0600)
+}
+
+func (d dpapi) Delete(account string) error {
+	err := os.Remove(d.path(account))
+	if os.IsNotExist(err) {
+		return ErrNotFound
+	}
+	return err
+}
+
+func protect(plain []byte) ([]byte, error) {
+	var out windows.DataBlob
+	err := windows.CryptProtectData(blob(plain), nil, nil, 0, nil, windows.CRYPTPROTECT_UI_FORBIDDEN, &out)
+	if err != nil {
+		return nil, err
+	}
+	return takeBlob(&out), nil
+}
+
+func unprotect(data []byte) ([]byte, error) {
+	var out windows.DataBlob
+	err := windows.CryptUnprotectData(blob(data), nil, nil, 0, nil, windows.CRYPTPROTECT_UI_FORBIDDEN, &out)
+	if err != nil {
+		return nil, err
+	}
+	return takeBlob(&out), nil
+}
+
+func blob(b []byte) *windows.DataBlob {
+	if len(b) == 0 {
+		return &windows.DataBlob{}
+	}
+	return &windows.DataBlob{Size: uint32(len(b)), Data: &b[0]}
+}
+
+// takeBlob copies a DPAPI result into Go memory and frees it.
+func takeBlob(b *windows.DataBlob) []byte {
+	defer windows.LocalFree(windows.Handle(unsafe.Pointer(b.Data)))
+	return append([]byte(nil), unsafe.Slice(b.Data, b.Size)...)
+}
@@ -0,0 +1,69 @@
+//go:build darwin
+
+package credstore
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// keychain uses the security(1) tool so drip needs no cgo.
+type keychain struct{}
+
+// New returns the login Keychain.
+func New() (Store, error) {
+	if _, err := exec.LookPath("security"); err != nil {
+		return nil, ErrUnavailable
+	}
+	return keychain{}, nil
+}
+
+func (keychain) Name() string { return "macOS Keychain" }
+
+func (keychain) Get(account string) (string, error) {
+	out, err := exec.Command("security", "find-generic-password", "-s", service, "-a", account, "-w").Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		// 44 is errSecItemNotFound.
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == 44 {
+			return "", ErrNotFound
+		}
+		return "", fmt.Errorf("failed to read from Keychain: %w", err)
+	}
+	return strings.TrimSuffix(string(out), "\n"), nil
+}
+
+// Set passes the command on stdin ('security -i') so the token never shows
+// up in the process list.
+func (keychain) Set(account, secret string) error {
+	cmd := exec.Command("security", "-i")
+	cmd.Stdin = strings.NewReader(fmt.Sprintf("add-generic-password -U -s %s -a %s -w %s\n",
+		quote(service), quote(account), quote(secret)))
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil || stderr.Len() > 0 {
+		return fmt.Errorf("failed to write to Keychain: %v %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+func (keychain) Delete(account string) error {
+	out, err := exec.Command("security", "delete-generic-password", "-s", service, "-a", account).CombinedOutput()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == 44 {
+			return ErrNotFound
+		}
+		return fmt.Errorf("failed to delete from Keychain: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+func quote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return `"` + s + `"`
+}
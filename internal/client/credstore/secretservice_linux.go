@@ -0,0 +1,65 @@
+//go:build linux
+
+package credstore
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// secretService uses secret-tool(1) from libsecret, which talks to GNOME
+// Keyring, KWallet or any other Secret Service provider.
+type secretService struct{}
+
+// New returns the Secret Service store. It needs secret-tool and a D-Bus
+// session, which headless machines usually lack.
+func New() (Store, error) {
+	if _, err := exec.LookPath("secret-tool"); err != nil {
+		return nil, ErrUnavailable
+	}
+	if os.Getenv("DBUS_SESSION_BUS_ADDRESS") == "" {
+		return nil, ErrUnavailable
+	}
+	return secretService{}, nil
+}
+
+func (secretService) Name() string { return "Secret Service" }
+
+func (secretService) Get(account string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("secret-tool", "lookup", "service", service, "account", account)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	// secret-tool exits 1 without output when nothing matches.
+	if stdout.Len() == 0 && stderr.Len() == 0 {
+		return "", ErrNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read from Secret Service: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSuffix(stdout.String(), "\n"), nil
+}
+
+func (secretService) Set(account, secret string) error {
+	cmd := exec.Command("secret-tool", "store", "--label=drip token ("+account+")", "service", service, "account", account)
+	cmd.Stdin = strings.NewReader(secret)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to write to Secret Service: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+func (s secretService) Delete(account string) error {
+	if _, err := s.Get(account); err != nil {
+		return err
+	}
+	out, err := exec.Command("secret-tool", "clear", "service", service, "account", account).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to delete from Secret Service: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
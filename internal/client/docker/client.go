@@ -0,0 +1,126 @@
+// Package docker exposes the ports of a running container through drip
+// tunnels. It talks to the Docker Engine API directly so the client binary
+// does not need the Docker SDK.
+package docker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	json "github.com/goccy/go-json"
+)
+
+const (
+	defaultHost = "unix:///var/run/docker.sock"
+	apiTimeout  = 10 * time.Second
+	maxBody     = 8 << 20
+)
+
+// ErrNotFound is returned when the container does not exist.
+var ErrNotFound = errors.New("container not found")
+
+// PortBinding is a host address a container port is published on.
+type PortBinding struct {
+	HostIP   string `json:"HostIp"`
+	HostPort string `json:"HostPort"`
+}
+
+// Container is the subset of 'docker inspect' output the watcher reads.
+type Container struct {
+	ID    string `json:"Id"`
+	Name  string `json:"Name"`
+	State struct {
+		Running bool `json:"Running"`
+	} `json:"State"`
+	Config struct {
+		ExposedPorts map[string]struct{} `json:"ExposedPorts"`
+	} `json:"Config"`
+	NetworkSettings struct {
+		IPAddress string                   `json:"IPAddress"`
+		Ports     map[string][]PortBinding `json:"Ports"`
+		Networks  map[string]struct {
+			IPAddress string `json:"IPAddress"`
+		} `json:"Networks"`
+	} `json:"NetworkSettings"`
+}
+
+// Client talks to the Docker Engine API.
+type Client struct {
+	http *http.Client
+}
+
+// NewClient connects to host, a DOCKER_HOST style address. An empty host
+// uses $DOCKER_HOST and then the default unix socket. Only unix:// and
+// unencrypted tcp:// endpoints are supported.
+func NewClient(host string) (*Client, error) {
+	if host == "" {
+		host = os.Getenv("DOCKER_HOST")
+	}
+	if host == "" {
+		host = defaultHost
+	}
+
+	u, err := url.Parse(host)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Docker host %q", host)
+	}
+
+	var network, addr string
+	switch u.Scheme {
+	case "unix":
+		network, addr = "unix", u.Path
+	case "tcp":
+		network, addr = "tcp", u.Host
+	default:
+		return nil, fmt.Errorf("unsupported Docker host %q: only unix:// and tcp:// are supported", host)
+	}
+
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		},
+	}
+	return &Client{http: &http.Client{Timeout: apiTimeout, Transport: transport}}, nil
+}
+
+// Inspect returns the container with the given name or ID.
+func (c *Client) Inspect(ctx context.Context, name string) (*Container, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://docker/containers/"+url.PathEscape(name)+"/json", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach Docker: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBody))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read container info: %w", err)
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, ErrNotFound
+	default:
+		return nil, fmt.Errorf("failed to inspect container: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	var ctr Container
+	if err := json.Unmarshal(body, &ctr); err != nil {
+		return nil, fmt.Errorf("failed to parse container info: %w", err)
+	}
+	ctr.Name = strings.TrimPrefix(ctr.Name, "/")
+	return &ctr, nil
+}
@@ -0,0 +1,209 @@
+package docker
+
+import (
+	"context"
+	"errors"
+	"net"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"drip/internal/client/supervisor"
+	"drip/internal/client/tcp"
+
+	"go.uber.org/zap"
+)
+
+// DefaultInterval is how often the watcher inspects the container.
+const DefaultInterval = 5 * time.Second
+
+// target is one container port and the address the client reaches it on.
+type target struct {
+	containerPort int
+	host          string
+	port          int
+}
+
+// Watcher keeps one tunnel per port of a container while it runs.
+type Watcher struct {
+	client    *Client
+	container string
+	ports     []int
+	interval  time.Duration
+	base      tcp.ConnectorConfig
+	tunnels   *supervisor.Supervisor
+	logger    *zap.Logger
+
+	skipped []int // last warned about, so each tick does not repeat it
+}
+
+// NewWatcher creates a watcher for container. ports limits the tunnels to
+// those container ports; empty means every TCP port. base carries the server
+// settings and tunnel type shared by every tunnel.
+func NewWatcher(client *Client, container string, ports []int, interval time.Duration, base tcp.ConnectorConfig, tunnels *supervisor.Supervisor, logger *zap.Logger) *Watcher {
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	return &Watcher{
+		client:    client,
+		container: container,
+		ports:     ports,
+		interval:  interval,
+		base:      base,
+		tunnels:   tunnels,
+		logger:    logger,
+	}
+}
+
+// Run syncs tunnels until ctx is done. Tunnels are closed while the
+// container is stopped and reopened when it starts again. Run returns
+// ErrNotFound once the container is removed.
+func (w *Watcher) Run(ctx context.Context) error {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := w.sync(ctx); err != nil {
+			if errors.Is(err, ErrNotFound) {
+				w.removeAll()
+				return err
+			}
+			if ctx.Err() == nil {
+				w.logger.Warn("Failed to inspect container", zap.String("container", w.container), zap.Error(err))
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (w *Watcher) sync(ctx context.Context) error {
+	ctr, err := w.client.Inspect(ctx, w.container)
+	if err != nil {
+		return err
+	}
+
+	if !ctr.State.Running {
+		if len(w.tunnels.Names()) > 0 {
+			w.logger.Info("Container stopped, closing tunnels", zap.String("container", ctr.Name))
+			w.removeAll()
+		}
+		return nil
+	}
+
+	targets, skipped := containerTargets(ctr, w.ports)
+	if !slices.Equal(skipped, w.skipped) {
+		for _, port := range skipped {
+			w.logger.Warn("Port is neither published nor reachable on a container IP",
+				zap.String("container", ctr.Name), zap.Int("port", port))
+		}
+		w.skipped = skipped
+	}
+
+	desired := make(map[string]tcp.ConnectorConfig, len(targets))
+	for _, t := range targets {
+		cfg := w.base
+		cfg.LocalHost = t.host
+		cfg.LocalPort = t.port
+		desired[ctr.Name+":"+strconv.Itoa(t.containerPort)] = cfg
+	}
+
+	for name, cfg := range desired {
+		w.tunnels.Set(name, cfg)
+	}
+	for _, name := range w.tunnels.Names() {
+		if _, ok := desired[name]; !ok {
+			w.tunnels.Remove(name)
+		}
+	}
+	return nil
+}
+
+func (w *Watcher) removeAll() {
+	for _, name := range w.tunnels.Names() {
+		w.tunnels.Remove(name)
+	}
+}
+
+// containerTargets lists the TCP ports of ctr and how to reach each one.
+// Published ports go through the host binding; exposed-only ports use the
+// container's IP, which works when drip runs on the Docker host or on the
+// same network. Ports with neither are returned in skipped.
+func containerTargets(ctr *Container, only []int) (targets []target, skipped []int) {
+	ports := make(map[int][]PortBinding)
+	for spec := range ctr.Config.ExposedPorts {
+		if port, ok := tcpPort(spec); ok {
+			ports[port] = nil
+		}
+	}
+	for spec, bindings := range ctr.NetworkSettings.Ports {
+		if port, ok := tcpPort(spec); ok {
+			ports[port] = bindings
+		}
+	}
+
+	containerIP := ctr.NetworkSettings.IPAddress
+	if containerIP == "" {
+		names := make([]string, 0, len(ctr.NetworkSettings.Networks))
+		for name := range ctr.NetworkSettings.Networks {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if ip := ctr.NetworkSettings.Networks[name].IPAddress; ip != "" {
+				containerIP = ip
+				break
+			}
+		}
+	}
+
+	for port, bindings := range ports {
+		if len(only) > 0 && !slices.Contains(only, port) {
+			continue
+		}
+		if t, ok := publishedTarget(port, bindings); ok {
+			targets = append(targets, t)
+		} else if containerIP != "" {
+			targets = append(targets, target{containerPort: port, host: containerIP, port: port})
+		} else {
+			skipped = append(skipped, port)
+		}
+	}
+
+	sort.Slice(targets, func(i, j int) bool { return targets[i].containerPort < targets[j].containerPort })
+	sort.Ints(skipped)
+	return targets, skipped
+}
+
+func publishedTarget(port int, bindings []PortBinding) (target, bool) {
+	for _, b := range bindings {
+		hostPort, err := strconv.Atoi(b.HostPort)
+		if err != nil || hostPort <= 0 {
+			continue
+		}
+		host := b.HostIP
+		if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+			host = "127.0.0.1"
+		}
+		return target{containerPort: port, host: host, port: hostPort}, true
+	}
+	return target{}, false
+}
+
+// tcpPort parses a Docker port spec such as "80/tcp".
+func tcpPort(spec string) (int, bool) {
+	num, proto, _ := strings.Cut(spec, "/")
+	if proto != "" && proto != "tcp" {
+		return 0, false
+	}
+	port, err := strconv.Atoi(num)
+	if err != nil || port <= 0 || port > 65535 {
+		return 0, false
+	}
+	return port, true
+}
@@ -0,0 +1,67 @@
+package docker
+
+import (
+	"reflect"
+	"testing"
+
+	json "github.com/goccy/go-json"
+)
+
+const inspectJSON = `{
+ "Id": "abc", "Name": "/web", "State": {"Running": true},
+ "Config": {"ExposedPorts": {"80/tcp": {}, "443/tcp": {}, "53/udp": {}, "9000/tcp": {}}},
+ "NetworkSettings": {
+  "IPAddress": "",
+  "Ports": {
+   "80/tcp": [{"HostIp": "0.0.0.0", "HostPort": "8080"}, {"HostIp": "::", "HostPort": "8080"}],
+   "443/tcp": [{"HostIp": "192.168.1.5", "HostPort": "8443"}],
+   "9000/tcp": null,
+   "53/udp": [{"HostIp": "0.0.0.0", "HostPort": "5353"}]
+  },
+  "Networks": {"bridge": {"IPAddress": "172.17.0.2"}}
+ }
+}`
+
+func TestContainerTargets(t *testing.T) {
+	var ctr Container
+	if err := json.Unmarshal([]byte(inspectJSON), &ctr); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		only []int
+		want []target
+	}{
+		{
+			name: "all ports",
+			want: []target{
+				{containerPort: 80, host: "127.0.0.1", port: 8080},
+				{containerPort: 443, host: "192.168.1.5", port: 8443},
+				{containerPort: 9000, host: "172.17.0.2", port: 9000},
+			},
+		},
+		{
+			name: "filtered",
+			only: []int{443, 53},
+			want: []target{{containerPort: 443, host: "192.168.1.5", port: 8443}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, skipped := containerTargets(&ctr, tt.only)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("containerTargets() = %+v, want %+v", got, tt.want)
+			}
+			if len(skipped) != 0 {
+				t.Errorf("skipped = %v, want none", skipped)
+			}
+		})
+	}
+
+	ctr.NetworkSettings.Networks = nil
+	if _, skipped := containerTargets(&ctr, nil); !reflect.DeepEqual(skipped, []int{9000}) {
+		t.Errorf("skipped without a container IP = %v, want [9000]", skipped)
+	}
+}
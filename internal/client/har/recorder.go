@@ -0,0 +1,333 @@
+package har
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	json "github.com/goccy/go-json"
+)
+
+// flushInterval is how often new entries are written out, so an archive
+// is useful even if the client is killed rather than stopped.
+const flushInterval = time.Second
+
+// Recorder collects entries and keeps the archive at its path up to date.
+type Recorder struct {
+	path    string
+	creator Creator
+	maxBody int64
+
+	mu      sync.Mutex
+	entries []Entry
+	dirty   bool
+
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewRecorder creates the archive at path and starts recording into it.
+// Bodies are kept up to maxBody bytes each; 0 records no bodies.
+// version is written as the creator version.
+func NewRecorder(path string, maxBody int64, version string) (*Recorder, error) {
+	r := &Recorder{
+		path:    path,
+		creator: Creator{Name: "drip", Version: version},
+		maxBody: max(maxBody, 0),
+		entries: []Entry{},
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	// Write the empty archive now so a bad path fails at startup.
+	if err := r.write(); err != nil {
+		return nil, err
+	}
+	go r.flushLoop()
+	return r, nil
+}
+
+// Path returns where the archive is written.
+func (r *Recorder) Path() string {
+	return r.path
+}
+
+// Len returns the number of recorded entries.
+func (r *Recorder) Len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.entries)
+}
+
+// Close stops recording and writes the final archive.
+func (r *Recorder) Close() error {
+	var err error
+	r.closeOnce.Do(func() {
+		close(r.stop)
+		<-r.done
+		err = r.flush()
+	})
+	return err
+}
+
+func (r *Recorder) add(e Entry) {
+	r.mu.Lock()
+	r.entries = append(r.entries, e)
+	r.dirty = true
+	r.mu.Unlock()
+}
+
+func (r *Recorder) flushLoop() {
+	defer close(r.done)
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			_ = r.flush()
+		case <-r.stop:
+			return
+		}
+	}
+}
+
+func (r *Recorder) flush() error {
+	r.mu.Lock()
+	dirty := r.dirty
+	r.dirty = false
+	r.mu.Unlock()
+	if !dirty {
+		return nil
+	}
+	return r.write()
+}
+
+// write replaces the archive with the current entries through a temporary
+// file, so readers never see a half-written document.
+func (r *Recorder) write() error {
+	r.mu.Lock()
+	data, err := json.MarshalIndent(File{Log: Log{
+		Version: "1.2",
+		Creator: r.creator,
+		Entries: r.entries,
+	}}, "", "  ")
+	r.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(r.path), filepath.Base(r.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to write HAR file: %w", err)
+	}
+	_, err = tmp.Write(data)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), r.path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write HAR file: %w", err)
+	}
+	return nil
+}
+
+// Transport wraps next so that every round trip is recorded. An entry is
+// added once the response body has been read or closed.
+func (r *Recorder) Transport(next http.RoundTripper) http.RoundTripper {
+	return &transport{recorder: r, next: next}
+}
+
+type transport struct {
+	recorder *Recorder
+	next     http.RoundTripper
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+
+	reqBody := &capture{limit: t.recorder.maxBody}
+	if req.Body != nil && req.Body != http.NoBody {
+		req = req.Clone(req.Context())
+		req.Body = &teeBody{ReadCloser: req.Body, capture: reqBody}
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	wait := time.Since(start)
+	if err != nil {
+		e := newEntry(req, reqBody, start)
+		e.Response.Comment = err.Error()
+		e.Time = milliseconds(wait)
+		e.Timings.Wait = e.Time
+		t.recorder.add(e)
+		return nil, err
+	}
+
+	respBody := &capture{limit: t.recorder.maxBody}
+	resp.Body = &teeBody{
+		ReadCloser: resp.Body,
+		capture:    respBody,
+		done: func() {
+			e := newEntry(req, reqBody, start)
+			e.setResponse(resp, respBody)
+			e.Time = milliseconds(time.Since(start))
+			e.Timings.Wait = milliseconds(wait)
+			e.Timings.Receive = e.Time - e.Timings.Wait
+			t.recorder.add(e)
+		},
+	}
+	return resp, nil
+}
+
+func newEntry(req *http.Request, body *capture, start time.Time) Entry {
+	e := Entry{
+		StartedDateTime: start,
+		Request: Request{
+			Method:      req.Method,
+			URL:         publicURL(req),
+			HTTPVersion: req.Proto,
+			Cookies:     []Cookie{},
+			Headers:     headerList(req.Header),
+			QueryString: headerList(http.Header(req.URL.Query())),
+			HeadersSize: -1,
+			BodySize:    body.Size(),
+		},
+		Response: Response{
+			Cookies:     []Cookie{},
+			Headers:     []NameValue{},
+			HeadersSize: -1,
+			BodySize:    -1,
+		},
+	}
+	for _, c := range req.Cookies() {
+		e.Request.Cookies = append(e.Request.Cookies, Cookie{Name: c.Name, Value: c.Value})
+	}
+
+	if kept, size := body.Bytes(); size > 0 {
+		text, encoding := encodeBody(kept)
+		e.Request.PostData = &PostData{
+			MimeType: req.Header.Get("Content-Type"),
+			Text:     text,
+			Encoding: encoding,
+		}
+		if int64(len(kept)) < size {
+			e.Request.PostData.Comment = truncatedComment(int64(len(kept)), size)
+		}
+	}
+	return e
+}
+
+func (e *Entry) setResponse(resp *http.Response, body *capture) {
+	e.Response.Status = resp.StatusCode
+	e.Response.StatusText = http.StatusText(resp.StatusCode)
+	e.Response.HTTPVersion = resp.Proto
+	e.Response.Headers = headerList(resp.Header)
+	e.Response.RedirectURL = resp.Header.Get("Location")
+	for _, c := range resp.Cookies() {
+		e.Response.Cookies = append(e.Response.Cookies, Cookie{
+			Name:     c.Name,
+			Value:    c.Value,
+			Path:     c.Path,
+			Domain:   c.Domain,
+			HTTPOnly: c.HttpOnly,
+			Secure:   c.Secure,
+		})
+	}
+
+	kept, size := body.Bytes()
+	e.Response.BodySize = size
+	e.Response.Content = Content{Size: size, MimeType: resp.Header.Get("Content-Type")}
+	e.Response.Content.Text, e.Response.Content.Encoding = encodeBody(kept)
+	if int64(len(kept)) < size {
+		e.Response.Content.Comment = truncatedComment(int64(len(kept)), size)
+	}
+}
+
+// publicURL returns the URL the visitor requested. The client rewrites
+// requests to the local address and keeps the public host in
+// X-Forwarded-Host.
+func publicURL(req *http.Request) string {
+	u := *req.URL
+	if host := req.Header.Get("X-Forwarded-Host"); host != "" {
+		u.Host = host
+		u.Scheme = "https"
+		if proto := req.Header.Get("X-Forwarded-Proto"); proto != "" {
+			u.Scheme = proto
+		}
+	}
+	return u.String()
+}
+
+// capture keeps the first limit bytes written to it and counts the rest.
+// The transport may still be sending the request body when the response
+// arrives, so it is safe for concurrent use.
+type capture struct {
+	limit int64
+
+	mu   sync.Mutex
+	buf  bytes.Buffer
+	size int64
+}
+
+func (c *capture) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.size += int64(len(p))
+	if room := c.limit - int64(c.buf.Len()); room > 0 {
+		c.buf.Write(p[:min(int64(len(p)), room)])
+	}
+	return len(p), nil
+}
+
+// Bytes returns the kept bytes and the total size seen.
+func (c *capture) Bytes() ([]byte, int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return bytes.Clone(c.buf.Bytes()), c.size
+}
+
+// Size returns the total size seen.
+func (c *capture) Size() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.size
+}
+
+// teeBody copies what is read from a body into a capture and calls done
+// once, at EOF or on Close, whichever comes first.
+type teeBody struct {
+	io.ReadCloser
+	capture *capture
+	done    func()
+	once    sync.Once
+}
+
+func (b *teeBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		_, _ = b.capture.Write(p[:n])
+	}
+	if err == io.EOF {
+		b.finish()
+	}
+	return n, err
+}
+
+func (b *teeBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.finish()
+	return err
+}
+
+func (b *teeBody) finish() {
+	if b.done != nil {
+		b.once.Do(b.done)
+	}
+}
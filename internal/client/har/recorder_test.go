@@ -0,0 +1,81 @@
+package har
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRecorderRecordsAndReplays(t *testing.T) {
+	app := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write([]byte(r.URL.Path + ":" + string(body)))
+	}))
+	defer app.Close()
+
+	path := filepath.Join(t.TempDir(), "out.har")
+	rec, err := NewRecorder(path, 8, "test")
+	if err != nil {
+		t.Fatalf("NewRecorder() error: %v", err)
+	}
+	client := &http.Client{Transport: rec.Transport(http.DefaultTransport)}
+
+	send := func(target, body string) {
+		req, _ := http.NewRequest(http.MethodPost, app.URL+target, strings.NewReader(body))
+		req.Header.Set("X-Forwarded-Host", "demo.example.com")
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("POST %s error: %v", target, err)
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+	send("/a?x=1", "hi")
+	send("/b", "this body is too long")
+
+	if err := rec.Close(); err != nil {
+		t.Fatalf("Close() error: %v", err)
+	}
+	f, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error: %v", err)
+	}
+	if len(f.Log.Entries) != 2 {
+		t.Fatalf("recorded %d entries, want 2", len(f.Log.Entries))
+	}
+
+	first, second := f.Log.Entries[0], f.Log.Entries[1]
+	if first.Request.URL != "https://demo.example.com/a?x=1" {
+		t.Errorf("URL = %q, want the public URL", first.Request.URL)
+	}
+	if first.Request.PostData.Text != "hi" || first.Request.PostData.Truncated() {
+		t.Errorf("request body = %+v, want \"hi\" untruncated", first.Request.PostData)
+	}
+	if first.Response.Status != http.StatusOK || first.Response.Content.Text != "/a:hi" {
+		t.Errorf("response = %d %q, want 200 \"/a:hi\"", first.Response.Status, first.Response.Content.Text)
+	}
+	if !second.Request.PostData.Truncated() || second.Request.PostData.Text != "this bod" {
+		t.Errorf("long request body = %+v, want truncated to 8 bytes", second.Request.PostData)
+	}
+	if second.Response.Content.Size != int64(len("/b:this body is too long")) {
+		t.Errorf("response size = %d, want the full size", second.Response.Content.Size)
+	}
+
+	base, _ := url.Parse("http://127.0.0.1:3000")
+	req, err := first.NewRequest(context.Background(), base)
+	if err != nil {
+		t.Fatalf("NewRequest() error: %v", err)
+	}
+	if req.URL.String() != "http://127.0.0.1:3000/a?x=1" || req.Header.Get("X-Forwarded-Host") != "demo.example.com" {
+		t.Errorf("replayed request = %s with X-Forwarded-Host %q", req.URL, req.Header.Get("X-Forwarded-Host"))
+	}
+	if _, err := second.NewRequest(context.Background(), base); err == nil {
+		t.Error("NewRequest() replayed a truncated body")
+	}
+}
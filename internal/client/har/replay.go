@@ -0,0 +1,51 @@
+package har
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"drip/internal/shared/httputil"
+)
+
+// NewRequest rebuilds the recorded request against base, an origin such
+// as http://127.0.0.1:3000. The recorded public host is kept in
+// X-Forwarded-Host, as the client sends it. Requests whose body was
+// truncated cannot be replayed faithfully and return an error.
+func (e *Entry) NewRequest(ctx context.Context, base *url.URL) (*http.Request, error) {
+	if e.Request.PostData.Truncated() {
+		return nil, fmt.Errorf("body was truncated when recorded")
+	}
+	body, err := e.Request.PostData.Body()
+	if err != nil {
+		return nil, fmt.Errorf("invalid recorded body: %w", err)
+	}
+
+	recorded, err := url.Parse(e.Request.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid recorded URL: %w", err)
+	}
+	target := *base
+	target.Path = strings.TrimSuffix(base.Path, "/") + recorded.Path
+	target.RawPath = ""
+	target.RawQuery = recorded.RawQuery
+
+	req, err := http.NewRequestWithContext(ctx, e.Request.Method, target.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for _, h := range e.Request.Headers {
+		req.Header.Add(h.Name, h.Value)
+	}
+	httputil.CleanHopByHopHeaders(req.Header)
+	req.Header.Del("Host")
+	req.Header.Del("Content-Length")
+	req.Host = target.Host
+	if recorded.Host != "" && req.Header.Get("X-Forwarded-Host") == "" {
+		req.Header.Set("X-Forwarded-Host", recorded.Host)
+	}
+	return req, nil
+}
@@ -0,0 +1,138 @@
+// Package kube exposes annotated Kubernetes Services through drip tunnels.
+// It talks to the API server over plain REST so the client binary does not
+// need the Kubernetes client libraries.
+package kube
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	json "github.com/goccy/go-json"
+)
+
+const (
+	serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+	apiTimeout        = 15 * time.Second
+	maxListBody       = 32 << 20
+)
+
+// Service is the subset of a Kubernetes Service the controller reads.
+type Service struct {
+	Metadata struct {
+		Name        string            `json:"name"`
+		Namespace   string            `json:"namespace"`
+		Annotations map[string]string `json:"annotations"`
+	} `json:"metadata"`
+	Spec struct {
+		Ports []ServicePort `json:"ports"`
+	} `json:"spec"`
+}
+
+// ServicePort is one port of a Service.
+type ServicePort struct {
+	Name     string `json:"name"`
+	Port     int    `json:"port"`
+	Protocol string `json:"protocol"`
+}
+
+// Client lists Services from the API server.
+type Client struct {
+	baseURL string
+	token   string
+	http    *http.Client
+}
+
+// NewInClusterClient uses the pod's service account, the way kubectl does
+// inside a cluster.
+func NewInClusterClient() (*Client, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, fmt.Errorf("not running in a Kubernetes pod; use --api-server (e.g. with 'kubectl proxy')")
+	}
+
+	token, err := os.ReadFile(serviceAccountDir + "/token")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read service account token: %w", err)
+	}
+	caPEM, err := os.ReadFile(serviceAccountDir + "/ca.crt")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read service account CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return nil, fmt.Errorf("service account CA contains no certificates")
+	}
+
+	return &Client{
+		baseURL: "https://" + net.JoinHostPort(host, port),
+		token:   strings.TrimSpace(string(token)),
+		http: &http.Client{
+			Timeout: apiTimeout,
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12},
+			},
+		},
+	}, nil
+}
+
+// NewClient talks to an API server that needs no credentials from drip,
+// such as 'kubectl proxy' on http://127.0.0.1:8001.
+func NewClient(apiServer string) (*Client, error) {
+	u, err := url.Parse(apiServer)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid API server URL %q", apiServer)
+	}
+	return &Client{
+		baseURL: strings.TrimRight(apiServer, "/"),
+		http:    &http.Client{Timeout: apiTimeout},
+	}, nil
+}
+
+// ListServices returns the Services in namespace, or in all namespaces when
+// namespace is empty.
+func (c *Client) ListServices(ctx context.Context, namespace string) ([]Service, error) {
+	path := "/api/v1/services"
+	if namespace != "" {
+		path = "/api/v1/namespaces/" + url.PathEscape(namespace) + "/services"
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list services: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxListBody))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read service list: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to list services: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	var list struct {
+		Items []Service `json:"items"`
+	}
+	if err := json.Unmarshal(body, &list); err != nil {
+		return nil, fmt.Errorf("failed to parse service list: %w", err)
+	}
+	return list.Items, nil
+}
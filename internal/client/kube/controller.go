@@ -0,0 +1,154 @@
+package kube
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"drip/internal/client/supervisor"
+	"drip/internal/client/tcp"
+	"drip/internal/shared/protocol"
+
+	"go.uber.org/zap"
+)
+
+// Annotations read from Services.
+const (
+	AnnotationExpose    = "drip.io/expose"    // "true" to expose the Service
+	AnnotationPort      = "drip.io/port"      // port name or number, default the first TCP port
+	AnnotationType      = "drip.io/type"      // http (default), https or tcp
+	AnnotationSubdomain = "drip.io/subdomain" // requested subdomain
+)
+
+// DefaultInterval is how often the controller lists Services.
+const DefaultInterval = 10 * time.Second
+
+// Controller keeps one tunnel per annotated Service.
+type Controller struct {
+	client    *Client
+	namespace string
+	interval  time.Duration
+	base      tcp.ConnectorConfig
+	tunnels   *supervisor.Supervisor
+	logger    *zap.Logger
+}
+
+// NewController creates a controller. base carries the server settings
+// shared by every tunnel; the controller fills in the per-Service fields.
+func NewController(client *Client, namespace string, interval time.Duration, base tcp.ConnectorConfig, tunnels *supervisor.Supervisor, logger *zap.Logger) *Controller {
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	return &Controller{
+		client:    client,
+		namespace: namespace,
+		interval:  interval,
+		base:      base,
+		tunnels:   tunnels,
+		logger:    logger,
+	}
+}
+
+// Run reconciles until ctx is done. Listing errors are logged and retried on
+// the next tick; existing tunnels are left alone meanwhile.
+func (c *Controller) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := c.sync(ctx); err != nil && ctx.Err() == nil {
+			c.logger.Warn("Failed to sync Kubernetes services", zap.Error(err))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *Controller) sync(ctx context.Context) error {
+	services, err := c.client.ListServices(ctx, c.namespace)
+	if err != nil {
+		return err
+	}
+
+	desired := make(map[string]tcp.ConnectorConfig)
+	for _, svc := range services {
+		if svc.Metadata.Annotations[AnnotationExpose] != "true" {
+			continue
+		}
+		name := svc.Metadata.Namespace + "/" + svc.Metadata.Name
+		cfg, err := c.tunnelConfig(svc)
+		if err != nil {
+			c.logger.Warn("Skipping Service", zap.String("service", name), zap.Error(err))
+			continue
+		}
+		desired[name] = cfg
+	}
+
+	for name, cfg := range desired {
+		if c.tunnels.Set(name, cfg) {
+			c.logger.Info("Exposing Service",
+				zap.String("service", name),
+				zap.String("type", string(cfg.TunnelType)),
+				zap.String("target", net.JoinHostPort(cfg.LocalHost, strconv.Itoa(cfg.LocalPort))),
+			)
+		}
+	}
+	for _, name := range c.tunnels.Names() {
+		if _, ok := desired[name]; !ok {
+			c.tunnels.Remove(name)
+			c.logger.Info("Stopped exposing Service", zap.String("service", name))
+		}
+	}
+	return nil
+}
+
+// tunnelConfig maps a Service and its annotations to a tunnel.
+func (c *Controller) tunnelConfig(svc Service) (tcp.ConnectorConfig, error) {
+	ann := svc.Metadata.Annotations
+
+	tunnelType := protocol.TunnelTypeHTTP
+	switch t := strings.ToLower(ann[AnnotationType]); t {
+	case "", "http":
+	case "https":
+		tunnelType = protocol.TunnelTypeHTTPS
+	case "tcp":
+		tunnelType = protocol.TunnelTypeTCP
+	default:
+		return tcp.ConnectorConfig{}, fmt.Errorf("invalid %s %q", AnnotationType, t)
+	}
+
+	port, err := servicePort(svc.Spec.Ports, ann[AnnotationPort])
+	if err != nil {
+		return tcp.ConnectorConfig{}, err
+	}
+
+	cfg := c.base
+	cfg.TunnelType = tunnelType
+	cfg.LocalHost = svc.Metadata.Name + "." + svc.Metadata.Namespace + ".svc"
+	cfg.LocalPort = port
+	cfg.Subdomain = ann[AnnotationSubdomain]
+	return cfg, nil
+}
+
+// servicePort picks the port named or numbered by want, or the first TCP
+// port when want is empty.
+func servicePort(ports []ServicePort, want string) (int, error) {
+	for _, p := range ports {
+		if p.Protocol != "" && p.Protocol != "TCP" {
+			continue
+		}
+		if want == "" || want == p.Name || want == strconv.Itoa(p.Port) {
+			return p.Port, nil
+		}
+	}
+	if want == "" {
+		return 0, fmt.Errorf("service has no TCP ports")
+	}
+	return 0, fmt.Errorf("service has no TCP port %q", want)
+}
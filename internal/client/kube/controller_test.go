@@ -0,0 +1,72 @@
+package kube
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"drip/internal/client/supervisor"
+	"drip/internal/client/tcp"
+	"drip/internal/shared/protocol"
+
+	"go.uber.org/zap"
+)
+
+const serviceList = `{"items":[
+ {"metadata":{"name":"web","namespace":"default","annotations":{"drip.io/expose":"true","drip.io/subdomain":"preview"}},
+  "spec":{"ports":[{"name":"dns","port":53,"protocol":"UDP"},{"name":"http","port":8080,"protocol":"TCP"}]}},
+ {"metadata":{"name":"db","namespace":"data","annotations":{"drip.io/expose":"true","drip.io/type":"tcp","drip.io/port":"5432"}},
+  "spec":{"ports":[{"name":"metrics","port":9187},{"name":"pg","port":5432}]}},
+ {"metadata":{"name":"bad","namespace":"default","annotations":{"drip.io/expose":"true","drip.io/port":"grpc"}},
+  "spec":{"ports":[{"name":"http","port":80}]}},
+ {"metadata":{"name":"internal","namespace":"default"},
+  "spec":{"ports":[{"port":80}]}}
+]}`
+
+func TestControllerSync(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/services" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(serviceList))
+	}))
+	defer api.Close()
+
+	client, err := NewClient(api.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tunnels := supervisor.New(zap.NewNop())
+	defer tunnels.Close()
+
+	base := tcp.ConnectorConfig{ServerAddr: "127.0.0.1:1", Transport: tcp.TransportTCP}
+	c := NewController(client, "", 0, base, tunnels, zap.NewNop())
+	if err := c.sync(context.Background()); err != nil {
+		t.Fatalf("sync() error = %v", err)
+	}
+
+	want := map[string]struct {
+		typ   protocol.TunnelType
+		local string
+	}{
+		"default/web": {protocol.TunnelTypeHTTP, "web.default.svc:8080"},
+		"data/db":     {protocol.TunnelTypeTCP, "db.data.svc:5432"},
+	}
+
+	list := tunnels.List()
+	if len(list) != len(want) {
+		t.Fatalf("List() = %+v, want %d tunnels", list, len(want))
+	}
+	for _, st := range list {
+		w, ok := want[st.Name]
+		if !ok {
+			t.Errorf("unexpected tunnel %q", st.Name)
+			continue
+		}
+		if st.Type != string(w.typ) || st.Local != w.local {
+			t.Errorf("%s = %s %s, want %s %s", st.Name, st.Type, st.Local, w.typ, w.local)
+		}
+	}
+}
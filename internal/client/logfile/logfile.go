@@ -0,0 +1,258 @@
+// Package logfile writes client logs to files under ~/.drip/logs, one per
+// tunnel, rotating them by size and age so they can be read back with
+// 'drip logs' after a failure.
+package logfile
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Ext is the extension of active and rotated log files.
+const Ext = ".log"
+
+// Defaults for Options fields left zero.
+const (
+	DefaultMaxSize    = 10 << 20
+	DefaultMaxBackups = 5
+	DefaultMaxAge     = 7 * 24 * time.Hour
+)
+
+// backupTimeFormat stamps rotated files; it sorts chronologically.
+const backupTimeFormat = "20060102T150405.000"
+
+// Dir returns the directory client logs are written to.
+func Dir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(".drip", "logs")
+	}
+	return filepath.Join(home, ".drip", "logs")
+}
+
+// Path returns the active log file of the tunnel called name in dir.
+func Path(dir, name string) string {
+	return filepath.Join(dir, SanitizeName(name)+Ext)
+}
+
+// SanitizeName makes a tunnel name safe to use as a file name.
+func SanitizeName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case 'a' <= r && r <= 'z', 'A' <= r && r <= 'Z', '0' <= r && r <= '9', r == '-', r == '_', r == '.':
+			return r
+		}
+		return '_'
+	}, name)
+	if strings.Trim(name, ".") == "" {
+		return "drip"
+	}
+	return name
+}
+
+// Options control rotation.
+type Options struct {
+	MaxSize    int64         // Rotate once the file would grow past this many bytes
+	MaxBackups int           // Rotated files kept per log
+	MaxAge     time.Duration // Rotated files older than this are removed, and an active file untouched for this long is rotated on open
+}
+
+// Writer is an append-only log file that rotates itself. Rotated files sit
+// next to it as <name>-<time>.log.
+type Writer struct {
+	mu   sync.Mutex
+	path string
+	opts Options
+	file *os.File
+	size int64
+}
+
+// Open appends to the log file at path, creating its directory if needed.
+func Open(path string, opts Options) (*Writer, error) {
+	if opts.MaxSize <= 0 {
+		opts.MaxSize = DefaultMaxSize
+	}
+	if opts.MaxBackups <= 0 {
+		opts.MaxBackups = DefaultMaxBackups
+	}
+	if opts.MaxAge <= 0 {
+		opts.MaxAge = DefaultMaxAge
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create log directory: %w", err)
+	}
+
+	w := &Writer{path: path, opts: opts}
+	if info, err := os.Stat(path); err == nil && info.Size() > 0 && time.Since(info.ModTime()) > opts.MaxAge {
+		if err := w.rotate(); err != nil {
+			return nil, err
+		}
+		return w, nil
+	}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *Writer) open() error {
+	f, err := os.OpenFile(w.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	w.file, w.size = f, info.Size()
+	return nil
+}
+
+// Write appends p, rotating first if p would take the file past MaxSize.
+func (w *Writer) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil {
+		return 0, os.ErrClosed
+	}
+	if w.size > 0 && w.size+int64(len(p)) > w.opts.MaxSize {
+		if err := w.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// Sync flushes the file to disk.
+func (w *Writer) Sync() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return nil
+	}
+	return w.file.Sync()
+}
+
+// Close closes the file.
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
+
+// rotate moves the active file aside, starts a new one and prunes old
+// backups.
+func (w *Writer) rotate() error {
+	if w.file != nil {
+		_ = w.file.Close()
+		w.file = nil
+	}
+	backup := strings.TrimSuffix(w.path, Ext) + "-" + time.Now().Format(backupTimeFormat) + Ext
+	if err := os.Rename(w.path, backup); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to rotate log file: %w", err)
+	}
+	if err := w.open(); err != nil {
+		return err
+	}
+	w.prune()
+	return nil
+}
+
+// prune removes backups beyond MaxBackups or older than MaxAge.
+func (w *Writer) prune() {
+	backups, err := Backups(w.path)
+	if err != nil {
+		return
+	}
+	cutoff := time.Now().Add(-w.opts.MaxAge)
+	for i, path := range backups {
+		keep := len(backups) - i
+		info, err := os.Stat(path)
+		if keep > w.opts.MaxBackups || (err == nil && info.ModTime().Before(cutoff)) {
+			_ = os.Remove(path)
+		}
+	}
+}
+
+// Backups returns the rotated files of the log at path, oldest first.
+func Backups(path string) ([]string, error) {
+	prefix := strings.TrimSuffix(filepath.Base(path), Ext) + "-"
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var backups []string
+	for _, e := range entries {
+		name := e.Name()
+		stamp, ok := strings.CutPrefix(name, prefix)
+		if !ok || e.IsDir() || filepath.Ext(name) != Ext {
+			continue
+		}
+		// Tunnel "web" must not claim the backups of "web-api".
+		if _, err := time.Parse(backupTimeFormat, strings.TrimSuffix(stamp, Ext)); err != nil {
+			continue
+		}
+		backups = append(backups, filepath.Join(filepath.Dir(path), name))
+	}
+	slices.Sort(backups)
+	return backups, nil
+}
+
+// List returns the sorted names of the logs in dir, without rotated files.
+func List(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var names []string
+	for _, e := range entries {
+		name, ok := strings.CutSuffix(e.Name(), Ext)
+		if !ok || e.IsDir() {
+			continue
+		}
+		if i := strings.LastIndexByte(name, '-'); i >= 0 {
+			if _, err := time.Parse(backupTimeFormat, name[i+1:]); err == nil {
+				continue
+			}
+		}
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names, nil
+}
+
+// Tee returns logger writing its entries to w as JSON lines as well, at
+// level and above, whatever the console shows.
+func Tee(logger *zap.Logger, w *Writer, level zapcore.Level) *zap.Logger {
+	encoderConfig := zap.NewProductionEncoderConfig()
+	encoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
+	fileCore := zapcore.NewCore(zapcore.NewJSONEncoder(encoderConfig), w, level)
+	return logger.WithOptions(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		return zapcore.NewTee(core, fileCore)
+	}))
+}
@@ -0,0 +1,92 @@
+package logfile
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriterRotates(t *testing.T) {
+	dir := t.TempDir()
+	path := Path(dir, "web")
+	w, err := Open(path, Options{MaxSize: 100, MaxBackups: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = w.Close() }()
+
+	line := []byte(strings.Repeat("x", 59) + "\n")
+	for i := 0; i < 5; i++ {
+		if _, err := w.Write(line); err != nil {
+			t.Fatal(err)
+		}
+		// Backups are stamped to the millisecond.
+		time.Sleep(2 * time.Millisecond)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != int64(len(line)) {
+		t.Errorf("active log is %d bytes, want %d", info.Size(), len(line))
+	}
+	backups, err := Backups(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 2 {
+		t.Errorf("got %d backups, want 2: %v", len(backups), backups)
+	}
+}
+
+func TestList(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{
+		"web.log",
+		"web-api.log",
+		"web-20260102T150405.000.log",
+		"notes.txt",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	names, err := List(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"web", "web-api"}; !slices.Equal(names, want) {
+		t.Errorf("List = %v, want %v", names, want)
+	}
+
+	backups, err := Backups(Path(dir, "web"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 1 || filepath.Base(backups[0]) != "web-20260102T150405.000.log" {
+		t.Errorf("Backups(web) = %v", backups)
+	}
+}
+
+func TestSanitizeName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"myapp", "myapp"},
+		{"http-3000", "http-3000"},
+		{"../etc/passwd", ".._etc_passwd"},
+		{"..", "drip"},
+		{"", "drip"},
+	}
+	for _, tt := range tests {
+		if got := SanitizeName(tt.name); got != tt.want {
+			t.Errorf("SanitizeName(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// corsMaxAge is how long browsers may cache a preflight answer, in seconds.
+const corsMaxAge = "600"
+
+// ValidateCORSOrigins checks an origin allowlist for AddCORS.
+func ValidateCORSOrigins(origins []string) error {
+	for _, o := range origins {
+		if o == "*" {
+			continue
+		}
+		scheme, host, ok := strings.Cut(o, "://")
+		if !ok || (scheme != "http" && scheme != "https") || host == "" || strings.Contains(host, "/") {
+			return fmt.Errorf("invalid CORS origin %q: use * or an origin like https://app.example.com or https://*.example.com", o)
+		}
+	}
+	return nil
+}
+
+// AddCORS answers CORS preflights and adds CORS headers to responses for
+// requests from an allowed origin, so a deployed frontend can call an API
+// behind the tunnel. origins holds exact origins, wildcard subdomains
+// such as https://*.example.com, or "*" for any origin. Listed and
+// wildcard origins are echoed back with credentials allowed; "*" only
+// answers with a literal "*", so other sites cannot make credentialed
+// reads. Requests from other origins are left to the app.
+func (c *Chain) AddCORS(origins []string) {
+	// allowOrigin returns the Access-Control-Allow-Origin value for origin,
+	// empty if it is not allowed, and whether credentials may be sent.
+	allowOrigin := func(origin string) (string, bool) {
+		if origin == "" {
+			return "", false
+		}
+		anyOrigin := false
+		for _, o := range origins {
+			if o == "*" {
+				anyOrigin = true
+			} else if strings.EqualFold(o, origin) || matchWildcardOrigin(o, origin) {
+				return origin, true
+			}
+		}
+		if anyOrigin {
+			return "*", false
+		}
+		return "", false
+	}
+
+	c.OnRequest(func(req *http.Request) (*http.Response, error) {
+		method := req.Header.Get("Access-Control-Request-Method")
+		if req.Method != http.MethodOptions || method == "" {
+			return nil, nil
+		}
+		if allow, _ := allowOrigin(req.Header.Get("Origin")); allow == "" {
+			return nil, nil
+		}
+		header := make(http.Header)
+		header.Set("Access-Control-Allow-Methods", method)
+		if h := req.Header.Get("Access-Control-Request-Headers"); h != "" {
+			header.Set("Access-Control-Allow-Headers", h)
+		}
+		if req.Header.Get("Access-Control-Request-Private-Network") == "true" {
+			header.Set("Access-Control-Allow-Private-Network", "true")
+		}
+		header.Set("Access-Control-Max-Age", corsMaxAge)
+		return &http.Response{StatusCode: http.StatusNoContent, Header: header}, nil
+	})
+
+	c.OnResponse(func(resp *http.Response) error {
+		allow, credentials := allowOrigin(resp.Request.Header.Get("Origin"))
+		if allow == "" {
+			return nil
+		}
+		resp.Header.Set("Access-Control-Allow-Origin", allow)
+		if credentials {
+			resp.Header.Set("Access-Control-Allow-Credentials", "true")
+		}
+		resp.Header.Add("Vary", "Origin")
+		return nil
+	})
+}
+
+// matchWildcardOrigin matches https://*.example.com against subdomains of
+// example.com with the same scheme.
+func matchWildcardOrigin(pattern, origin string) bool {
+	scheme, host, ok := strings.Cut(pattern, "://*.")
+	if !ok {
+		return false
+	}
+	prefix := scheme + "://"
+	if !strings.HasPrefix(strings.ToLower(origin), prefix) {
+		return false
+	}
+	return strings.HasSuffix(strings.ToLower(origin[len(prefix):]), "."+strings.ToLower(host))
+}
@@ -0,0 +1,179 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"time"
+
+	json "github.com/goccy/go-json"
+)
+
+const (
+	// execHookTimeout bounds one hook invocation.
+	execHookTimeout = 5 * time.Second
+	// maxExecHookBody is the largest request body passed to a hook.
+	// Larger or unknown-length bodies are streamed to the app untouched.
+	maxExecHookBody = 64 * 1024
+	// maxExecHookOutput caps what a hook may print.
+	maxExecHookOutput = 1024 * 1024
+)
+
+// ExecInput is written as JSON to the hook's stdin.
+type ExecInput struct {
+	Phase  string      `json:"phase"` // "request" or "response"
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header"`
+	Body   string      `json:"body,omitempty"` // request phase only
+
+	Status int `json:"status,omitempty"` // response phase only
+}
+
+// ExecOutput is read as JSON from the hook's stdout. Empty output leaves
+// the traffic unchanged.
+type ExecOutput struct {
+	SetHeader map[string]string `json:"set_header,omitempty"`
+	DelHeader []string          `json:"del_header,omitempty"`
+
+	// Response answers the request without contacting the local app
+	// (request phase only).
+	Response *ExecResponse `json:"response,omitempty"`
+}
+
+// ExecResponse is a mocked response.
+type ExecResponse struct {
+	Status int               `json:"status"`
+	Header map[string]string `json:"header,omitempty"`
+	Body   string            `json:"body,omitempty"`
+}
+
+// AddExecHook runs command through the shell for every request and
+// response. The hook reads an ExecInput from stdin and may print an
+// ExecOutput to change headers or mock the response.
+func (c *Chain) AddExecHook(command string) {
+	c.OnRequest(func(req *http.Request) (*http.Response, error) {
+		in := ExecInput{
+			Phase:  "request",
+			Method: req.Method,
+			URL:    req.URL.String(),
+			Header: req.Header,
+		}
+		if req.Body != nil && req.Body != http.NoBody &&
+			req.ContentLength >= 0 && req.ContentLength <= maxExecHookBody {
+			body, err := io.ReadAll(req.Body)
+			_ = req.Body.Close()
+			if err != nil {
+				return nil, fmt.Errorf("read request body: %w", err)
+			}
+			req.Body = io.NopCloser(bytes.NewReader(body))
+			in.Body = string(body)
+		}
+
+		out, err := runExecHook(req.Context(), command, &in)
+		if err != nil || out == nil {
+			return nil, err
+		}
+		applyHeaders(req.Header, out)
+		if out.Response == nil {
+			return nil, nil
+		}
+		return mockResponse(out.Response), nil
+	})
+
+	c.OnResponse(func(resp *http.Response) error {
+		in := ExecInput{
+			Phase:  "response",
+			Method: resp.Request.Method,
+			URL:    resp.Request.URL.String(),
+			Header: resp.Header,
+			Status: resp.StatusCode,
+		}
+		out, err := runExecHook(resp.Request.Context(), command, &in)
+		if err != nil || out == nil {
+			return err
+		}
+		applyHeaders(resp.Header, out)
+		return nil
+	})
+}
+
+func runExecHook(ctx context.Context, command string, in *ExecInput) (*ExecOutput, error) {
+	input, err := json.Marshal(in)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, execHookTimeout)
+	defer cancel()
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+	cmd.Stdin = bytes.NewReader(input)
+	var stdout bytes.Buffer
+	cmd.Stdout = &limitedBuffer{buf: &stdout, remaining: maxExecHookOutput}
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("hook %q: %w", command, err)
+	}
+
+	if len(bytes.TrimSpace(stdout.Bytes())) == 0 {
+		return nil, nil
+	}
+	var out ExecOutput
+	if err := json.Unmarshal(stdout.Bytes(), &out); err != nil {
+		return nil, fmt.Errorf("hook %q printed invalid JSON: %w", command, err)
+	}
+	return &out, nil
+}
+
+func applyHeaders(h http.Header, out *ExecOutput) {
+	for _, k := range out.DelHeader {
+		h.Del(k)
+	}
+	for k, v := range out.SetHeader {
+		h.Set(k, v)
+	}
+}
+
+func mockResponse(m *ExecResponse) *http.Response {
+	status := m.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	resp := &http.Response{
+		Status:        strconv.Itoa(status) + " " + http.StatusText(status),
+		StatusCode:    status,
+		Header:        make(http.Header),
+		Body:          io.NopCloser(bytes.NewReader([]byte(m.Body))),
+		ContentLength: int64(len(m.Body)),
+	}
+	for k, v := range m.Header {
+		resp.Header.Set(k, v)
+	}
+	resp.Header.Set("Content-Length", strconv.Itoa(len(m.Body)))
+	return normalize(resp)
+}
+
+// limitedBuffer fails writes past a fixed size so a runaway hook cannot
+// exhaust memory.
+type limitedBuffer struct {
+	buf       *bytes.Buffer
+	remaining int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if len(p) > b.remaining {
+		return 0, fmt.Errorf("hook output exceeds %d bytes", maxExecHookOutput)
+	}
+	b.remaining -= len(p)
+	return b.buf.Write(p)
+}
@@ -0,0 +1,115 @@
+// Package middleware lets users inspect and rewrite HTTP traffic on the
+// client before it reaches the local app and before the response goes back
+// through the tunnel.
+package middleware
+
+import (
+	"net/http"
+
+	"go.uber.org/zap"
+)
+
+// RequestHook runs before a request is forwarded to the local app. It may
+// modify req in place. Returning a non-nil response answers the request
+// without contacting the app, which is how endpoints are mocked.
+type RequestHook func(req *http.Request) (*http.Response, error)
+
+// ResponseHook runs on every response, including mocked ones, before it
+// is written back to the tunnel. It may modify resp in place.
+type ResponseHook func(resp *http.Response) error
+
+// Chain holds hooks in registration order. Hooks that fail are logged and
+// skipped so a broken hook never takes the tunnel down.
+type Chain struct {
+	logger    *zap.Logger
+	requests  []RequestHook
+	responses []ResponseHook
+}
+
+// NewChain creates an empty chain.
+func NewChain(logger *zap.Logger) *Chain {
+	return &Chain{logger: logger}
+}
+
+// OnRequest registers a request hook.
+func (c *Chain) OnRequest(h RequestHook) {
+	c.requests = append(c.requests, h)
+}
+
+// OnResponse registers a response hook.
+func (c *Chain) OnResponse(h ResponseHook) {
+	c.responses = append(c.responses, h)
+}
+
+// Empty reports whether no hooks are registered.
+func (c *Chain) Empty() bool {
+	return c == nil || (len(c.requests) == 0 && len(c.responses) == 0)
+}
+
+// Transport wraps next so that every round trip passes through the chain.
+func (c *Chain) Transport(next http.RoundTripper) http.RoundTripper {
+	return &transport{chain: c, next: next}
+}
+
+type transport struct {
+	chain *Chain
+	next  http.RoundTripper
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var resp *http.Response
+	for _, h := range t.chain.requests {
+		mocked, err := h(req)
+		if err != nil {
+			t.chain.logger.Warn("Request hook failed",
+				zap.String("method", req.Method),
+				zap.String("path", req.URL.Path),
+				zap.Error(err),
+			)
+			continue
+		}
+		if mocked != nil {
+			resp = normalize(mocked)
+			break
+		}
+	}
+
+	if resp == nil {
+		var err error
+		if resp, err = t.next.RoundTrip(req); err != nil {
+			return nil, err
+		}
+	}
+	if resp.Request == nil {
+		resp.Request = req
+	}
+
+	for _, h := range t.chain.responses {
+		if err := h(resp); err != nil {
+			t.chain.logger.Warn("Response hook failed",
+				zap.String("method", req.Method),
+				zap.String("path", req.URL.Path),
+				zap.Error(err),
+			)
+		}
+	}
+	return resp, nil
+}
+
+// normalize fills in the fields a hand-built response usually omits.
+func normalize(resp *http.Response) *http.Response {
+	if resp.ProtoMajor == 0 {
+		resp.Proto, resp.ProtoMajor, resp.ProtoMinor = "HTTP/1.1", 1, 1
+	}
+	if resp.StatusCode == 0 {
+		resp.StatusCode = http.StatusOK
+	}
+	if resp.Header == nil {
+		resp.Header = make(http.Header)
+	}
+	if resp.Body == nil {
+		resp.Body = http.NoBody
+		resp.ContentLength = 0
+	}
+	return resp
+}
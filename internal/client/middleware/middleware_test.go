@@ -0,0 +1,351 @@
+package middleware
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func newApp(t *testing.T) *httptest.Server {
+	t.Helper()
+	app := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Seen", r.Header.Get("X-Injected"))
+		_, _ = io.WriteString(w, "from app")
+	}))
+	t.Cleanup(app.Close)
+	return app
+}
+
+func get(t *testing.T, chain *Chain, url string) (*http.Response, string) {
+	t.Helper()
+	client := &http.Client{Transport: chain.Transport(http.DefaultTransport)}
+	resp, err := client.Get(url)
+	if err != nil {
+		t.Fatalf("GET %s: %v", url, err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	return resp, string(body)
+}
+
+func TestChain(t *testing.T) {
+	app := newApp(t)
+
+	chain := NewChain(zap.NewNop())
+	chain.OnRequest(func(req *http.Request) (*http.Response, error) {
+		req.Header.Set("X-Injected", "yes")
+		if req.URL.Path == "/mock" {
+			return &http.Response{StatusCode: http.StatusTeapot, Body: io.NopCloser(strings.NewReader("mocked"))}, nil
+		}
+		return nil, nil
+	})
+	chain.OnResponse(func(resp *http.Response) error {
+		resp.Header.Set("X-Hooked", "1")
+		return nil
+	})
+
+	resp, body := get(t, chain, app.URL+"/real")
+	if body != "from app" || resp.Header.Get("X-Seen") != "yes" || resp.Header.Get("X-Hooked") != "1" {
+		t.Errorf("real request: body %q, headers %v", body, resp.Header)
+	}
+
+	resp, body = get(t, chain, app.URL+"/mock")
+	if resp.StatusCode != http.StatusTeapot || body != "mocked" || resp.Header.Get("X-Hooked") != "1" {
+		t.Errorf("mocked request: status %d, body %q, headers %v", resp.StatusCode, body, resp.Header)
+	}
+}
+
+func TestExecHook(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+	app := newApp(t)
+
+	chain := NewChain(zap.NewNop())
+	chain.AddExecHook(`cat >/dev/null; echo '{"set_header":{"X-Injected":"exec"}}'`)
+
+	resp, body := get(t, chain, app.URL+"/")
+	if body != "from app" || resp.Header.Get("X-Seen") != "exec" {
+		t.Errorf("exec hook: body %q, X-Seen %q", body, resp.Header.Get("X-Seen"))
+	}
+
+	mock := NewChain(zap.NewNop())
+	mock.AddExecHook(`grep -q '"phase":"request"' && echo '{"response":{"status":201,"body":"fixture"}}' || true`)
+	resp, body = get(t, mock, app.URL+"/")
+	if resp.StatusCode != http.StatusCreated || body != "fixture" {
+		t.Errorf("exec mock: status %d, body %q", resp.StatusCode, body)
+	}
+}
+
+func TestMocks(t *testing.T) {
+	app := newApp(t)
+
+	chain := NewChain(zap.NewNop())
+	chain.AddMocks([]Mock{
+		{Method: "GET", Path: "/api/users/*", Body: []byte(`{"id":1}`), Header: map[string]string{"content-type": "application/json"}},
+		{Path: "/slow", Status: http.StatusAccepted, Delay: 50 * time.Millisecond},
+		{Path: "/page", Body: []byte("<html>hi</html>")},
+	})
+
+	tests := []struct {
+		path        string
+		wantStatus  int
+		wantBody    string
+		wantType    string
+		wantElapsed time.Duration
+	}{
+		{"/api/users/1", http.StatusOK, `{"id":1}`, "application/json", 0},
+		{"/api/users/1/posts", http.StatusOK, "from app", "", 0},
+		{"/slow", http.StatusAccepted, "", "", 50 * time.Millisecond},
+		{"/page", http.StatusOK, "<html>hi</html>", "text/html; charset=utf-8", 0},
+		{"/other", http.StatusOK, "from app", "", 0},
+	}
+	for _, tt := range tests {
+		start := time.Now()
+		resp, body := get(t, chain, app.URL+tt.path)
+		if resp.StatusCode != tt.wantStatus || body != tt.wantBody {
+			t.Errorf("GET %s = %d %q, want %d %q", tt.path, resp.StatusCode, body, tt.wantStatus, tt.wantBody)
+		}
+		if tt.wantType != "" && resp.Header.Get("Content-Type") != tt.wantType {
+			t.Errorf("GET %s Content-Type = %q, want %q", tt.path, resp.Header.Get("Content-Type"), tt.wantType)
+		}
+		if elapsed := time.Since(start); elapsed < tt.wantElapsed {
+			t.Errorf("GET %s answered after %v, want a delay of %v", tt.path, elapsed, tt.wantElapsed)
+		}
+	}
+}
+
+func TestRewrite(t *testing.T) {
+	app := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := "http://" + r.Host
+		w.Header().Add("Set-Cookie", "sid=1; Domain=localhost; Path=/")
+		w.Header().Add("Set-Cookie", "ads=1; Domain=example.org")
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if r.URL.Path == "/login" {
+			w.Header().Set("Location", origin+"/home?x=1")
+			w.WriteHeader(http.StatusFound)
+			return
+		}
+		_, _ = io.WriteString(w, `<a href="`+origin+`/a">a</a><script src="//`+r.Host+`/app.js"></script><a href="https://other.dev/">b</a>`)
+	}))
+	defer app.Close()
+	port := app.Listener.Addr().(*net.TCPAddr).Port
+
+	chain := NewChain(zap.NewNop())
+	chain.AddRewrite(Rewrite{LocalHost: "127.0.0.1", LocalPort: port, HTML: true, Cookies: CookieRewrite{Domain: true}})
+	client := &http.Client{
+		Transport:     chain.Transport(http.DefaultTransport),
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	fetch := func(path string) (*http.Response, string) {
+		req, _ := http.NewRequest(http.MethodGet, app.URL+path, nil)
+		req.Header.Set("X-Forwarded-Host", "demo.example.com")
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("GET %s: %v", path, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		return resp, string(body)
+	}
+
+	resp, _ := fetch("/login")
+	if got := resp.Header.Get("Location"); got != "https://demo.example.com/home?x=1" {
+		t.Errorf("Location = %q, want the public URL", got)
+	}
+	if got := resp.Header.Values("Set-Cookie"); len(got) != 2 || got[0] != "sid=1; Path=/" || got[1] != "ads=1; Domain=example.org" {
+		t.Errorf("Set-Cookie = %q, want only the local domain dropped", got)
+	}
+
+	resp, body := fetch("/")
+	want := `<a href="https://demo.example.com/a">a</a><script src="//demo.example.com/app.js"></script><a href="https://other.dev/">b</a>`
+	if body != want {
+		t.Errorf("body = %s, want %s", body, want)
+	}
+	if resp.ContentLength != int64(len(want)) {
+		t.Errorf("Content-Length = %d, want %d", resp.ContentLength, len(want))
+	}
+}
+
+func TestReplaceOrigin(t *testing.T) {
+	tests := []struct {
+		body, want string
+	}{
+		{`<a href="//localhost:3000/a">`, `<a href="//demo.example.com/a">`},
+		{`'//localhost:3000'`, `'//demo.example.com'`},
+		{`//localhost:3000`, `//demo.example.com`},
+		{`//localhost:30001/a //localhost:3000/b`, `//localhost:30001/a //demo.example.com/b`},
+		{`//localhost:3000.evil.com/`, `//localhost:3000.evil.com/`},
+	}
+	for _, tt := range tests {
+		got := string(replaceOrigin([]byte(tt.body), []byte("//localhost:3000"), []byte("//demo.example.com")))
+		if got != tt.want {
+			t.Errorf("replaceOrigin(%q) = %q, want %q", tt.body, got, tt.want)
+		}
+	}
+}
+
+func TestRewriteCookie(t *testing.T) {
+	tests := []struct {
+		toggles []string
+		cookie  string
+		want    string
+	}{
+		{[]string{"domain"}, "sid=1; Domain=.localhost; Path=/", "sid=1; Path=/"},
+		{[]string{"secure"}, "sid=1; Path=/", "sid=1; Path=/; Secure"},
+		{[]string{"secure"}, "sid=1; secure; Path=/", "sid=1; Path=/; Secure"},
+		{[]string{"samesite=lax"}, "sid=1; SameSite=Strict", "sid=1; SameSite=Lax"},
+		{[]string{"samesite=none"}, "sid=1; HttpOnly", "sid=1; HttpOnly; Secure; SameSite=None"},
+		{[]string{"domain", "secure"}, "sid=1; Domain=example.org", "sid=1; Domain=example.org; Secure"},
+	}
+
+	for _, tt := range tests {
+		c, err := ParseCookieRewrite(tt.toggles)
+		if err != nil {
+			t.Fatalf("ParseCookieRewrite(%q) error: %v", tt.toggles, err)
+		}
+		rw := &rewriter{hosts: []string{"localhost", "127.0.0.1", "::1"}, cookies: c}
+		if got := rw.rewriteCookie(tt.cookie); got != tt.want {
+			t.Errorf("%q: rewriteCookie(%q) = %q, want %q", tt.toggles, tt.cookie, got, tt.want)
+		}
+	}
+
+	for _, bad := range []string{"samesite=loose", "path"} {
+		if _, err := ParseCookieRewrite([]string{bad}); err == nil {
+			t.Errorf("ParseCookieRewrite(%q) succeeded, want an error", bad)
+		}
+	}
+}
+
+func TestCORS(t *testing.T) {
+	app := newApp(t)
+
+	chain := NewChain(zap.NewNop())
+	chain.AddCORS([]string{"https://app.example.com", "https://*.preview.dev"})
+	client := &http.Client{Transport: chain.Transport(http.DefaultTransport)}
+
+	tests := []struct {
+		method, origin string
+		preflight      bool
+		wantStatus     int
+		wantAllowed    bool
+	}{
+		{http.MethodOptions, "https://app.example.com", true, http.StatusNoContent, true},
+		{http.MethodOptions, "https://pr-7.preview.dev", true, http.StatusNoContent, true},
+		{http.MethodOptions, "https://evil.example", true, http.StatusOK, false},
+		{http.MethodGet, "https://app.example.com", false, http.StatusOK, true},
+		{http.MethodGet, "http://app.example.com", false, http.StatusOK, false},
+		{http.MethodGet, "", false, http.StatusOK, false},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest(tt.method, app.URL+"/api", nil)
+		if tt.origin != "" {
+			req.Header.Set("Origin", tt.origin)
+		}
+		if tt.preflight {
+			req.Header.Set("Access-Control-Request-Method", "PUT")
+			req.Header.Set("Access-Control-Request-Headers", "content-type")
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("%s from %q: %v", tt.method, tt.origin, err)
+		}
+		resp.Body.Close()
+
+		allowed := resp.Header.Get("Access-Control-Allow-Origin") == tt.origin && tt.origin != ""
+		if resp.StatusCode != tt.wantStatus || allowed != tt.wantAllowed {
+			t.Errorf("%s from %q = %d, allowed %v; want %d, allowed %v",
+				tt.method, tt.origin, resp.StatusCode, allowed, tt.wantStatus, tt.wantAllowed)
+		}
+		if tt.preflight && tt.wantAllowed && resp.Header.Get("Access-Control-Allow-Methods") != "PUT" {
+			t.Errorf("preflight from %q allowed methods %q, want PUT", tt.origin, resp.Header.Get("Access-Control-Allow-Methods"))
+		}
+	}
+
+	if err := ValidateCORSOrigins([]string{"*", "https://a.dev", "http://localhost:5173"}); err != nil {
+		t.Errorf("ValidateCORSOrigins() error: %v", err)
+	}
+	for _, bad := range []string{"app.example.com", "https://a.dev/path", "ftp://a.dev"} {
+		if ValidateCORSOrigins([]string{bad}) == nil {
+			t.Errorf("ValidateCORSOrigins(%q) succeeded, want an error", bad)
+		}
+	}
+}
+
+func TestCORSAnyOrigin(t *testing.T) {
+	app := newApp(t)
+
+	chain := NewChain(zap.NewNop())
+	chain.AddCORS([]string{"*", "https://app.example.com"})
+	client := &http.Client{Transport: chain.Transport(http.DefaultTransport)}
+
+	tests := []struct {
+		origin          string
+		wantOrigin      string
+		wantCredentials string
+	}{
+		// Any origin may read, but never with the user's cookies.
+		{"https://evil.example", "*", ""},
+		{"https://app.example.com", "https://app.example.com", "true"},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest(http.MethodGet, app.URL+"/api", nil)
+		req.Header.Set("Origin", tt.origin)
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("GET from %q: %v", tt.origin, err)
+		}
+		resp.Body.Close()
+
+		if got := resp.Header.Get("Access-Control-Allow-Origin"); got != tt.wantOrigin {
+			t.Errorf("GET from %q: Access-Control-Allow-Origin = %q, want %q", tt.origin, got, tt.wantOrigin)
+		}
+		if got := resp.Header.Get("Access-Control-Allow-Credentials"); got != tt.wantCredentials {
+			t.Errorf("GET from %q: Access-Control-Allow-Credentials = %q, want %q", tt.origin, got, tt.wantCredentials)
+		}
+	}
+}
+
+func TestShadow(t *testing.T) {
+	app := newApp(t)
+
+	mirrored := make(chan string, 1)
+	shadow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mirrored <- r.Method + " " + r.URL.RequestURI() + " " + string(body) + " " + r.Header.Get(ShadowHeader)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer shadow.Close()
+	target, _ := url.Parse(shadow.URL)
+
+	chain := NewChain(zap.NewNop())
+	chain.AddShadow(target, http.DefaultTransport)
+	client := &http.Client{Transport: chain.Transport(http.DefaultTransport)}
+
+	resp, err := client.Post(app.URL+"/orders?id=7", "text/plain", strings.NewReader("payload"))
+	if err != nil {
+		t.Fatalf("POST: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != "from app" {
+		t.Errorf("visitor got %d %q, want the app's response", resp.StatusCode, body)
+	}
+
+	select {
+	case got := <-mirrored:
+		if want := "POST /orders?id=7 payload 1"; got != want {
+			t.Errorf("shadow got %q, want %q", got, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("request was not mirrored")
+	}
+}
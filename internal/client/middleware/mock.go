@@ -0,0 +1,79 @@
+package middleware
+
+import (
+	"maps"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+// Mock answers requests for a path on the client itself, so endpoints the
+// local app does not implement yet can be demoed.
+type Mock struct {
+	Method string            // only this method; empty matches any
+	Path   string            // exact path, or a glob such as /api/users/*
+	Status int               // response status (default: 200)
+	Header map[string]string // response headers
+	Body   []byte            // response body
+	Delay  time.Duration     // wait this long before answering
+}
+
+func (m *Mock) matches(req *http.Request) bool {
+	if m.Method != "" && !strings.EqualFold(m.Method, req.Method) {
+		return false
+	}
+	ok, _ := path.Match(m.Path, req.URL.Path)
+	return ok
+}
+
+// AddMocks answers requests matching one of mocks instead of forwarding
+// them to the local app. The first matching mock wins; a mock with an
+// invalid glob never matches.
+func (c *Chain) AddMocks(mocks []Mock) {
+	compiled := make([]Mock, len(mocks))
+	for i, m := range mocks {
+		m.Header = maps.Clone(m.Header)
+		if m.Header == nil {
+			m.Header = make(map[string]string)
+		}
+		if len(m.Body) > 0 && !hasHeader(m.Header, "Content-Type") {
+			m.Header["Content-Type"] = http.DetectContentType(m.Body)
+		}
+		compiled[i] = m
+	}
+
+	c.OnRequest(func(req *http.Request) (*http.Response, error) {
+		for i := range compiled {
+			m := &compiled[i]
+			if !m.matches(req) {
+				continue
+			}
+			if m.Delay > 0 {
+				t := time.NewTimer(m.Delay)
+				defer t.Stop()
+				select {
+				case <-t.C:
+				case <-req.Context().Done():
+					return nil, req.Context().Err()
+				}
+			}
+			return mockResponse(&ExecResponse{
+				Status: m.Status,
+				Header: m.Header,
+				Body:   string(m.Body),
+			}), nil
+		}
+		return nil, nil
+	})
+}
+
+// hasHeader reports whether h sets name, in any letter case.
+func hasHeader(h map[string]string, name string) bool {
+	for k := range h {
+		if strings.EqualFold(k, name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,272 @@
+package middleware
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// maxRewriteBody is the largest HTML body rewritten. Larger bodies are
+// passed through untouched rather than held in memory.
+const maxRewriteBody = 4 << 20
+
+// Rewrite describes which references to the local app are rewritten.
+type Rewrite struct {
+	LocalHost string
+	LocalPort int
+	URLs      bool // rewrite absolute URLs in Location and Content-Location
+	HTML      bool // also rewrite links in text/html bodies
+	Cookies   CookieRewrite
+}
+
+// CookieRewrite selects the Set-Cookie attributes normalized for the
+// tunnel, so session logins work without changes to the app.
+type CookieRewrite struct {
+	Domain   bool   // drop Domain attributes naming the local host
+	Secure   bool   // mark cookies Secure, as visitors use HTTPS
+	SameSite string // set SameSite to Lax, Strict or None; None implies Secure
+}
+
+// Enabled reports whether any cookie attribute is rewritten.
+func (c CookieRewrite) Enabled() bool {
+	return c.Domain || c.Secure || c.SameSite != ""
+}
+
+// ParseCookieRewrite parses toggles such as "domain", "secure" and
+// "samesite=none".
+func ParseCookieRewrite(specs []string) (CookieRewrite, error) {
+	var c CookieRewrite
+	for _, spec := range specs {
+		key, value, _ := strings.Cut(strings.ToLower(strings.TrimSpace(spec)), "=")
+		switch key {
+		case "domain":
+			c.Domain = true
+		case "secure":
+			c.Secure = true
+		case "samesite":
+			switch value {
+			case "lax", "strict", "none":
+				c.SameSite = strings.ToUpper(value[:1]) + value[1:]
+			default:
+				return CookieRewrite{}, fmt.Errorf("invalid cookie rewrite %q: samesite must be lax, strict or none", spec)
+			}
+		default:
+			return CookieRewrite{}, fmt.Errorf("invalid cookie rewrite %q: use domain, secure or samesite=<lax|strict|none>", spec)
+		}
+	}
+	return c, nil
+}
+
+// Enabled reports whether r rewrites anything.
+func (r Rewrite) Enabled() bool {
+	return r.URLs || r.HTML || r.Cookies.Enabled()
+}
+
+// AddRewrite makes responses that point at the local app point at the
+// public tunnel host instead: absolute URLs in Location and
+// Content-Location and, with r.HTML, links in HTML pages. Apps that build
+// links from their own address, such as http://localhost:3000, then work
+// for remote visitors. r.Cookies adjusts Set-Cookie attributes for the
+// public host.
+func (c *Chain) AddRewrite(r Rewrite) {
+	port := strconv.Itoa(r.LocalPort)
+	hosts := []string{"localhost", "127.0.0.1", "::1"}
+	if h := strings.ToLower(r.LocalHost); h != "" && h != "localhost" && h != "127.0.0.1" && h != "::1" {
+		hosts = append(hosts, h)
+	}
+	var origins []string
+	for _, h := range hosts {
+		origins = append(origins, net.JoinHostPort(h, port))
+		if r.LocalPort == 80 || r.LocalPort == 443 {
+			origins = append(origins, hostLiteral(h))
+		}
+	}
+	rw := &rewriter{hosts: hosts, origins: origins, urls: r.URLs || r.HTML, html: r.HTML, cookies: r.Cookies}
+
+	c.OnResponse(func(resp *http.Response) error {
+		public := resp.Request.Header.Get("X-Forwarded-Host")
+		if public == "" {
+			return nil
+		}
+		scheme := resp.Request.Header.Get("X-Forwarded-Proto")
+		if scheme == "" {
+			scheme = "https"
+		}
+		return rw.rewrite(resp, scheme, public)
+	})
+}
+
+type rewriter struct {
+	hosts   []string // local host names, without port
+	origins []string // host:port forms the app may use in URLs
+	urls    bool
+	html    bool
+	cookies CookieRewrite
+}
+
+func (rw *rewriter) rewrite(resp *http.Response, scheme, public string) error {
+	if rw.urls {
+		for _, name := range []string{"Location", "Content-Location"} {
+			if v := resp.Header.Get(name); v != "" {
+				resp.Header.Set(name, rw.rewriteURL(v, scheme, public))
+			}
+		}
+	}
+
+	if cookies := resp.Header.Values("Set-Cookie"); len(cookies) > 0 && rw.cookies.Enabled() {
+		rewritten := make([]string, len(cookies))
+		for i, c := range cookies {
+			rewritten[i] = rw.rewriteCookie(c)
+		}
+		resp.Header["Set-Cookie"] = rewritten
+	}
+
+	if rw.html && isHTML(resp) {
+		return rw.rewriteBody(resp, scheme, public)
+	}
+	return nil
+}
+
+// rewriteURL points an absolute URL at the local app to the public host.
+// Relative URLs and other hosts are returned unchanged.
+func (rw *rewriter) rewriteURL(raw, scheme, public string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" || !rw.isLocal(u.Host) {
+		return raw
+	}
+	u.Scheme = scheme
+	u.Host = public
+	return u.String()
+}
+
+// rewriteCookie applies the cookie toggles to one Set-Cookie value.
+// Dropping a Domain that names the local host, which browsers reject on
+// the public host, leaves a host-only cookie for the tunnel.
+func (rw *rewriter) rewriteCookie(cookie string) string {
+	c := rw.cookies
+	secure := c.Secure || c.SameSite == "None"
+
+	parts := strings.Split(cookie, ";")
+	kept := parts[:1]
+	for _, attr := range parts[1:] {
+		key, value, _ := strings.Cut(strings.TrimSpace(attr), "=")
+		switch {
+		case c.Domain && strings.EqualFold(key, "domain") && rw.isLocalHost(strings.TrimPrefix(value, ".")):
+			continue
+		case secure && strings.EqualFold(key, "secure"):
+			continue
+		case c.SameSite != "" && strings.EqualFold(key, "samesite"):
+			continue
+		}
+		kept = append(kept, attr)
+	}
+	if secure {
+		kept = append(kept, " Secure")
+	}
+	if c.SameSite != "" {
+		kept = append(kept, " SameSite="+c.SameSite)
+	}
+	return strings.Join(kept, ";")
+}
+
+func (rw *rewriter) rewriteBody(resp *http.Response, scheme, public string) error {
+	if resp.ContentLength > maxRewriteBody {
+		return nil
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxRewriteBody+1))
+	if err != nil {
+		return err
+	}
+	if len(body) > maxRewriteBody {
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), resp.Body), resp.Body}
+		return nil
+	}
+	_ = resp.Body.Close()
+
+	for _, origin := range rw.origins {
+		body = replaceOrigin(body, []byte("http://"+origin), []byte(scheme+"://"+public))
+		body = replaceOrigin(body, []byte("https://"+origin), []byte(scheme+"://"+public))
+		body = replaceOrigin(body, []byte("//"+origin), []byte("//"+public))
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	return nil
+}
+
+// replaceOrigin replaces the URL prefix old with repl wherever the host
+// ends there, so //localhost:3000 is not found in //localhost:30001 or
+// //localhost in //localhost.example.com.
+func replaceOrigin(body, old, repl []byte) []byte {
+	var out []byte
+	i := 0
+	for {
+		j := bytes.Index(body[i:], old)
+		if j < 0 {
+			break
+		}
+		j += i
+		end := j + len(old)
+		out = append(out, body[i:j]...)
+		if end < len(body) && isHostByte(body[end]) {
+			out = append(out, old...)
+		} else {
+			out = append(out, repl...)
+		}
+		i = end
+	}
+	if out == nil {
+		return body
+	}
+	return append(out, body[i:]...)
+}
+
+// isHostByte reports whether b can continue the host or port of a URL.
+func isHostByte(b byte) bool {
+	return 'a' <= b && b <= 'z' || 'A' <= b && b <= 'Z' || '0' <= b && b <= '9' ||
+		b == '.' || b == '-' || b == ':' || b == '_'
+}
+
+func (rw *rewriter) isLocal(hostport string) bool {
+	for _, o := range rw.origins {
+		if strings.EqualFold(hostport, o) {
+			return true
+		}
+	}
+	return false
+}
+
+func (rw *rewriter) isLocalHost(host string) bool {
+	for _, h := range rw.hosts {
+		if strings.EqualFold(hostLiteral(host), hostLiteral(h)) {
+			return true
+		}
+	}
+	return false
+}
+
+// isHTML reports whether resp carries an uncompressed HTML page.
+func isHTML(resp *http.Response) bool {
+	if resp.Header.Get("Content-Encoding") != "" {
+		return false
+	}
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	return mediaType == "text/html" || mediaType == "application/xhtml+xml"
+}
+
+// hostLiteral brackets IPv6 addresses the way they appear in URLs.
+func hostLiteral(h string) string {
+	if strings.Contains(h, ":") && !strings.HasPrefix(h, "[") {
+		return "[" + h + "]"
+	}
+	return h
+}
@@ -0,0 +1,84 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// maxShadowBody is the largest request body mirrored. Requests with
+	// larger or unknown-length bodies are not mirrored.
+	maxShadowBody = 1 << 20
+	// maxShadowInFlight bounds mirrored requests waiting on the shadow
+	// target; further requests are not mirrored until some finish.
+	maxShadowInFlight = 64
+	// shadowTimeout bounds one mirrored request.
+	shadowTimeout = 30 * time.Second
+)
+
+// ShadowHeader marks mirrored requests, so the shadow target can tell them
+// apart from real traffic.
+const ShadowHeader = "X-Drip-Shadow"
+
+// AddShadow mirrors every request forwarded to the local app to target,
+// a base URL such as http://127.0.0.1:3001, in the background. Responses
+// from target are discarded and its failures never affect the visitor,
+// which makes it safe to try a new version of a service on real traffic.
+// Register it last so mocked requests are not mirrored.
+func (c *Chain) AddShadow(target *url.URL, rt http.RoundTripper) {
+	slots := make(chan struct{}, maxShadowInFlight)
+
+	c.OnRequest(func(req *http.Request) (*http.Response, error) {
+		var body []byte
+		if req.Body != nil && req.Body != http.NoBody {
+			if req.ContentLength < 0 || req.ContentLength > maxShadowBody {
+				return nil, nil
+			}
+			var err error
+			body, err = io.ReadAll(req.Body)
+			_ = req.Body.Close()
+			req.Body = io.NopCloser(bytes.NewReader(body))
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		select {
+		case slots <- struct{}{}:
+		default:
+			c.logger.Debug("Shadow target busy, not mirroring request", zap.String("path", req.URL.Path))
+			return nil, nil
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), shadowTimeout)
+		mirror := req.Clone(ctx)
+		mirror.URL.Scheme = target.Scheme
+		mirror.URL.Host = target.Host
+		mirror.Host = target.Host
+		mirror.Header.Set("Host", target.Host)
+		mirror.Header.Set(ShadowHeader, "1")
+		mirror.Body = http.NoBody
+		if body != nil {
+			mirror.Body = io.NopCloser(bytes.NewReader(body))
+		}
+
+		go func() {
+			defer func() { <-slots }()
+			defer cancel()
+			resp, err := rt.RoundTrip(mirror)
+			if err != nil {
+				c.logger.Debug("Shadow request failed", zap.String("path", mirror.URL.Path), zap.Error(err))
+				return
+			}
+			_, _ = io.Copy(io.Discard, resp.Body)
+			_ = resp.Body.Close()
+		}()
+		return nil, nil
+	})
+}
@@ -0,0 +1,138 @@
+// Package notify announces tunnels to chat channels through incoming
+// webhooks, so a preview URL can be shared the moment it is up.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	json "github.com/goccy/go-json"
+	"go.uber.org/zap"
+)
+
+// Supported target kinds.
+const (
+	KindSlack   = "slack"
+	KindDiscord = "discord"
+)
+
+const sendTimeout = 5 * time.Second
+
+// Target is an incoming webhook to post to.
+type Target struct {
+	Kind string
+	URL  string
+}
+
+// ParseTarget parses "slack:https://hooks.slack.com/..." or
+// "discord:https://discord.com/api/webhooks/...".
+func ParseTarget(s string) (Target, error) {
+	kind, rawURL, ok := strings.Cut(s, ":")
+	if !ok {
+		return Target{}, fmt.Errorf("invalid notify target %q: want slack:<webhook-url> or discord:<webhook-url>", s)
+	}
+	kind = strings.ToLower(kind)
+	if kind != KindSlack && kind != KindDiscord {
+		return Target{}, fmt.Errorf("unsupported notify target %q: want slack or discord", kind)
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return Target{}, fmt.Errorf("invalid %s webhook URL %q: must be https", kind, rawURL)
+	}
+	return Target{Kind: kind, URL: rawURL}, nil
+}
+
+// ParseTargets parses every entry, failing on the first invalid one.
+func ParseTargets(specs []string) ([]Target, error) {
+	targets := make([]Target, 0, len(specs))
+	for _, s := range specs {
+		t, err := ParseTarget(s)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, t)
+	}
+	return targets, nil
+}
+
+// Notifier posts tunnel lifecycle messages. A nil Notifier does nothing.
+type Notifier struct {
+	targets []Target
+	client  *http.Client
+	logger  *zap.Logger
+}
+
+// New returns a notifier, or nil when there are no targets.
+func New(targets []Target, logger *zap.Logger) *Notifier {
+	if len(targets) == 0 {
+		return nil
+	}
+	return &Notifier{
+		targets: targets,
+		client:  &http.Client{Timeout: sendTimeout},
+		logger:  logger,
+	}
+}
+
+// TunnelUp announces that publicURL now forwards to localAddr.
+func (n *Notifier) TunnelUp(publicURL, localAddr string) {
+	n.send(fmt.Sprintf(":rocket: Tunnel is up: %s → %s", publicURL, localAddr))
+}
+
+// TunnelDown announces that publicURL stopped working.
+func (n *Notifier) TunnelDown(publicURL string) {
+	n.send(fmt.Sprintf(":octagonal_sign: Tunnel closed: %s", publicURL))
+}
+
+// send posts text to every target. Failures are logged, never returned:
+// a broken webhook must not affect the tunnel.
+func (n *Notifier) send(text string) {
+	if n == nil {
+		return
+	}
+	for _, t := range n.targets {
+		if err := n.post(t, text); err != nil {
+			n.logger.Warn("Failed to send notification",
+				zap.String("target", t.Kind),
+				zap.Error(err),
+			)
+		}
+	}
+}
+
+func (n *Notifier) post(t Target, text string) error {
+	var payload any
+	switch t.Kind {
+	case KindDiscord:
+		payload = map[string]string{"content": text}
+	default:
+		payload = map[string]string{"text": text}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,28 @@
+package notify
+
+import "testing"
+
+func TestParseTarget(t *testing.T) {
+	tests := []struct {
+		in       string
+		wantKind string
+		wantErr  bool
+	}{
+		{"slack:https://hooks.slack.com/services/T/B/X", KindSlack, false},
+		{"Discord:https://discord.com/api/webhooks/1/abc", KindDiscord, false},
+		{"teams:https://example.com/hook", "", true},
+		{"slack:http://hooks.slack.com/services/T/B/X", "", true},
+		{"https://hooks.slack.com/services/T/B/X", "", true},
+		{"slack", "", true},
+	}
+	for _, tt := range tests {
+		got, err := ParseTarget(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseTarget(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got.Kind != tt.wantKind {
+			t.Errorf("ParseTarget(%q) kind = %q, want %q", tt.in, got.Kind, tt.wantKind)
+		}
+	}
+}
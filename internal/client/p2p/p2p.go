@@ -0,0 +1,188 @@
+// Package p2p establishes direct TCP connections between an exposing drip
+// client and a consumer using TCP simultaneous open. The server only
+// reports each peer's public address; callers fall back to the relayed
+// tunnel port whenever a direct connection cannot be made.
+package p2p
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	json "github.com/goccy/go-json"
+
+	"drip/internal/shared/protocol"
+)
+
+const (
+	helloMagic = "DRP2P1"
+
+	// punchRetryInterval spaces out connection attempts while the peer's
+	// NAT mapping is being opened.
+	punchRetryInterval = 100 * time.Millisecond
+	punchDialTimeout   = time.Second
+)
+
+// ErrPeerMismatch is returned when the directly connected peer does not
+// present the offer ID negotiated through the server.
+var ErrPeerMismatch = errors.New("direct peer did not present the expected offer")
+
+// Rendezvous describes how to reach the server's rendezvous endpoints.
+type Rendezvous struct {
+	ServerAddr string
+	TLSConfig  *tls.Config // nil for plain TCP servers
+	Token      string
+}
+
+// Dial asks the server for a direct connection to the tunnel on port and
+// punches through to the exposing client. It is used by consumers.
+func Dial(ctx context.Context, rv *Rendezvous, port int) (net.Conn, error) {
+	var resp protocol.P2PRendezvousResponse
+	local, err := rv.post(ctx, "/_drip/p2p/connect", protocol.P2PConnectRequest{Port: port}, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := punch(ctx, local, resp.PeerAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	hello := append([]byte(helloMagic), resp.ID...)
+	if _, err := conn.Write(hello); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// Accept answers offer by announcing this client to the server and punching
+// through to the consumer. It is used by exposing clients.
+func Accept(ctx context.Context, rv *Rendezvous, offer protocol.P2POffer) (net.Conn, error) {
+	var resp protocol.P2PRendezvousResponse
+	local, err := rv.post(ctx, "/_drip/p2p/announce", protocol.P2PAnnounceRequest{ID: offer.ID}, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := punch(ctx, local, resp.PeerAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetReadDeadline(deadline)
+	}
+	hello := make([]byte, len(helloMagic)+len(offer.ID))
+	if _, err := io.ReadFull(conn, hello); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	want := append([]byte(helloMagic), offer.ID...)
+	if subtle.ConstantTimeCompare(hello, want) != 1 {
+		conn.Close()
+		return nil, ErrPeerMismatch
+	}
+	_ = conn.SetReadDeadline(time.Time{})
+	return conn, nil
+}
+
+// post sends one rendezvous request from a fresh reusable socket and returns
+// that socket's local address so punching leaves through the same mapping.
+func (rv *Rendezvous) post(ctx context.Context, path string, req, out any) (string, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return "", err
+	}
+
+	dialer := &net.Dialer{Control: reuseControl}
+	raw, err := dialer.DialContext(ctx, "tcp", rv.ServerAddr)
+	if err != nil {
+		return "", fmt.Errorf("rendezvous dial failed: %w", err)
+	}
+	defer raw.Close()
+	localAddr := raw.LocalAddr().String()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = raw.SetDeadline(deadline)
+	}
+
+	conn := raw
+	scheme := "http"
+	if rv.TLSConfig != nil {
+		tlsConn := tls.Client(raw, rv.TLSConfig)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			return "", fmt.Errorf("rendezvous TLS handshake failed: %w", err)
+		}
+		conn = tlsConn
+		scheme = "https"
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, scheme+"://"+rv.ServerAddr+path, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Close = true
+	if rv.Token != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+rv.Token)
+	}
+	if err := httpReq.Write(conn); err != nil {
+		return "", err
+	}
+
+	resp, err := http.ReadResponse(bufio.NewReader(conn), httpReq)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("rendezvous failed: %s: %s", resp.Status, bytes.TrimSpace(data))
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return "", fmt.Errorf("invalid rendezvous response: %w", err)
+	}
+	return localAddr, nil
+}
+
+// punch repeatedly dials peer from local until a connection is made or ctx
+// ends. Both peers do this at once, so their SYNs cross and open each
+// other's NAT mappings.
+func punch(ctx context.Context, local, peer string) (net.Conn, error) {
+	localAddr, err := net.ResolveTCPAddr("tcp", local)
+	if err != nil {
+		return nil, err
+	}
+
+	dialer := &net.Dialer{
+		LocalAddr: localAddr,
+		Control:   reuseControl,
+		Timeout:   punchDialTimeout,
+	}
+
+	for {
+		conn, err := dialer.DialContext(ctx, "tcp", peer)
+		if err == nil {
+			return conn, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("direct connection to %s failed: %w", peer, err)
+		case <-time.After(punchRetryInterval):
+		}
+	}
+}
@@ -0,0 +1,23 @@
+//go:build windows
+
+package p2p
+
+import (
+	"syscall"
+
+	"golang.org/x/sys/windows"
+)
+
+// reuseControl lets several sockets share one local port, which hole
+// punching needs: the rendezvous connection and the punch attempts must
+// leave from the same NAT mapping.
+func reuseControl(_, _ string, c syscall.RawConn) error {
+	var sockErr error
+	err := c.Control(func(fd uintptr) {
+		sockErr = windows.SetsockoptInt(windows.Handle(fd), windows.SOL_SOCKET, windows.SO_REUSEADDR, 1)
+	})
+	if err != nil {
+		return err
+	}
+	return sockErr
+}
@@ -0,0 +1,103 @@
+package proxy
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/Azure/go-ntlmssp"
+)
+
+// authenticator produces Proxy-Authorization headers for one scheme, one
+// per round of a handshake.
+type authenticator interface {
+	scheme() string
+	// next returns the header for the next request, given the data the
+	// proxy sent with its last challenge.
+	next(challenge string) (string, error)
+}
+
+// authenticator picks the strongest scheme the proxy offers that we have
+// credentials for: Negotiate, then NTLM, then Basic. Negotiate uses a
+// Kerberos ticket if there is one and falls back to NTLM inside Negotiate,
+// which Windows proxies accept.
+func (d *Dialer) authenticator(u *url.URL, offers []string) authenticator {
+	offered := func(scheme string) bool {
+		for _, offer := range offers {
+			name, _, _ := strings.Cut(strings.TrimSpace(offer), " ")
+			if strings.EqualFold(name, scheme) {
+				return true
+			}
+		}
+		return false
+	}
+	user, pass, hasCreds := d.credentials(u)
+
+	if offered("Negotiate") {
+		if k := d.kerberosClient(); k != nil {
+			return &negotiateAuth{k: k, spn: "HTTP/" + u.Hostname()}
+		}
+		if hasCreds {
+			return &ntlmAuth{name: "Negotiate", user: user, pass: pass}
+		}
+	}
+	if offered("NTLM") && hasCreds {
+		return &ntlmAuth{name: "NTLM", user: user, pass: pass}
+	}
+	if offered("Basic") && hasCreds {
+		return &basicAuth{user: user, pass: pass}
+	}
+	return nil
+}
+
+var errRejected = errors.New("credentials rejected")
+
+type basicAuth struct {
+	user, pass string
+	sent       bool
+}
+
+func (a *basicAuth) scheme() string { return "Basic" }
+
+func (a *basicAuth) next(string) (string, error) {
+	if a.sent {
+		return "", fmt.Errorf("proxy authentication with Basic failed: %w", errRejected)
+	}
+	a.sent = true
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(a.user+":"+a.pass)), nil
+}
+
+// ntlmAuth runs the NTLM handshake: a NEGOTIATE message, then an
+// AUTHENTICATE message answering the proxy's CHALLENGE. The last two must
+// share a connection.
+type ntlmAuth struct {
+	name       string
+	user, pass string
+	step       int
+}
+
+func (a *ntlmAuth) scheme() string { return a.name }
+
+func (a *ntlmAuth) next(challenge string) (string, error) {
+	var msg []byte
+	var err error
+	switch a.step {
+	case 0:
+		msg, err = ntlmssp.NewNegotiateMessage("", "")
+	case 1:
+		var data []byte
+		if data, err = base64.StdEncoding.DecodeString(challenge); err != nil || len(data) == 0 {
+			return "", fmt.Errorf("proxy sent no usable %s challenge", a.name)
+		}
+		msg, err = ntlmssp.NewAuthenticateMessage(data, a.user, a.pass, nil)
+	default:
+		return "", fmt.Errorf("proxy authentication with %s failed: %w", a.name, errRejected)
+	}
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", a.name, err)
+	}
+	a.step++
+	return a.name + " " + base64.StdEncoding.EncodeToString(msg), nil
+}
@@ -0,0 +1,140 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// maxAuthRounds bounds the CONNECT requests sent to authenticate once:
+// NTLM needs three.
+const maxAuthRounds = 4
+
+// connect opens a CONNECT tunnel to addr through the HTTP proxy u,
+// authenticating with whichever scheme the proxy asks for that can be
+// used.
+func (d *Dialer) connect(ctx context.Context, u *url.URL, addr string) (net.Conn, error) {
+	conn, err := dialProxy(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+
+	var auth authenticator
+	var challenge string
+	for range maxAuthRounds {
+		header := ""
+		if auth != nil {
+			if header, err = auth.next(challenge); err != nil {
+				_ = conn.Close()
+				return nil, err
+			}
+		}
+
+		resp, br, err := roundTripConnect(ctx, conn, addr, header)
+		if err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+
+		switch resp.StatusCode {
+		case http.StatusOK:
+			if br.Buffered() > 0 {
+				return &bufferedConn{Conn: conn, r: br}, nil
+			}
+			return conn, nil
+		case http.StatusProxyAuthRequired:
+		default:
+			_ = conn.Close()
+			return nil, fmt.Errorf("proxy refused CONNECT to %s: %s", addr, resp.Status)
+		}
+
+		offers := resp.Header.Values("Proxy-Authenticate")
+		if auth == nil {
+			if auth = d.authenticator(u, offers); auth == nil {
+				_ = conn.Close()
+				return nil, fmt.Errorf("proxy requires authentication (%s); set credentials with --proxy-user or in the proxy URL", schemes(offers))
+			}
+		}
+		challenge = challengeFor(offers, auth.scheme())
+
+		// Drain the body so the connection can carry the next attempt,
+		// or start over on a new one if the proxy is closing it.
+		_ = conn.SetReadDeadline(time.Now().Add(dialTimeout))
+		_, drainErr := io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+		resp.Body.Close()
+		_ = conn.SetReadDeadline(time.Time{})
+		if drainErr != nil || resp.Close {
+			_ = conn.Close()
+			if conn, err = dialProxy(ctx, u); err != nil {
+				return nil, err
+			}
+		}
+	}
+	_ = conn.Close()
+	return nil, fmt.Errorf("proxy authentication with %s failed", auth.scheme())
+}
+
+// roundTripConnect sends a CONNECT request for addr on conn and reads the
+// response.
+func roundTripConnect(ctx context.Context, conn net.Conn, addr, authorization string) (*http.Response, *bufio.Reader, error) {
+	deadline := time.Now().Add(dialTimeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	_ = conn.SetDeadline(deadline)
+	defer conn.SetDeadline(time.Time{})
+
+	req := "CONNECT " + addr + " HTTP/1.1\r\nHost: " + addr + "\r\n"
+	if authorization != "" {
+		req += "Proxy-Authorization: " + authorization + "\r\n"
+	}
+	if _, err := io.WriteString(conn, req+"\r\n"); err != nil {
+		return nil, nil, err
+	}
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, &http.Request{Method: http.MethodConnect})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read proxy response: %w", err)
+	}
+	return resp, br, nil
+}
+
+// challengeFor returns the data the proxy sent with scheme in its
+// Proxy-Authenticate headers, if any.
+func challengeFor(offers []string, scheme string) string {
+	for _, offer := range offers {
+		name, data, _ := strings.Cut(strings.TrimSpace(offer), " ")
+		if strings.EqualFold(name, scheme) {
+			return strings.TrimSpace(data)
+		}
+	}
+	return ""
+}
+
+// schemes lists the authentication schemes in offers.
+func schemes(offers []string) string {
+	names := make([]string, 0, len(offers))
+	for _, offer := range offers {
+		name, _, _ := strings.Cut(strings.TrimSpace(offer), " ")
+		names = append(names, name)
+	}
+	return strings.Join(names, ", ")
+}
+
+// bufferedConn reads what the proxy sent after its CONNECT response
+// before reading from the connection again.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
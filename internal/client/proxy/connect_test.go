@@ -0,0 +1,81 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// fakeProxy answers CONNECT requests, asking for Basic credentials user:pass
+// first, and then echoes what the client sends.
+func fakeProxy(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	want := "Basic " + base64.StdEncoding.EncodeToString([]byte("user:pass"))
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				br := bufio.NewReader(conn)
+				for {
+					req, err := http.ReadRequest(br)
+					if err != nil {
+						return
+					}
+					if req.Header.Get("Proxy-Authorization") != want {
+						io.WriteString(conn, "HTTP/1.1 407 Proxy Authentication Required\r\nProxy-Authenticate: Basic realm=\"corp\"\r\nContent-Length: 6\r\n\r\ndenied")
+						continue
+					}
+					io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\n")
+					io.Copy(conn, br)
+					return
+				}
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestConnectBasicAuth(t *testing.T) {
+	addr := fakeProxy(t)
+
+	d, err := New(Config{URL: addr, Username: "user", Password: "pass"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := d.DialContext(context.Background(), "tcp", "tunnel.example.com:443")
+	if err != nil {
+		t.Fatalf("DialContext: %v", err)
+	}
+	defer conn.Close()
+
+	io.WriteString(conn, "ping")
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != "ping" {
+		t.Errorf("echo = %q, %v; want ping", buf, err)
+	}
+
+	d, _ = New(Config{URL: addr})
+	if _, err := d.DialContext(context.Background(), "tcp", "tunnel.example.com:443"); err == nil || !strings.Contains(err.Error(), "--proxy-user") {
+		t.Errorf("DialContext without credentials: err = %v, want a hint to set them", err)
+	}
+
+	d, _ = New(Config{URL: "http://user:wrong@" + addr})
+	if _, err := d.DialContext(context.Background(), "tcp", "tunnel.example.com:443"); err == nil {
+		t.Error("DialContext with wrong credentials succeeded")
+	}
+}
@@ -0,0 +1,77 @@
+package proxy
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/jcmturner/gokrb5/v8/client"
+	"github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/credentials"
+	"github.com/jcmturner/gokrb5/v8/spnego"
+	"go.uber.org/zap"
+)
+
+// kerberosClient returns a Kerberos client holding the ticket-granting
+// ticket of the user's credential cache, as left by kinit, or nil if
+// there is none. The cache is read again for every handshake, so a ticket
+// renewed meanwhile is picked up.
+func (d *Dialer) kerberosClient() *client.Client {
+	ccPath := os.Getenv("KRB5CCNAME")
+	if ccPath == "" {
+		ccPath = "/tmp/krb5cc_" + strconv.Itoa(os.Getuid())
+	}
+	ccPath = strings.TrimPrefix(ccPath, "FILE:")
+
+	ccache, err := credentials.LoadCCache(ccPath)
+	if err != nil {
+		d.logger.Debug("No Kerberos credential cache", zap.String("path", ccPath), zap.Error(err))
+		return nil
+	}
+
+	confPath := os.Getenv("KRB5_CONFIG")
+	if confPath == "" {
+		confPath = "/etc/krb5.conf"
+	}
+	conf, err := config.Load(confPath)
+	if err != nil {
+		d.logger.Debug("No Kerberos configuration", zap.String("path", confPath), zap.Error(err))
+		return nil
+	}
+
+	cl, err := client.NewFromCCache(ccache, conf, client.DisablePAFXFAST(true))
+	if err != nil {
+		d.logger.Debug("Unusable Kerberos credential cache", zap.String("path", ccPath), zap.Error(err))
+		return nil
+	}
+	return cl
+}
+
+// negotiateAuth sends a Kerberos service ticket for the proxy in a SPNEGO
+// token. Kerberos needs a single round.
+type negotiateAuth struct {
+	k    *client.Client
+	spn  string
+	sent bool
+}
+
+func (a *negotiateAuth) scheme() string { return "Negotiate" }
+
+func (a *negotiateAuth) next(string) (string, error) {
+	if a.sent {
+		return "", fmt.Errorf("proxy authentication with Kerberos failed: %w", errRejected)
+	}
+	a.sent = true
+
+	token, err := spnego.SPNEGOClient(a.k, a.spn).InitSecContext()
+	if err != nil {
+		return "", fmt.Errorf("failed to get a Kerberos ticket for %s: %w", a.spn, err)
+	}
+	data, err := token.Marshal()
+	if err != nil {
+		return "", fmt.Errorf("failed to encode SPNEGO token: %w", err)
+	}
+	return "Negotiate " + base64.StdEncoding.EncodeToString(data), nil
+}
@@ -0,0 +1,196 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dop251/goja"
+)
+
+const (
+	// pacMaxSize bounds the PAC files read.
+	pacMaxSize = 1 << 20
+	// pacTimeout bounds fetching a PAC file and each run of its
+	// FindProxyForURL.
+	pacTimeout = 10 * time.Second
+	// pacDNSTimeout bounds each name lookup a PAC file makes.
+	pacDNSTimeout = 2 * time.Second
+)
+
+// pacProxies returns the proxies the PAC file lists for connections to
+// addr, loading it on first use. A PAC file that fails to load is tried
+// again on the next connection.
+func (d *Dialer) pacProxies(ctx context.Context, addr string) ([]*url.URL, error) {
+	d.pacMu.Lock()
+	defer d.pacMu.Unlock()
+
+	if d.pac == nil {
+		src, err := loadPAC(ctx, d.pacURL)
+		if err != nil {
+			return nil, err
+		}
+		if d.pac, err = newPACScript(src); err != nil {
+			return nil, err
+		}
+	}
+
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	result, err := d.pac.findProxy("https://"+addr+"/", host)
+	if err != nil {
+		return nil, err
+	}
+	return parsePACResult(result)
+}
+
+// loadPAC reads the PAC file at location, an http(s) or file URL or a
+// path. It is fetched directly: a PAC file is not served through the
+// proxies it describes.
+func loadPAC(ctx context.Context, location string) (string, error) {
+	var r io.Reader
+	switch {
+	case strings.HasPrefix(location, "http://"), strings.HasPrefix(location, "https://"):
+		ctx, cancel := context.WithTimeout(ctx, pacTimeout)
+		defer cancel()
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, location, nil)
+		if err != nil {
+			return "", fmt.Errorf("invalid PAC URL: %w", err)
+		}
+		client := &http.Client{Transport: &http.Transport{Proxy: nil}}
+		resp, err := client.Do(req)
+		if err != nil {
+			return "", fmt.Errorf("failed to fetch PAC file: %w", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return "", fmt.Errorf("failed to fetch PAC file: %s", resp.Status)
+		}
+		r = resp.Body
+	default:
+		f, err := os.Open(strings.TrimPrefix(location, "file://"))
+		if err != nil {
+			return "", fmt.Errorf("failed to read PAC file: %w", err)
+		}
+		defer f.Close()
+		r = f
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r, pacMaxSize+1))
+	if err != nil {
+		return "", fmt.Errorf("failed to read PAC file: %w", err)
+	}
+	if len(data) > pacMaxSize {
+		return "", fmt.Errorf("PAC file is larger than %d bytes", pacMaxSize)
+	}
+	return string(data), nil
+}
+
+// pacScript is a loaded PAC file. Its JavaScript runtime runs one call at
+// a time.
+type pacScript struct {
+	mu sync.Mutex
+	vm *goja.Runtime
+	fn goja.Callable
+}
+
+// newPACScript runs src with the functions PAC files may call defined and
+// returns it if it defines FindProxyForURL.
+func newPACScript(src string) (*pacScript, error) {
+	vm := goja.New()
+	for name, fn := range pacFunctions(vm) {
+		if err := vm.Set(name, fn); err != nil {
+			return nil, err
+		}
+	}
+
+	timer := time.AfterFunc(pacTimeout, func() { vm.Interrupt("timeout") })
+	_, err := vm.RunScript("proxy.pac", src)
+	timer.Stop()
+	if err != nil {
+		return nil, fmt.Errorf("invalid PAC file: %w", err)
+	}
+
+	fn, ok := goja.AssertFunction(vm.Get("FindProxyForURL"))
+	if !ok {
+		return nil, errors.New("invalid PAC file: it does not define FindProxyForURL")
+	}
+	return &pacScript{vm: vm, fn: fn}, nil
+}
+
+// findProxy returns what the PAC file's FindProxyForURL returns for
+// rawURL, e.g. "PROXY proxy:8080; DIRECT".
+func (p *pacScript) findProxy(rawURL, host string) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.vm.ClearInterrupt()
+	timer := time.AfterFunc(pacTimeout, func() { p.vm.Interrupt("timeout") })
+	defer timer.Stop()
+
+	v, err := p.fn(goja.Undefined(), p.vm.ToValue(rawURL), p.vm.ToValue(host))
+	if err != nil {
+		return "", fmt.Errorf("PAC FindProxyForURL failed: %w", err)
+	}
+	if goja.IsUndefined(v) || goja.IsNull(v) {
+		return "", nil
+	}
+	return v.String(), nil
+}
+
+// parsePACResult turns a FindProxyForURL result into the proxies to try
+// in order, with nil for DIRECT. An empty result means DIRECT. SOCKS4
+// proxies are skipped, as only SOCKS5 is supported.
+func parsePACResult(result string) ([]*url.URL, error) {
+	if strings.TrimSpace(result) == "" {
+		return []*url.URL{nil}, nil
+	}
+	var proxies []*url.URL
+	for _, entry := range strings.Split(result, ";") {
+		fields := strings.Fields(entry)
+		if len(fields) == 0 {
+			continue
+		}
+		kind := strings.ToUpper(fields[0])
+		if kind == "DIRECT" {
+			proxies = append(proxies, nil)
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("invalid PAC result %q", entry)
+		}
+
+		var scheme string
+		switch kind {
+		case "PROXY", "HTTP":
+			scheme = "http"
+		case "HTTPS":
+			scheme = "https"
+		case "SOCKS", "SOCKS5":
+			scheme = "socks5"
+		case "SOCKS4":
+			continue
+		default:
+			return nil, fmt.Errorf("invalid PAC result %q", entry)
+		}
+		u, err := parseProxyURL(scheme + "://" + fields[1])
+		if err != nil {
+			return nil, err
+		}
+		proxies = append(proxies, u)
+	}
+	if len(proxies) == 0 {
+		return nil, errors.New("PAC file lists no usable proxy")
+	}
+	return proxies, nil
+}
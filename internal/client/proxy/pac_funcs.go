@@ -0,0 +1,264 @@
+package proxy
+
+import (
+	"context"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dop251/goja"
+)
+
+// clock is the clock the PAC date and time functions read.
+var clock = time.Now
+
+// pacFunctions returns the functions PAC files may call, as defined by
+// Netscape's original specification.
+func pacFunctions(vm *goja.Runtime) map[string]any {
+	return map[string]any{
+		"isPlainHostName": func(host string) bool {
+			return !strings.Contains(host, ".")
+		},
+		"dnsDomainIs": func(host, domain string) bool {
+			return strings.HasSuffix(strings.ToLower(host), strings.ToLower(domain))
+		},
+		"localHostOrDomainIs": func(host, hostdom string) bool {
+			host, hostdom = strings.ToLower(host), strings.ToLower(hostdom)
+			return host == hostdom || (!strings.Contains(host, ".") && strings.HasPrefix(hostdom, host+"."))
+		},
+		"isResolvable": func(host string) bool {
+			return resolveIPv4(host) != nil
+		},
+		"isInNet": func(host, pattern, mask string) bool {
+			ip := resolveIPv4(host)
+			p, m := net.ParseIP(pattern).To4(), net.ParseIP(mask).To4()
+			if ip == nil || p == nil || m == nil {
+				return false
+			}
+			return ip.Mask(net.IPMask(m)).Equal(p.Mask(net.IPMask(m)))
+		},
+		"dnsResolve": func(host string) goja.Value {
+			if ip := resolveIPv4(host); ip != nil {
+				return vm.ToValue(ip.String())
+			}
+			return goja.Null()
+		},
+		"myIpAddress": func() string {
+			return myIPAddress()
+		},
+		"dnsDomainLevels": func(host string) int {
+			return strings.Count(host, ".")
+		},
+		"shExpMatch": func(str, pattern string) bool {
+			return shExpMatch(str, pattern)
+		},
+		"weekdayRange": func(call goja.FunctionCall) goja.Value {
+			args, t := pacTimeArgs(call)
+			return vm.ToValue(weekdayRange(t, args))
+		},
+		"dateRange": func(call goja.FunctionCall) goja.Value {
+			args, t := pacTimeArgs(call)
+			return vm.ToValue(dateRange(t, args))
+		},
+		"timeRange": func(call goja.FunctionCall) goja.Value {
+			args, t := pacTimeArgs(call)
+			return vm.ToValue(timeRange(t, args))
+		},
+		"alert": func(string) {},
+	}
+}
+
+// resolveIPv4 returns host as an IPv4 address, looking it up if it is a
+// name, or nil.
+func resolveIPv4(host string) net.IP {
+	if ip := net.ParseIP(host); ip != nil {
+		return ip.To4()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), pacDNSTimeout)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupIP(ctx, "ip4", host)
+	if err != nil || len(addrs) == 0 {
+		return nil
+	}
+	return addrs[0].To4()
+}
+
+// myIPAddress returns the address of the first interface that is up and
+// not a loopback one.
+func myIPAddress() string {
+	ifaces, err := net.Interfaces()
+	if err == nil {
+		for _, iface := range ifaces {
+			if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+				continue
+			}
+			addrs, _ := iface.Addrs()
+			for _, addr := range addrs {
+				if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.To4() != nil {
+					return ipNet.IP.String()
+				}
+			}
+		}
+	}
+	return "127.0.0.1"
+}
+
+// shExpMatch matches str against a shell expression, where * matches any
+// run of characters and ? any single one.
+func shExpMatch(str, pattern string) bool {
+	expr := regexp.QuoteMeta(pattern)
+	expr = strings.ReplaceAll(expr, `\*`, ".*")
+	expr = strings.ReplaceAll(expr, `\?`, ".")
+	re, err := regexp.Compile("^" + expr + "$")
+	return err == nil && re.MatchString(str)
+}
+
+// pacTimeArgs returns the arguments of a date or time function as
+// strings, and the time to test them against: UTC when the last argument
+// is "GMT", local time otherwise.
+func pacTimeArgs(call goja.FunctionCall) ([]string, time.Time) {
+	args := make([]string, len(call.Arguments))
+	for i, v := range call.Arguments {
+		args[i] = strings.ToUpper(v.String())
+	}
+	t := clock()
+	if n := len(args); n > 0 && args[n-1] == "GMT" {
+		return args[:n-1], t.UTC()
+	}
+	return args, t
+}
+
+var weekdays = []string{"SUN", "MON", "TUE", "WED", "THU", "FRI", "SAT"}
+
+var months = []string{"JAN", "FEB", "MAR", "APR", "MAY", "JUN", "JUL", "AUG", "SEP", "OCT", "NOV", "DEC"}
+
+func indexOf(names []string, name string) int {
+	for i, n := range names {
+		if n == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// inRange reports whether v lies between lo and hi inclusive, wrapping
+// around when hi is smaller, as in FRI to MON.
+func inRange(v, lo, hi int) bool {
+	if lo <= hi {
+		return lo <= v && v <= hi
+	}
+	return v >= lo || v <= hi
+}
+
+// weekdayRange implements weekdayRange(wd1[, wd2]).
+func weekdayRange(t time.Time, args []string) bool {
+	if len(args) == 0 || len(args) > 2 {
+		return false
+	}
+	lo := indexOf(weekdays, args[0])
+	hi := lo
+	if len(args) == 2 {
+		hi = indexOf(weekdays, args[1])
+	}
+	if lo < 0 || hi < 0 {
+		return false
+	}
+	return inRange(int(t.Weekday()), lo, hi)
+}
+
+// dateField is one argument of dateRange: a day of the month, a month or
+// a year.
+type dateField struct {
+	kind  byte // 'd', 'm' or 'y'
+	value int
+}
+
+func parseDateField(arg string) (dateField, bool) {
+	if m := indexOf(months, arg); m >= 0 {
+		return dateField{'m', m}, true
+	}
+	n, err := strconv.Atoi(arg)
+	switch {
+	case err != nil || n < 1:
+		return dateField{}, false
+	case n <= 31:
+		return dateField{'d', n}, true
+	default:
+		return dateField{'y', n}, true
+	}
+}
+
+// dateKey orders a date by the fields given, most significant first.
+func dateKey(fields []dateField, t time.Time) (lo int, now int) {
+	for _, kind := range []byte{'y', 'm', 'd'} {
+		for _, f := range fields {
+			if f.kind != kind {
+				continue
+			}
+			lo = lo*10000 + f.value
+			switch kind {
+			case 'y':
+				now = now*10000 + t.Year()
+			case 'm':
+				now = now*10000 + int(t.Month()) - 1
+			case 'd':
+				now = now*10000 + t.Day()
+			}
+		}
+	}
+	return lo, now
+}
+
+// dateRange implements dateRange with one field, e.g. dateRange("JUN"),
+// or two sets of the same fields bounding a range, e.g.
+// dateRange(1, "JUN", 15, "AUG").
+func dateRange(t time.Time, args []string) bool {
+	fields := make([]dateField, len(args))
+	for i, arg := range args {
+		f, ok := parseDateField(arg)
+		if !ok {
+			return false
+		}
+		fields[i] = f
+	}
+
+	switch {
+	case len(fields) == 1:
+		want, now := dateKey(fields, t)
+		return want == now
+	case len(fields)%2 == 0 && len(fields) <= 6:
+		start, end := fields[:len(fields)/2], fields[len(fields)/2:]
+		lo, now := dateKey(start, t)
+		hi, _ := dateKey(end, t)
+		return inRange(now, lo, hi)
+	}
+	return false
+}
+
+// timeRange implements timeRange(hour), timeRange(h1, h2),
+// timeRange(h1, m1, h2, m2) and timeRange(h1, m1, s1, h2, m2, s2).
+func timeRange(t time.Time, args []string) bool {
+	n := make([]int, len(args))
+	for i, arg := range args {
+		v, err := strconv.Atoi(arg)
+		if err != nil {
+			return false
+		}
+		n[i] = v
+	}
+
+	secs := t.Hour()*3600 + t.Minute()*60 + t.Second()
+	switch len(n) {
+	case 1:
+		return t.Hour() == n[0]
+	case 2:
+		return inRange(secs, n[0]*3600, n[1]*3600)
+	case 4:
+		return inRange(secs, n[0]*3600+n[1]*60, n[2]*3600+n[3]*60)
+	case 6:
+		return inRange(secs, n[0]*3600+n[1]*60+n[2], n[3]*3600+n[4]*60+n[5])
+	}
+	return false
+}
@@ -0,0 +1,95 @@
+package proxy
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPACScript(t *testing.T) {
+	script, err := newPACScript(`
+function FindProxyForURL(url, host) {
+	if (isPlainHostName(host) || dnsDomainIs(host, ".corp.example")) {
+		return "DIRECT";
+	}
+	if (shExpMatch(host, "*.eu.example.com")) {
+		return "SOCKS eu-proxy:1080";
+	}
+	return "PROXY proxy1:8080; PROXY proxy2:8080; DIRECT";
+}`)
+	if err != nil {
+		t.Fatalf("newPACScript: %v", err)
+	}
+
+	tests := []struct {
+		host string
+		want []string
+	}{
+		{"intranet", []string{""}},
+		{"git.corp.example", []string{""}},
+		{"tunnel.eu.example.com", []string{"socks5://eu-proxy:1080"}},
+		{"tunnel.example.com", []string{"http://proxy1:8080", "http://proxy2:8080", ""}},
+	}
+	for _, tt := range tests {
+		result, err := script.findProxy("https://"+tt.host+":443/", tt.host)
+		if err != nil {
+			t.Fatalf("findProxy(%s): %v", tt.host, err)
+		}
+		proxies, err := parsePACResult(result)
+		if err != nil {
+			t.Fatalf("parsePACResult(%q): %v", result, err)
+		}
+		var got []string
+		for _, u := range proxies {
+			if u == nil {
+				got = append(got, "")
+			} else {
+				got = append(got, u.String())
+			}
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: proxies = %q, want %q", tt.host, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%s: proxies = %q, want %q", tt.host, got, tt.want)
+				break
+			}
+		}
+	}
+
+	if _, err := newPACScript("var x = 1;"); err == nil {
+		t.Error("script without FindProxyForURL accepted")
+	}
+	if _, err := parsePACResult("SOCKS4 old:1080"); err == nil {
+		t.Error("result with only a SOCKS4 proxy accepted")
+	}
+}
+
+func TestPACTimeFunctions(t *testing.T) {
+	// A Friday.
+	now := time.Date(2024, time.June, 14, 18, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		fn   func(time.Time, []string) bool
+		args []string
+		want bool
+	}{
+		{"weekday", weekdayRange, []string{"FRI"}, true},
+		{"weekdays", weekdayRange, []string{"MON", "THU"}, false},
+		{"weekend wrapping", weekdayRange, []string{"FRI", "MON"}, true},
+		{"month", dateRange, []string{"JUN"}, true},
+		{"day range", dateRange, []string{"1", "15"}, true},
+		{"date range", dateRange, []string{"1", "JUL", "15", "AUG"}, false},
+		{"year", dateRange, []string{"2024"}, true},
+		{"hour", timeRange, []string{"18"}, true},
+		{"hours", timeRange, []string{"9", "17"}, false},
+		{"overnight", timeRange, []string{"18", "0", "6", "0"}, true},
+	}
+	for _, tt := range tests {
+		if got := tt.fn(now, tt.args); got != tt.want {
+			t.Errorf("%s %v = %v, want %v", tt.name, tt.args, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,258 @@
+// Package proxy connects the client to its server through the outbound
+// proxies of networks that allow no direct connections. The proxy comes
+// from an explicit URL, a proxy auto-config (PAC) file or the usual
+// HTTPS_PROXY and NO_PROXY variables, in that order. HTTP proxies are
+// asked for a CONNECT tunnel and may require Basic, NTLM or Negotiate
+// (Kerberos) authentication; SOCKS5 proxies are supported too.
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/net/http/httpproxy"
+	xproxy "golang.org/x/net/proxy"
+)
+
+// dialTimeout bounds connecting to a proxy or, without one, to the server.
+const dialTimeout = 10 * time.Second
+
+// Direct, as Config.URL, connects directly even if the environment names a
+// proxy.
+const Direct = "direct"
+
+// Config selects the proxies used to reach the server.
+type Config struct {
+	// URL is the proxy for every connection, e.g. http://proxy:8080,
+	// https://proxy:8443 or socks5://proxy:1080, or Direct for none.
+	// Credentials may be given in it as user:password; a Windows domain
+	// goes before the user as DOMAIN\user.
+	URL string
+
+	// PAC is the http(s) URL or file path of a proxy auto-config script,
+	// used when URL is empty.
+	PAC string
+
+	// Username and Password authenticate to proxies whose URL has no
+	// credentials, such as the ones a PAC file returns.
+	Username string
+	Password string
+}
+
+// Dialer opens connections to the server through the configured proxy.
+// It is safe for concurrent use.
+type Dialer struct {
+	fixed    *url.URL
+	direct   bool
+	pacURL   string
+	username string
+	password string
+	env      func(*url.URL) (*url.URL, error)
+	logger   *zap.Logger
+
+	pacMu sync.Mutex
+	pac   *pacScript
+}
+
+// New returns a Dialer for cfg. A PAC file is only fetched once the first
+// connection is made.
+func New(cfg Config) (*Dialer, error) {
+	d := &Dialer{
+		pacURL:   cfg.PAC,
+		username: cfg.Username,
+		password: cfg.Password,
+		env:      httpproxy.FromEnvironment().ProxyFunc(),
+		logger:   zap.NewNop(),
+	}
+	switch {
+	case strings.EqualFold(cfg.URL, Direct):
+		d.direct = true
+	case cfg.URL != "":
+		u, err := parseProxyURL(cfg.URL)
+		if err != nil {
+			return nil, err
+		}
+		d.fixed = u
+	}
+	if d.fixed != nil && d.pacURL != "" {
+		return nil, errors.New("a proxy URL and a PAC file cannot both be given")
+	}
+	return d, nil
+}
+
+// SetLogger sets where the Dialer reports falling back to a direct
+// connection. It must be called before the first connection.
+func (d *Dialer) SetLogger(logger *zap.Logger) {
+	if d != nil && logger != nil {
+		d.logger = logger
+	}
+}
+
+// parseProxyURL parses a proxy URL, taking a bare host:port as an HTTP
+// proxy.
+func parseProxyURL(raw string) (*url.URL, error) {
+	if !strings.Contains(raw, "://") {
+		raw = "http://" + raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy URL %q: %w", raw, err)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q (use http, https or socks5)", u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return nil, fmt.Errorf("invalid proxy URL %q: no host", raw)
+	}
+	return u, nil
+}
+
+// DialContext connects to addr, a host:port, through the first proxy for
+// it that can be reached. A nil Dialer connects directly.
+func (d *Dialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	var direct net.Dialer
+	if d == nil {
+		return direct.DialContext(ctx, network, addr)
+	}
+
+	proxies := d.proxiesFor(ctx, addr)
+	var errs []error
+	for _, u := range proxies {
+		var conn net.Conn
+		var err error
+		if u == nil {
+			conn, err = direct.DialContext(ctx, network, addr)
+		} else {
+			conn, err = d.dialVia(ctx, u, addr)
+		}
+		if err == nil {
+			return conn, nil
+		}
+		if u != nil {
+			err = fmt.Errorf("proxy %s: %w", u.Host, err)
+		}
+		errs = append(errs, err)
+	}
+	return nil, errors.Join(errs...)
+}
+
+// DialTLSContext connects to addr like DialContext and runs a TLS
+// handshake with config over the connection. As with tls.Dial, the server
+// name defaults to the host of addr.
+func (d *Dialer) DialTLSContext(ctx context.Context, addr string, config *tls.Config) (*tls.Conn, error) {
+	raw, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if config.ServerName == "" {
+		host, _, _ := net.SplitHostPort(addr)
+		config = config.Clone()
+		config.ServerName = host
+	}
+	conn := tls.Client(raw, config)
+	if err := conn.HandshakeContext(ctx); err != nil {
+		_ = raw.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// Proxied reports whether connections to addr go through a proxy.
+func (d *Dialer) Proxied(addr string) bool {
+	if d == nil {
+		return false
+	}
+	proxies := d.proxiesFor(context.Background(), addr)
+	return len(proxies) > 0 && proxies[0] != nil
+}
+
+// proxiesFor returns the proxies to try for addr in order, with nil for a
+// direct connection.
+func (d *Dialer) proxiesFor(ctx context.Context, addr string) []*url.URL {
+	switch {
+	case d.direct:
+		return []*url.URL{nil}
+	case d.fixed != nil:
+		return []*url.URL{d.fixed}
+	case d.pacURL != "":
+		proxies, err := d.pacProxies(ctx, addr)
+		if err == nil {
+			return proxies
+		}
+		// Browsers go direct when the PAC file cannot be used; so do we,
+		// but say why.
+		d.logger.Warn("Proxy auto-config failed, connecting without it", zap.String("pac", d.pacURL), zap.Error(err))
+	}
+
+	u, err := d.env(&url.URL{Scheme: "https", Host: addr})
+	if err != nil {
+		d.logger.Warn("Invalid proxy in the environment, connecting directly", zap.Error(err))
+		return []*url.URL{nil}
+	}
+	return []*url.URL{u}
+}
+
+// dialVia opens a connection to addr through the proxy u.
+func (d *Dialer) dialVia(ctx context.Context, u *url.URL, addr string) (net.Conn, error) {
+	if u.Scheme == "socks5" || u.Scheme == "socks5h" {
+		var auth *xproxy.Auth
+		if user, pass, ok := d.credentials(u); ok {
+			auth = &xproxy.Auth{User: user, Password: pass}
+		}
+		socks, err := xproxy.SOCKS5("tcp", hostPort(u), auth, &net.Dialer{Timeout: dialTimeout})
+		if err != nil {
+			return nil, err
+		}
+		return socks.(xproxy.ContextDialer).DialContext(ctx, "tcp", addr)
+	}
+	return d.connect(ctx, u, addr)
+}
+
+// dialProxy opens a connection to the HTTP proxy u itself.
+func dialProxy(ctx context.Context, u *url.URL) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: dialTimeout}
+	if u.Scheme == "https" {
+		td := &tls.Dialer{NetDialer: dialer, Config: &tls.Config{ServerName: u.Hostname()}}
+		return td.DialContext(ctx, "tcp", hostPort(u))
+	}
+	return dialer.DialContext(ctx, "tcp", hostPort(u))
+}
+
+// credentials returns the user and password for the proxy u: those in its
+// URL, or else the configured ones.
+func (d *Dialer) credentials(u *url.URL) (string, string, bool) {
+	if u.User != nil {
+		pass, _ := u.User.Password()
+		return u.User.Username(), pass, true
+	}
+	if d.username != "" {
+		return d.username, d.password, true
+	}
+	return "", "", false
+}
+
+// hostPort returns the address of the proxy u, with its scheme's default
+// port if it has none.
+func hostPort(u *url.URL) string {
+	if u.Port() != "" {
+		return u.Host
+	}
+	port := "80"
+	switch u.Scheme {
+	case "https":
+		port = "443"
+	case "socks5", "socks5h":
+		port = "1080"
+	}
+	return net.JoinHostPort(u.Hostname(), port)
+}
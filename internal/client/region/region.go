@@ -0,0 +1,131 @@
+// Package region picks the closest of several equivalent servers. Each
+// candidate is timed by opening TCP connections to it; the fastest one is
+// used and the rest become failover targets, in order.
+package region
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// samples is how many connections are timed per region; the fastest counts,
+// so one slow handshake does not disqualify a region.
+const samples = 3
+
+// Endpoint is a named server address (host:port or a wss:// URL).
+type Endpoint struct {
+	Name string
+	Addr string
+}
+
+// Result is the measured connect time to an Endpoint. Err is set when the
+// region could not be reached.
+type Result struct {
+	Endpoint
+	RTT time.Duration
+	Err error
+}
+
+// Measure times connections to every endpoint concurrently and returns the
+// results fastest first, with unreachable endpoints last in their original
+// order.
+func Measure(ctx context.Context, endpoints []Endpoint, timeout time.Duration) []Result {
+	results := make([]Result, len(endpoints))
+	var wg sync.WaitGroup
+	for i, ep := range endpoints {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rtt, err := measure(ctx, ep.Addr, timeout)
+			results[i] = Result{Endpoint: ep, RTT: rtt, Err: err}
+		}()
+	}
+	wg.Wait()
+
+	slices.SortStableFunc(results, func(a, b Result) int {
+		if a.Err != nil || b.Err != nil {
+			return boolCmp(a.Err != nil, b.Err != nil)
+		}
+		return cmp.Compare(a.RTT, b.RTT)
+	})
+	return results
+}
+
+// Prefer moves the endpoint called name to the front, keeping the others in
+// order behind it as failover targets.
+func Prefer(results []Result, name string) ([]Result, error) {
+	i := slices.IndexFunc(results, func(r Result) bool { return r.Name == name })
+	if i < 0 {
+		names := make([]string, len(results))
+		for j, r := range results {
+			names[j] = r.Name
+		}
+		slices.Sort(names)
+		return nil, fmt.Errorf("unknown region %q (available: %s)", name, strings.Join(names, ", "))
+	}
+	ordered := make([]Result, 0, len(results))
+	ordered = append(ordered, results[i])
+	ordered = append(ordered, results[:i]...)
+	return append(ordered, results[i+1:]...), nil
+}
+
+func measure(ctx context.Context, addr string, timeout time.Duration) (time.Duration, error) {
+	dialAddr, err := hostPort(addr)
+	if err != nil {
+		return 0, err
+	}
+
+	best := time.Duration(-1)
+	dialer := net.Dialer{Timeout: timeout}
+	for range samples {
+		start := time.Now()
+		conn, dialErr := dialer.DialContext(ctx, "tcp", dialAddr)
+		if dialErr != nil {
+			err = dialErr
+			continue
+		}
+		rtt := time.Since(start)
+		_ = conn.Close()
+		if best < 0 || rtt < best {
+			best = rtt
+		}
+	}
+	if best < 0 {
+		return 0, err
+	}
+	return best, nil
+}
+
+// hostPort returns the address to dial for a server given as host:port or
+// as a wss:// URL.
+func hostPort(addr string) (string, error) {
+	if !strings.Contains(addr, "://") {
+		return addr, nil
+	}
+	u, err := url.Parse(addr)
+	if err != nil {
+		return "", err
+	}
+	if u.Port() != "" {
+		return u.Host, nil
+	}
+	return net.JoinHostPort(u.Hostname(), "443"), nil
+}
+
+func boolCmp(a, b bool) int {
+	switch {
+	case a == b:
+		return 0
+	case a:
+		return 1
+	default:
+		return -1
+	}
+}
@@ -0,0 +1,93 @@
+package region
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestMeasureOrdersReachableFirst(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	// Grab a free port and close it so dialing it is refused.
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	closedAddr := closed.Addr().String()
+	closed.Close()
+
+	results := Measure(context.Background(), []Endpoint{
+		{Name: "down", Addr: closedAddr},
+		{Name: "up", Addr: ln.Addr().String()},
+	}, time.Second)
+
+	if len(results) != 2 {
+		t.Fatalf("Measure() returned %d results, want 2", len(results))
+	}
+	if results[0].Name != "up" || results[0].Err != nil {
+		t.Errorf("results[0] = %+v, want reachable region up", results[0])
+	}
+	if results[1].Name != "down" || results[1].Err == nil {
+		t.Errorf("results[1] = %+v, want unreachable region down", results[1])
+	}
+}
+
+func TestPrefer(t *testing.T) {
+	results := []Result{
+		{Endpoint: Endpoint{Name: "eu"}},
+		{Endpoint: Endpoint{Name: "us"}},
+		{Endpoint: Endpoint{Name: "ap"}},
+	}
+
+	got, err := Prefer(results, "ap")
+	if err != nil {
+		t.Fatalf("Prefer() error = %v", err)
+	}
+	want := []string{"ap", "eu", "us"}
+	for i, r := range got {
+		if r.Name != want[i] {
+			t.Errorf("Prefer()[%d] = %s, want %s", i, r.Name, want[i])
+		}
+	}
+
+	if _, err := Prefer(results, "sa"); err == nil {
+		t.Errorf("Prefer(sa) error = nil, want unknown region")
+	}
+}
+
+func TestHostPort(t *testing.T) {
+	tests := []struct {
+		addr string
+		want string
+	}{
+		{"tunnel.example.com:443", "tunnel.example.com:443"},
+		{"wss://edge.example.com/drip", "edge.example.com:443"},
+		{"wss://edge.example.com:8443", "edge.example.com:8443"},
+		{"wss://[2001:db8::1]/", "[2001:db8::1]:443"},
+	}
+	for _, tt := range tests {
+		got, err := hostPort(tt.addr)
+		if err != nil {
+			t.Errorf("hostPort(%q) error = %v", tt.addr, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("hostPort(%q) = %q, want %q", tt.addr, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !windows
+
+package service
+
+// IsService is always false outside Windows: systemd and launchd run drip
+// as a normal process and stop it with SIGTERM.
+func IsService() bool {
+	return false
+}
+
+// Run calls run; stop is only used on Windows.
+func Run(run func() error, _ func()) error {
+	return run()
+}
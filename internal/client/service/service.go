@@ -0,0 +1,161 @@
+// Package service installs drip as an operating system service: a systemd
+// unit on Linux, a launchd job on macOS and a Windows service, so tunnels
+// start at boot and are restarted when they exit.
+package service
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+// DefaultName is the service name used when none is given.
+const DefaultName = "drip"
+
+// ErrUnsupported is returned on platforms without a supported service manager.
+var ErrUnsupported = errors.New("service installation is not supported on this platform")
+
+var validName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]{0,63}$`)
+
+// Config describes the service to install.
+type Config struct {
+	Name        string
+	Description string
+	Executable  string   // absolute path to the drip binary
+	Args        []string // arguments passed to Executable
+	LogPath     string   // launchd only; systemd logs to the journal
+}
+
+// Manager installs and controls one service. System reports whether it is
+// a system-wide service (run as root or an administrator) or a per-user one.
+type Manager interface {
+	Install(cfg Config) error
+	Uninstall() error
+	Start() error
+	Stop() error
+	Path() string
+	System() bool
+}
+
+// ValidateName rejects names that are unsafe in unit file names, launchd
+// labels or Windows service names.
+func ValidateName(name string) error {
+	if !validName.MatchString(name) {
+		return fmt.Errorf("invalid service name %q: use letters, digits, '.', '_' or '-'", name)
+	}
+	return nil
+}
+
+var systemdTemplate = template.Must(template.New("unit").Parse(`[Unit]
+Description={{.Description}}
+After=network-online.target
+Wants=network-online.target
+
+[Service]
+Type=simple
+ExecStart={{.ExecStart}}
+Restart=always
+RestartSec=5s
+LimitNOFILE=65536
+StandardOutput=journal
+StandardError=journal
+SyslogIdentifier={{.Name}}
+
+[Install]
+WantedBy={{.WantedBy}}
+`))
+
+// systemdUnit renders a unit file. User units are wanted by default.target
+// because multi-user.target does not exist in the user manager.
+func systemdUnit(cfg Config, system bool) string {
+	wantedBy := "default.target"
+	if system {
+		wantedBy = "multi-user.target"
+	}
+
+	words := append([]string{cfg.Executable}, cfg.Args...)
+	for i, w := range words {
+		words[i] = systemdQuote(w)
+	}
+
+	var buf bytes.Buffer
+	_ = systemdTemplate.Execute(&buf, map[string]string{
+		"Name":        cfg.Name,
+		"Description": cfg.Description,
+		"ExecStart":   strings.Join(words, " "),
+		"WantedBy":    wantedBy,
+	})
+	return buf.String()
+}
+
+// systemdQuote quotes a word for ExecStart. '%' and '$' are expanded by
+// systemd even inside quotes, so they are escaped too.
+func systemdQuote(s string) string {
+	s = strings.ReplaceAll(s, "%", "%%")
+	s = strings.ReplaceAll(s, "$", "$$")
+	if s != "" && !strings.ContainsAny(s, " \t\"'\\") {
+		return s
+	}
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return `"` + s + `"`
+}
+
+var launchdTemplate = template.Must(template.New("plist").Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>Label</key>
+	<string>{{.Label}}</string>
+	<key>ProgramArguments</key>
+	<array>
+{{- range .Args}}
+		<string>{{.}}</string>
+{{- end}}
+	</array>
+	<key>RunAtLoad</key>
+	<true/>
+	<key>KeepAlive</key>
+	<true/>
+	<key>ThrottleInterval</key>
+	<integer>5</integer>
+{{- if .LogPath}}
+	<key>StandardOutPath</key>
+	<string>{{.LogPath}}</string>
+	<key>StandardErrorPath</key>
+	<string>{{.LogPath}}</string>
+{{- end}}
+</dict>
+</plist>
+`))
+
+// launchdLabel is the job label for a service name.
+func launchdLabel(name string) string {
+	return "io.drip." + name
+}
+
+// launchdPlist renders a launchd property list. text/template does not
+// escape, so every string goes through xmlEscape.
+func launchdPlist(cfg Config) string {
+	args := make([]string, 0, len(cfg.Args)+1)
+	for _, a := range append([]string{cfg.Executable}, cfg.Args...) {
+		args = append(args, xmlEscape(a))
+	}
+
+	var buf bytes.Buffer
+	_ = launchdTemplate.Execute(&buf, map[string]any{
+		"Label":   xmlEscape(launchdLabel(cfg.Name)),
+		"Args":    args,
+		"LogPath": xmlEscape(cfg.LogPath),
+	})
+	return buf.String()
+}
+
+var xmlReplacer = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;", "'", "&apos;")
+
+func xmlEscape(s string) string {
+	return xmlReplacer.Replace(s)
+}
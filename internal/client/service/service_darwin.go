@@ -0,0 +1,94 @@
+//go:build darwin
+
+package service
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+type launchdManager struct {
+	name   string
+	system bool
+	path   string
+}
+
+// New returns the launchd manager for name. Root installs a LaunchDaemon;
+// other users get a LaunchAgent in ~/Library/LaunchAgents.
+func New(name string) (Manager, error) {
+	if err := ValidateName(name); err != nil {
+		return nil, err
+	}
+
+	m := &launchdManager{name: name, system: os.Geteuid() == 0}
+	file := launchdLabel(name) + ".plist"
+	if m.system {
+		m.path = filepath.Join("/Library/LaunchDaemons", file)
+	} else {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		m.path = filepath.Join(home, "Library", "LaunchAgents", file)
+	}
+	return m, nil
+}
+
+func (m *launchdManager) Path() string { return m.path }
+func (m *launchdManager) System() bool { return m.system }
+
+func (m *launchdManager) domain() string {
+	if m.system {
+		return "system"
+	}
+	return "gui/" + strconv.Itoa(os.Getuid())
+}
+
+func (m *launchdManager) Install(cfg Config) error {
+	if _, err := os.Stat(m.path); err == nil {
+		return fmt.Errorf("service %q is already installed at %s", m.name, m.path)
+	}
+	if cfg.LogPath != "" {
+		if err := os.MkdirAll(filepath.Dir(cfg.LogPath), 0700); err != nil {
+			return err
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(m.path), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(m.path, []byte(launchdPlist(cfg)), 0644); err != nil {
+		return fmt.Errorf("failed to write plist: %w", err)
+	}
+	return nil
+}
+
+func (m *launchdManager) Uninstall() error {
+	if _, err := os.Stat(m.path); os.IsNotExist(err) {
+		return fmt.Errorf("service %q is not installed", m.name)
+	}
+	_ = m.Stop()
+	return os.Remove(m.path)
+}
+
+// Start loads the job, which runs it because of RunAtLoad. A loaded job is
+// also started again at login or boot.
+func (m *launchdManager) Start() error {
+	return launchctl("bootstrap", m.domain(), m.path)
+}
+
+// Stop unloads the job; KeepAlive would restart it after a plain kill.
+func (m *launchdManager) Stop() error {
+	return launchctl("bootout", m.domain()+"/"+launchdLabel(m.name))
+}
+
+func launchctl(args ...string) error {
+	out, err := exec.Command("launchctl", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("launchctl %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+//go:build linux
+
+package service
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+type systemdManager struct {
+	name   string
+	system bool
+	path   string
+}
+
+// New returns the systemd manager for name. Root installs a system unit;
+// other users get a user unit under ~/.config/systemd/user.
+func New(name string) (Manager, error) {
+	if err := ValidateName(name); err != nil {
+		return nil, err
+	}
+	if _, err := exec.LookPath("systemctl"); err != nil {
+		return nil, fmt.Errorf("systemctl not found: only systemd is supported on Linux")
+	}
+
+	m := &systemdManager{name: name, system: os.Geteuid() == 0}
+	if m.system {
+		m.path = filepath.Join("/etc/systemd/system", name+".service")
+	} else {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		m.path = filepath.Join(home, ".config", "systemd", "user", name+".service")
+	}
+	return m, nil
+}
+
+func (m *systemdManager) Path() string { return m.path }
+func (m *systemdManager) System() bool { return m.system }
+
+func (m *systemdManager) Install(cfg Config) error {
+	if _, err := os.Stat(m.path); err == nil {
+		return fmt.Errorf("service %q is already installed at %s", m.name, m.path)
+	}
+	if err := os.MkdirAll(filepath.Dir(m.path), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(m.path, []byte(systemdUnit(cfg, m.system)), 0644); err != nil {
+		return fmt.Errorf("failed to write unit file: %w", err)
+	}
+	if err := m.systemctl("daemon-reload"); err != nil {
+		return err
+	}
+	return m.systemctl("enable", m.name+".service")
+}
+
+func (m *systemdManager) Uninstall() error {
+	if _, err := os.Stat(m.path); os.IsNotExist(err) {
+		return fmt.Errorf("service %q is not installed", m.name)
+	}
+	_ = m.systemctl("disable", "--now", m.name+".service")
+	if err := os.Remove(m.path); err != nil {
+		return err
+	}
+	return m.systemctl("daemon-reload")
+}
+
+func (m *systemdManager) Start() error {
+	return m.systemctl("start", m.name+".service")
+}
+
+func (m *systemdManager) Stop() error {
+	return m.systemctl("stop", m.name+".service")
+}
+
+func (m *systemdManager) systemctl(args ...string) error {
+	if !m.system {
+		args = append([]string{"--user"}, args...)
+	}
+	out, err := exec.Command("systemctl", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("systemctl %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
@@ -0,0 +1,11 @@
+//go:build !linux && !darwin && !windows
+
+package service
+
+// New reports that this platform has no supported service manager.
+func New(name string) (Manager, error) {
+	if err := ValidateName(name); err != nil {
+		return nil, err
+	}
+	return nil, ErrUnsupported
+}
@@ -0,0 +1,71 @@
+package service
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSystemdUnit(t *testing.T) {
+	cfg := Config{
+		Name:        "drip",
+		Description: "Drip tunnels (drip)",
+		Executable:  "/usr/local/bin/drip",
+		Args:        []string{"start", "--config", "/home/me/My Config/50%.yaml", "--all"},
+	}
+
+	tests := []struct {
+		system bool
+		want   []string
+	}{
+		{true, []string{
+			`ExecStart=/usr/local/bin/drip start --config "/home/me/My Config/50%%.yaml" --all`,
+			"WantedBy=multi-user.target",
+		}},
+		{false, []string{"WantedBy=default.target"}},
+	}
+
+	for _, tt := range tests {
+		unit := systemdUnit(cfg, tt.system)
+		for _, line := range tt.want {
+			if !strings.Contains(unit, line+"\n") {
+				t.Errorf("systemdUnit(system=%v) missing %q:\n%s", tt.system, line, unit)
+			}
+		}
+	}
+}
+
+func TestLaunchdPlist(t *testing.T) {
+	plist := launchdPlist(Config{
+		Name:       "drip",
+		Executable: "/usr/local/bin/drip",
+		Args:       []string{"start", "--config", "/Users/me/a&b.yaml", "--all"},
+		LogPath:    "/Users/me/.drip/daemons/drip.log",
+	})
+
+	for _, want := range []string{
+		"<string>io.drip.drip</string>",
+		"<string>/usr/local/bin/drip</string>",
+		"<string>/Users/me/a&amp;b.yaml</string>",
+		"<key>StandardOutPath</key>",
+	} {
+		if !strings.Contains(plist, want) {
+			t.Errorf("launchdPlist() missing %q:\n%s", want, plist)
+		}
+	}
+}
+
+func TestValidateName(t *testing.T) {
+	for name, ok := range map[string]bool{
+		"drip":      true,
+		"drip-prod": true,
+		"a.b_c":     true,
+		"":          false,
+		"-drip":     false,
+		"drip/x":    false,
+		"drip prod": false,
+	} {
+		if err := ValidateName(name); (err == nil) != ok {
+			t.Errorf("ValidateName(%q) error = %v, want ok=%v", name, err, ok)
+		}
+	}
+}
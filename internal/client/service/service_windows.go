@@ -0,0 +1,204 @@
+//go:build windows
+
+package service
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+const stopTimeout = 20 * time.Second
+
+type windowsManager struct {
+	name string
+}
+
+// New returns the Windows service manager for name. Installing and
+// controlling services needs an elevated prompt.
+func New(name string) (Manager, error) {
+	if err := ValidateName(name); err != nil {
+		return nil, err
+	}
+	return &windowsManager{name: name}, nil
+}
+
+func (m *windowsManager) Path() string { return `HKLM\SYSTEM\CurrentControlSet\Services\` + m.name }
+func (m *windowsManager) System() bool { return true }
+
+func (m *windowsManager) Install(cfg Config) error {
+	scm, err := connect()
+	if err != nil {
+		return err
+	}
+	defer scm.Disconnect()
+
+	if s, err := scm.OpenService(m.name); err == nil {
+		s.Close()
+		return fmt.Errorf("service %q is already installed", m.name)
+	}
+
+	s, err := scm.CreateService(m.name, cfg.Executable, mgr.Config{
+		DisplayName:      cfg.Description,
+		Description:      cfg.Description,
+		StartType:        mgr.StartAutomatic,
+		DelayedAutoStart: true,
+	}, cfg.Args...)
+	if err != nil {
+		return fmt.Errorf("failed to create service: %w", err)
+	}
+	defer s.Close()
+
+	err = s.SetRecoveryActions([]mgr.RecoveryAction{
+		{Type: mgr.ServiceRestart, Delay: 5 * time.Second},
+		{Type: mgr.ServiceRestart, Delay: 5 * time.Second},
+		{Type: mgr.ServiceRestart, Delay: 30 * time.Second},
+	}, 24*60*60)
+	if err != nil {
+		return fmt.Errorf("failed to set recovery actions: %w", err)
+	}
+	return nil
+}
+
+func (m *windowsManager) Uninstall() error {
+	scm, s, err := m.open()
+	if err != nil {
+		return err
+	}
+	defer scm.Disconnect()
+	defer s.Close()
+
+	_ = stopService(s)
+	if err := s.Delete(); err != nil {
+		return fmt.Errorf("failed to delete service: %w", err)
+	}
+	return nil
+}
+
+func (m *windowsManager) Start() error {
+	scm, s, err := m.open()
+	if err != nil {
+		return err
+	}
+	defer scm.Disconnect()
+	defer s.Close()
+
+	if err := s.Start(); err != nil {
+		return fmt.Errorf("failed to start service: %w", err)
+	}
+	return nil
+}
+
+func (m *windowsManager) Stop() error {
+	scm, s, err := m.open()
+	if err != nil {
+		return err
+	}
+	defer scm.Disconnect()
+	defer s.Close()
+
+	return stopService(s)
+}
+
+func (m *windowsManager) open() (*mgr.Mgr, *mgr.Service, error) {
+	scm, err := connect()
+	if err != nil {
+		return nil, nil, err
+	}
+	s, err := scm.OpenService(m.name)
+	if err != nil {
+		scm.Disconnect()
+		return nil, nil, fmt.Errorf("service %q is not installed", m.name)
+	}
+	return scm, s, nil
+}
+
+func connect() (*mgr.Mgr, error) {
+	scm, err := mgr.Connect()
+	if errors.Is(err, windows.ERROR_ACCESS_DENIED) {
+		return nil, fmt.Errorf("access denied: run this command from an elevated prompt")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to the service manager: %w", err)
+	}
+	return scm, nil
+}
+
+// stopService asks the service to stop and waits until it has.
+func stopService(s *mgr.Service) error {
+	status, err := s.Control(svc.Stop)
+	if errors.Is(err, windows.ERROR_SERVICE_NOT_ACTIVE) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to stop service: %w", err)
+	}
+
+	deadline := time.Now().Add(stopTimeout)
+	for status.State != svc.Stopped {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("service did not stop within %s", stopTimeout)
+		}
+		time.Sleep(300 * time.Millisecond)
+		if status, err = s.Query(); err != nil {
+			return fmt.Errorf("failed to query service: %w", err)
+		}
+	}
+	return nil
+}
+
+// IsService reports whether the process was started by the service manager.
+func IsService() bool {
+	ok, err := svc.IsWindowsService()
+	return err == nil && ok
+}
+
+// Run reports to the service manager while run executes. A stop or
+// shutdown request calls stop, which must make run return.
+func Run(run func() error, stop func()) error {
+	h := &handler{run: run, stop: stop}
+	if err := svc.Run("", h); err != nil {
+		return err
+	}
+	return h.err
+}
+
+type handler struct {
+	run  func() error
+	stop func()
+	err  error
+}
+
+func (h *handler) Execute(_ []string, requests <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	status <- svc.Status{State: svc.StartPending}
+
+	done := make(chan error, 1)
+	go func() { done <- h.run() }()
+
+	status <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+
+	for {
+		select {
+		case h.err = <-done:
+			if h.err != nil {
+				// A non-zero exit code triggers the recovery actions.
+				return true, 1
+			}
+			return false, 0
+		case req := <-requests:
+			switch req.Cmd {
+			case svc.Interrogate:
+				status <- req.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				status <- svc.Status{State: svc.StopPending}
+				h.stop()
+				h.err = <-done
+				return false, 0
+			}
+		}
+	}
+}
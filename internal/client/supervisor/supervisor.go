@@ -0,0 +1,447 @@
+// Package supervisor keeps a changing set of named tunnels connected in one
+// process. Controllers that discover services on their own (Kubernetes,
+// Docker, the daemon control socket) declare which tunnels should exist and
+// the supervisor connects, reconnects and tears them down.
+package supervisor
+
+import (
+	"net"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"drip/internal/client/proxy"
+	"drip/internal/client/tcp"
+	"drip/internal/shared/protocol"
+	"drip/internal/shared/stats"
+
+	"go.uber.org/zap"
+)
+
+const (
+	minBackoff = time.Second
+	maxBackoff = 30 * time.Second
+
+	// speedInterval is how often the traffic rate of a connected tunnel
+	// is sampled.
+	speedInterval = time.Second
+)
+
+// Status is a snapshot of one supervised tunnel.
+type Status struct {
+	Name      string    `json:"name"`
+	Type      string    `json:"type"`
+	Local     string    `json:"local"`
+	URL       string    `json:"url,omitempty"`
+	Connected bool      `json:"connected"`
+	Paused    bool      `json:"paused,omitempty"`
+	Since     time.Time `json:"since"`
+	LastError string    `json:"last_error,omitempty"`
+
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// Traffic since the tunnel was added, and its current rate in
+	// bytes per second
+	BytesIn  int64 `json:"bytes_in"`
+	BytesOut int64 `json:"bytes_out"`
+	SpeedIn  int64 `json:"speed_in"`
+	SpeedOut int64 `json:"speed_out"`
+}
+
+// Event reports a tunnel coming up or going down. Err is set when a
+// connection attempt failed.
+type Event struct {
+	Name string
+	URL  string
+	Up   bool
+	Err  error
+}
+
+// Supervisor runs tunnels by name. The zero value is not usable; call New.
+type Supervisor struct {
+	logger       *zap.Logger
+	onEvent      func(Event)
+	tunnelLogger func(name string) *zap.Logger
+	proxy        *proxy.Dialer
+
+	mu      sync.Mutex
+	tunnels map[string]*entry
+	closed  bool
+	wg      sync.WaitGroup
+}
+
+type entry struct {
+	cfg     tcp.ConnectorConfig
+	stop    chan struct{}
+	traffic *stats.TrafficStats
+
+	mu     sync.Mutex
+	status Status
+	client tcp.TunnelClient       // while connected
+	rules  []protocol.RequestRule // sent on every (re)connect
+}
+
+// New creates an empty supervisor.
+func New(logger *zap.Logger) *Supervisor {
+	s := &Supervisor{
+		logger:  logger,
+		onEvent: func(Event) {},
+		tunnels: make(map[string]*entry),
+	}
+	s.tunnelLogger = s.defaultTunnelLogger
+	return s
+}
+
+func (s *Supervisor) defaultTunnelLogger(name string) *zap.Logger {
+	return s.logger.With(zap.String("tunnel", name))
+}
+
+// SetTunnelLogger makes the tunnel called name log to fn(name), e.g. to
+// give each tunnel its own log file. By default tunnels share the
+// supervisor's logger.
+func (s *Supervisor) SetTunnelLogger(fn func(name string) *zap.Logger) {
+	if fn == nil {
+		fn = s.defaultTunnelLogger
+	}
+	s.mu.Lock()
+	s.tunnelLogger = fn
+	s.mu.Unlock()
+}
+
+// SetProxy makes tunnels reach their servers through p. It must be called
+// before any tunnel is added.
+func (s *Supervisor) SetProxy(p *proxy.Dialer) {
+	s.mu.Lock()
+	s.proxy = p
+	s.mu.Unlock()
+}
+
+// SetEventHandler registers fn to be called from tunnel goroutines whenever
+// a tunnel connects, disconnects or fails to connect.
+func (s *Supervisor) SetEventHandler(fn func(Event)) {
+	if fn == nil {
+		fn = func(Event) {}
+	}
+	s.mu.Lock()
+	s.onEvent = fn
+	s.mu.Unlock()
+}
+
+// Set starts the tunnel called name, or restarts it if cfg differs from the
+// configuration it is running with. It reports whether anything changed.
+func (s *Supervisor) Set(name string, cfg tcp.ConnectorConfig) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return false
+	}
+	if old, ok := s.tunnels[name]; ok {
+		if reflect.DeepEqual(old.cfg, cfg) {
+			return false
+		}
+		close(old.stop)
+	}
+	s.start(name, cfg)
+	return true
+}
+
+// Add starts the tunnel called name unless a tunnel with that name exists.
+func (s *Supervisor) Add(name string, cfg tcp.ConnectorConfig) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.tunnels[name]; ok || s.closed {
+		return false
+	}
+	s.start(name, cfg)
+	return true
+}
+
+// start runs a new entry for name. s.mu must be held.
+func (s *Supervisor) start(name string, cfg tcp.ConnectorConfig) {
+	e := &entry{
+		cfg:     cfg,
+		stop:    make(chan struct{}),
+		traffic: stats.NewTrafficStats(),
+		rules:   cfg.RequestRules,
+		status: Status{
+			Name:   name,
+			Type:   string(cfg.TunnelType),
+			Local:  localAddr(cfg),
+			Since:  time.Now(),
+			Labels: cfg.Labels,
+		},
+	}
+	s.tunnels[name] = e
+
+	s.wg.Add(1)
+	go s.run(name, e)
+}
+
+// Remove stops and forgets the tunnel called name.
+func (s *Supervisor) Remove(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.tunnels[name]
+	if !ok {
+		return false
+	}
+	close(e.stop)
+	delete(s.tunnels, name)
+	return true
+}
+
+// SetPaused pauses or resumes the tunnel called name, see
+// tcp.TunnelClient.SetPaused. The state is kept across reconnects. It
+// reports false if there is no such tunnel; the error, if any, comes from
+// telling the server.
+func (s *Supervisor) SetPaused(name string, paused bool) (bool, error) {
+	s.mu.Lock()
+	e, ok := s.tunnels[name]
+	s.mu.Unlock()
+	if !ok {
+		return false, nil
+	}
+
+	e.mu.Lock()
+	e.status.Paused = paused
+	client := e.client
+	e.mu.Unlock()
+	if client == nil {
+		return true, nil
+	}
+	return true, client.SetPaused(paused)
+}
+
+// SetRequestRules replaces the server-side request filtering rules of the
+// tunnel called name, see tcp.TunnelClient.UpdateRequestRules. The rules
+// are kept across reconnects. It reports false if there is no such
+// tunnel; the error, if any, comes from the server turning them down.
+func (s *Supervisor) SetRequestRules(name string, rules []protocol.RequestRule) (bool, error) {
+	s.mu.Lock()
+	e, ok := s.tunnels[name]
+	s.mu.Unlock()
+	if !ok {
+		return false, nil
+	}
+
+	e.mu.Lock()
+	previous := e.rules
+	e.rules = rules
+	client := e.client
+	e.mu.Unlock()
+	if client == nil {
+		return true, nil
+	}
+	if err := client.UpdateRequestRules(rules); err != nil {
+		e.mu.Lock()
+		e.rules = previous
+		e.mu.Unlock()
+		return true, err
+	}
+	return true, nil
+}
+
+// Names returns the supervised tunnel names in sorted order.
+func (s *Supervisor) Names() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	names := make([]string, 0, len(s.tunnels))
+	for name := range s.tunnels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// List returns the status of every tunnel, sorted by name.
+func (s *Supervisor) List() []Status {
+	s.mu.Lock()
+	entries := make([]*entry, 0, len(s.tunnels))
+	for _, e := range s.tunnels {
+		entries = append(entries, e)
+	}
+	s.mu.Unlock()
+
+	list := make([]Status, 0, len(entries))
+	for _, e := range entries {
+		e.mu.Lock()
+		st := e.status
+		e.mu.Unlock()
+		snapshot := e.traffic.GetSnapshot()
+		st.BytesIn, st.BytesOut = snapshot.TotalBytesIn, snapshot.TotalBytesOut
+		if st.Connected {
+			st.SpeedIn, st.SpeedOut = snapshot.SpeedIn, snapshot.SpeedOut
+		}
+		list = append(list, st)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// Close stops every tunnel and waits for them to disconnect.
+func (s *Supervisor) Close() {
+	s.mu.Lock()
+	if !s.closed {
+		s.closed = true
+		for name, e := range s.tunnels {
+			close(e.stop)
+			delete(s.tunnels, name)
+		}
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+}
+
+func (s *Supervisor) emit(ev Event) {
+	s.mu.Lock()
+	fn := s.onEvent
+	s.mu.Unlock()
+	fn(ev)
+}
+
+// run keeps one tunnel connected until its stop channel is closed.
+func (s *Supervisor) run(name string, e *entry) {
+	defer s.wg.Done()
+
+	s.mu.Lock()
+	tunnelLogger := s.tunnelLogger
+	dialer := s.proxy
+	s.mu.Unlock()
+	logger := tunnelLogger(name)
+
+	cfg := e.cfg
+	if cfg.Proxy == nil {
+		cfg.Proxy = dialer
+	}
+	cfg.Stats = e.traffic
+	cfg.Resume = tcp.NewResumeState()
+	backoff := minBackoff
+	failovers := 0
+	for {
+		e.mu.Lock()
+		cfg.RequestRules = e.rules
+		e.mu.Unlock()
+		client := tcp.NewTunnelClient(&cfg, logger)
+		if err := client.Connect(); err != nil {
+			e.update(func(st *Status) {
+				st.Connected = false
+				st.LastError = err.Error()
+			})
+			s.emit(Event{Name: name, Err: err})
+
+			// Try every other region before backing off.
+			if failovers < len(cfg.FallbackAddrs) && cfg.FailOver() {
+				failovers++
+				continue
+			}
+			failovers = 0
+
+			select {
+			case <-e.stop:
+				return
+			case <-time.After(backoff):
+			}
+			backoff = min(backoff*2, maxBackoff)
+			continue
+		}
+
+		// Keep the assigned subdomain so reconnects get the same URL.
+		if cfg.Subdomain == "" {
+			cfg.Subdomain = client.GetSubdomain()
+		}
+		backoff = minBackoff
+		failovers = 0
+
+		url := client.GetURL()
+		// SetPaused either sees the client or its state is applied here.
+		e.mu.Lock()
+		e.status.URL = url
+		e.status.Connected = true
+		connectedAt := time.Now()
+		e.status.Since = connectedAt
+		e.status.LastError = ""
+		e.client = client
+		paused := e.status.Paused
+		e.mu.Unlock()
+		if paused {
+			if err := client.SetPaused(true); err != nil {
+				logger.Warn("Server did not pause the tunnel", zap.Error(err))
+			}
+		}
+		s.emit(Event{Name: name, URL: url, Up: true})
+
+		disconnected := make(chan struct{})
+		go func() {
+			client.Wait()
+			close(disconnected)
+		}()
+
+		connected := e.waitDisconnect(disconnected)
+		e.setClient(nil)
+		if !connected {
+			_ = client.Close()
+			s.emit(Event{Name: name, URL: url})
+			return
+		}
+
+		e.update(func(st *Status) {
+			st.Connected = false
+			st.Since = time.Now()
+		})
+		s.emit(Event{Name: name, URL: url})
+
+		// With a resume token the tunnel is taken back at once, unless it
+		// dropped right after coming up.
+		if cfg.Resume.Token(cfg.ServerAddr) != "" && time.Since(connectedAt) > backoff {
+			continue
+		}
+		select {
+		case <-e.stop:
+			return
+		case <-time.After(backoff):
+		}
+	}
+}
+
+// waitDisconnect samples the traffic rate until disconnected is closed,
+// returning true, or the tunnel is stopped, returning false.
+func (e *entry) waitDisconnect(disconnected <-chan struct{}) bool {
+	ticker := time.NewTicker(speedInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-e.stop:
+			return false
+		case <-disconnected:
+			return true
+		case <-ticker.C:
+			e.traffic.UpdateSpeed()
+		}
+	}
+}
+
+func (e *entry) setClient(client tcp.TunnelClient) {
+	e.mu.Lock()
+	e.client = client
+	e.mu.Unlock()
+}
+
+func (e *entry) update(fn func(*Status)) {
+	e.mu.Lock()
+	fn(&e.status)
+	e.mu.Unlock()
+}
+
+func localAddr(cfg tcp.ConnectorConfig) string {
+	host := cfg.LocalHost
+	if host == "" {
+		host = "127.0.0.1"
+	}
+	return net.JoinHostPort(host, strconv.Itoa(cfg.LocalPort))
+}
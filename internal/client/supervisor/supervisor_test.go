@@ -0,0 +1,62 @@
+package supervisor
+
+import (
+	"testing"
+	"time"
+
+	"drip/internal/client/tcp"
+	"drip/internal/shared/protocol"
+
+	"go.uber.org/zap"
+)
+
+func TestSupervisorSetRemove(t *testing.T) {
+	s := New(zap.NewNop())
+	defer s.Close()
+
+	failed := make(chan Event, 4)
+	s.SetEventHandler(func(ev Event) {
+		if ev.Err != nil {
+			select {
+			case failed <- ev:
+			default:
+			}
+		}
+	})
+
+	// Nothing listens on port 1, so every attempt fails quickly.
+	cfg := tcp.ConnectorConfig{
+		ServerAddr: "127.0.0.1:1",
+		TunnelType: protocol.TunnelTypeHTTP,
+		LocalPort:  3000,
+		Transport:  tcp.TransportTCP,
+	}
+
+	if !s.Set("api", cfg) {
+		t.Fatal("Set() on a new tunnel = false, want true")
+	}
+	if s.Set("api", cfg) {
+		t.Error("Set() with the same config = true, want false")
+	}
+
+	select {
+	case ev := <-failed:
+		if ev.Name != "api" {
+			t.Errorf("event name = %q, want api", ev.Name)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no connection failure reported")
+	}
+
+	list := s.List()
+	if len(list) != 1 || list[0].Connected || list[0].LastError == "" || list[0].Local != "127.0.0.1:3000" {
+		t.Errorf("List() = %+v, want one disconnected tunnel with an error", list)
+	}
+
+	if !s.Remove("api") {
+		t.Error("Remove() = false, want true")
+	}
+	if names := s.Names(); len(names) != 0 {
+		t.Errorf("Names() after Remove = %v, want none", names)
+	}
+}
@@ -0,0 +1,194 @@
+package tcp
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+
+	"drip/internal/shared/protocol"
+)
+
+// Load balancing strategies for tunnels with several local backends.
+const (
+	BalanceRoundRobin = "round-robin"
+	BalanceLeastConn  = "least-conn"
+)
+
+// healthCheckInterval is how often backends of a balanced tunnel are
+// probed; a failed probe takes a backend out of rotation until the next
+// successful one.
+const healthCheckInterval = 5 * time.Second
+
+// ValidateBalance checks a load balancing strategy name.
+func ValidateBalance(strategy string) error {
+	switch strategy {
+	case "", BalanceRoundRobin, BalanceLeastConn:
+		return nil
+	}
+	return fmt.Errorf("invalid balance strategy %q: use %s or %s", strategy, BalanceRoundRobin, BalanceLeastConn)
+}
+
+// backend is one local address the tunnel forwards to.
+type backend struct {
+	host string
+	port int
+	addr string // host:port
+
+	active  atomic.Int64
+	healthy atomic.Bool
+}
+
+// balancer spreads streams over the local backends.
+type balancer struct {
+	backends  []*backend
+	leastConn bool
+	next      atomic.Uint64
+}
+
+func newBalancer(host string, port int, extra []string, strategy string) *balancer {
+	b := &balancer{leastConn: strategy == BalanceLeastConn}
+	b.add(host, port)
+	for _, addr := range extra {
+		h, p, err := net.SplitHostPort(addr)
+		if err != nil {
+			continue
+		}
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			continue
+		}
+		b.add(h, n)
+	}
+	return b
+}
+
+func (b *balancer) add(host string, port int) {
+	be := &backend{host: host, port: port, addr: net.JoinHostPort(host, strconv.Itoa(port))}
+	be.healthy.Store(true)
+	b.backends = append(b.backends, be)
+}
+
+// acquire picks the backend for a new stream and counts it as active
+// until release. Unhealthy backends are skipped unless none is healthy,
+// in which case the request fails against the local service as usual.
+func (b *balancer) acquire() *backend {
+	if len(b.backends) == 1 {
+		be := b.backends[0]
+		be.active.Add(1)
+		return be
+	}
+
+	candidates := make([]*backend, 0, len(b.backends))
+	for _, be := range b.backends {
+		if be.healthy.Load() {
+			candidates = append(candidates, be)
+		}
+	}
+	if len(candidates) == 0 {
+		candidates = b.backends
+	}
+
+	n := b.next.Add(1) - 1
+	be := candidates[n%uint64(len(candidates))]
+	if b.leastConn {
+		// Start the scan at the round-robin position so ties rotate.
+		for i := range candidates {
+			c := candidates[(n+uint64(i))%uint64(len(candidates))]
+			if c.active.Load() < be.active.Load() {
+				be = c
+			}
+		}
+	}
+	be.active.Add(1)
+	return be
+}
+
+func (b *balancer) release(be *backend) {
+	be.active.Add(-1)
+}
+
+// healthLoop probes every backend until ctx is done. With an HTTP path
+// the backend must answer it with a status below 500; otherwise it only
+// has to accept TCP connections.
+func (b *balancer) healthLoop(ctx context.Context, client *http.Client, scheme, path string, logger *zap.Logger) {
+	ticker := time.NewTicker(healthCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		for _, be := range b.backends {
+			err := probeBackend(ctx, client, scheme, be.addr, path)
+			if ctx.Err() != nil {
+				return
+			}
+			healthy := err == nil
+			if be.healthy.Swap(healthy) != healthy {
+				if healthy {
+					logger.Info("Local backend is healthy again", zap.String("backend", be.addr))
+				} else {
+					logger.Warn("Local backend failed health check", zap.String("backend", be.addr), zap.Error(err))
+				}
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func probeBackend(ctx context.Context, client *http.Client, scheme, addr, path string) error {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	if path == "" || client == nil {
+		conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, scheme+"://"+addr+path, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("health check returned %s", resp.Status)
+	}
+	return nil
+}
+
+// checksBackends reports whether backendHealthLoop runs, i.e. the tunnel
+// balances over several backends or has an HTTP health check.
+func (c *PoolClient) checksBackends() bool {
+	return len(c.backends.backends) > 1 || c.healthCheck != ""
+}
+
+// backendHealthLoop keeps the health of the local backends current while
+// the tunnel is up.
+func (c *PoolClient) backendHealthLoop() {
+	defer c.wg.Done()
+
+	var client *http.Client
+	scheme := "http"
+	if c.tunnelType == protocol.TunnelTypeHTTPS {
+		scheme = "https"
+	}
+	if c.healthCheck != "" && c.tunnelType.IsHTTP() {
+		client = newLocalHTTPClient(c.localTLS)
+	}
+	c.backends.healthLoop(c.ctx, client, scheme, c.healthCheck, c.logger)
+}
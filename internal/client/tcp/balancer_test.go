@@ -0,0 +1,44 @@
+package tcp
+
+import "testing"
+
+func TestBalancer(t *testing.T) {
+	rr := newBalancer("127.0.0.1", 3000, []string{"127.0.0.1:3001", "[::1]:3002"}, BalanceRoundRobin)
+	var got []string
+	for range 4 {
+		be := rr.acquire()
+		got = append(got, be.addr)
+		rr.release(be)
+	}
+	want := []string{"127.0.0.1:3000", "127.0.0.1:3001", "[::1]:3002", "127.0.0.1:3000"}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("round-robin pick %d = %s, want %s", i, got[i], want[i])
+		}
+	}
+
+	rr.backends[1].healthy.Store(false)
+	for range 4 {
+		if be := rr.acquire(); be.port == 3001 {
+			t.Errorf("round-robin picked unhealthy backend %s", be.addr)
+		}
+	}
+
+	for _, be := range rr.backends {
+		be.healthy.Store(false)
+	}
+	if be := rr.acquire(); be == nil {
+		t.Error("no backend picked when all are unhealthy")
+	}
+
+	lc := newBalancer("127.0.0.1", 3000, []string{"127.0.0.1:3001"}, BalanceLeastConn)
+	busy := lc.acquire()
+	for range 3 {
+		if be := lc.acquire(); be == busy {
+			t.Errorf("least-conn picked busy backend %s", be.addr)
+		} else {
+			lc.release(be)
+		}
+	}
+	lc.release(busy)
+}
@@ -0,0 +1,84 @@
+package tcp
+
+import (
+	"runtime"
+	"time"
+
+	"go.uber.org/zap"
+
+	"drip/internal/shared/constants"
+	"drip/internal/shared/protocol"
+)
+
+// clientStateLoop reports the client's version, streams and local service
+// health to the server in a heartbeat every ClientStateInterval, so the
+// server can show more than whether the tunnel is alive.
+func (c *PoolClient) clientStateLoop() {
+	defer c.wg.Done()
+
+	ticker := time.NewTicker(constants.ClientStateInterval)
+	defer ticker.Stop()
+
+	for {
+		// An idle tunnel in power-saving mode reports again once traffic
+		// returns.
+		if !c.idle() {
+			var ack struct{}
+			if err := c.sendControl(protocol.FrameTypeHeartbeat, c.clientState(), protocol.FrameTypeHeartbeatAck, &ack); err != nil && !c.IsClosed() {
+				c.logger.Debug("Failed to report client state", zap.Error(err))
+			}
+		}
+
+		select {
+		case <-c.stopCh:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// clientState collects the payload of a heartbeat.
+func (c *PoolClient) clientState() protocol.ClientHeartbeat {
+	hb := protocol.ClientHeartbeat{
+		Version:       clientVersion,
+		OS:            runtime.GOOS + "/" + runtime.GOARCH,
+		ActiveStreams: c.activeStreams(),
+	}
+
+	if c.checksBackends() {
+		// backendHealthLoop keeps the backends' health current.
+		hb.Backends = len(c.backends.backends)
+		for _, be := range c.backends.backends {
+			if be.healthy.Load() {
+				hb.HealthyBackends++
+			}
+		}
+		hb.LocalHealthy = hb.HealthyBackends > 0
+		if !hb.LocalHealthy {
+			hb.LocalError = "no local backend passes its health check"
+		}
+		return hb
+	}
+
+	be := c.backends.backends[0]
+	if err := probeBackend(c.ctx, nil, "", be.addr, ""); err != nil {
+		hb.LocalError = err.Error()
+	} else {
+		hb.LocalHealthy = true
+	}
+	return hb
+}
+
+// activeStreams counts the streams being served on all sessions.
+func (c *PoolClient) activeStreams() int64 {
+	var n int64
+	if h := c.primary; h != nil {
+		n += h.active.Load()
+	}
+	c.mu.RLock()
+	for _, h := range c.dataSessions {
+		n += h.active.Load()
+	}
+	c.mu.RUnlock()
+	return n
+}
@@ -1,6 +1,7 @@
 package tcp
 
 import (
+	"context"
 	"crypto/tls"
 	"fmt"
 	"net"
@@ -12,6 +13,9 @@ import (
 	"github.com/gorilla/websocket"
 	"go.uber.org/zap"
 
+	"drip/internal/client/proxy"
+	"drip/internal/shared/chaos"
+	"drip/internal/shared/protocol"
 	"drip/internal/shared/wsutil"
 )
 
@@ -25,9 +29,12 @@ type serverCapabilities struct {
 type ConnectionDialer struct {
 	serverAddr string
 	tlsConfig  *tls.Config
+	controlTLS *tls.Config // tlsConfig asking for the drip protocol by ALPN
 	token      string
 	transport  TransportType
 	logger     *zap.Logger
+	chaos      *chaos.Config
+	proxy      *proxy.Dialer
 }
 
 // NewConnectionDialer creates a new connection dialer.
@@ -38,17 +45,41 @@ func NewConnectionDialer(
 	transport TransportType,
 	logger *zap.Logger,
 ) *ConnectionDialer {
+	// Servers that only advertise HTTP protocols tell clients apart by
+	// what they send, so http/1.1 is fine as a fallback.
+	controlTLS := tlsConfig.Clone()
+	controlTLS.NextProtos = []string{protocol.ALPN, "http/1.1"}
+
 	return &ConnectionDialer{
 		serverAddr: serverAddr,
 		tlsConfig:  tlsConfig,
+		controlTLS: controlTLS,
 		token:      token,
 		transport:  transport,
 		logger:     logger,
 	}
 }
 
+// SetChaos injects cfg's faults into every connection the dialer opens.
+func (d *ConnectionDialer) SetChaos(cfg *chaos.Config) {
+	d.chaos = cfg
+}
+
+// SetProxy sends every connection the dialer opens through p.
+func (d *ConnectionDialer) SetProxy(p *proxy.Dialer) {
+	d.proxy = p
+}
+
 // Dial establishes a connection using the appropriate transport.
 func (d *ConnectionDialer) Dial() (net.Conn, error) {
+	conn, err := d.dial()
+	if err != nil {
+		return nil, err
+	}
+	return d.chaos.Wrap(conn), nil
+}
+
+func (d *ConnectionDialer) dial() (net.Conn, error) {
 	switch d.transport {
 	case TransportWebSocket:
 		return d.dialWebSocket()
@@ -85,8 +116,9 @@ func (d *ConnectionDialer) Dial() (net.Conn, error) {
 
 // dialTLS establishes a TLS connection to the server.
 func (d *ConnectionDialer) dialTLS() (net.Conn, error) {
-	dialer := &net.Dialer{Timeout: 10 * time.Second}
-	conn, err := tls.DialWithDialer(dialer, "tcp", d.serverAddr, d.tlsConfig)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	conn, err := d.proxy.DialTLSContext(ctx, d.serverAddr, d.controlTLS)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect: %w", err)
 	}
@@ -130,6 +162,9 @@ func (d *ConnectionDialer) dialWebSocket() (net.Conn, error) {
 		ReadBufferSize:   256 * 1024,
 		WriteBufferSize:  256 * 1024,
 	}
+	if d.proxy != nil {
+		dialer.NetDialContext = d.proxy.DialContext
+	}
 
 	// Add authorization header if token is set
 	header := http.Header{}
@@ -161,13 +196,17 @@ func (d *ConnectionDialer) discoverServerCapabilities() *serverCapabilities {
 		port = "443"
 	}
 
-	discoverURL := fmt.Sprintf("https://%s:%s/_drip/discover", host, port)
+	discoverURL := "https://" + net.JoinHostPort(host, port) + "/_drip/discover"
 
+	transport := &http.Transport{
+		TLSClientConfig: d.tlsConfig,
+	}
+	if d.proxy != nil {
+		transport.DialContext = d.proxy.DialContext
+	}
 	client := &http.Client{
-		Timeout: 5 * time.Second,
-		Transport: &http.Transport{
-			TLSClientConfig: d.tlsConfig,
-		},
+		Timeout:   5 * time.Second,
+		Transport: transport,
 	}
 
 	resp, err := client.Get(discoverURL)
@@ -4,6 +4,10 @@ import (
 	"strings"
 	"time"
 
+	"drip/internal/client/har"
+	"drip/internal/client/middleware"
+	"drip/internal/client/proxy"
+	"drip/internal/shared/chaos"
 	"drip/internal/shared/protocol"
 	"drip/internal/shared/stats"
 
@@ -22,10 +26,33 @@ const (
 	TransportWebSocket TransportType = "wss"
 )
 
+// clientVersion is reported to the server at registration.
+var clientVersion = "dev"
+
+// SetClientVersion sets the release reported to servers, which may refuse
+// clients older than their minimum.
+func SetClientVersion(version string) {
+	clientVersion = version
+}
+
 type LatencyCallback func(latency time.Duration)
 
+// ExpiryCallback is called when the server warns that the tunnel's TTL is
+// about to run out.
+type ExpiryCallback func(expiresAt time.Time)
+
+// StreamStatsCallback is called with the server's stats of each stream of
+// the tunnel as it ends, see ConnectorConfig.StreamStats.
+type StreamStatsCallback func(stats protocol.StreamStats)
+
 type ConnectorConfig struct {
 	ServerAddr string
+
+	// FallbackAddrs are servers in other regions of the same deployment,
+	// in order of preference. Runners move to the next one with FailOver
+	// when ServerAddr cannot be reached.
+	FallbackAddrs []string
+
 	Token      string
 	TunnelType protocol.TunnelType
 	LocalHost  string
@@ -33,6 +60,30 @@ type ConnectorConfig struct {
 	Subdomain  string
 	Insecure   bool
 
+	// SubdomainStyle and SubdomainPrefix ask the server for a generated
+	// subdomain of that style when Subdomain is empty, see
+	// protocol.RegisterRequest.
+	SubdomainStyle  string
+	SubdomainPrefix string
+
+	// Labels are key=value metadata registered with the tunnel, see
+	// package labels.
+	Labels map[string]string
+
+	// Backends are further host:port addresses served alongside
+	// LocalHost:LocalPort. Streams are spread over all of them with the
+	// Balance strategy (round-robin by default), and backends failing the
+	// periodic health check are skipped. HealthCheck is an HTTP path
+	// probed on each backend (http/https only); without it a backend only
+	// has to accept TCP connections.
+	Backends    []string
+	Balance     string
+	HealthCheck string
+
+	// ServerFingerprint pins the server's public key (see
+	// config.ParseFingerprint). It takes precedence over Insecure.
+	ServerFingerprint string
+
 	PoolSize int
 	PoolMin  int
 	PoolMax  int
@@ -40,6 +91,11 @@ type ConnectorConfig struct {
 	AllowIPs []string
 	DenyIPs  []string
 
+	// Country allow/deny lists (ISO 3166-1 alpha-2), enforced by servers
+	// with a GeoIP database
+	AllowCountries []string
+	DenyCountries  []string
+
 	// Proxy authentication
 	AuthPass   string
 	AuthBearer string
@@ -49,6 +105,172 @@ type ConnectorConfig struct {
 
 	// Bandwidth limit (bytes/sec), 0 = unlimited
 	Bandwidth int64
+
+	// Rate caps the traffic of all tunnel streams together, in and out,
+	// on the client itself (bytes/sec), 0 = unlimited.
+	Rate int64
+
+	// ProxyProtocol asks the server to prefix TCP streams with a
+	// PROXY protocol v2 header carrying the visitor address.
+	ProxyProtocol bool
+
+	// RequestRules are evaluated by the server before requests reach
+	// the tunnel (http/https only).
+	RequestRules []protocol.RequestRule
+
+	// Per-visitor-IP rate limit enforced by the server (http/https only)
+	VisitorRPS   float64
+	VisitorBurst int
+
+	// EdgeTLS asks the server for HSTS, TLS 1.3 or visitor client
+	// certificates on the tunnel's public hostname (http/https only).
+	EdgeTLS *protocol.EdgeTLSPolicy
+
+	// SigningSecret has the server sign every request body it forwards
+	// with HMAC-SHA256 in X-Drip-Signature (http/https only).
+	SigningSecret string
+
+	// RequestStore has the server keep the last RequestStore requests to
+	// the tunnel for replay, also while the client is away (http/https
+	// only).
+	RequestStore int
+
+	// MaxRequestBody has the server answer requests with larger bodies
+	// with a 413 instead of forwarding them, and MaxResponseBody has the
+	// client answer responses of the local service with larger bodies
+	// with a 502 (http/https only). Zero means no limit.
+	MaxRequestBody  int64
+	MaxResponseBody int64
+
+	// E2EKey makes every TCP stream an end-to-end encrypted session with a
+	// consumer running 'drip connect' using the same key (tcp only).
+	E2EKey string
+
+	// P2P lets consumers running 'drip connect --p2p' attempt a direct
+	// connection before falling back to the server relay (tcp only).
+	P2P bool
+
+	// Private registers a TCP tunnel without a public port; consumers
+	// reach it with 'drip connect <name>' through the server (tcp only).
+	Private bool
+
+	// CompressStreams deflates streaming responses such as Server-Sent
+	// Events on the way to the server, if it supports it (http/https only).
+	CompressStreams bool
+
+	// CacheTTL enables answering conditional GETs with 304s on the client
+	// for this long after the local app last confirmed the validators
+	// (http/https only). Zero disables the cache.
+	CacheTTL time.Duration
+
+	// Middleware lets embedders inspect, rewrite or mock HTTP traffic
+	// before it reaches the local app (http/https only).
+	Middleware *middleware.Chain
+
+	// ExecHooks are shell commands run as middleware for every request
+	// and response; see middleware.ExecInput (http/https only).
+	ExecHooks []string
+
+	// Mocks are answered by the client without contacting the local app
+	// (http/https only).
+	Mocks []middleware.Mock
+
+	// RewriteHost points absolute URLs to the local app in redirects and
+	// cookie domains at the public host; RewriteHTML does the same for
+	// links in HTML pages (http/https only).
+	RewriteHost bool
+	RewriteHTML bool
+
+	// CookieRewrite normalizes Set-Cookie attributes for the public host
+	// (http/https only).
+	CookieRewrite middleware.CookieRewrite
+
+	// LocalTLS sets how the certificate of the local service is checked
+	// (https only). The zero value accepts any certificate.
+	LocalTLS LocalTLS
+
+	// Retry retries dials to the local service that fail, e.g. while the
+	// app restarts. The zero value gives up after the first failure.
+	Retry RetryPolicy
+
+	// MaxInFlight caps the requests forwarded to the local service at once;
+	// up to MaxQueue more wait for a slot and the rest get a 503 with
+	// Retry-After. Zero means unlimited (http/https only).
+	MaxInFlight int
+	MaxQueue    int
+
+	// Shadow is a host:port that receives a copy of every request forwarded
+	// to the local service; its responses are discarded (http/https only).
+	Shadow string
+
+	// CORSOrigins makes the client answer CORS preflights and add CORS
+	// headers for these origins; see middleware.AddCORS (http/https only).
+	CORSOrigins []string
+
+	// HAR records every proxied request and response, outside all other
+	// hooks so the archive shows what visitors saw (http/https only).
+	HAR *har.Recorder
+
+	// TTL asks the server to close the tunnel this long after it is
+	// registered. Zero keeps it up until the client stops.
+	TTL time.Duration
+
+	// OnExpiry is called when the server warns that TTL is about to run
+	// out. Unlike SetExpiryCallback it is in place before Connect starts
+	// listening for the warning, which may come right away for short TTLs.
+	OnExpiry ExpiryCallback
+
+	// Schedule limits the times the server lets visitors reach the
+	// tunnel, see package schedule. Connecting fails on servers that
+	// cannot enforce it.
+	Schedule string
+
+	// DrainTimeout is how long closing a connection waits for its streams
+	// in flight to finish after the server stopped sending new ones to
+	// it. Zero closes connections right away.
+	DrainTimeout time.Duration
+
+	// PowerSave stops heartbeats while the tunnel carries no streams,
+	// leaving dead connections to TCP keepalive, to spare the battery and
+	// radio of laptops and phones. They resume with the next stream.
+	PowerSave bool
+
+	// StreamStats asks the server for the stats of each request or
+	// connection the tunnel carries, passed to the stream stats callback
+	// as it ends. Servers without protocol.CapabilityStreamStats send none.
+	StreamStats bool
+
+	// Chaos injects latency and disconnects into connections to the
+	// server, for testing applications over a flaky tunnel.
+	Chaos *chaos.Config
+
+	// Proxy, if set, carries every connection to the server, e.g.
+	// through a corporate HTTP proxy. Otherwise connections are direct.
+	Proxy *proxy.Dialer
+
+	// Stats, if set, counts the traffic of every client created from this
+	// configuration, so a session that reconnects keeps its totals.
+	// Otherwise each client counts its own.
+	Stats *stats.TrafficStats
+
+	// Resume, if set, carries TLS sessions and the server's resume token
+	// from one client created from this configuration to the next, so a
+	// reconnect re-binds the tunnel in a resumed handshake and a single
+	// register exchange. See ResumeState.
+	Resume *ResumeState
+}
+
+// FailOver makes the first fallback the server to connect to, queueing the
+// current one behind the others so a long outage cycles through them all.
+// It reports false when there is nothing to fail over to.
+func (c *ConnectorConfig) FailOver() bool {
+	if len(c.FallbackAddrs) == 0 {
+		return false
+	}
+	next := c.FallbackAddrs[0]
+	c.FallbackAddrs = append(c.FallbackAddrs[1:len(c.FallbackAddrs):len(c.FallbackAddrs)], c.ServerAddr)
+	c.ServerAddr = next
+	return true
 }
 
 type TunnelClient interface {
@@ -58,9 +280,19 @@ type TunnelClient interface {
 	GetURL() string
 	GetSubdomain() string
 	SetLatencyCallback(cb LatencyCallback)
+	SetExpiryCallback(cb ExpiryCallback)
+	SetStreamStatsCallback(cb StreamStatsCallback)
+	ExpiresAt() time.Time
 	GetLatency() time.Duration
 	GetStats() *stats.TrafficStats
 	IsClosed() bool
+	UpdateRequestRules(rules []protocol.RequestRule) error
+
+	// SetPaused stops forwarding traffic to the local service without
+	// giving up the tunnel: HTTP visitors get a 503 and TCP connections
+	// are closed until it is called with false.
+	SetPaused(paused bool) error
+	Paused() bool
 }
 
 func NewTunnelClient(cfg *ConnectorConfig, logger *zap.Logger) TunnelClient {
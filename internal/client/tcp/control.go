@@ -0,0 +1,101 @@
+package tcp
+
+import (
+	"fmt"
+	"time"
+
+	json "github.com/goccy/go-json"
+
+	"drip/internal/shared/constants"
+	"drip/internal/shared/protocol"
+)
+
+// controlTimeout bounds a single control request on the primary session.
+const controlTimeout = 10 * time.Second
+
+// UpdateRequestRules replaces the server-side request filtering rules of the
+// running tunnel. The new rules are also used on reconnect.
+func (c *PoolClient) UpdateRequestRules(rules []protocol.RequestRule) error {
+	var resp protocol.RulesUpdateResponse
+	req := protocol.RulesUpdateRequest{Rules: rules}
+	if err := c.sendControl(protocol.FrameTypeRulesUpdate, req, protocol.FrameTypeRulesUpdateAck, &resp); err != nil {
+		return err
+	}
+	if !resp.Accepted {
+		return fmt.Errorf("rules update rejected: %s", resp.Message)
+	}
+
+	c.mu.Lock()
+	c.requestRules = rules
+	c.mu.Unlock()
+	return nil
+}
+
+// SetPaused pauses or resumes the tunnel. The server then answers visitors
+// with a "paused" page or refuses their TCP connections, so traffic stops
+// at the edge. The client turns away anything that still arrives, which
+// also covers servers that predate pausing; for those, and when the tunnel
+// is not connected, the error says the server was not told.
+func (c *PoolClient) SetPaused(paused bool) error {
+	c.paused.Store(paused)
+
+	var resp protocol.PauseResponse
+	if err := c.sendControl(protocol.FrameTypePause, protocol.PauseRequest{Paused: paused}, protocol.FrameTypePauseAck, &resp); err != nil {
+		if protocol.ErrorCode(err) == constants.ErrCodeUnsupported {
+			return fmt.Errorf("server does not support pausing; the client turns visitors away instead")
+		}
+		return err
+	}
+	if !resp.Accepted {
+		return fmt.Errorf("pause rejected: %s", resp.Message)
+	}
+	return nil
+}
+
+// sendControl opens a short-lived stream on the primary session, writes one
+// control frame and decodes the expected acknowledgement into out.
+func (c *PoolClient) sendControl(frameType protocol.FrameType, req any, ackType protocol.FrameType, out any) error {
+	return c.sendControlWithin(controlTimeout, frameType, req, ackType, out)
+}
+
+// sendControlWithin is sendControl with a custom deadline for the exchange.
+func (c *PoolClient) sendControlWithin(timeout time.Duration, frameType protocol.FrameType, req any, ackType protocol.FrameType, out any) error {
+	h := c.primary
+	if h == nil || h.session == nil || h.session.IsClosed() {
+		return fmt.Errorf("tunnel is not connected")
+	}
+
+	payload, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("failed to marshal control request: %w", err)
+	}
+
+	stream, err := h.session.Open()
+	if err != nil {
+		return fmt.Errorf("failed to open control stream: %w", err)
+	}
+	defer stream.Close()
+	_ = stream.SetDeadline(time.Now().Add(timeout))
+
+	if err := protocol.WriteFrame(stream, protocol.NewFrame(frameType, payload)); err != nil {
+		return fmt.Errorf("failed to send %s: %w", frameType, err)
+	}
+
+	ack, err := protocol.ReadFrame(stream)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", ackType, err)
+	}
+	defer ack.Release()
+
+	switch ack.Type {
+	case ackType:
+		if err := json.Unmarshal(ack.Payload, out); err != nil {
+			return fmt.Errorf("failed to parse %s: %w", ackType, err)
+		}
+		return nil
+	case protocol.FrameTypeError:
+		return fmt.Errorf("control error: %w", protocol.DecodeError(ack.Payload))
+	default:
+		return fmt.Errorf("unexpected control reply frame: %s", ack.Type)
+	}
+}
@@ -0,0 +1,92 @@
+package tcp
+
+import (
+	"time"
+
+	"go.uber.org/zap"
+
+	"drip/internal/shared/protocol"
+)
+
+// drainPollInterval is how often a drain checks for streams still in flight.
+const drainPollInterval = 50 * time.Millisecond
+
+// retireDataSession closes a data session without cutting its streams: the
+// server stops opening new streams on it, and it is closed once the ones in
+// flight finish or the drain timeout passes.
+func (c *PoolClient) retireDataSession(id string) bool {
+	c.mu.RLock()
+	h := c.dataSessions[id]
+	c.mu.RUnlock()
+	if h == nil {
+		return false
+	}
+
+	c.drain(protocol.DrainRequest{ConnectionIDs: []string{id}}, []*sessionHandle{h})
+	return c.removeDataSession(id)
+}
+
+// drainAll stops the server from opening new streams on any of the
+// tunnel's sessions and waits for the streams in flight to finish.
+func (c *PoolClient) drainAll() {
+	c.mu.RLock()
+	handles := make([]*sessionHandle, 0, len(c.dataSessions)+1)
+	if c.primary != nil {
+		handles = append(handles, c.primary)
+	}
+	for _, h := range c.dataSessions {
+		handles = append(handles, h)
+	}
+	c.mu.RUnlock()
+
+	c.drain(protocol.DrainRequest{All: true}, handles)
+}
+
+// drain sends req and waits up to the drain timeout for the streams open on
+// handles to finish. Servers that do not support draining keep sending
+// streams, so nothing is waited for when the request is refused.
+func (c *PoolClient) drain(req protocol.DrainRequest, handles []*sessionHandle) {
+	if c.drainTimeout <= 0 {
+		return
+	}
+
+	deadline := time.Now().Add(c.drainTimeout)
+
+	var resp protocol.DrainResponse
+	if err := c.sendControlWithin(c.drainTimeout, protocol.FrameTypeDrain, req, protocol.FrameTypeDrainAck, &resp); err != nil {
+		c.logger.Debug("Failed to drain sessions", zap.Error(err))
+		return
+	}
+	if !resp.Accepted {
+		c.logger.Debug("Server refused to drain sessions", zap.String("message", resp.Message))
+		return
+	}
+
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+
+	for {
+		var active int64
+		for _, h := range handles {
+			if !h.closed.Load() {
+				active += h.active.Load()
+			}
+		}
+		if active == 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			c.logger.Info("Drain timeout reached, closing streams still in flight",
+				zap.Int64("streams", active),
+				zap.Duration("timeout", c.drainTimeout),
+			)
+			return
+		}
+
+		select {
+		case <-c.stopCh:
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package tcp
+
+import (
+	"time"
+
+	json "github.com/goccy/go-json"
+	"go.uber.org/zap"
+
+	"drip/internal/shared/protocol"
+)
+
+// expiryWatchLoop waits on the primary session for the server's warning that
+// the tunnel's TTL is about to run out and passes it to the expiry callback.
+func (c *PoolClient) expiryWatchLoop(h *sessionHandle) {
+	defer c.wg.Done()
+
+	stream, err := h.session.Open()
+	if err != nil {
+		c.logger.Warn("Failed to open expiry watch stream", zap.Error(err))
+		return
+	}
+	defer stream.Close()
+
+	go func() {
+		<-c.stopCh
+		_ = stream.Close()
+	}()
+
+	if err := protocol.WriteFrame(stream, protocol.NewFrame(protocol.FrameTypeExpiryWatch, []byte("{}"))); err != nil {
+		c.logger.Warn("Failed to request expiry warning", zap.Error(err))
+		return
+	}
+
+	frame, err := protocol.ReadFrame(stream)
+	if err != nil {
+		return
+	}
+	defer frame.Release()
+
+	switch frame.Type {
+	case protocol.FrameTypeExpiryNotice:
+		var notice protocol.ExpiryNotice
+		if err := json.Unmarshal(frame.Payload, &notice); err != nil {
+			return
+		}
+		expiresAt := time.Unix(notice.ExpiresAt, 0)
+		c.logger.Warn("Tunnel is about to expire",
+			zap.Time("expires_at", expiresAt),
+		)
+		if cb, ok := c.expiryCallback.Load().(ExpiryCallback); ok && cb != nil {
+			cb(expiresAt)
+		}
+	case protocol.FrameTypeError:
+		perr := protocol.DecodeError(frame.Payload)
+		c.logger.Debug("Server does not send expiry warnings",
+			zap.String("code", perr.Code),
+			zap.String("message", perr.Message),
+		)
+	}
+}
@@ -0,0 +1,82 @@
+package tcp
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"drip/internal/shared/stats"
+)
+
+const (
+	// queueTimeout is the longest a request waits for a free slot before
+	// it is turned away like one that found the queue full.
+	queueTimeout = 30 * time.Second
+	// retryAfterSeconds is the Retry-After sent with overload responses.
+	retryAfterSeconds = 2
+)
+
+// requestLimiter bounds the requests in flight to the local service. Up to
+// maxQueue more wait for a slot; the rest are rejected with a 503, so a
+// slow app does not collect an unbounded backlog.
+type requestLimiter struct {
+	slots    chan struct{}
+	maxQueue int64
+	queued   atomic.Int64
+	stats    *stats.TrafficStats
+}
+
+// newRequestLimiter returns nil, which never limits, when maxInFlight is
+// not positive.
+func newRequestLimiter(maxInFlight, maxQueue int, st *stats.TrafficStats) *requestLimiter {
+	if maxInFlight <= 0 {
+		return nil
+	}
+	return &requestLimiter{
+		slots:    make(chan struct{}, maxInFlight),
+		maxQueue: int64(max(maxQueue, 0)),
+		stats:    st,
+	}
+}
+
+// acquire takes a slot, waiting in the queue if there is room. It reports
+// false if the request should be rejected; otherwise release must be
+// called once the request is done.
+func (l *requestLimiter) acquire(ctx context.Context) bool {
+	if l == nil {
+		return true
+	}
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	default:
+	}
+
+	if l.queued.Add(1) > l.maxQueue {
+		l.queued.Add(-1)
+		l.stats.AddRejected()
+		return false
+	}
+	l.stats.AddQueued(1)
+	defer func() {
+		l.queued.Add(-1)
+		l.stats.AddQueued(-1)
+	}()
+
+	timer := time.NewTimer(queueTimeout)
+	defer timer.Stop()
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+	l.stats.AddRejected()
+	return false
+}
+
+func (l *requestLimiter) release() {
+	if l != nil {
+		<-l.slots
+	}
+}
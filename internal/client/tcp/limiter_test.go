@@ -0,0 +1,50 @@
+package tcp
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"drip/internal/shared/stats"
+)
+
+func TestRequestLimiter(t *testing.T) {
+	st := stats.NewTrafficStats()
+	l := newRequestLimiter(1, 1, st)
+	ctx := context.Background()
+
+	if !l.acquire(ctx) {
+		t.Fatal("first request rejected")
+	}
+
+	queued := make(chan bool)
+	go func() { queued <- l.acquire(ctx) }()
+	deadline := time.Now().Add(5 * time.Second)
+	for st.GetSnapshot().QueuedRequests != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("second request never queued")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if l.acquire(ctx) {
+		t.Error("request admitted with a full queue")
+	}
+	if got := st.GetSnapshot().RejectedRequests; got != 1 {
+		t.Errorf("rejected = %d, want 1", got)
+	}
+
+	l.release()
+	if !<-queued {
+		t.Error("queued request rejected after a slot freed up")
+	}
+	if got := st.GetSnapshot().QueuedRequests; got != 0 {
+		t.Errorf("queued = %d after admission, want 0", got)
+	}
+	l.release()
+
+	var unlimited *requestLimiter
+	if !unlimited.acquire(ctx) {
+		t.Error("nil limiter rejected a request")
+	}
+}
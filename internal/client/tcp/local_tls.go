@@ -0,0 +1,76 @@
+package tcp
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+
+	"drip/pkg/config"
+)
+
+// LocalTLS controls how the client checks the certificate of an HTTPS
+// local service. The zero value accepts any certificate, which suits the
+// self-signed certificates of development servers.
+type LocalTLS struct {
+	CAFile     string // trust only CAs in this PEM bundle; implies Verify
+	Pin        string // require this public key hash (sha256/<base64>)
+	Verify     bool   // verify the chain against the system roots and the host name
+	ServerName string // name to send and verify instead of the local host
+}
+
+// Enabled reports whether the certificate is checked at all.
+func (o LocalTLS) Enabled() bool {
+	return o.CAFile != "" || o.Pin != "" || o.Verify
+}
+
+// Config returns the TLS configuration for connections to host. An empty
+// host leaves ServerName for the caller to fill in per connection.
+func (o LocalTLS) Config(host string) (*tls.Config, error) {
+	serverName := o.ServerName
+	if serverName == "" {
+		serverName = host
+	}
+	cfg := &tls.Config{ServerName: serverName}
+	if !o.Enabled() {
+		cfg.InsecureSkipVerify = true
+		return cfg, nil
+	}
+
+	if o.CAFile != "" {
+		pem, err := os.ReadFile(o.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read local CA bundle: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in local CA bundle %s", o.CAFile)
+		}
+		cfg.RootCAs = pool
+	}
+
+	if o.Pin == "" {
+		return cfg, nil
+	}
+	pin, err := config.ParseFingerprint(o.Pin)
+	if err != nil {
+		return nil, err
+	}
+	// A pin alone replaces CA and host name checks, as with
+	// --server-fingerprint; combined with verification it adds to them.
+	cfg.InsecureSkipVerify = o.CAFile == "" && !o.Verify
+	cfg.VerifyConnection = func(state tls.ConnectionState) error {
+		if len(state.PeerCertificates) == 0 {
+			return errors.New("local service presented no certificate")
+		}
+		sum := sha256.Sum256(state.PeerCertificates[0].RawSubjectPublicKeyInfo)
+		if !bytes.Equal(sum[:], pin) {
+			return fmt.Errorf("local certificate fingerprint mismatch: got %s", config.SPKIFingerprint(state.PeerCertificates[0]))
+		}
+		return nil
+	}
+	return cfg, nil
+}
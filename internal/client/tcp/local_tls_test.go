@@ -0,0 +1,56 @@
+package tcp
+
+import (
+	"crypto/tls"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"drip/pkg/config"
+)
+
+func TestLocalTLS(t *testing.T) {
+	app := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer app.Close()
+
+	cert := app.Certificate()
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	otherPin := "sha256/47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU="
+
+	tests := []struct {
+		name    string
+		opts    LocalTLS
+		wantErr bool
+	}{
+		{"default accepts any certificate", LocalTLS{}, false},
+		{"verify against system roots", LocalTLS{Verify: true}, true},
+		{"trusted CA", LocalTLS{CAFile: caFile}, false},
+		{"trusted CA with wrong name", LocalTLS{CAFile: caFile, ServerName: "other.test"}, true},
+		{"matching pin", LocalTLS{Pin: config.SPKIFingerprint(cert)}, false},
+		{"mismatched pin", LocalTLS{Pin: otherPin}, true},
+		{"CA and mismatched pin", LocalTLS{CAFile: caFile, Pin: otherPin}, true},
+	}
+	for _, tt := range tests {
+		cfg, err := tt.opts.Config("127.0.0.1")
+		if err != nil {
+			t.Fatalf("%s: Config() error: %v", tt.name, err)
+		}
+		conn, err := tls.Dial("tcp", app.Listener.Addr().String(), cfg)
+		if err == nil {
+			conn.Close()
+		}
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: handshake error = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+	}
+
+	if _, err := (LocalTLS{CAFile: filepath.Join(t.TempDir(), "missing.pem")}).Config("127.0.0.1"); err == nil {
+		t.Error("Config() accepted a missing CA bundle")
+	}
+}
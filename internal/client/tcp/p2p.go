@@ -0,0 +1,97 @@
+package tcp
+
+import (
+	"context"
+	"time"
+
+	json "github.com/goccy/go-json"
+	"go.uber.org/zap"
+
+	"drip/internal/client/p2p"
+	"drip/internal/shared/protocol"
+)
+
+// p2pAcceptTimeout bounds announcing and punching for one offer; the
+// consumer falls back to the relay on its own once it gives up.
+const p2pAcceptTimeout = 10 * time.Second
+
+// p2pWatchLoop subscribes to direct connection offers on the primary session
+// and serves each successful direct connection like a relayed stream.
+func (c *PoolClient) p2pWatchLoop(h *sessionHandle) {
+	defer c.wg.Done()
+
+	stream, err := h.session.Open()
+	if err != nil {
+		c.logger.Warn("Failed to open P2P watch stream", zap.Error(err))
+		return
+	}
+	defer stream.Close()
+
+	go func() {
+		<-c.stopCh
+		_ = stream.Close()
+	}()
+
+	if err := protocol.WriteFrame(stream, protocol.NewFrame(protocol.FrameTypeP2PWatch, []byte("{}"))); err != nil {
+		c.logger.Warn("Failed to request P2P offers", zap.Error(err))
+		return
+	}
+
+	rv := &p2p.Rendezvous{
+		ServerAddr: c.serverAddr,
+		TLSConfig:  c.tlsConfig,
+		Token:      c.token,
+	}
+
+	frames := protocol.NewFrameReader(stream)
+	frames.SetMaxFrameSize(protocol.MaxControlFrameSize)
+	for {
+		frame, err := frames.ReadFrame()
+		if err != nil {
+			return
+		}
+
+		switch frame.Type {
+		case protocol.FrameTypeP2POffer:
+			var offer protocol.P2POffer
+			if err := json.Unmarshal(frame.Payload, &offer); err == nil {
+				c.wg.Add(1)
+				go c.acceptP2P(rv, offer)
+			}
+		case protocol.FrameTypeError:
+			perr := protocol.DecodeError(frame.Payload)
+			c.logger.Warn("Server does not support direct connections",
+				zap.String("code", perr.Code),
+				zap.String("message", perr.Message),
+			)
+			frame.Release()
+			return
+		}
+		frame.Release()
+	}
+}
+
+func (c *PoolClient) acceptP2P(rv *p2p.Rendezvous, offer protocol.P2POffer) {
+	defer c.wg.Done()
+
+	ctx, cancel := context.WithTimeout(c.ctx, p2pAcceptTimeout)
+	conn, err := p2p.Accept(ctx, rv, offer)
+	cancel()
+	if err != nil {
+		c.logger.Debug("Direct connection failed, consumer will use the relay",
+			zap.String("peer", offer.PeerAddr),
+			zap.Error(err),
+		)
+		return
+	}
+	defer conn.Close()
+
+	c.logger.Info("Direct connection established",
+		zap.String("peer", conn.RemoteAddr().String()),
+	)
+
+	c.stats.IncActiveConnections()
+	defer c.stats.DecActiveConnections()
+
+	c.handleTCPStream(conn)
+}
@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"net/url"
 	"runtime"
+	"slices"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -17,9 +18,13 @@ import (
 	"github.com/hashicorp/yamux"
 	"go.uber.org/zap"
 
+	"drip/internal/client/cache"
+	"drip/internal/client/middleware"
 	"drip/internal/shared/constants"
+	"drip/internal/shared/httputil"
 	"drip/internal/shared/mux"
 	"drip/internal/shared/protocol"
+	"drip/internal/shared/qos"
 	"drip/internal/shared/stats"
 	"drip/pkg/config"
 )
@@ -30,10 +35,17 @@ type PoolClient struct {
 	tlsConfig  *tls.Config
 	token      string
 	tunnelType protocol.TunnelType
-	localHost  string
 	localPort  int
+	localTLS   *tls.Config // for https tunnels
+	backends   *balancer
 	subdomain  string
 
+	subdomainStyle  string
+	subdomainPrefix string
+	labels          map[string]string
+
+	healthCheck string
+
 	assignedURL string
 	tunnelID    string
 
@@ -41,12 +53,18 @@ type PoolClient struct {
 	maxSessions     int
 	initialSessions int
 
-	stats *stats.TrafficStats
+	stats  *stats.TrafficStats
+	resume *ResumeState
 
 	httpClient *http.Client
+	limiter    *requestLimiter
+	retry      RetryPolicy
 
 	latencyCallback atomic.Value // LatencyCallback
+	expiryCallback  atomic.Value // ExpiryCallback
+	streamCallback  atomic.Value // StreamStatsCallback
 	latencyNanos    atomic.Int64
+	paused          atomic.Bool
 
 	ctx    context.Context
 	cancel context.CancelFunc
@@ -66,8 +84,10 @@ type PoolClient struct {
 
 	logger *zap.Logger
 
-	allowIPs []string
-	denyIPs  []string
+	allowIPs       []string
+	denyIPs        []string
+	allowCountries []string
+	denyCountries  []string
 
 	authPass   string
 	authBearer string
@@ -84,6 +104,48 @@ type PoolClient struct {
 
 	// Bandwidth limit requested from server (bytes/sec), 0 = unlimited
 	bandwidth int64
+
+	// rate throttles tunnel streams on this side, see ConnectorConfig.Rate.
+	rate *qos.Limiter
+
+	proxyProtocol bool
+	requestRules  []protocol.RequestRule
+	visitorRPS    float64
+	visitorBurst  int
+	edgeTLS       *protocol.EdgeTLSPolicy
+	signingSecret string
+	requestStore  int
+	maxBody       int64
+	maxRespBody   int64
+	e2eKey        string
+	p2p           bool
+	private       bool
+
+	compressStreams bool
+	// streamCompression is the encoding negotiated at registration.
+	streamCompression string
+
+	ttl       time.Duration
+	expiresAt time.Time
+	schedule  string
+
+	drainTimeout time.Duration
+
+	powerSave bool
+	// lastStream is when a stream last started or ended, in unix
+	// nanoseconds, and resting whether heartbeats are off for want of
+	// them.
+	lastStream atomic.Int64
+	resting    atomic.Bool
+
+	// reportState is set when the server takes the client's state in
+	// heartbeats, see protocol.CapabilityClientState.
+	reportState bool
+
+	// streamStats is set when the stats of finished streams were asked
+	// for, and watchStreams when the server also sends them.
+	streamStats  bool
+	watchStreams bool
 }
 
 // NewPoolClient creates a new pool client.
@@ -111,11 +173,21 @@ func NewPoolClient(cfg *ConnectorConfig, logger *zap.Logger) *PoolClient {
 	}
 
 	var tlsConfig *tls.Config
-	if cfg.Insecure {
+	if cfg.ServerFingerprint != "" {
+		// An unparsable pin leaves pin empty, which rejects every server.
+		pin, err := config.ParseFingerprint(cfg.ServerFingerprint)
+		if err != nil {
+			logger.Error("Invalid server fingerprint", zap.Error(err))
+		}
+		tlsConfig = config.GetClientTLSConfigPinned(hostOnly, pin)
+	} else if cfg.Insecure {
 		tlsConfig = config.GetClientTLSConfigInsecure()
 	} else {
 		tlsConfig = config.GetClientTLSConfig(hostOnly)
 	}
+	if cfg.Resume != nil {
+		tlsConfig.ClientSessionCache = cfg.Resume.sessions
+	}
 
 	localHost := cfg.LocalHost
 	if localHost == "" {
@@ -161,13 +233,19 @@ func NewPoolClient(cfg *ConnectorConfig, logger *zap.Logger) *PoolClient {
 		tlsConfig:       tlsConfig,
 		token:           cfg.Token,
 		tunnelType:      tunnelType,
-		localHost:       localHost,
 		localPort:       cfg.LocalPort,
+		backends:        newBalancer(localHost, cfg.LocalPort, cfg.Backends, cfg.Balance),
 		subdomain:       cfg.Subdomain,
+		subdomainStyle:  cfg.SubdomainStyle,
+		subdomainPrefix: cfg.SubdomainPrefix,
+		labels:          cfg.Labels,
+		healthCheck:     cfg.HealthCheck,
+		retry:           cfg.Retry,
 		minSessions:     minSessions,
 		maxSessions:     maxSessions,
 		initialSessions: initialSessions,
-		stats:           stats.NewTrafficStats(),
+		stats:           cfg.Stats,
+		resume:          cfg.Resume,
 		ctx:             ctx,
 		cancel:          cancel,
 		stopCh:          make(chan struct{}),
@@ -176,19 +254,117 @@ func NewPoolClient(cfg *ConnectorConfig, logger *zap.Logger) *PoolClient {
 		logger:          logger,
 		allowIPs:        cfg.AllowIPs,
 		denyIPs:         cfg.DenyIPs,
+		allowCountries:  cfg.AllowCountries,
+		denyCountries:   cfg.DenyCountries,
 		authPass:        cfg.AuthPass,
 		authBearer:      cfg.AuthBearer,
 		transport:       transport,
 		insecure:        cfg.Insecure,
 		dialer:          NewConnectionDialer(serverAddr, tlsConfig, cfg.Token, transport, logger),
 		bandwidth:       cfg.Bandwidth,
+		rate:            qos.NewLimiter(qos.Config{Bandwidth: cfg.Rate}),
+		proxyProtocol:   cfg.ProxyProtocol,
+		requestRules:    cfg.RequestRules,
+		visitorRPS:      cfg.VisitorRPS,
+		visitorBurst:    cfg.VisitorBurst,
+		edgeTLS:         cfg.EdgeTLS,
+		signingSecret:   cfg.SigningSecret,
+		requestStore:    cfg.RequestStore,
+		maxBody:         cfg.MaxRequestBody,
+		maxRespBody:     cfg.MaxResponseBody,
+		e2eKey:          cfg.E2EKey,
+		p2p:             cfg.P2P,
+		private:         cfg.Private,
+		compressStreams: cfg.CompressStreams,
+		ttl:             cfg.TTL,
+		schedule:        cfg.Schedule,
+		drainTimeout:    cfg.DrainTimeout,
+		powerSave:       cfg.PowerSave,
+		streamStats:     cfg.StreamStats,
+	}
+	c.lastStream.Store(time.Now().UnixNano())
+
+	if c.stats == nil {
+		c.stats = stats.NewTrafficStats()
+	}
+	if c.p2p && cfg.Proxy.Proxied(serverAddr) {
+		// Direct connections need UDP to the server, which a proxy
+		// does not carry.
+		logger.Warn("P2P is not available through a proxy; visitors connect through the server")
+		c.p2p = false
+	}
+	if tunnelType.IsHTTP() {
+		c.limiter = newRequestLimiter(cfg.MaxInFlight, cfg.MaxQueue, c.stats)
+	}
+
+	if tunnelType == protocol.TunnelTypeHTTPS {
+		// The server name is left to each connection, as backends may
+		// differ in host.
+		localTLS, err := cfg.LocalTLS.Config("")
+		if err != nil {
+			// Never fall back to skipping verification the user asked for.
+			logger.Error("Invalid local TLS settings", zap.Error(err))
+			localTLS = &tls.Config{VerifyConnection: func(tls.ConnectionState) error { return err }}
+		}
+		c.localTLS = localTLS
 	}
 
-	if tunnelType == protocol.TunnelTypeHTTP || tunnelType == protocol.TunnelTypeHTTPS {
-		c.httpClient = newLocalHTTPClient(tunnelType)
+	if tunnelType.IsHTTP() {
+		c.httpClient = newLocalHTTPClient(c.localTLS)
+		if cfg.CacheTTL > 0 {
+			c.httpClient.Transport = cache.NewTransport(c.httpClient.Transport, cfg.CacheTTL)
+		}
+		if !cfg.Middleware.Empty() {
+			c.httpClient.Transport = cfg.Middleware.Transport(c.httpClient.Transport)
+		}
+		rewrite := middleware.Rewrite{
+			LocalHost: localHost,
+			LocalPort: cfg.LocalPort,
+			URLs:      cfg.RewriteHost,
+			HTML:      cfg.RewriteHTML,
+			Cookies:   cfg.CookieRewrite,
+		}
+		if cfg.RewriteHost || cfg.RewriteHTML {
+			rewrite.Cookies.Domain = true
+		}
+		if len(cfg.ExecHooks) > 0 || len(cfg.Mocks) > 0 || rewrite.Enabled() || len(cfg.CORSOrigins) > 0 || cfg.Shadow != "" {
+			hooks := middleware.NewChain(logger)
+			if len(cfg.CORSOrigins) > 0 {
+				hooks.AddCORS(cfg.CORSOrigins)
+			}
+			if rewrite.Enabled() {
+				hooks.AddRewrite(rewrite)
+			}
+			for _, command := range cfg.ExecHooks {
+				hooks.AddExecHook(command)
+			}
+			if len(cfg.Mocks) > 0 {
+				hooks.AddMocks(cfg.Mocks)
+			}
+			if cfg.Shadow != "" {
+				scheme := "http"
+				if tunnelType == protocol.TunnelTypeHTTPS {
+					scheme = "https"
+				}
+				target := &url.URL{Scheme: scheme, Host: cfg.Shadow}
+				hooks.AddShadow(target, newLocalHTTPClient(c.localTLS).Transport)
+			}
+			c.httpClient.Transport = hooks.Transport(c.httpClient.Transport)
+		}
+		if cfg.HAR != nil {
+			c.httpClient.Transport = cfg.HAR.Transport(c.httpClient.Transport)
+		}
 	}
 
+	c.dialer.SetChaos(cfg.Chaos)
+	c.dialer.SetProxy(cfg.Proxy)
+
 	c.latencyCallback.Store(LatencyCallback(func(time.Duration) {}))
+	c.expiryCallback.Store(ExpiryCallback(func(time.Time) {}))
+	if cfg.OnExpiry != nil {
+		c.expiryCallback.Store(cfg.OnExpiry)
+	}
+	c.streamCallback.Store(StreamStatsCallback(func(protocol.StreamStats) {}))
 	return c
 }
 
@@ -203,19 +379,31 @@ func (c *PoolClient) Connect() error {
 	req := protocol.RegisterRequest{
 		Token:           c.token,
 		CustomSubdomain: c.subdomain,
+		SubdomainStyle:  c.subdomainStyle,
+		SubdomainPrefix: c.subdomainPrefix,
+		Labels:          c.labels,
 		TunnelType:      c.tunnelType,
 		LocalPort:       c.localPort,
 		ConnectionType:  "primary",
 		PoolCapabilities: &protocol.PoolCapabilities{
 			MaxDataConns: maxData,
 			Version:      1,
+			PowerSave:    c.powerSave,
 		},
+		ClientVersion:   clientVersion,
+		ProtocolVersion: protocol.ProtocolVersion,
+	}
+
+	if c.compressStreams && c.tunnelType.IsHTTP() {
+		req.PoolCapabilities.StreamCompression = []string{httputil.StreamEncodingDeflate}
 	}
 
-	if len(c.allowIPs) > 0 || len(c.denyIPs) > 0 {
+	if len(c.allowIPs) > 0 || len(c.denyIPs) > 0 || len(c.allowCountries) > 0 || len(c.denyCountries) > 0 {
 		req.IPAccess = &protocol.IPAccessControl{
-			AllowIPs: c.allowIPs,
-			DenyIPs:  c.denyIPs,
+			AllowIPs:       c.allowIPs,
+			DenyIPs:        c.denyIPs,
+			AllowCountries: c.allowCountries,
+			DenyCountries:  c.denyCountries,
 		}
 	}
 
@@ -237,6 +425,53 @@ func (c *PoolClient) Connect() error {
 		req.Bandwidth = c.bandwidth
 	}
 
+	if c.ttl > 0 {
+		// Round up so a sub-second remainder still asks for a TTL.
+		req.TTL = int64((c.ttl + time.Second - 1) / time.Second)
+	}
+	req.Schedule = c.schedule
+
+	if c.proxyProtocol && (c.tunnelType == protocol.TunnelTypeTCP || c.tunnelType == protocol.TunnelTypeTLS) {
+		req.ProxyProtocol = true
+	}
+
+	if c.resume != nil {
+		req.ResumeToken = c.resume.Token(c.serverAddr)
+	}
+
+	if c.private && c.tunnelType == protocol.TunnelTypeTCP {
+		req.Private = true
+	}
+
+	if c.visitorRPS > 0 && c.tunnelType.IsHTTP() {
+		req.VisitorRateLimit = &protocol.VisitorRateLimit{
+			RPS:   c.visitorRPS,
+			Burst: c.visitorBurst,
+		}
+	}
+
+	if c.edgeTLS != nil && c.tunnelType.IsHTTP() {
+		req.EdgeTLS = c.edgeTLS
+	}
+
+	if c.signingSecret != "" && c.tunnelType.IsHTTP() {
+		req.SigningSecret = c.signingSecret
+	}
+
+	if c.maxBody > 0 && c.tunnelType.IsHTTP() {
+		req.MaxRequestBody = c.maxBody
+	}
+
+	if c.requestStore > 0 && c.tunnelType.IsHTTP() {
+		req.RequestStore = c.requestStore
+	}
+
+	c.mu.RLock()
+	if len(c.requestRules) > 0 {
+		req.RequestRules = c.requestRules
+	}
+	c.mu.RUnlock()
+
 	payload, err := json.Marshal(req)
 	if err != nil {
 		_ = primaryConn.Close()
@@ -258,13 +493,8 @@ func (c *PoolClient) Connect() error {
 	_ = primaryConn.SetReadDeadline(time.Time{})
 
 	if ack.Type == protocol.FrameTypeError {
-		var errMsg protocol.ErrorMessage
-		if e := json.Unmarshal(ack.Payload, &errMsg); e == nil {
-			_ = primaryConn.Close()
-			return fmt.Errorf("registration error: %s - %s", errMsg.Code, errMsg.Message)
-		}
 		_ = primaryConn.Close()
-		return fmt.Errorf("registration error")
+		return fmt.Errorf("registration error: %w", protocol.DecodeError(ack.Payload))
 	}
 	if ack.Type != protocol.FrameTypeRegisterAck {
 		_ = primaryConn.Close()
@@ -276,9 +506,21 @@ func (c *PoolClient) Connect() error {
 		_ = primaryConn.Close()
 		return fmt.Errorf("failed to parse register response: %w", err)
 	}
+	if c.schedule != "" && !slices.Contains(resp.Capabilities, protocol.CapabilitySchedule) {
+		// Older servers would keep the tunnel reachable around the clock.
+		_ = primaryConn.Close()
+		return protocol.NewError(constants.ErrCodeUnsupported, "the server does not support --schedule")
+	}
 
 	c.assignedURL = resp.URL
 	c.subdomain = resp.Subdomain
+	if c.resume != nil {
+		c.resume.setToken(c.serverAddr, resp.ResumeToken)
+	}
+	if req.Private {
+		// There is no public URL; show how consumers reach the tunnel.
+		c.assignedURL = "drip connect " + resp.Subdomain
+	}
 	if resp.SupportsDataConn && resp.TunnelID != "" {
 		c.tunnelID = resp.TunnelID
 	}
@@ -286,6 +528,22 @@ func (c *PoolClient) Connect() error {
 	if resp.Bandwidth > 0 {
 		c.bandwidth = resp.Bandwidth
 	}
+	c.streamCompression = resp.StreamCompression
+	if resp.ExpiresAt > 0 {
+		c.expiresAt = time.Unix(resp.ExpiresAt, 0)
+	}
+	c.reportState = slices.Contains(resp.Capabilities, protocol.CapabilityClientState)
+	c.watchStreams = c.streamStats && slices.Contains(resp.Capabilities, protocol.CapabilityStreamStats)
+	if c.powerSave && !slices.Contains(resp.Capabilities, protocol.CapabilityPowerSave) {
+		c.logger.Info("The server does not support power saving; it keeps pinging idle tunnels")
+	}
+	if resp.ServerVersion != "" {
+		c.logger.Debug("Server capabilities",
+			zap.String("server_version", resp.ServerVersion),
+			zap.Int("protocol_version", resp.ProtocolVersion),
+			zap.Strings("capabilities", resp.Capabilities),
+		)
+	}
 
 	yamuxCfg := mux.NewClientConfig()
 
@@ -318,6 +576,31 @@ func (c *PoolClient) Connect() error {
 	c.wg.Add(1)
 	go c.pingLoop(primary)
 
+	if c.p2p && c.tunnelType == protocol.TunnelTypeTCP {
+		c.wg.Add(1)
+		go c.p2pWatchLoop(primary)
+	}
+
+	if !c.expiresAt.IsZero() {
+		c.wg.Add(1)
+		go c.expiryWatchLoop(primary)
+	}
+
+	if c.watchStreams {
+		c.wg.Add(1)
+		go c.streamStatsWatchLoop(primary)
+	}
+
+	if c.reportState {
+		c.wg.Add(1)
+		go c.clientStateLoop()
+	}
+
+	if c.checksBackends() {
+		c.wg.Add(1)
+		go c.backendHealthLoop()
+	}
+
 	if c.tunnelID != "" {
 		c.mu.Lock()
 		c.desiredTotal = c.initialSessions
@@ -355,7 +638,7 @@ func (c *PoolClient) acceptLoop(h *sessionHandle, isPrimary bool) {
 			}
 			if isPrimary {
 				c.logger.Debug("Primary session accept failed", zap.Error(err))
-				_ = c.Close()
+				_ = c.shutdown()
 				return
 			}
 
@@ -366,6 +649,7 @@ func (c *PoolClient) acceptLoop(h *sessionHandle, isPrimary bool) {
 
 		h.active.Add(1)
 		h.touch()
+		c.lastStream.Store(time.Now().UnixNano())
 
 		c.stats.AddRequest()
 		c.stats.IncActiveConnections()
@@ -383,7 +667,7 @@ func (c *PoolClient) sessionWatcher(h *sessionHandle, isPrimary bool) {
 		return
 	case <-h.session.CloseChan():
 		if isPrimary {
-			_ = c.Close()
+			_ = c.shutdown()
 			return
 		}
 		c.removeDataSession(h.id)
@@ -410,6 +694,9 @@ func (c *PoolClient) pingLoop(h *sessionHandle) {
 		if h.session == nil || h.session.IsClosed() {
 			return
 		}
+		if c.idle() {
+			continue
+		}
 
 		latency, err := h.session.Ping()
 		if err != nil {
@@ -426,7 +713,7 @@ func (c *PoolClient) pingLoop(h *sessionHandle) {
 					zap.Int("failures", consecutiveFailures),
 				)
 				if h.id == "primary" {
-					_ = c.Close()
+					_ = c.shutdown()
 					return
 				}
 				c.removeDataSession(h.id)
@@ -445,8 +732,17 @@ func (c *PoolClient) pingLoop(h *sessionHandle) {
 	}
 }
 
-// Close shuts down the client and all sessions.
+// Close shuts down the client and all sessions, first giving streams in
+// flight up to the drain timeout to finish.
 func (c *PoolClient) Close() error {
+	if !c.IsClosed() {
+		c.drainAll()
+	}
+	return c.shutdown()
+}
+
+// shutdown closes the client and all sessions immediately.
+func (c *PoolClient) shutdown() error {
 	var closeErr error
 
 	c.once.Do(func() {
@@ -500,6 +796,11 @@ func (c *PoolClient) GetSubdomain() string          { return c.subdomain }
 func (c *PoolClient) GetLatency() time.Duration     { return time.Duration(c.latencyNanos.Load()) }
 func (c *PoolClient) GetStats() *stats.TrafficStats { return c.stats }
 func (c *PoolClient) IsClosed() bool                { return c.closed.Load() }
+func (c *PoolClient) Paused() bool                  { return c.paused.Load() }
+
+// ExpiresAt returns when the server will close the tunnel, or the zero time
+// if it has no TTL.
+func (c *PoolClient) ExpiresAt() time.Time { return c.expiresAt }
 
 func (c *PoolClient) SetLatencyCallback(cb LatencyCallback) {
 	if cb == nil {
@@ -507,3 +808,17 @@ func (c *PoolClient) SetLatencyCallback(cb LatencyCallback) {
 	}
 	c.latencyCallback.Store(cb)
 }
+
+func (c *PoolClient) SetExpiryCallback(cb ExpiryCallback) {
+	if cb == nil {
+		cb = func(time.Time) {}
+	}
+	c.expiryCallback.Store(cb)
+}
+
+func (c *PoolClient) SetStreamStatsCallback(cb StreamStatsCallback) {
+	if cb == nil {
+		cb = func(protocol.StreamStats) {}
+	}
+	c.streamCallback.Store(cb)
+}
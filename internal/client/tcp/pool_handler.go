@@ -2,27 +2,37 @@ package tcp
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"crypto/tls"
 	"fmt"
 	"io"
 	"net"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
+	"drip/internal/shared/e2e"
 	"drip/internal/shared/httputil"
 	"drip/internal/shared/netutil"
 	"drip/internal/shared/pool"
 	"drip/internal/shared/protocol"
+	"drip/internal/shared/qos"
 
 	"go.uber.org/zap"
 )
 
+// pausedRetryAfterSeconds is the Retry-After sent while the tunnel is
+// paused, which usually lasts longer than an overload.
+const pausedRetryAfterSeconds = 60
+
 func (c *PoolClient) handleStream(h *sessionHandle, stream net.Conn) {
 	defer c.wg.Done()
 	defer func() {
 		h.active.Add(-1)
 		c.stats.DecActiveConnections()
+		c.lastStream.Store(time.Now().UnixNano())
 	}()
 	defer stream.Close()
 
@@ -30,16 +40,47 @@ func (c *PoolClient) handleStream(h *sessionHandle, stream net.Conn) {
 	case protocol.TunnelTypeHTTP, protocol.TunnelTypeHTTPS:
 		c.handleHTTPStream(stream)
 	default:
+		if c.Paused() {
+			return
+		}
 		c.handleTCPStream(stream)
 	}
 }
 
+// throttle limits stream to the client's rate, if it has one.
+func (c *PoolClient) throttle(stream net.Conn) net.Conn {
+	if !c.rate.IsLimited() {
+		return stream
+	}
+	return qos.NewLimitedConn(c.ctx, stream, c.rate)
+}
+
 func (c *PoolClient) handleTCPStream(stream net.Conn) {
-	localConn, err := net.DialTimeout("tcp", net.JoinHostPort(c.localHost, fmt.Sprintf("%d", c.localPort)), 10*time.Second)
-	if err != nil {
-		c.logger.Debug("Dial local failed", zap.Error(err))
-		return
+	stream = c.throttle(stream)
+	if c.e2eKey != "" {
+		secured, err := e2e.Server(stream, c.e2eKey)
+		if err != nil {
+			c.logger.Warn("E2E handshake failed", zap.Error(err))
+			return
+		}
+		stream = secured
 	}
+
+	var be *backend
+	var localConn net.Conn
+	for attempt := 0; ; attempt++ {
+		be = c.backends.acquire()
+		var err error
+		if localConn, err = net.DialTimeout("tcp", be.addr, 10*time.Second); err == nil {
+			break
+		}
+		c.backends.release(be)
+		c.logger.Debug("Dial local failed", zap.String("backend", be.addr), zap.Int("attempt", attempt+1), zap.Error(err))
+		if !c.retry.wait(c.ctx, attempt) {
+			return
+		}
+	}
+	defer c.backends.release(be)
 	defer localConn.Close()
 
 	if tcpConn, ok := localConn.(*net.TCPConn); ok {
@@ -61,6 +102,7 @@ func (c *PoolClient) handleTCPStream(stream net.Conn) {
 }
 
 func (c *PoolClient) handleHTTPStream(stream net.Conn) {
+	stream = c.throttle(stream)
 	_ = stream.SetReadDeadline(time.Now().Add(30 * time.Second))
 
 	cc := netutil.NewCountingConn(stream,
@@ -77,6 +119,11 @@ func (c *PoolClient) handleHTTPStream(stream net.Conn) {
 
 	_ = stream.SetReadDeadline(time.Time{})
 
+	if c.Paused() {
+		httputil.WriteRetryLater(cc, pausedRetryAfterSeconds, "This tunnel is paused, please retry later")
+		return
+	}
+
 	if httputil.IsWebSocketUpgrade(req) {
 		c.handleWebSocketUpgrade(&bufferedConn{Conn: cc, reader: br}, req)
 		return
@@ -85,42 +132,98 @@ func (c *PoolClient) handleHTTPStream(stream net.Conn) {
 	ctx, cancel := context.WithCancel(c.ctx)
 	defer cancel()
 
+	if !c.limiter.acquire(ctx) {
+		httputil.WriteRetryLater(cc, retryAfterSeconds, "The local service is overloaded, please retry later")
+		return
+	}
+	defer c.limiter.release()
+
 	scheme := "http"
 	if c.tunnelType == protocol.TunnelTypeHTTPS {
 		scheme = "https"
 	}
 
-	targetURL := fmt.Sprintf("%s://%s:%d%s", scheme, c.localHost, c.localPort, req.URL.RequestURI())
-	outReq, err := http.NewRequestWithContext(ctx, req.Method, targetURL, req.Body)
-	if err != nil {
-		httputil.WriteProxyError(cc, http.StatusBadGateway, "Bad Gateway")
-		return
+	// A request can only be sent again if its body is kept; small bodies
+	// of retryable requests are buffered for that.
+	retry := c.retry.allowsMethod(req.Method)
+	var reqBody []byte
+	if retry && req.Body != http.NoBody {
+		if req.ContentLength < 0 || req.ContentLength > maxRetryBody {
+			retry = false
+		} else if reqBody, err = io.ReadAll(req.Body); err != nil {
+			return
+		}
 	}
-	outReq.ContentLength = req.ContentLength
 
-	origHost := req.Host
-	httputil.CopyHeaders(outReq.Header, req.Header)
-	httputil.CleanHopByHopHeaders(outReq.Header)
+	var be *backend
+	var resp *http.Response
+	for attempt := 0; ; attempt++ {
+		be = c.backends.acquire()
+		var outBody io.Reader = req.Body
+		if retry {
+			outBody = bytes.NewReader(reqBody)
+		}
+		outReq, err := newLocalRequest(ctx, req, scheme, be, outBody)
+		if err != nil {
+			c.backends.release(be)
+			httputil.WriteProxyError(cc, http.StatusBadGateway, "Bad Gateway")
+			return
+		}
+		if resp, err = c.httpClient.Do(outReq); err == nil {
+			break
+		}
+		c.backends.release(be)
+		if !retry || !isDialError(err) || !c.retry.wait(ctx, attempt) {
+			httputil.WriteLocalServiceUnavailable(cc, be.port)
+			return
+		}
+		c.logger.Debug("Retrying local request", zap.String("backend", be.addr), zap.Int("attempt", attempt+1), zap.Error(err))
+	}
+	defer c.backends.release(be)
+	defer resp.Body.Close()
 
-	outReq.Header.Del("Accept-Encoding")
+	// Only this client may mark a body as compressed for the server.
+	resp.Header.Del(httputil.StreamEncodingHeader)
 
-	targetHost := c.localHost
-	if c.localPort != 80 && c.localPort != 443 {
-		targetHost = fmt.Sprintf("%s:%d", c.localHost, c.localPort)
-	}
-	outReq.Host = targetHost
-	outReq.Header.Set("Host", targetHost)
-	if origHost != "" {
-		outReq.Header.Set("X-Forwarded-Host", origHost)
+	if c.maxRespBody > 0 && resp.ContentLength > c.maxRespBody {
+		c.logger.Warn("Local response body too large",
+			zap.String("path", req.URL.Path),
+			zap.Int64("content_length", resp.ContentLength),
+			zap.Int64("max_response_body", c.maxRespBody),
+		)
+		httputil.WriteProxyError(cc, http.StatusBadGateway, "Response body too large")
+		return
 	}
-	outReq.Header.Set("X-Forwarded-Proto", "https")
 
-	resp, err := c.httpClient.Do(outReq)
-	if err != nil {
-		httputil.WriteLocalServiceUnavailable(cc, c.localPort)
-		return
+	// Streaming responses (SSE, NDJSON, ...) may stay idle far longer than the
+	// per-chunk deadline, so they only rely on context cancellation.
+	streaming := httputil.IsStreamingContentType(resp.Header.Get("Content-Type"))
+
+	// Trailers can only travel after a chunked body, so re-frame the response
+	// when the local service announced any. A body of unknown length that
+	// may be cut off at MaxResponseBody is chunked too, so that it does not
+	// look complete when it ends with the stream.
+	var chunked *httputil.ChunkedWriter
+	var compressor *httputil.StreamCompressor
+	var body io.Writer = cc
+	compress := streaming && c.streamCompression == httputil.StreamEncodingDeflate &&
+		resp.Header.Get("Content-Encoding") == ""
+	limited := c.maxRespBody > 0 && resp.ContentLength < 0 && resp.Body != http.NoBody
+	if len(resp.Trailer) > 0 || limited && !compress {
+		resp.Header.Del("Content-Length")
+		resp.Header.Set("Transfer-Encoding", "chunked")
+		if len(resp.Trailer) > 0 {
+			resp.Header.Set("Trailer", httputil.TrailerKeys(resp.Trailer))
+		}
+		chunked = httputil.NewChunkedWriter(cc)
+		body = chunked
+	} else if compress {
+		// The compressed body ends when the stream closes.
+		resp.Header.Del("Content-Length")
+		resp.Header.Set(httputil.StreamEncodingHeader, c.streamCompression)
+		compressor = httputil.NewStreamCompressor(cc)
+		body = compressor
 	}
-	defer resp.Body.Close()
 
 	_ = stream.SetWriteDeadline(time.Now().Add(30 * time.Second))
 	if err := writeResponseHeader(cc, resp); err != nil {
@@ -136,16 +239,36 @@ func (c *PoolClient) handleHTTPStream(stream net.Conn) {
 		}
 	}()
 
+	if streaming {
+		_ = stream.SetWriteDeadline(time.Time{})
+	}
+
 	buf := make([]byte, 32*1024)
+	var copied int64
 	for {
 		nr, er := resp.Body.Read(buf)
+		if copied += int64(nr); c.maxRespBody > 0 && copied > c.maxRespBody {
+			c.logger.Warn("Local response body too large, cutting it off",
+				zap.String("path", req.URL.Path),
+				zap.Int64("max_response_body", c.maxRespBody),
+			)
+			break
+		}
 		if nr > 0 {
-			_ = stream.SetWriteDeadline(time.Now().Add(10 * time.Second))
-			nw, ew := cc.Write(buf[:nr])
+			if !streaming {
+				_ = stream.SetWriteDeadline(time.Now().Add(10 * time.Second))
+			}
+			nw, ew := body.Write(buf[:nr])
 			if ew != nil || nr != nw {
 				break
 			}
 		}
+		if er == io.EOF && chunked != nil {
+			_ = chunked.Close(resp.Trailer)
+		}
+		if er == io.EOF && compressor != nil {
+			_ = compressor.Close()
+		}
 		if er != nil {
 			break
 		}
@@ -154,7 +277,10 @@ func (c *PoolClient) handleHTTPStream(stream net.Conn) {
 }
 
 func (c *PoolClient) handleWebSocketUpgrade(cc net.Conn, req *http.Request) {
-	targetAddr := net.JoinHostPort(c.localHost, fmt.Sprintf("%d", c.localPort))
+	be := c.backends.acquire()
+	defer c.backends.release(be)
+
+	targetAddr := be.addr
 	localConn, err := net.DialTimeout("tcp", targetAddr, 10*time.Second)
 	if err != nil {
 		httputil.WriteProxyError(cc, http.StatusBadGateway, "WebSocket backend unavailable")
@@ -163,7 +289,11 @@ func (c *PoolClient) handleWebSocketUpgrade(cc net.Conn, req *http.Request) {
 	defer localConn.Close()
 
 	if c.tunnelType == protocol.TunnelTypeHTTPS {
-		tlsConn := tls.Client(localConn, &tls.Config{InsecureSkipVerify: true})
+		tlsConfig := c.localTLS.Clone()
+		if tlsConfig.ServerName == "" {
+			tlsConfig.ServerName = be.host
+		}
+		tlsConn := tls.Client(localConn, tlsConfig)
 		if err := tlsConn.Handshake(); err != nil {
 			httputil.WriteProxyError(cc, http.StatusBadGateway, "TLS handshake failed")
 			return
@@ -217,11 +347,39 @@ func (c *bufferedConn) Read(p []byte) (int, error) {
 	return c.reader.Read(p)
 }
 
-func newLocalHTTPClient(tunnelType protocol.TunnelType) *http.Client {
-	var tlsConfig *tls.Config
-	if tunnelType == protocol.TunnelTypeHTTPS {
-		tlsConfig = &tls.Config{InsecureSkipVerify: true}
+// newLocalRequest builds the request for be from a request read off the
+// tunnel.
+func newLocalRequest(ctx context.Context, req *http.Request, scheme string, be *backend, body io.Reader) (*http.Request, error) {
+	targetURL := scheme + "://" + be.addr + req.URL.RequestURI()
+	outReq, err := http.NewRequestWithContext(ctx, req.Method, targetURL, body)
+	if err != nil {
+		return nil, err
+	}
+	outReq.ContentLength = req.ContentLength
+	outReq.Trailer = req.Trailer
+
+	httputil.CopyHeaders(outReq.Header, req.Header)
+	httputil.CleanHopByHopHeaders(outReq.Header)
+
+	outReq.Header.Del("Accept-Encoding")
+
+	targetHost := be.addr
+	if be.port == 80 || be.port == 443 {
+		// Default ports stay out of Host; IPv6 literals keep their brackets.
+		targetHost = strings.TrimSuffix(be.addr, ":"+strconv.Itoa(be.port))
 	}
+	outReq.Host = targetHost
+	outReq.Header.Set("Host", targetHost)
+	if req.Host != "" {
+		outReq.Header.Set("X-Forwarded-Host", req.Host)
+	}
+	outReq.Header.Set("X-Forwarded-Proto", "https")
+	return outReq, nil
+}
+
+// newLocalHTTPClient returns the client for requests to the local service.
+// tlsConfig is nil for plain HTTP services.
+func newLocalHTTPClient(tlsConfig *tls.Config) *http.Client {
 	return &http.Client{
 		Transport: &http.Transport{
 			MaxIdleConns:          2000,
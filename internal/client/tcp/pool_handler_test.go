@@ -0,0 +1,80 @@
+package tcp
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"drip/internal/shared/protocol"
+)
+
+func TestHandleHTTPStreamMaxResponseBody(t *testing.T) {
+	local := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/declared":
+			w.Header().Set("Content-Length", "100")
+			_, _ = w.Write(make([]byte, 100))
+		case "/small":
+			// Flushing first leaves the length unknown.
+			w.(http.Flusher).Flush()
+			_, _ = io.WriteString(w, "0123456789")
+		case "/large":
+			w.(http.Flusher).Flush()
+			_, _ = w.Write(make([]byte, 64<<10))
+		}
+	}))
+	defer local.Close()
+	_, portStr, _ := net.SplitHostPort(local.Listener.Addr().String())
+	port, _ := strconv.Atoi(portStr)
+
+	c := NewPoolClient(&ConnectorConfig{
+		ServerAddr:      "127.0.0.1:1",
+		TunnelType:      protocol.TunnelTypeHTTP,
+		LocalPort:       port,
+		MaxResponseBody: 16,
+	}, zap.NewNop())
+	defer c.shutdown()
+
+	get := func(path string) (*http.Response, []byte, error) {
+		server, client := net.Pipe()
+		defer client.Close()
+		go func() {
+			c.handleHTTPStream(server)
+			server.Close()
+		}()
+
+		_ = client.SetDeadline(time.Now().Add(5 * time.Second))
+		req, _ := http.NewRequest(http.MethodGet, "http://app.example.com"+path, nil)
+		if err := req.Write(client); err != nil {
+			t.Fatalf("%s: write request: %v", path, err)
+		}
+		resp, err := http.ReadResponse(bufio.NewReader(client), req)
+		if err != nil {
+			t.Fatalf("%s: read response: %v", path, err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		return resp, body, err
+	}
+
+	if resp, _, _ := get("/declared"); resp.StatusCode != http.StatusBadGateway {
+		t.Errorf("declared length over the limit: status = %d, want %d", resp.StatusCode, http.StatusBadGateway)
+	}
+	if resp, body, err := get("/small"); err != nil || resp.StatusCode != http.StatusOK || string(body) != "0123456789" {
+		t.Errorf("body within the limit = %d %q, %v", resp.StatusCode, body, err)
+	}
+	resp, body, err := get("/large")
+	if resp.StatusCode != http.StatusOK || !strings.EqualFold(resp.TransferEncoding[0], "chunked") {
+		t.Fatalf("body of unknown length: status = %d, transfer encoding = %v, want chunked", resp.StatusCode, resp.TransferEncoding)
+	}
+	if err == nil || len(body) >= 64<<10 {
+		t.Errorf("body over the limit read as complete (%d bytes, %v), want it cut off", len(body), err)
+	}
+}
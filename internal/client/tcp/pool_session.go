@@ -222,13 +222,8 @@ func (c *PoolClient) addDataSession() error {
 	_ = conn.SetReadDeadline(time.Time{})
 
 	if ack.Type == protocol.FrameTypeError {
-		var errMsg protocol.ErrorMessage
-		if e := json.Unmarshal(ack.Payload, &errMsg); e == nil {
-			_ = conn.Close()
-			return fmt.Errorf("data connect error: %s - %s", errMsg.Code, errMsg.Message)
-		}
 		_ = conn.Close()
-		return fmt.Errorf("data connect error")
+		return fmt.Errorf("data connect error: %w", protocol.DecodeError(ack.Payload))
 	}
 	if ack.Type != protocol.FrameTypeDataConnectAck {
 		_ = conn.Close()
@@ -315,7 +310,7 @@ func (c *PoolClient) removeIdleSessions(n int) {
 		if !found {
 			return
 		}
-		if c.removeDataSession(best.id) {
+		if c.retireDataSession(best.id) {
 			removed++
 		}
 		for i := range candidates {
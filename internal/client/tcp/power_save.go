@@ -0,0 +1,27 @@
+package tcp
+
+import (
+	"time"
+
+	"drip/internal/shared/constants"
+)
+
+// idle reports whether heartbeats should rest: power-saving mode is on and
+// the tunnel has had no streams for PowerSaveIdleTimeout. Dead connections
+// are then left to TCP keepalive, and the first stream to arrive brings
+// heartbeats back.
+func (c *PoolClient) idle() bool {
+	if !c.powerSave {
+		return false
+	}
+	idle := c.stats.GetActiveConnections() == 0 &&
+		time.Since(time.Unix(0, c.lastStream.Load())) >= constants.PowerSaveIdleTimeout
+	if c.resting.CompareAndSwap(!idle, idle) {
+		if idle {
+			c.logger.Debug("Tunnel idle, pausing heartbeats")
+		} else {
+			c.logger.Debug("Traffic resumed, heartbeats back on")
+		}
+	}
+	return idle
+}
@@ -0,0 +1,41 @@
+package tcp
+
+import (
+	"crypto/tls"
+	"sync"
+)
+
+// ResumeState lets a tunnel come back quickly after a brief disconnect. It
+// keeps the TLS session tickets of the servers connected to, so the next
+// handshake resumes without a certificate exchange, and the resume token
+// the server issued for the tunnel, so the next registration takes over
+// the stale tunnel the server may still be holding instead of being
+// refused its subdomain. Keep one per tunnel across reconnects.
+type ResumeState struct {
+	sessions tls.ClientSessionCache
+
+	mu     sync.Mutex
+	server string
+	token  string
+}
+
+// NewResumeState returns an empty ResumeState.
+func NewResumeState() *ResumeState {
+	return &ResumeState{sessions: tls.NewLRUClientSessionCache(0)}
+}
+
+// Token returns the resume token issued by server, if any.
+func (r *ResumeState) Token(server string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.server != server {
+		return ""
+	}
+	return r.token
+}
+
+func (r *ResumeState) setToken(server, token string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.server, r.token = server, token
+}
@@ -0,0 +1,79 @@
+package tcp
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultRetryBackoff is the wait before the first retry.
+	DefaultRetryBackoff = 200 * time.Millisecond
+	// maxRetryBackoff caps the doubling backoff between retries.
+	maxRetryBackoff = 5 * time.Second
+	// maxRetryBody is the largest request body kept in memory so the
+	// request can be sent again. Requests with larger bodies are not
+	// retried.
+	maxRetryBody = 1 << 20
+)
+
+// DefaultRetryMethods are the idempotent methods retried when
+// RetryPolicy.Methods is empty.
+var DefaultRetryMethods = []string{
+	http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete,
+}
+
+// RetryPolicy retries connections to the local service that fail to
+// dial, e.g. while the app restarts. Only dial failures are retried:
+// once the app has accepted a connection, its answer is final.
+type RetryPolicy struct {
+	Retries int           // extra attempts after a failed dial; 0 disables retries
+	Backoff time.Duration // wait before the first retry, doubled after each
+	Methods []string      // HTTP methods retried (default: DefaultRetryMethods)
+}
+
+// allowsMethod reports whether requests with method may be retried.
+func (p RetryPolicy) allowsMethod(method string) bool {
+	if p.Retries <= 0 {
+		return false
+	}
+	methods := p.Methods
+	if len(methods) == 0 {
+		methods = DefaultRetryMethods
+	}
+	return slices.ContainsFunc(methods, func(m string) bool { return strings.EqualFold(m, method) })
+}
+
+// wait sleeps before retry number attempt+1 and reports whether the
+// caller should go on; it returns false once attempts are used up or ctx
+// is done.
+func (p RetryPolicy) wait(ctx context.Context, attempt int) bool {
+	if attempt >= p.Retries {
+		return false
+	}
+	backoff := p.Backoff
+	if backoff <= 0 {
+		backoff = DefaultRetryBackoff
+	}
+	backoff = min(backoff<<attempt, maxRetryBackoff)
+
+	timer := time.NewTimer(backoff)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// isDialError reports whether err means no connection to the local
+// service was made, so nothing was sent and a retry is safe.
+func isDialError(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
@@ -0,0 +1,56 @@
+package tcp
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicy(t *testing.T) {
+	tests := []struct {
+		policy RetryPolicy
+		method string
+		want   bool
+	}{
+		{RetryPolicy{}, http.MethodGet, false},
+		{RetryPolicy{Retries: 2}, http.MethodGet, true},
+		{RetryPolicy{Retries: 2}, http.MethodPost, false},
+		{RetryPolicy{Retries: 2, Methods: []string{"post"}}, http.MethodPost, true},
+		{RetryPolicy{Retries: 2, Methods: []string{"POST"}}, http.MethodGet, false},
+	}
+	for _, tt := range tests {
+		if got := tt.policy.allowsMethod(tt.method); got != tt.want {
+			t.Errorf("%+v.allowsMethod(%s) = %v, want %v", tt.policy, tt.method, got, tt.want)
+		}
+	}
+
+	p := RetryPolicy{Retries: 1, Backoff: time.Millisecond}
+	if !p.wait(context.Background(), 0) {
+		t.Error("wait() refused the first retry")
+	}
+	if p.wait(context.Background(), 1) {
+		t.Error("wait() allowed more retries than configured")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if (RetryPolicy{Retries: 1, Backoff: time.Hour}).wait(ctx, 0) {
+		t.Error("wait() ignored a cancelled context")
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+	_, err = http.Get("http://" + addr)
+	if !isDialError(err) {
+		t.Errorf("isDialError(%v) = false for a refused connection", err)
+	}
+	if isDialError(errors.New("unexpected EOF")) {
+		t.Error("isDialError() = true for a read error")
+	}
+}
@@ -0,0 +1,59 @@
+package tcp
+
+import (
+	json "github.com/goccy/go-json"
+	"go.uber.org/zap"
+
+	"drip/internal/shared/protocol"
+)
+
+// streamStatsWatchLoop receives the server's stats of each finished stream
+// on the primary session and passes them to the stream stats callback.
+func (c *PoolClient) streamStatsWatchLoop(h *sessionHandle) {
+	defer c.wg.Done()
+
+	stream, err := h.session.Open()
+	if err != nil {
+		c.logger.Warn("Failed to open stream stats watch stream", zap.Error(err))
+		return
+	}
+	defer stream.Close()
+
+	go func() {
+		<-c.stopCh
+		_ = stream.Close()
+	}()
+
+	if err := protocol.WriteFrame(stream, protocol.NewFrame(protocol.FrameTypeStreamStatsWatch, []byte("{}"))); err != nil {
+		c.logger.Warn("Failed to request stream stats", zap.Error(err))
+		return
+	}
+
+	frames := protocol.NewFrameReader(stream)
+	frames.SetMaxFrameSize(protocol.MaxControlFrameSize)
+	for {
+		frame, err := frames.ReadFrame()
+		if err != nil {
+			return
+		}
+
+		switch frame.Type {
+		case protocol.FrameTypeStreamStats:
+			var stats protocol.StreamStats
+			if err := json.Unmarshal(frame.Payload, &stats); err == nil {
+				if cb, ok := c.streamCallback.Load().(StreamStatsCallback); ok && cb != nil {
+					cb(stats)
+				}
+			}
+		case protocol.FrameTypeError:
+			perr := protocol.DecodeError(frame.Payload)
+			c.logger.Debug("Server does not send stream stats",
+				zap.String("code", perr.Code),
+				zap.String("message", perr.Message),
+			)
+			frame.Release()
+			return
+		}
+		frame.Release()
+	}
+}
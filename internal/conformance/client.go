@@ -0,0 +1,203 @@
+package conformance
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	json "github.com/goccy/go-json"
+	"github.com/hashicorp/yamux"
+
+	"drip/internal/shared/constants"
+	"drip/internal/shared/httputil"
+	"drip/internal/shared/mux"
+	"drip/internal/shared/protocol"
+)
+
+// ClientConfig is the mock server CheckClient runs.
+type ClientConfig struct {
+	Listener    net.Listener // plain TCP; TLS is added with Certificate
+	Certificate tls.Certificate
+
+	// Version is sent as the server version.
+	Version string
+}
+
+// CheckClient plays a server for the first client that registers on
+// cfg.Listener: it replays ClientTranscripts, pings the session, sends a
+// visitor's request through the tunnel and waits for the client's state
+// heartbeat. HTTP requests arriving first, such as transport discovery, get
+// a 404. The client is disconnected before returning.
+func CheckClient(ctx context.Context, cfg ClientConfig) []Result {
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cfg.Certificate},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	conn, version, err := acceptClient(ctx, cfg.Listener, tlsConfig)
+	if err != nil {
+		return []Result{fail("client/tls", err)}
+	}
+	defer conn.Close()
+	if version != tls.VersionTLS13 {
+		return []Result{fail("client/tls", fmt.Errorf("negotiated %s, want TLS 1.3", tls.VersionName(version)))}
+	}
+	results := []Result{pass("client/tls", "TLS 1.3")}
+
+	register, heartbeat := ClientTranscripts[0], ClientTranscripts[1]
+	payload, err := play(conn, register.Steps[:1], FromServer, "", cfg.Version)
+	if err != nil {
+		return append(results, fail("client/"+register.Name, err))
+	}
+	var req protocol.RegisterRequest
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return append(results, fail("client/"+register.Name, err))
+	}
+	if _, err := play(conn, register.Steps[1:], FromServer, "", cfg.Version); err != nil {
+		return append(results, fail("client/"+register.Name, err))
+	}
+	results = append(results, pass("client/"+register.Name, fmt.Sprintf("%s tunnel, client %s", req.TunnelType, req.ClientVersion)))
+	_ = conn.SetReadDeadline(time.Time{})
+
+	// The public server runs the yamux client.
+	session, err := yamux.Client(conn, mux.NewServerConfig())
+	if err != nil {
+		return append(results, fail("client/ping", err))
+	}
+	defer session.Close()
+
+	if rtt, err := session.Ping(); err != nil {
+		results = append(results, fail("client/ping", err))
+	} else {
+		results = append(results, pass("client/ping", rtt.Round(time.Microsecond).String()))
+	}
+
+	if req.TunnelType == protocol.TunnelTypeTCP {
+		results = append(results, skip("client/visitor", "tcp tunnel"))
+	} else {
+		results = append(results, checkClientVisitor(session))
+	}
+
+	return append(results, checkClientHeartbeat(ctx, session, heartbeat, cfg.Version))
+}
+
+// acceptClient returns the first connection that does not start with an
+// HTTP request, and the TLS version it negotiated.
+func acceptClient(ctx context.Context, ln net.Listener, tlsConfig *tls.Config) (net.Conn, uint16, error) {
+	stop := context.AfterFunc(ctx, func() { _ = ln.Close() })
+	defer stop()
+
+	for {
+		raw, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, 0, ctx.Err()
+			}
+			return nil, 0, err
+		}
+		conn := tls.Server(raw, tlsConfig)
+		_ = conn.SetDeadline(time.Now().Add(DefaultTimeout))
+		if err := conn.HandshakeContext(ctx); err != nil {
+			_ = conn.Close()
+			return nil, 0, err
+		}
+
+		reader := bufio.NewReader(conn)
+		peek, err := reader.Peek(4)
+		if err != nil {
+			_ = conn.Close()
+			continue
+		}
+		if httputil.IsHTTPRequest(peek) {
+			if req, err := http.ReadRequest(reader); err == nil {
+				_ = req.Body.Close()
+				_, _ = io.WriteString(conn, "HTTP/1.1 404 Not Found\r\nContent-Length: 0\r\nConnection: close\r\n\r\n")
+			}
+			_ = conn.Close()
+			continue
+		}
+		_ = conn.SetDeadline(time.Time{})
+		return mux.NewBufferedConn(conn, reader), conn.ConnectionState().Version, nil
+	}
+}
+
+// checkClientVisitor sends a request through the tunnel. Any well-formed
+// response passes, since the client answers with a 502 when nothing
+// listens on its local port.
+func checkClientVisitor(session *yamux.Session) Result {
+	const name = "client/visitor"
+	stream, err := session.Open()
+	if err != nil {
+		return fail(name, err)
+	}
+	defer stream.Close()
+	_ = stream.SetDeadline(time.Now().Add(DefaultTimeout))
+
+	if _, err := io.WriteString(stream, "GET "+visitorPath+" HTTP/1.1\r\nHost: conformance.localhost\r\nConnection: close\r\n\r\n"); err != nil {
+		return fail(name, err)
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(stream), nil)
+	if err != nil {
+		return fail(name, err)
+	}
+	defer resp.Body.Close()
+	if _, err := io.Copy(io.Discard, resp.Body); err != nil {
+		return fail(name, err)
+	}
+	return pass(name, resp.Status)
+}
+
+// checkClientHeartbeat waits for the client to report its state on a
+// control stream. Other control frames are refused as unsupported.
+func checkClientHeartbeat(ctx context.Context, session *yamux.Session, t Transcript, version string) Result {
+	name := "client/" + t.Name
+	ctx, cancel := context.WithTimeout(ctx, DefaultTimeout)
+	defer cancel()
+	stop := context.AfterFunc(ctx, func() { _ = session.Close() })
+	defer stop()
+
+	for {
+		stream, err := session.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return fail(name, errors.New("no heartbeat received"))
+			}
+			return fail(name, err)
+		}
+		_ = stream.SetDeadline(time.Now().Add(DefaultTimeout))
+
+		frame, err := protocol.ReadFrameLimit(stream, protocol.MaxControlFrameSize)
+		if err != nil {
+			_ = stream.Close()
+			return fail(name, err)
+		}
+		typ, payload := frame.Type, append([]byte(nil), frame.Payload...)
+		frame.Release()
+
+		if typ != t.Steps[0].Type {
+			errFrame, _ := protocol.EncodeError(protocol.NewError(constants.ErrCodeUnsupported, "Unsupported control frame: "+typ.String()))
+			_ = protocol.WriteFrame(stream, errFrame)
+			_ = stream.Close()
+			continue
+		}
+
+		err = Match([]byte(t.Steps[0].Payload), payload)
+		if err == nil {
+			_, err = play(stream, t.Steps[1:], FromServer, "", version)
+		}
+		_ = stream.Close()
+		if err != nil {
+			return fail(name, err)
+		}
+
+		var hb protocol.ClientHeartbeat
+		_ = json.Unmarshal(payload, &hb)
+		return pass(name, fmt.Sprintf("%s on %s, %d streams, local healthy: %t", hb.Version, hb.OS, hb.ActiveStreams, hb.LocalHealthy))
+	}
+}
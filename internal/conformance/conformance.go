@@ -0,0 +1,91 @@
+// Package conformance checks that a drip server or client speaks the tunnel
+// protocol: golden frame encodings, handshake transcripts replayed against
+// a live peer, and a request carried over the tunnel. It backs
+// 'drip protocol-test', so third-party implementations and upgrades
+// between releases can be verified without reading the source.
+package conformance
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+
+	json "github.com/goccy/go-json"
+)
+
+// DefaultTimeout bounds each exchange with the peer under test.
+const DefaultTimeout = 10 * time.Second
+
+// Status is the outcome of a check.
+type Status string
+
+const (
+	StatusPass Status = "pass"
+	StatusFail Status = "fail"
+	StatusSkip Status = "skip"
+)
+
+// Result is the outcome of a single named check.
+type Result struct {
+	Name   string `json:"name"`
+	Status Status `json:"status"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// Count returns how many results have the given status.
+func Count(results []Result, status Status) int {
+	n := 0
+	for _, r := range results {
+		if r.Status == status {
+			n++
+		}
+	}
+	return n
+}
+
+func pass(name, detail string) Result {
+	return Result{Name: name, Status: StatusPass, Detail: detail}
+}
+
+func fail(name string, err error) Result {
+	return Result{Name: name, Status: StatusFail, Detail: err.Error()}
+}
+
+func skip(name, reason string) Result {
+	return Result{Name: name, Status: StatusSkip, Detail: reason}
+}
+
+// Wildcard in an expected payload matches any value, as long as the key is
+// present.
+const Wildcard = "*"
+
+// Match checks a received JSON payload against an expected one: every key
+// of want must be in got with an equal value, or any value if want has
+// Wildcard. Extra keys in got are allowed, so newer peers still match.
+func Match(want, got []byte) error {
+	var wantFields map[string]any
+	if err := json.Unmarshal(want, &wantFields); err != nil {
+		return fmt.Errorf("invalid expected payload: %w", err)
+	}
+	if len(wantFields) == 0 {
+		return nil
+	}
+
+	var gotFields map[string]any
+	if err := json.Unmarshal(got, &gotFields); err != nil {
+		return fmt.Errorf("payload is not a JSON object: %w", err)
+	}
+	for key, w := range wantFields {
+		g, ok := gotFields[key]
+		if !ok {
+			return fmt.Errorf("missing field %q", key)
+		}
+		if w == Wildcard {
+			continue
+		}
+		if !reflect.DeepEqual(w, g) {
+			return fmt.Errorf("field %q = %v, want %v", key, g, w)
+		}
+	}
+	return nil
+}
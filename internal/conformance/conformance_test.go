@@ -0,0 +1,145 @@
+package conformance
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"drip/internal/client/tcp"
+	"drip/internal/server/ports"
+	"drip/internal/server/proxy"
+	servertcp "drip/internal/server/tcp"
+	servertls "drip/internal/server/tls"
+	"drip/internal/server/tunnel"
+	"drip/internal/shared/protocol"
+)
+
+const testDomain = "conformance.localhost"
+
+func TestVectors(t *testing.T) {
+	for _, r := range CheckVectors() {
+		if r.Status != StatusPass {
+			t.Errorf("%s: %s", r.Name, r.Detail)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		want, got string
+		ok        bool
+	}{
+		{`{}`, ``, true},
+		{`{"code":"AUTH_FAILED"}`, `{"code":"AUTH_FAILED","message":"no"}`, true},
+		{`{"code":"AUTH_FAILED"}`, `{"code":"INVALID_REQUEST"}`, false},
+		{`{"url":"*"}`, `{"url":""}`, true},
+		{`{"url":"*"}`, `{"subdomain":"demo"}`, false},
+		{`{"protocol_version":1}`, `{"protocol_version":1}`, true},
+		{`{"capabilities":["ttl"]}`, `{"capabilities":["ttl","p2p"]}`, false},
+		{`{"code":"AUTH_FAILED"}`, `not json`, false},
+	}
+	for _, tt := range tests {
+		if err := Match([]byte(tt.want), []byte(tt.got)); (err == nil) != tt.ok {
+			t.Errorf("Match(%s, %s) = %v, want ok %v", tt.want, tt.got, err, tt.ok)
+		}
+	}
+}
+
+func TestCheckServer(t *testing.T) {
+	if testing.Short() {
+		t.Skip("starts a server")
+	}
+
+	cert, err := servertls.SelfSigned(testDomain, "*."+testDomain, "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	alloc, err := ports.NewAllocator(41000, 41010)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := zap.NewNop()
+	manager := tunnel.NewManager(logger)
+	listener := servertcp.NewListener(servertcp.ListenerConfig{
+		Address: "127.0.0.1:0",
+		TLSConfig: &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			MinVersion:   tls.VersionTLS13,
+		},
+		AuthToken: "secret",
+		Manager:   manager,
+		Logger:    logger,
+		PortAlloc: alloc,
+		Domain:    testDomain,
+		HTTPHandler: proxy.NewHandler(proxy.HandlerConfig{
+			Manager:      manager,
+			Logger:       logger,
+			ServerDomain: testDomain,
+			TunnelDomain: testDomain,
+		}),
+		TunnelDomain: testDomain,
+	})
+	if err := listener.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = listener.Shutdown(ctx)
+	})
+
+	results := CheckServer(context.Background(), ServerConfig{
+		Addr:     listener.Addr().String(),
+		Token:    "secret",
+		Insecure: true,
+		Version:  "v1.0.0",
+	})
+	for _, r := range results {
+		if r.Status != StatusPass {
+			t.Errorf("%s: %s %s", r.Name, r.Status, r.Detail)
+		}
+	}
+}
+
+func TestCheckClient(t *testing.T) {
+	if testing.Short() {
+		t.Skip("starts a client")
+	}
+
+	cert, err := servertls.SelfSigned("127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	done := make(chan []Result, 1)
+	go func() {
+		done <- CheckClient(context.Background(), ClientConfig{Listener: ln, Certificate: cert, Version: "v1.0.0"})
+	}()
+
+	client := tcp.NewTunnelClient(&tcp.ConnectorConfig{
+		ServerAddr: ln.Addr().String(),
+		TunnelType: protocol.TunnelTypeHTTP,
+		LocalHost:  "127.0.0.1",
+		LocalPort:  1,
+		Insecure:   true,
+	}, zap.NewNop())
+	if err := client.Connect(); err != nil {
+		t.Fatalf("Connect() error: %v", err)
+	}
+	defer client.Close()
+
+	for _, r := range <-done {
+		if r.Status != StatusPass {
+			t.Errorf("%s: %s %s", r.Name, r.Status, r.Detail)
+		}
+	}
+}
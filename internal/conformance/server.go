@@ -0,0 +1,246 @@
+package conformance
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"time"
+
+	json "github.com/goccy/go-json"
+	"github.com/hashicorp/yamux"
+
+	"drip/internal/shared/mux"
+	"drip/internal/shared/protocol"
+)
+
+// visitorPath is requested through the tunnel to check the data path.
+const visitorPath = "/drip-conformance"
+
+// ServerConfig is the server CheckServer connects to.
+type ServerConfig struct {
+	Addr     string // host:port of the tunnel server
+	Token    string
+	Insecure bool // skip certificate verification
+
+	// Version is sent as the client version. Servers refuse releases
+	// older than their minimum, so it should be a current one.
+	Version string
+}
+
+// CheckServer replays ServerTranscripts against a live server, then
+// checks the yamux session of the registered tunnel and that a visitor's
+// request reaches it. The tunnel is closed before returning.
+func CheckServer(ctx context.Context, cfg ServerConfig) []Result {
+	host, _, err := net.SplitHostPort(cfg.Addr)
+	if err != nil {
+		return []Result{fail("server/tls", fmt.Errorf("invalid server address %q: %w", cfg.Addr, err))}
+	}
+	tlsConfig := &tls.Config{
+		ServerName:         host,
+		InsecureSkipVerify: cfg.Insecure,
+		MinVersion:         tls.VersionTLS12,
+	}
+	dial := func() (*tls.Conn, error) {
+		d := &tls.Dialer{NetDialer: &net.Dialer{Timeout: DefaultTimeout}, Config: tlsConfig}
+		conn, err := d.DialContext(ctx, "tcp", cfg.Addr)
+		if err != nil {
+			return nil, err
+		}
+		return conn.(*tls.Conn), nil
+	}
+
+	conn, err := dial()
+	if err != nil {
+		return []Result{fail("server/tls", err)}
+	}
+	version := conn.ConnectionState().Version
+	_ = conn.Close()
+	if version != tls.VersionTLS13 {
+		return []Result{fail("server/tls", fmt.Errorf("negotiated %s, want TLS 1.3", tls.VersionName(version)))}
+	}
+	results := []Result{pass("server/tls", "TLS 1.3")}
+	results = append(results, checkDiscovery(ctx, cfg.Addr, tlsConfig))
+
+	var (
+		session *yamux.Session
+		resp    protocol.RegisterResponse
+	)
+	defer func() {
+		if session != nil {
+			_ = session.Close()
+		}
+	}()
+
+	for _, t := range ServerTranscripts {
+		name := "server/" + t.Name
+		if t.Control {
+			if session == nil {
+				results = append(results, skip(name, "no tunnel registered"))
+				continue
+			}
+			if t.Capability != "" && !slices.Contains(resp.Capabilities, t.Capability) {
+				results = append(results, skip(name, "server does not advertise "+t.Capability))
+				continue
+			}
+			stream, err := session.Open()
+			if err != nil {
+				results = append(results, fail(name, err))
+				continue
+			}
+			_, err = play(stream, t.Steps, FromClient, cfg.Token, cfg.Version)
+			_ = stream.Close()
+			results = append(results, result(name, err))
+			continue
+		}
+
+		if t.Name == "register_bad_token" && cfg.Token == "" {
+			results = append(results, skip(name, "no token given; the server may not require one"))
+			continue
+		}
+
+		conn, err := dial()
+		if err != nil {
+			results = append(results, fail(name, err))
+			continue
+		}
+		last, err := play(conn, t.Steps, FromClient, cfg.Token, cfg.Version)
+		if err != nil || session != nil || t.Steps[len(t.Steps)-1].Type != protocol.FrameTypeRegisterAck {
+			_ = conn.Close()
+			results = append(results, result(name, err))
+			continue
+		}
+
+		// The registration stays up for the control transcripts; the
+		// client side of the tunnel runs the yamux server.
+		if err := json.Unmarshal(last, &resp); err != nil {
+			_ = conn.Close()
+			results = append(results, fail(name, err))
+			continue
+		}
+		_ = conn.SetReadDeadline(time.Time{})
+		if session, err = yamux.Server(conn, mux.NewClientConfig()); err != nil {
+			_ = conn.Close()
+			results = append(results, fail(name, err))
+			continue
+		}
+		results = append(results, pass(name, resp.URL))
+	}
+
+	if session == nil {
+		return append(results, skip("server/ping", "no tunnel registered"), skip("server/visitor", "no tunnel registered"))
+	}
+	if rtt, err := session.Ping(); err != nil {
+		results = append(results, fail("server/ping", err))
+	} else {
+		results = append(results, pass("server/ping", rtt.Round(time.Microsecond).String()))
+	}
+	return append(results, checkVisitor(ctx, session, resp.URL, cfg.Addr, tlsConfig))
+}
+
+func result(name string, err error) Result {
+	if err != nil {
+		return fail(name, err)
+	}
+	return pass(name, "")
+}
+
+func checkDiscovery(ctx context.Context, addr string, tlsConfig *tls.Config) Result {
+	const name = "server/discover"
+	client := &http.Client{
+		Timeout:   DefaultTimeout,
+		Transport: &http.Transport{TLSClientConfig: tlsConfig},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://"+addr+"/_drip/discover", nil)
+	if err != nil {
+		return fail(name, err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fail(name, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fail(name, fmt.Errorf("status %s", resp.Status))
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, protocol.MaxControlFrameSize))
+	if err != nil {
+		return fail(name, err)
+	}
+	if err := Match([]byte(`{"transports":"*","tunnel_types":"*","preferred":"*"}`), body); err != nil {
+		return fail(name, err)
+	}
+	return pass(name, "")
+}
+
+// checkVisitor sends a request for the tunnel's host to the server and
+// answers it from the tunnel side. The server's own address is dialled, so
+// the tunnel's DNS name need not resolve.
+func checkVisitor(ctx context.Context, session *yamux.Session, tunnelURL, addr string, tlsConfig *tls.Config) Result {
+	const name = "server/visitor"
+	u, err := url.Parse(tunnelURL)
+	if err != nil || u.Host == "" {
+		return fail(name, fmt.Errorf("unexpected tunnel URL %q", tunnelURL))
+	}
+
+	served := make(chan error, 1)
+	go func() {
+		stream, err := session.Accept()
+		if err != nil {
+			served <- err
+			return
+		}
+		defer stream.Close()
+		_ = stream.SetDeadline(time.Now().Add(DefaultTimeout))
+
+		req, err := http.ReadRequest(bufio.NewReader(stream))
+		if err != nil {
+			served <- fmt.Errorf("tunnel stream: %w", err)
+			return
+		}
+		if req.URL.Path != visitorPath {
+			served <- fmt.Errorf("tunnel stream: got request for %q, want %q", req.URL.Path, visitorPath)
+			return
+		}
+		_, err = io.WriteString(stream, "HTTP/1.1 200 OK\r\nContent-Length: 11\r\nConnection: close\r\n\r\nconformance")
+		served <- err
+	}()
+
+	visitorTLS := tlsConfig.Clone()
+	visitorTLS.ServerName = u.Hostname()
+	client := &http.Client{
+		Timeout: DefaultTimeout,
+		Transport: &http.Transport{
+			TLSClientConfig: visitorTLS,
+			DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, network, addr)
+			},
+		},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.Scheme+"://"+u.Host+visitorPath, nil)
+	if err != nil {
+		return fail(name, err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fail(name, err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	if resp.StatusCode != http.StatusOK || string(body) != "conformance" {
+		return fail(name, fmt.Errorf("visitor got %s %q", resp.Status, body))
+	}
+
+	select {
+	case err := <-served:
+		return result(name, err)
+	case <-time.After(DefaultTimeout):
+		return fail(name, errors.New("request never reached the tunnel"))
+	}
+}
@@ -0,0 +1,157 @@
+package conformance
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	json "github.com/goccy/go-json"
+
+	"drip/internal/shared/protocol"
+)
+
+// Who sends a step of a transcript.
+const (
+	FromClient = "client"
+	FromServer = "server"
+)
+
+// Step is one frame of a transcript. Frames from the side being checked
+// are matched against Payload with Match; frames from the other side are
+// sent as Payload, after replacing the variables $TOKEN and $VERSION.
+type Step struct {
+	From    string
+	Type    protocol.FrameType
+	Payload string
+}
+
+// Transcript is a reference exchange of frames.
+type Transcript struct {
+	Name string
+
+	// Control transcripts run on a stream the client opens on the session
+	// after registering; the others on a new connection.
+	Control bool
+
+	// Capability, if set, is what the server must advertise in its
+	// RegisterResponse for the transcript to apply.
+	Capability string
+
+	Steps []Step
+}
+
+// ServerTranscripts are replayed by CheckServer, which plays the client.
+// The first is the registration whose session the control transcripts use.
+var ServerTranscripts = []Transcript{
+	{
+		Name: "register",
+		Steps: []Step{
+			{FromClient, protocol.FrameTypeRegister, `{"token":$TOKEN,"custom_subdomain":"","tunnel_type":"http","local_port":80,"connection_type":"primary","pool_capabilities":{"max_data_conns":0,"version":1},"client_version":$VERSION,"protocol_version":1}`},
+			{FromServer, protocol.FrameTypeRegisterAck, `{"subdomain":"*","url":"*","protocol_version":1,"capabilities":"*"}`},
+		},
+	},
+	{
+		Name: "register_bad_token",
+		Steps: []Step{
+			{FromClient, protocol.FrameTypeRegister, `{"token":"drip-conformance-invalid-token","custom_subdomain":"","tunnel_type":"http","local_port":80,"client_version":$VERSION,"protocol_version":1}`},
+			{FromServer, protocol.FrameTypeError, `{"code":"AUTH_FAILED","message":"*"}`},
+		},
+	},
+	{
+		Name: "register_malformed",
+		Steps: []Step{
+			{FromClient, protocol.FrameTypeRegister, `{"token":`},
+			{FromServer, protocol.FrameTypeError, `{"code":"INVALID_REQUEST","message":"*"}`},
+		},
+	},
+	{
+		Name: "register_wrong_frame",
+		Steps: []Step{
+			{FromClient, protocol.FrameTypeHeartbeat, ``},
+			{FromServer, protocol.FrameTypeError, `{"code":"INVALID_REQUEST","message":"*"}`},
+		},
+	},
+	{
+		Name:       "control_heartbeat",
+		Control:    true,
+		Capability: protocol.CapabilityClientState,
+		Steps: []Step{
+			{FromClient, protocol.FrameTypeHeartbeat, `{"version":$VERSION,"os":"conformance","active_streams":0,"local_healthy":true}`},
+			{FromServer, protocol.FrameTypeHeartbeatAck, `{}`},
+		},
+	},
+	{
+		Name:    "control_unsupported",
+		Control: true,
+		Steps: []Step{
+			{FromClient, protocol.FrameTypeRegisterAck, `{}`},
+			{FromServer, protocol.FrameTypeError, `{"code":"UNSUPPORTED","message":"*"}`},
+		},
+	},
+}
+
+// ClientTranscripts are replayed by CheckClient, which plays the server.
+var ClientTranscripts = []Transcript{
+	{
+		Name: "register",
+		Steps: []Step{
+			{FromClient, protocol.FrameTypeRegister, `{"token":"*","tunnel_type":"*","connection_type":"primary","client_version":"*","protocol_version":1,"pool_capabilities":"*"}`},
+			{FromServer, protocol.FrameTypeRegisterAck, `{"subdomain":"conformance","url":"https://conformance.localhost","message":"Tunnel registered","server_version":$VERSION,"protocol_version":1,"capabilities":["client_state"]}`},
+		},
+	},
+	{
+		Name:    "control_heartbeat",
+		Control: true,
+		Steps: []Step{
+			{FromClient, protocol.FrameTypeHeartbeat, `{"version":"*","os":"*","active_streams":"*","local_healthy":"*"}`},
+			{FromServer, protocol.FrameTypeHeartbeatAck, `{}`},
+		},
+	},
+}
+
+// expand replaces the variables of a payload with JSON strings.
+func expand(payload, token, version string) string {
+	quote := func(s string) string {
+		data, _ := json.Marshal(s)
+		return string(data)
+	}
+	return strings.NewReplacer("$TOKEN", quote(token), "$VERSION", quote(version)).Replace(payload)
+}
+
+// play runs the steps of a transcript on conn, sending the frames of the
+// side named self and checking those of its peer. It returns the payload
+// of the last frame received.
+func play(conn net.Conn, steps []Step, self, token, version string) ([]byte, error) {
+	var last []byte
+	for i, step := range steps {
+		if step.From == self {
+			payload := expand(step.Payload, token, version)
+			if err := protocol.WriteFrame(conn, protocol.NewFrame(step.Type, []byte(payload))); err != nil {
+				return nil, fmt.Errorf("step %d: send %s: %w", i+1, step.Type, err)
+			}
+			continue
+		}
+
+		_ = conn.SetReadDeadline(time.Now().Add(DefaultTimeout))
+		frame, err := protocol.ReadFrameLimit(conn, protocol.MaxControlFrameSize)
+		if err != nil {
+			return nil, fmt.Errorf("step %d: expected %s: %w", i+1, step.Type, err)
+		}
+		last = append([]byte(nil), frame.Payload...)
+		got := frame.Type
+		frame.Release()
+
+		if got != step.Type {
+			detail := ""
+			if got == protocol.FrameTypeError {
+				detail = ": " + protocol.DecodeError(last).Error()
+			}
+			return nil, fmt.Errorf("step %d: got %s frame, want %s%s", i+1, got, step.Type, detail)
+		}
+		if err := Match([]byte(expand(step.Payload, token, version)), last); err != nil {
+			return nil, fmt.Errorf("step %d: %s: %w", i+1, step.Type, err)
+		}
+	}
+	return last, nil
+}
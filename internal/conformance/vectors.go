@@ -0,0 +1,252 @@
+package conformance
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	json "github.com/goccy/go-json"
+
+	"drip/internal/shared/protocol"
+)
+
+// Vector is a golden frame encoding. On the wire a frame is a 4-byte
+// big-endian payload length and a 1-byte type, together Header, followed
+// by Payload.
+type Vector struct {
+	Name    string
+	Type    protocol.FrameType
+	Header  string // hex
+	Payload string
+
+	// Message returns the type Payload decodes into, or nil for frames
+	// without a JSON message. Payload is its canonical encoding: decoding
+	// and encoding it again gives the same bytes.
+	Message func() any
+}
+
+// Bytes returns the complete encoded frame.
+func (v Vector) Bytes() ([]byte, error) {
+	header, err := hex.DecodeString(v.Header)
+	if err != nil || len(header) != protocol.FrameHeaderSize {
+		return nil, fmt.Errorf("invalid header %q", v.Header)
+	}
+	return append(header, v.Payload...), nil
+}
+
+// Vectors are the golden encodings of the frames of protocol version 1.
+var Vectors = []Vector{
+	{
+		Name:    "register",
+		Type:    protocol.FrameTypeRegister,
+		Header:  "000000ea01",
+		Payload: `{"token":"secret","custom_subdomain":"demo","tunnel_type":"http","local_port":3000,"connection_type":"primary","pool_capabilities":{"max_data_conns":3,"version":1},"labels":{"env":"dev"},"client_version":"v1.0.0","protocol_version":1}`,
+		Message: func() any { return &protocol.RegisterRequest{} },
+	},
+	{
+		Name:    "register_ack",
+		Type:    protocol.FrameTypeRegisterAck,
+		Header:  "000000f502",
+		Payload: `{"subdomain":"demo","url":"https://demo.example.com","message":"Tunnel registered","tunnel_id":"4f2a9c1e","supports_data_conn":true,"recommended_conns":4,"server_version":"v1.0.0","protocol_version":1,"capabilities":["data_conn","client_state"]}`,
+		Message: func() any { return &protocol.RegisterResponse{} },
+	},
+	{
+		Name:    "error",
+		Type:    protocol.FrameTypeError,
+		Header:  "0000003f06",
+		Payload: `{"code":"AUTH_FAILED","message":"Invalid authentication token"}`,
+		Message: func() any { return &protocol.ErrorMessage{} },
+	},
+	{
+		// Sent on the primary connection by clients without a session.
+		Name:   "heartbeat_empty",
+		Type:   protocol.FrameTypeHeartbeat,
+		Header: "0000000003",
+	},
+	{
+		Name:    "heartbeat",
+		Type:    protocol.FrameTypeHeartbeat,
+		Header:  "0000004f03",
+		Payload: `{"version":"v1.0.0","os":"linux/amd64","active_streams":2,"local_healthy":true}`,
+		Message: func() any { return &protocol.ClientHeartbeat{} },
+	},
+	{
+		Name:   "heartbeat_ack_empty",
+		Type:   protocol.FrameTypeHeartbeatAck,
+		Header: "0000000004",
+	},
+	{
+		Name:    "heartbeat_ack",
+		Type:    protocol.FrameTypeHeartbeatAck,
+		Header:  "0000000204",
+		Payload: `{}`,
+	},
+	{
+		Name:   "close",
+		Type:   protocol.FrameTypeClose,
+		Header: "0000000005",
+	},
+	{
+		Name:    "data_connect",
+		Type:    protocol.FrameTypeDataConnect,
+		Header:  "0000004207",
+		Payload: `{"tunnel_id":"4f2a9c1e","token":"secret","connection_id":"data-1"}`,
+		Message: func() any { return &protocol.DataConnectRequest{} },
+	},
+	{
+		Name:    "data_connect_ack",
+		Type:    protocol.FrameTypeDataConnectAck,
+		Header:  "0000002a08",
+		Payload: `{"accepted":true,"connection_id":"data-1"}`,
+		Message: func() any { return &protocol.DataConnectResponse{} },
+	},
+	{
+		Name:    "rules_update",
+		Type:    protocol.FrameTypeRulesUpdate,
+		Header:  "0000002d09",
+		Payload: `{"rules":[{"action":"deny","path":"/admin"}]}`,
+		Message: func() any { return &protocol.RulesUpdateRequest{} },
+	},
+	{
+		Name:    "rules_update_ack",
+		Type:    protocol.FrameTypeRulesUpdateAck,
+		Header:  "000000110a",
+		Payload: `{"accepted":true}`,
+		Message: func() any { return &protocol.RulesUpdateResponse{} },
+	},
+	{
+		Name:    "p2p_watch",
+		Type:    protocol.FrameTypeP2PWatch,
+		Header:  "000000020b",
+		Payload: `{}`,
+	},
+	{
+		Name:    "p2p_offer",
+		Type:    protocol.FrameTypeP2POffer,
+		Header:  "0000002e0c",
+		Payload: `{"id":"7d1e","peer_addr":"198.51.100.7:41000"}`,
+		Message: func() any { return &protocol.P2POffer{} },
+	},
+	{
+		Name:    "expiry_watch",
+		Type:    protocol.FrameTypeExpiryWatch,
+		Header:  "000000020d",
+		Payload: `{}`,
+	},
+	{
+		Name:    "expiry_notice",
+		Type:    protocol.FrameTypeExpiryNotice,
+		Header:  "000000190e",
+		Payload: `{"expires_at":1767225600}`,
+		Message: func() any { return &protocol.ExpiryNotice{} },
+	},
+	{
+		Name:    "drain",
+		Type:    protocol.FrameTypeDrain,
+		Header:  "0000001d0f",
+		Payload: `{"connection_ids":["data-1"]}`,
+		Message: func() any { return &protocol.DrainRequest{} },
+	},
+	{
+		Name:    "drain_ack",
+		Type:    protocol.FrameTypeDrainAck,
+		Header:  "0000001110",
+		Payload: `{"accepted":true}`,
+		Message: func() any { return &protocol.DrainResponse{} },
+	},
+	{
+		Name:    "pause",
+		Type:    protocol.FrameTypePause,
+		Header:  "0000000f11",
+		Payload: `{"paused":true}`,
+		Message: func() any { return &protocol.PauseRequest{} },
+	},
+	{
+		Name:    "pause_ack",
+		Type:    protocol.FrameTypePauseAck,
+		Header:  "0000001112",
+		Payload: `{"accepted":true}`,
+		Message: func() any { return &protocol.PauseResponse{} },
+	},
+}
+
+// RejectVectors are encodings a reader must refuse, with the payload limit
+// it reads them with. Only headers are given: the length must be checked
+// before the payload is read.
+var RejectVectors = []struct {
+	Name   string
+	Header string
+	Limit  int
+}{
+	{"control_frame_too_large", "0001000101", protocol.MaxControlFrameSize},
+	{"frame_too_large", "0010000103", protocol.MaxFrameSize},
+	{"truncated_header", "000000", protocol.MaxFrameSize},
+}
+
+// CheckVectors checks this build's frame codec and message types against
+// the golden vectors.
+func CheckVectors() []Result {
+	var results []Result
+	for _, v := range Vectors {
+		name := "vector/" + v.Name
+		if err := checkVector(v); err != nil {
+			results = append(results, fail(name, err))
+			continue
+		}
+		results = append(results, pass(name, ""))
+	}
+
+	for _, v := range RejectVectors {
+		name := "vector/" + v.Name
+		header, _ := hex.DecodeString(v.Header)
+		frame, err := protocol.ReadFrameLimit(bytes.NewReader(header), v.Limit)
+		if err == nil {
+			frame.Release()
+			results = append(results, fail(name, errors.New("frame was accepted")))
+			continue
+		}
+		results = append(results, pass(name, err.Error()))
+	}
+	return results
+}
+
+func checkVector(v Vector) error {
+	want, err := v.Bytes()
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if err := protocol.WriteFrame(&buf, protocol.NewFrame(v.Type, []byte(v.Payload))); err != nil {
+		return fmt.Errorf("encode: %w", err)
+	}
+	if !bytes.Equal(buf.Bytes(), want) {
+		return fmt.Errorf("encoded as %x, want %x", buf.Bytes(), want)
+	}
+
+	frame, err := protocol.ReadFrame(bytes.NewReader(want))
+	if err != nil {
+		return fmt.Errorf("decode: %w", err)
+	}
+	defer frame.Release()
+	if frame.Type != v.Type || string(frame.Payload) != v.Payload {
+		return fmt.Errorf("decoded as %s %q, want %s %q", frame.Type, frame.Payload, v.Type, v.Payload)
+	}
+
+	if v.Message == nil {
+		return nil
+	}
+	msg := v.Message()
+	if err := json.Unmarshal([]byte(v.Payload), msg); err != nil {
+		return fmt.Errorf("unmarshal %T: %w", msg, err)
+	}
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("marshal %T: %w", msg, err)
+	}
+	if string(data) != v.Payload {
+		return fmt.Errorf("%T marshals as %s", msg, data)
+	}
+	return nil
+}
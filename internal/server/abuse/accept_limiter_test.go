@@ -0,0 +1,89 @@
+package abuse
+
+import "testing"
+
+func TestAcceptLimiterMaxConnections(t *testing.T) {
+	a := NewAcceptLimiter(AcceptConfig{MaxConnections: 2})
+
+	if !a.Acquire() || !a.Acquire() {
+		t.Fatal("Acquire() = false below the cap")
+	}
+	if a.Acquire() {
+		t.Fatal("Acquire() = true above the cap")
+	}
+	if got := a.Active(); got != 2 {
+		t.Errorf("Active() = %d, want 2", got)
+	}
+
+	a.Release()
+	if !a.Acquire() {
+		t.Error("Acquire() = false after Release")
+	}
+}
+
+func TestAcceptLimiterMaxConnectionsPerIP(t *testing.T) {
+	a := NewAcceptLimiter(AcceptConfig{MaxConnectionsPerIP: 2})
+
+	if !a.AcquireIP("192.0.2.1") || !a.AcquireIP("192.0.2.1") {
+		t.Fatal("AcquireIP() = false below the cap")
+	}
+	if a.AcquireIP("192.0.2.1") {
+		t.Fatal("AcquireIP() = true above the cap")
+	}
+	if !a.AcquireIP("192.0.2.2") {
+		t.Error("AcquireIP() = false for another IP")
+	}
+
+	a.ReleaseIP("192.0.2.1")
+	if !a.AcquireIP("192.0.2.1") {
+		t.Error("AcquireIP() = false after ReleaseIP")
+	}
+
+	a.ReleaseIP("192.0.2.2")
+	if _, ok := a.perIP["192.0.2.2"]; ok {
+		t.Error("released IP still tracked")
+	}
+}
+
+func TestAcceptLimiterRate(t *testing.T) {
+	a := NewAcceptLimiter(AcceptConfig{Rate: 1, Burst: 3})
+
+	admitted := 0
+	for i := 0; i < 10; i++ {
+		if a.Acquire() {
+			admitted++
+		}
+	}
+	if admitted != 3 {
+		t.Errorf("admitted %d connections in a burst, want 3", admitted)
+	}
+}
+
+func TestAcceptLimiterDisabled(t *testing.T) {
+	a := NewAcceptLimiter(AcceptConfig{})
+	if a != nil {
+		t.Fatalf("NewAcceptLimiter() = %v, want nil without limits", a)
+	}
+	for i := 0; i < 100; i++ {
+		if !a.Acquire() {
+			t.Fatal("nil limiter rejected a connection")
+		}
+	}
+	a.Release()
+}
+
+func TestAcceptLimiterUpdate(t *testing.T) {
+	var a AcceptLimiter
+	if !a.Acquire() {
+		t.Fatal("zero limiter rejected a connection")
+	}
+
+	a.Update(AcceptConfig{MaxConnections: 1})
+	if a.Acquire() {
+		t.Error("Acquire() = true above the updated cap")
+	}
+	a.Release()
+	if !a.Acquire() {
+		t.Error("Acquire() = false after Release")
+	}
+}
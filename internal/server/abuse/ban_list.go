@@ -0,0 +1,330 @@
+// Package abuse tracks misbehaving peers on the public edge and applies
+// temporary bans before any expensive work (such as TLS) is done.
+package abuse
+
+import (
+	"container/list"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"drip/internal/server/audit"
+	"drip/internal/server/metrics"
+	"drip/internal/shared/netutil"
+)
+
+// Config controls when and for how long IPs are banned.
+type Config struct {
+	// Threshold is the number of failures within Window that triggers a ban.
+	// Zero disables automatic banning.
+	Threshold int
+	Window    time.Duration
+	// BanDuration is the first ban length; each repeat ban doubles it up to
+	// MaxBanDuration.
+	BanDuration    time.Duration
+	MaxBanDuration time.Duration
+}
+
+// Ban describes an active ban.
+type Ban struct {
+	IP          string    `json:"ip"`
+	Reason      string    `json:"reason"`
+	BannedUntil time.Time `json:"banned_until"`
+	BanCount    int       `json:"ban_count"`
+}
+
+// maxBanEntries caps the peers a ban list tracks; the one whose last
+// failure is oldest makes room for a new one.
+const maxBanEntries = 100000
+
+type entry struct {
+	key         string
+	failures    int
+	windowStart time.Time
+	bannedUntil time.Time
+	banCount    int
+	lastBan     time.Time
+	reason      string
+}
+
+// BanList records failures per IP and bans IPs that exceed the threshold.
+// IPv6 peers are counted and banned per /64, since a single host can
+// rotate through its whole prefix. IPs on its blocked list are refused
+// regardless.
+type BanList struct {
+	mu      sync.Mutex
+	entries map[string]*list.Element // of *entry
+	lru     *list.List               // most recent failure first
+	cfg     Config
+	blocked *netutil.IPAccessChecker
+	logger  *zap.Logger
+	audit   *audit.Log
+}
+
+// NewBanList creates a ban list. Missing durations get sensible defaults.
+func NewBanList(cfg Config, logger *zap.Logger) *BanList {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	return &BanList{
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+		cfg:     withDefaults(cfg),
+		logger:  logger,
+	}
+}
+
+func withDefaults(cfg Config) Config {
+	if cfg.Window <= 0 {
+		cfg.Window = time.Minute
+	}
+	if cfg.BanDuration <= 0 {
+		cfg.BanDuration = time.Minute
+	}
+	if cfg.MaxBanDuration < cfg.BanDuration {
+		cfg.MaxBanDuration = max(time.Hour, cfg.BanDuration)
+	}
+	return cfg
+}
+
+// Reconfigure replaces the thresholds and durations of a running ban list.
+// Active bans run out as they were given.
+func (b *BanList) Reconfigure(cfg Config) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.cfg = withDefaults(cfg)
+}
+
+// SetBlocked refuses the IPs denied by checker outright, on top of
+// automatic bans. Nil clears the list.
+func (b *BanList) SetBlocked(checker *netutil.IPAccessChecker) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.blocked = checker
+}
+
+// SetAudit records bans in the audit log.
+func (b *BanList) SetAudit(log *audit.Log) {
+	b.audit = log
+}
+
+// Enabled reports whether automatic banning is active.
+func (b *BanList) Enabled() bool {
+	if b == nil {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.cfg.Threshold > 0
+}
+
+// IsBanned reports whether ip is currently banned or blocked.
+func (b *BanList) IsBanned(ip string) bool {
+	if b == nil || ip == "" {
+		return false
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.blocked.HasRules() && !b.blocked.IsAllowed(ip) {
+		metrics.BannedConnectionsRejected.Inc()
+		return true
+	}
+	if b.cfg.Threshold <= 0 {
+		return false
+	}
+	el, ok := b.entries[banKey(ip)]
+	if !ok || !time.Now().Before(el.Value.(*entry).bannedUntil) {
+		return false
+	}
+	metrics.BannedConnectionsRejected.Inc()
+	return true
+}
+
+// RecordFailure counts a handshake or protocol failure from ip and bans it
+// once the threshold is reached. Private and loopback addresses are never
+// banned since they usually belong to a local reverse proxy.
+func (b *BanList) RecordFailure(ip, reason string) bool {
+	if !b.Enabled() || ip == "" || netutil.IsPrivateIP(ip) {
+		return false
+	}
+
+	now := time.Now()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// The ban list may have been reconfigured since Enabled.
+	if b.cfg.Threshold <= 0 {
+		return false
+	}
+	key := banKey(ip)
+	var e *entry
+	if el, ok := b.entries[key]; ok {
+		e = el.Value.(*entry)
+		b.lru.MoveToFront(el)
+	} else {
+		e = &entry{key: key, windowStart: now}
+		b.entries[key] = b.lru.PushFront(e)
+		for b.lru.Len() > maxBanEntries {
+			b.removeLocked(b.lru.Back())
+		}
+	}
+	if now.Before(e.bannedUntil) {
+		return true
+	}
+	if now.Sub(e.windowStart) > b.cfg.Window {
+		e.failures = 0
+		e.windowStart = now
+	}
+	// Forget earlier bans once the peer has behaved for a long while.
+	if e.banCount > 0 && now.Sub(e.lastBan) > 24*time.Hour {
+		e.banCount = 0
+	}
+
+	e.failures++
+	if e.failures < b.cfg.Threshold {
+		return false
+	}
+
+	e.banCount++
+	duration := b.cfg.BanDuration << (e.banCount - 1)
+	if duration <= 0 || duration > b.cfg.MaxBanDuration {
+		duration = b.cfg.MaxBanDuration
+	}
+	e.bannedUntil = now.Add(duration)
+	e.lastBan = now
+	e.failures = 0
+	e.reason = reason
+
+	metrics.IPBansTotal.WithLabelValues(reason).Inc()
+	metrics.BannedIPs.Set(float64(b.activeLocked(now)))
+
+	b.logger.Warn("IP temporarily banned",
+		zap.String("ip", key),
+		zap.String("reason", reason),
+		zap.Duration("duration", duration),
+		zap.Int("ban_count", e.banCount),
+	)
+	b.audit.Record(audit.Event{
+		Type: audit.TypeBan,
+		IP:   key,
+		Detail: map[string]string{
+			"reason":    reason,
+			"duration":  duration.String(),
+			"ban_count": strconv.Itoa(e.banCount),
+		},
+	})
+	return true
+}
+
+// List returns active bans sorted by expiry.
+func (b *BanList) List() []Ban {
+	if b == nil {
+		return nil
+	}
+	now := time.Now()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	bans := make([]Ban, 0)
+	for key, el := range b.entries {
+		if e := el.Value.(*entry); now.Before(e.bannedUntil) {
+			bans = append(bans, Ban{IP: key, Reason: e.reason, BannedUntil: e.bannedUntil, BanCount: e.banCount})
+		}
+	}
+	sort.Slice(bans, func(i, j int) bool { return bans[i].BannedUntil.Before(bans[j].BannedUntil) })
+	return bans
+}
+
+// Unban lifts the ban on ip, or on the /64 it belongs to, and resets its
+// history.
+func (b *BanList) Unban(ip string) bool {
+	if b == nil {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	el, ok := b.entries[banKey(ip)]
+	if !ok {
+		return false
+	}
+	wasBanned := time.Now().Before(el.Value.(*entry).bannedUntil)
+	b.removeLocked(el)
+	metrics.BannedIPs.Set(float64(b.activeLocked(time.Now())))
+	return wasBanned
+}
+
+// Clear removes all bans and failure history, returning the number of
+// bans that were lifted.
+func (b *BanList) Clear() int {
+	if b == nil {
+		return 0
+	}
+	now := time.Now()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	n := b.activeLocked(now)
+	b.entries = make(map[string]*list.Element)
+	b.lru.Init()
+	metrics.BannedIPs.Set(0)
+	return n
+}
+
+// Cleanup drops entries that are neither banned nor counting failures.
+func (b *BanList) Cleanup() {
+	if b == nil {
+		return
+	}
+	now := time.Now()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, el := range b.entries {
+		e := el.Value.(*entry)
+		if now.Before(e.bannedUntil) || now.Sub(e.windowStart) <= b.cfg.Window {
+			continue
+		}
+		if e.banCount > 0 && now.Sub(e.lastBan) <= 24*time.Hour {
+			continue
+		}
+		b.removeLocked(el)
+	}
+	metrics.BannedIPs.Set(float64(b.activeLocked(now)))
+}
+
+func (b *BanList) removeLocked(el *list.Element) {
+	b.lru.Remove(el)
+	delete(b.entries, el.Value.(*entry).key)
+}
+
+func (b *BanList) activeLocked(now time.Time) int {
+	n := 0
+	for _, el := range b.entries {
+		if now.Before(el.Value.(*entry).bannedUntil) {
+			n++
+		}
+	}
+	return n
+}
+
+// banKey returns the unit ip is counted and banned as: the address itself
+// for IPv4 and its /64 for IPv6. Anything else, such as a key List
+// returned, is used as is.
+func banKey(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil || parsed.To4() != nil {
+		return ip
+	}
+	return parsed.Mask(net.CIDRMask(64, 128)).String() + "/64"
+}
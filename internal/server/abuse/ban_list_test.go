@@ -0,0 +1,116 @@
+package abuse
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"drip/internal/shared/netutil"
+)
+
+func TestBanListThreshold(t *testing.T) {
+	b := NewBanList(Config{Threshold: 3, BanDuration: time.Minute, MaxBanDuration: time.Hour}, nil)
+	ip := "203.0.113.7"
+
+	for i := 0; i < 2; i++ {
+		if b.RecordFailure(ip, "tls_handshake") {
+			t.Fatalf("failure %d should not ban", i+1)
+		}
+	}
+	if b.IsBanned(ip) {
+		t.Fatal("IP banned before reaching threshold")
+	}
+	if !b.RecordFailure(ip, "tls_handshake") {
+		t.Fatal("third failure should ban")
+	}
+	if !b.IsBanned(ip) {
+		t.Fatal("IP should be banned")
+	}
+
+	bans := b.List()
+	if len(bans) != 1 || bans[0].IP != ip || bans[0].BanCount != 1 {
+		t.Errorf("List() = %+v", bans)
+	}
+
+	if !b.Unban(ip) {
+		t.Error("Unban() = false, want true")
+	}
+	if b.IsBanned(ip) {
+		t.Error("IP still banned after Unban")
+	}
+}
+
+func TestBanListExemptsPrivateAndDisabled(t *testing.T) {
+	b := NewBanList(Config{Threshold: 1}, nil)
+	if b.RecordFailure("127.0.0.1", "protocol") {
+		t.Error("loopback address should never be banned")
+	}
+
+	disabled := NewBanList(Config{}, nil)
+	if disabled.Enabled() {
+		t.Error("zero threshold should disable banning")
+	}
+	if disabled.RecordFailure("203.0.113.7", "protocol") {
+		t.Error("disabled ban list should not ban")
+	}
+}
+
+func TestBanListReconfigure(t *testing.T) {
+	b := NewBanList(Config{}, nil)
+	b.SetBlocked(netutil.NewIPAccessChecker(nil, []string{"198.51.100.0/24"}))
+	if !b.IsBanned("198.51.100.20") || b.IsBanned("203.0.113.7") {
+		t.Error("blocked list not applied with automatic banning disabled")
+	}
+
+	b.Reconfigure(Config{Threshold: 1})
+	if !b.Enabled() || !b.RecordFailure("203.0.113.7", "protocol") || !b.IsBanned("203.0.113.7") {
+		t.Error("Reconfigure() did not turn on automatic banning")
+	}
+
+	b.SetBlocked(nil)
+	if b.IsBanned("198.51.100.20") {
+		t.Error("IP still blocked after clearing the list")
+	}
+}
+
+func TestBanListIPv6Prefix(t *testing.T) {
+	b := NewBanList(Config{Threshold: 3}, nil)
+
+	// Rotating addresses within one /64 still reaches the threshold.
+	for _, ip := range []string{"2001:db8:1:2::1", "2001:db8:1:2::2", "2001:db8:1:2:ffff::3"} {
+		b.RecordFailure(ip, "protocol")
+	}
+	if !b.IsBanned("2001:db8:1:2::dead") {
+		t.Error("address in the failing /64 not banned")
+	}
+	if b.IsBanned("2001:db8:1:3::1") {
+		t.Error("address in a neighbouring /64 banned")
+	}
+
+	bans := b.List()
+	if len(bans) != 1 || bans[0].IP != "2001:db8:1:2::/64" {
+		t.Fatalf("List() = %+v, want one ban on 2001:db8:1:2::/64", bans)
+	}
+	if !b.Unban(bans[0].IP) || b.IsBanned("2001:db8:1:2::1") {
+		t.Error("Unban() of the listed prefix did not lift the ban")
+	}
+}
+
+func TestBanListBounded(t *testing.T) {
+	b := NewBanList(Config{Threshold: 2}, nil)
+	b.RecordFailure("203.0.113.7", "protocol")
+	for i := 0; i < maxBanEntries; i++ {
+		b.RecordFailure(fmt.Sprintf("2001:db8:%x:%x::1", i>>16, i&0xffff), "protocol")
+	}
+
+	b.mu.Lock()
+	n := len(b.entries)
+	_, kept := b.entries["203.0.113.7"]
+	b.mu.Unlock()
+	if n != maxBanEntries {
+		t.Errorf("%d entries tracked, want the cap of %d", n, maxBanEntries)
+	}
+	if kept {
+		t.Error("oldest entry kept beyond the cap")
+	}
+}
@@ -0,0 +1,206 @@
+// Package audit keeps an append-only trail of security-relevant server
+// events, separate from the operational log, for operators who must be
+// able to show who registered what and which requests were refused.
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	json "github.com/goccy/go-json"
+	"go.uber.org/zap"
+)
+
+// Event types written to the audit log.
+const (
+	TypeRegister    = "register"     // a tunnel was registered
+	TypeAuthFailure = "auth_failure" // a client or API caller presented a wrong token
+	TypeAdmin       = "admin"        // server state was changed through the admin API
+	TypeBan         = "ban"          // an IP was banned automatically
+	TypeQuota       = "quota"        // a registration was refused by a limit
+)
+
+// tailSize is how much of an existing chained log is read to find the
+// hash the next event links to. Events are far smaller than this.
+const tailSize = 64 << 10
+
+// Event is one line of the audit log.
+type Event struct {
+	Time   time.Time         `json:"time"`
+	Type   string            `json:"type"`
+	IP     string            `json:"ip,omitempty"`
+	Tunnel string            `json:"tunnel,omitempty"`
+	Detail map[string]string `json:"detail,omitempty"`
+
+	// With chaining, Prev is the hash of the event before and Hash covers
+	// this event including Prev, so removing or editing a line breaks the
+	// chain from there on.
+	Prev string `json:"prev,omitempty"`
+	Hash string `json:"hash,omitempty"`
+}
+
+// Log appends events to a file as JSON lines. A nil *Log discards events,
+// so callers need not check whether auditing is enabled.
+type Log struct {
+	mu     sync.Mutex
+	file   *os.File
+	chain  bool
+	last   string
+	logger *zap.Logger
+}
+
+// Open appends to the audit log at path, creating it if needed. With
+// chain, every event carries a hash linking it to the one before,
+// continuing an existing chain in the file.
+func Open(path string, chain bool, logger *zap.Logger) (*Log, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	l := &Log{file: f, chain: chain, logger: logger}
+	if chain {
+		if l.last, err = lastHash(f); err != nil {
+			_ = f.Close()
+			return nil, fmt.Errorf("failed to read audit log %s: %w", path, err)
+		}
+	}
+	return l, nil
+}
+
+// Record appends e, stamping the current time if e.Time is zero. Write
+// failures are reported to the operational log; they never fail the
+// action being audited.
+func (l *Log) Record(e Event) {
+	if l == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	e.Time = e.Time.UTC()
+	e.Hash = ""
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.chain {
+		e.Prev = l.last
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		l.logger.Error("Failed to encode audit event", zap.String("type", e.Type), zap.Error(err))
+		return
+	}
+	if l.chain {
+		hash := chainHash(e.Prev, line)
+		line = appendHash(line, hash)
+		l.last = hash
+	}
+
+	if _, err := l.file.Write(append(line, '\n')); err != nil {
+		l.logger.Error("Failed to write audit event", zap.String("type", e.Type), zap.Error(err))
+	}
+}
+
+// Close closes the underlying file.
+func (l *Log) Close() error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.file.Close()
+}
+
+// Verify checks the hash chain of an audit log and returns the number of
+// events read. It fails at the first event that was edited, removed or
+// inserted, or that carries no hash.
+func Verify(r io.Reader) (int, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64<<10), tailSize)
+
+	var prev string
+	n := 0
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		n++
+
+		var e Event
+		if err := json.Unmarshal(line, &e); err != nil {
+			return n, fmt.Errorf("event %d: %w", n, err)
+		}
+		if e.Hash == "" {
+			return n, fmt.Errorf("event %d: no hash, the log was written without chaining", n)
+		}
+		if e.Prev != prev {
+			return n, fmt.Errorf("event %d: chain broken, an earlier event was removed or changed", n)
+		}
+		body, ok := bytes.CutSuffix(line, hashSuffix(e.Hash))
+		if !ok || chainHash(e.Prev, append(body[:len(body):len(body)], '}')) != e.Hash {
+			return n, fmt.Errorf("event %d: hash mismatch, the event was changed", n)
+		}
+		prev = e.Hash
+	}
+	return n, scanner.Err()
+}
+
+// chainHash hashes an encoded event together with the hash before it.
+func chainHash(prev string, line []byte) string {
+	h := sha256.New()
+	h.Write([]byte(prev))
+	h.Write(line)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// appendHash adds the hash field to an encoded event object.
+func appendHash(line []byte, hash string) []byte {
+	return append(line[:len(line)-1], hashSuffix(hash)...)
+}
+
+func hashSuffix(hash string) []byte {
+	return []byte(`,"hash":"` + hash + `"}`)
+}
+
+// lastHash returns the hash of the last event in f, or "" if f is empty.
+func lastHash(f *os.File) (string, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	offset := max(info.Size()-tailSize, 0)
+	buf := make([]byte, info.Size()-offset)
+	if _, err := f.ReadAt(buf, offset); err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+
+	buf = bytes.TrimRight(buf, "\n")
+	if len(buf) == 0 {
+		return "", nil
+	}
+	if i := bytes.LastIndexByte(buf, '\n'); i >= 0 {
+		buf = buf[i+1:]
+	}
+	var e Event
+	if err := json.Unmarshal(buf, &e); err != nil {
+		return "", fmt.Errorf("last event: %w", err)
+	}
+	if e.Hash == "" {
+		return "", errors.New("existing events have no hash; start a new file to enable chaining")
+	}
+	return e.Hash, nil
+}
@@ -0,0 +1,68 @@
+package audit
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestChainedLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+
+	l, err := Open(path, true, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Record(Event{Type: TypeRegister, IP: "203.0.113.7", Tunnel: "demo"})
+	l.Record(Event{Type: TypeAuthFailure, IP: "203.0.113.8", Detail: map[string]string{"via": "tunnel"}})
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Reopening continues the chain.
+	l, err = Open(path, true, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Record(Event{Type: TypeBan, IP: "203.0.113.8"})
+	_ = l.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := Verify(bytes.NewReader(data)); err != nil || n != 3 {
+		t.Fatalf("Verify = %d, %v; want 3 events, no error", n, err)
+	}
+
+	tampered := strings.Replace(string(data), "203.0.113.7", "203.0.113.9", 1)
+	if _, err := Verify(strings.NewReader(tampered)); err == nil {
+		t.Error("Verify accepted an edited event")
+	}
+
+	lines := strings.SplitAfter(string(data), "\n")
+	removed := lines[0] + lines[2]
+	if _, err := Verify(strings.NewReader(removed)); err == nil {
+		t.Error("Verify accepted a log with an event removed")
+	}
+}
+
+func TestPlainLogCannotChain(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+
+	l, err := Open(path, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Record(Event{Type: TypeAdmin})
+	_ = l.Close()
+
+	if _, err := Open(path, true, nil); err == nil {
+		t.Error("chaining onto a log without hashes should fail")
+	}
+
+	var nilLog *Log
+	nilLog.Record(Event{Type: TypeAdmin})
+}
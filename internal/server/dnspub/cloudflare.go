@@ -0,0 +1,205 @@
+package dnspub
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const cloudflareAPI = "https://api.cloudflare.com/client/v4"
+
+// cloudflareZoneID matches a zone ID, as opposed to a zone name.
+var cloudflareZoneID = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// Cloudflare keeps records through the Cloudflare API, with a token
+// allowed to edit the zone's DNS. Records are not proxied by Cloudflare,
+// as tunnels carry more than HTTP.
+type Cloudflare struct {
+	token  string
+	zoneID string
+	api    string
+	client *http.Client
+}
+
+// NewCloudflare returns a Cloudflare provider for zone, a zone ID or name.
+// Without one the zone is the closest parent of domain the token can see.
+func NewCloudflare(ctx context.Context, token, zone, domain string) (*Cloudflare, error) {
+	if token == "" {
+		return nil, errors.New("cloudflare needs an API token")
+	}
+	c := &Cloudflare{
+		token:  token,
+		api:    cloudflareAPI,
+		client: &http.Client{Timeout: opTimeout},
+	}
+	if cloudflareZoneID.MatchString(zone) {
+		c.zoneID = zone
+		return c, nil
+	}
+
+	candidates := parentDomains(domain)
+	if zone != "" {
+		candidates = []string{strings.TrimSuffix(zone, ".")}
+	}
+	for _, name := range candidates {
+		var zones []struct {
+			ID string `json:"id"`
+		}
+		if err := c.call(ctx, http.MethodGet, "/zones?name="+url.QueryEscape(name), nil, &zones); err != nil {
+			return nil, err
+		}
+		if len(zones) > 0 {
+			c.zoneID = zones[0].ID
+			return c, nil
+		}
+	}
+	return nil, fmt.Errorf("no Cloudflare zone found for %s", domain)
+}
+
+type cloudflareRecord struct {
+	ID      string `json:"id,omitempty"`
+	Type    string `json:"type"`
+	Name    string `json:"name"`
+	Content string `json:"content"`
+	TTL     int    `json:"ttl"`
+	Proxied bool   `json:"proxied"`
+}
+
+// Set implements Provider.
+func (c *Cloudflare) Set(ctx context.Context, name string, records []Record) error {
+	existing, err := c.list(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	want := make(map[string]Record, len(records))
+	for _, r := range records {
+		want[r.Type+" "+r.Value] = r
+	}
+	for _, rec := range existing {
+		key := rec.Type + " " + rec.Content
+		if r, ok := want[key]; ok && rec.TTL == cloudflareTTL(r.TTL) && !rec.Proxied {
+			delete(want, key)
+			continue
+		}
+		if err := c.call(ctx, http.MethodDelete, "/zones/"+c.zoneID+"/dns_records/"+rec.ID, nil, nil); err != nil {
+			return err
+		}
+	}
+	for _, r := range records {
+		if _, ok := want[r.Type+" "+r.Value]; !ok {
+			continue
+		}
+		rec := cloudflareRecord{Type: r.Type, Name: name, Content: r.Value, TTL: cloudflareTTL(r.TTL)}
+		if err := c.call(ctx, http.MethodPost, "/zones/"+c.zoneID+"/dns_records", rec, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete implements Provider.
+func (c *Cloudflare) Delete(ctx context.Context, name string, _ []Record) error {
+	existing, err := c.list(ctx, name)
+	if err != nil {
+		return err
+	}
+	for _, rec := range existing {
+		if err := c.call(ctx, http.MethodDelete, "/zones/"+c.zoneID+"/dns_records/"+rec.ID, nil, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// list returns the A, AAAA and CNAME records of name.
+func (c *Cloudflare) list(ctx context.Context, name string) ([]cloudflareRecord, error) {
+	var all []cloudflareRecord
+	if err := c.call(ctx, http.MethodGet, "/zones/"+c.zoneID+"/dns_records?per_page=100&name="+url.QueryEscape(name), nil, &all); err != nil {
+		return nil, err
+	}
+	records := all[:0]
+	for _, rec := range all {
+		switch rec.Type {
+		case "A", "AAAA", "CNAME":
+			records = append(records, rec)
+		}
+	}
+	return records, nil
+}
+
+// call sends one API request and decodes the result field of the
+// response into result, if not nil.
+func (c *Cloudflare) call(ctx context.Context, method, path string, body, result any) error {
+	var r io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.api+path, r)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("cloudflare: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var envelope struct {
+		Success bool                       `json:"success"`
+		Errors  []struct{ Message string } `json:"errors"`
+		Result  json.RawMessage            `json:"result"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 4<<20)).Decode(&envelope); err != nil {
+		return fmt.Errorf("cloudflare: %s: %s", method, resp.Status)
+	}
+	if !envelope.Success {
+		msgs := make([]string, 0, len(envelope.Errors))
+		for _, e := range envelope.Errors {
+			msgs = append(msgs, e.Message)
+		}
+		return fmt.Errorf("cloudflare: %s: %s", resp.Status, strings.Join(msgs, "; "))
+	}
+	if result != nil {
+		return json.Unmarshal(envelope.Result, result)
+	}
+	return nil
+}
+
+// cloudflareTTL converts ttl to Cloudflare's seconds, where 1 means
+// automatic and anything else must be at least 60.
+func cloudflareTTL(ttl time.Duration) int {
+	secs := int(ttl / time.Second)
+	if secs <= 0 {
+		return 1
+	}
+	return max(secs, 60)
+}
+
+// parentDomains returns domain and each of its parents with at least two
+// labels, closest first.
+func parentDomains(domain string) []string {
+	labels := strings.Split(strings.TrimSuffix(domain, "."), ".")
+	var names []string
+	for i := 0; i+2 <= len(labels); i++ {
+		names = append(names, strings.Join(labels[i:], "."))
+	}
+	return names
+}
@@ -0,0 +1,306 @@
+// Package dnspub publishes a DNS record for each tunnel hostname while the
+// tunnel is registered, for tunnel domains whose zone has no wildcard
+// record. Records are kept in Cloudflare, Route 53 or any server accepting
+// RFC 2136 dynamic updates.
+package dnspub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"drip/internal/server/metrics"
+	"go.uber.org/zap"
+)
+
+const (
+	// withdrawDelay keeps the record of a tunnel that went away for a
+	// while, so one that reconnects does not flap in DNS caches.
+	withdrawDelay = 30 * time.Second
+
+	// opTimeout bounds each call to the provider.
+	opTimeout = 30 * time.Second
+
+	// maxAttempts is how many times a change is tried before giving up.
+	maxAttempts = 3
+
+	// queueSize bounds the changes waiting for the provider.
+	queueSize = 1024
+)
+
+// Providers lists the supported providers.
+var Providers = []string{"cloudflare", "route53", "rfc2136"}
+
+// Record is one DNS record of a tunnel hostname.
+type Record struct {
+	Type  string // A, AAAA or CNAME
+	Value string
+	TTL   time.Duration
+}
+
+// Provider changes the records of names in a DNS zone.
+type Provider interface {
+	// Set makes records the only A, AAAA and CNAME records of name,
+	// leaving its other records alone.
+	Set(ctx context.Context, name string, records []Record) error
+	// Delete removes the A, AAAA and CNAME records of name.
+	Delete(ctx context.Context, name string, records []Record) error
+}
+
+// ParseTarget returns the records tunnel hostnames point at: A and AAAA
+// records for a comma-separated list of IPs, or a CNAME record for a
+// hostname.
+func ParseTarget(target string, ttl time.Duration) ([]Record, error) {
+	var records []Record
+	for _, part := range strings.Split(target, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		ip := net.ParseIP(part)
+		switch {
+		case ip == nil:
+			records = append(records, Record{Type: "CNAME", Value: strings.TrimSuffix(part, "."), TTL: ttl})
+		case ip.To4() != nil:
+			records = append(records, Record{Type: "A", Value: ip.String(), TTL: ttl})
+		default:
+			records = append(records, Record{Type: "AAAA", Value: ip.String(), TTL: ttl})
+		}
+	}
+	if len(records) == 0 {
+		return nil, errors.New("DNS target is empty")
+	}
+	for _, r := range records {
+		if r.Type == "CNAME" && len(records) > 1 {
+			return nil, fmt.Errorf("DNS target %q mixes a hostname with other targets", target)
+		}
+	}
+	return records, nil
+}
+
+// Options selects and configures a provider.
+type Options struct {
+	Provider string // one of Providers
+	Zone     string // zone ID or name; found from the tunnel domain if empty
+	Server   string // name server, for rfc2136
+	Token    string // Cloudflare API token, or rfc2136 TSIG key
+}
+
+// NewProvider returns the provider opts selects for records under domain.
+func NewProvider(ctx context.Context, opts Options, domain string) (Provider, error) {
+	switch opts.Provider {
+	case "cloudflare":
+		return NewCloudflare(ctx, opts.Token, opts.Zone, domain)
+	case "route53":
+		return NewRoute53(ctx, opts.Zone, domain)
+	case "rfc2136":
+		zone := opts.Zone
+		if zone == "" {
+			zone = domain
+		}
+		return NewRFC2136(opts.Server, zone, opts.Token)
+	}
+	return nil, fmt.Errorf("unknown DNS provider %q (use %s)", opts.Provider, strings.Join(Providers, ", "))
+}
+
+type op struct {
+	name    string
+	publish bool
+}
+
+// Publisher keeps a record for every registered tunnel. A nil Publisher
+// does nothing.
+type Publisher struct {
+	provider Provider
+	domain   string
+	records  []Record
+	logger   *zap.Logger
+	delay    time.Duration // before withdrawing a record
+
+	mu        sync.Mutex
+	published map[string]bool
+	pending   map[string]*time.Timer // withdrawals waiting out withdrawDelay
+	closed    bool
+
+	queue chan op
+	done  chan struct{}
+}
+
+// New returns a Publisher pointing <subdomain>.<domain> at records through
+// provider.
+func New(provider Provider, domain string, records []Record, logger *zap.Logger) *Publisher {
+	p := &Publisher{
+		provider:  provider,
+		domain:    strings.TrimSuffix(domain, "."),
+		records:   records,
+		logger:    logger,
+		delay:     withdrawDelay,
+		published: make(map[string]bool),
+		pending:   make(map[string]*time.Timer),
+		queue:     make(chan op, queueSize),
+		done:      make(chan struct{}),
+	}
+	go p.run()
+	return p
+}
+
+// Publish creates the record of the tunnel on subdomain, or keeps it if
+// it was about to be withdrawn.
+func (p *Publisher) Publish(subdomain string) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if t, ok := p.pending[subdomain]; ok {
+		t.Stop()
+		delete(p.pending, subdomain)
+	}
+	if p.closed || p.published[subdomain] {
+		return
+	}
+	p.published[subdomain] = true
+	p.enqueue(op{name: subdomain, publish: true})
+}
+
+// Withdraw removes the record of the tunnel on subdomain after a delay,
+// unless it is published again meanwhile.
+func (p *Publisher) Withdraw(subdomain string) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed || !p.published[subdomain] || p.pending[subdomain] != nil {
+		return
+	}
+	var t *time.Timer
+	t = time.AfterFunc(p.delay, func() {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if p.closed || p.pending[subdomain] != t {
+			return
+		}
+		delete(p.pending, subdomain)
+		delete(p.published, subdomain)
+		p.enqueue(op{name: subdomain})
+	})
+	p.pending[subdomain] = t
+}
+
+// enqueue hands o to the worker. p.mu must be held.
+func (p *Publisher) enqueue(o op) {
+	select {
+	case p.queue <- o:
+	default:
+		metrics.DNSUpdates.WithLabelValues(o.label(), "dropped").Inc()
+		p.logger.Warn("DNS update queue full, dropping change",
+			zap.String("hostname", p.hostname(o.name)),
+			zap.String("op", o.label()),
+		)
+	}
+}
+
+// Close stops publishing and removes every record still published, which
+// the server does on shutdown as its tunnels go away with it.
+func (p *Publisher) Close(ctx context.Context) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return
+	}
+	p.closed = true
+	for _, t := range p.pending {
+		t.Stop()
+	}
+	p.pending = nil
+	close(p.queue)
+	p.mu.Unlock()
+
+	select {
+	case <-p.done:
+	case <-ctx.Done():
+		return
+	}
+
+	p.mu.Lock()
+	names := make([]string, 0, len(p.published))
+	for name := range p.published {
+		names = append(names, name)
+	}
+	p.mu.Unlock()
+	for _, name := range names {
+		if ctx.Err() != nil {
+			return
+		}
+		p.apply(ctx, op{name: name})
+	}
+}
+
+func (p *Publisher) run() {
+	defer close(p.done)
+	for o := range p.queue {
+		p.apply(context.Background(), o)
+	}
+}
+
+// apply makes one change, trying again a few times if the provider fails.
+func (p *Publisher) apply(ctx context.Context, o op) {
+	hostname := p.hostname(o.name)
+	var err error
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		opCtx, cancel := context.WithTimeout(ctx, opTimeout)
+		if o.publish {
+			err = p.provider.Set(opCtx, hostname, p.records)
+		} else {
+			err = p.provider.Delete(opCtx, hostname, p.records)
+		}
+		cancel()
+		if err == nil || attempt == maxAttempts {
+			break
+		}
+		select {
+		case <-time.After(time.Duration(attempt) * 2 * time.Second):
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	if err != nil {
+		metrics.DNSUpdates.WithLabelValues(o.label(), "error").Inc()
+		p.logger.Warn("Failed to update tunnel DNS record",
+			zap.String("hostname", hostname),
+			zap.String("op", o.label()),
+			zap.Error(err),
+		)
+		return
+	}
+	metrics.DNSUpdates.WithLabelValues(o.label(), "ok").Inc()
+	p.logger.Debug("Updated tunnel DNS record",
+		zap.String("hostname", hostname),
+		zap.String("op", o.label()),
+	)
+}
+
+func (p *Publisher) hostname(subdomain string) string {
+	return subdomain + "." + p.domain
+}
+
+func (o op) label() string {
+	if o.publish {
+		return "publish"
+	}
+	return "withdraw"
+}
@@ -0,0 +1,163 @@
+package dnspub
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"go.uber.org/zap"
+)
+
+// fakeProvider records the names it holds records for.
+type fakeProvider struct {
+	mu    sync.Mutex
+	names map[string]bool
+	calls int
+}
+
+func (f *fakeProvider) Set(_ context.Context, name string, _ []Record) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.names[name] = true
+	f.calls++
+	return nil
+}
+
+func (f *fakeProvider) Delete(_ context.Context, name string, _ []Record) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.names, name)
+	f.calls++
+	return nil
+}
+
+func (f *fakeProvider) has(name string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.names[name]
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		if cond() {
+			return
+		}
+	}
+	t.Fatalf("timed out waiting for %s", what)
+}
+
+func TestPublisher(t *testing.T) {
+	provider := &fakeProvider{names: make(map[string]bool)}
+	p := New(provider, "tunnels.example.com", []Record{{Type: "CNAME", Value: "example.com"}}, zap.NewNop())
+	p.delay = 50 * time.Millisecond
+
+	p.Publish("myapp")
+	waitFor(t, "record published", func() bool { return provider.has("myapp.tunnels.example.com") })
+
+	// A tunnel that comes back before the delay keeps its record.
+	p.Withdraw("myapp")
+	p.Publish("myapp")
+	time.Sleep(100 * time.Millisecond)
+	if !provider.has("myapp.tunnels.example.com") {
+		t.Error("record withdrawn although the tunnel came back")
+	}
+	provider.mu.Lock()
+	if provider.calls != 1 {
+		t.Errorf("provider called %d times, want 1", provider.calls)
+	}
+	provider.mu.Unlock()
+
+	p.Withdraw("myapp")
+	waitFor(t, "record withdrawn", func() bool { return !provider.has("myapp.tunnels.example.com") })
+
+	p.Publish("other")
+	waitFor(t, "record published", func() bool { return provider.has("other.tunnels.example.com") })
+	p.Close(context.Background())
+	if provider.has("other.tunnels.example.com") {
+		t.Error("record left behind on Close")
+	}
+}
+
+func TestParseTarget(t *testing.T) {
+	tests := []struct {
+		target string
+		want   []string
+	}{
+		{"203.0.113.7", []string{"A 203.0.113.7"}},
+		{"203.0.113.7, 2001:db8::7", []string{"A 203.0.113.7", "AAAA 2001:db8::7"}},
+		{"edge.example.com.", []string{"CNAME edge.example.com"}},
+		{"edge.example.com,203.0.113.7", nil},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		records, err := ParseTarget(tt.target, time.Minute)
+		if tt.want == nil {
+			if err == nil {
+				t.Errorf("ParseTarget(%q) accepted", tt.target)
+			}
+			continue
+		}
+		if err != nil || len(records) != len(tt.want) {
+			t.Errorf("ParseTarget(%q) = %v, %v", tt.target, records, err)
+			continue
+		}
+		for i, r := range records {
+			if got := r.Type + " " + r.Value; got != tt.want[i] {
+				t.Errorf("ParseTarget(%q)[%d] = %s, want %s", tt.target, i, got, tt.want[i])
+			}
+		}
+	}
+}
+
+func TestRFC2136(t *testing.T) {
+	const keyName, secret = "drip.", "c2VjcmV0LXNlY3JldC1zZWNyZXQtc2VjcmV0"
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	updates := make(chan *dns.Msg, 2)
+	server := &dns.Server{
+		Listener:      ln,
+		TsigSecret:    map[string]string{keyName: secret},
+		MsgAcceptFunc: func(dns.Header) dns.MsgAcceptAction { return dns.MsgAccept },
+		Handler: dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+			resp := new(dns.Msg)
+			resp.SetReply(req)
+			if req.IsTsig() == nil || w.TsigStatus() != nil {
+				resp.Rcode = dns.RcodeNotAuth
+			} else {
+				updates <- req
+				resp.SetTsig(keyName, dns.HmacSHA256, 300, time.Now().Unix())
+			}
+			_ = w.WriteMsg(resp)
+		}),
+	}
+	go server.ActivateAndServe()
+	defer server.Shutdown()
+
+	r, err := NewRFC2136(ln.Addr().String(), "example.com", "hmac-sha256:drip:"+secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records := []Record{{Type: "A", Value: "203.0.113.7", TTL: time.Minute}}
+	if err := r.Set(context.Background(), "myapp.example.com", records); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	update := <-updates
+	if len(update.Ns) != 4 {
+		t.Fatalf("update has %d records, want 3 removals and 1 insert: %v", len(update.Ns), update.Ns)
+	}
+	if a, ok := update.Ns[3].(*dns.A); !ok || a.A.String() != "203.0.113.7" || a.Hdr.Name != "myapp.example.com." {
+		t.Errorf("inserted %v, want the A record of myapp.example.com.", update.Ns[3])
+	}
+
+	bad, _ := NewRFC2136(ln.Addr().String(), "example.com", "drip:d3Jvbmc=")
+	if err := bad.Delete(context.Background(), "myapp.example.com", records); err == nil {
+		t.Error("update signed with the wrong key succeeded")
+	}
+}
@@ -0,0 +1,123 @@
+package dnspub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// tsigAlgorithms maps the algorithm names nsupdate accepts to TSIG's.
+var tsigAlgorithms = map[string]string{
+	"hmac-sha1":   dns.HmacSHA1,
+	"hmac-sha224": dns.HmacSHA224,
+	"hmac-sha256": dns.HmacSHA256,
+	"hmac-sha384": dns.HmacSHA384,
+	"hmac-sha512": dns.HmacSHA512,
+}
+
+// RFC2136 keeps records with dynamic updates sent to a name server such
+// as BIND, Knot or PowerDNS, signed with a TSIG key.
+type RFC2136 struct {
+	server  string
+	zone    string
+	keyName string
+	keyAlg  string
+	client  *dns.Client
+}
+
+// NewRFC2136 returns an RFC2136 provider updating zone on server. key is
+// a TSIG key written as nsupdate -y takes it, [algorithm:]name:secret
+// with HMAC-SHA256 by default, or empty for unsigned updates.
+func NewRFC2136(server, zone, key string) (*RFC2136, error) {
+	if server == "" {
+		return nil, errors.New("rfc2136 needs a name server address")
+	}
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "53")
+	}
+	if zone == "" {
+		return nil, errors.New("rfc2136 needs a zone")
+	}
+	r := &RFC2136{
+		server: server,
+		zone:   dns.Fqdn(strings.ToLower(zone)),
+		client: &dns.Client{Net: "tcp", Timeout: opTimeout},
+	}
+
+	if key != "" {
+		parts := strings.Split(key, ":")
+		alg := "hmac-sha256"
+		switch len(parts) {
+		case 2:
+		case 3:
+			alg, parts = strings.ToLower(parts[0]), parts[1:]
+		default:
+			return nil, errors.New("invalid TSIG key: use [algorithm:]name:secret")
+		}
+		if r.keyAlg = tsigAlgorithms[alg]; r.keyAlg == "" {
+			return nil, fmt.Errorf("unsupported TSIG algorithm %q", alg)
+		}
+		r.keyName = dns.Fqdn(strings.ToLower(parts[0]))
+		r.client.TsigSecret = map[string]string{r.keyName: parts[1]}
+	}
+	return r, nil
+}
+
+// Set implements Provider.
+func (r *RFC2136) Set(ctx context.Context, name string, records []Record) error {
+	rrs := make([]dns.RR, 0, len(records))
+	for _, rec := range records {
+		value := rec.Value
+		if rec.Type == "CNAME" {
+			value = dns.Fqdn(value)
+		}
+		rr, err := dns.NewRR(fmt.Sprintf("%s %d IN %s %s", dns.Fqdn(name), int(rec.TTL.Seconds()), rec.Type, value))
+		if err != nil {
+			return err
+		}
+		rrs = append(rrs, rr)
+	}
+
+	m := new(dns.Msg)
+	m.SetUpdate(r.zone)
+	m.RemoveRRset(addressSets(name))
+	m.Insert(rrs)
+	return r.exchange(ctx, m)
+}
+
+// Delete implements Provider.
+func (r *RFC2136) Delete(ctx context.Context, name string, _ []Record) error {
+	m := new(dns.Msg)
+	m.SetUpdate(r.zone)
+	m.RemoveRRset(addressSets(name))
+	return r.exchange(ctx, m)
+}
+
+func (r *RFC2136) exchange(ctx context.Context, m *dns.Msg) error {
+	if r.keyName != "" {
+		m.SetTsig(r.keyName, r.keyAlg, 300, time.Now().Unix())
+	}
+	resp, _, err := r.client.ExchangeContext(ctx, m, r.server)
+	if err != nil {
+		return fmt.Errorf("rfc2136: %w", err)
+	}
+	if resp.Rcode != dns.RcodeSuccess {
+		return fmt.Errorf("rfc2136: server answered %s", dns.RcodeToString[resp.Rcode])
+	}
+	return nil
+}
+
+// addressSets names the A, AAAA and CNAME record sets of name, for
+// removing them.
+func addressSets(name string) []dns.RR {
+	var rrs []dns.RR
+	for _, t := range []uint16{dns.TypeA, dns.TypeAAAA, dns.TypeCNAME} {
+		rrs = append(rrs, &dns.ANY{Hdr: dns.RR_Header{Name: dns.Fqdn(name), Rrtype: t, Class: dns.ClassINET}})
+	}
+	return rrs
+}
@@ -0,0 +1,140 @@
+package dnspub
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	"github.com/aws/aws-sdk-go-v2/service/route53/types"
+)
+
+// Route53 keeps records in an Amazon Route 53 hosted zone. Credentials
+// come from the usual AWS sources: the environment, the shared config
+// files or the instance role.
+type Route53 struct {
+	client *route53.Client
+	zoneID string
+}
+
+// NewRoute53 returns a Route53 provider for zone, a hosted zone ID or
+// name. Without one the zone is the closest parent of domain.
+func NewRoute53(ctx context.Context, zone, domain string) (*Route53, error) {
+	cfg, err := awsconfig.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("route53: %w", err)
+	}
+	r := &Route53{client: route53.NewFromConfig(cfg)}
+
+	zone = strings.TrimPrefix(zone, "/hostedzone/")
+	if strings.HasPrefix(zone, "Z") && !strings.Contains(zone, ".") {
+		r.zoneID = zone
+		return r, nil
+	}
+
+	candidates := parentDomains(domain)
+	if zone != "" {
+		candidates = []string{strings.TrimSuffix(zone, ".")}
+	}
+	for _, name := range candidates {
+		out, err := r.client.ListHostedZonesByName(ctx, &route53.ListHostedZonesByNameInput{
+			DNSName:  aws.String(name),
+			MaxItems: aws.Int32(1),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("route53: %w", err)
+		}
+		if len(out.HostedZones) > 0 && aws.ToString(out.HostedZones[0].Name) == name+"." {
+			r.zoneID = strings.TrimPrefix(aws.ToString(out.HostedZones[0].Id), "/hostedzone/")
+			return r, nil
+		}
+	}
+	return nil, fmt.Errorf("no Route 53 hosted zone found for %s", domain)
+}
+
+// Set implements Provider.
+func (r *Route53) Set(ctx context.Context, name string, records []Record) error {
+	existing, err := r.list(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	sets := make(map[string]*types.ResourceRecordSet)
+	var order []string
+	for _, rec := range records {
+		set := sets[rec.Type]
+		if set == nil {
+			set = &types.ResourceRecordSet{
+				Name: aws.String(name),
+				Type: types.RRType(rec.Type),
+				TTL:  aws.Int64(int64(rec.TTL.Seconds())),
+			}
+			sets[rec.Type] = set
+			order = append(order, rec.Type)
+		}
+		set.ResourceRecords = append(set.ResourceRecords, types.ResourceRecord{Value: aws.String(rec.Value)})
+	}
+
+	var changes []types.Change
+	for i := range existing {
+		if sets[string(existing[i].Type)] == nil {
+			changes = append(changes, types.Change{Action: types.ChangeActionDelete, ResourceRecordSet: &existing[i]})
+		}
+	}
+	for _, typ := range order {
+		changes = append(changes, types.Change{Action: types.ChangeActionUpsert, ResourceRecordSet: sets[typ]})
+	}
+	return r.change(ctx, changes)
+}
+
+// Delete implements Provider.
+func (r *Route53) Delete(ctx context.Context, name string, _ []Record) error {
+	existing, err := r.list(ctx, name)
+	if err != nil {
+		return err
+	}
+	changes := make([]types.Change, len(existing))
+	for i := range existing {
+		changes[i] = types.Change{Action: types.ChangeActionDelete, ResourceRecordSet: &existing[i]}
+	}
+	return r.change(ctx, changes)
+}
+
+// list returns the A, AAAA and CNAME record sets of name.
+func (r *Route53) list(ctx context.Context, name string) ([]types.ResourceRecordSet, error) {
+	out, err := r.client.ListResourceRecordSets(ctx, &route53.ListResourceRecordSetsInput{
+		HostedZoneId:    aws.String(r.zoneID),
+		StartRecordName: aws.String(name),
+		MaxItems:        aws.Int32(10),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("route53: %w", err)
+	}
+	var sets []types.ResourceRecordSet
+	for _, set := range out.ResourceRecordSets {
+		if aws.ToString(set.Name) != name+"." {
+			continue
+		}
+		switch set.Type {
+		case types.RRTypeA, types.RRTypeAaaa, types.RRTypeCname:
+			sets = append(sets, set)
+		}
+	}
+	return sets, nil
+}
+
+func (r *Route53) change(ctx context.Context, changes []types.Change) error {
+	if len(changes) == 0 {
+		return nil
+	}
+	_, err := r.client.ChangeResourceRecordSets(ctx, &route53.ChangeResourceRecordSetsInput{
+		HostedZoneId: aws.String(r.zoneID),
+		ChangeBatch:  &types.ChangeBatch{Changes: changes, Comment: aws.String("drip tunnel")},
+	})
+	if err != nil {
+		return fmt.Errorf("route53: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,302 @@
+// Package federation lets servers that share a token serve each other's
+// HTTP tunnels. A server without a tunnel for a subdomain asks its peers
+// whether they have one and proxies the visitor to the peer that does, so
+// clients can connect to their nearest server while visitors use any
+// server's domain.
+package federation
+
+import (
+	"container/list"
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"drip/internal/server/metrics"
+	"drip/internal/shared/netutil"
+)
+
+// Headers exchanged between federated servers. They are stripped from
+// visitor requests so they cannot be forged from outside.
+const (
+	TokenHeader     = "X-Drip-Federation-Token"
+	SubdomainHeader = "X-Drip-Federation-Subdomain"
+	VisitorHeader   = "X-Drip-Federation-Visitor"
+
+	// MissHeader marks a federated request the peer no longer has a tunnel
+	// for, so the sender drops its cached route.
+	MissHeader = "X-Drip-Federation-Miss"
+)
+
+// LookupPath answers whether a server has a tunnel for ?subdomain=.
+const LookupPath = "/_drip/federation/lookup"
+
+const (
+	// DefaultCacheTTL is how long a peer stays the known home of a subdomain.
+	DefaultCacheTTL = 30 * time.Second
+	// missTTL is how long a subdomain no peer has is remembered, so
+	// scanners cannot make every request fan out to all peers.
+	missTTL = 5 * time.Second
+	// maxRoutes bounds the route cache; visitors pick the subdomains, so
+	// the least recently used routes make room for new ones.
+	maxRoutes = 10000
+
+	lookupTimeout = 3 * time.Second
+)
+
+// Config configures a Router.
+type Config struct {
+	Peers    []string // base URLs of the other servers, e.g. https://eu.example.com
+	Token    string   // shared by every server in the federation
+	Insecure bool     // skip TLS verification of peers (testing only)
+	CacheTTL time.Duration
+}
+
+type peer struct {
+	name  string
+	base  *url.URL
+	proxy *httputil.ReverseProxy
+}
+
+type route struct {
+	subdomain string
+	peer      *peer // nil when no peer has the subdomain
+	expires   time.Time
+}
+
+// Router finds the peer serving a subdomain and proxies visitors to it.
+type Router struct {
+	token    string
+	peers    []*peer
+	client   *http.Client
+	cacheTTL time.Duration
+	logger   *zap.Logger
+
+	mu        sync.Mutex
+	routes    map[string]*list.Element // of *route
+	lru       *list.List               // most recently used first
+	nextPrune time.Time
+}
+
+// NewRouter validates cfg and returns a router for its peers.
+func NewRouter(cfg Config, logger *zap.Logger) (*Router, error) {
+	if cfg.Token == "" {
+		return nil, fmt.Errorf("federation needs a shared token")
+	}
+	if cfg.CacheTTL <= 0 {
+		cfg.CacheTTL = DefaultCacheTTL
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: cfg.Insecure,
+	}
+
+	r := &Router{
+		token:    cfg.Token,
+		client:   &http.Client{Transport: transport, Timeout: lookupTimeout},
+		cacheTTL: cfg.CacheTTL,
+		logger:   logger,
+		routes:   make(map[string]*list.Element),
+		lru:      list.New(),
+	}
+	for _, raw := range cfg.Peers {
+		base, err := url.Parse(strings.TrimSuffix(raw, "/"))
+		if err != nil || base.Scheme != "https" || base.Host == "" {
+			return nil, fmt.Errorf("federation peer must be an https:// URL: %q", raw)
+		}
+		p := &peer{name: base.Host, base: base}
+		p.proxy = &httputil.ReverseProxy{
+			Transport: transport,
+			Rewrite: func(pr *httputil.ProxyRequest) {
+				pr.SetURL(p.base)
+				pr.SetXForwarded()
+				// The peer routes by SubdomainHeader; the original Host
+				// keeps redirects and cookies on this server's domain.
+				pr.Out.Host = pr.In.Host
+			},
+			ModifyResponse: func(resp *http.Response) error {
+				if resp.Header.Get(MissHeader) != "" {
+					resp.Header.Del(MissHeader)
+					r.forget(resp.Request.Header.Get(SubdomainHeader))
+				}
+				return nil
+			},
+			ErrorHandler: func(w http.ResponseWriter, req *http.Request, err error) {
+				r.logger.Debug("Federated request failed", zap.String("peer", p.name), zap.Error(err))
+				r.forget(req.Header.Get(SubdomainHeader))
+				http.Error(w, "Tunnel unavailable", http.StatusBadGateway)
+			},
+		}
+		r.peers = append(r.peers, p)
+	}
+	return r, nil
+}
+
+// Authorized reports whether req carries the federation token.
+func (r *Router) Authorized(req *http.Request) bool {
+	token := req.Header.Get(TokenHeader)
+	return token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(r.token)) == 1
+}
+
+// Accept prepares an authorized request from a peer for local routing: it
+// returns the subdomain the peer asked for, restores the visitor address
+// so IP rules apply to the visitor, and removes the federation headers.
+func (r *Router) Accept(req *http.Request) string {
+	subdomain := req.Header.Get(SubdomainHeader)
+	if ip := net.ParseIP(req.Header.Get(VisitorHeader)); ip != nil {
+		req.RemoteAddr = net.JoinHostPort(ip.String(), "0")
+	}
+	StripHeaders(req)
+	return subdomain
+}
+
+// StripHeaders removes federation headers from a visitor request.
+func StripHeaders(req *http.Request) {
+	req.Header.Del(TokenHeader)
+	req.Header.Del(SubdomainHeader)
+	req.Header.Del(VisitorHeader)
+}
+
+// Forward proxies req to the peer serving subdomain. It reports false,
+// without writing a response, when no peer has the subdomain.
+func (r *Router) Forward(w http.ResponseWriter, req *http.Request, subdomain string) bool {
+	p := r.lookup(req.Context(), subdomain)
+	if p == nil {
+		return false
+	}
+
+	metrics.FederatedRequests.WithLabelValues(p.name).Inc()
+	req.Header.Set(TokenHeader, r.token)
+	req.Header.Set(SubdomainHeader, subdomain)
+	req.Header.Set(VisitorHeader, netutil.ExtractClientIP(req))
+	p.proxy.ServeHTTP(w, req)
+	return true
+}
+
+// lookup returns the peer with a tunnel for subdomain, asking all peers
+// when the answer is not cached.
+func (r *Router) lookup(ctx context.Context, subdomain string) *peer {
+	if p, ok := r.cached(subdomain); ok {
+		return p
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, lookupTimeout)
+	defer cancel()
+
+	found := make(chan *peer, len(r.peers))
+	var wg sync.WaitGroup
+	for _, p := range r.peers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if r.has(ctx, p, subdomain) {
+				found <- p
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(found)
+	}()
+
+	p := <-found
+	ttl := r.cacheTTL
+	if p == nil {
+		ttl = missTTL
+	}
+	r.remember(subdomain, p, ttl)
+	return p
+}
+
+// cached returns the cached route of subdomain, dropping it if expired.
+func (r *Router) cached(subdomain string) (*peer, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	el, ok := r.routes[subdomain]
+	if !ok {
+		return nil, false
+	}
+	rt := el.Value.(*route)
+	if !time.Now().Before(rt.expires) {
+		r.removeLocked(el)
+		return nil, false
+	}
+	r.lru.MoveToFront(el)
+	return rt.peer, true
+}
+
+// remember caches the route of subdomain for ttl. Beyond maxRoutes the
+// least recently used routes are evicted, and every missTTL the expired
+// ones are pruned.
+func (r *Router) remember(subdomain string, p *peer, ttl time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	if now.After(r.nextPrune) {
+		r.nextPrune = now.Add(missTTL)
+		for el := r.lru.Front(); el != nil; {
+			next := el.Next()
+			if !now.Before(el.Value.(*route).expires) {
+				r.removeLocked(el)
+			}
+			el = next
+		}
+	}
+
+	rt := &route{subdomain: subdomain, peer: p, expires: now.Add(ttl)}
+	if el, ok := r.routes[subdomain]; ok {
+		el.Value = rt
+		r.lru.MoveToFront(el)
+	} else {
+		r.routes[subdomain] = r.lru.PushFront(rt)
+	}
+	for r.lru.Len() > maxRoutes {
+		r.removeLocked(r.lru.Back())
+	}
+}
+
+func (r *Router) removeLocked(el *list.Element) {
+	r.lru.Remove(el)
+	delete(r.routes, el.Value.(*route).subdomain)
+}
+
+func (r *Router) has(ctx context.Context, p *peer, subdomain string) bool {
+	u := *p.base
+	u.Path += LookupPath
+	u.RawQuery = url.Values{"subdomain": {subdomain}}.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return false
+	}
+	req.Header.Set(TokenHeader, r.token)
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		r.logger.Debug("Federation lookup failed", zap.String("peer", p.name), zap.Error(err))
+		return false
+	}
+	resp.Body.Close()
+	return resp.StatusCode == http.StatusOK
+}
+
+func (r *Router) forget(subdomain string) {
+	r.mu.Lock()
+	if el, ok := r.routes[subdomain]; ok {
+		r.removeLocked(el)
+	}
+	r.mu.Unlock()
+}
@@ -0,0 +1,118 @@
+package federation
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestRouterForward(t *testing.T) {
+	const token = "federation-secret"
+
+	var peerReq *http.Request
+	peer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(TokenHeader) != token {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		if r.URL.Path == LookupPath {
+			if r.URL.Query().Get("subdomain") != "app" {
+				http.NotFound(w, r)
+			}
+			return
+		}
+		peerReq = r
+		io.WriteString(w, r.Host)
+	}))
+	defer peer.Close()
+
+	router, err := NewRouter(Config{Peers: []string{peer.URL}, Token: token, Insecure: true}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewRouter() error = %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "https://app.edge.example.com/path", nil)
+	req.RemoteAddr = "203.0.113.9:41000"
+	rec := httptest.NewRecorder()
+	if !router.Forward(rec, req, "app") {
+		t.Fatalf("Forward(app) = false, want the peer to serve it")
+	}
+	if rec.Code != http.StatusOK || rec.Body.String() != "app.edge.example.com" {
+		t.Errorf("Forward(app) = %d %q, want 200 with the original Host", rec.Code, rec.Body.String())
+	}
+	if got := peerReq.Header.Get(SubdomainHeader); got != "app" {
+		t.Errorf("peer got %s = %q, want app", SubdomainHeader, got)
+	}
+	if got := peerReq.Header.Get(VisitorHeader); got != "203.0.113.9" {
+		t.Errorf("peer got %s = %q, want the visitor IP", VisitorHeader, got)
+	}
+
+	if router.Forward(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil), "missing") {
+		t.Errorf("Forward(missing) = true, want false when no peer has the tunnel")
+	}
+}
+
+func TestRouterAccept(t *testing.T) {
+	router, err := NewRouter(Config{Token: "secret"}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewRouter() error = %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "10.0.0.2:5000"
+	req.Header.Set(TokenHeader, "wrong")
+	if router.Authorized(req) {
+		t.Errorf("Authorized() = true with a wrong token")
+	}
+
+	req.Header.Set(TokenHeader, "secret")
+	req.Header.Set(SubdomainHeader, "app")
+	req.Header.Set(VisitorHeader, "2001:db8::7")
+	if !router.Authorized(req) {
+		t.Fatalf("Authorized() = false with the shared token")
+	}
+	if got := router.Accept(req); got != "app" {
+		t.Errorf("Accept() = %q, want app", got)
+	}
+	if req.RemoteAddr != "[2001:db8::7]:0" {
+		t.Errorf("RemoteAddr = %q, want the visitor address", req.RemoteAddr)
+	}
+	if req.Header.Get(TokenHeader) != "" {
+		t.Errorf("Accept() left %s on the request", TokenHeader)
+	}
+}
+
+func TestRouterRouteCacheBounded(t *testing.T) {
+	router, err := NewRouter(Config{Token: "secret"}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewRouter() error = %v", err)
+	}
+
+	for i := 0; i < maxRoutes+100; i++ {
+		router.remember(fmt.Sprintf("scan-%d", i), nil, missTTL)
+	}
+	if n := len(router.routes); n != maxRoutes || router.lru.Len() != maxRoutes {
+		t.Errorf("cache holds %d routes, want at most %d", n, maxRoutes)
+	}
+	if _, ok := router.cached("scan-0"); ok {
+		t.Error("the least recently used route was not evicted")
+	}
+	if _, ok := router.cached(fmt.Sprintf("scan-%d", maxRoutes+99)); !ok {
+		t.Error("the newest route was evicted")
+	}
+
+	router.remember("gone", nil, -time.Second)
+	router.nextPrune = time.Time{}
+	router.remember("fresh", nil, missTTL)
+	if _, ok := router.routes["gone"]; ok {
+		t.Error("an expired miss was not pruned")
+	}
+	if _, ok := router.cached("gone"); ok {
+		t.Error("cached() returned an expired route")
+	}
+}
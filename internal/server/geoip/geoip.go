@@ -0,0 +1,176 @@
+// Package geoip maps visitor IPs to countries using a MaxMind DB file,
+// such as GeoLite2-Country or GeoIP2-City, or any compatible database
+// with a country.iso_code field.
+package geoip
+
+import (
+	"bytes"
+	"fmt"
+	"net/netip"
+	"os"
+	"strings"
+	"sync"
+)
+
+// maxCacheEntries bounds the per-record country cache. Country databases
+// have a few hundred distinct records; city databases have many more.
+const maxCacheEntries = 4096
+
+// DB looks up countries in a MaxMind DB file held in memory. A nil *DB
+// knows no countries.
+type DB struct {
+	tree       []byte
+	data       decoder
+	nodeCount  uint
+	recordSize uint
+	ipv4Start  uint
+	ipVersion  uint
+
+	mu    sync.Mutex
+	cache map[uint]string
+}
+
+// Open loads the MaxMind DB file at path.
+func Open(path string) (*DB, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read GeoIP database: %w", err)
+	}
+	db, err := newDB(buf)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return db, nil
+}
+
+func newDB(buf []byte) (*DB, error) {
+	start := max(len(buf)-maxMetadataSize, 0)
+	i := bytes.LastIndex(buf[start:], metadataMarker)
+	if i < 0 {
+		return nil, fmt.Errorf("not a MaxMind database: metadata not found")
+	}
+	metaStart := start + i + len(metadataMarker)
+
+	raw, _, err := decoder{buf: buf[metaStart:]}.decode(0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("invalid metadata: %w", err)
+	}
+	meta, ok := raw.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("invalid metadata: %w", errCorrupt)
+	}
+	nodeCount, _ := meta["node_count"].(uint64)
+	recordSize, _ := meta["record_size"].(uint64)
+	ipVersion, _ := meta["ip_version"].(uint64)
+
+	switch recordSize {
+	case 24, 28, 32:
+	default:
+		return nil, fmt.Errorf("unsupported record size %d", recordSize)
+	}
+	if ipVersion != 4 && ipVersion != 6 {
+		return nil, fmt.Errorf("unsupported IP version %d", ipVersion)
+	}
+
+	treeSize := nodeCount * recordSize / 4
+	dataStart := treeSize + 16
+	if dataStart > uint64(metaStart-len(metadataMarker)) {
+		return nil, errCorrupt
+	}
+
+	db := &DB{
+		tree:       buf[:treeSize],
+		data:       decoder{buf: buf[dataStart : metaStart-len(metadataMarker)]},
+		nodeCount:  uint(nodeCount),
+		recordSize: uint(recordSize),
+		ipVersion:  uint(ipVersion),
+		cache:      make(map[uint]string),
+	}
+
+	// IPv4 addresses live under ::/96 in IPv6 databases.
+	if db.ipVersion == 6 {
+		node := uint(0)
+		for i := 0; i < 96 && node < db.nodeCount; i++ {
+			node = db.record(node, 0)
+		}
+		db.ipv4Start = node
+	}
+	return db, nil
+}
+
+// record returns the left (bit 0) or right (bit 1) record of node.
+func (db *DB) record(node, bit uint) uint {
+	switch db.recordSize {
+	case 24:
+		b := db.tree[node*6+bit*3:]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+	case 28:
+		b := db.tree[node*7:]
+		if bit == 0 {
+			return uint(b[3]&0xf0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3]&0x0f)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	default:
+		b := db.tree[node*8+bit*4:]
+		return uint(b[0])<<24 | uint(b[1])<<16 | uint(b[2])<<8 | uint(b[3])
+	}
+}
+
+// Country returns the ISO 3166-1 alpha-2 code of the country ip belongs
+// to, or "" if ip is invalid, private or not in the database.
+func (db *DB) Country(ip string) string {
+	if db == nil {
+		return ""
+	}
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return ""
+	}
+	addr = addr.Unmap()
+
+	node := uint(0)
+	if addr.Is4() && db.ipVersion == 6 {
+		node = db.ipv4Start
+	} else if addr.Is6() && db.ipVersion == 4 {
+		return ""
+	}
+
+	bits := addr.AsSlice()
+	for i := 0; i < len(bits)*8 && node < db.nodeCount; i++ {
+		bit := uint(bits[i/8]>>(7-i%8)) & 1
+		node = db.record(node, bit)
+	}
+	if node <= db.nodeCount {
+		return ""
+	}
+	return db.countryAt(node - db.nodeCount - 16)
+}
+
+// countryAt returns the country of the data record at off.
+func (db *DB) countryAt(off uint) string {
+	db.mu.Lock()
+	country, ok := db.cache[off]
+	db.mu.Unlock()
+	if ok {
+		return country
+	}
+
+	country, err := db.data.lookup(off, "country", "iso_code")
+	if err == nil && country == "" {
+		// Anonymous proxies and satellite providers only carry the
+		// country the network is registered in.
+		country, err = db.data.lookup(off, "registered_country", "iso_code")
+	}
+	if err != nil {
+		country = ""
+	}
+	country = strings.ToUpper(country)
+
+	db.mu.Lock()
+	if len(db.cache) >= maxCacheEntries {
+		clear(db.cache)
+	}
+	db.cache[off] = country
+	db.mu.Unlock()
+	return country
+}
@@ -0,0 +1,142 @@
+package geoip
+
+import (
+	"bytes"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeString, writeUint and writeMap encode data section fields.
+func writeString(b *bytes.Buffer, s string) {
+	b.WriteByte(typeString<<5 | byte(len(s)))
+	b.WriteString(s)
+}
+
+func writeUint(b *bytes.Buffer, typ byte, v uint32) {
+	b.WriteByte(typ<<5 | 4)
+	b.Write([]byte{byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v)})
+}
+
+func writeMapHeader(b *bytes.Buffer, n int) {
+	b.WriteByte(typeMap<<5 | byte(n))
+}
+
+// buildDB writes an IPv6 database with 24-bit records mapping each prefix
+// to a {"country": {"iso_code": code}} record.
+func buildDB(t *testing.T, prefixes map[string]string) []byte {
+	t.Helper()
+
+	var data bytes.Buffer
+	offsets := map[string]uint32{}
+	for _, code := range prefixes {
+		if _, ok := offsets[code]; ok {
+			continue
+		}
+		offsets[code] = uint32(data.Len())
+		writeMapHeader(&data, 1)
+		writeString(&data, "country")
+		writeMapHeader(&data, 1)
+		writeString(&data, "iso_code")
+		writeString(&data, code)
+	}
+
+	const empty = -1
+	nodes := [][2]int{{empty, empty}}
+	leaves := map[[2]int]string{} // (node, bit) -> code
+	for prefix, code := range prefixes {
+		p := netip.MustParsePrefix(prefix)
+		addr := p.Addr().As16()
+		bits := p.Bits()
+		if p.Addr().Is4() {
+			// IPv4 lives under ::/96, not the ::ffff:0:0/96 mapped range.
+			v4 := p.Addr().As4()
+			addr = [16]byte{}
+			copy(addr[12:], v4[:])
+			bits += 96
+		}
+		node := 0
+		for i := 0; i < bits; i++ {
+			bit := int(addr[i/8]>>(7-i%8)) & 1
+			if i == bits-1 {
+				leaves[[2]int{node, bit}] = code
+				break
+			}
+			if nodes[node][bit] == empty {
+				nodes = append(nodes, [2]int{empty, empty})
+				nodes[node][bit] = len(nodes) - 1
+			}
+			node = nodes[node][bit]
+		}
+	}
+
+	n := uint32(len(nodes))
+	var tree bytes.Buffer
+	for i, node := range nodes {
+		for bit, child := range node {
+			v := n // empty
+			if code, ok := leaves[[2]int{i, bit}]; ok {
+				v = n + 16 + offsets[code]
+			} else if child != empty {
+				v = uint32(child)
+			}
+			tree.Write([]byte{byte(v >> 16), byte(v >> 8), byte(v)})
+		}
+	}
+
+	var file bytes.Buffer
+	file.Write(tree.Bytes())
+	file.Write(make([]byte, 16))
+	file.Write(data.Bytes())
+	file.Write(metadataMarker)
+	writeMapHeader(&file, 3)
+	writeString(&file, "node_count")
+	writeUint(&file, typeUint32, n)
+	writeString(&file, "record_size")
+	writeUint(&file, typeUint16, 24)
+	writeString(&file, "ip_version")
+	writeUint(&file, typeUint16, 6)
+	return file.Bytes()
+}
+
+func TestCountry(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.mmdb")
+	buf := buildDB(t, map[string]string{
+		"203.0.113.0/24": "au",
+		"2001:db8::/32":  "DE",
+	})
+	if err := os.WriteFile(path, buf, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	db, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		ip   string
+		want string
+	}{
+		{"203.0.113.7", "AU"},
+		{"::ffff:203.0.113.7", "AU"},
+		{"203.0.114.7", ""},
+		{"2001:db8::1", "DE"},
+		{"2001:db9::1", ""},
+		{"not-an-ip", ""},
+	}
+	for _, tt := range tests {
+		if got := db.Country(tt.ip); got != tt.want {
+			t.Errorf("Country(%q) = %q, want %q", tt.ip, got, tt.want)
+		}
+	}
+
+	var nilDB *DB
+	if got := nilDB.Country("203.0.113.7"); got != "" {
+		t.Errorf("nil DB Country = %q, want empty", got)
+	}
+
+	if _, err := newDB([]byte("not a database")); err == nil {
+		t.Error("newDB accepted a file without metadata")
+	}
+}
@@ -0,0 +1,327 @@
+package geoip
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Data section field types of the MaxMind DB format.
+const (
+	typeExtended  = 0
+	typePointer   = 1
+	typeString    = 2
+	typeDouble    = 3
+	typeBytes     = 4
+	typeUint16    = 5
+	typeUint32    = 6
+	typeMap       = 7
+	typeInt32     = 8
+	typeUint64    = 9
+	typeUint128   = 10
+	typeArray     = 11
+	typeContainer = 12
+	typeEndMarker = 13
+	typeBool      = 14
+	typeFloat     = 15
+)
+
+// metadataMarker precedes the metadata map at the end of the file.
+var metadataMarker = []byte("\xab\xcd\xefMaxMind.com")
+
+// maxMetadataSize is how far from the end of the file the metadata marker
+// may be.
+const maxMetadataSize = 128 << 10
+
+var errCorrupt = errors.New("corrupt MaxMind database")
+
+// maxDepth bounds nesting so a malformed file cannot recurse forever.
+const maxDepth = 32
+
+// decoder reads fields from a data or metadata section. Pointers are
+// offsets into the same section.
+type decoder struct {
+	buf []byte
+}
+
+// field reads the control bytes at off. For pointers, size is the offset
+// pointed to; otherwise it is the payload length (or entry count for maps
+// and arrays, or the value for booleans) and payload is where it starts.
+func (d decoder) field(off uint) (typ, size, payload uint, err error) {
+	if off >= uint(len(d.buf)) {
+		return 0, 0, 0, errCorrupt
+	}
+	ctrl := d.buf[off]
+	off++
+	typ = uint(ctrl >> 5)
+
+	if typ == typePointer {
+		ss := uint(ctrl>>3) & 0x3
+		n := ss + 1
+		if off+n > uint(len(d.buf)) {
+			return 0, 0, 0, errCorrupt
+		}
+		v := uint(ctrl & 0x7)
+		b := d.buf[off : off+n]
+		switch ss {
+		case 0:
+			size = v<<8 | uint(b[0])
+		case 1:
+			size = (v<<16 | uint(b[0])<<8 | uint(b[1])) + 2048
+		case 2:
+			size = (v<<24 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])) + 526336
+		default:
+			size = uint(b[0])<<24 | uint(b[1])<<16 | uint(b[2])<<8 | uint(b[3])
+		}
+		return typ, size, off + n, nil
+	}
+
+	if typ == typeExtended {
+		if off >= uint(len(d.buf)) {
+			return 0, 0, 0, errCorrupt
+		}
+		typ = 7 + uint(d.buf[off])
+		off++
+	}
+
+	size = uint(ctrl & 0x1f)
+	if size >= 29 {
+		n := size - 28
+		if off+n > uint(len(d.buf)) {
+			return 0, 0, 0, errCorrupt
+		}
+		v := uint(0)
+		for _, c := range d.buf[off : off+n] {
+			v = v<<8 | uint(c)
+		}
+		off += n
+		switch n {
+		case 1:
+			size = 29 + v
+		case 2:
+			size = 285 + v
+		default:
+			size = 65821 + v
+		}
+	}
+	return typ, size, off, nil
+}
+
+// value reads the field at off, following a pointer if there is one.
+// after is the offset following the pointer, or 0 if off held none.
+func (d decoder) value(off uint) (typ, size, payload, after uint, err error) {
+	typ, size, payload, err = d.field(off)
+	if err != nil || typ != typePointer {
+		return typ, size, payload, 0, err
+	}
+	after = payload
+	typ, size, payload, err = d.field(size)
+	if err != nil {
+		return 0, 0, 0, 0, err
+	}
+	if typ == typePointer {
+		return 0, 0, 0, 0, errCorrupt
+	}
+	return typ, size, payload, after, nil
+}
+
+// skip returns the offset of the field after the one at off.
+func (d decoder) skip(off uint) (uint, error) {
+	typ, size, payload, err := d.field(off)
+	if err != nil {
+		return 0, err
+	}
+	if typ == typePointer {
+		return payload, nil
+	}
+	return d.end(typ, size, payload, 0)
+}
+
+// end returns the offset after a value whose payload starts at payload.
+func (d decoder) end(typ, size, payload uint, depth int) (uint, error) {
+	if depth > maxDepth {
+		return 0, errCorrupt
+	}
+	switch typ {
+	case typeMap, typeArray:
+		n := size
+		if typ == typeMap {
+			n *= 2
+		}
+		off := payload
+		for range n {
+			t, s, p, err := d.field(off)
+			if err != nil {
+				return 0, err
+			}
+			if t == typePointer {
+				off = p
+				continue
+			}
+			if off, err = d.end(t, s, p, depth+1); err != nil {
+				return 0, err
+			}
+		}
+		return off, nil
+	case typeBool:
+		return payload, nil
+	default:
+		if payload+size > uint(len(d.buf)) {
+			return 0, errCorrupt
+		}
+		return payload + size, nil
+	}
+}
+
+// decode reads the value at off into Go types: map[string]any, []any,
+// string, []byte, uint64, int32, float64, float32 or bool.
+func (d decoder) decode(off uint, depth int) (any, uint, error) {
+	if depth > maxDepth {
+		return nil, 0, errCorrupt
+	}
+	typ, size, payload, after, err := d.value(off)
+	if err != nil {
+		return nil, 0, err
+	}
+	val, end, err := d.decodeValue(typ, size, payload, depth)
+	if err != nil {
+		return nil, 0, err
+	}
+	if after != 0 {
+		end = after
+	}
+	return val, end, nil
+}
+
+func (d decoder) decodeValue(typ, size, payload uint, depth int) (any, uint, error) {
+	switch typ {
+	case typeMap:
+		m := make(map[string]any, size)
+		off := payload
+		for range size {
+			var (
+				key, val any
+				err      error
+			)
+			if key, off, err = d.decode(off, depth+1); err != nil {
+				return nil, 0, err
+			}
+			k, ok := key.(string)
+			if !ok {
+				return nil, 0, errCorrupt
+			}
+			if val, off, err = d.decode(off, depth+1); err != nil {
+				return nil, 0, err
+			}
+			m[k] = val
+		}
+		return m, off, nil
+	case typeArray:
+		a := make([]any, 0, size)
+		off := payload
+		for range size {
+			var (
+				val any
+				err error
+			)
+			if val, off, err = d.decode(off, depth+1); err != nil {
+				return nil, 0, err
+			}
+			a = append(a, val)
+		}
+		return a, off, nil
+	case typeBool:
+		return size != 0, payload, nil
+	}
+
+	if payload+size > uint(len(d.buf)) {
+		return nil, 0, errCorrupt
+	}
+	b := d.buf[payload : payload+size]
+	next := payload + size
+	switch typ {
+	case typeString:
+		return string(b), next, nil
+	case typeBytes, typeUint128:
+		return bytes.Clone(b), next, nil
+	case typeUint16, typeUint32, typeUint64:
+		if size > 8 {
+			return nil, 0, errCorrupt
+		}
+		var v uint64
+		for _, c := range b {
+			v = v<<8 | uint64(c)
+		}
+		return v, next, nil
+	case typeInt32:
+		if size > 4 {
+			return nil, 0, errCorrupt
+		}
+		var v uint32
+		for _, c := range b {
+			v = v<<8 | uint32(c)
+		}
+		if size < 4 && size > 0 && b[0]&0x80 != 0 {
+			v |= math.MaxUint32 << (8 * size)
+		}
+		return int32(v), next, nil
+	case typeDouble:
+		if size != 8 {
+			return nil, 0, errCorrupt
+		}
+		var v uint64
+		for _, c := range b {
+			v = v<<8 | uint64(c)
+		}
+		return math.Float64frombits(v), next, nil
+	case typeFloat:
+		if size != 4 {
+			return nil, 0, errCorrupt
+		}
+		v := uint32(b[0])<<24 | uint32(b[1])<<16 | uint32(b[2])<<8 | uint32(b[3])
+		return math.Float32frombits(v), next, nil
+	default:
+		return nil, 0, fmt.Errorf("%w: unexpected field type %d", errCorrupt, typ)
+	}
+}
+
+// lookup returns the string at path in the map at off, or "" if any part
+// of the path is missing. Values off the path are skipped, not decoded.
+func (d decoder) lookup(off uint, path ...string) (string, error) {
+	typ, size, payload, _, err := d.value(off)
+	if err != nil {
+		return "", err
+	}
+	if len(path) == 0 {
+		if typ != typeString || payload+size > uint(len(d.buf)) {
+			return "", nil
+		}
+		return string(d.buf[payload : payload+size]), nil
+	}
+	if typ != typeMap {
+		return "", nil
+	}
+
+	off = payload
+	for range size {
+		kt, ks, kp, after, err := d.value(off)
+		if err != nil {
+			return "", err
+		}
+		if kt != typeString || kp+ks > uint(len(d.buf)) {
+			return "", errCorrupt
+		}
+		valOff := kp + ks
+		if after != 0 {
+			valOff = after
+		}
+		if string(d.buf[kp:kp+ks]) == path[0] {
+			return d.lookup(valOff, path[1:]...)
+		}
+		if off, err = d.skip(valOff); err != nil {
+			return "", err
+		}
+	}
+	return "", nil
+}
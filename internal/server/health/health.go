@@ -0,0 +1,94 @@
+// Package health serves liveness and readiness probes for the server on a
+// separate admin address, where they cannot collide with paths of the apps
+// behind tunnels.
+package health
+
+import (
+	"net/http"
+	"time"
+
+	json "github.com/goccy/go-json"
+
+	"drip/internal/server/tcp"
+	"drip/internal/shared/httputil"
+)
+
+// Source reports the state the probes expose. *tcp.Listener implements it.
+type Source interface {
+	Health() tcp.ListenerHealth
+}
+
+// Report is the JSON body of both probes.
+type Report struct {
+	Status        string   `json:"status"`
+	Reasons       []string `json:"reasons,omitempty"`
+	UptimeSeconds int64    `json:"uptime_seconds"`
+
+	tcp.ListenerHealth
+}
+
+// NewHandler returns a handler for /healthz and /readyz.
+//
+// /healthz answers 200 as long as the process can serve requests at all.
+// /readyz answers 503 while the listener is not accepting connections or
+// the server is draining, so load balancers stop sending new tunnels.
+func NewHandler(src Source) http.Handler {
+	started := time.Now()
+	report := func(ready bool) (Report, bool) {
+		h := src.Health()
+		r := Report{
+			Status:         "ok",
+			UptimeSeconds:  int64(time.Since(started).Seconds()),
+			ListenerHealth: h,
+		}
+		if ready {
+			r.Reasons = notReadyReasons(h)
+			if len(r.Reasons) > 0 {
+				r.Status = "unavailable"
+				return r, false
+			}
+		}
+		return r, true
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		rep, _ := report(false)
+		writeReport(w, rep, http.StatusOK)
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		rep, ok := report(true)
+		status := http.StatusOK
+		if !ok {
+			status = http.StatusServiceUnavailable
+		}
+		writeReport(w, rep, status)
+	})
+	return mux
+}
+
+func notReadyReasons(h tcp.ListenerHealth) []string {
+	var reasons []string
+	if h.Draining {
+		reasons = append(reasons, "draining")
+	} else if !h.Listening {
+		reasons = append(reasons, "listener not started")
+	}
+	return reasons
+}
+
+func writeReport(w http.ResponseWriter, rep Report, status int) {
+	data, err := json.Marshal(rep)
+	if err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	if status != http.StatusOK {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_, _ = w.Write(data)
+		return
+	}
+	httputil.WriteJSON(w, data)
+}
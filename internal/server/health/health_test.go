@@ -0,0 +1,51 @@
+package health
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	json "github.com/goccy/go-json"
+
+	"drip/internal/server/tcp"
+)
+
+type fakeSource tcp.ListenerHealth
+
+func (f fakeSource) Health() tcp.ListenerHealth { return tcp.ListenerHealth(f) }
+
+func TestProbes(t *testing.T) {
+	tests := []struct {
+		name        string
+		state       fakeSource
+		path        string
+		wantStatus  int
+		wantReasons int
+	}{
+		{"ready", fakeSource{Listening: true}, "/readyz", http.StatusOK, 0},
+		{"not started", fakeSource{}, "/readyz", http.StatusServiceUnavailable, 1},
+		{"draining", fakeSource{Listening: true, Draining: true}, "/readyz", http.StatusServiceUnavailable, 1},
+		{"alive while draining", fakeSource{Draining: true}, "/healthz", http.StatusOK, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			NewHandler(tt.state).ServeHTTP(rec, httptest.NewRequest("GET", tt.path, nil))
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			var rep Report
+			if err := json.Unmarshal(rec.Body.Bytes(), &rep); err != nil {
+				t.Fatalf("Unmarshal() error = %v", err)
+			}
+			if len(rep.Reasons) != tt.wantReasons {
+				t.Errorf("reasons = %v, want %d", rep.Reasons, tt.wantReasons)
+			}
+			if rep.Draining != tt.state.Draining {
+				t.Errorf("draining = %v, want %v", rep.Draining, tt.state.Draining)
+			}
+		})
+	}
+}
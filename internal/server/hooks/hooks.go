@@ -0,0 +1,87 @@
+// Package hooks lets embedders and external services take part in tunnel
+// registration and request routing, e.g. for custom auth or billing,
+// without patching the server.
+package hooks
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// RegisterEvent describes a tunnel asking to be registered.
+type RegisterEvent struct {
+	Token      string `json:"token,omitempty"`
+	Subdomain  string `json:"subdomain,omitempty"` // requested, may be empty
+	TunnelType string `json:"tunnel_type"`
+	LocalPort  int    `json:"local_port"`
+	RemoteIP   string `json:"remote_ip"`
+
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// RegisterDecision is the answer to a RegisterEvent. A nil decision
+// accepts the tunnel unchanged.
+type RegisterDecision struct {
+	Deny   bool   `json:"deny,omitempty"`
+	Reason string `json:"reason,omitempty"`
+
+	// Subdomain replaces the requested subdomain when set.
+	Subdomain string `json:"subdomain,omitempty"`
+
+	// PortRange names the port range a TCP tunnel is allocated from, e.g.
+	// by plan, instead of the one assigned to its token.
+	PortRange string `json:"port_range,omitempty"`
+
+	// Bind replaces the server's TCP bind addresses for this tunnel, e.g.
+	// to expose it only on a secondary IP.
+	Bind []string `json:"bind,omitempty"`
+}
+
+// RequestEvent describes a visitor request about to be proxied.
+type RequestEvent struct {
+	Subdomain string      `json:"subdomain"`
+	Method    string      `json:"method"`
+	Host      string      `json:"host"`
+	Path      string      `json:"path"`
+	RemoteIP  string      `json:"remote_ip"`
+	Country   string      `json:"country,omitempty"` // ISO 3166-1 alpha-2, with a GeoIP database
+	Header    http.Header `json:"header,omitempty"`
+}
+
+// RequestDecision is the answer to a RequestEvent. A nil decision proxies
+// the request to its tunnel.
+type RequestDecision struct {
+	Deny   bool   `json:"deny,omitempty"`
+	Status int    `json:"status,omitempty"` // defaults to 403 when denying
+	Reason string `json:"reason,omitempty"`
+
+	// Subdomain routes the request to another tunnel when set.
+	Subdomain string `json:"subdomain,omitempty"`
+}
+
+// DisconnectEvent reports a registered tunnel going away.
+type DisconnectEvent struct {
+	Subdomain  string        `json:"subdomain"`
+	TunnelType string        `json:"tunnel_type"`
+	RemoteIP   string        `json:"remote_ip"`
+	Duration   time.Duration `json:"duration"`
+	BytesIn    int64         `json:"bytes_in"`
+	BytesOut   int64         `json:"bytes_out"`
+}
+
+// Hooks is implemented by server extensions. Errors from OnRegister and
+// OnRequest reject the tunnel or request, so a failing extension cannot
+// be bypassed. OnDisconnect is called asynchronously.
+type Hooks interface {
+	OnRegister(ctx context.Context, ev *RegisterEvent) (*RegisterDecision, error)
+	OnRequest(ctx context.Context, ev *RequestEvent) (*RequestDecision, error)
+	OnDisconnect(ctx context.Context, ev *DisconnectEvent)
+}
+
+// Nop accepts everything. Embed it to implement only some hooks.
+type Nop struct{}
+
+func (Nop) OnRegister(context.Context, *RegisterEvent) (*RegisterDecision, error) { return nil, nil }
+func (Nop) OnRequest(context.Context, *RequestEvent) (*RequestDecision, error)    { return nil, nil }
+func (Nop) OnDisconnect(context.Context, *DisconnectEvent)                        {}
@@ -0,0 +1,142 @@
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	json "github.com/goccy/go-json"
+)
+
+// Event names accepted by WebhookConfig.Events.
+const (
+	EventRegister   = "register"
+	EventRequest    = "request"
+	EventDisconnect = "disconnect"
+)
+
+// DefaultWebhookTimeout bounds a single hook call, webhook or not.
+const DefaultWebhookTimeout = 3 * time.Second
+
+// maxWebhookResponse caps how much of the webhook's answer is read.
+const maxWebhookResponse = 64 * 1024
+
+// WebhookConfig configures a Webhook.
+type WebhookConfig struct {
+	URL    string
+	Token  string   // sent as a bearer token when set
+	Events []string // events to forward; others are accepted locally
+}
+
+// Webhook implements Hooks by POSTing each event as JSON to an external
+// service: {"event": "register", "data": {...}}. Register and request
+// events expect a decision object in the response body; an empty body
+// accepts. Any non-2xx status is treated as an error.
+type Webhook struct {
+	cfg    WebhookConfig
+	events map[string]bool
+	client *http.Client
+}
+
+// NewWebhook validates cfg and returns the webhook.
+func NewWebhook(cfg WebhookConfig) (*Webhook, error) {
+	if !strings.HasPrefix(cfg.URL, "http://") && !strings.HasPrefix(cfg.URL, "https://") {
+		return nil, fmt.Errorf("hook URL must start with http:// or https://: %q", cfg.URL)
+	}
+
+	events := make(map[string]bool)
+	for _, e := range cfg.Events {
+		e = strings.ToLower(strings.TrimSpace(e))
+		switch e {
+		case EventRegister, EventRequest, EventDisconnect:
+			events[e] = true
+		case "":
+		default:
+			return nil, fmt.Errorf("unknown hook event %q (want register, request or disconnect)", e)
+		}
+	}
+
+	return &Webhook{
+		cfg:    cfg,
+		events: events,
+		client: &http.Client{Timeout: DefaultWebhookTimeout},
+	}, nil
+}
+
+func (w *Webhook) OnRegister(ctx context.Context, ev *RegisterEvent) (*RegisterDecision, error) {
+	if !w.events[EventRegister] {
+		return nil, nil
+	}
+	var d RegisterDecision
+	ok, err := w.post(ctx, EventRegister, ev, &d)
+	if err != nil || !ok {
+		return nil, err
+	}
+	return &d, nil
+}
+
+func (w *Webhook) OnRequest(ctx context.Context, ev *RequestEvent) (*RequestDecision, error) {
+	if !w.events[EventRequest] {
+		return nil, nil
+	}
+	var d RequestDecision
+	ok, err := w.post(ctx, EventRequest, ev, &d)
+	if err != nil || !ok {
+		return nil, err
+	}
+	return &d, nil
+}
+
+func (w *Webhook) OnDisconnect(ctx context.Context, ev *DisconnectEvent) {
+	if !w.events[EventDisconnect] {
+		return
+	}
+	_, _ = w.post(ctx, EventDisconnect, ev, nil)
+}
+
+// post sends the event and decodes the answer into out. It reports
+// whether a non-empty answer was decoded.
+func (w *Webhook) post(ctx context.Context, event string, data, out any) (bool, error) {
+	body, err := json.Marshal(map[string]any{"event": event, "data": data})
+	if err != nil {
+		return false, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if w.cfg.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+w.cfg.Token)
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("%s hook: %w", event, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return false, fmt.Errorf("%s hook: unexpected status %d", event, resp.StatusCode)
+	}
+	if out == nil {
+		return false, nil
+	}
+
+	answer, err := io.ReadAll(io.LimitReader(resp.Body, maxWebhookResponse))
+	if err != nil {
+		return false, fmt.Errorf("%s hook: %w", event, err)
+	}
+	if len(bytes.TrimSpace(answer)) == 0 {
+		return false, nil
+	}
+	if err := json.Unmarshal(answer, out); err != nil {
+		return false, fmt.Errorf("%s hook: invalid response: %w", event, err)
+	}
+	return true, nil
+}
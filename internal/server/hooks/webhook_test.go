@@ -0,0 +1,83 @@
+package hooks
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWebhook(t *testing.T) {
+	var events []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		switch {
+		case strings.Contains(string(body), `"event":"register"`):
+			events = append(events, "register")
+			_, _ = io.WriteString(w, `{"subdomain":"billing-ok"}`)
+		case strings.Contains(string(body), `"path":"/admin"`):
+			events = append(events, "request")
+			_, _ = io.WriteString(w, `{"deny":true,"status":401}`)
+		default:
+			events = append(events, "other")
+		}
+	}))
+	defer srv.Close()
+
+	wh, err := NewWebhook(WebhookConfig{
+		URL:    srv.URL,
+		Token:  "secret",
+		Events: []string{"register", "request"},
+	})
+	if err != nil {
+		t.Fatalf("NewWebhook() = %v", err)
+	}
+	ctx := context.Background()
+
+	reg, err := wh.OnRegister(ctx, &RegisterEvent{Subdomain: "demo"})
+	if err != nil || reg == nil || reg.Subdomain != "billing-ok" {
+		t.Errorf("OnRegister() = %+v, %v; want subdomain billing-ok", reg, err)
+	}
+
+	req, err := wh.OnRequest(ctx, &RequestEvent{Path: "/admin"})
+	if err != nil || req == nil || !req.Deny || req.Status != http.StatusUnauthorized {
+		t.Errorf("OnRequest(/admin) = %+v, %v; want deny 401", req, err)
+	}
+
+	req, err = wh.OnRequest(ctx, &RequestEvent{Path: "/"})
+	if err != nil || req != nil {
+		t.Errorf("OnRequest(/) = %+v, %v; want nil decision", req, err)
+	}
+
+	// Disconnect is not subscribed and must not reach the webhook.
+	wh.OnDisconnect(ctx, &DisconnectEvent{Subdomain: "demo"})
+	if want := "register,request,other"; strings.Join(events, ",") != want {
+		t.Errorf("events = %v, want %s", events, want)
+	}
+
+	bad, _ := NewWebhook(WebhookConfig{URL: srv.URL, Events: []string{"register"}})
+	if _, err := bad.OnRegister(ctx, &RegisterEvent{}); err == nil {
+		t.Error("OnRegister() with a rejected token succeeded, want error")
+	}
+}
+
+func TestNewWebhookValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  WebhookConfig
+	}{
+		{"bad scheme", WebhookConfig{URL: "ftp://example.com"}},
+		{"unknown event", WebhookConfig{URL: "https://example.com", Events: []string{"connect"}}},
+	}
+	for _, tt := range tests {
+		if _, err := NewWebhook(tt.cfg); err == nil {
+			t.Errorf("%s: NewWebhook() succeeded, want error", tt.name)
+		}
+	}
+}
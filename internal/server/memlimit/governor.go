@@ -0,0 +1,121 @@
+// Package memlimit accounts for memory buffered on behalf of visitors and
+// sheds new work once a tunnel or the whole server exceeds its budget, so
+// abusive traffic gets 503s and reset streams instead of an OOM kill.
+package memlimit
+
+import (
+	"errors"
+	"sync/atomic"
+
+	"drip/internal/server/metrics"
+	"drip/internal/shared/constants"
+	"drip/internal/shared/pool"
+)
+
+// StreamCost is what one proxied stream may hold in memory at once: the
+// mux receive window plus the copy buffers on each side.
+const StreamCost = constants.YamuxMaxStreamWindowSize + 2*pool.SizeLarge
+
+var (
+	// ErrTunnelBudget means the tunnel already buffers its share of memory.
+	ErrTunnelBudget = errors.New("tunnel memory budget exceeded")
+	// ErrGlobalBudget means the server as a whole is out of budget.
+	ErrGlobalBudget = errors.New("server memory budget exceeded")
+)
+
+// Governor holds the server-wide budget shared by all tunnels.
+type Governor struct {
+	limit     int64
+	perTunnel int64
+	used      atomic.Int64
+}
+
+// NewGovernor creates a governor. A zero limit or perTunnel disables the
+// corresponding check.
+func NewGovernor(limit, perTunnel int64) *Governor {
+	return &Governor{
+		limit:     limit,
+		perTunnel: perTunnel,
+	}
+}
+
+// Enabled reports whether any budget is enforced.
+func (g *Governor) Enabled() bool {
+	return g != nil && (g.limit > 0 || g.perTunnel > 0)
+}
+
+// Used returns the bytes currently reserved across all tunnels.
+func (g *Governor) Used() int64 {
+	if g == nil {
+		return 0
+	}
+	return g.used.Load()
+}
+
+// NewBudget returns the budget for one tunnel. It returns nil, which never
+// sheds, when the governor is nil or disabled.
+func (g *Governor) NewBudget() *Budget {
+	if !g.Enabled() {
+		return nil
+	}
+	return &Budget{gov: g}
+}
+
+func (g *Governor) reserve(n int64) bool {
+	used := g.used.Add(n)
+	if g.limit > 0 && used > g.limit {
+		g.used.Add(-n)
+		return false
+	}
+	metrics.MemoryBudgetUsedBytes.Set(float64(used))
+	return true
+}
+
+func (g *Governor) release(n int64) {
+	metrics.MemoryBudgetUsedBytes.Set(float64(g.used.Add(-n)))
+}
+
+// Budget tracks the memory buffered for a single tunnel. A nil Budget
+// accepts every reservation.
+type Budget struct {
+	gov  *Governor
+	used atomic.Int64
+}
+
+// Reserve claims n bytes or reports which budget would be exceeded. Every
+// successful Reserve must be paired with a Release of the same size.
+func (b *Budget) Reserve(n int64) error {
+	if b == nil {
+		return nil
+	}
+
+	used := b.used.Add(n)
+	if b.gov.perTunnel > 0 && used > b.gov.perTunnel {
+		b.used.Add(-n)
+		metrics.MemoryBudgetShed.WithLabelValues("tunnel").Inc()
+		return ErrTunnelBudget
+	}
+	if !b.gov.reserve(n) {
+		b.used.Add(-n)
+		metrics.MemoryBudgetShed.WithLabelValues("global").Inc()
+		return ErrGlobalBudget
+	}
+	return nil
+}
+
+// Release returns n bytes claimed by Reserve.
+func (b *Budget) Release(n int64) {
+	if b == nil {
+		return
+	}
+	b.used.Add(-n)
+	b.gov.release(n)
+}
+
+// Used returns the bytes currently reserved by the tunnel.
+func (b *Budget) Used() int64 {
+	if b == nil {
+		return 0
+	}
+	return b.used.Load()
+}
@@ -0,0 +1,54 @@
+package memlimit
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestBudgetReserve(t *testing.T) {
+	gov := NewGovernor(300, 200)
+	a := gov.NewBudget()
+	b := gov.NewBudget()
+
+	steps := []struct {
+		name   string
+		budget *Budget
+		n      int64
+		want   error
+	}{
+		{"a within tunnel budget", a, 150, nil},
+		{"a over tunnel budget", a, 100, ErrTunnelBudget},
+		{"b within both budgets", b, 150, nil},
+		{"b over global budget", b, 10, ErrGlobalBudget},
+	}
+	for _, s := range steps {
+		if err := s.budget.Reserve(s.n); !errors.Is(err, s.want) {
+			t.Errorf("%s: Reserve(%d) = %v, want %v", s.name, s.n, err, s.want)
+		}
+	}
+
+	if got := gov.Used(); got != 300 {
+		t.Errorf("Used() = %d, want 300", got)
+	}
+
+	a.Release(150)
+	if err := b.Reserve(10); err != nil {
+		t.Errorf("Reserve after Release = %v, want nil", err)
+	}
+	if got := b.Used(); got != 160 {
+		t.Errorf("b.Used() = %d, want 160", got)
+	}
+}
+
+func TestDisabledGovernor(t *testing.T) {
+	for _, gov := range []*Governor{nil, NewGovernor(0, 0)} {
+		budget := gov.NewBudget()
+		if budget != nil {
+			t.Errorf("NewBudget() = %v, want nil for a disabled governor", budget)
+		}
+		if err := budget.Reserve(1 << 40); err != nil {
+			t.Errorf("nil Budget Reserve() = %v, want nil", err)
+		}
+		budget.Release(1 << 40)
+	}
+}
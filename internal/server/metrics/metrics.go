@@ -27,6 +27,12 @@ var (
 		Help: "Number of tunnels per client IP",
 	}, []string{"ip"})
 
+	TunnelReconnectSeconds = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "drip_tunnel_reconnect_seconds",
+		Help:    "Time from accepting a reconnecting client to acknowledging its registration, by whether it took over its stale tunnel with a resume token",
+		Buckets: []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+	}, []string{"resumed"})
+
 	// Connection metrics
 	ActiveConnections = promauto.NewGauge(prometheus.GaugeOpts{
 		Name: "drip_active_connections",
@@ -70,6 +76,54 @@ var (
 		Help: "Current number of active connections per tunnel",
 	}, []string{"tunnel_id", "subdomain", "type"})
 
+	TunnelVisitorRateLimited = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "drip_tunnel_visitor_rate_limited_total",
+		Help: "Total number of visitor requests rejected by per-IP rate limiting per tunnel",
+	}, []string{"tunnel_id", "subdomain", "type"})
+
+	VisitorsByCountry = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "drip_visitors_by_country_total",
+		Help: "Total number of visitor HTTP requests and TCP connections by country, when a GeoIP database is configured",
+	}, []string{"country"})
+
+	// Abuse protection metrics
+	BannedIPs = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "drip_banned_ips",
+		Help: "Current number of temporarily banned IPs",
+	})
+
+	IPBansTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "drip_ip_bans_total",
+		Help: "Total number of temporary IP bans issued",
+	}, []string{"reason"})
+
+	BannedConnectionsRejected = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "drip_banned_connections_rejected_total",
+		Help: "Total number of connections rejected from banned IPs",
+	})
+
+	AcceptRejected = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "drip_accept_rejected_total",
+		Help: "Total number of connections closed at accept by the rate limit or connection cap",
+	}, []string{"reason"})
+
+	FederatedRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "drip_federation_requests_total",
+		Help: "Total number of visitor requests proxied to a federated server",
+	}, []string{"peer"})
+
+	// Peer-to-peer metrics
+	P2PRendezvousTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "drip_p2p_rendezvous_total",
+		Help: "Total number of direct connection rendezvous attempts by result",
+	}, []string{"result"})
+
+	// DNS publishing metrics
+	DNSUpdates = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "drip_dns_updates_total",
+		Help: "Total number of tunnel DNS record changes by operation (publish, withdraw) and result",
+	}, []string{"op", "result"})
+
 	// Rate limiting metrics
 	RateLimitRejections = promauto.NewCounterVec(prometheus.CounterOpts{
 		Name: "drip_rate_limit_rejections_total",
@@ -82,6 +136,16 @@ var (
 		Help: "Total number of panics recovered",
 	})
 
+	PanicsByLocation = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "drip_panics_by_location_total",
+		Help: "Total number of panics recovered, by goroutine or handler",
+	}, []string{"location"})
+
+	PanicLastTimestamp = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "drip_panic_last_timestamp_seconds",
+		Help: "Unix time of the most recently recovered panic",
+	})
+
 	WorkerPoolSize = promauto.NewGauge(prometheus.GaugeOpts{
 		Name: "drip_worker_pool_size",
 		Help: "Current worker pool size",
@@ -92,6 +156,79 @@ var (
 		Help: "Current number of active workers",
 	})
 
+	WorkerPoolQueueDepth = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "drip_worker_pool_queue_depth",
+		Help: "Current number of connections waiting for a worker",
+	})
+
+	WorkerPoolQueueLatency = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "drip_worker_pool_queue_latency_seconds",
+		Help: "Average time connections wait in the worker queue",
+	})
+
+	WorkerPoolSubmitted = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "drip_worker_pool_submitted_total",
+		Help: "Total number of connections queued to the worker pool",
+	})
+
+	WorkerPoolRejected = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "drip_worker_pool_rejected_total",
+		Help: "Total number of connections dropped because the worker pool was overloaded",
+	})
+
+	WorkerPoolFallback = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "drip_worker_pool_fallback_total",
+		Help: "Total number of connections handled outside the worker pool because it was overloaded",
+	})
+
+	// Buffer pool metrics
+	BufferPoolGets = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "drip_buffer_pool_gets_total",
+		Help: "Total number of pooled buffer requests by bucket size and whether a recycled buffer was available",
+	}, []string{"bucket", "result"})
+
+	BufferPoolDrops = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "drip_buffer_pool_drops_total",
+		Help: "Total number of returned buffers discarded because their size matched no bucket",
+	}, []string{"bucket"})
+
+	BufferPoolOversize = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "drip_buffer_pool_oversize_total",
+		Help: "Total number of buffer requests larger than the biggest bucket",
+	})
+
+	BufferPoolAdaptiveThreshold = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "drip_buffer_pool_adaptive_threshold_bytes",
+		Help: "Largest frame payload currently read into a pooled buffer",
+	})
+
+	// Frame writer batching metrics
+	FrameWriterBatchSize = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "drip_frame_writer_batch_size",
+		Help: "Frames written together at most, as tuned by write latency and queue depth, averaged over connections",
+	})
+
+	FrameWriterBatchWait = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "drip_frame_writer_batch_wait_seconds",
+		Help: "Time a frame may wait for others to batch with, averaged over connections",
+	})
+
+	FrameWriterWriteLatency = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "drip_frame_writer_write_latency_seconds",
+		Help: "Moving average of the time a batched write to a connection takes, averaged over connections",
+	})
+
+	// Memory budget metrics
+	MemoryBudgetUsedBytes = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "drip_memory_budget_used_bytes",
+		Help: "Bytes currently reserved for buffering visitor traffic",
+	})
+
+	MemoryBudgetShed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "drip_memory_budget_shed_total",
+		Help: "Total number of requests and streams refused because a memory budget was exhausted",
+	}, []string{"scope"})
+
 	// HTTP proxy metrics
 	HTTPRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
 		Name:    "drip_http_request_duration_seconds",
@@ -104,3 +241,12 @@ var (
 		Help: "Current number of HTTP requests being processed",
 	})
 )
+
+// RecordVisitorCountry counts a visitor from country, an ISO 3166-1 alpha-2
+// code or "" if unknown.
+func RecordVisitorCountry(country string) {
+	if country == "" {
+		country = "unknown"
+	}
+	VisitorsByCountry.WithLabelValues(country).Inc()
+}
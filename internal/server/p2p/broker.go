@@ -0,0 +1,140 @@
+// Package p2p coordinates direct connections between an exposing drip client
+// and a consumer. The server only introduces the two peers to each other;
+// when hole punching fails the consumer falls back to the relayed port.
+package p2p
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+
+	"drip/internal/server/metrics"
+	"drip/internal/shared/protocol"
+)
+
+var (
+	// ErrNoPeer means no exposing client accepts direct connections on the port.
+	ErrNoPeer = errors.New("tunnel does not accept direct connections")
+	// ErrDenied means the consumer's IP is rejected by the tunnel's access rules.
+	ErrDenied = errors.New("access denied by tunnel IP rules")
+	// ErrUnknownOffer means the offer expired or never existed.
+	ErrUnknownOffer = errors.New("unknown or expired offer")
+)
+
+type watcher struct {
+	offers  chan protocol.P2POffer
+	allowIP func(ip string) bool
+}
+
+type pending struct {
+	consumerAddr string
+	exposerAddr  chan string
+}
+
+// Broker pairs consumers with exposing clients, keyed by public tunnel port.
+type Broker struct {
+	mu       sync.Mutex
+	watchers map[int]*watcher
+	pending  map[string]*pending
+}
+
+// NewBroker creates an empty broker.
+func NewBroker() *Broker {
+	return &Broker{
+		watchers: make(map[int]*watcher),
+		pending:  make(map[string]*pending),
+	}
+}
+
+// Watch registers the exposing client of port for offers. allowIP, if not
+// nil, filters consumers the same way the relayed port would. The returned
+// cancel function must be called when the client goes away.
+func (b *Broker) Watch(port int, allowIP func(ip string) bool) (<-chan protocol.P2POffer, func()) {
+	w := &watcher{
+		offers:  make(chan protocol.P2POffer, 16),
+		allowIP: allowIP,
+	}
+
+	b.mu.Lock()
+	b.watchers[port] = w
+	b.mu.Unlock()
+
+	return w.offers, func() {
+		b.mu.Lock()
+		if b.watchers[port] == w {
+			delete(b.watchers, port)
+		}
+		b.mu.Unlock()
+	}
+}
+
+// Connect offers consumerAddr to the exposing client of port and waits until
+// it announces its address or ctx is done.
+func (b *Broker) Connect(ctx context.Context, port int, consumerAddr, consumerIP string) (*protocol.P2PRendezvousResponse, error) {
+	b.mu.Lock()
+	w := b.watchers[port]
+	b.mu.Unlock()
+
+	if w == nil {
+		metrics.P2PRendezvousTotal.WithLabelValues("no_peer").Inc()
+		return nil, ErrNoPeer
+	}
+	if w.allowIP != nil && !w.allowIP(consumerIP) {
+		metrics.P2PRendezvousTotal.WithLabelValues("denied").Inc()
+		return nil, ErrDenied
+	}
+
+	id := newOfferID()
+	p := &pending{
+		consumerAddr: consumerAddr,
+		exposerAddr:  make(chan string, 1),
+	}
+
+	b.mu.Lock()
+	b.pending[id] = p
+	b.mu.Unlock()
+	defer func() {
+		b.mu.Lock()
+		delete(b.pending, id)
+		b.mu.Unlock()
+	}()
+
+	select {
+	case w.offers <- protocol.P2POffer{ID: id, PeerAddr: consumerAddr}:
+	default:
+		metrics.P2PRendezvousTotal.WithLabelValues("busy").Inc()
+		return nil, ErrNoPeer
+	}
+
+	select {
+	case addr := <-p.exposerAddr:
+		metrics.P2PRendezvousTotal.WithLabelValues("matched").Inc()
+		return &protocol.P2PRendezvousResponse{ID: id, PeerAddr: addr}, nil
+	case <-ctx.Done():
+		metrics.P2PRendezvousTotal.WithLabelValues("timeout").Inc()
+		return nil, ctx.Err()
+	}
+}
+
+// Announce completes an offer with the exposing client's observed address
+// and returns the consumer's address.
+func (b *Broker) Announce(id, exposerAddr string) (string, error) {
+	b.mu.Lock()
+	p := b.pending[id]
+	delete(b.pending, id)
+	b.mu.Unlock()
+
+	if p == nil {
+		return "", ErrUnknownOffer
+	}
+	p.exposerAddr <- exposerAddr
+	return p.consumerAddr, nil
+}
+
+func newOfferID() string {
+	var buf [16]byte
+	_, _ = rand.Read(buf[:])
+	return hex.EncodeToString(buf[:])
+}
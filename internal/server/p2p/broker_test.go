@@ -0,0 +1,54 @@
+package p2p
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBrokerRendezvous(t *testing.T) {
+	b := NewBroker()
+	offers, cancel := b.Watch(20001, nil)
+	defer cancel()
+
+	go func() {
+		offer := <-offers
+		if offer.PeerAddr != "198.51.100.1:40000" {
+			t.Errorf("offer peer = %q", offer.PeerAddr)
+		}
+		consumer, err := b.Announce(offer.ID, "203.0.113.9:50000")
+		if err != nil || consumer != "198.51.100.1:40000" {
+			t.Errorf("Announce() = %q, %v", consumer, err)
+		}
+	}()
+
+	ctx, cancelCtx := context.WithTimeout(context.Background(), time.Second)
+	defer cancelCtx()
+
+	match, err := b.Connect(ctx, 20001, "198.51.100.1:40000", "198.51.100.1")
+	if err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	if match.PeerAddr != "203.0.113.9:50000" {
+		t.Errorf("match peer = %q", match.PeerAddr)
+	}
+	if _, err := b.Announce(match.ID, "203.0.113.9:50000"); !errors.Is(err, ErrUnknownOffer) {
+		t.Errorf("second Announce() error = %v, want ErrUnknownOffer", err)
+	}
+}
+
+func TestBrokerRejects(t *testing.T) {
+	b := NewBroker()
+	ctx := context.Background()
+
+	if _, err := b.Connect(ctx, 20001, "198.51.100.1:40000", "198.51.100.1"); !errors.Is(err, ErrNoPeer) {
+		t.Errorf("Connect() without watcher error = %v, want ErrNoPeer", err)
+	}
+
+	_, cancel := b.Watch(20001, func(ip string) bool { return ip == "10.0.0.1" })
+	defer cancel()
+	if _, err := b.Connect(ctx, 20001, "198.51.100.1:40000", "198.51.100.1"); !errors.Is(err, ErrDenied) {
+		t.Errorf("Connect() from denied IP error = %v, want ErrDenied", err)
+	}
+}
@@ -0,0 +1,460 @@
+// Package ports hands out public ports to TCP tunnels from named ranges.
+// Tokens can be pinned to a range (e.g. low ports for premium users), and
+// ports the host uses for other services can be excluded.
+package ports
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math"
+	"math/big"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultRange names the range passed to NewAllocator. Tunnels whose token
+// has no assignment allocate from it.
+const DefaultRange = "default"
+
+// Range is an inclusive port range.
+type Range struct {
+	Name string `json:"name"`
+	Min  int    `json:"min"`
+	Max  int    `json:"max"`
+}
+
+func (r Range) contains(port int) bool {
+	return port >= r.Min && port <= r.Max
+}
+
+func (r Range) validate() error {
+	if r.Name == "" {
+		return fmt.Errorf("port range needs a name")
+	}
+	if r.Min <= 0 || r.Max <= 0 || r.Min > r.Max || r.Max > 65535 {
+		return fmt.Errorf("invalid port range %d-%d", r.Min, r.Max)
+	}
+	return nil
+}
+
+// RangeStatus is a Range with its current usage.
+type RangeStatus struct {
+	Range
+	Total  int `json:"total"`
+	Used   int `json:"used"`
+	Tokens int `json:"tokens"`
+}
+
+// Allocator manages dynamic TCP port allocation within the configured ranges.
+// It keeps an in-memory reservation map; ports are held until Release is called.
+type Allocator struct {
+	mu       sync.Mutex
+	ranges   []Range
+	tokens   map[string]string
+	excluded map[int]bool
+	used     map[int]bool
+
+	// owners maps allocated ports to the token that holds them, for
+	// tokenShare.
+	owners     map[int]string
+	tokenShare float64
+}
+
+// NewAllocator creates an allocator whose default range is min-max.
+func NewAllocator(min, max int) (*Allocator, error) {
+	if min <= 0 || max <= 0 || min >= max || max > 65535 {
+		return nil, fmt.Errorf("invalid port range %d-%d", min, max)
+	}
+
+	return &Allocator{
+		ranges:   []Range{{Name: DefaultRange, Min: min, Max: max}},
+		tokens:   make(map[string]string),
+		excluded: make(map[int]bool),
+		used:     make(map[int]bool),
+		owners:   make(map[int]string),
+	}, nil
+}
+
+// SetRange adds a range or replaces the one with the same name. Ranges may
+// not overlap. Ports already allocated outside a shrunk range stay reserved
+// until released.
+func (p *Allocator) SetRange(r Range) error {
+	if err := r.validate(); err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, other := range p.ranges {
+		if other.Name != r.Name && r.Min <= other.Max && other.Min <= r.Max {
+			return fmt.Errorf("port range %s (%d-%d) overlaps %s (%d-%d)", r.Name, r.Min, r.Max, other.Name, other.Min, other.Max)
+		}
+	}
+	if i := p.rangeIndex(r.Name); i >= 0 {
+		p.ranges[i] = r
+	} else {
+		p.ranges = append(p.ranges, r)
+	}
+	return nil
+}
+
+// RemoveRange deletes a range and the token assignments pointing to it.
+// The default range cannot be removed.
+func (p *Allocator) RemoveRange(name string) error {
+	if name == DefaultRange {
+		return fmt.Errorf("the %s port range cannot be removed", DefaultRange)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	i := p.rangeIndex(name)
+	if i < 0 {
+		return fmt.Errorf("unknown port range %q", name)
+	}
+	p.ranges = slices.Delete(p.ranges, i, i+1)
+	for token, assigned := range p.tokens {
+		if assigned == name {
+			delete(p.tokens, token)
+		}
+	}
+	return nil
+}
+
+// AssignToken makes tunnels authenticated with token allocate from the
+// named range.
+func (p *Allocator) AssignToken(token, name string) error {
+	if token == "" {
+		return fmt.Errorf("token is empty")
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.rangeIndex(name) < 0 {
+		return fmt.Errorf("unknown port range %q", name)
+	}
+	if name == DefaultRange {
+		delete(p.tokens, token)
+	} else {
+		p.tokens[token] = name
+	}
+	return nil
+}
+
+// UnassignToken moves token back to the default range. It reports whether
+// the token had an assignment.
+func (p *Allocator) UnassignToken(token string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	_, ok := p.tokens[token]
+	delete(p.tokens, token)
+	return ok
+}
+
+// SetTokenShare limits each token to share (0-1) of the ports of a range,
+// so one tenant cannot exhaust it. 0 removes the limit. Ports allocated
+// without a token are not limited.
+func (p *Allocator) SetTokenShare(share float64) error {
+	if share < 0 || share > 1 || math.IsNaN(share) {
+		return fmt.Errorf("invalid token port share %v: must be between 0 and 1", share)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.tokenShare = share
+	return nil
+}
+
+// RangeFor returns the name of the range token allocates from.
+func (p *Allocator) RangeFor(token string) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if name, ok := p.tokens[token]; ok {
+		return name
+	}
+	return DefaultRange
+}
+
+// Exclude keeps ports from ever being allocated. Ports already in use stay
+// reserved until released.
+func (p *Allocator) Exclude(ports ...int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, port := range ports {
+		p.excluded[port] = true
+	}
+}
+
+// Include lifts exclusions added with Exclude.
+func (p *Allocator) Include(ports ...int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, port := range ports {
+		delete(p.excluded, port)
+	}
+}
+
+// Excluded returns the excluded ports in ascending order.
+func (p *Allocator) Excluded() []int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	ports := make([]int, 0, len(p.excluded))
+	for port := range p.excluded {
+		ports = append(ports, port)
+	}
+	slices.Sort(ports)
+	return ports
+}
+
+// Ranges returns every range with its usage, the default range first.
+func (p *Allocator) Ranges() []RangeStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	status := make([]RangeStatus, len(p.ranges))
+	for i, r := range p.ranges {
+		status[i] = RangeStatus{Range: r, Total: p.available(r)}
+		for port := range p.used {
+			if r.contains(port) {
+				status[i].Used++
+			}
+		}
+		for _, name := range p.tokens {
+			if name == r.Name {
+				status[i].Tokens++
+			}
+		}
+	}
+	return status
+}
+
+// Allocate finds a free port in the named range ("" for the default range)
+// for token, marks it as used, and ensures it's currently available.
+func (p *Allocator) Allocate(name, token string) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	r, err := p.lookup(name)
+	if err != nil {
+		return 0, err
+	}
+	if err := p.checkShare(r, token); err != nil {
+		return 0, err
+	}
+
+	// Scan from a random offset so tunnels don't get predictable ports.
+	total := r.Max - r.Min + 1
+	start := randomOffset(total)
+	for i := 0; i < total; i++ {
+		port := r.Min + (start+i)%total
+		if p.used[port] || p.excluded[port] {
+			continue
+		}
+
+		// Probe the port to ensure it's not taken by the OS/other process.
+		if !probe(port) {
+			continue
+		}
+
+		p.reserve(port, token)
+		return port, nil
+	}
+
+	return 0, fmt.Errorf("no available port in range %d-%d", r.Min, r.Max)
+}
+
+// AllocateSpecific reserves a specific port for token if it is within the
+// named range ("" for the default range) and available.
+func (p *Allocator) AllocateSpecific(name, token string, port int) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	r, err := p.lookup(name)
+	if err != nil {
+		return 0, err
+	}
+	if !r.contains(port) {
+		return 0, fmt.Errorf("requested port %d outside range %d-%d", port, r.Min, r.Max)
+	}
+	if p.excluded[port] {
+		return 0, fmt.Errorf("requested port %d is reserved", port)
+	}
+	if p.used[port] {
+		return 0, fmt.Errorf("requested port %d already in use", port)
+	}
+	if err := p.checkShare(r, token); err != nil {
+		return 0, err
+	}
+
+	ln, err := net.Listen("tcp", ":"+strconv.Itoa(port))
+	if err != nil {
+		return 0, fmt.Errorf("requested port %d unavailable: %w", port, err)
+	}
+	_ = ln.Close()
+
+	p.reserve(port, token)
+	return port, nil
+}
+
+func (p *Allocator) reserve(port int, token string) {
+	p.used[port] = true
+	if token != "" {
+		p.owners[port] = token
+	}
+}
+
+// checkShare fails once token holds its share of r.
+func (p *Allocator) checkShare(r Range, token string) error {
+	if p.tokenShare == 0 || token == "" {
+		return nil
+	}
+	limit := int(math.Ceil(p.tokenShare * float64(p.available(r))))
+	held := 0
+	for port, owner := range p.owners {
+		if owner == token && r.contains(port) {
+			held++
+		}
+	}
+	if held >= limit {
+		return fmt.Errorf("token already holds %d of the %d ports of range %s it may use", held, limit, r.Name)
+	}
+	return nil
+}
+
+// Release frees a previously allocated port.
+func (p *Allocator) Release(port int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.used, port)
+	delete(p.owners, port)
+}
+
+// Capacity returns how many ports the ranges offer and how many are reserved.
+func (p *Allocator) Capacity() (total, used int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, r := range p.ranges {
+		total += p.available(r)
+	}
+	return total, len(p.used)
+}
+
+// available returns the number of ports in r that are not excluded.
+func (p *Allocator) available(r Range) int {
+	n := r.Max - r.Min + 1
+	for port := range p.excluded {
+		if r.contains(port) {
+			n--
+		}
+	}
+	return n
+}
+
+func (p *Allocator) rangeIndex(name string) int {
+	return slices.IndexFunc(p.ranges, func(r Range) bool { return r.Name == name })
+}
+
+func (p *Allocator) lookup(name string) (Range, error) {
+	if name == "" {
+		name = DefaultRange
+	}
+	i := p.rangeIndex(name)
+	if i < 0 {
+		return Range{}, fmt.Errorf("unknown port range %q", name)
+	}
+	return p.ranges[i], nil
+}
+
+// probe checks the port is free on both IPv4 and IPv6, whichever addresses
+// the tunnel ends up binding.
+func probe(port int) bool {
+	ln, err := net.Listen("tcp", ":"+strconv.Itoa(port))
+	if err != nil {
+		return false
+	}
+	_ = ln.Close()
+	return true
+}
+
+func randomOffset(n int) int {
+	if n <= 1 {
+		return 0
+	}
+
+	// crypto/rand for better distribution without needing a global seed.
+	randInt, err := rand.Int(rand.Reader, big.NewInt(int64(n)))
+	if err != nil {
+		return 0
+	}
+	return int(randInt.Int64())
+}
+
+// ParseList parses a comma-separated list of ports and port ranges such as
+// "5432,6000-6010".
+func ParseList(s string) ([]int, error) {
+	var ports []int
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		lo, hi, isRange := strings.Cut(item, "-")
+		min, err := parsePort(lo)
+		if err != nil {
+			return nil, err
+		}
+		max := min
+		if isRange {
+			if max, err = parsePort(hi); err != nil {
+				return nil, err
+			}
+			if max < min {
+				return nil, fmt.Errorf("invalid port range %q", item)
+			}
+		}
+		for port := min; port <= max; port++ {
+			ports = append(ports, port)
+		}
+	}
+	return ports, nil
+}
+
+func parsePort(s string) (int, error) {
+	port, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil || port < 1 || port > 65535 {
+		return 0, fmt.Errorf("invalid port %q", s)
+	}
+	return port, nil
+}
+
+// FormatList is the inverse of ParseList for sorted ports, collapsing runs
+// into ranges.
+func FormatList(ports []int) string {
+	var b strings.Builder
+	for i := 0; i < len(ports); {
+		j := i
+		for j+1 < len(ports) && ports[j+1] == ports[j]+1 {
+			j++
+		}
+		if b.Len() > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(strconv.Itoa(ports[i]))
+		if j > i {
+			b.WriteByte('-')
+			b.WriteString(strconv.Itoa(ports[j]))
+		}
+		i = j + 1
+	}
+	return b.String()
+}
@@ -0,0 +1,144 @@
+package ports
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestAllocatorTokenRanges(t *testing.T) {
+	p, err := NewAllocator(41000, 41009)
+	if err != nil {
+		t.Fatalf("NewAllocator() error = %v", err)
+	}
+	if err := p.SetRange(Range{Name: "premium", Min: 41100, Max: 41101}); err != nil {
+		t.Fatalf("SetRange() error = %v", err)
+	}
+	if err := p.AssignToken("gold", "premium"); err != nil {
+		t.Fatalf("AssignToken() error = %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		port, err := p.Allocate(p.RangeFor("gold"), "gold")
+		if err != nil {
+			t.Fatalf("Allocate(premium) error = %v", err)
+		}
+		if port < 41100 || port > 41101 {
+			t.Errorf("Allocate(premium) = %d, want 41100-41101", port)
+		}
+	}
+	if _, err := p.Allocate("premium", ""); err == nil {
+		t.Error("Allocate(premium) succeeded with the range exhausted")
+	}
+	if _, err := p.AllocateSpecific(p.RangeFor("other"), "other", 41100); err == nil {
+		t.Error("AllocateSpecific() gave a premium port to an unassigned token")
+	}
+
+	if err := p.RemoveRange("premium"); err != nil {
+		t.Fatalf("RemoveRange() error = %v", err)
+	}
+	if got := p.RangeFor("gold"); got != DefaultRange {
+		t.Errorf("RangeFor() after RemoveRange = %q, want %q", got, DefaultRange)
+	}
+}
+
+func TestAllocatorExclusions(t *testing.T) {
+	p, err := NewAllocator(41200, 41203)
+	if err != nil {
+		t.Fatalf("NewAllocator() error = %v", err)
+	}
+	p.Exclude(41200, 41201, 41202)
+
+	if total, _ := p.Capacity(); total != 1 {
+		t.Errorf("Capacity() total = %d, want 1", total)
+	}
+	port, err := p.Allocate("", "")
+	if err != nil || port != 41203 {
+		t.Errorf("Allocate() = %d, %v, want 41203", port, err)
+	}
+	if _, err := p.AllocateSpecific("", "", 41201); err == nil {
+		t.Error("AllocateSpecific() allocated an excluded port")
+	}
+
+	p.Include(41201)
+	if got, want := p.Excluded(), []int{41200, 41202}; !slices.Equal(got, want) {
+		t.Errorf("Excluded() = %v, want %v", got, want)
+	}
+}
+
+func TestAllocatorTokenShare(t *testing.T) {
+	p, err := NewAllocator(41400, 41403)
+	if err != nil {
+		t.Fatalf("NewAllocator() error = %v", err)
+	}
+	if err := p.SetTokenShare(0.5); err != nil {
+		t.Fatalf("SetTokenShare() error = %v", err)
+	}
+
+	var held []int
+	for i := 0; i < 2; i++ {
+		port, err := p.Allocate("", "alice")
+		if err != nil {
+			t.Fatalf("Allocate() error = %v", err)
+		}
+		held = append(held, port)
+	}
+	if _, err := p.Allocate("", "alice"); err == nil {
+		t.Error("Allocate() went past the token's share")
+	}
+	if _, err := p.Allocate("", "bob"); err != nil {
+		t.Errorf("Allocate() for another token error = %v", err)
+	}
+
+	p.Release(held[0])
+	if _, err := p.Allocate("", "alice"); err != nil {
+		t.Errorf("Allocate() after Release error = %v", err)
+	}
+	if err := p.SetTokenShare(1.5); err == nil {
+		t.Error("SetTokenShare() accepted a share above 1")
+	}
+}
+
+func TestAllocatorRejectsOverlap(t *testing.T) {
+	p, err := NewAllocator(41300, 41399)
+	if err != nil {
+		t.Fatalf("NewAllocator() error = %v", err)
+	}
+	if err := p.SetRange(Range{Name: "low", Min: 41390, Max: 41400}); err == nil {
+		t.Error("SetRange() accepted a range overlapping the default range")
+	}
+	if err := p.RemoveRange(DefaultRange); err == nil {
+		t.Error("RemoveRange() removed the default range")
+	}
+}
+
+func TestParseList(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    []int
+		wantErr bool
+	}{
+		{"", nil, false},
+		{"5432", []int{5432}, false},
+		{"22, 6000-6002", []int{22, 6000, 6001, 6002}, false},
+		{"6002-6000", nil, true},
+		{"70000", nil, true},
+		{"ssh", nil, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseList(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseList(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("ParseList(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestFormatList(t *testing.T) {
+	if got, want := FormatList([]int{22, 6000, 6001, 6002, 8080}), "22,6000-6002,8080"; got != want {
+		t.Errorf("FormatList() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,357 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	json "github.com/goccy/go-json"
+	"go.uber.org/zap"
+
+	"drip/internal/server/abuse"
+	"drip/internal/server/ports"
+	"drip/internal/server/tunnel"
+	"drip/internal/shared/httputil"
+	"drip/internal/shared/recovery"
+	"drip/internal/shared/utils"
+	"drip/pkg/config"
+)
+
+// SetBanList exposes the edge ban list through the admin API.
+func (h *Handler) SetBanList(banList *abuse.BanList) {
+	h.banList = banList
+}
+
+// SetPortAllocator exposes TCP port ranges through the admin API.
+func (h *Handler) SetPortAllocator(alloc *ports.Allocator) {
+	h.portAlloc = alloc
+}
+
+// SetPanicMetrics exposes recently recovered panics through the admin API.
+func (h *Handler) SetPanicMetrics(pm *recovery.PanicMetrics) {
+	h.panicMetrics = pm
+}
+
+// SetReloader lets the admin API reload the server configuration file.
+func (h *Handler) SetReloader(reload func() (*config.ReloadResult, error)) {
+	h.reload = reload
+}
+
+// validateAdminAuth guards endpoints that change server state. Unlike
+// read-only stats, they are disabled entirely when no metrics token is set.
+func (h *Handler) validateAdminAuth(w http.ResponseWriter, r *http.Request) bool {
+	if h.getMetricsToken() == "" {
+		http.Error(w, "Admin API disabled: configure a metrics token to enable it", http.StatusForbidden)
+		return false
+	}
+	return h.validateMetricsAuth(w, r, "admin")
+}
+
+// serveAdminBans lists active bans (GET) or lifts them (DELETE, optionally
+// restricted to ?ip=).
+func (h *Handler) serveAdminBans(w http.ResponseWriter, r *http.Request) {
+	if !h.validateAdminAuth(w, r) {
+		return
+	}
+
+	var result map[string]interface{}
+
+	switch r.Method {
+	case http.MethodGet:
+		bans := h.banList.List()
+		result = map[string]interface{}{
+			"enabled": h.banList.Enabled(),
+			"total":   len(bans),
+			"bans":    bans,
+		}
+	case http.MethodDelete:
+		if ip := r.URL.Query().Get("ip"); ip != "" {
+			result = map[string]interface{}{
+				"ip":      ip,
+				"removed": h.banList.Unban(ip),
+			}
+			h.auditAdmin(r, "unban", map[string]string{"ip": ip})
+		} else {
+			result = map[string]interface{}{
+				"cleared": h.banList.Clear(),
+			}
+			h.auditAdmin(r, "clear_bans", nil)
+		}
+	default:
+		w.Header().Set("Allow", "GET, DELETE")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+	httputil.WriteJSON(w, data)
+}
+
+// serveAdminPorts reports (GET) or changes TCP port allocation at runtime
+// and answers with the resulting state.
+//
+//	PUT    ?range=&min=&max=   add or resize a named range
+//	PUT    ?token=&range=      allocate the token's tunnels from a range
+//	PUT    ?exclude=           never allocate these ports, e.g. 5432,6000-6010
+//	DELETE ?range=, ?token= or ?exclude= undoes the above
+func (h *Handler) serveAdminPorts(w http.ResponseWriter, r *http.Request) {
+	if !h.validateAdminAuth(w, r) {
+		return
+	}
+	if h.portAlloc == nil {
+		http.Error(w, "Port allocation is not configured", http.StatusNotFound)
+		return
+	}
+
+	q := r.URL.Query()
+	var err error
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut, http.MethodPost:
+		err = h.updatePorts(q.Get("range"), q.Get("min"), q.Get("max"), q.Get("token"), q.Get("exclude"))
+	case http.MethodDelete:
+		err = h.deletePorts(q.Get("range"), q.Get("token"), q.Get("exclude"))
+	default:
+		w.Header().Set("Allow", "GET, PUT, POST, DELETE")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if r.Method != http.MethodGet {
+		h.logger.Warn("Port allocation changed via admin API",
+			zap.String("method", r.Method),
+			zap.String("range", q.Get("range")),
+			zap.String("exclude", q.Get("exclude")),
+			zap.Bool("token", q.Get("token") != ""),
+		)
+		h.auditAdmin(r, "ports", map[string]string{
+			"method":  r.Method,
+			"range":   q.Get("range"),
+			"min":     q.Get("min"),
+			"max":     q.Get("max"),
+			"exclude": q.Get("exclude"),
+			"token":   strconv.FormatBool(q.Get("token") != ""),
+		})
+	}
+
+	data, err := json.Marshal(map[string]interface{}{
+		"ranges":   h.portAlloc.Ranges(),
+		"excluded": ports.FormatList(h.portAlloc.Excluded()),
+	})
+	if err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+	httputil.WriteJSON(w, data)
+}
+
+func (h *Handler) updatePorts(name, min, max, token, exclude string) error {
+	switch {
+	case token != "":
+		return h.portAlloc.AssignToken(token, name)
+	case name != "":
+		lo, err := strconv.Atoi(min)
+		if err != nil {
+			return fmt.Errorf("invalid min %q", min)
+		}
+		hi, err := strconv.Atoi(max)
+		if err != nil {
+			return fmt.Errorf("invalid max %q", max)
+		}
+		return h.portAlloc.SetRange(ports.Range{Name: name, Min: lo, Max: hi})
+	case exclude != "":
+		list, err := ports.ParseList(exclude)
+		if err != nil {
+			return err
+		}
+		h.portAlloc.Exclude(list...)
+		return nil
+	default:
+		return fmt.Errorf("set range, token or exclude")
+	}
+}
+
+func (h *Handler) deletePorts(name, token, exclude string) error {
+	switch {
+	case token != "":
+		if !h.portAlloc.UnassignToken(token) {
+			return fmt.Errorf("token has no port range assigned")
+		}
+		return nil
+	case name != "":
+		return h.portAlloc.RemoveRange(name)
+	case exclude != "":
+		list, err := ports.ParseList(exclude)
+		if err != nil {
+			return err
+		}
+		h.portAlloc.Include(list...)
+		return nil
+	default:
+		return fmt.Errorf("set range, token or exclude")
+	}
+}
+
+// serveAdminLogLevel reports (GET) or changes (PUT/POST) log levels at
+// runtime. ?level= sets the level; with ?subsystem= (protocol, proxy, auth)
+// only that subsystem changes, and level=reset drops its override.
+func (h *Handler) serveAdminLogLevel(w http.ResponseWriter, r *http.Request) {
+	if !h.validateAdminAuth(w, r) {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut, http.MethodPost:
+		level := r.URL.Query().Get("level")
+		subsystem := r.URL.Query().Get("subsystem")
+		if err := utils.SetLogLevel(subsystem, level); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		h.logger.Warn("Log level changed via admin API",
+			zap.String("subsystem", subsystem),
+			zap.String("level", level),
+		)
+		h.auditAdmin(r, "log_level", map[string]string{"subsystem": subsystem, "level": level})
+	default:
+		w.Header().Set("Allow", "GET, PUT, POST")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	global, subsystems := utils.LogLevels()
+	data, err := json.Marshal(map[string]interface{}{
+		"level":      global,
+		"subsystems": subsystems,
+	})
+	if err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+	httputil.WriteJSON(w, data)
+}
+
+// serveAdminReload re-reads the configuration file (POST), the same as
+// sending the server SIGHUP, and reports which changes were applied and
+// which need a restart.
+func (h *Handler) serveAdminReload(w http.ResponseWriter, r *http.Request) {
+	if !h.validateAdminAuth(w, r) {
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if h.reload == nil {
+		http.Error(w, "Configuration reload not available", http.StatusNotImplemented)
+		return
+	}
+
+	result, err := h.reload()
+	if err != nil {
+		http.Error(w, "Reload failed: "+err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	h.auditAdmin(r, "reload", map[string]string{
+		"applied":          strings.Join(result.Applied, ","),
+		"restart_required": strings.Join(result.RestartRequired, ","),
+	})
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+	httputil.WriteJSON(w, data)
+}
+
+// serveAdminPanics lists recently recovered panics with their stacks.
+func (h *Handler) serveAdminPanics(w http.ResponseWriter, r *http.Request) {
+	if !h.validateAdminAuth(w, r) {
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var total uint64
+	panics := []map[string]interface{}{}
+	if h.panicMetrics != nil {
+		total = h.panicMetrics.Total()
+		for _, p := range h.panicMetrics.Recent() {
+			panics = append(panics, map[string]interface{}{
+				"location":  p.Location,
+				"timestamp": p.Timestamp,
+				"value":     fmt.Sprint(p.Value),
+				"stack":     p.Stack,
+			})
+		}
+	}
+
+	data, err := json.Marshal(map[string]interface{}{
+		"total":  total,
+		"recent": panics,
+	})
+	if err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+	httputil.WriteJSON(w, data)
+}
+
+// serveAdminEvents reports the recent history of a tunnel (?subdomain=), or
+// of every tunnel, including ones closed within the last hour. ?type=
+// keeps only events of that type, e.g. heartbeat_missed.
+func (h *Handler) serveAdminEvents(w http.ResponseWriter, r *http.Request) {
+	if !h.validateAdminAuth(w, r) {
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := r.URL.Query()
+	var history map[string][]tunnel.Event
+	if subdomain := q.Get("subdomain"); subdomain != "" {
+		events, ok := h.manager.Events(subdomain)
+		if !ok {
+			http.Error(w, "No history for tunnel "+subdomain, http.StatusNotFound)
+			return
+		}
+		history = map[string][]tunnel.Event{subdomain: events}
+	} else {
+		history = h.manager.EventHistory()
+	}
+
+	if typ := q.Get("type"); typ != "" {
+		for subdomain, events := range history {
+			history[subdomain] = slices.DeleteFunc(events, func(e tunnel.Event) bool {
+				return e.Type != typ
+			})
+		}
+	}
+
+	data, err := json.Marshal(map[string]interface{}{
+		"tunnels": history,
+	})
+	if err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+	httputil.WriteJSON(w, data)
+}
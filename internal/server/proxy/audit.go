@@ -0,0 +1,37 @@
+package proxy
+
+import (
+	"net/http"
+
+	"drip/internal/server/audit"
+	"drip/internal/shared/netutil"
+)
+
+// SetAudit records failed token checks and admin API changes in the
+// audit log.
+func (h *Handler) SetAudit(log *audit.Log) {
+	h.audit = log
+}
+
+// auditAuthFailure records a request to realm (metrics, admin, connect,
+// p2p) that presented a wrong token.
+func (h *Handler) auditAuthFailure(r *http.Request, realm string) {
+	h.audit.Record(audit.Event{
+		Type:   audit.TypeAuthFailure,
+		IP:     netutil.ExtractClientIP(r),
+		Detail: map[string]string{"realm": realm, "path": r.URL.Path},
+	})
+}
+
+// auditAdmin records a change made through the admin API.
+func (h *Handler) auditAdmin(r *http.Request, action string, detail map[string]string) {
+	if detail == nil {
+		detail = map[string]string{}
+	}
+	detail["action"] = action
+	h.audit.Record(audit.Event{
+		Type:   audit.TypeAdmin,
+		IP:     netutil.ExtractClientIP(r),
+		Detail: detail,
+	})
+}
@@ -0,0 +1,121 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"drip/internal/server/tunnel"
+	"drip/internal/shared/protocol"
+)
+
+// newStreamTunnel registers an HTTP tunnel whose client reads each request
+// in full and answers it with respond.
+func newStreamTunnel(t *testing.T, m *tunnel.Manager, name string, respond func(conn net.Conn, req *http.Request)) *tunnel.Connection {
+	t.Helper()
+	if _, err := m.RegisterWithIP(nil, name, "192.0.2.1", "alice", tunnel.SubdomainNaming{}); err != nil {
+		t.Fatalf("RegisterWithIP(%s) = %v", name, err)
+	}
+	tc, _ := m.Get(name)
+	tc.SetTunnelType(protocol.TunnelTypeHTTP)
+	tc.SetOpenStream(func() (net.Conn, error) {
+		server, client := net.Pipe()
+		go func() {
+			defer client.Close()
+			req, err := http.ReadRequest(bufio.NewReader(client))
+			if err != nil {
+				return
+			}
+			if _, err := io.Copy(io.Discard, req.Body); err != nil {
+				return
+			}
+			respond(client, req)
+		}()
+		return server, nil
+	})
+	return tc
+}
+
+func TestForwardRequestBodyLimit(t *testing.T) {
+	m := tunnel.NewManager(zap.NewNop())
+	defer m.Shutdown()
+	var forwarded int
+	tc := newStreamTunnel(t, m, "upload-app", func(conn net.Conn, _ *http.Request) {
+		forwarded++
+		_, _ = io.WriteString(conn, "HTTP/1.1 204 No Content\r\n\r\n")
+	})
+	tc.SetMaxRequestBody(8)
+	h := NewHandler(HandlerConfig{Manager: m, Logger: zap.NewNop()})
+
+	tests := []struct {
+		name    string
+		body    string
+		chunked bool
+		want    int
+	}{
+		{"within limit", "12345678", false, http.StatusNoContent},
+		{"content length over limit", "123456789", false, http.StatusRequestEntityTooLarge},
+		{"chunked within limit", "1234", true, http.StatusNoContent},
+		{"chunked over limit", strings.Repeat("x", 64<<10), true, http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, "http://upload-app.example.com/", strings.NewReader(tt.body))
+		if tt.chunked {
+			// Hide the length, as for a chunked upload.
+			req.Body = io.NopCloser(strings.NewReader(tt.body))
+			req.ContentLength = -1
+		}
+		rec := httptest.NewRecorder()
+		h.ServeTunnel(rec, req, "upload-app")
+		if rec.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.name, rec.Code, tt.want)
+		}
+	}
+	if forwarded != 2 {
+		t.Errorf("tunnel answered %d requests, want only the 2 within the limit", forwarded)
+	}
+}
+
+func TestForwardAbortsCutOffResponse(t *testing.T) {
+	m := tunnel.NewManager(zap.NewNop())
+	defer m.Shutdown()
+	newStreamTunnel(t, m, "large-app", func(conn net.Conn, _ *http.Request) {
+		// A client cutting the body off at --max-response-body ends the
+		// stream before the terminating chunk.
+		_, _ = io.WriteString(conn, "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nhello\r\n")
+	})
+	newStreamTunnel(t, m, "small-app", func(conn net.Conn, _ *http.Request) {
+		_, _ = io.WriteString(conn, "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nhello\r\n0\r\n\r\n")
+	})
+
+	h := NewHandler(HandlerConfig{Manager: m, Logger: zap.NewNop()})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.ServeTunnel(w, r, strings.SplitN(r.Host, ".", 2)[0])
+	}))
+	defer srv.Close()
+
+	get := func(name string) ([]byte, error) {
+		req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+		req.Host = name + ".example.com"
+		resp, err := srv.Client().Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		return io.ReadAll(resp.Body)
+	}
+
+	if body, err := get("small-app"); err != nil || !bytes.Equal(body, []byte("hello")) {
+		t.Errorf("complete response = %q, %v; want hello", body, err)
+	}
+	if body, err := get("large-app"); err == nil {
+		t.Errorf("cut-off response read as complete: %q", body)
+	}
+}
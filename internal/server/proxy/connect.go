@@ -0,0 +1,81 @@
+package proxy
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"drip/internal/server/tunnel"
+	"drip/internal/shared/protocol"
+)
+
+// serveConnect lets 'drip connect' reach a TCP tunnel by name through the
+// server's own port. After authenticating, the request is upgraded and the
+// connection is handed to the tunnel like one on its public port, so IP
+// rules, bandwidth limits and PROXY headers apply the same way. See
+// connectAuthorized for the tokens it takes.
+func (h *Handler) serveConnect(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet || !strings.EqualFold(r.Header.Get("Upgrade"), protocol.ConnectUpgrade) {
+		http.Error(w, "Expected an "+protocol.ConnectUpgrade+" upgrade", http.StatusBadRequest)
+		return
+	}
+	name := r.URL.Query().Get("tunnel")
+	tconn, ok := h.manager.Get(name)
+	if !ok || tconn == nil || tconn.IsClosed() || tconn.GetTunnelType() != protocol.TunnelTypeTCP {
+		http.Error(w, "TCP tunnel not found", http.StatusNotFound)
+		return
+	}
+	if !h.connectAuthorized(tconn, extractBearerToken(r.Header.Get("Authorization"))) {
+		h.auditAuthFailure(r, "connect")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "Connection upgrade not supported", http.StatusInternalServerError)
+		return
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return
+	}
+	// The session must outlive the server's read and write timeouts;
+	// clear them rather than rely on Hijack doing so.
+	_ = conn.SetDeadline(time.Time{})
+	if rw.Reader.Buffered() > 0 {
+		// The consumer must wait for the upgrade before sending data.
+		_ = conn.Close()
+		return
+	}
+
+	_, err = conn.Write([]byte("HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: " + protocol.ConnectUpgrade + "\r\n" +
+		"Connection: Upgrade\r\n\r\n"))
+	if err != nil {
+		_ = conn.Close()
+		return
+	}
+
+	h.logger.Debug("Consumer connected through server",
+		zap.String("tunnel", name),
+		zap.String("remote", r.RemoteAddr),
+	)
+	if !tconn.ServeConn(conn) {
+		_ = conn.Close()
+	}
+}
+
+// connectAuthorized reports whether token may reach tconn through the
+// server: the owner's token always may, the server token only for tunnels
+// that are public anyway. Without either there is no way through.
+func (h *Handler) connectAuthorized(tconn *tunnel.Connection, token string) bool {
+	if tconn.OwnedBy(token) {
+		return true
+	}
+	authToken := h.getAuthToken()
+	return !tconn.IsPrivate() && authToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(authToken)) == 1
+}
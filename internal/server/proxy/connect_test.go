@@ -0,0 +1,149 @@
+package proxy
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"drip/internal/server/tunnel"
+	"drip/internal/shared/protocol"
+)
+
+// newConnectTunnel registers a TCP tunnel owned by token that greets every
+// consumer with "hello" and then echoes.
+func newConnectTunnel(t *testing.T, m *tunnel.Manager, name, token string, private bool) {
+	t.Helper()
+	if _, err := m.RegisterWithIP(nil, name, "192.0.2.1", token, tunnel.SubdomainNaming{}); err != nil {
+		t.Fatalf("RegisterWithIP(%s) = %v", name, err)
+	}
+	tc, _ := m.Get(name)
+	tc.SetTunnelType(protocol.TunnelTypeTCP)
+	tc.SetPrivate(private)
+	tc.SetConnHandler(func(conn net.Conn) {
+		_, _ = conn.Write([]byte("hello"))
+		_, _ = io.Copy(conn, conn)
+	})
+}
+
+// dialConnect asks the server at addr to connect to tunnel and returns the
+// upgrade's status and, once upgraded, the connection to the tunnel and a
+// reader of what the tunnel sent.
+func dialConnect(t *testing.T, addr, name, token string) (int, net.Conn, *bufio.Reader) {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, _ := http.NewRequest(http.MethodGet, "http://"+addr+protocol.ConnectPath+"?tunnel="+name, nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", protocol.ConnectUpgrade)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if err := req.Write(conn); err != nil {
+		t.Fatal(err)
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		conn.Close()
+		return resp.StatusCode, nil, nil
+	}
+	return resp.StatusCode, conn, br
+}
+
+func TestServeConnectPrivateTunnel(t *testing.T) {
+	m := tunnel.NewManager(zap.NewNop())
+	defer m.Shutdown()
+	newConnectTunnel(t, m, "private-db", "alice", true)
+
+	srv := httptest.NewServer(NewHandler(HandlerConfig{Manager: m, Logger: zap.NewNop()}))
+	defer srv.Close()
+	addr := srv.Listener.Addr().String()
+
+	for _, token := range []string{"", "bob"} {
+		if status, _, _ := dialConnect(t, addr, "private-db", token); status != http.StatusUnauthorized {
+			t.Errorf("token %q: status = %d, want %d", token, status, http.StatusUnauthorized)
+		}
+	}
+
+	status, conn, br := dialConnect(t, addr, "private-db", "alice")
+	if status != http.StatusSwitchingProtocols {
+		t.Fatalf("owner token: status = %d, want %d", status, http.StatusSwitchingProtocols)
+	}
+	defer conn.Close()
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 5)
+	if _, err := io.ReadFull(br, buf); err != nil || string(buf) != "hello" {
+		t.Errorf("read %q, %v; want hello", buf, err)
+	}
+}
+
+func TestServeConnectPublicTunnel(t *testing.T) {
+	m := tunnel.NewManager(zap.NewNop())
+	defer m.Shutdown()
+	newConnectTunnel(t, m, "public-db", "alice", false)
+	newConnectTunnel(t, m, "open-db", "", false)
+
+	srv := httptest.NewServer(NewHandler(HandlerConfig{Manager: m, Logger: zap.NewNop(), AuthToken: "server"}))
+	defer srv.Close()
+	addr := srv.Listener.Addr().String()
+
+	tests := []struct {
+		tunnel, token string
+		want          int
+	}{
+		{"public-db", "", http.StatusUnauthorized},
+		{"public-db", "bob", http.StatusUnauthorized},
+		{"public-db", "alice", http.StatusSwitchingProtocols},
+		{"public-db", "server", http.StatusSwitchingProtocols},
+		{"open-db", "", http.StatusUnauthorized},
+		{"missing-db", "server", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		status, conn, _ := dialConnect(t, addr, tt.tunnel, tt.token)
+		if conn != nil {
+			conn.Close()
+		}
+		if status != tt.want {
+			t.Errorf("%s with token %q: status = %d, want %d", tt.tunnel, tt.token, status, tt.want)
+		}
+	}
+}
+
+func TestServeConnectOutlivesServerTimeouts(t *testing.T) {
+	m := tunnel.NewManager(zap.NewNop())
+	defer m.Shutdown()
+	newConnectTunnel(t, m, "private-db", "alice", true)
+
+	srv := httptest.NewUnstartedServer(NewHandler(HandlerConfig{Manager: m, Logger: zap.NewNop()}))
+	srv.Config.ReadTimeout = 100 * time.Millisecond
+	srv.Config.WriteTimeout = 100 * time.Millisecond
+	srv.Start()
+	defer srv.Close()
+
+	status, conn, br := dialConnect(t, srv.Listener.Addr().String(), "private-db", "alice")
+	if status != http.StatusSwitchingProtocols {
+		t.Fatalf("status = %d, want %d", status, http.StatusSwitchingProtocols)
+	}
+	defer conn.Close()
+
+	time.Sleep(300 * time.Millisecond)
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Write([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, len("helloping"))
+	if _, err := io.ReadFull(br, buf); err != nil || string(buf) != "helloping" {
+		t.Errorf("read %q, %v; want the session to outlive the server's timeouts", buf, err)
+	}
+}
@@ -0,0 +1,57 @@
+package proxy
+
+import (
+	"net/http"
+
+	json "github.com/goccy/go-json"
+
+	"drip/internal/server/federation"
+	"drip/internal/shared/httputil"
+	"drip/internal/shared/protocol"
+)
+
+// SetFederation routes requests for subdomains this server does not have to
+// the federated peer that does, and accepts such requests from peers.
+func (h *Handler) SetFederation(router *federation.Router) {
+	h.federation = router
+}
+
+// serveFederationLookup tells a peer whether this server has an HTTP tunnel
+// for ?subdomain=.
+func (h *Handler) serveFederationLookup(w http.ResponseWriter, r *http.Request) {
+	if h.federation == nil || !h.federation.Authorized(r) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	subdomain := r.URL.Query().Get("subdomain")
+	tconn, ok := h.manager.Get(subdomain)
+	if !ok || tconn == nil || tconn.IsClosed() {
+		http.Error(w, "Tunnel not found", http.StatusNotFound)
+		return
+	}
+	if t := tconn.GetTunnelType(); t != protocol.TunnelTypeHTTP && t != protocol.TunnelTypeHTTPS {
+		http.Error(w, "Tunnel not found", http.StatusNotFound)
+		return
+	}
+
+	data, err := json.Marshal(map[string]string{"subdomain": subdomain})
+	if err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+	httputil.WriteJSON(w, data)
+}
+
+// federatedSubdomain returns the subdomain an authorized peer forwarded r
+// for. Federation headers on any other request are dropped.
+func (h *Handler) federatedSubdomain(r *http.Request) (string, bool) {
+	if r.Header.Get(federation.SubdomainHeader) == "" {
+		return "", false
+	}
+	if h.federation == nil || !h.federation.Authorized(r) {
+		federation.StripHeaders(r)
+		return "", false
+	}
+	return h.federation.Accept(r), true
+}
@@ -0,0 +1,34 @@
+package proxy
+
+import (
+	"net/http"
+
+	"drip/internal/server/geoip"
+	"drip/internal/server/metrics"
+)
+
+// CountryHeader carries the visitor's ISO 3166-1 alpha-2 country code to
+// the local service when the server has a GeoIP database. Values sent by
+// visitors are always removed, so the local service can trust it.
+const CountryHeader = "X-Drip-Country"
+
+// SetGeoIP sets the database visitor countries are looked up in, enabling
+// country access rules, the country header and per-country metrics.
+func (h *Handler) SetGeoIP(db *geoip.DB) {
+	h.geoip = db
+}
+
+// visitorCountry looks up the country of the visitor at clientIP, records
+// it and passes it on in CountryHeader. It returns "" if unknown.
+func (h *Handler) visitorCountry(r *http.Request, clientIP string) string {
+	r.Header.Del(CountryHeader)
+	if h.geoip == nil {
+		return ""
+	}
+	country := h.geoip.Country(clientIP)
+	metrics.RecordVisitorCountry(country)
+	if country != "" {
+		r.Header.Set(CountryHeader, country)
+	}
+	return country
+}
@@ -3,24 +3,38 @@ package proxy
 import (
 	"bufio"
 	"crypto/subtle"
+	"errors"
 	"fmt"
 	"io"
+	"math"
 	"net"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
 	"go.uber.org/zap"
 
+	"drip/internal/server/abuse"
+	"drip/internal/server/audit"
+	"drip/internal/server/federation"
+	"drip/internal/server/geoip"
+	"drip/internal/server/hooks"
+	"drip/internal/server/memlimit"
+	"drip/internal/server/p2p"
+	"drip/internal/server/ports"
 	"drip/internal/server/tunnel"
 	"drip/internal/shared/httputil"
 	"drip/internal/shared/netutil"
 	"drip/internal/shared/pool"
 	"drip/internal/shared/protocol"
 	"drip/internal/shared/qos"
+	"drip/internal/shared/recovery"
+	"drip/pkg/config"
 )
 
 // bufio.Reader pool to reduce allocations on hot path
@@ -46,6 +60,7 @@ type Handler struct {
 	logger       *zap.Logger
 	serverDomain string
 	tunnelDomain string
+	tokenMu      sync.RWMutex
 	authToken    string
 	metricsToken string
 	publicPort   int
@@ -57,6 +72,19 @@ type Handler struct {
 	// Server capabilities
 	allowedTransports  []string
 	allowedTunnelTypes []string
+
+	banList      *abuse.BanList
+	portAlloc    *ports.Allocator
+	p2pBroker    *p2p.Broker
+	panicMetrics *recovery.PanicMetrics
+	reload       func() (*config.ReloadResult, error)
+
+	maxHeaderListSize int
+	maxRequestBody    atomic.Int64
+	hooks             hooks.Hooks
+	federation        *federation.Router
+	audit             *audit.Log
+	geoip             *geoip.DB
 }
 
 // WSConnectionHandler handles WebSocket tunnel connections
@@ -82,11 +110,44 @@ func NewHandler(cfg HandlerConfig) *Handler {
 	}
 }
 
+// SetTokens replaces the server and metrics tokens, e.g. on a config
+// reload.
+func (h *Handler) SetTokens(authToken, metricsToken string) {
+	h.tokenMu.Lock()
+	defer h.tokenMu.Unlock()
+	h.authToken, h.metricsToken = authToken, metricsToken
+}
+
+func (h *Handler) getAuthToken() string {
+	h.tokenMu.RLock()
+	defer h.tokenMu.RUnlock()
+	return h.authToken
+}
+
+func (h *Handler) getMetricsToken() string {
+	h.tokenMu.RLock()
+	defer h.tokenMu.RUnlock()
+	return h.metricsToken
+}
+
 // SetWSConnectionHandler sets the handler for WebSocket tunnel connections
 func (h *Handler) SetWSConnectionHandler(handler WSConnectionHandler) {
 	h.wsConnHandler = handler
 }
 
+// SetMaxHeaderListSize bounds the response headers a tunnel client may
+// send back. Zero uses httputil.DefaultMaxHeaderListSize.
+func (h *Handler) SetMaxHeaderListSize(size int) {
+	h.maxHeaderListSize = size
+}
+
+// SetMaxRequestBody bounds the body of each request forwarded to a
+// tunnel; larger ones are answered with a 413. Zero means no limit. It may
+// be called while the handler serves, e.g. on a config reload.
+func (h *Handler) SetMaxRequestBody(size int64) {
+	h.maxRequestBody.Store(size)
+}
+
 // SetPublicPort sets the public port for URL generation
 func (h *Handler) SetPublicPort(port int) {
 	h.publicPort = port
@@ -164,19 +225,99 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		h.serveMetrics(w, r)
 		return
 	}
-
-	subdomain, result := h.extractSubdomain(r.Host)
-	switch result {
-	case subdomainHome:
-		h.serveHomePage(w, r)
+	if r.URL.Path == "/_drip/admin/bans" {
+		h.serveAdminBans(w, r)
 		return
-	case subdomainNotFound:
-		h.serveTunnelNotFound(w, r)
+	}
+	if r.URL.Path == "/_drip/admin/ports" {
+		h.serveAdminPorts(w, r)
+		return
+	}
+	if r.URL.Path == "/_drip/admin/log-level" {
+		h.serveAdminLogLevel(w, r)
+		return
+	}
+	if r.URL.Path == "/_drip/admin/reload" {
+		h.serveAdminReload(w, r)
+		return
+	}
+	if r.URL.Path == "/_drip/admin/panics" {
+		h.serveAdminPanics(w, r)
+		return
+	}
+	if r.URL.Path == "/_drip/admin/events" {
+		h.serveAdminEvents(w, r)
+		return
+	}
+	if r.URL.Path == "/_drip/p2p/connect" {
+		h.serveP2PConnect(w, r)
+		return
+	}
+	if r.URL.Path == "/_drip/p2p/announce" {
+		h.serveP2PAnnounce(w, r)
+		return
+	}
+	if r.URL.Path == protocol.ConnectPath {
+		h.serveConnect(w, r)
+		return
+	}
+	if r.URL.Path == protocol.ReplayPath {
+		h.serveReplay(w, r)
+		return
+	}
+	if r.URL.Path == federation.LookupPath {
+		h.serveFederationLookup(w, r)
 		return
 	}
 
+	subdomain, federated := h.federatedSubdomain(r)
+	if !federated {
+		var result subdomainResult
+		subdomain, result = h.extractSubdomain(r.Host)
+		switch result {
+		case subdomainHome:
+			h.serveHomePage(w, r)
+			return
+		case subdomainNotFound:
+			h.serveTunnelNotFound(w, r)
+			return
+		}
+	}
+
+	h.serveTunnel(w, r, subdomain, federated)
+}
+
+// ServeTunnel serves r from the tunnel named subdomain whatever its Host,
+// for listeners that give a tunnel an address of its own. Unlike ServeHTTP
+// it leaves the server's own endpoints to the tunnel.
+func (h *Handler) ServeTunnel(w http.ResponseWriter, r *http.Request, subdomain string) {
+	h.serveTunnel(w, r, subdomain, false)
+}
+
+// serveTunnel applies the access rules of the tunnel named subdomain to r
+// and forwards it there. federated is set for requests a federated server
+// passed on.
+func (h *Handler) serveTunnel(w http.ResponseWriter, r *http.Request, subdomain string, federated bool) {
+	clientIP := netutil.ExtractClientIP(r)
+	country := h.visitorCountry(r, clientIP)
+
+	if h.hooks != nil {
+		var ok bool
+		if subdomain, ok = h.runRequestHook(w, r, subdomain, country); !ok {
+			return
+		}
+	}
+
 	tconn, ok := h.manager.Get(subdomain)
 	if !ok || tconn == nil {
+		switch {
+		case federated:
+			w.Header().Set(federation.MissHeader, "1")
+		case h.federation != nil && h.federation.Forward(w, r, subdomain):
+			return
+		case h.storeOffline(w, r, subdomain):
+			return
+		}
 		h.serveTunnelNotFound(w, r)
 		return
 	}
@@ -184,18 +325,46 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Tunnel connection closed", http.StatusBadGateway)
 		return
 	}
+	if tconn.IsPaused() {
+		h.serveTunnelPaused(w, r)
+		return
+	}
+	if sched := tconn.Schedule(); sched != nil && !sched.Open(time.Now()) {
+		h.serveTunnelOffline(w, r, sched)
+		return
+	}
 
-	if tconn.HasIPAccessControl() {
-		clientIP := netutil.ExtractClientIP(r)
-		if !tconn.IsIPAllowed(clientIP) {
-			http.Error(w, "Access denied: your IP is not allowed", http.StatusForbidden)
-			return
-		}
+	edgePolicy := tconn.EdgePolicy()
+	if edgePolicy != nil && !edgePolicy.Satisfied(netutil.RequestTLSState(r), r.Host) {
+		// Mostly a connection the browser set up for another tunnel and
+		// reused for this one; 421 makes it retry on a connection of its
+		// own, whose handshake the tunnel's policy applies to.
+		http.Error(w, "Misdirected request", http.StatusMisdirectedRequest)
+		return
 	}
 
-	if auth := tconn.GetProxyAuth(); auth != nil && auth.Enabled {
-		clientIP := netutil.ExtractClientIP(r)
+	if tconn.HasIPAccessControl() && !tconn.IsIPAllowed(clientIP) {
+		http.Error(w, "Access denied: your IP is not allowed", http.StatusForbidden)
+		return
+	}
+
+	if tconn.HasCountryAccess() && !tconn.IsCountryAllowed(country) {
+		http.Error(w, "Access denied: your country is not allowed", http.StatusForbidden)
+		return
+	}
+
+	if ok, retryAfter := tconn.AllowVisitor(clientIP); !ok {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		http.Error(w, "Too many requests", http.StatusTooManyRequests)
+		return
+	}
+
+	if tconn.HasRequestRules() && !tconn.IsRequestAllowed(r) {
+		http.Error(w, "Request blocked by tunnel rules", http.StatusForbidden)
+		return
+	}
 
+	if auth := tconn.GetProxyAuth(); auth != nil && auth.Enabled {
 		if authLimiter.isRateLimited(clientIP) {
 			w.Header().Set("Retry-After", "60")
 			http.Error(w, "Too many failed authentication attempts. Please try again later.", http.StatusTooManyRequests)
@@ -232,26 +401,131 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if store := tconn.RequestStore(); store != nil && !h.isWebSocketUpgrade(r) {
+		id, err := store.Record(r, false)
+		if err != nil {
+			http.Error(w, "Read request failed", http.StatusBadRequest)
+			return
+		}
+		store.SetStatus(id, h.forward(w, r, tconn, subdomain))
+		return
+	}
+	h.forward(w, r, tconn, subdomain)
+}
+
+// requestBodyLimit returns the largest request body forwarded to tconn:
+// the server's limit, or the tunnel's own if that is lower.
+func (h *Handler) requestBodyLimit(tconn *tunnel.Connection) int64 {
+	limit := h.maxRequestBody.Load()
+	if own := tconn.MaxRequestBody(); own > 0 && (limit == 0 || own < limit) {
+		return own
+	}
+	return limit
+}
+
+// requestBody records why reading a request body failed, which
+// Request.Write does not tell apart from a failed write to the tunnel.
+type requestBody struct {
+	io.ReadCloser
+	err error
+}
+
+func (b *requestBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil && err != io.EOF && b.err == nil {
+		b.err = err
+	}
+	return n, err
+}
+
+// writeBodyError answers a request whose body could not be read because of
+// err, when the visitor is to blame: the body was over the size limit or
+// sent too slowly. It returns the status sent, or 0 for other errors.
+func writeBodyError(w http.ResponseWriter, err error) int {
+	var tooLarge *http.MaxBytesError
+	var netErr net.Error
+	switch {
+	case errors.Is(err, httputil.ErrSignedBodyTooLarge), errors.As(err, &tooLarge):
+		http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+		return http.StatusRequestEntityTooLarge
+	case errors.As(err, &netErr) && netErr.Timeout():
+		http.Error(w, "Request body timed out", http.StatusRequestTimeout)
+		return http.StatusRequestTimeout
+	}
+	return 0
+}
+
+// forward sends r to the tunnel and copies the response to w, returning
+// its status. Once a stream is opened its stats are passed to the
+// tunnel's stream watchers.
+func (h *Handler) forward(w http.ResponseWriter, r *http.Request, tconn *tunnel.Connection, subdomain string) (status int) {
+	// Shed load before opening a stream whose buffers we cannot afford.
+	budget := tconn.MemoryBudget()
+	if err := budget.Reserve(memlimit.StreamCost); err != nil {
+		h.logger.Debug("Request shed by memory budget",
+			zap.String("subdomain", subdomain),
+			zap.Error(err),
+		)
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, "Server is busy, please retry", http.StatusServiceUnavailable)
+		return http.StatusServiceUnavailable
+	}
+	defer budget.Release(memlimit.StreamCost)
+
+	body := &requestBody{ReadCloser: r.Body}
+	if limit := h.requestBodyLimit(tconn); limit > 0 {
+		if r.ContentLength > limit {
+			http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+			return http.StatusRequestEntityTooLarge
+		}
+		// Bodies of unknown length are cut off while they are forwarded.
+		body.ReadCloser = http.MaxBytesReader(w, r.Body, limit)
+	}
+	if r.Body != nil && r.Body != http.NoBody {
+		r.Body = body
+	}
+
+	if secret := tconn.SigningSecret(); secret != nil {
+		if err := httputil.SignRequest(r, secret, time.Now()); err != nil {
+			if status := writeBodyError(w, err); status != 0 {
+				return status
+			}
+			http.Error(w, "Read request failed", http.StatusBadRequest)
+			return http.StatusBadRequest
+		}
+	}
+
 	if h.isWebSocketUpgrade(r) {
 		h.handleWebSocket(w, r, tconn)
-		return
+		return http.StatusSwitchingProtocols
 	}
 
 	stream, err := h.openStreamWithTimeout(tconn)
 	if err != nil {
 		httputil.SetCloseConnection(w)
 		http.Error(w, "Tunnel unavailable", http.StatusBadGateway)
-		return
+		return http.StatusBadGateway
 	}
 	defer stream.Close()
 
 	tconn.IncActiveConnections()
 	defer tconn.DecActiveConnections()
 
-	var limitedStream net.Conn = stream
+	counter := netutil.NewStreamCounter(stream)
+	start := time.Now()
+	defer func() {
+		stats := tunnel.NewStreamStats(counter, start)
+		stats.Method = r.Method
+		stats.Path = r.URL.Path
+		stats.Status = status
+		stats.RemoteAddr = netutil.ExtractClientIP(r)
+		tconn.RecordStream(stats)
+	}()
+
+	var limitedStream net.Conn = counter
 	if limiter := tconn.GetLimiter(); limiter != nil && limiter.IsLimited() {
 		if l, ok := limiter.(*qos.Limiter); ok {
-			limitedStream = qos.NewLimitedConn(r.Context(), stream, l)
+			limitedStream = qos.NewLimitedConn(r.Context(), counter, l)
 		}
 	}
 
@@ -260,28 +534,50 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		tconn.AddBytesIn,
 	)
 
+	netutil.SetForwardedHeaders(r)
 	if err := r.Write(countingStream); err != nil {
 		httputil.SetCloseConnection(w)
 		_ = r.Body.Close()
+		if status := writeBodyError(w, body.err); status != 0 {
+			return status
+		}
 		http.Error(w, "Forward failed", http.StatusBadGateway)
-		return
+		return http.StatusBadGateway
 	}
 
+	headerLimit := httputil.NewHeaderLimitReader(countingStream, h.maxHeaderListSize)
 	reader := bufioReaderPool.Get().(*bufio.Reader)
-	reader.Reset(countingStream)
+	reader.Reset(headerLimit)
 	resp, err := http.ReadResponse(reader, r)
 	if err != nil {
 		bufioReaderPool.Put(reader)
 		httputil.SetCloseConnection(w)
+		if errors.Is(err, httputil.ErrHeaderListTooLarge) {
+			h.logger.Warn("Tunnel response headers too large",
+				zap.String("subdomain", subdomain),
+			)
+			http.Error(w, "Response headers too large", http.StatusBadGateway)
+			return http.StatusBadGateway
+		}
 		http.Error(w, "Read response failed", http.StatusBadGateway)
-		return
+		return http.StatusBadGateway
+	}
+	headerLimit.Done()
+
+	if resp.Header.Get(httputil.StreamEncodingHeader) == httputil.StreamEncodingDeflate {
+		resp.Body = httputil.NewStreamDecompressor(resp.Body)
+		resp.ContentLength = -1
 	}
+	resp.Header.Del(httputil.StreamEncodingHeader)
 	defer func() {
 		resp.Body.Close()
 		bufioReaderPool.Put(reader)
 	}()
 
 	h.copyResponseHeaders(w.Header(), resp.Header, r.Host)
+	if edgePolicy := tconn.EdgePolicy(); edgePolicy != nil && edgePolicy.HSTS() != "" {
+		w.Header().Set("Strict-Transport-Security", edgePolicy.HSTS())
+	}
 
 	statusCode := resp.StatusCode
 	if statusCode == 0 {
@@ -295,7 +591,7 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			w.Header().Del("Content-Length")
 		}
 		w.WriteHeader(statusCode)
-		return
+		return statusCode
 	}
 
 	if resp.ContentLength >= 0 {
@@ -304,8 +600,22 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		w.Header().Del("Content-Length")
 	}
 
+	if len(resp.Trailer) > 0 {
+		w.Header().Set("Trailer", httputil.TrailerKeys(resp.Trailer))
+	}
+
 	w.WriteHeader(statusCode)
 
+	var dst io.Writer = w
+	if httputil.IsStreamingResponse(resp) {
+		rc := http.NewResponseController(w)
+		if httputil.IsStreamingContentType(resp.Header.Get("Content-Type")) {
+			_ = rc.SetWriteDeadline(time.Time{})
+		}
+		_ = rc.Flush()
+		dst = &flushWriter{w: w, rc: rc}
+	}
+
 	// Use pooled buffer for zero-copy optimization
 	buf := pool.GetBuffer(pool.SizeLarge)
 	defer pool.PutBuffer(buf)
@@ -321,8 +631,61 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		}
 	}()
 
-	_, _ = io.CopyBuffer(w, resp.Body, (*buf)[:])
+	src := &errReader{r: resp.Body}
+	_, err = io.CopyBuffer(dst, src, (*buf)[:])
 	close(copyDone)
+
+	if src.err != nil && ctx.Err() == nil {
+		// The body was cut off, e.g. at the client's response body limit.
+		// Abort rather than let the visitor take it for the whole one.
+		h.logger.Debug("Tunnel response body cut off",
+			zap.String("subdomain", subdomain),
+			zap.Error(src.err),
+		)
+		status = http.StatusBadGateway
+		if _, replay := w.(*statusRecorder); !replay {
+			panic(http.ErrAbortHandler)
+		}
+		return status
+	}
+
+	// resp.Trailer is only populated once the body has been fully read.
+	if err == nil {
+		for k, vv := range resp.Trailer {
+			w.Header()[http.CanonicalHeaderKey(k)] = vv
+		}
+	}
+	return statusCode
+}
+
+// errReader remembers the error its reader failed with, to tell a body
+// cut off by the tunnel from a visitor that went away.
+type errReader struct {
+	r   io.Reader
+	err error
+}
+
+func (e *errReader) Read(p []byte) (int, error) {
+	n, err := e.r.Read(p)
+	if err != nil && err != io.EOF {
+		e.err = err
+	}
+	return n, err
+}
+
+// flushWriter flushes the underlying ResponseWriter after every write so
+// streamed events reach the visitor as soon as they arrive from the tunnel.
+type flushWriter struct {
+	w  io.Writer
+	rc *http.ResponseController
+}
+
+func (f *flushWriter) Write(p []byte) (int, error) {
+	n, err := f.w.Write(p)
+	if err == nil {
+		_ = f.rc.Flush()
+	}
+	return n, err
 }
 
 func (h *Handler) openStreamWithTimeout(tconn *tunnel.Connection) (net.Conn, error) {
@@ -348,6 +711,7 @@ func (h *Handler) openStreamWithTimeout(tconn *tunnel.Connection) (net.Conn, err
 				r.stream.Close()
 			}
 		}()
+		tconn.RecordEvent(tunnel.EventStreamError, "open stream timeout")
 		return nil, fmt.Errorf("open stream timeout")
 	}
 }
@@ -414,9 +778,7 @@ const (
 )
 
 func (h *Handler) extractSubdomain(host string) (string, subdomainResult) {
-	if idx := strings.Index(host, ":"); idx != -1 {
-		host = host[:idx]
-	}
+	host = netutil.StripPort(host)
 
 	if host == h.serverDomain {
 		return "", subdomainHome
@@ -435,13 +797,15 @@ func (h *Handler) extractSubdomain(host string) (string, subdomainResult) {
 }
 
 func (h *Handler) validateMetricsAuth(w http.ResponseWriter, r *http.Request, realm string) bool {
-	if h.metricsToken == "" {
+	metricsToken := h.getMetricsToken()
+	if metricsToken == "" {
 		return true
 	}
 
 	token := extractBearerToken(r.Header.Get("Authorization"))
 
-	if subtle.ConstantTimeCompare([]byte(token), []byte(h.metricsToken)) != 1 {
+	if subtle.ConstantTimeCompare([]byte(token), []byte(metricsToken)) != 1 {
+		h.auditAuthFailure(r, realm)
 		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s"`, realm))
 		http.Error(w, "Unauthorized: provide metrics token via 'Authorization: Bearer <token>' header", http.StatusUnauthorized)
 		return false
@@ -0,0 +1,61 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+
+	"go.uber.org/zap"
+
+	"drip/internal/server/hooks"
+	"drip/internal/shared/netutil"
+)
+
+// SetHooks lets an extension deny or reroute visitor requests.
+func (h *Handler) SetHooks(hk hooks.Hooks) {
+	h.hooks = hk
+}
+
+// runRequestHook returns the subdomain to serve the request from, or false
+// if the hook already answered it.
+func (h *Handler) runRequestHook(w http.ResponseWriter, r *http.Request, subdomain, country string) (string, bool) {
+	ctx, cancel := context.WithTimeout(r.Context(), hooks.DefaultWebhookTimeout)
+	defer cancel()
+
+	decision, err := h.hooks.OnRequest(ctx, &hooks.RequestEvent{
+		Subdomain: subdomain,
+		Method:    r.Method,
+		Host:      r.Host,
+		Path:      r.URL.Path,
+		RemoteIP:  netutil.ExtractClientIP(r),
+		Country:   country,
+		Header:    r.Header,
+	})
+	if err != nil {
+		h.logger.Warn("Request hook failed",
+			zap.String("subdomain", subdomain),
+			zap.Error(err),
+		)
+		http.Error(w, "Service unavailable", http.StatusServiceUnavailable)
+		return "", false
+	}
+	if decision == nil {
+		return subdomain, true
+	}
+
+	if decision.Deny {
+		status := decision.Status
+		if status < 400 || status > 599 {
+			status = http.StatusForbidden
+		}
+		reason := decision.Reason
+		if reason == "" {
+			reason = http.StatusText(status)
+		}
+		http.Error(w, reason, status)
+		return "", false
+	}
+	if decision.Subdomain != "" {
+		return decision.Subdomain, true
+	}
+	return subdomain, true
+}
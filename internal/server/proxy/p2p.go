@@ -0,0 +1,105 @@
+package proxy
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"time"
+
+	json "github.com/goccy/go-json"
+
+	"drip/internal/server/p2p"
+	"drip/internal/shared/httputil"
+	"drip/internal/shared/netutil"
+	"drip/internal/shared/protocol"
+)
+
+// p2pRendezvousTimeout bounds how long a consumer waits for the exposing
+// client to announce itself before falling back to the relay.
+const p2pRendezvousTimeout = 5 * time.Second
+
+// SetP2PBroker enables the direct connection rendezvous endpoints.
+func (h *Handler) SetP2PBroker(broker *p2p.Broker) {
+	h.p2pBroker = broker
+}
+
+// serveP2PConnect pairs a consumer with the exposing client of a TCP tunnel.
+// The observed remote address is what the peer will punch towards, so it
+// must not come from forwarding headers.
+func (h *Handler) serveP2PConnect(w http.ResponseWriter, r *http.Request) {
+	var req protocol.P2PConnectRequest
+	if !h.decodeP2PRequest(w, r, &req) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), p2pRendezvousTimeout)
+	defer cancel()
+
+	match, err := h.p2pBroker.Connect(ctx, req.Port, r.RemoteAddr, netutil.ExtractIP(r.RemoteAddr))
+	switch {
+	case errors.Is(err, p2p.ErrNoPeer):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case errors.Is(err, p2p.ErrDenied):
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	case err != nil:
+		http.Error(w, "Peer did not respond", http.StatusGatewayTimeout)
+		return
+	}
+
+	h.writeP2PResponse(w, match)
+}
+
+// serveP2PAnnounce completes an offer with the exposing client's address.
+func (h *Handler) serveP2PAnnounce(w http.ResponseWriter, r *http.Request) {
+	var req protocol.P2PAnnounceRequest
+	if !h.decodeP2PRequest(w, r, &req) {
+		return
+	}
+
+	peerAddr, err := h.p2pBroker.Announce(req.ID, r.RemoteAddr)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	h.writeP2PResponse(w, &protocol.P2PRendezvousResponse{PeerAddr: peerAddr})
+}
+
+func (h *Handler) decodeP2PRequest(w http.ResponseWriter, r *http.Request, out any) bool {
+	if h.p2pBroker == nil {
+		http.Error(w, "Direct connections are disabled on this server", http.StatusNotFound)
+		return false
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return false
+	}
+	if authToken := h.getAuthToken(); authToken != "" {
+		token := extractBearerToken(r.Header.Get("Authorization"))
+		if subtle.ConstantTimeCompare([]byte(token), []byte(authToken)) != 1 {
+			h.auditAuthFailure(r, "p2p")
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return false
+		}
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, 4096)
+	if err := json.NewDecoder(r.Body).Decode(out); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+func (h *Handler) writeP2PResponse(w http.ResponseWriter, resp *protocol.P2PRendezvousResponse) {
+	data, err := json.Marshal(resp)
+	if err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+	httputil.WriteJSON(w, data)
+}
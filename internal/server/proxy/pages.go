@@ -1,6 +1,7 @@
 package proxy
 
 import (
+	"html"
 	"net/http"
 	"time"
 
@@ -8,6 +9,8 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 
 	"drip/internal/shared/httputil"
+	"drip/internal/shared/labels"
+	"drip/internal/shared/schedule"
 )
 
 func (h *Handler) serveHomePage(w http.ResponseWriter, r *http.Request) {
@@ -209,6 +212,103 @@ func (h *Handler) serveTunnelNotFound(w http.ResponseWriter, r *http.Request) {
 	httputil.WriteHTMLWithStatus(w, []byte(html), http.StatusNotFound)
 }
 
+// pausedRetryAfter is the Retry-After sent with the paused page, in seconds.
+const pausedRetryAfter = "60"
+
+func (h *Handler) serveTunnelPaused(w http.ResponseWriter, r *http.Request) {
+	html := `<!DOCTYPE html>
+<html lang="en">
+<head>
+	<meta charset="UTF-8" />
+	<meta name="viewport" content="width=device-width, initial-scale=1.0" />
+	<title>503 - Tunnel Paused</title>
+	` + faviconLink + `
+	<style>
+		* { margin: 0; padding: 0; box-sizing: border-box; }
+		body {
+			font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, sans-serif;
+			background: #fff;
+			color: #24292f;
+			line-height: 1.6;
+		}
+		.container { max-width: 720px; margin: 0 auto; padding: 48px 24px; }
+		header { margin-bottom: 48px; }
+		h1 { font-size: 28px; font-weight: 600; margin-bottom: 8px; }
+		h1 span { margin-right: 8px; }
+		.desc { color: #57606a; font-size: 16px; }
+		p { margin-bottom: 16px; }
+		footer { margin-top: 48px; padding-top: 24px; border-top: 1px solid #d0d7de; }
+		footer a { color: #57606a; text-decoration: none; font-size: 14px; }
+		footer a:hover { color: #0969da; }
+	</style>
+</head>
+<body>
+	<div class="container">
+		<header>
+			<h1><span>⏸</span>Tunnel Paused</h1>
+			<p class="desc">The owner of this tunnel has paused it for a moment.</p>
+		</header>
+
+		<p>The address stays the same. Please try again in a little while.</p>
+
+		<footer>
+			<a href="https://github.com/Gouryella/drip" target="_blank">GitHub</a>
+		</footer>
+	</div>
+</body>
+</html>`
+
+	w.Header().Set("Retry-After", pausedRetryAfter)
+	httputil.WriteHTMLWithStatus(w, []byte(html), http.StatusServiceUnavailable)
+}
+
+// serveTunnelOffline answers visitors of a tunnel outside its schedule.
+func (h *Handler) serveTunnelOffline(w http.ResponseWriter, r *http.Request, sched *schedule.Schedule) {
+	page := `<!DOCTYPE html>
+<html lang="en">
+<head>
+	<meta charset="UTF-8" />
+	<meta name="viewport" content="width=device-width, initial-scale=1.0" />
+	<title>503 - Tunnel Offline</title>
+	` + faviconLink + `
+	<style>
+		* { margin: 0; padding: 0; box-sizing: border-box; }
+		body {
+			font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, sans-serif;
+			background: #fff;
+			color: #24292f;
+			line-height: 1.6;
+		}
+		.container { max-width: 720px; margin: 0 auto; padding: 48px 24px; }
+		header { margin-bottom: 48px; }
+		h1 { font-size: 28px; font-weight: 600; margin-bottom: 8px; }
+		h1 span { margin-right: 8px; }
+		.desc { color: #57606a; font-size: 16px; }
+		p { margin-bottom: 16px; }
+		footer { margin-top: 48px; padding-top: 24px; border-top: 1px solid #d0d7de; }
+		footer a { color: #57606a; text-decoration: none; font-size: 14px; }
+		footer a:hover { color: #0969da; }
+	</style>
+</head>
+<body>
+	<div class="container">
+		<header>
+			<h1><span>🌙</span>Tunnel Offline</h1>
+			<p class="desc">This tunnel is only available at scheduled times.</p>
+		</header>
+
+		<p>It is available <strong>` + html.EscapeString(sched.String()) + `</strong>. The address stays the same; please come back then.</p>
+
+		<footer>
+			<a href="https://github.com/Gouryella/drip" target="_blank">GitHub</a>
+		</footer>
+	</div>
+</body>
+</html>`
+
+	httputil.WriteHTMLWithStatus(w, []byte(page), http.StatusServiceUnavailable)
+}
+
 func (h *Handler) serveHealth(w http.ResponseWriter, r *http.Request) {
 	health := map[string]interface{}{
 		"status":         "ok",
@@ -230,11 +330,18 @@ func (h *Handler) serveStats(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// ?label=team=payments, repeatable, lists only tunnels with those labels.
+	selector, err := labels.Parse(r.URL.Query()["label"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	connections := h.manager.List()
 
 	tunnelStats := make([]map[string]interface{}, 0, len(connections))
 	for _, conn := range connections {
-		if conn == nil {
+		if conn == nil || !labels.Match(conn.Labels(), selector) {
 			continue
 		}
 		tunnelStats = append(tunnelStats, map[string]interface{}{
@@ -245,6 +352,11 @@ func (h *Handler) serveStats(w http.ResponseWriter, r *http.Request) {
 			"bytes_out":          conn.GetBytesOut(),
 			"active_connections": conn.GetActiveConnections(),
 			"total_bytes":        conn.GetBytesIn() + conn.GetBytesOut(),
+			"paused":             conn.IsPaused(),
+			"outside_schedule":   conn.OutsideSchedule(),
+			"labels":             conn.Labels(),
+			"last_event":         conn.LastEvent(),
+			"client":             conn.ClientState(),
 		})
 	}
 
@@ -278,7 +390,7 @@ func (h *Handler) serveDiscovery(w http.ResponseWriter, r *http.Request) {
 
 	tunnelTypes := h.allowedTunnelTypes
 	if len(tunnelTypes) == 0 {
-		tunnelTypes = []string{"http", "https", "tcp"}
+		tunnelTypes = []string{"http", "https", "tcp", "tls"}
 	}
 
 	response := map[string]interface{}{
@@ -0,0 +1,119 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+
+	"drip/internal/server/tunnel"
+	"drip/internal/shared/httputil"
+	"drip/internal/shared/protocol"
+)
+
+// serveReplay lets 'drip replay' list the requests a tunnel's request
+// store kept (GET ?tunnel=) and send one to the tunnel again (POST
+// ?tunnel=&id=). The store outlives the tunnel's connection, so requests
+// that arrived while the client was restarting can be replayed once it is
+// back. Only the token the tunnel registered with may use its store.
+func (h *Handler) serveReplay(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("tunnel")
+	store, ok := h.manager.RequestStore(name)
+	if !ok || !store.Authorized(extractBearerToken(r.Header.Get("Authorization"))) {
+		// Unknown tunnels look the same as other owners' tunnels.
+		h.auditAuthFailure(r, "replay")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var result interface{}
+	switch r.Method {
+	case http.MethodGet:
+		result = store.List()
+	case http.MethodPost:
+		id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid request id", http.StatusBadRequest)
+			return
+		}
+		res, status, err := h.replayStored(r, name, store, id)
+		if err != nil {
+			http.Error(w, err.Error(), status)
+			return
+		}
+		result = res
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+	httputil.WriteJSON(w, data)
+}
+
+// storeOffline keeps a request for a tunnel that is away, if its store
+// accepts them, and answers it with 503 so senders that retry do.
+func (h *Handler) storeOffline(w http.ResponseWriter, r *http.Request, subdomain string) bool {
+	store, ok := h.manager.RequestStore(subdomain)
+	if !ok || !store.AcceptsOffline() || h.isWebSocketUpgrade(r) || r.Method == http.MethodConnect {
+		return false
+	}
+	id, err := store.Record(r, true)
+	if err != nil {
+		http.Error(w, "Read request failed", http.StatusBadRequest)
+		return true
+	}
+	store.SetStatus(id, http.StatusServiceUnavailable)
+	w.Header().Set("Retry-After", "30")
+	http.Error(w, "Tunnel offline; the request was stored for replay", http.StatusServiceUnavailable)
+	return true
+}
+
+// replayStored sends stored request id to the tunnel. On failure it
+// returns the status to answer the replay request with.
+func (h *Handler) replayStored(r *http.Request, name string, store *tunnel.RequestStore, id int64) (*protocol.ReplayResult, int, error) {
+	tconn, ok := h.manager.Get(name)
+	if !ok || tconn == nil || tconn.IsClosed() {
+		return nil, http.StatusConflict, errors.New("tunnel is offline")
+	}
+	req, err := store.Request(r.Context(), id)
+	switch {
+	case errors.Is(err, tunnel.ErrStoredRequestNotFound):
+		return nil, http.StatusNotFound, err
+	case err != nil:
+		return nil, http.StatusUnprocessableEntity, err
+	}
+
+	start := time.Now()
+	rw := &statusRecorder{header: make(http.Header)}
+	status := h.forward(rw, req, tconn, name)
+	store.SetStatus(id, status)
+
+	h.logger.Info("Replayed stored request",
+		zap.String("subdomain", name),
+		zap.Int64("id", id),
+		zap.Int("status", status),
+	)
+	return &protocol.ReplayResult{
+		Status:     status,
+		DurationMs: time.Since(start).Milliseconds(),
+	}, 0, nil
+}
+
+// statusRecorder is the ResponseWriter replayed requests are forwarded
+// to. The response goes nowhere; only its status is reported back.
+type statusRecorder struct {
+	header http.Header
+}
+
+func (s *statusRecorder) Header() http.Header         { return s.header }
+func (s *statusRecorder) Write(p []byte) (int, error) { return len(p), nil }
+func (s *statusRecorder) WriteHeader(int)             {}
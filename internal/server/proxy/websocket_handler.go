@@ -52,6 +52,7 @@ func (h *Handler) handleWebSocket(w http.ResponseWriter, r *http.Request, tconn
 		return
 	}
 
+	netutil.SetForwardedHeaders(r)
 	if err := r.Write(stream); err != nil {
 		stream.Close()
 		clientConn.Close()
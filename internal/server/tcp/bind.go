@@ -0,0 +1,49 @@
+package tcp
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// BindAny as a bind address listens on every interface with a single
+// dual-stack socket. A literal 0.0.0.0 or :: binds only that family.
+const BindAny = "*"
+
+// DefaultBindAddrs is where TCP tunnel ports listen unless configured.
+var DefaultBindAddrs = []string{"0.0.0.0"}
+
+// ValidateBindAddrs checks that every address is BindAny or an IP literal.
+func ValidateBindAddrs(addrs []string) error {
+	for _, addr := range addrs {
+		if _, _, err := bindNetwork(addr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// listenBind listens on port at addr, choosing the socket family from the
+// address so that IPv6 wildcards stay IPv6-only.
+func listenBind(addr string, port int) (net.Listener, error) {
+	network, host, err := bindNetwork(addr)
+	if err != nil {
+		return nil, err
+	}
+	return net.Listen(network, net.JoinHostPort(host, strconv.Itoa(port)))
+}
+
+func bindNetwork(addr string) (network, host string, err error) {
+	if addr == BindAny {
+		return "tcp", "", nil
+	}
+	ip := net.ParseIP(strings.Trim(addr, "[]"))
+	if ip == nil {
+		return "", "", fmt.Errorf("invalid bind address %q: must be an IP or %q", addr, BindAny)
+	}
+	if ip.To4() != nil {
+		return "tcp4", ip.String(), nil
+	}
+	return "tcp6", ip.String(), nil
+}
@@ -0,0 +1,31 @@
+package tcp
+
+import "testing"
+
+func TestBindNetwork(t *testing.T) {
+	tests := []struct {
+		addr        string
+		wantNetwork string
+		wantHost    string
+		wantErr     bool
+	}{
+		{"*", "tcp", "", false},
+		{"0.0.0.0", "tcp4", "0.0.0.0", false},
+		{"203.0.113.5", "tcp4", "203.0.113.5", false},
+		{"::", "tcp6", "::", false},
+		{"[2001:db8::1]", "tcp6", "2001:db8::1", false},
+		{"eth0", "", "", true},
+		{"", "", "", true},
+	}
+
+	for _, tt := range tests {
+		network, host, err := bindNetwork(tt.addr)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("bindNetwork(%q) error = %v, wantErr %v", tt.addr, err, tt.wantErr)
+			continue
+		}
+		if network != tt.wantNetwork || host != tt.wantHost {
+			t.Errorf("bindNetwork(%q) = %q, %q, want %q, %q", tt.addr, network, host, tt.wantNetwork, tt.wantHost)
+		}
+	}
+}
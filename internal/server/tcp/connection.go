@@ -16,11 +16,20 @@ import (
 	json "github.com/goccy/go-json"
 	"github.com/hashicorp/yamux"
 
+	"drip/internal/server/abuse"
+	"drip/internal/server/audit"
+	"drip/internal/server/geoip"
+	"drip/internal/server/hooks"
+	"drip/internal/server/p2p"
+	"drip/internal/server/ports"
 	"drip/internal/server/tunnel"
 	"drip/internal/shared/constants"
 	"drip/internal/shared/httputil"
+	"drip/internal/shared/labels"
+	"drip/internal/shared/netutil"
 	"drip/internal/shared/protocol"
 	"drip/internal/shared/qos"
+	"drip/internal/shared/utils"
 
 	"go.uber.org/zap"
 )
@@ -30,7 +39,7 @@ type ConnectionConfig struct {
 	AuthToken    string
 	Manager      *tunnel.Manager
 	Logger       *zap.Logger
-	PortAlloc    *PortAllocator
+	PortAlloc    *ports.Allocator
 	Domain       string
 	TunnelDomain string
 	PublicPort   int
@@ -38,6 +47,13 @@ type ConnectionConfig struct {
 	GroupManager *ConnectionGroupManager
 	HTTPListener *connQueueListener
 	RemoteIP     string
+
+	// AcceptedAt is when the peer connected, before any TLS handshake.
+	// Zero means now.
+	AcceptedAt time.Time
+
+	// ALPN is the protocol negotiated in the TLS handshake, if any.
+	ALPN string
 }
 
 type Connection struct {
@@ -50,9 +66,8 @@ type Connection struct {
 	domain           string
 	tunnelDomain     string
 	publicPort       int
-	portAlloc        *PortAllocator
+	portAlloc        *ports.Allocator
 	tunnelConn       *tunnel.Connection
-	stopCh           chan struct{}
 	once             sync.Once
 	lastHeartbeat    time.Time
 	mu               sync.RWMutex
@@ -75,12 +90,35 @@ type Connection struct {
 	bandwidth          int64
 	burstMultiplier    float64
 	remoteIP           string
+
+	acceptProxyProtocol bool
+	p2pBroker           *p2p.Broker
+	hooks               hooks.Hooks
+	audit               *audit.Log
+	geoip               *geoip.DB
+	versionPolicy       VersionPolicy
+	portRange           string
+	bindAddrs           []string
+	acceptLimiter       *abuse.AcceptLimiter
+	sniRouting          bool
+	acceptedAt          time.Time
+	alpn                string
+	registeredAt        time.Time
+	expiresAt           time.Time
+
+	// powerSave is set when the client asked for power-saving mode, see
+	// protocol.PoolCapabilities.PowerSave.
+	powerSave bool
 }
 
-// NewConnection creates a new connection handler
-func NewConnection(cfg ConnectionConfig) *Connection {
-	ctx, cancel := context.WithCancel(context.Background())
-	stopCh := make(chan struct{})
+// registrationTimeout bounds how long a peer may take to send its first
+// frame.
+const registrationTimeout = 30 * time.Second
+
+// NewConnection creates a new connection handler. The connection is closed
+// when ctx is cancelled.
+func NewConnection(ctx context.Context, cfg ConnectionConfig) *Connection {
+	ctx, cancel := context.WithCancel(ctx)
 
 	c := &Connection{
 		conn:             cfg.Conn,
@@ -92,14 +130,18 @@ func NewConnection(cfg ConnectionConfig) *Connection {
 		tunnelDomain:     cfg.TunnelDomain,
 		publicPort:       cfg.PublicPort,
 		httpHandler:      cfg.HTTPHandler,
-		stopCh:           stopCh,
 		lastHeartbeat:    time.Now(),
 		ctx:              ctx,
 		cancel:           cancel,
 		groupManager:     cfg.GroupManager,
 		httpListener:     cfg.HTTPListener,
-		lifecycleManager: NewConnectionLifecycleManager(stopCh, cancel, cfg.Logger),
+		lifecycleManager: NewConnectionLifecycleManager(cancel, cfg.Logger),
 		remoteIP:         cfg.RemoteIP,
+		acceptedAt:       cfg.AcceptedAt,
+		alpn:             cfg.ALPN,
+	}
+	if c.acceptedAt.IsZero() {
+		c.acceptedAt = time.Now()
 	}
 
 	// Set connection in lifecycle manager
@@ -112,17 +154,25 @@ func (c *Connection) Handle() error {
 	protocol.RegisterConnection()
 	defer c.Close()
 
-	c.conn.SetReadDeadline(time.Now().Add(30 * time.Second))
-	reader := bufio.NewReader(c.conn)
+	stop := context.AfterFunc(c.ctx, c.Close)
+	defer stop()
 
-	peek, err := reader.Peek(4)
-	if err != nil {
-		return fmt.Errorf("failed to peek connection: %w", err)
-	}
+	c.conn.SetReadDeadline(deadline(c.ctx, registrationTimeout))
+	frames := protocol.NewFrameReader(c.conn)
+	reader := frames.Reader()
+
+	// Clients that asked for the drip protocol by ALPN are not checked for
+	// HTTP.
+	if c.alpn != protocol.ALPN {
+		peek, err := frames.Peek(4)
+		if err != nil {
+			return fmt.Errorf("failed to peek connection: %w", err)
+		}
 
-	if httputil.IsHTTPRequest(peek) {
-		c.logger.Info("Detected HTTP request on TCP port, handling as HTTP")
-		return c.handleHTTPRequest(reader)
+		if httputil.IsHTTPRequest(peek) {
+			c.logger.Info("Detected HTTP request on TCP port, handling as HTTP")
+			return c.handleHTTPRequest(reader)
+		}
 	}
 
 	// Check if TCP transport is allowed (only for Drip protocol connections, not HTTP)
@@ -131,9 +181,10 @@ func (c *Connection) Handle() error {
 		return fmt.Errorf("TCP transport not allowed")
 	}
 
-	frame, err := protocol.ReadFrame(reader)
+	frames.SetMaxFrameSize(protocol.MaxControlFrameSize)
+	frame, err := frames.ReadFrame()
 	if err != nil {
-		return fmt.Errorf("failed to read registration frame: %w", err)
+		return protocol.Errorf(constants.ErrCodeInvalidRequest, "failed to read registration frame: %w", err)
 	}
 	sf := protocol.WithFrame(frame)
 	defer sf.Close()
@@ -144,7 +195,7 @@ func (c *Connection) Handle() error {
 			reader,
 			c.authToken,
 			c.groupManager,
-			c.stopCh,
+			c.ctx,
 			c.logger,
 		)
 		handler.SetSessionCreatedHandler(func(session *yamux.Session) {
@@ -156,31 +207,63 @@ func (c *Connection) Handle() error {
 		handler.SetTunnelIDHandler(func(tunnelID string) {
 			c.tunnelID = tunnelID
 		})
+		handler.SetAuthFailedHandler(func(tunnelID string) {
+			c.recordAudit(audit.TypeAuthFailure, "", map[string]string{"via": "data_connection", "tunnel_id": tunnelID})
+		})
 		return handler.Handle(sf.Frame)
 	}
 
 	if sf.Frame.Type != protocol.FrameTypeRegister {
-		return fmt.Errorf("expected register frame, got %s", sf.Frame.Type)
+		return c.reject(protocol.Errorf(constants.ErrCodeInvalidRequest, "expected register frame, got %s", sf.Frame.Type))
 	}
 
 	var req protocol.RegisterRequest
 	if err := json.Unmarshal(sf.Frame.Payload, &req); err != nil {
-		return fmt.Errorf("failed to parse registration request: %w", err)
+		return c.reject(protocol.Errorf(constants.ErrCodeInvalidRequest, "failed to parse registration request: %w", err))
 	}
 
 	c.tunnelType = req.TunnelType
 
+	if c.versionPolicy.clientTooOld(req.ClientVersion) {
+		c.logger.Info("Rejected outdated client",
+			zap.String("client_version", req.ClientVersion),
+			zap.String("min_version", c.versionPolicy.MinClientVersion),
+			zap.String("remote_ip", c.remoteIP),
+		)
+		return c.reject(c.versionPolicy.tooOldError(req.ClientVersion))
+	}
+
 	// Check if tunnel type is allowed
 	if !c.isTunnelTypeAllowed(string(req.TunnelType)) {
-		c.sendError("tunnel_type_not_allowed", fmt.Sprintf("Tunnel type '%s' is not allowed on this server", req.TunnelType))
-		return fmt.Errorf("tunnel type not allowed: %s", req.TunnelType)
+		return c.reject(protocol.Errorf(constants.ErrCodeTunnelTypeNotAllowed, "Tunnel type '%s' is not allowed on this server", req.TunnelType))
+	}
+	if req.TunnelType == protocol.TunnelTypeTLS && !c.sniRouting {
+		return c.reject(protocol.NewError(constants.ErrCodeUnsupported, "TLS tunnels need a server that terminates TLS itself, not one behind a TLS proxy"))
+	}
+	if e := req.EdgeTLS; e != nil && (e.TLS13Only || e.ClientCA != "") && !c.sniRouting {
+		return c.reject(protocol.NewError(constants.ErrCodeUnsupported, "edge TLS requirements need a server that terminates TLS itself, not one behind a TLS proxy"))
 	}
 
 	if c.authToken != "" && req.Token != c.authToken {
-		c.sendError("authentication_failed", "Invalid authentication token")
-		return fmt.Errorf("authentication failed")
+		c.logger.Named(utils.SubsystemAuth).Warn("Client authentication failed",
+			zap.String("remote_ip", c.remoteIP),
+		)
+		c.recordAudit(audit.TypeAuthFailure, req.CustomSubdomain, map[string]string{"via": "register"})
+		return c.reject(protocol.NewError(constants.ErrCodeAuthFailed, "Invalid authentication token"))
+	}
+
+	if req.TTL < 0 || req.TTL > int64(maxTunnelTTL/time.Second) {
+		return c.reject(protocol.Errorf(constants.ErrCodeInvalidTTL, "TTL must be between 0 and %s", maxTunnelTTL))
+	}
+
+	if c.hooks != nil {
+		if err := c.runRegisterHook(&req); err != nil {
+			return err
+		}
 	}
 
+	resumed := c.takeOver(&req)
+
 	// Use RegistrationHandler for registration logic
 	regHandler := NewRegistrationHandler(
 		c.manager,
@@ -191,30 +274,72 @@ func (c *Connection) Handle() error {
 		c.publicPort,
 		c.logger,
 	)
+	regHandler.SetGeoIP(c.geoip)
 
 	regReq := &RegistrationRequest{
 		TunnelType:       req.TunnelType,
 		CustomSubdomain:  req.CustomSubdomain,
+		SubdomainStyle:   req.SubdomainStyle,
+		SubdomainPrefix:  req.SubdomainPrefix,
 		Token:            req.Token,
 		ConnectionType:   req.ConnectionType,
 		PoolCapabilities: req.PoolCapabilities,
 		IPAccess:         req.IPAccess,
 		ProxyAuth:        req.ProxyAuth,
+		ProxyProtocol:    req.ProxyProtocol,
+		Private:          req.Private,
+		RequestRules:     req.RequestRules,
+		VisitorRateLimit: req.VisitorRateLimit,
+		EdgeTLS:          req.EdgeTLS,
+		SigningSecret:    req.SigningSecret,
+		RequestStore:     req.RequestStore,
+		MaxRequestBody:   req.MaxRequestBody,
+		Schedule:         req.Schedule,
+		Labels:           req.Labels,
 		LocalPort:        req.LocalPort,
 		RemoteIP:         c.remoteIP,
+		PortRange:        c.portRange,
 	}
 
 	result, err := regHandler.Register(regReq)
 	if err != nil {
-		c.sendError("registration_failed", err.Error())
-		return fmt.Errorf("registration failed: %w", err)
+		code := registrationErrorCode(err)
+		switch code {
+		case constants.ErrCodeTunnelLimit, constants.ErrCodeRateLimited, constants.ErrCodePortAllocationFailed:
+			c.recordAudit(audit.TypeQuota, req.CustomSubdomain, map[string]string{
+				"code":  code,
+				"error": err.Error(),
+			})
+		}
+		var perr *protocol.Error
+		if !errors.As(err, &perr) {
+			perr = protocol.Errorf(code, "%w", err)
+		}
+		switch code {
+		case constants.ErrCodeSubdomainTaken, constants.ErrCodeSubdomainReserved, constants.ErrCodeInvalidSubdomain:
+			perr.Subdomain = req.CustomSubdomain
+		}
+		return c.reject(perr)
+	}
+	details := map[string]string{
+		"tunnel_type": string(req.TunnelType),
+		"port":        strconv.Itoa(result.Port),
+		"private":     strconv.FormatBool(req.Private),
+		"labels":      labels.Format(req.Labels),
+	}
+	if resumed {
+		details["resumed"] = "true"
 	}
+	c.recordAudit(audit.TypeRegister, result.Subdomain, details)
 
 	// Store registration results
+	c.registeredAt = time.Now()
+	if req.TTL > 0 {
+		c.expiresAt = c.registeredAt.Add(time.Duration(req.TTL) * time.Second)
+	}
 	c.subdomain = result.Subdomain
 	c.port = result.Port
 	c.tunnelConn = result.TunnelConn
-	c.tunnelConn.Conn = nil
 
 	// Update lifecycle manager with registration info
 	if c.lifecycleManager != nil {
@@ -222,11 +347,17 @@ func (c *Connection) Handle() error {
 		c.lifecycleManager.SetTunnelRegistration(c.manager, c.subdomain, "", c.groupManager)
 	}
 
+	c.powerSave = req.PoolCapabilities != nil && req.PoolCapabilities.PowerSave
+
 	// Handle connection groups
 	if result.SupportsDataConn && c.groupManager != nil {
 		group := c.groupManager.CreateGroup(result.Subdomain, req.Token, c, req.TunnelType)
+		group.SetPowerSave(c.powerSave)
 		result.TunnelID = group.TunnelID
 		c.tunnelID = result.TunnelID
+		if c.tunnelConn != nil {
+			c.tunnelConn.SetTunnelID(c.tunnelID)
+		}
 
 		// Update lifecycle manager with tunnel ID
 		if c.lifecycleManager != nil {
@@ -246,6 +377,9 @@ func (c *Connection) Handle() error {
 			effectiveBandwidth = req.Bandwidth
 		}
 	}
+	// Tunnels of one token also share the token's bandwidth, if the
+	// server sets one.
+	shared := c.manager.TokenLimiter(req.Token)
 	if effectiveBandwidth > 0 {
 		burstMultiplier := c.burstMultiplier
 		if burstMultiplier <= 0 {
@@ -257,6 +391,7 @@ func (c *Connection) Handle() error {
 		limiter := qos.NewLimiter(qos.Config{
 			Bandwidth: effectiveBandwidth,
 			Burst:     burst,
+			Shared:    shared,
 		})
 		c.tunnelConn.SetLimiter(limiter)
 
@@ -271,6 +406,8 @@ func (c *Connection) Handle() error {
 			zap.Int("burst_bytes", burst),
 			zap.String("source", source),
 		)
+	} else if shared != nil {
+		c.tunnelConn.SetLimiter(qos.NewLimiter(qos.Config{Shared: shared}))
 	}
 
 	// Build and send registration response
@@ -279,14 +416,29 @@ func (c *Connection) Handle() error {
 		return fmt.Errorf("failed to build registration response: %w", err)
 	}
 	resp.Bandwidth = c.tunnelConn.GetBandwidth()
+	resp.ServerVersion = c.versionPolicy.ServerVersion
+	resp.ProtocolVersion = protocol.ProtocolVersion
+	resp.Capabilities = c.capabilities(result, req.TunnelType)
+	if !c.expiresAt.IsZero() {
+		resp.ExpiresAt = c.expiresAt.Unix()
+	}
+	resp.ResumeToken = utils.GenerateID()
+	c.tunnelConn.SetResumeToken(resp.ResumeToken, c.Close)
 
 	if err := regHandler.SendRegistrationResponse(c.conn, resp); err != nil {
 		return fmt.Errorf("failed to send registration ack: %w", err)
 	}
+	if req.ResumeToken != "" {
+		c.observeReconnect(resumed)
+	}
+
+	if !c.expiresAt.IsZero() {
+		go c.enforceTTL()
+	}
 
 	c.conn.SetReadDeadline(time.Time{})
 
-	if req.TunnelType == protocol.TunnelTypeTCP {
+	if req.TunnelType == protocol.TunnelTypeTCP || req.TunnelType == protocol.TunnelTypeTLS {
 		return c.handleTCPTunnel(reader)
 	}
 	if req.TunnelType == protocol.TunnelTypeHTTP || req.TunnelType == protocol.TunnelTypeHTTPS {
@@ -308,8 +460,9 @@ func (c *Connection) Handle() error {
 	go c.heartbeatChecker()
 
 	// Use FrameHandler for frame processing
-	frameHandler := NewFrameHandler(c.conn, reader, c.stopCh, c.frameWriter, c.logger)
-	frameHandler.SetHeartbeatHandler(func() {
+	frameHandler := NewFrameHandler(c.ctx, frames, c.frameWriter, c.logger)
+	frameHandler.SetHeartbeatHandler(func(payload []byte) {
+		c.recordClientState(payload)
 		c.handleHeartbeat()
 	})
 	frameHandler.SetCloseHandler(func() {
@@ -375,7 +528,7 @@ func (c *Connection) heartbeatChecker() {
 
 	for {
 		select {
-		case <-c.stopCh:
+		case <-c.ctx.Done():
 			return
 		case <-ticker.C:
 			c.mu.RLock()
@@ -387,6 +540,10 @@ func (c *Connection) heartbeatChecker() {
 					zap.String("subdomain", c.subdomain),
 					zap.Duration("last_heartbeat", time.Since(lastHB)),
 				)
+				if c.tunnelConn != nil {
+					c.tunnelConn.RecordEvent(tunnel.EventHeartbeatMissed,
+						fmt.Sprintf("no heartbeat for %s, closing the tunnel", time.Since(lastHB).Round(time.Second)))
+				}
 				c.Close()
 				return
 			}
@@ -394,23 +551,19 @@ func (c *Connection) heartbeatChecker() {
 	}
 }
 
-func (c *Connection) sendError(code, message string) {
-	errMsg := protocol.ErrorMessage{
-		Code:    code,
-		Message: message,
-	}
-	data, err := json.Marshal(errMsg)
-	if err != nil {
-		c.logger.Error("Failed to marshal error message", zap.Error(err))
-		return
+// reject sends err to the client as an error frame and returns it.
+func (c *Connection) reject(err *protocol.Error) error {
+	frame, ferr := protocol.EncodeError(err)
+	if ferr != nil {
+		c.logger.Error("Failed to marshal error message", zap.Error(ferr))
+		return err
 	}
-	errFrame := protocol.NewFrame(protocol.FrameTypeError, data)
-
 	if c.frameWriter == nil {
-		_ = protocol.WriteFrame(c.conn, errFrame)
+		_ = protocol.WriteFrame(c.conn, frame)
 	} else {
-		c.frameWriter.WriteFrame(errFrame)
+		c.frameWriter.WriteFrame(frame)
 	}
+	return err
 }
 
 func (c *Connection) Close() {
@@ -426,13 +579,14 @@ func (c *Connection) Close() {
 			return
 		}
 
+		defer c.runDisconnectHook()
+
 		// Use lifecycle manager for cleanup
 		if c.lifecycleManager != nil {
 			c.lifecycleManager.Close()
 		} else {
 			// Fallback if lifecycle manager not initialized
 			protocol.UnregisterConnection()
-			close(c.stopCh)
 
 			if c.cancel != nil {
 				c.cancel()
@@ -480,6 +634,15 @@ func (c *Connection) Close() {
 	})
 }
 
+// deadline returns the time d from now, or ctx's deadline if that is earlier.
+func deadline(ctx context.Context, d time.Duration) time.Time {
+	t := time.Now().Add(d)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(t) {
+		return ctxDeadline
+	}
+	return t
+}
+
 func isTimeoutError(err error) bool {
 	if err == nil {
 		return false
@@ -535,6 +698,154 @@ func (c *Connection) SetBandwidthConfig(bandwidth int64, burstMultiplier float64
 	c.burstMultiplier = burstMultiplier
 }
 
+// SetAcceptProxyProtocol makes TCP tunnel proxies expect PROXY headers
+// from an upstream load balancer.
+func (c *Connection) SetAcceptProxyProtocol(enabled bool) {
+	c.acceptProxyProtocol = enabled
+}
+
+// SetP2PBroker enables direct connection offers for TCP tunnels.
+func (c *Connection) SetP2PBroker(broker *p2p.Broker) {
+	c.p2pBroker = broker
+}
+
+// SetHooks lets an extension accept, deny or rename tunnels and observe
+// disconnects.
+func (c *Connection) SetHooks(h hooks.Hooks) {
+	c.hooks = h
+}
+
+// SetAudit records registrations, failed authentication and refusals by
+// tunnel limits in the audit log.
+func (c *Connection) SetAudit(log *audit.Log) {
+	c.audit = log
+}
+
+func (c *Connection) recordAudit(eventType, tunnel string, detail map[string]string) {
+	ip := c.remoteIP
+	if ip == "" {
+		ip = netutil.ExtractIP(c.conn.RemoteAddr().String())
+	}
+	c.audit.Record(audit.Event{
+		Type:   eventType,
+		IP:     ip,
+		Tunnel: tunnel,
+		Detail: detail,
+	})
+}
+
+// SetGeoIP sets the database visitor countries are looked up in, for
+// metrics and country access rules.
+func (c *Connection) SetGeoIP(db *geoip.DB) {
+	c.geoip = db
+}
+
+// allowVisitor reports whether a visitor at ip passes the tunnel's IP and
+// country access rules, or returns nil if the tunnel has none.
+func (c *Connection) allowVisitor() func(ip string) bool {
+	tc := c.tunnelConn
+	if tc == nil {
+		return nil
+	}
+	checkIP, checkCountry := tc.HasIPAccessControl(), tc.HasCountryAccess()
+	if !checkIP && !checkCountry {
+		return nil
+	}
+	return func(ip string) bool {
+		if checkIP && !tc.IsIPAllowed(ip) {
+			return false
+		}
+		return !checkCountry || tc.IsCountryAllowed(c.geoip.Country(ip))
+	}
+}
+
+// SetVersionPolicy sets the server version reported to clients and the
+// oldest client version accepted.
+func (c *Connection) SetVersionPolicy(p VersionPolicy) {
+	c.versionPolicy = p
+}
+
+// SetBindAddrs sets the addresses TCP tunnel ports listen on.
+func (c *Connection) SetBindAddrs(addrs []string) {
+	c.bindAddrs = addrs
+}
+
+// SetAcceptLimiter sets the limiter whose cap per IP applies to visitors
+// of the TCP tunnel port.
+func (c *Connection) SetAcceptLimiter(limiter *abuse.AcceptLimiter) {
+	c.acceptLimiter = limiter
+}
+
+// SetSNIRouting accepts TLS tunnels, whose visitors the listener routes
+// by SNI before terminating TLS.
+func (c *Connection) SetSNIRouting(enabled bool) {
+	c.sniRouting = enabled
+}
+
+// runRegisterHook asks the extension about req, renaming it if told to.
+func (c *Connection) runRegisterHook(req *protocol.RegisterRequest) error {
+	ctx, cancel := context.WithTimeout(c.ctx, hooks.DefaultWebhookTimeout)
+	defer cancel()
+
+	decision, err := c.hooks.OnRegister(ctx, &hooks.RegisterEvent{
+		Token:      req.Token,
+		Subdomain:  req.CustomSubdomain,
+		TunnelType: string(req.TunnelType),
+		LocalPort:  req.LocalPort,
+		RemoteIP:   c.remoteIP,
+		Labels:     req.Labels,
+	})
+	if err != nil {
+		c.logger.Warn("Registration hook failed", zap.Error(err))
+		c.reject(protocol.NewError(constants.ErrCodeRegistrationDenied, "Registration hook unavailable"))
+		return fmt.Errorf("registration hook: %w", err)
+	}
+	if decision == nil {
+		return nil
+	}
+	if decision.Deny {
+		reason := decision.Reason
+		if reason == "" {
+			reason = "Registration denied"
+		}
+		return c.reject(protocol.NewError(constants.ErrCodeRegistrationDenied, reason))
+	}
+	if decision.Subdomain != "" {
+		req.CustomSubdomain = decision.Subdomain
+	}
+	c.portRange = decision.PortRange
+	if len(decision.Bind) > 0 {
+		if err := ValidateBindAddrs(decision.Bind); err != nil {
+			c.logger.Warn("Registration hook returned an invalid bind address", zap.Error(err))
+			return c.reject(protocol.NewError(constants.ErrCodeRegistrationFailed, "Invalid bind address from registration hook"))
+		}
+		c.bindAddrs = decision.Bind
+	}
+	return nil
+}
+
+// runDisconnectHook reports the end of a registered tunnel.
+func (c *Connection) runDisconnectHook() {
+	if c.hooks == nil || c.subdomain == "" || c.registeredAt.IsZero() {
+		return
+	}
+	ev := &hooks.DisconnectEvent{
+		Subdomain:  c.subdomain,
+		TunnelType: string(c.tunnelType),
+		RemoteIP:   c.remoteIP,
+		Duration:   time.Since(c.registeredAt),
+	}
+	if c.tunnelConn != nil {
+		ev.BytesIn = c.tunnelConn.GetBytesIn()
+		ev.BytesOut = c.tunnelConn.GetBytesOut()
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), hooks.DefaultWebhookTimeout)
+		defer cancel()
+		c.hooks.OnDisconnect(ctx, ev)
+	}()
+}
+
 func limiterBurst(bandwidth int64, burstMultiplier float64) int {
 	if bandwidth <= 0 {
 		return 0
@@ -4,33 +4,124 @@ import (
 	"container/heap"
 	"fmt"
 	"net"
+	"slices"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/hashicorp/yamux"
 
+	"drip/internal/server/tunnel"
 	"drip/internal/shared/constants"
 	"drip/internal/shared/protocol"
 
 	"go.uber.org/zap"
 )
 
-// sessionEntry represents a session with its current stream count for heap operations
+// sessionEntry represents a session with its current health score for heap operations
 type sessionEntry struct {
 	id      string
+	member  *sessionMember
 	session *yamux.Session
 	streams int
+	score   float64
 	heapIdx int // index in the heap, managed by heap.Interface
 }
 
+const (
+	// healthAlpha weights the newest sample in the RTT and error averages.
+	healthAlpha = 0.1
+	// backlogPerStream is how many pending write bytes count as one extra
+	// stream of load when scoring a session.
+	backlogPerStream = 32 * 1024
+	// rttUnit is the RTT that doubles a session's score.
+	rttUnit = 50 * time.Millisecond
+
+	// A session is drained (gets no new streams while healthier sessions
+	// exist) when its error rate or score relative to the group median
+	// crosses the drain thresholds, and returns once it is back under the
+	// restore thresholds.
+	drainErrorRate    = 0.5
+	restoreErrorRate  = 0.1
+	drainScoreRatio   = 4.0
+	restoreScoreRatio = 2.0
+)
+
+// sessionMember is a session in a group together with its health.
+type sessionMember struct {
+	session *yamux.Session
+	backlog func() int64 // pending write bytes on the underlying conn, may be nil
+
+	mu       sync.Mutex
+	rtt      time.Duration // moving average of heartbeat RTT
+	errRate  float64       // moving average of failed opens and pings, 0..1
+	draining bool
+	// retiring is set when the client announced it will close the
+	// session. Unlike draining it is never undone.
+	retiring bool
+}
+
+// record folds the outcome of an open or ping into the error rate.
+func (m *sessionMember) record(err error) {
+	sample := 0.0
+	if err != nil {
+		sample = 1
+	}
+	m.mu.Lock()
+	m.errRate += healthAlpha * (sample - m.errRate)
+	m.mu.Unlock()
+}
+
+func (m *sessionMember) recordRTT(rtt time.Duration) {
+	m.mu.Lock()
+	if m.rtt == 0 {
+		m.rtt = rtt
+	} else {
+		m.rtt += time.Duration(healthAlpha * float64(rtt-m.rtt))
+	}
+	m.mu.Unlock()
+}
+
+// score returns the member's current health score; lower is healthier.
+func (m *sessionMember) score(streams int) float64 {
+	var backlog int64
+	if m.backlog != nil {
+		backlog = m.backlog()
+	}
+	m.mu.Lock()
+	rtt, errRate := m.rtt, m.errRate
+	m.mu.Unlock()
+	return healthScore(streams, backlog, rtt, errRate)
+}
+
+func (m *sessionMember) isDraining() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.draining
+}
+
+func (m *sessionMember) isRetiring() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.retiring
+}
+
+// healthScore combines queue depth (open streams plus write backlog), RTT
+// and error rate into a single load figure. A session with twice the
+// queue, or an extra rttUnit of latency, scores about twice as high.
+func healthScore(streams int, backlog int64, rtt time.Duration, errRate float64) float64 {
+	queue := float64(streams+1) + float64(backlog)/backlogPerStream
+	return queue * (1 + float64(rtt)/float64(rttUnit)) * (1 + 4*errRate)
+}
+
 // sessionHeap implements heap.Interface for O(log n) session selection
 type sessionHeap []*sessionEntry
 
 func (h sessionHeap) Len() int { return len(h) }
 
 func (h sessionHeap) Less(i, j int) bool {
-	// Min-heap: session with fewer streams has higher priority
-	return h[i].streams < h[j].streams
+	// Min-heap: healthier session (lower score) has higher priority
+	return h[i].score < h[j].score
 }
 
 func (h sessionHeap) Swap(i, j int) {
@@ -68,7 +159,7 @@ type ConnectionGroup struct {
 	Subdomain    string
 	Token        string
 	PrimaryConn  *Connection
-	Sessions     map[string]*yamux.Session
+	Sessions     map[string]*sessionMember
 	TunnelType   protocol.TunnelType
 	RegisteredAt time.Time
 	LastActivity time.Time
@@ -78,29 +169,65 @@ type ConnectionGroup struct {
 	logger       *zap.Logger
 
 	heartbeatStarted bool
+
+	// powerSave rests the heartbeat while the tunnel is idle, see
+	// protocol.PoolCapabilities.PowerSave.
+	powerSave atomic.Bool
+	// lastStream is when a stream was last opened, in unix nanoseconds.
+	lastStream atomic.Int64
 }
 
 func NewConnectionGroup(tunnelID, subdomain, token string, primaryConn *Connection, tunnelType protocol.TunnelType, logger *zap.Logger) *ConnectionGroup {
-	return &ConnectionGroup{
+	g := &ConnectionGroup{
 		TunnelID:     tunnelID,
 		Subdomain:    subdomain,
 		Token:        token,
 		PrimaryConn:  primaryConn,
-		Sessions:     make(map[string]*yamux.Session),
+		Sessions:     make(map[string]*sessionMember),
 		TunnelType:   tunnelType,
 		RegisteredAt: time.Now(),
 		LastActivity: time.Now(),
 		stopCh:       make(chan struct{}),
 		logger:       logger.With(zap.String("tunnel_id", tunnelID)),
 	}
+	g.lastStream.Store(time.Now().UnixNano())
+	return g
 }
 
-// StartHeartbeat starts a goroutine that periodically pings all sessions
-// and removes dead ones. The caller should ensure this is only called once.
+// StartHeartbeat starts a goroutine that periodically pings all sessions,
+// removes dead ones and rebalances new streams away from unhealthy ones. The caller should ensure this is only called once.
 func (g *ConnectionGroup) StartHeartbeat(interval, timeout time.Duration) {
 	go g.heartbeatLoop(interval, timeout)
 }
 
+// SetPowerSave sets whether the group's heartbeat rests while its tunnel
+// is idle.
+func (g *ConnectionGroup) SetPowerSave(on bool) {
+	g.powerSave.Store(on)
+}
+
+// PowerSave reports whether the client asked for power-saving mode.
+func (g *ConnectionGroup) PowerSave() bool {
+	return g.powerSave.Load()
+}
+
+// resting reports whether the heartbeat should skip pings: in
+// power-saving mode, once no stream has been open for
+// PowerSaveIdleTimeout. Dead connections are then left to TCP keepalive.
+func (g *ConnectionGroup) resting() bool {
+	if !g.powerSave.Load() || time.Since(time.Unix(0, g.lastStream.Load())) < constants.PowerSaveIdleTimeout {
+		return false
+	}
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	for _, m := range g.Sessions {
+		if m.session.NumStreams() > 0 {
+			return false
+		}
+	}
+	return true
+}
+
 func (g *ConnectionGroup) heartbeatLoop(interval, timeout time.Duration) {
 	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
@@ -109,8 +236,8 @@ func (g *ConnectionGroup) heartbeatLoop(interval, timeout time.Duration) {
 	failureCount := make(map[string]int)
 
 	type sessionSnapshot struct {
-		id      string
-		session *yamux.Session
+		id     string
+		member *sessionMember
 	}
 	sessions := make([]sessionSnapshot, 0, 16)
 
@@ -121,37 +248,57 @@ func (g *ConnectionGroup) heartbeatLoop(interval, timeout time.Duration) {
 		case <-ticker.C:
 		}
 
+		if g.resting() {
+			// Closed sessions are still removed, and the group must not
+			// look stale for want of pings.
+			g.deleteClosedSessions()
+			g.mu.Lock()
+			g.LastActivity = time.Now()
+			g.mu.Unlock()
+			continue
+		}
+
 		sessions = sessions[:0]
 		g.mu.RLock()
-		for id, s := range g.Sessions {
-			sessions = append(sessions, sessionSnapshot{id: id, session: s})
+		for id, m := range g.Sessions {
+			sessions = append(sessions, sessionSnapshot{id: id, member: m})
 		}
 		g.mu.RUnlock()
 
 		for _, snap := range sessions {
-			if snap.session == nil || snap.session.IsClosed() {
+			if snap.member.session.IsClosed() {
 				g.RemoveSession(snap.id)
 				delete(failureCount, snap.id)
 				continue
 			}
 
-			done := make(chan error, 1)
+			type pingResult struct {
+				rtt time.Duration
+				err error
+			}
+			done := make(chan pingResult, 1)
 			go func(s *yamux.Session) {
-				_, err := s.Ping()
-				done <- err
-			}(snap.session)
+				rtt, err := s.Ping()
+				done <- pingResult{rtt, err}
+			}(snap.member.session)
 
 			var err error
 			select {
-			case err = <-done:
+			case res := <-done:
+				err = res.err
+				if err == nil {
+					snap.member.recordRTT(res.rtt)
+				}
 			case <-time.After(timeout):
 				err = fmt.Errorf("ping timeout")
 			case <-g.stopCh:
 				return
 			}
 
+			snap.member.record(err)
 			if err != nil {
 				failureCount[snap.id]++
+				g.recordEvent(tunnel.EventHeartbeatMissed, fmt.Sprintf("session %s: %v", snap.id, err))
 				g.logger.Debug("Session ping failed",
 					zap.String("session_id", snap.id),
 					zap.Int("consecutive_failures", failureCount[snap.id]),
@@ -159,6 +306,7 @@ func (g *ConnectionGroup) heartbeatLoop(interval, timeout time.Duration) {
 				)
 
 				if failureCount[snap.id] >= maxConsecutiveFailures {
+					g.recordEvent(tunnel.EventHeartbeatMissed, fmt.Sprintf("session %s removed after %d missed heartbeats", snap.id, failureCount[snap.id]))
 					g.logger.Warn("Session ping failed too many times, removing",
 						zap.String("session_id", snap.id),
 						zap.Int("failures", failureCount[snap.id]),
@@ -174,6 +322,8 @@ func (g *ConnectionGroup) heartbeatLoop(interval, timeout time.Duration) {
 			}
 		}
 
+		g.rebalance()
+
 		g.mu.RLock()
 		sessionCount := len(g.Sessions)
 		g.mu.RUnlock()
@@ -184,6 +334,13 @@ func (g *ConnectionGroup) heartbeatLoop(interval, timeout time.Duration) {
 	}
 }
 
+// recordEvent adds an event to the history of the group's tunnel.
+func (g *ConnectionGroup) recordEvent(typ, detail string) {
+	if g.PrimaryConn != nil && g.PrimaryConn.tunnelConn != nil {
+		g.PrimaryConn.tunnelConn.RecordEvent(typ, detail)
+	}
+}
+
 func (g *ConnectionGroup) Close() {
 	g.mu.Lock()
 
@@ -196,12 +353,10 @@ func (g *ConnectionGroup) Close() {
 	}
 
 	sessions := make([]*yamux.Session, 0, len(g.Sessions))
-	for _, session := range g.Sessions {
-		if session != nil {
-			sessions = append(sessions, session)
-		}
+	for _, m := range g.Sessions {
+		sessions = append(sessions, m.session)
 	}
-	g.Sessions = make(map[string]*yamux.Session)
+	g.Sessions = make(map[string]*sessionMember)
 
 	g.mu.Unlock()
 
@@ -216,16 +371,19 @@ func (g *ConnectionGroup) IsStale(timeout time.Duration) bool {
 	return time.Since(g.LastActivity) > timeout
 }
 
-func (g *ConnectionGroup) AddSession(connID string, session *yamux.Session) {
+// AddSession adds a session to the group. backlog, if not nil, reports the
+// bytes waiting to be written on the session's connection and is used to
+// score the session's load.
+func (g *ConnectionGroup) AddSession(connID string, session *yamux.Session, backlog func() int64) {
 	if connID == "" || session == nil {
 		return
 	}
 
 	g.mu.Lock()
 	if g.Sessions == nil {
-		g.Sessions = make(map[string]*yamux.Session)
+		g.Sessions = make(map[string]*sessionMember)
 	}
-	g.Sessions[connID] = session
+	g.Sessions[connID] = &sessionMember{session: session, backlog: backlog}
 	g.LastActivity = time.Now()
 
 	// Start heartbeat on first session
@@ -248,8 +406,8 @@ func (g *ConnectionGroup) RemoveSession(connID string) {
 	var session *yamux.Session
 
 	g.mu.Lock()
-	if g.Sessions != nil {
-		session = g.Sessions[connID]
+	if m, ok := g.Sessions[connID]; ok {
+		session = m.session
 		delete(g.Sessions, connID)
 	}
 	g.mu.Unlock()
@@ -259,13 +417,51 @@ func (g *ConnectionGroup) RemoveSession(connID string) {
 	}
 }
 
+// Retire stops OpenStream from using the given sessions, or every session
+// when all is set, because the client is about to close them. Streams that
+// are already open keep running until the client closes the session. It
+// returns the number of sessions retired.
+func (g *ConnectionGroup) Retire(connIDs []string, all bool) int {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	retire := func(id string, m *sessionMember) {
+		m.mu.Lock()
+		m.retiring = true
+		m.mu.Unlock()
+		g.logger.Debug("Session retiring, no new streams",
+			zap.String("session_id", id),
+			zap.Int("open_streams", m.session.NumStreams()),
+		)
+	}
+
+	if all {
+		for id, m := range g.Sessions {
+			retire(id, m)
+		}
+		return len(g.Sessions)
+	}
+
+	n := 0
+	for _, id := range connIDs {
+		if m, ok := g.Sessions[id]; ok {
+			retire(id, m)
+			n++
+		}
+	}
+	return n
+}
+
 func (g *ConnectionGroup) SessionCount() int {
 	g.mu.RLock()
 	defer g.mu.RUnlock()
 	return len(g.Sessions)
 }
 
-// OpenStream opens a new stream using a min-heap for O(log n) session selection.
+// OpenStream opens a new stream on the healthiest session, using a min-heap
+// of health scores for O(log n) session selection. Draining sessions and
+// the primary session are only used when no other session is available;
+// retiring sessions are never used.
 func (g *ConnectionGroup) OpenStream() (net.Conn, error) {
 	const (
 		maxStreamsPerSession = 256
@@ -282,11 +478,17 @@ func (g *ConnectionGroup) OpenStream() (net.Conn, error) {
 		default:
 		}
 
-		h := g.buildSessionHeap(false)
+		h := g.buildSessionHeap(false, false)
+		if h.Len() == 0 {
+			sessionHeapPool.Put(h)
+			h = g.buildSessionHeap(true, false)
+		}
 		if h.Len() == 0 {
-			h = g.buildSessionHeap(true)
+			sessionHeapPool.Put(h)
+			h = g.buildSessionHeap(true, true)
 		}
 		if h.Len() == 0 {
+			sessionHeapPool.Put(h)
 			return nil, net.ErrClosed
 		}
 
@@ -306,7 +508,9 @@ func (g *ConnectionGroup) OpenStream() (net.Conn, error) {
 			anyUnderCap = true
 
 			stream, err := session.Open()
+			entry.member.record(err)
 			if err == nil {
+				g.lastStream.Store(time.Now().UnixNano())
 				*h = (*h)[:0]
 				sessionHeapPool.Put(h)
 				return stream, nil
@@ -340,31 +544,35 @@ func (g *ConnectionGroup) OpenStream() (net.Conn, error) {
 	return nil, lastErr
 }
 
-// buildSessionHeap creates a min-heap of sessions ordered by stream count.
-func (g *ConnectionGroup) buildSessionHeap(includePrimary bool) *sessionHeap {
+// buildSessionHeap creates a min-heap of sessions ordered by health score.
+func (g *ConnectionGroup) buildSessionHeap(includePrimary, includeDraining bool) *sessionHeap {
 	g.mu.RLock()
 	defer g.mu.RUnlock()
 
-	if len(g.Sessions) == 0 {
-		h := sessionHeapPool.Get().(*sessionHeap)
-		return h
-	}
-
 	h := sessionHeapPool.Get().(*sessionHeap)
 	*h = (*h)[:0]
 
-	for id, session := range g.Sessions {
-		if session == nil || session.IsClosed() {
+	for id, m := range g.Sessions {
+		if m.session.IsClosed() {
 			continue
 		}
 		if id == "primary" && !includePrimary {
 			continue
 		}
+		if m.isRetiring() {
+			continue
+		}
+		if !includeDraining && m.isDraining() {
+			continue
+		}
 
+		streams := m.session.NumStreams()
 		*h = append(*h, &sessionEntry{
 			id:      id,
-			session: session,
-			streams: session.NumStreams(),
+			member:  m,
+			session: m.session,
+			streams: streams,
+			score:   m.score(streams),
 		})
 	}
 
@@ -374,10 +582,83 @@ func (g *ConnectionGroup) buildSessionHeap(includePrimary bool) *sessionHeap {
 
 func (g *ConnectionGroup) deleteClosedSessions() {
 	g.mu.Lock()
-	for id, session := range g.Sessions {
-		if session == nil || session.IsClosed() {
+	for id, m := range g.Sessions {
+		if m.session.IsClosed() {
 			delete(g.Sessions, id)
 		}
 	}
 	g.mu.Unlock()
 }
+
+// rebalance rescores the group's sessions and moves new streams away from
+// the unhealthy ones: a session is drained when its error rate is high or
+// its score is far above the group median, and restored once it recovers.
+// Streams already open on a drained session are left to finish.
+func (g *ConnectionGroup) rebalance() {
+	type scored struct {
+		id     string
+		member *sessionMember
+		score  float64
+	}
+
+	g.mu.RLock()
+	members := make([]scored, 0, len(g.Sessions))
+	for id, m := range g.Sessions {
+		if m.session.IsClosed() || m.isRetiring() {
+			continue
+		}
+		members = append(members, scored{id: id, member: m, score: m.score(m.session.NumStreams())})
+	}
+	g.mu.RUnlock()
+
+	if len(members) < 2 {
+		for _, s := range members {
+			s.member.mu.Lock()
+			s.member.draining = false
+			s.member.mu.Unlock()
+		}
+		return
+	}
+
+	scores := make([]float64, len(members))
+	for i, s := range members {
+		scores[i] = s.score
+	}
+	slices.Sort(scores)
+	// Lower median, so in a pair the healthier session is the reference.
+	median := scores[(len(scores)-1)/2]
+
+	for _, s := range members {
+		m := s.member
+		m.mu.Lock()
+		was := m.draining
+		m.draining = shouldDrain(was, m.errRate, s.score, median)
+		now, errRate, rtt := m.draining, m.errRate, m.rtt
+		m.mu.Unlock()
+
+		if now != was {
+			fields := []zap.Field{
+				zap.String("session_id", s.id),
+				zap.Float64("score", s.score),
+				zap.Float64("median_score", median),
+				zap.Float64("error_rate", errRate),
+				zap.Duration("rtt", rtt),
+			}
+			if now {
+				g.logger.Info("Draining unhealthy session", fields...)
+			} else {
+				g.logger.Info("Session recovered, routing new streams to it again", fields...)
+			}
+		}
+	}
+}
+
+// shouldDrain decides whether a session stays or becomes drained. The gap
+// between the drain and restore thresholds keeps a borderline session from
+// flapping between the two on every heartbeat.
+func shouldDrain(draining bool, errRate, score, median float64) bool {
+	if draining {
+		return errRate > restoreErrorRate || score > restoreScoreRatio*median
+	}
+	return errRate > drainErrorRate || score > drainScoreRatio*median
+}
@@ -0,0 +1,129 @@
+package tcp
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/yamux"
+	"go.uber.org/zap"
+
+	"drip/internal/shared/constants"
+	"drip/internal/shared/protocol"
+)
+
+func TestHealthScoreOrdering(t *testing.T) {
+	idle := healthScore(0, 0, 10*time.Millisecond, 0)
+
+	tests := []struct {
+		name  string
+		score float64
+	}{
+		{"more streams", healthScore(4, 0, 10*time.Millisecond, 0)},
+		{"write backlog", healthScore(0, 4*backlogPerStream, 10*time.Millisecond, 0)},
+		{"higher rtt", healthScore(0, 0, 200*time.Millisecond, 0)},
+		{"errors", healthScore(0, 0, 10*time.Millisecond, 0.5)},
+	}
+
+	for _, tt := range tests {
+		if tt.score <= idle {
+			t.Errorf("%s: score %.2f, want above idle session's %.2f", tt.name, tt.score, idle)
+		}
+	}
+}
+
+func TestShouldDrain(t *testing.T) {
+	tests := []struct {
+		name     string
+		draining bool
+		errRate  float64
+		score    float64
+		want     bool
+	}{
+		{"healthy", false, 0, 1, false},
+		{"error rate", false, 0.6, 1, true},
+		{"overloaded", false, 0, 5, true},
+		{"borderline stays", false, 0.3, 3, false},
+		{"still recovering", true, 0.3, 1, true},
+		{"still loaded", true, 0, 3, true},
+		{"recovered", true, 0.05, 1.5, false},
+	}
+
+	for _, tt := range tests {
+		if got := shouldDrain(tt.draining, tt.errRate, tt.score, 1); got != tt.want {
+			t.Errorf("%s: shouldDrain = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestConnectionGroupSkipsRetiredSessions(t *testing.T) {
+	g := NewConnectionGroup("tunnel", "app", "", nil, protocol.TunnelTypeHTTP, zap.NewNop())
+	defer g.Close()
+
+	sessions := make(map[string]*yamux.Session)
+	for _, id := range []string{"data-1", "data-2"} {
+		serverConn, clientConn := net.Pipe()
+		session, err := yamux.Client(serverConn, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		peer, err := yamux.Server(clientConn, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer peer.Close()
+		go func() {
+			for {
+				if _, err := peer.Accept(); err != nil {
+					return
+				}
+			}
+		}()
+		g.AddSession(id, session, nil)
+		sessions[id] = session
+	}
+
+	if n := g.Retire([]string{"data-1", "missing"}, false); n != 1 {
+		t.Fatalf("Retire() = %d, want 1", n)
+	}
+
+	for range 5 {
+		if _, err := g.OpenStream(); err != nil {
+			t.Fatalf("OpenStream() error: %v", err)
+		}
+	}
+	if n := sessions["data-1"].NumStreams(); n != 0 {
+		t.Errorf("retired session got %d streams, want 0", n)
+	}
+	if n := sessions["data-2"].NumStreams(); n != 5 {
+		t.Errorf("remaining session got %d streams, want 5", n)
+	}
+
+	g.Retire(nil, true)
+	if _, err := g.OpenStream(); err == nil {
+		t.Error("OpenStream() succeeded with every session retired")
+	}
+}
+
+func TestConnectionGroupResting(t *testing.T) {
+	tests := []struct {
+		name       string
+		powerSave  bool
+		lastStream time.Duration
+		want       bool
+	}{
+		{"power save off", false, time.Hour, false},
+		{"recent stream", true, time.Second, false},
+		{"idle", true, 2 * constants.PowerSaveIdleTimeout, true},
+	}
+
+	for _, tt := range tests {
+		g := NewConnectionGroup("tunnel", "app", "", nil, protocol.TunnelTypeHTTP, zap.NewNop())
+		g.SetPowerSave(tt.powerSave)
+		g.lastStream.Store(time.Now().Add(-tt.lastStream).UnixNano())
+		if got := g.resting(); got != tt.want {
+			t.Errorf("%s: resting() = %v, want %v", tt.name, got, tt.want)
+		}
+		g.Close()
+	}
+}
@@ -0,0 +1,216 @@
+package tcp
+
+import (
+	"io"
+	"net"
+	"time"
+
+	json "github.com/goccy/go-json"
+	"github.com/hashicorp/yamux"
+	"go.uber.org/zap"
+
+	"drip/internal/shared/constants"
+	"drip/internal/shared/httputil"
+	"drip/internal/shared/protocol"
+)
+
+// controlStreamTimeout bounds a single request/response exchange on a
+// client-initiated control stream.
+const controlStreamTimeout = 10 * time.Second
+
+// serveControlStreams accepts streams opened by the client on the primary
+// session. Each stream carries exactly one control frame and its reply.
+func (c *Connection) serveControlStreams(session *yamux.Session) {
+	for {
+		stream, err := session.Accept()
+		if err != nil {
+			return
+		}
+		go c.handleControlStream(stream)
+	}
+}
+
+func (c *Connection) handleControlStream(stream net.Conn) {
+	defer stream.Close()
+	_ = stream.SetDeadline(time.Now().Add(controlStreamTimeout))
+
+	frame, err := protocol.ReadFrameLimit(stream, protocol.MaxControlFrameSize)
+	if err != nil {
+		c.logger.Debug("Failed to read control frame", zap.Error(err))
+		return
+	}
+	defer frame.Release()
+
+	errorSender := protocol.NewErrorSender(stream, nil, c.logger)
+
+	switch frame.Type {
+	case protocol.FrameTypeRulesUpdate:
+		c.handleRulesUpdate(stream, frame.Payload)
+	case protocol.FrameTypeP2PWatch:
+		c.handleP2PWatch(stream, errorSender)
+	case protocol.FrameTypeExpiryWatch:
+		c.handleExpiryWatch(stream, errorSender)
+	case protocol.FrameTypeStreamStatsWatch:
+		c.handleStreamStatsWatch(stream, errorSender)
+	case protocol.FrameTypeDrain:
+		c.handleDrain(stream, frame.Payload)
+	case protocol.FrameTypePause:
+		c.handlePause(stream, frame.Payload)
+	case protocol.FrameTypeHeartbeat:
+		c.handleClientState(stream, frame.Payload)
+	default:
+		_ = errorSender.SendError(constants.ErrCodeUnsupported,
+			"Unsupported control frame: "+frame.Type.String())
+	}
+}
+
+func (c *Connection) handleRulesUpdate(stream net.Conn, payload []byte) {
+	var req protocol.RulesUpdateRequest
+	resp := protocol.RulesUpdateResponse{Accepted: true}
+
+	if err := json.Unmarshal(payload, &req); err != nil {
+		resp = protocol.RulesUpdateResponse{Message: "invalid rules update payload"}
+	} else if !c.tunnelType.IsHTTP() {
+		resp = protocol.RulesUpdateResponse{Message: "request rules are only supported for http and https tunnels"}
+	} else if rs, err := httputil.NewRuleSet(req.Rules); err != nil {
+		resp = protocol.RulesUpdateResponse{Message: err.Error()}
+	} else if c.tunnelConn != nil {
+		c.tunnelConn.SetRequestRules(rs)
+		c.logger.Info("Request filtering rules updated",
+			zap.String("subdomain", c.subdomain),
+			zap.Int("rules", len(req.Rules)),
+		)
+	}
+
+	data, err := json.Marshal(resp)
+	if err != nil {
+		return
+	}
+	_ = protocol.WriteFrame(stream, protocol.NewFrame(protocol.FrameTypeRulesUpdateAck, data))
+}
+
+// handleDrain stops new streams on connections the client is about to
+// close. The client waits for their in-flight streams before closing them.
+func (c *Connection) handleDrain(stream net.Conn, payload []byte) {
+	var req protocol.DrainRequest
+	resp := protocol.DrainResponse{Accepted: true}
+
+	var group *ConnectionGroup
+	if c.groupManager != nil {
+		group, _ = c.groupManager.GetGroup(c.tunnelID)
+	}
+
+	if err := json.Unmarshal(payload, &req); err != nil {
+		resp = protocol.DrainResponse{Message: "invalid drain payload"}
+	} else if group == nil {
+		resp = protocol.DrainResponse{Message: "tunnel has no connection group"}
+	} else {
+		n := group.Retire(req.ConnectionIDs, req.All)
+		c.logger.Debug("Draining tunnel connections",
+			zap.String("subdomain", c.subdomain),
+			zap.Bool("all", req.All),
+			zap.Int("connections", n),
+		)
+	}
+
+	data, err := json.Marshal(resp)
+	if err != nil {
+		return
+	}
+	_ = protocol.WriteFrame(stream, protocol.NewFrame(protocol.FrameTypeDrainAck, data))
+}
+
+// handlePause pauses or resumes the tunnel for visitors.
+func (c *Connection) handlePause(stream net.Conn, payload []byte) {
+	var req protocol.PauseRequest
+	resp := protocol.PauseResponse{Accepted: true}
+
+	if err := json.Unmarshal(payload, &req); err != nil {
+		resp = protocol.PauseResponse{Message: "invalid pause payload"}
+	} else if c.tunnelConn == nil {
+		resp = protocol.PauseResponse{Message: "tunnel is not registered"}
+	} else {
+		c.tunnelConn.SetPaused(req.Paused)
+		msg := "Tunnel resumed"
+		if req.Paused {
+			msg = "Tunnel paused"
+		}
+		c.logger.Info(msg,
+			zap.String("subdomain", c.subdomain),
+			zap.Int("port", c.port),
+		)
+	}
+
+	data, err := json.Marshal(resp)
+	if err != nil {
+		return
+	}
+	_ = protocol.WriteFrame(stream, protocol.NewFrame(protocol.FrameTypePauseAck, data))
+}
+
+// handleClientState stores the client state carried by a heartbeat.
+func (c *Connection) handleClientState(stream net.Conn, payload []byte) {
+	c.recordClientState(payload)
+	_ = protocol.WriteFrame(stream, protocol.NewFrame(protocol.FrameTypeHeartbeatAck, []byte("{}")))
+}
+
+// recordClientState stores a heartbeat payload on the tunnel, if there is
+// one.
+func (c *Connection) recordClientState(payload []byte) {
+	if len(payload) == 0 || c.tunnelConn == nil {
+		return
+	}
+	var hb protocol.ClientHeartbeat
+	if err := json.Unmarshal(payload, &hb); err != nil {
+		c.logger.Debug("Invalid heartbeat payload", zap.Error(err))
+		return
+	}
+	c.tunnelConn.SetClientState(hb)
+}
+
+// handleP2PWatch keeps the stream open and forwards direct connection offers
+// for this tunnel until the client closes it or the tunnel goes away.
+func (c *Connection) handleP2PWatch(stream net.Conn, errorSender *protocol.ErrorSender) {
+	if c.p2pBroker == nil {
+		_ = errorSender.SendError(constants.ErrCodeP2PDisabled, "Direct connections are disabled on this server")
+		return
+	}
+	if c.tunnelType != protocol.TunnelTypeTCP || c.port == 0 {
+		_ = errorSender.SendError(constants.ErrCodeUnsupported, "Direct connections are only supported for tcp tunnels")
+		return
+	}
+
+	offers, cancel := c.p2pBroker.Watch(c.port, c.allowVisitor())
+	defer cancel()
+
+	_ = stream.SetDeadline(time.Time{})
+
+	// The client never writes after the watch frame; a read returning
+	// means it closed the stream.
+	closed := make(chan struct{})
+	go func() {
+		_, _ = io.Copy(io.Discard, stream)
+		close(closed)
+	}()
+
+	c.logger.Info("Client accepts direct connections",
+		zap.Int("port", c.port),
+	)
+
+	for {
+		select {
+		case offer := <-offers:
+			data, err := json.Marshal(offer)
+			if err != nil {
+				continue
+			}
+			if err := protocol.WriteFrame(stream, protocol.NewFrame(protocol.FrameTypeP2POffer, data)); err != nil {
+				return
+			}
+		case <-closed:
+			return
+		case <-c.ctx.Done():
+			return
+		}
+	}
+}
@@ -2,6 +2,7 @@ package tcp
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"net"
 	"time"
@@ -10,8 +11,9 @@ import (
 	"github.com/hashicorp/yamux"
 	"go.uber.org/zap"
 
-	"drip/internal/shared/mux"
+	"drip/internal/shared/constants"
 	"drip/internal/shared/protocol"
+	"drip/internal/shared/utils"
 )
 
 // DataConnectionHandler handles data connection requests for multi-connection support.
@@ -20,10 +22,11 @@ type DataConnectionHandler struct {
 	reader           *bufio.Reader
 	authToken        string
 	groupManager     *ConnectionGroupManager
-	stopCh           <-chan struct{}
+	ctx              context.Context
 	logger           *zap.Logger
 	onSessionCreated func(*yamux.Session)
 	onTunnelIDSet    func(string)
+	onAuthFailed     func(tunnelID string)
 }
 
 // NewDataConnectionHandler creates a new data connection handler.
@@ -32,7 +35,7 @@ func NewDataConnectionHandler(
 	reader *bufio.Reader,
 	authToken string,
 	groupManager *ConnectionGroupManager,
-	stopCh <-chan struct{},
+	ctx context.Context,
 	logger *zap.Logger,
 ) *DataConnectionHandler {
 	return &DataConnectionHandler{
@@ -40,7 +43,7 @@ func NewDataConnectionHandler(
 		reader:       reader,
 		authToken:    authToken,
 		groupManager: groupManager,
-		stopCh:       stopCh,
+		ctx:          ctx,
 		logger:       logger,
 	}
 }
@@ -55,12 +58,27 @@ func (h *DataConnectionHandler) SetTunnelIDHandler(handler func(string)) {
 	h.onTunnelIDSet = handler
 }
 
+// SetAuthFailedHandler sets the callback for a data connection rejected
+// for a wrong token.
+func (h *DataConnectionHandler) SetAuthFailedHandler(handler func(tunnelID string)) {
+	h.onAuthFailed = handler
+}
+
+func (h *DataConnectionHandler) authFailed(tunnelID string) error {
+	h.logger.Named(utils.SubsystemAuth).Warn("Data connection authentication failed",
+		zap.String("tunnel_id", tunnelID),
+	)
+	if h.onAuthFailed != nil {
+		h.onAuthFailed(tunnelID)
+	}
+	return h.reject(protocol.NewError(constants.ErrCodeAuthFailed, "Invalid authentication token"))
+}
+
 // Handle processes the data connection request.
 func (h *DataConnectionHandler) Handle(frame *protocol.Frame) error {
 	var req protocol.DataConnectRequest
 	if err := json.Unmarshal(frame.Payload, &req); err != nil {
-		h.sendError("invalid_request", "Failed to parse data connect request")
-		return fmt.Errorf("failed to parse data connect request: %w", err)
+		return h.reject(protocol.Errorf(constants.ErrCodeInvalidRequest, "failed to parse data connect request: %w", err))
 	}
 
 	h.logger.Info("Data connection request received",
@@ -69,24 +87,23 @@ func (h *DataConnectionHandler) Handle(frame *protocol.Frame) error {
 	)
 
 	if h.groupManager == nil {
-		h.sendError("not_supported", "Multi-connection not supported")
-		return fmt.Errorf("group manager not available")
-	}
-
-	if h.authToken != "" && req.Token != h.authToken {
-		h.sendError("authentication_failed", "Invalid authentication token")
-		return fmt.Errorf("authentication failed for data connection")
+		return h.reject(protocol.NewError(constants.ErrCodeUnsupported, "Multi-connection not supported"))
 	}
 
+	// Data connections of a tunnel authenticate with the token it
+	// registered with, so replacing the server token does not cut off
+	// tunnels that are already open.
 	group, ok := h.groupManager.GetGroup(req.TunnelID)
-	if !ok || group == nil {
-		h.sendError("join_failed", "Tunnel not found")
-		return fmt.Errorf("tunnel not found: %s", req.TunnelID)
+	token := h.authToken
+	if ok && group != nil && group.Token != "" {
+		token = group.Token
+	}
+	if token != "" && req.Token != token {
+		return h.authFailed(req.TunnelID)
 	}
 
-	if group.Token != "" && req.Token != group.Token {
-		h.sendError("authentication_failed", "Invalid authentication token")
-		return fmt.Errorf("authentication failed for data connection")
+	if !ok || group == nil {
+		return h.reject(protocol.Errorf(constants.ErrCodeTunnelNotFound, "tunnel not found: %s", req.TunnelID))
 	}
 
 	if h.onTunnelIDSet != nil {
@@ -122,10 +139,7 @@ func (h *DataConnectionHandler) Handle(frame *protocol.Frame) error {
 		reader: h.reader,
 	}
 
-	// Use optimized mux config for server
-	cfg := mux.NewServerConfig()
-
-	session, err := yamux.Client(bc, cfg)
+	session, err := yamux.Client(bc, muxConfig(group.PowerSave()))
 	if err != nil {
 		return fmt.Errorf("failed to init yamux session: %w", err)
 	}
@@ -134,11 +148,11 @@ func (h *DataConnectionHandler) Handle(frame *protocol.Frame) error {
 		h.onSessionCreated(session)
 	}
 
-	group.AddSession(req.ConnectionID, session)
+	group.AddSession(req.ConnectionID, session, bc.Backlog)
 	defer group.RemoveSession(req.ConnectionID)
 
 	select {
-	case <-h.stopCh:
+	case <-h.ctx.Done():
 		return nil
 	case <-session.CloseChan():
 		return nil
@@ -146,16 +160,10 @@ func (h *DataConnectionHandler) Handle(frame *protocol.Frame) error {
 }
 
 // sendError sends an error response to the client.
-func (h *DataConnectionHandler) sendError(code, message string) {
-	resp := protocol.DataConnectResponse{
-		Accepted: false,
-		Message:  fmt.Sprintf("%s: %s", code, message),
-	}
-	respData, err := json.Marshal(resp)
-	if err != nil {
-		h.logger.Error("Failed to marshal data connect error", zap.Error(err))
-		return
+// reject sends err to the client as an error frame and returns it.
+func (h *DataConnectionHandler) reject(err *protocol.Error) error {
+	if frame, ferr := protocol.EncodeError(err); ferr == nil {
+		_ = protocol.WriteFrame(h.conn, frame)
 	}
-	frame := protocol.NewFrame(protocol.FrameTypeDataConnectAck, respData)
-	_ = protocol.WriteFrame(h.conn, frame)
+	return err
 }
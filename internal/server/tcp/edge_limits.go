@@ -0,0 +1,78 @@
+package tcp
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// releaseConn runs release once the connection is closed, for limits
+// that hold a slot for the whole life of a connection. It outlives
+// handleConnection when the connection is handed to the HTTP server.
+type releaseConn struct {
+	net.Conn
+	once    sync.Once
+	release func()
+}
+
+func (c *releaseConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(c.release)
+	return err
+}
+
+// NetConn returns the underlying connection.
+func (c *releaseConn) NetConn() net.Conn {
+	return c.Conn
+}
+
+// minRateHandler makes request bodies arrive at no less than rate bytes
+// per second on average once grace has passed, so a visitor trickling a
+// body cannot hold a tunnel stream open indefinitely. It replaces the
+// server's fixed read timeout for bodies, which larger uploads at a
+// decent rate no longer run into.
+func minRateHandler(next http.Handler, rate int64, grace time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Body != nil && r.Body != http.NoBody {
+			body := &minRateBody{
+				ReadCloser: r.Body,
+				rc:         http.NewResponseController(w),
+				start:      time.Now(),
+				grace:      grace,
+				rate:       rate,
+			}
+			// Not supported over HTTP/3, where the idle timeout has to do.
+			_ = body.rc.SetReadDeadline(body.deadline())
+			r.Body = body
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// minRateBody moves the read deadline of a request along with every read
+// of its body, see minRateHandler.
+type minRateBody struct {
+	io.ReadCloser
+	rc    *http.ResponseController
+	start time.Time
+	grace time.Duration
+	rate  int64
+	read  int64
+}
+
+func (b *minRateBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 && err == nil {
+		b.read += int64(n)
+		_ = b.rc.SetReadDeadline(b.deadline())
+	}
+	return n, err
+}
+
+// deadline returns when the body is too slow if nothing more arrives.
+func (b *minRateBody) deadline() time.Time {
+	due := time.Duration(float64(b.read) / float64(b.rate) * float64(time.Second))
+	return b.start.Add(b.grace + due)
+}
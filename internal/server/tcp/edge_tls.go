@@ -0,0 +1,48 @@
+package tcp
+
+import (
+	"crypto/tls"
+	"strings"
+
+	"drip/internal/server/tunnel"
+)
+
+// withEdgePolicies returns base with a hook applying, per handshake, the
+// edge TLS policy of the tunnel the visitor names by SNI. Handshakes for
+// other names, drip clients included, use base unchanged.
+func (l *Listener) withEdgePolicies(base *tls.Config) *tls.Config {
+	cfg := base.Clone()
+	next := base.GetConfigForClient
+	cfg.GetConfigForClient = func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		c := base
+		if next != nil {
+			nc, err := next(hello)
+			if err != nil {
+				return nil, err
+			}
+			if nc != nil {
+				c = nc
+			}
+		}
+		if tconn, ok := l.tunnelForServerName(hello.ServerName); ok {
+			if policy := tconn.EdgePolicy(); policy != nil && policy.RequiresTLS() {
+				return policy.TLSConfig(c), nil
+			}
+		}
+		return c, nil
+	}
+	return cfg
+}
+
+// tunnelForServerName returns the tunnel serverName, a TLS server name,
+// belongs to.
+func (l *Listener) tunnelForServerName(serverName string) (*tunnel.Connection, bool) {
+	if serverName == "" || l.tunnelDomain == "" {
+		return nil, false
+	}
+	subdomain, ok := strings.CutSuffix(strings.ToLower(serverName), "."+strings.ToLower(l.tunnelDomain))
+	if !ok {
+		return nil, false
+	}
+	return l.manager.Get(subdomain)
+}
@@ -0,0 +1,67 @@
+package tcp
+
+import (
+	"io"
+	"net"
+	"time"
+
+	json "github.com/goccy/go-json"
+	"go.uber.org/zap"
+
+	"drip/internal/shared/constants"
+	"drip/internal/shared/protocol"
+)
+
+// maxTunnelTTL bounds the lifetime a client may request for its tunnel.
+const maxTunnelTTL = 30 * 24 * time.Hour
+
+// enforceTTL closes the tunnel once its TTL runs out.
+func (c *Connection) enforceTTL() {
+	timer := time.NewTimer(time.Until(c.expiresAt))
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		c.logger.Info("Tunnel TTL expired, closing",
+			zap.String("subdomain", c.subdomain),
+			zap.Duration("lifetime", time.Since(c.registeredAt)),
+		)
+		c.Close()
+	case <-c.ctx.Done():
+	}
+}
+
+// handleExpiryWatch holds the stream open and sends a single ExpiryNotice
+// constants.TunnelExpiryWarning before the tunnel's TTL runs out.
+func (c *Connection) handleExpiryWatch(stream net.Conn, errorSender *protocol.ErrorSender) {
+	if c.expiresAt.IsZero() {
+		_ = errorSender.SendError(constants.ErrCodeNoTTL, "Tunnel has no TTL")
+		return
+	}
+
+	_ = stream.SetDeadline(time.Time{})
+
+	closed := make(chan struct{})
+	go func() {
+		_, _ = io.Copy(io.Discard, stream)
+		close(closed)
+	}()
+
+	timer := time.NewTimer(time.Until(c.expiresAt.Add(-constants.TunnelExpiryWarning)))
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+	case <-closed:
+		return
+	case <-c.ctx.Done():
+		return
+	}
+
+	data, err := json.Marshal(protocol.ExpiryNotice{ExpiresAt: c.expiresAt.Unix()})
+	if err != nil {
+		return
+	}
+	_ = stream.SetWriteDeadline(time.Now().Add(controlStreamTimeout))
+	_ = protocol.WriteFrame(stream, protocol.NewFrame(protocol.FrameTypeExpiryNotice, data))
+}
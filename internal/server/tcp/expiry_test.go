@@ -0,0 +1,61 @@
+package tcp
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	json "github.com/goccy/go-json"
+	"go.uber.org/zap"
+
+	"drip/internal/shared/protocol"
+)
+
+func TestHandleExpiryWatch(t *testing.T) {
+	tests := []struct {
+		name      string
+		expiresAt time.Time
+		wantType  protocol.FrameType
+	}{
+		{"no ttl", time.Time{}, protocol.FrameTypeError},
+		{"inside warning window", time.Now().Add(time.Minute), protocol.FrameTypeExpiryNotice},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, client := net.Pipe()
+			defer client.Close()
+
+			c := &Connection{
+				expiresAt: tt.expiresAt,
+				ctx:       context.Background(),
+				logger:    zap.NewNop(),
+			}
+			go func() {
+				defer server.Close()
+				c.handleExpiryWatch(server, protocol.NewErrorSender(server, nil, c.logger))
+			}()
+
+			_ = client.SetDeadline(time.Now().Add(2 * time.Second))
+			frame, err := protocol.ReadFrame(client)
+			if err != nil {
+				t.Fatalf("ReadFrame() error = %v", err)
+			}
+			defer frame.Release()
+
+			if frame.Type != tt.wantType {
+				t.Fatalf("frame type = %s, want %s", frame.Type, tt.wantType)
+			}
+			if frame.Type == protocol.FrameTypeExpiryNotice {
+				var notice protocol.ExpiryNotice
+				if err := json.Unmarshal(frame.Payload, &notice); err != nil {
+					t.Fatalf("Unmarshal() error = %v", err)
+				}
+				if notice.ExpiresAt != tt.expiresAt.Unix() {
+					t.Errorf("ExpiresAt = %d, want %d", notice.ExpiresAt, tt.expiresAt.Unix())
+				}
+			}
+		})
+	}
+}
@@ -1,48 +1,48 @@
 package tcp
 
 import (
-	"bufio"
+	"context"
+	"errors"
 	"fmt"
-	"net"
-	"time"
+	"io"
 
 	"drip/internal/shared/constants"
 	"drip/internal/shared/protocol"
 	"go.uber.org/zap"
 )
 
+// frameBatchSize caps the frames FrameHandler takes from one read.
+const frameBatchSize = 16
+
 // FrameHandler handles protocol frame reading and processing.
 type FrameHandler struct {
-	conn        net.Conn
-	reader      *bufio.Reader
-	stopCh      <-chan struct{}
+	ctx         context.Context
+	reader      *protocol.FrameReader
 	logger      *zap.Logger
 	frameWriter *protocol.FrameWriter
 
 	// Heartbeat tracking
-	onHeartbeat func()
+	onHeartbeat func(payload []byte)
 	onClose     func()
 }
 
 // NewFrameHandler creates a new frame handler.
 func NewFrameHandler(
-	conn net.Conn,
-	reader *bufio.Reader,
-	stopCh <-chan struct{},
+	ctx context.Context,
+	reader *protocol.FrameReader,
 	frameWriter *protocol.FrameWriter,
 	logger *zap.Logger,
 ) *FrameHandler {
 	return &FrameHandler{
-		conn:        conn,
+		ctx:         ctx,
 		reader:      reader,
-		stopCh:      stopCh,
 		frameWriter: frameWriter,
 		logger:      logger,
 	}
 }
 
 // SetHeartbeatHandler sets the callback for heartbeat frames.
-func (fh *FrameHandler) SetHeartbeatHandler(handler func()) {
+func (fh *FrameHandler) SetHeartbeatHandler(handler func(payload []byte)) {
 	fh.onHeartbeat = handler
 }
 
@@ -51,27 +51,34 @@ func (fh *FrameHandler) SetCloseHandler(handler func()) {
 	fh.onClose = handler
 }
 
-// HandleFrames processes incoming frames in a loop.
+// HandleFrames processes incoming frames in a loop, taking whatever
+// frames have arrived together in one batch.
 func (fh *FrameHandler) HandleFrames() error {
+	fh.reader.SetMaxFrameSize(protocol.MaxControlFrameSize)
+	fh.reader.SetFrameTimeout(constants.RequestTimeout)
+
+	batch := make([]*protocol.Frame, 0, frameBatchSize)
 	for {
-		select {
-		case <-fh.stopCh:
+		if fh.ctx.Err() != nil {
 			return nil
-		default:
 		}
 
-		fh.conn.SetReadDeadline(time.Now().Add(constants.RequestTimeout))
-		frame, err := protocol.ReadFrame(fh.reader)
+		frames, err := fh.reader.ReadBatch(batch[:0])
 		if err != nil {
 			return fh.handleReadError(err)
 		}
 
-		sf := protocol.WithFrame(frame)
-		err = fh.processFrame(sf)
-		sf.Close()
-
-		if err != nil {
-			return err
+		for i, frame := range frames {
+			sf := protocol.WithFrame(frame)
+			err = fh.processFrame(sf)
+			sf.Close()
+
+			if err != nil {
+				for _, rest := range frames[i+1:] {
+					rest.Release()
+				}
+				return err
+			}
 		}
 	}
 }
@@ -83,18 +90,16 @@ func (fh *FrameHandler) handleReadError(err error) error {
 		return fmt.Errorf("read timeout")
 	}
 
-	if err.Error() == "failed to read frame header: EOF" || err.Error() == "EOF" {
+	if errors.Is(err, io.EOF) {
 		fh.logger.Info("Client disconnected")
 		return nil
 	}
 
-	select {
-	case <-fh.stopCh:
+	if fh.ctx.Err() != nil {
 		fh.logger.Debug("Connection closed during shutdown")
 		return nil
-	default:
-		return fmt.Errorf("failed to read frame: %w", err)
 	}
+	return fmt.Errorf("failed to read frame: %w", err)
 }
 
 // processFrame processes a single frame based on its type.
@@ -102,7 +107,7 @@ func (fh *FrameHandler) processFrame(sf *protocol.SafeFrame) error {
 	switch sf.Frame.Type {
 	case protocol.FrameTypeHeartbeat:
 		if fh.onHeartbeat != nil {
-			fh.onHeartbeat()
+			fh.onHeartbeat(sf.Frame.Payload)
 		}
 		return nil
 
@@ -0,0 +1,38 @@
+package tcp
+
+import "runtime"
+
+// ListenerHealth is a snapshot of the listener for liveness and readiness
+// probes.
+type ListenerHealth struct {
+	Listening   bool `json:"listening"`
+	Draining    bool `json:"draining"`
+	Connections int  `json:"connections"`
+	Tunnels     int  `json:"tunnels"`
+	Goroutines  int  `json:"goroutines"`
+
+	PortsTotal int `json:"ports_total"`
+	PortsUsed  int `json:"ports_used"`
+
+	WorkerQueueDepth int `json:"worker_queue_depth"`
+}
+
+// Health reports the listener's current state.
+func (l *Listener) Health() ListenerHealth {
+	h := ListenerHealth{
+		Listening:   l.listening.Load(),
+		Draining:    l.draining.Load(),
+		Connections: l.GetActiveConnections(),
+		Goroutines:  runtime.NumGoroutine(),
+	}
+	if l.manager != nil {
+		h.Tunnels = l.manager.Count()
+	}
+	if l.portAlloc != nil {
+		h.PortsTotal, h.PortsUsed = l.portAlloc.Capacity()
+	}
+	if l.workerPool != nil {
+		h.WorkerQueueDepth = l.workerPool.Stats().Queued
+	}
+	return h
+}
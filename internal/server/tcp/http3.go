@@ -0,0 +1,129 @@
+package tcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+	"go.uber.org/zap"
+
+	"drip/internal/shared/netutil"
+)
+
+// altSvcMaxAge is how long visitors may remember that HTTP/3 is offered.
+// Browsers fall back to TCP on their own if it goes away sooner.
+const altSvcMaxAge = 24 * time.Hour
+
+// SetHTTP3 also serves visitors over HTTP/3 on the listener's port in UDP
+// and advertises it with Alt-Svc on HTTP/1.1 and HTTP/2 responses. It only
+// applies in TLS mode; tunnels keep their own transport either way.
+func (l *Listener) SetHTTP3(enabled bool) {
+	l.http3 = enabled
+}
+
+// HTTP3Addr returns the UDP address HTTP/3 is served on, or nil.
+func (l *Listener) HTTP3Addr() net.Addr {
+	if l.http3Conn == nil {
+		return nil
+	}
+	return l.http3Conn.LocalAddr()
+}
+
+// startHTTP3 listens on the TCP listener's port in UDP and serves the HTTP
+// handler there. It must run before the HTTP server starts, as it wraps
+// that server's handler to add the Alt-Svc header.
+func (l *Listener) startHTTP3() error {
+	host, _, err := net.SplitHostPort(l.address)
+	if err != nil {
+		return fmt.Errorf("invalid listen address %q: %w", l.address, err)
+	}
+	_, port, err := net.SplitHostPort(l.listener.Addr().String())
+	if err != nil {
+		return err
+	}
+	pc, err := net.ListenPacket("udp", net.JoinHostPort(host, port))
+	if err != nil {
+		return fmt.Errorf("failed to start HTTP/3 listener: %w", err)
+	}
+
+	ln, err := quic.ListenEarly(pc, http3.ConfigureTLSConfig(l.tlsConfig), &quic.Config{
+		MaxIncomingStreams: 1000,
+		MaxIdleTimeout:     120 * time.Second,
+	})
+	if err != nil {
+		_ = pc.Close()
+		return fmt.Errorf("failed to start HTTP/3 listener: %w", err)
+	}
+
+	l.http3Conn = pc
+	l.http3Server = &http3.Server{
+		Handler:        l.httpHandler,
+		MaxHeaderBytes: l.httpServer.MaxHeaderBytes,
+		IdleTimeout:    120 * time.Second,
+	}
+
+	// Visitors reach the public port, which differs from ours behind a
+	// port mapping.
+	altPort := l.publicPort
+	if altPort == 0 {
+		altPort, _ = strconv.Atoi(port)
+	}
+	altSvc := fmt.Sprintf(`h3=":%d"; ma=%d`, altPort, int(altSvcMaxAge.Seconds()))
+	next := l.httpServer.Handler
+	l.httpServer.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Alt-Svc", altSvc)
+		next.ServeHTTP(w, r)
+	})
+
+	l.wg.Add(1)
+	go func() {
+		defer l.wg.Done()
+		if err := l.http3Server.ServeListener(&http3Listener{EarlyListener: ln, l: l}); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			l.logger.Error("HTTP/3 server error", zap.Error(err))
+		}
+	}()
+
+	l.logger.Info("HTTP/3 enabled",
+		zap.String("address", pc.LocalAddr().String()),
+		zap.String("alt_svc", altSvc),
+	)
+	return nil
+}
+
+// stopHTTP3 lets in-flight HTTP/3 requests finish until ctx is done.
+func (l *Listener) stopHTTP3(ctx context.Context) {
+	if l.http3Server == nil {
+		return
+	}
+	if err := l.http3Server.Shutdown(ctx); err != nil {
+		l.logger.Warn("HTTP/3 server shutdown error", zap.Error(err))
+	}
+	_ = l.http3Conn.Close()
+}
+
+// http3Listener drops banned peers before serving them, like acceptLoop
+// does for TCP.
+type http3Listener struct {
+	*quic.EarlyListener
+	l *Listener
+}
+
+func (h *http3Listener) Accept(ctx context.Context) (*quic.Conn, error) {
+	for {
+		conn, err := h.EarlyListener.Accept(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if h.l.banList.IsBanned(netutil.ExtractIP(conn.RemoteAddr().String())) {
+			_ = conn.CloseWithError(0, "")
+			continue
+		}
+		return conn, nil
+	}
+}
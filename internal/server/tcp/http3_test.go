@@ -0,0 +1,66 @@
+package tcp
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go/http3"
+	"go.uber.org/zap"
+
+	servertls "drip/internal/server/tls"
+)
+
+func TestListenerHTTP3(t *testing.T) {
+	cert, err := servertls.SelfSigned("localhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := NewListener(ListenerConfig{
+		Address:    "127.0.0.1:0",
+		TLSConfig:  &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS13},
+		Logger:     zap.NewNop(),
+		PublicPort: 443,
+		HTTPHandler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = io.WriteString(w, r.Proto)
+		}),
+	})
+	l.SetHTTP3(true)
+	if err := l.Start(); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = l.Shutdown(ctx)
+	})
+
+	clientTLS := &tls.Config{InsecureSkipVerify: true}
+
+	// Over TCP, responses point visitors at the public port.
+	tcpClient := &http.Client{Timeout: 5 * time.Second, Transport: &http.Transport{TLSClientConfig: clientTLS}}
+	resp, err := tcpClient.Get("https://" + l.listener.Addr().String() + "/")
+	if err != nil {
+		t.Fatalf("GET over TCP: %v", err)
+	}
+	resp.Body.Close()
+	if got := resp.Header.Get("Alt-Svc"); !strings.HasPrefix(got, `h3=":443"`) {
+		t.Errorf("Alt-Svc = %q, want h3 on port 443", got)
+	}
+
+	h3Client := &http.Client{Timeout: 5 * time.Second, Transport: &http3.Transport{TLSClientConfig: clientTLS}}
+	defer h3Client.CloseIdleConnections()
+	resp, err = h3Client.Get("https://" + l.HTTP3Addr().String() + "/")
+	if err != nil {
+		t.Fatalf("GET over HTTP/3: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != "HTTP/3.0" {
+		t.Errorf("handler saw %q, want HTTP/3.0", body)
+	}
+}
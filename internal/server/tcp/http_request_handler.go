@@ -2,7 +2,6 @@ package tcp
 
 import (
 	"bufio"
-	"errors"
 	"fmt"
 	"io"
 	"net"
@@ -12,6 +11,10 @@ import (
 	"time"
 
 	"go.uber.org/zap"
+
+	"drip/internal/shared/constants"
+	"drip/internal/shared/protocol"
+	"drip/internal/shared/utils"
 )
 
 // bufioWriterPool reuses bufio.Writer instances to reduce GC pressure
@@ -116,17 +119,12 @@ func (h *HTTPRequestHandler) handleLegacy() error {
 				h.logger.Debug("HTTP keep-alive timeout")
 				return nil
 			}
-			errStr := err.Error()
-			if errors.Is(err, net.ErrClosed) || strings.Contains(errStr, "use of closed network connection") {
-				h.logger.Debug("HTTP connection closed during read", zap.Error(err))
-				return nil
-			}
-			if strings.Contains(errStr, "connection reset by peer") ||
-				strings.Contains(errStr, "broken pipe") ||
-				strings.Contains(errStr, "connection refused") {
+			if utils.IsNetworkError(err) {
 				h.logger.Debug("Client disconnected abruptly", zap.Error(err))
 				return nil
 			}
+			// net/http reports malformed requests only as text.
+			errStr := err.Error()
 			if strings.Contains(errStr, "malformed HTTP") {
 				h.logger.Warn("Received malformed HTTP request",
 					zap.Error(err),
@@ -135,7 +133,7 @@ func (h *HTTPRequestHandler) handleLegacy() error {
 				return nil
 			}
 			h.logger.Error("Failed to parse HTTP request", zap.Error(err))
-			return fmt.Errorf("failed to parse HTTP request: %w", err)
+			return protocol.Errorf(constants.ErrCodeInvalidRequest, "failed to parse HTTP request: %w", err)
 		}
 
 		if h.ctx != nil {
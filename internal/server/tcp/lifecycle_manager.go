@@ -7,17 +7,23 @@ import (
 	"github.com/hashicorp/yamux"
 	"go.uber.org/zap"
 
+	"drip/internal/server/ports"
 	"drip/internal/server/tunnel"
 	"drip/internal/shared/protocol"
 )
 
-// ConnectionLifecycleManager manages the lifecycle of a connection.
+// ConnectionLifecycleManager manages the lifecycle of a connection. Close
+// may be called from another goroutine than the one setting the
+// resources, e.g. when a resuming client evicts a stale tunnel.
 type ConnectionLifecycleManager struct {
 	once   sync.Once
-	stopCh chan struct{}
 	cancel func()
 	logger *zap.Logger
 
+	// mu guards the resources below and closed.
+	mu     sync.Mutex
+	closed bool
+
 	// Resources to clean up
 	conn interface {
 		Close() error
@@ -26,7 +32,7 @@ type ConnectionLifecycleManager struct {
 	frameWriter  *protocol.FrameWriter
 	proxy        interface{ Stop() }
 	session      *yamux.Session
-	portAlloc    *PortAllocator
+	portAlloc    *ports.Allocator
 	port         int
 	manager      *tunnel.Manager
 	subdomain    string
@@ -36,12 +42,10 @@ type ConnectionLifecycleManager struct {
 
 // NewConnectionLifecycleManager creates a new lifecycle manager.
 func NewConnectionLifecycleManager(
-	stopCh chan struct{},
 	cancel func(),
 	logger *zap.Logger,
 ) *ConnectionLifecycleManager {
 	return &ConnectionLifecycleManager{
-		stopCh: stopCh,
 		cancel: cancel,
 		logger: logger,
 	}
@@ -52,26 +56,48 @@ func (clm *ConnectionLifecycleManager) SetConnection(conn interface {
 	Close() error
 	SetDeadline(time.Time) error
 }) {
+	clm.mu.Lock()
+	defer clm.mu.Unlock()
 	clm.conn = conn
 }
 
 // SetFrameWriter sets the frame writer to close.
 func (clm *ConnectionLifecycleManager) SetFrameWriter(fw *protocol.FrameWriter) {
+	clm.mu.Lock()
+	defer clm.mu.Unlock()
 	clm.frameWriter = fw
 }
 
-// SetProxy sets the proxy to stop.
+// SetProxy sets the proxy to stop. A proxy set after Close is stopped at
+// once.
 func (clm *ConnectionLifecycleManager) SetProxy(proxy interface{ Stop() }) {
-	clm.proxy = proxy
+	clm.mu.Lock()
+	if !clm.closed {
+		clm.proxy = proxy
+		clm.mu.Unlock()
+		return
+	}
+	clm.mu.Unlock()
+	proxy.Stop()
 }
 
-// SetSession sets the yamux session to close.
+// SetSession sets the yamux session to close. A session set after Close
+// is closed at once.
 func (clm *ConnectionLifecycleManager) SetSession(session *yamux.Session) {
-	clm.session = session
+	clm.mu.Lock()
+	if !clm.closed {
+		clm.session = session
+		clm.mu.Unlock()
+		return
+	}
+	clm.mu.Unlock()
+	_ = session.Close()
 }
 
 // SetPortAllocation sets the port allocation to release.
-func (clm *ConnectionLifecycleManager) SetPortAllocation(portAlloc *PortAllocator, port int) {
+func (clm *ConnectionLifecycleManager) SetPortAllocation(portAlloc *ports.Allocator, port int) {
+	clm.mu.Lock()
+	defer clm.mu.Unlock()
 	clm.portAlloc = portAlloc
 	clm.port = port
 }
@@ -83,6 +109,8 @@ func (clm *ConnectionLifecycleManager) SetTunnelRegistration(
 	tunnelID string,
 	groupManager *ConnectionGroupManager,
 ) {
+	clm.mu.Lock()
+	defer clm.mu.Unlock()
 	clm.manager = manager
 	clm.subdomain = subdomain
 	clm.tunnelID = tunnelID
@@ -92,46 +120,52 @@ func (clm *ConnectionLifecycleManager) SetTunnelRegistration(
 // Close closes the connection and cleans up all resources.
 func (clm *ConnectionLifecycleManager) Close() {
 	clm.once.Do(func() {
+		clm.mu.Lock()
+		clm.closed = true
+		conn, frameWriter, proxy, session := clm.conn, clm.frameWriter, clm.proxy, clm.session
+		portAlloc, port := clm.portAlloc, clm.port
+		manager, subdomain, tunnelID, groupManager := clm.manager, clm.subdomain, clm.tunnelID, clm.groupManager
+		clm.mu.Unlock()
+
 		protocol.UnregisterConnection()
-		close(clm.stopCh)
 
 		if clm.cancel != nil {
 			clm.cancel()
 		}
 
-		if clm.conn != nil {
-			_ = clm.conn.SetDeadline(time.Now())
+		if conn != nil {
+			_ = conn.SetDeadline(time.Now())
 		}
 
-		if clm.frameWriter != nil {
-			clm.frameWriter.Close()
+		if frameWriter != nil {
+			frameWriter.Close()
 		}
 
-		if clm.proxy != nil {
-			clm.proxy.Stop()
+		if proxy != nil {
+			proxy.Stop()
 		}
 
-		if clm.session != nil {
-			_ = clm.session.Close()
+		if session != nil {
+			_ = session.Close()
 		}
 
-		if clm.conn != nil {
-			clm.conn.Close()
+		if conn != nil {
+			conn.Close()
 		}
 
-		if clm.port > 0 && clm.portAlloc != nil {
-			clm.portAlloc.Release(clm.port)
+		if port > 0 && portAlloc != nil {
+			portAlloc.Release(port)
 		}
 
-		if clm.subdomain != "" && clm.manager != nil {
-			clm.manager.Unregister(clm.subdomain)
-			if clm.tunnelID != "" && clm.groupManager != nil {
-				clm.groupManager.RemoveGroup(clm.tunnelID)
+		if subdomain != "" && manager != nil {
+			manager.Unregister(subdomain)
+			if tunnelID != "" && groupManager != nil {
+				groupManager.RemoveGroup(tunnelID)
 			}
 		}
 
 		clm.logger.Info("Connection closed",
-			zap.String("subdomain", clm.subdomain),
+			zap.String("subdomain", subdomain),
 		)
 	})
 }
@@ -3,21 +3,36 @@ package tcp
 import (
 	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"net"
 	"net/http"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"drip/internal/server/abuse"
+	"drip/internal/server/audit"
+	"drip/internal/server/geoip"
+	"drip/internal/server/hooks"
 	"drip/internal/server/metrics"
+	"drip/internal/server/p2p"
+	"drip/internal/server/ports"
 	"drip/internal/server/proxy"
 	"drip/internal/server/tunnel"
+	"drip/internal/shared/chaos"
+	"drip/internal/shared/constants"
+	"drip/internal/shared/httputil"
 	"drip/internal/shared/netutil"
 	"drip/internal/shared/pool"
+	"drip/internal/shared/protocol"
 	"drip/internal/shared/recovery"
 	"drip/internal/shared/utils"
 
+	"github.com/quic-go/quic-go/http3"
 	"go.uber.org/zap"
 	"golang.org/x/net/http2"
 )
@@ -28,27 +43,30 @@ type ListenerConfig struct {
 	AuthToken    string
 	Manager      *tunnel.Manager
 	Logger       *zap.Logger
-	PortAlloc    *PortAllocator
+	PortAlloc    *ports.Allocator
 	Domain       string
 	TunnelDomain string
 	PublicPort   int
 	HTTPHandler  http.Handler
+
+	// WorkerPool sizes the connection worker pool. Zero values use
+	// defaults derived from the CPU count.
+	WorkerPool pool.Config
 }
 
 type Listener struct {
 	address      string
 	tlsConfig    *tls.Config
+	authMu       sync.RWMutex
 	authToken    string
 	manager      *tunnel.Manager
-	portAlloc    *PortAllocator
+	portAlloc    *ports.Allocator
 	logger       *zap.Logger
 	domain       string
 	tunnelDomain string
 	publicPort   int
 	httpHandler  http.Handler
 	listener     net.Listener
-	stopCh       chan struct{}
-	stopOnce     sync.Once
 	wg           sync.WaitGroup
 	connections  map[string]*Connection
 	connMu       sync.RWMutex
@@ -64,25 +82,94 @@ type Listener struct {
 	allowedTunnelTypes []string
 	bandwidth          int64
 	burstMultiplier    float64
+
+	acceptProxyProtocol bool
+	chaos               *chaos.Config
+	banList             *abuse.BanList
+	acceptLimiter       *abuse.AcceptLimiter
+	headerTimeout       time.Duration
+	minTransferRate     int64
+	p2pBroker           *p2p.Broker
+	maxHeaderListSize   int
+	hooks               hooks.Hooks
+	audit               *audit.Log
+	geoip               *geoip.DB
+	versionPolicy       VersionPolicy
+	bindAddrs           []string
+	ssh                 *SSHConfig
+	sshListener         net.Listener
+	http3               bool
+	http3Server         *http3.Server
+	http3Conn           net.PacketConn
+
+	// ctx is the parent of every connection's context; cancelling it
+	// closes all tunnels.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	shutdownOnce sync.Once
+	shutdownErr  error
+
+	listening atomic.Bool
+	draining  atomic.Bool
+}
+
+// proxyHeaderTimeout bounds how long a peer may take to send its PROXY header.
+const proxyHeaderTimeout = 5 * time.Second
+
+// tlsHandshakeTimeout bounds how long a peer may take to complete the TLS
+// handshake.
+const tlsHandshakeTimeout = 10 * time.Second
+
+// httpALPN are the protocols visitors are offered by ALPN unless the TLS
+// config names others.
+var httpALPN = []string{"h2", "http/1.1"}
+
+// withALPN returns cfg offering protocol.ALPN ahead of its HTTP protocols,
+// so the control protocol and visitors' HTTPS share the port and are
+// routed by what the handshake negotiated. Peers that negotiate nothing,
+// such as older clients, are still told apart by what they send first.
+func withALPN(cfg *tls.Config) *tls.Config {
+	protos := cfg.NextProtos
+	if len(protos) == 0 {
+		protos = httpALPN
+	}
+	cfg = cfg.Clone()
+	cfg.NextProtos = append([]string{protocol.ALPN}, slices.DeleteFunc(slices.Clone(protos), func(p string) bool {
+		return p == protocol.ALPN
+	})...)
+	return cfg
 }
 
+// defaultHeaderTimeout bounds how long a visitor may take to send its
+// request headers unless SetHeaderTimeout says otherwise.
+const defaultHeaderTimeout = 10 * time.Second
+
 func NewListener(cfg ListenerConfig) *Listener {
+	poolCfg := cfg.WorkerPool
 	numCPU := pool.NumCPU()
-	workers := numCPU * 5
-	queueSize := workers * 20
-	workerPool := pool.NewWorkerPool(workers, queueSize)
+	if poolCfg.MinWorkers <= 0 {
+		poolCfg.MinWorkers = numCPU * 5
+	}
+	if poolCfg.MaxWorkers <= 0 {
+		poolCfg.MaxWorkers = poolCfg.MinWorkers * 4
+	}
+	if poolCfg.QueueSize <= 0 {
+		poolCfg.QueueSize = poolCfg.MinWorkers * 20
+	}
+	workerPool := pool.NewWorkerPoolWithConfig(poolCfg)
 
 	cfg.Logger.Info("Worker pool configured",
 		zap.Int("cpu_cores", numCPU),
-		zap.Int("workers", workers),
-		zap.Int("queue_size", queueSize),
+		zap.Int("min_workers", poolCfg.MinWorkers),
+		zap.Int("max_workers", poolCfg.MaxWorkers),
+		zap.Int("queue_size", poolCfg.QueueSize),
+		zap.String("overload_policy", string(workerPool.Policy())),
 	)
 
 	panicMetrics := recovery.NewPanicMetrics(cfg.Logger, nil)
 	recoverer := recovery.NewRecoverer(cfg.Logger, panicMetrics)
-
-	// Initialize worker pool metrics
-	metrics.WorkerPoolSize.Set(float64(workers))
+	ctx, cancel := context.WithCancel(context.Background())
 
 	l := &Listener{
 		address:      cfg.Address,
@@ -95,12 +182,13 @@ func NewListener(cfg ListenerConfig) *Listener {
 		tunnelDomain: cfg.TunnelDomain,
 		publicPort:   cfg.PublicPort,
 		httpHandler:  cfg.HTTPHandler,
-		stopCh:       make(chan struct{}),
 		connections:  make(map[string]*Connection),
 		workerPool:   workerPool,
 		recoverer:    recoverer,
 		panicMetrics: panicMetrics,
 		groupManager: NewConnectionGroupManager(cfg.Logger),
+		ctx:          ctx,
+		cancel:       cancel,
 	}
 
 	// Set up WebSocket connection handler if httpHandler supports it
@@ -109,41 +197,66 @@ func NewListener(cfg ListenerConfig) *Listener {
 		h.SetPublicPort(cfg.PublicPort)
 	}
 
+	if l.tlsConfig != nil {
+		l.tlsConfig = l.withEdgePolicies(withALPN(l.tlsConfig))
+	}
+
 	return l
 }
 
 func (l *Listener) Start() error {
-	var err error
+	ln, err := net.Listen("tcp", l.address)
+	if err != nil {
+		return fmt.Errorf("failed to start TCP listener: %w", err)
+	}
+
+	ln = l.chaos.Listener(ln)
 
-	// Support both TLS and plain TCP modes
+	// PROXY headers precede the TLS handshake, so unwrap them first.
+	if l.acceptProxyProtocol {
+		ln = netutil.NewProxyProtoListener(ln, proxyHeaderTimeout)
+		l.logger.Info("PROXY protocol enabled on listener",
+			zap.String("address", l.address),
+		)
+	}
+
+	// Support both TLS and plain TCP modes. In TLS mode handshakes happen
+	// per connection, after routing TLS tunnels by SNI.
+	l.listener = ln
 	if l.tlsConfig != nil {
-		l.listener, err = tls.Listen("tcp", l.address, l.tlsConfig)
-		if err != nil {
-			return fmt.Errorf("failed to start TLS listener: %w", err)
-		}
 		l.logger.Info("TCP listener started (TLS mode)",
 			zap.String("address", l.address),
-			zap.String("tls_version", "TLS 1.3"),
+			zap.String("min_tls_version", tls.VersionName(l.tlsConfig.MinVersion)),
+			zap.Strings("alpn", l.tlsConfig.NextProtos),
 		)
 	} else {
-		l.listener, err = net.Listen("tcp", l.address)
-		if err != nil {
-			return fmt.Errorf("failed to start TCP listener: %w", err)
-		}
 		l.logger.Info("TCP listener started (plain mode - for reverse proxy)",
 			zap.String("address", l.address),
 		)
 	}
 
 	l.httpListener = newConnQueueListener(l.listener.Addr(), 4096)
+	l.listening.Store(true)
+
+	headerTimeout := l.headerTimeout
+	if headerTimeout <= 0 {
+		headerTimeout = defaultHeaderTimeout
+	}
+	if l.minTransferRate > 0 {
+		l.httpHandler = minRateHandler(l.httpHandler, l.minTransferRate, headerTimeout)
+	}
 
 	l.httpServer = &http.Server{
 		Handler:           l.httpHandler,
-		ReadHeaderTimeout: 10 * time.Second,  // Time to read request headers
+		ReadHeaderTimeout: headerTimeout,     // Time to read request headers
 		ReadTimeout:       30 * time.Second,  // Total time to read request (prevents slow-loris)
 		WriteTimeout:      60 * time.Second,  // Time to write response (allows large responses)
 		IdleTimeout:       120 * time.Second, // Keep-alive timeout
-		MaxHeaderBytes:    1 << 18,           // 256KB max header size (reduced from 1MB)
+		MaxHeaderBytes:    l.maxHeaderListSize,
+		ConnContext:       netutil.ContextWithTLSState,
+	}
+	if l.httpServer.MaxHeaderBytes <= 0 {
+		l.httpServer.MaxHeaderBytes = httputil.DefaultMaxHeaderListSize
 	}
 
 	if err := http2.ConfigureServer(l.httpServer, &http2.Server{
@@ -153,6 +266,13 @@ func (l *Listener) Start() error {
 		l.logger.Warn("Failed to configure HTTP/2", zap.Error(err))
 	}
 
+	if l.http3 && l.tlsConfig != nil {
+		if err := l.startHTTP3(); err != nil {
+			_ = l.listener.Close()
+			return err
+		}
+	}
+
 	l.wg.Add(1)
 	go func() {
 		defer l.wg.Done()
@@ -165,59 +285,143 @@ func (l *Listener) Start() error {
 	l.wg.Add(1)
 	go l.acceptLoop()
 
+	// Banning may be turned on later by a config reload.
+	if l.banList != nil {
+		l.wg.Add(1)
+		go l.banCleanupLoop()
+	}
+
+	l.wg.Add(1)
+	go l.poolMetricsLoop()
+
+	if l.ssh != nil {
+		if err := l.startSSH(); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
-func (l *Listener) acceptLoop() {
+// poolMetricsLoop publishes worker and buffer pool stats and frame writer
+// batching. Counters are exported as deltas since the pools keep their own
+// cumulative totals.
+func (l *Listener) poolMetricsLoop() {
 	defer l.wg.Done()
-	defer l.recoverer.Recover("acceptLoop")
 
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+
+	var last pool.Stats
+	var lastBuf pool.BufferPoolStats
 	for {
+		bufStats := pool.GetBufferPoolStats()
+		for i, b := range bufStats.Buckets {
+			prev := lastBuf.Buckets[i]
+			bucket := strconv.Itoa(b.Size)
+			metrics.BufferPoolGets.WithLabelValues(bucket, "hit").Add(counterDelta(b.Hits(), prev.Hits()))
+			metrics.BufferPoolGets.WithLabelValues(bucket, "miss").Add(counterDelta(b.Misses, prev.Misses))
+			metrics.BufferPoolDrops.WithLabelValues(bucket).Add(counterDelta(b.Drops, prev.Drops))
+		}
+		metrics.BufferPoolOversize.Add(counterDelta(bufStats.Oversize, lastBuf.Oversize))
+		metrics.BufferPoolAdaptiveThreshold.Set(float64(bufStats.AdaptiveThreshold))
+		lastBuf = bufStats
+
+		batchStats := protocol.GetBatchStats()
+		metrics.FrameWriterBatchSize.Set(batchStats.BatchSize)
+		metrics.FrameWriterBatchWait.Set(batchStats.BatchWait.Seconds())
+		metrics.FrameWriterWriteLatency.Set(batchStats.WriteLatency.Seconds())
+
+		stats := l.workerPool.Stats()
+		metrics.WorkerPoolSize.Set(float64(stats.Workers))
+		metrics.WorkerPoolActiveWorkers.Set(float64(stats.Busy))
+		metrics.WorkerPoolQueueDepth.Set(float64(stats.Queued))
+		metrics.WorkerPoolQueueLatency.Set(stats.QueueLatency.Seconds())
+		metrics.WorkerPoolSubmitted.Add(counterDelta(stats.Submitted, last.Submitted))
+		metrics.WorkerPoolRejected.Add(counterDelta(stats.Rejected, last.Rejected))
+		metrics.WorkerPoolFallback.Add(counterDelta(stats.Fallback, last.Fallback))
+		last = stats
+
 		select {
-		case <-l.stopCh:
+		case <-l.ctx.Done():
 			return
-		default:
+		case <-ticker.C:
 		}
+	}
+}
+
+func (l *Listener) banCleanupLoop() {
+	defer l.wg.Done()
+
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
 
-		if tcpListener, ok := l.listener.(*net.TCPListener); ok {
-			tcpListener.SetDeadline(time.Now().Add(1 * time.Second))
+	for {
+		select {
+		case <-l.ctx.Done():
+			return
+		case <-ticker.C:
+			l.banList.Cleanup()
 		}
+	}
+}
+
+func (l *Listener) acceptLoop() {
+	defer l.wg.Done()
+	defer l.recoverer.Recover("acceptLoop")
 
+	for {
 		conn, err := l.listener.Accept()
 		if err != nil {
-			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
-				continue
-			}
-			select {
-			case <-l.stopCh:
+			if errors.Is(err, net.ErrClosed) {
 				return
-			default:
-				l.logger.Error("Failed to accept connection", zap.Error(err))
-				continue
 			}
+			l.logger.Error("Failed to accept connection", zap.Error(err))
+			continue
+		}
+
+		// Drop banned peers before spending any CPU on TLS.
+		if l.banList.IsBanned(netutil.ExtractIP(conn.RemoteAddr().String())) {
+			_ = conn.Close()
+			continue
 		}
 
+		if !l.acceptLimiter.Acquire() {
+			_ = conn.Close()
+			continue
+		}
+
+		ip := netutil.ExtractIP(conn.RemoteAddr().String())
+		if !l.acceptLimiter.AcquireIP(ip) {
+			_ = conn.Close()
+			l.acceptLimiter.Release()
+			continue
+		}
+		conn = &releaseConn{Conn: conn, release: func() { l.acceptLimiter.ReleaseIP(ip) }}
+
 		l.wg.Add(1)
-		submitted := l.workerPool.Submit(l.recoverer.WrapGoroutine(
+		submitted := l.workerPool.SubmitUntil(l.recoverer.WrapGoroutine(
 			fmt.Sprintf("handleConnection-%s", conn.RemoteAddr().String()),
 			func() {
-				l.handleConnection(conn)
+				l.handleConnection(l.ctx, conn)
 			},
-		))
+		), l.ctx.Done())
 
 		if !submitted {
-			l.recoverer.SafeGo(
-				fmt.Sprintf("handleConnection-fallback-%s", conn.RemoteAddr().String()),
-				func() {
-					l.handleConnection(conn)
-				},
+			l.logger.Warn("Worker pool overloaded, dropping connection",
+				zap.String("remote_addr", conn.RemoteAddr().String()),
 			)
+			_ = conn.Close()
+			l.acceptLimiter.Release()
+			l.wg.Done()
 		}
 	}
 }
 
-func (l *Listener) handleConnection(netConn net.Conn) {
+func (l *Listener) handleConnection(ctx context.Context, netConn net.Conn) {
+	acceptedAt := time.Now()
 	defer l.wg.Done()
+	defer l.acceptLimiter.Release()
 	defer l.recoverer.RecoverWithCallback("handleConnection", func(p interface{}) {
 		connID := netConn.RemoteAddr().String()
 		l.connMu.Lock()
@@ -233,32 +437,32 @@ func (l *Listener) handleConnection(netConn net.Conn) {
 	}()
 
 	// Handle TLS connections
-	if tlsConn, ok := netConn.(*tls.Conn); ok {
-		if err := tlsConn.SetReadDeadline(time.Now().Add(10 * time.Second)); err != nil {
-			l.logger.Warn("Failed to set read deadline",
-				zap.String("remote_addr", netConn.RemoteAddr().String()),
-				zap.Error(err),
-			)
+	var alpn string
+	if l.tlsConfig != nil {
+		var handled bool
+		netConn, handled = l.routeSNI(netConn)
+		if handled {
 			return
 		}
+		tlsConn := tls.Server(netConn, l.tlsConfig)
+		netConn = tlsConn
 
-		if err := tlsConn.Handshake(); err != nil {
+		hsCtx, cancel := context.WithTimeout(ctx, tlsHandshakeTimeout)
+		err := tlsConn.HandshakeContext(hsCtx)
+		cancel()
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
 			l.logger.Warn("TLS handshake failed",
 				zap.String("remote_addr", netConn.RemoteAddr().String()),
 				zap.Error(err),
 			)
+			l.recordFailure(netConn, "tls_handshake")
 			return
 		}
 
-		if err := tlsConn.SetReadDeadline(time.Time{}); err != nil {
-			l.logger.Warn("Failed to clear read deadline",
-				zap.String("remote_addr", netConn.RemoteAddr().String()),
-				zap.Error(err),
-			)
-			return
-		}
-
-		if tcpConn, ok := tlsConn.NetConn().(*net.TCPConn); ok {
+		if tcpConn := netutil.UnwrapTCPConn(tlsConn); tcpConn != nil {
 			tcpConn.SetNoDelay(true)
 			tcpConn.SetKeepAlive(true)
 			tcpConn.SetKeepAlivePeriod(30 * time.Second)
@@ -269,19 +473,34 @@ func (l *Listener) handleConnection(netConn net.Conn) {
 		state := tlsConn.ConnectionState()
 		l.logger.Info("New TLS connection",
 			zap.String("remote_addr", netConn.RemoteAddr().String()),
-			zap.Uint16("tls_version", state.Version),
+			zap.String("tls_version", tls.VersionName(state.Version)),
 			zap.String("cipher_suite", tls.CipherSuiteName(state.CipherSuite)),
+			zap.Bool("resumed", state.DidResume),
+			zap.String("alpn", state.NegotiatedProtocol),
 		)
 
-		if state.Version != tls.VersionTLS13 {
-			l.logger.Warn("Connection not using TLS 1.3",
-				zap.Uint16("version", state.Version),
+		// The handshake already enforces MinVersion; this guards against a
+		// config swapped in without it.
+		if state.Version < l.tlsConfig.MinVersion {
+			l.logger.Warn("Rejecting connection below minimum TLS version",
+				zap.String("remote_addr", netConn.RemoteAddr().String()),
+				zap.String("version", tls.VersionName(state.Version)),
+				zap.String("min_version", tls.VersionName(l.tlsConfig.MinVersion)),
 			)
+			l.recordFailure(netConn, "tls_version")
+			return
+		}
+
+		alpn = state.NegotiatedProtocol
+		if alpn == "h2" || alpn == "http/1.1" {
+			if l.serveHTTP(tlsConn) {
+				cleanupRegistered = true
+			}
 			return
 		}
 	} else {
 		// Handle plain TCP connections (reverse proxy mode)
-		if tcpConn, ok := netConn.(*net.TCPConn); ok {
+		if tcpConn := netutil.UnwrapTCPConn(netConn); tcpConn != nil {
 			tcpConn.SetNoDelay(true)
 			tcpConn.SetKeepAlive(true)
 			tcpConn.SetKeepAlivePeriod(30 * time.Second)
@@ -294,9 +513,9 @@ func (l *Listener) handleConnection(netConn net.Conn) {
 		)
 	}
 
-	conn := NewConnection(ConnectionConfig{
+	conn := NewConnection(ctx, ConnectionConfig{
 		Conn:         netConn,
-		AuthToken:    l.authToken,
+		AuthToken:    l.token(),
 		Manager:      l.manager,
 		Logger:       l.logger,
 		PortAlloc:    l.portAlloc,
@@ -306,10 +525,10 @@ func (l *Listener) handleConnection(netConn net.Conn) {
 		HTTPHandler:  l.httpHandler,
 		GroupManager: l.groupManager,
 		HTTPListener: l.httpListener,
+		AcceptedAt:   acceptedAt,
+		ALPN:         alpn,
 	})
-	conn.SetAllowedTunnelTypes(l.allowedTunnelTypes)
-	conn.SetAllowedTransports(l.allowedTransports)
-	conn.SetBandwidthConfig(l.bandwidth, l.burstMultiplier)
+	l.configureConnection(conn)
 
 	connID := netConn.RemoteAddr().String()
 	l.connMu.Lock()
@@ -334,17 +553,16 @@ func (l *Listener) handleConnection(netConn net.Conn) {
 	cleanupRegistered = true
 
 	if err := conn.Handle(); err != nil {
-		errStr := err.Error()
-
-		if utils.IsNetworkError(errStr) {
+		if utils.IsNetworkError(err) {
 			return
 		}
 
-		if utils.IsProtocolError(errStr) {
+		if isProtocolFailure(err) {
 			l.logger.Warn("Protocol validation failed",
 				zap.String("remote_addr", connID),
 				zap.Error(err),
 			)
+			l.recordFailure(netConn, "protocol")
 		} else {
 			l.logger.Error("Connection handling failed",
 				zap.String("remote_addr", connID),
@@ -354,51 +572,123 @@ func (l *Listener) handleConnection(netConn net.Conn) {
 	}
 }
 
-func (l *Listener) Stop() error {
-	l.stopOnce.Do(func() {
-		l.logger.Info("Stopping TCP listener")
+// configureConnection applies the listener's policies to a control
+// connection. Every transport goes through it, so a client on the WebSocket
+// path is held to the same hooks and limits as one on plain TCP/TLS.
+func (l *Listener) configureConnection(conn *Connection) {
+	conn.SetAllowedTunnelTypes(l.allowedTunnelTypes)
+	conn.SetAllowedTransports(l.allowedTransports)
+	conn.SetBandwidthConfig(l.bandwidth, l.burstMultiplier)
+	conn.SetAcceptProxyProtocol(l.acceptProxyProtocol)
+	conn.SetP2PBroker(l.p2pBroker)
+	conn.SetHooks(l.hooks)
+	conn.SetAudit(l.audit)
+	conn.SetGeoIP(l.geoip)
+	conn.SetVersionPolicy(l.versionPolicy)
+	conn.SetBindAddrs(l.bindAddrs)
+	conn.SetAcceptLimiter(l.acceptLimiter)
+	conn.SetSNIRouting(l.tlsConfig != nil)
+}
 
-		close(l.stopCh)
+// serveHTTP hands a visitor that negotiated HTTP by ALPN straight to the
+// HTTP server. Given the *tls.Conn itself, the server serves HTTP/2 to
+// those that asked for it.
+func (l *Listener) serveHTTP(conn *tls.Conn) bool {
+	if !l.httpListener.Enqueue(conn) {
+		l.logger.Warn("HTTP listener queue full, rejecting connection",
+			zap.String("remote_addr", conn.RemoteAddr().String()),
+		)
+		return false
+	}
+	metrics.TotalConnections.Inc()
+	return true
+}
 
-		if l.httpServer != nil {
-			shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+// Shutdown stops accepting connections, lets in-flight HTTP requests
+// finish, then cancels every tunnel connection and waits for its handler to
+// return. HTTP requests get at most half the time ctx leaves, so tunnels
+// still have the rest to wind down; those still running then are cut off.
+// If ctx is done first, Shutdown returns ctx.Err() and the remaining
+// handlers are left to exit on their own.
+func (l *Listener) Shutdown(ctx context.Context) error {
+	l.shutdownOnce.Do(func() {
+		httpCtx := ctx
+		if deadline, ok := ctx.Deadline(); ok {
+			var cancel context.CancelFunc
+			httpCtx, cancel = context.WithDeadline(ctx, time.Now().Add(time.Until(deadline)/2))
 			defer cancel()
-			if err := l.httpServer.Shutdown(shutdownCtx); err != nil {
-				l.logger.Warn("HTTP server shutdown error", zap.Error(err))
-			}
-			l.logger.Info("HTTP server shutdown complete")
 		}
 
-		if l.httpListener != nil {
-			l.httpListener.Close()
-		}
+		l.logger.Info("Stopping TCP listener")
+		l.draining.Store(true)
 
 		if l.listener != nil {
 			if err := l.listener.Close(); err != nil {
 				l.logger.Error("Failed to close listener", zap.Error(err))
 			}
+			l.listening.Store(false)
 		}
-
-		l.connMu.Lock()
-		for _, conn := range l.connections {
-			conn.Close()
+		if l.sshListener != nil {
+			_ = l.sshListener.Close()
 		}
-		l.connMu.Unlock()
-
-		l.wg.Wait()
 
-		if l.workerPool != nil {
-			l.workerPool.Close()
+		if l.httpServer != nil {
+			if err := l.httpServer.Shutdown(httpCtx); err != nil {
+				l.logger.Warn("HTTP server shutdown error", zap.Error(err))
+				_ = l.httpServer.Close()
+			}
+			l.logger.Info("HTTP server shutdown complete")
 		}
+		l.stopHTTP3(httpCtx)
 
-		if l.groupManager != nil {
-			l.groupManager.Close()
+		if l.httpListener != nil {
+			l.httpListener.Close()
 		}
 
-		l.logger.Info("TCP listener stopped")
+		l.cancel()
+
+		done := make(chan struct{})
+		go func() {
+			l.wg.Wait()
+			close(done)
+		}()
+
+		select {
+		case <-done:
+			l.release()
+			l.logger.Info("TCP listener stopped")
+		case <-ctx.Done():
+			l.shutdownErr = ctx.Err()
+			l.logger.Warn("TCP listener shutdown deadline exceeded",
+				zap.Int("active_connections", l.GetActiveConnections()),
+			)
+			go func() {
+				<-done
+				l.release()
+			}()
+		}
 	})
 
-	return nil
+	return l.shutdownErr
+}
+
+// release closes the pools once every connection handler has returned.
+func (l *Listener) release() {
+	if l.workerPool != nil {
+		l.workerPool.Close()
+	}
+	if l.groupManager != nil {
+		l.groupManager.Close()
+	}
+}
+
+// Addr returns the address the listener accepts connections on, or nil
+// before Start.
+func (l *Listener) Addr() net.Addr {
+	if l.listener == nil {
+		return nil
+	}
+	return l.listener.Addr()
 }
 
 func (l *Listener) GetActiveConnections() int {
@@ -430,9 +720,9 @@ func (l *Listener) HandleWSConnection(conn net.Conn, remoteAddr string) {
 	}
 
 	// Create connection handler (no TLS verification needed - already done by HTTP server)
-	tcpConn := NewConnection(ConnectionConfig{
+	tcpConn := NewConnection(l.ctx, ConnectionConfig{
 		Conn:         conn,
-		AuthToken:    l.authToken,
+		AuthToken:    l.token(),
 		Manager:      l.manager,
 		Logger:       l.logger,
 		PortAlloc:    l.portAlloc,
@@ -444,9 +734,7 @@ func (l *Listener) HandleWSConnection(conn net.Conn, remoteAddr string) {
 		HTTPListener: l.httpListener,
 		RemoteIP:     remoteIP,
 	})
-	tcpConn.SetAllowedTunnelTypes(l.allowedTunnelTypes)
-	tcpConn.SetAllowedTransports(l.allowedTransports)
-	tcpConn.SetBandwidthConfig(l.bandwidth, l.burstMultiplier)
+	l.configureConnection(tcpConn)
 
 	l.connMu.Lock()
 	l.connections[connID] = tcpConn
@@ -468,13 +756,11 @@ func (l *Listener) HandleWSConnection(conn net.Conn, remoteAddr string) {
 	}()
 
 	if err := tcpConn.Handle(); err != nil {
-		errStr := err.Error()
-
-		if utils.IsNetworkError(errStr) {
+		if utils.IsNetworkError(err) {
 			return
 		}
 
-		if utils.IsProtocolError(errStr) {
+		if isProtocolFailure(err) {
 			l.logger.Warn("WebSocket tunnel protocol validation failed",
 				zap.String("remote_addr", connID),
 				zap.Error(err),
@@ -488,6 +774,28 @@ func (l *Listener) HandleWSConnection(conn net.Conn, remoteAddr string) {
 	}
 }
 
+// isProtocolFailure reports whether a connection failed because the peer
+// does not speak the protocol, which counts towards a ban.
+func isProtocolFailure(err error) bool {
+	if errors.Is(err, protocol.ErrFrameTooLarge) {
+		return true
+	}
+	switch protocol.ErrorCode(err) {
+	case constants.ErrCodeInvalidRequest, constants.ErrCodeTunnelTypeNotAllowed:
+		return true
+	}
+	return false
+}
+
+// counterDelta returns cur-prev for a Prometheus counter, or 0 when
+// concurrently read totals make the snapshot appear to go backwards.
+func counterDelta(cur, prev uint64) float64 {
+	if cur <= prev {
+		return 0
+	}
+	return float64(cur - prev)
+}
+
 // SetAllowedTransports sets the allowed transport protocols
 func (l *Listener) SetAllowedTransports(transports []string) {
 	l.allowedTransports = transports
@@ -502,6 +810,143 @@ func (l *Listener) SetBandwidth(bandwidth int64) {
 	l.bandwidth = bandwidth
 }
 
+// SetAcceptProxyProtocol requires a PROXY protocol header on the main
+// listener and on every public TCP tunnel port.
+func (l *Listener) SetAcceptProxyProtocol(enabled bool) {
+	l.acceptProxyProtocol = enabled
+}
+
+// SetBanList enables automatic banning of peers that keep failing the
+// TLS handshake or protocol validation.
+// SetChaos injects cfg's faults into every accepted connection, before
+// TLS, so they apply to the frame transport of tunnels and to visitors
+// on the server port alike.
+func (l *Listener) SetChaos(cfg *chaos.Config) {
+	l.chaos = cfg
+}
+
+// SetAuthToken replaces the token clients register with. Tunnels that are
+// already open keep running with the token they registered with.
+func (l *Listener) SetAuthToken(token string) {
+	l.authMu.Lock()
+	defer l.authMu.Unlock()
+	l.authToken = token
+}
+
+func (l *Listener) token() string {
+	l.authMu.RLock()
+	defer l.authMu.RUnlock()
+	return l.authToken
+}
+
+func (l *Listener) SetBanList(banList *abuse.BanList) {
+	l.banList = banList
+}
+
+// SetAcceptLimiter bounds the rate and number of connections the accept
+// loop takes on; excess connections are closed immediately. Its cap per IP
+// also covers the ports of TCP tunnels.
+func (l *Listener) SetAcceptLimiter(limiter *abuse.AcceptLimiter) {
+	l.acceptLimiter = limiter
+}
+
+// SetHeaderTimeout sets how long visitors may take to send their request
+// headers. Zero uses a default of 10s.
+func (l *Listener) SetHeaderTimeout(d time.Duration) {
+	l.headerTimeout = d
+}
+
+// SetMinTransferRate sets the slowest rate, in bytes per second, at which
+// visitors may upload request bodies once the header timeout has passed.
+// Zero keeps the fixed read timeout instead.
+func (l *Listener) SetMinTransferRate(rate int64) {
+	l.minTransferRate = rate
+}
+
+// SetP2PBroker lets TCP tunnel clients receive direct connection offers.
+func (l *Listener) SetP2PBroker(broker *p2p.Broker) {
+	l.p2pBroker = broker
+}
+
+// SetMaxHeaderListSize bounds visitor request headers. HTTP/2 peers are
+// told the limit through SETTINGS_MAX_HEADER_LIST_SIZE. Zero uses
+// httputil.DefaultMaxHeaderListSize.
+func (l *Listener) SetMaxHeaderListSize(size int) {
+	l.maxHeaderListSize = size
+}
+
+// SetHooks lets an extension take part in tunnel registration.
+func (l *Listener) SetHooks(h hooks.Hooks) {
+	l.hooks = h
+}
+
+// SetAudit records registrations, failed authentication and refusals by
+// tunnel limits in the audit log.
+func (l *Listener) SetAudit(log *audit.Log) {
+	l.audit = log
+}
+
+// SetGeoIP sets the database visitor countries are looked up in, enabling
+// country access rules and per-country metrics.
+func (l *Listener) SetGeoIP(db *geoip.DB) {
+	l.geoip = db
+}
+
+// SetVersionPolicy sets the server version reported to clients and the
+// oldest client version accepted.
+func (l *Listener) SetVersionPolicy(p VersionPolicy) {
+	l.versionPolicy = p
+}
+
+// SetBindAddrs sets the addresses TCP tunnel ports listen on, see BindAny.
+func (l *Listener) SetBindAddrs(addrs []string) {
+	l.bindAddrs = addrs
+}
+
+// SetPanicDumpDir writes recovered panic stacks to dir, empty to disable.
+func (l *Listener) SetPanicDumpDir(dir string) {
+	l.panicMetrics.SetDumpDir(dir)
+}
+
+// PanicMetrics returns the recorder shared by the listener's goroutines.
+func (l *Listener) PanicMetrics() *recovery.PanicMetrics {
+	return l.panicMetrics
+}
+
+// recordFailure reports a failed handshake or protocol exchange to the ban list.
+// routeSNI peeks at the ClientHello on conn and, when its server name
+// belongs to a TLS tunnel, forwards the raw TLS bytes to that tunnel. It
+// returns the conn to terminate TLS on otherwise, and whether conn was
+// handed to a tunnel.
+func (l *Listener) routeSNI(conn net.Conn) (net.Conn, bool) {
+	_ = conn.SetReadDeadline(time.Now().Add(tlsHandshakeTimeout))
+	serverName, conn, err := netutil.PeekServerName(conn)
+	_ = conn.SetReadDeadline(time.Time{})
+	if err != nil {
+		return conn, false
+	}
+	tconn, ok := l.tunnelForServerName(serverName)
+	if !ok || tconn.GetTunnelType() != protocol.TunnelTypeTLS {
+		return conn, false
+	}
+
+	l.logger.Debug("Routing TLS connection by SNI",
+		zap.String("remote_addr", conn.RemoteAddr().String()),
+		zap.String("server_name", serverName),
+	)
+	if !tconn.ServeConn(conn) {
+		_ = conn.Close()
+	}
+	return conn, true
+}
+
+func (l *Listener) recordFailure(conn net.Conn, reason string) {
+	if l.banList == nil {
+		return
+	}
+	l.banList.RecordFailure(netutil.ExtractIP(conn.RemoteAddr().String()), reason)
+}
+
 func (l *Listener) SetBurstMultiplier(multiplier float64) {
 	if multiplier <= 0 {
 		multiplier = 2.0
@@ -0,0 +1,195 @@
+package tcp
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	json "github.com/goccy/go-json"
+	"go.uber.org/zap"
+
+	"drip/internal/server/abuse"
+	"drip/internal/server/ports"
+	"drip/internal/server/tunnel"
+	"drip/internal/shared/protocol"
+)
+
+func TestListenerShutdownClosesIdleConnections(t *testing.T) {
+	l := NewListener(ListenerConfig{Address: "127.0.0.1:0", Logger: zap.NewNop()})
+	if err := l.Start(); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+
+	// The peer never sends its registration frame, so the connection only
+	// ends when shutdown cancels it.
+	conn, err := net.Dial("tcp", l.listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer conn.Close()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for l.GetActiveConnections() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	start := time.Now()
+	if err := l.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Shutdown() took %v, want the connection cancelled promptly", elapsed)
+	}
+	if n := l.GetActiveConnections(); n != 0 {
+		t.Errorf("GetActiveConnections() = %d after Shutdown, want 0", n)
+	}
+}
+
+func TestListenerShutdownLeavesTunnelsTimeAfterHTTP(t *testing.T) {
+	started := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-r.Context().Done()
+	})
+	l := NewListener(ListenerConfig{Address: "127.0.0.1:0", Logger: zap.NewNop(), HTTPHandler: handler})
+	if err := l.Start(); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+
+	// A request that never finishes on its own.
+	visitor, err := net.Dial("tcp", l.listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer visitor.Close()
+	if _, err := visitor.Write([]byte("GET / HTTP/1.1\r\nHost: app.example.com\r\n\r\n")); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-started:
+	case <-time.After(2 * time.Second):
+		t.Fatal("HTTP request never reached the handler")
+	}
+
+	// An idle tunnel connection, only ended by cancelling the tunnels.
+	tunnelConn, err := net.Dial("tcp", l.listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer tunnelConn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	start := time.Now()
+	if err := l.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown() error = %v, want the tunnels stopped within the deadline", err)
+	}
+	if elapsed := time.Since(start); elapsed > 1500*time.Millisecond {
+		t.Errorf("Shutdown() took %v, want the HTTP request cut off after half the deadline", elapsed)
+	}
+}
+
+func TestWithALPN(t *testing.T) {
+	tests := []struct {
+		name   string
+		protos []string
+		want   []string
+	}{
+		{"default", nil, []string{"drip/1", "h2", "http/1.1"}},
+		{"configured", []string{"http/1.1"}, []string{"drip/1", "http/1.1"}},
+		{"already offered", []string{"h2", "drip/1"}, []string{"drip/1", "h2"}},
+	}
+	for _, tt := range tests {
+		base := &tls.Config{NextProtos: tt.protos}
+		got := withALPN(base).NextProtos
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: NextProtos = %v, want %v", tt.name, got, tt.want)
+		}
+		if !slices.Equal(base.NextProtos, tt.protos) {
+			t.Errorf("%s: base NextProtos changed to %v", tt.name, base.NextProtos)
+		}
+	}
+}
+
+func TestHandleWSConnectionAppliesAcceptLimiter(t *testing.T) {
+	alloc, err := ports.NewAllocator(42020, 42030)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := NewListener(ListenerConfig{
+		Address:   "127.0.0.1:0",
+		Manager:   tunnel.NewManager(zap.NewNop()),
+		Logger:    zap.NewNop(),
+		PortAlloc: alloc,
+	})
+	l.SetBindAddrs([]string{"127.0.0.1"})
+	limiter := abuse.NewAcceptLimiter(abuse.AcceptConfig{MaxConnectionsPerIP: 1})
+	l.SetAcceptLimiter(limiter)
+	if err := l.Start(); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = l.Shutdown(ctx)
+	})
+
+	// A loopback pair stands in for the connection the WebSocket upgrade
+	// hands over.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	client, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	server, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	go l.HandleWSConnection(server, "203.0.113.9:4000")
+
+	_ = client.SetDeadline(time.Now().Add(5 * time.Second))
+	payload, _ := json.Marshal(protocol.RegisterRequest{TunnelType: protocol.TunnelTypeTCP})
+	if err := protocol.WriteFrame(client, protocol.NewFrame(protocol.FrameTypeRegister, payload)); err != nil {
+		t.Fatalf("WriteFrame() error = %v", err)
+	}
+	frame, err := protocol.ReadFrame(client)
+	if err != nil {
+		t.Fatalf("ReadFrame() error = %v", err)
+	}
+	var resp protocol.RegisterResponse
+	err = json.Unmarshal(frame.Payload, &resp)
+	frame.Release()
+	if err != nil || resp.Port == 0 {
+		t.Fatalf("registration response %+v, %v; want an allocated port", resp, err)
+	}
+
+	// The one slot 127.0.0.1 may hold is taken, so the public port must
+	// turn the visitor away.
+	if !limiter.AcquireIP("127.0.0.1") {
+		t.Fatal("AcquireIP() = false, want the first slot")
+	}
+	defer limiter.ReleaseIP("127.0.0.1")
+
+	visitor, err := net.DialTimeout("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(resp.Port)), 5*time.Second)
+	if err != nil {
+		t.Fatalf("dial tunnel port: %v", err)
+	}
+	defer visitor.Close()
+	_ = visitor.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err := visitor.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("visitor read error = %v, want the connection closed by the per-IP cap", err)
+	}
+}
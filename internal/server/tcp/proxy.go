@@ -8,8 +8,14 @@ import (
 	"sync"
 	"time"
 
+	"drip/internal/server/abuse"
+	"drip/internal/server/geoip"
+	"drip/internal/server/memlimit"
+	"drip/internal/server/metrics"
+	"drip/internal/server/tunnel"
 	"drip/internal/shared/netutil"
 	"drip/internal/shared/pool"
+	"drip/internal/shared/protocol"
 	"drip/internal/shared/qos"
 
 	"go.uber.org/zap"
@@ -22,10 +28,11 @@ type Proxy struct {
 	subdomain string
 	logger    *zap.Logger
 
-	listener net.Listener
-	stopCh   chan struct{}
-	once     sync.Once
-	wg       sync.WaitGroup
+	bindAddrs []string
+	listeners []net.Listener
+	once      sync.Once
+	wg        sync.WaitGroup
+	stopMu    sync.Mutex // orders ServeConn's wg.Add before Stop's Wait
 
 	openStream func() (net.Conn, error)
 	stats      trafficStats
@@ -35,7 +42,15 @@ type Proxy struct {
 	cancel context.CancelFunc
 
 	checkIPAccess func(ip string) bool
+	checkCountry  func(country string) bool
+	isPaused      func() bool
+	geoip         *geoip.DB
 	limiter       interface{ IsLimited() bool }
+	proxyProtocol bool
+
+	acceptProxyProtocol bool
+	memBudget           *memlimit.Budget
+	acceptLimiter       *abuse.AcceptLimiter
 }
 
 type trafficStats interface {
@@ -43,6 +58,7 @@ type trafficStats interface {
 	AddBytesOut(n int64)
 	IncActiveConnections()
 	DecActiveConnections()
+	RecordStream(stats protocol.StreamStats)
 }
 
 func NewProxy(ctx context.Context, port int, subdomain string, openStream func() (net.Conn, error), stats trafficStats, logger *zap.Logger) *Proxy {
@@ -61,7 +77,6 @@ func NewProxy(ctx context.Context, port int, subdomain string, openStream func()
 		port:       port,
 		subdomain:  subdomain,
 		logger:     logger,
-		stopCh:     make(chan struct{}),
 		openStream: openStream,
 		stats:      stats,
 		sem:        sem,
@@ -75,37 +90,102 @@ func (p *Proxy) SetIPAccessCheck(check func(ip string) bool) {
 	p.checkIPAccess = check
 }
 
+// SetGeoIP looks up the country of each visitor for metrics and country
+// access rules.
+func (p *Proxy) SetGeoIP(db *geoip.DB) {
+	p.geoip = db
+}
+
+// SetCountryAccessCheck sets the country access control check function.
+// It only takes effect with a GeoIP database.
+func (p *Proxy) SetCountryAccessCheck(check func(country string) bool) {
+	p.checkCountry = check
+}
+
+// SetPausedCheck sets the function that reports whether the tunnel is
+// paused or outside its schedule, in which case visitors are disconnected
+// right away.
+func (p *Proxy) SetPausedCheck(paused func() bool) {
+	p.isPaused = paused
+}
+
 // SetLimiter sets the bandwidth limiter for this proxy.
 func (p *Proxy) SetLimiter(limiter interface{ IsLimited() bool }) {
 	p.limiter = limiter
 }
 
+// SetProxyProtocol enables sending a PROXY protocol v2 header at the start
+// of every stream so the local service sees the visitor address.
+func (p *Proxy) SetProxyProtocol(enabled bool) {
+	p.proxyProtocol = enabled
+}
+
+// SetAcceptProxyProtocol requires incoming visitors to be prefixed with a
+// PROXY protocol header from an upstream load balancer.
+func (p *Proxy) SetAcceptProxyProtocol(enabled bool) {
+	p.acceptProxyProtocol = enabled
+}
+
+// SetMemoryBudget makes each visitor connection reserve its buffers from
+// budget; visitors are reset when it is exhausted.
+func (p *Proxy) SetMemoryBudget(budget *memlimit.Budget) {
+	p.memBudget = budget
+}
+
+// SetAcceptLimiter caps the visitors a single IP may have connected to
+// the public port at once, see abuse.AcceptLimiter.AcquireIP.
+func (p *Proxy) SetAcceptLimiter(limiter *abuse.AcceptLimiter) {
+	p.acceptLimiter = limiter
+}
+
+// SetBindAddrs sets the addresses the public port listens on, see
+// BindAny. The default is DefaultBindAddrs.
+func (p *Proxy) SetBindAddrs(addrs []string) {
+	p.bindAddrs = addrs
+}
+
 func (p *Proxy) Start() error {
-	addr := fmt.Sprintf("0.0.0.0:%d", p.port)
+	addrs := p.bindAddrs
+	if len(addrs) == 0 {
+		addrs = DefaultBindAddrs
+	}
 
-	ln, err := net.Listen("tcp", addr)
-	if err != nil {
-		return fmt.Errorf("failed to listen on port %d: %w", p.port, err)
+	for _, addr := range addrs {
+		ln, err := listenBind(addr, p.port)
+		if err != nil {
+			for _, l := range p.listeners {
+				_ = l.Close()
+			}
+			p.listeners = nil
+			return fmt.Errorf("failed to listen on port %d: %w", p.port, err)
+		}
+		if p.acceptProxyProtocol {
+			ln = netutil.NewProxyProtoListener(ln, proxyHeaderTimeout)
+		}
+		p.listeners = append(p.listeners, ln)
 	}
-	p.listener = ln
 
 	p.logger.Info("TCP proxy started",
 		zap.Int("port", p.port),
 		zap.String("subdomain", p.subdomain),
+		zap.Strings("bind", addrs),
 	)
 
-	p.wg.Add(1)
-	go p.acceptLoop()
+	for _, ln := range p.listeners {
+		p.wg.Add(1)
+		go p.acceptLoop(ln)
+	}
 	return nil
 }
 
 func (p *Proxy) Stop() {
 	p.once.Do(func() {
-		close(p.stopCh)
+		p.stopMu.Lock()
 		p.cancel()
+		p.stopMu.Unlock()
 
-		if p.listener != nil {
-			_ = p.listener.Close()
+		for _, ln := range p.listeners {
+			_ = ln.Close()
 		}
 
 		done := make(chan struct{})
@@ -132,33 +212,33 @@ func (p *Proxy) Stop() {
 	})
 }
 
-func (p *Proxy) acceptLoop() {
+// ServeConn forwards conn like a connection accepted on the public port,
+// for consumers that reach the tunnel through the server's own port with
+// 'drip connect'. It returns once conn is done; Stop waits for it too.
+func (p *Proxy) ServeConn(conn net.Conn) {
+	p.stopMu.Lock()
+	if p.ctx.Err() != nil {
+		p.stopMu.Unlock()
+		_ = conn.Close()
+		return
+	}
+	p.wg.Add(1)
+	p.stopMu.Unlock()
 	defer p.wg.Done()
 
-	tcpLn, _ := p.listener.(*net.TCPListener)
-
-	for {
-		select {
-		case <-p.stopCh:
-			return
-		default:
-		}
+	p.serveConn(conn)
+}
 
-		if tcpLn != nil {
-			_ = tcpLn.SetDeadline(time.Now().Add(1 * time.Second))
-		}
+func (p *Proxy) acceptLoop(ln net.Listener) {
+	defer p.wg.Done()
 
-		conn, err := p.listener.Accept()
+	for {
+		conn, err := ln.Accept()
 		if err != nil {
-			if ne, ok := err.(net.Error); ok && ne.Timeout() {
-				continue
-			}
-			select {
-			case <-p.stopCh:
+			if errors.Is(err, net.ErrClosed) || p.ctx.Err() != nil {
 				return
-			default:
-				continue
 			}
+			continue
 		}
 
 		p.wg.Add(1)
@@ -168,19 +248,56 @@ func (p *Proxy) acceptLoop() {
 
 func (p *Proxy) handleConn(conn net.Conn) {
 	defer p.wg.Done()
+
+	// Connections through ServeConn hold a slot of the server's listener
+	// already.
+	ip := netutil.ExtractIP(conn.RemoteAddr().String())
+	if !p.acceptLimiter.AcquireIP(ip) {
+		p.logger.Debug("Too many connections from IP",
+			zap.String("ip", ip),
+			zap.Int("port", p.port),
+		)
+		_ = conn.Close()
+		return
+	}
+	defer p.acceptLimiter.ReleaseIP(ip)
+
+	p.serveConn(conn)
+}
+
+func (p *Proxy) serveConn(conn net.Conn) {
 	defer conn.Close()
 
-	if p.checkIPAccess != nil {
-		clientIP := netutil.ExtractIP(conn.RemoteAddr().String())
-		if !p.checkIPAccess(clientIP) {
-			p.logger.Debug("IP access denied",
+	clientIP := netutil.ExtractIP(conn.RemoteAddr().String())
+	if p.checkIPAccess != nil && !p.checkIPAccess(clientIP) {
+		p.logger.Debug("IP access denied",
+			zap.String("ip", clientIP),
+			zap.Int("port", p.port),
+		)
+		return
+	}
+
+	if p.geoip != nil {
+		country := p.geoip.Country(clientIP)
+		metrics.RecordVisitorCountry(country)
+		if p.checkCountry != nil && !p.checkCountry(country) {
+			p.logger.Debug("Country access denied",
 				zap.String("ip", clientIP),
+				zap.String("country", country),
 				zap.Int("port", p.port),
 			)
 			return
 		}
 	}
 
+	if p.isPaused != nil && p.isPaused() {
+		p.logger.Debug("Tunnel unavailable, closing visitor connection",
+			zap.String("ip", clientIP),
+			zap.Int("port", p.port),
+		)
+		return
+	}
+
 	if p.sem != nil {
 		select {
 		case p.sem <- struct{}{}:
@@ -190,12 +307,25 @@ func (p *Proxy) handleConn(conn net.Conn) {
 		}
 	}
 
+	if err := p.memBudget.Reserve(memlimit.StreamCost); err != nil {
+		p.logger.Debug("Connection shed by memory budget",
+			zap.Int("port", p.port),
+			zap.Error(err),
+		)
+		if tcpConn := netutil.UnwrapTCPConn(conn); tcpConn != nil {
+			// Reset rather than close gracefully so the visitor fails fast.
+			_ = tcpConn.SetLinger(0)
+		}
+		return
+	}
+	defer p.memBudget.Release(memlimit.StreamCost)
+
 	if p.stats != nil {
 		p.stats.IncActiveConnections()
 		defer p.stats.DecActiveConnections()
 	}
 
-	if tcpConn, ok := conn.(*net.TCPConn); ok {
+	if tcpConn := netutil.UnwrapTCPConn(conn); tcpConn != nil {
 		_ = tcpConn.SetNoDelay(true)
 		_ = tcpConn.SetKeepAlive(true)
 		_ = tcpConn.SetKeepAlivePeriod(30 * time.Second)
@@ -239,18 +369,35 @@ func (p *Proxy) handleConn(conn net.Conn) {
 		}
 		stream = result.stream
 	case <-ctx.Done():
-		p.logger.Debug("Open stream timeout")
-		return
-	case <-p.stopCh:
+		if p.ctx.Err() == nil {
+			p.logger.Debug("Open stream timeout")
+		}
 		return
 	}
 
 	defer stream.Close()
 
-	var limitedStream net.Conn = stream
+	if p.proxyProtocol {
+		if err := netutil.WriteProxyHeaderV2(stream, conn.RemoteAddr(), conn.LocalAddr()); err != nil {
+			p.logger.Debug("Write PROXY header failed", zap.Error(err))
+			return
+		}
+	}
+
+	counter := netutil.NewStreamCounter(stream)
+	if p.stats != nil {
+		start := time.Now()
+		defer func() {
+			stats := tunnel.NewStreamStats(counter, start)
+			stats.RemoteAddr = clientIP
+			p.stats.RecordStream(stats)
+		}()
+	}
+
+	var limitedStream net.Conn = counter
 	if p.limiter != nil && p.limiter.IsLimited() {
 		if l, ok := p.limiter.(*qos.Limiter); ok {
-			limitedStream = qos.NewLimitedConn(p.ctx, stream, l)
+			limitedStream = qos.NewLimitedConn(p.ctx, counter, l)
 		}
 	}
 
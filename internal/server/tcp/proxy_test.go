@@ -0,0 +1,46 @@
+package tcp
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestProxyStopWaitsForServeConn(t *testing.T) {
+	stream, tunnelSide := net.Pipe()
+	defer tunnelSide.Close()
+	p := NewProxy(context.Background(), 0, "db", func() (net.Conn, error) { return stream, nil }, nil, zap.NewNop())
+
+	visitor, conn := net.Pipe()
+	defer visitor.Close()
+	done := make(chan struct{})
+	go func() {
+		p.ServeConn(conn)
+		close(done)
+	}()
+
+	go func() { _, _ = visitor.Write([]byte("ping")) }()
+	buf := make([]byte, 4)
+	_ = tunnelSide.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := io.ReadFull(tunnelSide, buf); err != nil {
+		t.Fatalf("tunnel read: %v", err)
+	}
+
+	p.Stop()
+	select {
+	case <-done:
+	default:
+		t.Fatal("Stop returned while ServeConn was still forwarding")
+	}
+
+	late, lateConn := net.Pipe()
+	defer late.Close()
+	p.ServeConn(lateConn)
+	if _, err := lateConn.Write([]byte("x")); err == nil {
+		t.Error("ServeConn after Stop left the connection open")
+	}
+}
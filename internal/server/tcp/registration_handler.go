@@ -1,31 +1,41 @@
 package tcp
 
 import (
+	"errors"
 	"fmt"
+	"slices"
 
 	json "github.com/goccy/go-json"
 	"go.uber.org/zap"
 
+	"drip/internal/server/geoip"
+	"drip/internal/server/ports"
 	"drip/internal/server/tunnel"
+	"drip/internal/shared/constants"
+	"drip/internal/shared/httputil"
+	"drip/internal/shared/labels"
+	"drip/internal/shared/netutil"
 	"drip/internal/shared/protocol"
+	"drip/internal/shared/schedule"
 	"drip/internal/shared/utils"
 )
 
 // RegistrationHandler handles tunnel registration logic.
 type RegistrationHandler struct {
 	manager      *tunnel.Manager
-	portAlloc    *PortAllocator
+	portAlloc    *ports.Allocator
 	groupManager *ConnectionGroupManager
 	domain       string
 	tunnelDomain string
 	publicPort   int
+	geoip        *geoip.DB
 	logger       *zap.Logger
 }
 
 // NewRegistrationHandler creates a new registration handler.
 func NewRegistrationHandler(
 	manager *tunnel.Manager,
-	portAlloc *PortAllocator,
+	portAlloc *ports.Allocator,
 	groupManager *ConnectionGroupManager,
 	domain, tunnelDomain string,
 	publicPort int,
@@ -42,17 +52,39 @@ func NewRegistrationHandler(
 	}
 }
 
+// SetGeoIP sets the database country access rules are checked against.
+// Without one, registrations with country rules are refused.
+func (rh *RegistrationHandler) SetGeoIP(db *geoip.DB) {
+	rh.geoip = db
+}
+
 // RegistrationRequest contains all information needed for registration.
 type RegistrationRequest struct {
 	TunnelType       protocol.TunnelType
 	CustomSubdomain  string
+	SubdomainStyle   string
+	SubdomainPrefix  string
 	Token            string
 	ConnectionType   string
 	PoolCapabilities *protocol.PoolCapabilities
 	IPAccess         *protocol.IPAccessControl
 	ProxyAuth        *protocol.ProxyAuth
+	ProxyProtocol    bool
+	Private          bool
+	RequestRules     []protocol.RequestRule
+	VisitorRateLimit *protocol.VisitorRateLimit
+	EdgeTLS          *protocol.EdgeTLSPolicy
+	SigningSecret    string
+	RequestStore     int
+	MaxRequestBody   int64
+	Schedule         string
+	Labels           map[string]string
 	LocalPort        int
 	RemoteIP         string
+
+	// PortRange overrides the port range assigned to Token, e.g. by a
+	// registration hook that knows the user's plan.
+	PortRange string
 }
 
 // RegistrationResult contains the result of a registration attempt.
@@ -64,27 +96,115 @@ type RegistrationResult struct {
 	SupportsDataConn bool
 	RecommendedConns int
 	TunnelConn       *tunnel.Connection
+
+	StreamCompression string
 }
 
 // Register handles the tunnel registration process.
 func (rh *RegistrationHandler) Register(req *RegistrationRequest) (*RegistrationResult, error) {
-	// Allocate port for TCP tunnels
+	var ruleSet *httputil.RuleSet
+	if len(req.RequestRules) > 0 {
+		if !req.TunnelType.IsHTTP() {
+			return nil, protocol.NewError(constants.ErrCodeInvalidRequest, "request rules are only supported for http and https tunnels")
+		}
+		rs, err := httputil.NewRuleSet(req.RequestRules)
+		if err != nil {
+			return nil, protocol.Errorf(constants.ErrCodeInvalidRequest, "invalid request rules: %w", err)
+		}
+		ruleSet = rs
+	}
+
+	var edgePolicy *tunnel.EdgePolicy
+	if req.EdgeTLS != nil {
+		if !req.TunnelType.IsHTTP() {
+			return nil, protocol.NewError(constants.ErrCodeInvalidRequest, "edge TLS policies are only supported for http and https tunnels")
+		}
+		ep, err := tunnel.NewEdgePolicy(req.EdgeTLS)
+		if err != nil {
+			return nil, protocol.Errorf(constants.ErrCodeInvalidRequest, "invalid edge TLS policy: %w", err)
+		}
+		edgePolicy = ep
+	}
+
+	if req.SigningSecret != "" {
+		if !req.TunnelType.IsHTTP() {
+			return nil, protocol.NewError(constants.ErrCodeInvalidRequest, "request signing is only supported for http and https tunnels")
+		}
+		if err := httputil.ValidateSigningSecret(req.SigningSecret); err != nil {
+			return nil, protocol.Errorf(constants.ErrCodeInvalidRequest, "invalid request signing: %w", err)
+		}
+	}
+
+	if req.RequestStore != 0 {
+		if !req.TunnelType.IsHTTP() {
+			return nil, protocol.NewError(constants.ErrCodeInvalidRequest, "request stores are only supported for http and https tunnels")
+		}
+		if req.RequestStore < 0 || req.RequestStore > protocol.MaxRequestStore {
+			return nil, protocol.Errorf(constants.ErrCodeInvalidRequest, "request store size must be between 1 and %d", protocol.MaxRequestStore)
+		}
+		// Stored requests are only handed out to the tunnel's token.
+		if req.Token == "" {
+			return nil, protocol.NewError(constants.ErrCodeInvalidRequest, "request stores need an auth token")
+		}
+	}
+
+	var sched *schedule.Schedule
+	if req.Schedule != "" {
+		s, err := schedule.Parse(req.Schedule)
+		if err != nil {
+			return nil, protocol.Errorf(constants.ErrCodeInvalidRequest, "invalid schedule: %w", err)
+		}
+		sched = s
+	}
+
+	if err := labels.Validate(req.Labels); err != nil {
+		return nil, protocol.Errorf(constants.ErrCodeInvalidRequest, "invalid labels: %w", err)
+	}
+
+	if req.Private && req.TunnelType != protocol.TunnelTypeTCP {
+		return nil, protocol.NewError(constants.ErrCodeInvalidRequest, "private tunnels are only supported for tcp tunnels")
+	}
+	// Only the owner's token reaches a private tunnel.
+	if req.Private && req.Token == "" {
+		return nil, protocol.NewError(constants.ErrCodeInvalidRequest, "private tunnels need an auth token")
+	}
+
+	var allowCountries, denyCountries []string
+	if req.IPAccess != nil {
+		allowCountries, denyCountries = req.IPAccess.AllowCountries, req.IPAccess.DenyCountries
+	}
+	hasCountryRules := len(allowCountries) > 0 || len(denyCountries) > 0
+	if hasCountryRules {
+		if rh.geoip == nil {
+			return nil, protocol.NewError(constants.ErrCodeUnsupported, "country access rules need a GeoIP database, which this server does not have")
+		}
+		if err := netutil.ValidateCountryCodes(slices.Concat(allowCountries, denyCountries)); err != nil {
+			return nil, protocol.Errorf(constants.ErrCodeInvalidRequest, "invalid country access rules: %w", err)
+		}
+	}
+
+	// Allocate port for public TCP tunnels
 	port := 0
-	if req.TunnelType == protocol.TunnelTypeTCP {
+	if req.TunnelType == protocol.TunnelTypeTCP && !req.Private {
 		if rh.portAlloc == nil {
 			return nil, fmt.Errorf("port allocator not configured")
 		}
 
+		portRange := req.PortRange
+		if portRange == "" {
+			portRange = rh.portAlloc.RangeFor(req.Token)
+		}
+
 		if requestedPort, ok := parseTCPSubdomainPort(req.CustomSubdomain); ok {
-			allocatedPort, err := rh.portAlloc.AllocateSpecific(requestedPort)
+			allocatedPort, err := rh.portAlloc.AllocateSpecific(portRange, req.Token, requestedPort)
 			if err != nil {
-				return nil, fmt.Errorf("failed to allocate requested port %d: %w", requestedPort, err)
+				return nil, protocol.Errorf(constants.ErrCodePortAllocationFailed, "failed to allocate requested port %d: %w", requestedPort, err)
 			}
 			port = allocatedPort
 		} else {
-			allocatedPort, err := rh.portAlloc.Allocate()
+			allocatedPort, err := rh.portAlloc.Allocate(portRange, req.Token)
 			if err != nil {
-				return nil, fmt.Errorf("failed to allocate port: %w", err)
+				return nil, protocol.Errorf(constants.ErrCodePortAllocationFailed, "failed to allocate port: %w", err)
 			}
 			port = allocatedPort
 
@@ -95,7 +215,10 @@ func (rh *RegistrationHandler) Register(req *RegistrationRequest) (*Registration
 	}
 
 	// Register with tunnel manager
-	subdomain, err := rh.manager.RegisterWithIP(nil, req.CustomSubdomain, req.RemoteIP)
+	subdomain, err := rh.manager.RegisterWithIP(nil, req.CustomSubdomain, req.RemoteIP, req.Token, tunnel.SubdomainNaming{
+		Style:  req.SubdomainStyle,
+		Prefix: req.SubdomainPrefix,
+	})
 	if err != nil {
 		if port > 0 && rh.portAlloc != nil {
 			rh.portAlloc.Release(port)
@@ -111,6 +234,7 @@ func (rh *RegistrationHandler) Register(req *RegistrationRequest) (*Registration
 
 	// Configure tunnel
 	tunnelConn.SetTunnelType(req.TunnelType)
+	tunnelConn.SetLabels(req.Labels)
 
 	if req.IPAccess != nil && (len(req.IPAccess.AllowIPs) > 0 || len(req.IPAccess.DenyIPs) > 0) {
 		tunnelConn.SetIPAccessControl(req.IPAccess.AllowIPs, req.IPAccess.DenyIPs)
@@ -121,6 +245,15 @@ func (rh *RegistrationHandler) Register(req *RegistrationRequest) (*Registration
 		)
 	}
 
+	if hasCountryRules {
+		tunnelConn.SetCountryAccess(allowCountries, denyCountries)
+		rh.logger.Info("Country access control configured",
+			zap.String("subdomain", subdomain),
+			zap.Strings("allow_countries", allowCountries),
+			zap.Strings("deny_countries", denyCountries),
+		)
+	}
+
 	if req.ProxyAuth != nil && req.ProxyAuth.Enabled {
 		tunnelConn.SetProxyAuth(req.ProxyAuth)
 		rh.logger.Info("Proxy authentication configured",
@@ -128,9 +261,87 @@ func (rh *RegistrationHandler) Register(req *RegistrationRequest) (*Registration
 		)
 	}
 
-	// Build tunnel URL
-	urlBuilder := utils.NewTunnelURLBuilder(rh.tunnelDomain, rh.publicPort)
-	tunnelURL := urlBuilder.BuildURL(subdomain, req.TunnelType, port)
+	if ruleSet != nil {
+		tunnelConn.SetRequestRules(ruleSet)
+		rh.logger.Info("Request filtering rules configured",
+			zap.String("subdomain", subdomain),
+			zap.Int("rules", len(req.RequestRules)),
+		)
+	}
+
+	if vrl := req.VisitorRateLimit; vrl != nil && vrl.RPS > 0 && req.TunnelType.IsHTTP() {
+		tunnelConn.SetVisitorLimiter(tunnel.NewVisitorLimiter(vrl.RPS, vrl.Burst))
+		rh.logger.Info("Visitor rate limit configured",
+			zap.String("subdomain", subdomain),
+			zap.Float64("rps", vrl.RPS),
+			zap.Int("burst", vrl.Burst),
+		)
+	}
+
+	if edgePolicy != nil {
+		tunnelConn.SetEdgePolicy(edgePolicy)
+		rh.logger.Info("Edge TLS policy configured",
+			zap.String("subdomain", subdomain),
+			zap.Int64("hsts_max_age", req.EdgeTLS.HSTSMaxAge),
+			zap.Bool("tls13_only", req.EdgeTLS.TLS13Only),
+			zap.Bool("client_ca", req.EdgeTLS.ClientCA != ""),
+		)
+	}
+
+	if req.MaxRequestBody > 0 && req.TunnelType.IsHTTP() {
+		tunnelConn.SetMaxRequestBody(req.MaxRequestBody)
+		rh.logger.Info("Request body limit configured",
+			zap.String("subdomain", subdomain),
+			zap.Int64("max_request_body", req.MaxRequestBody),
+		)
+	}
+
+	if req.SigningSecret != "" {
+		tunnelConn.SetSigningSecret([]byte(req.SigningSecret))
+		rh.logger.Info("Request signing configured",
+			zap.String("subdomain", subdomain),
+		)
+	}
+
+	if sched != nil {
+		tunnelConn.SetSchedule(sched)
+		rh.logger.Info("Availability schedule configured",
+			zap.String("subdomain", subdomain),
+			zap.String("schedule", sched.String()),
+		)
+	}
+
+	// Requests arriving while the tunnel is away skip its access rules,
+	// so only open tunnels keep them.
+	open := req.IPAccess == nil && (req.ProxyAuth == nil || !req.ProxyAuth.Enabled) &&
+		ruleSet == nil && (edgePolicy == nil || !edgePolicy.RequiresTLS())
+	if store := rh.manager.OpenRequestStore(subdomain, req.Token, req.RequestStore, open); store != nil {
+		tunnelConn.SetRequestStore(store)
+		rh.logger.Info("Request store configured",
+			zap.String("subdomain", subdomain),
+			zap.Int("size", req.RequestStore),
+			zap.Bool("offline", open),
+		)
+	}
+
+	if req.ProxyProtocol && (req.TunnelType == protocol.TunnelTypeTCP || req.TunnelType == protocol.TunnelTypeTLS) {
+		tunnelConn.SetProxyProtocol(true)
+		rh.logger.Info("PROXY protocol v2 enabled",
+			zap.String("subdomain", subdomain),
+		)
+	}
+
+	// Private tunnels have no public URL.
+	var tunnelURL string
+	if req.Private {
+		tunnelConn.SetPrivate(true)
+		rh.logger.Info("Private tunnel, no public port allocated",
+			zap.String("subdomain", subdomain),
+		)
+	} else {
+		urlBuilder := utils.NewTunnelURLBuilder(rh.tunnelDomain, rh.publicPort)
+		tunnelURL = urlBuilder.BuildURL(subdomain, req.TunnelType, port)
+	}
 
 	// Handle connection groups for multi-connection support
 	var tunnelID string
@@ -143,6 +354,12 @@ func (rh *RegistrationHandler) Register(req *RegistrationRequest) (*Registration
 		recommendedConns = 4
 	}
 
+	var streamCompression string
+	if req.PoolCapabilities != nil && req.TunnelType.IsHTTP() &&
+		slices.Contains(req.PoolCapabilities.StreamCompression, httputil.StreamEncodingDeflate) {
+		streamCompression = httputil.StreamEncodingDeflate
+	}
+
 	rh.logger.Info("Tunnel registered",
 		zap.String("subdomain", subdomain),
 		zap.String("tunnel_type", string(req.TunnelType)),
@@ -158,9 +375,31 @@ func (rh *RegistrationHandler) Register(req *RegistrationRequest) (*Registration
 		SupportsDataConn: supportsDataConn,
 		RecommendedConns: recommendedConns,
 		TunnelConn:       tunnelConn,
+
+		StreamCompression: streamCompression,
 	}, nil
 }
 
+// registrationErrorCode returns the error frame code for a failed Register.
+func registrationErrorCode(err error) string {
+	switch {
+	case errors.Is(err, tunnel.ErrSubdomainTaken):
+		return constants.ErrCodeSubdomainTaken
+	case errors.Is(err, tunnel.ErrReservedSubdomain), errors.Is(err, tunnel.ErrBlockedSubdomain):
+		return constants.ErrCodeSubdomainReserved
+	case errors.Is(err, tunnel.ErrInvalidSubdomain), errors.Is(err, tunnel.ErrInvalidSubdomainStyle):
+		return constants.ErrCodeInvalidSubdomain
+	case errors.Is(err, tunnel.ErrTooManyTunnels), errors.Is(err, tunnel.ErrTooManyPerIP), errors.Is(err, tunnel.ErrTooManyPerToken):
+		return constants.ErrCodeTunnelLimit
+	case errors.Is(err, tunnel.ErrRateLimitExceeded):
+		return constants.ErrCodeRateLimited
+	}
+	if code := protocol.ErrorCode(err); code != "" {
+		return code
+	}
+	return constants.ErrCodeRegistrationFailed
+}
+
 // BuildRegistrationResponse creates a protocol registration response.
 func (rh *RegistrationHandler) BuildRegistrationResponse(result *RegistrationResult) (*protocol.RegisterResponse, error) {
 	resp := &protocol.RegisterResponse{
@@ -171,6 +410,8 @@ func (rh *RegistrationHandler) BuildRegistrationResponse(result *RegistrationRes
 		TunnelID:         result.TunnelID,
 		SupportsDataConn: result.SupportsDataConn,
 		RecommendedConns: result.RecommendedConns,
+
+		StreamCompression: result.StreamCompression,
 	}
 	return resp, nil
 }
@@ -0,0 +1,46 @@
+package tcp
+
+import (
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+
+	"drip/internal/server/metrics"
+	"drip/internal/shared/protocol"
+)
+
+// A client that loses its connection usually reconnects before the server
+// notices, finding its own tunnel still holding the subdomain and port it
+// asks for. A resume token, issued with every registration and presented
+// on the next one, lets it close that stale tunnel and take its place in
+// the same round trip. Together with the TLS session tickets the client
+// keeps across reconnects, re-binding a tunnel costs one resumed handshake
+// and one register exchange. Go's TLS stack does not send 0-RTT early
+// data, so the register frame still waits for the handshake to finish.
+
+// takeOver closes the tunnel a reconnecting client left behind at the
+// subdomain it asks for, if it presents that tunnel's resume token. It
+// reports whether it did.
+func (c *Connection) takeOver(req *protocol.RegisterRequest) bool {
+	if req.ResumeToken == "" || req.CustomSubdomain == "" {
+		return false
+	}
+	stale, ok := c.manager.Get(req.CustomSubdomain)
+	if !ok || !stale.Evict(req.ResumeToken) {
+		return false
+	}
+	c.logger.Info("Closed stale tunnel for reconnecting client",
+		zap.String("subdomain", req.CustomSubdomain),
+		zap.String("remote_ip", c.remoteIP),
+	)
+	return true
+}
+
+// observeReconnect records how long a reconnecting client took from
+// connecting to having its tunnel back.
+func (c *Connection) observeReconnect(resumed bool) {
+	metrics.TunnelReconnectSeconds.
+		WithLabelValues(strconv.FormatBool(resumed)).
+		Observe(time.Since(c.acceptedAt).Seconds())
+}
@@ -0,0 +1,87 @@
+package tcp
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	json "github.com/goccy/go-json"
+	"go.uber.org/zap"
+
+	"drip/internal/server/tunnel"
+	"drip/internal/shared/constants"
+	"drip/internal/shared/protocol"
+)
+
+func TestRegisterResumeTakesOverStaleTunnel(t *testing.T) {
+	l := NewListener(ListenerConfig{
+		Address: "127.0.0.1:0",
+		Manager: tunnel.NewManager(zap.NewNop()),
+		Logger:  zap.NewNop(),
+	})
+	if err := l.Start(); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = l.Shutdown(ctx)
+	})
+
+	register := func(resumeToken string) (*protocol.RegisterResponse, error) {
+		conn, err := net.Dial("tcp", l.listener.Addr().String())
+		if err != nil {
+			t.Fatalf("Dial() error = %v", err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+		payload, _ := json.Marshal(protocol.RegisterRequest{
+			CustomSubdomain: "myapp",
+			TunnelType:      protocol.TunnelTypeHTTP,
+			ResumeToken:     resumeToken,
+		})
+		if err := protocol.WriteFrame(conn, protocol.NewFrame(protocol.FrameTypeRegister, payload)); err != nil {
+			t.Fatalf("WriteFrame() error = %v", err)
+		}
+		frame, err := protocol.ReadFrame(conn)
+		if err != nil {
+			t.Fatalf("ReadFrame() error = %v", err)
+		}
+		defer frame.Release()
+		if frame.Type == protocol.FrameTypeError {
+			return nil, protocol.DecodeError(frame.Payload)
+		}
+		var resp protocol.RegisterResponse
+		if err := json.Unmarshal(frame.Payload, &resp); err != nil {
+			t.Fatalf("Unmarshal() error = %v", err)
+		}
+		return &resp, nil
+	}
+
+	// The first connection stays open, as one the server has not yet
+	// noticed is gone would.
+	first, err := register("")
+	if err != nil {
+		t.Fatalf("first registration: %v", err)
+	}
+	if first.ResumeToken == "" {
+		t.Fatal("first registration got no resume token")
+	}
+
+	if _, err := register("wrong"); protocol.ErrorCode(err) != constants.ErrCodeSubdomainTaken {
+		t.Errorf("registration with a wrong token: err = %v, want subdomain taken", err)
+	}
+
+	second, err := register(first.ResumeToken)
+	if err != nil {
+		t.Fatalf("registration with the resume token: %v", err)
+	}
+	if second.Subdomain != "myapp" {
+		t.Errorf("resumed subdomain = %q, want myapp", second.Subdomain)
+	}
+	if second.ResumeToken == "" || second.ResumeToken == first.ResumeToken {
+		t.Errorf("resumed registration got token %q, want a new one", second.ResumeToken)
+	}
+}
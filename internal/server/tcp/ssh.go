@@ -0,0 +1,766 @@
+package tcp
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/crypto/ssh"
+
+	"drip/internal/server/audit"
+	"drip/internal/server/hooks"
+	"drip/internal/server/metrics"
+	"drip/internal/server/tunnel"
+	"drip/internal/shared/constants"
+	"drip/internal/shared/netutil"
+	"drip/internal/shared/protocol"
+	"drip/internal/shared/qos"
+	"drip/internal/shared/utils"
+)
+
+// SSHConfig enables the SSH frontend, which lets users without the drip
+// client open tunnels with OpenSSH's remote forwarding:
+//
+//	ssh -R 80:localhost:3000 -p 2222 tunnel@example.com     HTTP tunnel
+//	ssh -R myapp:80:localhost:3000 -p 2222 tunnel@...       HTTP tunnel on myapp
+//	ssh -R 0:localhost:5432 -p 2222 tunnel@example.com      TCP tunnel
+//
+// Forwards of port 80 or 443 become HTTP tunnels, with the bind address as
+// the subdomain; any other port becomes a TCP tunnel on a port from the
+// server's range. Each visitor connection is a forwarded-tcpip channel.
+type SSHConfig struct {
+	Address string
+	HostKey ssh.Signer
+
+	// AuthorizedKeys may log in without the token. When the server has a
+	// token, it is accepted as the password.
+	AuthorizedKeys []ssh.PublicKey
+}
+
+// sshTokenExtension carries the password a client logged in with to its
+// registrations, where it selects the token's port range.
+const sshTokenExtension = "drip-token"
+
+// sshKeepaliveInterval is how often idle SSH clients are probed, so
+// tunnels of vanished clients are released.
+const sshKeepaliveInterval = 30 * time.Second
+
+var errSSHAuth = errors.New("invalid token")
+
+// SetSSH enables the SSH frontend, started along with the listener.
+func (l *Listener) SetSSH(cfg *SSHConfig) {
+	l.ssh = cfg
+}
+
+// SSHAddr returns the address the SSH frontend accepts connections on, or
+// nil if it is disabled or not started.
+func (l *Listener) SSHAddr() net.Addr {
+	if l.sshListener == nil {
+		return nil
+	}
+	return l.sshListener.Addr()
+}
+
+func (l *Listener) startSSH() error {
+	ln, err := net.Listen("tcp", l.ssh.Address)
+	if err != nil {
+		return fmt.Errorf("failed to start SSH listener: %w", err)
+	}
+	l.sshListener = ln
+	l.logger.Info("SSH listener started",
+		zap.String("address", ln.Addr().String()),
+		zap.String("host_key", ssh.FingerprintSHA256(l.ssh.HostKey.PublicKey())),
+	)
+
+	l.wg.Add(1)
+	go l.sshAcceptLoop(ln, l.sshServerConfig())
+	return nil
+}
+
+func (l *Listener) sshServerConfig() *ssh.ServerConfig {
+	cfg := &ssh.ServerConfig{ServerVersion: "SSH-2.0-drip"}
+	cfg.AddHostKey(l.ssh.HostKey)
+
+	// The token is looked up on every login, as a config reload may set,
+	// change or remove it.
+	cfg.NoClientAuth = true
+	cfg.NoClientAuthCallback = func(ssh.ConnMetadata) (*ssh.Permissions, error) {
+		if l.token() != "" || len(l.ssh.AuthorizedKeys) > 0 {
+			return nil, errSSHAuth
+		}
+		return &ssh.Permissions{}, nil
+	}
+
+	checkToken := func(meta ssh.ConnMetadata, token string) (*ssh.Permissions, error) {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(l.token())) != 1 {
+			l.sshAuthFailed(meta)
+			return nil, errSSHAuth
+		}
+		return &ssh.Permissions{Extensions: map[string]string{sshTokenExtension: token}}, nil
+	}
+	cfg.PasswordCallback = func(meta ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+		if l.token() == "" {
+			return nil, errSSHAuth
+		}
+		return checkToken(meta, string(password))
+	}
+	cfg.KeyboardInteractiveCallback = func(meta ssh.ConnMetadata, challenge ssh.KeyboardInteractiveChallenge) (*ssh.Permissions, error) {
+		if l.token() == "" {
+			return nil, errSSHAuth
+		}
+		answers, err := challenge("", "", []string{"Token: "}, []bool{false})
+		if err != nil || len(answers) != 1 {
+			return nil, errSSHAuth
+		}
+		return checkToken(meta, answers[0])
+	}
+
+	if len(l.ssh.AuthorizedKeys) > 0 {
+		cfg.PublicKeyCallback = func(_ ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			// Clients offer each of their keys in turn, so a mismatch is
+			// not a failed login.
+			for _, k := range l.ssh.AuthorizedKeys {
+				if bytes.Equal(k.Marshal(), key.Marshal()) {
+					return &ssh.Permissions{}, nil
+				}
+			}
+			return nil, fmt.Errorf("unknown public key")
+		}
+	}
+	return cfg
+}
+
+func (l *Listener) sshAuthFailed(meta ssh.ConnMetadata) {
+	ip := netutil.ExtractIP(meta.RemoteAddr().String())
+	l.logger.Named(utils.SubsystemAuth).Warn("SSH authentication failed",
+		zap.String("remote_ip", ip),
+		zap.String("user", meta.User()),
+	)
+	l.audit.Record(audit.Event{
+		Type:   audit.TypeAuthFailure,
+		IP:     ip,
+		Detail: map[string]string{"via": "ssh"},
+	})
+	if l.banList != nil {
+		l.banList.RecordFailure(ip, "ssh_auth")
+	}
+}
+
+func (l *Listener) sshAcceptLoop(ln net.Listener, cfg *ssh.ServerConfig) {
+	defer l.wg.Done()
+	defer l.recoverer.Recover("sshAcceptLoop")
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			l.logger.Error("Failed to accept SSH connection", zap.Error(err))
+			continue
+		}
+
+		if l.banList.IsBanned(netutil.ExtractIP(conn.RemoteAddr().String())) {
+			_ = conn.Close()
+			continue
+		}
+
+		if !l.acceptLimiter.Acquire() {
+			_ = conn.Close()
+			continue
+		}
+
+		l.wg.Add(1)
+		go l.recoverer.WrapGoroutine(
+			fmt.Sprintf("handleSSH-%s", conn.RemoteAddr().String()),
+			func() {
+				defer l.wg.Done()
+				defer l.acceptLimiter.Release()
+				l.handleSSH(conn, cfg)
+			},
+		)()
+	}
+}
+
+func (l *Listener) handleSSH(netConn net.Conn, cfg *ssh.ServerConfig) {
+	_ = netConn.SetDeadline(time.Now().Add(tlsHandshakeTimeout))
+	conn, chans, reqs, err := ssh.NewServerConn(netConn, cfg)
+	if err != nil {
+		l.logger.Debug("SSH handshake failed",
+			zap.String("remote_addr", netConn.RemoteAddr().String()),
+			zap.Error(err),
+		)
+		_ = netConn.Close()
+		return
+	}
+	_ = netConn.SetDeadline(time.Time{})
+
+	s := &sshSession{
+		l:        l,
+		conn:     conn,
+		remoteIP: netutil.ExtractIP(netConn.RemoteAddr().String()),
+		forwards: make(map[string]*sshForward),
+	}
+	if conn.Permissions != nil {
+		s.token = conn.Permissions.Extensions[sshTokenExtension]
+	}
+	// Per-IP tunnel limits only count public addresses, as for WebSocket
+	// tunnels.
+	if !netutil.IsPrivateIP(s.remoteIP) {
+		s.limitIP = s.remoteIP
+	}
+
+	l.logger.Info("New SSH connection",
+		zap.String("remote_addr", netConn.RemoteAddr().String()),
+		zap.String("user", conn.User()),
+		zap.String("client_version", string(conn.ClientVersion())),
+	)
+
+	protocol.RegisterConnection()
+	defer protocol.UnregisterConnection()
+	metrics.TotalConnections.Inc()
+	metrics.ActiveConnections.Inc()
+	defer metrics.ActiveConnections.Dec()
+
+	stop := context.AfterFunc(l.ctx, func() { _ = conn.Close() })
+	defer stop()
+	defer s.close()
+
+	go s.serveChannels(chans)
+	go s.keepalive()
+	s.serveRequests(reqs)
+}
+
+// sshSession is one SSH client connection and the tunnels it forwarded.
+type sshSession struct {
+	l        *Listener
+	conn     *ssh.ServerConn
+	remoteIP string
+	limitIP  string
+	token    string
+
+	mu       sync.Mutex
+	forwards map[string]*sshForward // by requested bind address and port
+	notices  []string
+	outputs  []ssh.Channel
+	closed   bool
+}
+
+// sshForward is a tunnel registered for one remote forward.
+type sshForward struct {
+	bindAddr string
+	bindPort uint32 // as the client knows it, echoed in forwarded-tcpip channels
+
+	tunnelType   protocol.TunnelType
+	subdomain    string
+	port         int
+	tunnelConn   *tunnel.Connection
+	proxy        *Proxy
+	registeredAt time.Time
+}
+
+// Payloads of the RFC 4254 section 7 messages.
+type sshForwardRequest struct {
+	BindAddr string
+	BindPort uint32
+}
+
+type sshForwardReply struct {
+	Port uint32
+}
+
+type sshForwardedChannel struct {
+	Addr       string
+	Port       uint32
+	OriginAddr string
+	OriginPort uint32
+}
+
+func (s *sshSession) serveRequests(reqs <-chan *ssh.Request) {
+	for req := range reqs {
+		switch req.Type {
+		case "tcpip-forward":
+			var fr sshForwardRequest
+			if err := ssh.Unmarshal(req.Payload, &fr); err != nil {
+				_ = req.Reply(false, nil)
+				continue
+			}
+			f, err := s.forward(fr.BindAddr, fr.BindPort)
+			if err != nil {
+				s.notify(fmt.Sprintf("Forwarding %s:%d failed: %v", fr.BindAddr, fr.BindPort, err))
+				_ = req.Reply(false, nil)
+				continue
+			}
+			var reply []byte
+			if fr.BindPort == 0 {
+				reply = ssh.Marshal(sshForwardReply{Port: f.bindPort})
+			}
+			_ = req.Reply(true, reply)
+		case "cancel-tcpip-forward":
+			var fr sshForwardRequest
+			if err := ssh.Unmarshal(req.Payload, &fr); err != nil {
+				_ = req.Reply(false, nil)
+				continue
+			}
+			_ = req.Reply(s.cancel(fr.BindAddr, fr.BindPort), nil)
+		default:
+			if req.WantReply {
+				_ = req.Reply(false, nil)
+			}
+		}
+	}
+}
+
+// forward registers a tunnel for a remote forward of bindAddr:bindPort.
+func (s *sshSession) forward(bindAddr string, bindPort uint32) (*sshForward, error) {
+	l := s.l
+	key := net.JoinHostPort(bindAddr, strconv.Itoa(int(bindPort)))
+	s.mu.Lock()
+	_, exists := s.forwards[key]
+	s.mu.Unlock()
+	if exists {
+		return nil, fmt.Errorf("already forwarded")
+	}
+
+	f := &sshForward{bindAddr: bindAddr, bindPort: bindPort, tunnelType: protocol.TunnelTypeTCP}
+	var subdomain string
+	if bindPort == 80 || bindPort == 443 {
+		// OpenSSH connects to the local service itself, so both are
+		// plain HTTP tunnels, served over HTTPS publicly.
+		f.tunnelType = protocol.TunnelTypeHTTP
+		subdomain = sshSubdomain(bindAddr, l.tunnelDomain)
+	}
+
+	if len(l.allowedTunnelTypes) > 0 && !slices.ContainsFunc(l.allowedTunnelTypes, func(t string) bool {
+		return strings.EqualFold(t, string(f.tunnelType))
+	}) {
+		return nil, fmt.Errorf("tunnel type '%s' is not allowed on this server", f.tunnelType)
+	}
+
+	bindAddrs := l.bindAddrs
+	var portRange string
+	if l.hooks != nil {
+		ctx, cancel := context.WithTimeout(l.ctx, hooks.DefaultWebhookTimeout)
+		decision, err := l.hooks.OnRegister(ctx, &hooks.RegisterEvent{
+			Token:      s.token,
+			Subdomain:  subdomain,
+			TunnelType: string(f.tunnelType),
+			RemoteIP:   s.remoteIP,
+		})
+		cancel()
+		if err != nil {
+			l.logger.Warn("Registration hook failed", zap.Error(err))
+			return nil, fmt.Errorf("registration hook unavailable")
+		}
+		if decision != nil {
+			if decision.Deny {
+				if decision.Reason != "" {
+					return nil, errors.New(decision.Reason)
+				}
+				return nil, fmt.Errorf("registration denied")
+			}
+			if decision.Subdomain != "" {
+				subdomain = decision.Subdomain
+			}
+			portRange = decision.PortRange
+			if len(decision.Bind) > 0 {
+				if err := ValidateBindAddrs(decision.Bind); err != nil {
+					l.logger.Warn("Registration hook returned an invalid bind address", zap.Error(err))
+					return nil, fmt.Errorf("invalid bind address from registration hook")
+				}
+				bindAddrs = decision.Bind
+			}
+		}
+	}
+
+	regHandler := NewRegistrationHandler(l.manager, l.portAlloc, nil, l.domain, l.tunnelDomain, l.publicPort, l.logger)
+	regHandler.SetGeoIP(l.geoip)
+	result, err := regHandler.Register(&RegistrationRequest{
+		TunnelType:      f.tunnelType,
+		CustomSubdomain: subdomain,
+		Token:           s.token,
+		RemoteIP:        s.limitIP,
+		PortRange:       portRange,
+	})
+	if err != nil {
+		code := registrationErrorCode(err)
+		switch code {
+		case constants.ErrCodeTunnelLimit, constants.ErrCodeRateLimited, constants.ErrCodePortAllocationFailed:
+			s.recordAudit(audit.TypeQuota, subdomain, map[string]string{
+				"code":  code,
+				"error": err.Error(),
+			})
+		}
+		return nil, err
+	}
+	f.subdomain, f.port, f.tunnelConn = result.Subdomain, result.Port, result.TunnelConn
+	f.registeredAt = time.Now()
+	if bindPort == 0 {
+		f.bindPort = uint32(result.Port)
+	}
+	s.recordAudit(audit.TypeRegister, f.subdomain, map[string]string{
+		"tunnel_type": string(f.tunnelType),
+		"port":        strconv.Itoa(f.port),
+		"via":         "ssh",
+	})
+
+	shared := l.manager.TokenLimiter(s.token)
+	if l.bandwidth > 0 {
+		f.tunnelConn.SetBandwidthWithBurst(l.bandwidth, l.burstMultiplier)
+		f.tunnelConn.SetLimiter(qos.NewLimiter(qos.Config{
+			Bandwidth: l.bandwidth,
+			Burst:     limiterBurst(l.bandwidth, l.burstMultiplier),
+			Shared:    shared,
+		}))
+	} else if shared != nil {
+		f.tunnelConn.SetLimiter(qos.NewLimiter(qos.Config{Shared: shared}))
+	}
+
+	openStream := func() (net.Conn, error) {
+		return s.openStream(f)
+	}
+	if f.tunnelType == protocol.TunnelTypeTCP {
+		f.proxy = NewProxy(l.ctx, f.port, f.subdomain, openStream, f.tunnelConn, l.logger)
+		f.proxy.SetAcceptProxyProtocol(l.acceptProxyProtocol)
+		f.proxy.SetBindAddrs(bindAddrs)
+		f.proxy.SetAcceptLimiter(l.acceptLimiter)
+		f.proxy.SetGeoIP(l.geoip)
+		f.proxy.SetPausedCheck(f.tunnelConn.Unavailable)
+		f.proxy.SetLimiter(f.tunnelConn.GetLimiter())
+		f.proxy.SetMemoryBudget(f.tunnelConn.MemoryBudget())
+		f.tunnelConn.SetConnHandler(f.proxy.ServeConn)
+		if err := f.proxy.Start(); err != nil {
+			s.release(f)
+			return nil, fmt.Errorf("failed to start tcp proxy: %w", err)
+		}
+	} else {
+		f.tunnelConn.SetOpenStream(openStream)
+	}
+
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		s.release(f)
+		return nil, net.ErrClosed
+	}
+	s.forwards[key] = f
+	s.mu.Unlock()
+
+	if f.tunnelType == protocol.TunnelTypeTCP {
+		s.notify(fmt.Sprintf("Forwarding TCP traffic from %s", result.TunnelURL))
+	} else {
+		s.notify(fmt.Sprintf("Forwarding HTTP traffic from %s", result.TunnelURL))
+	}
+	return f, nil
+}
+
+// cancel removes the tunnel of a remote forward.
+func (s *sshSession) cancel(bindAddr string, bindPort uint32) bool {
+	key := net.JoinHostPort(bindAddr, strconv.Itoa(int(bindPort)))
+	s.mu.Lock()
+	f, ok := s.forwards[key]
+	if !ok {
+		// Forwards of port 0 are cancelled with the allocated port.
+		for k, candidate := range s.forwards {
+			if candidate.bindAddr == bindAddr && candidate.bindPort == bindPort {
+				f, key, ok = candidate, k, true
+				break
+			}
+		}
+	}
+	delete(s.forwards, key)
+	s.mu.Unlock()
+
+	if ok {
+		s.release(f)
+	}
+	return ok
+}
+
+// openStream opens a forwarded-tcpip channel for a visitor of f.
+func (s *sshSession) openStream(f *sshForward) (net.Conn, error) {
+	// Visitors are not known here, so the server itself is the
+	// originator. Clients reject channels without a valid one.
+	origin := sshForwardedChannel{Addr: f.bindAddr, Port: f.bindPort, OriginAddr: "127.0.0.1", OriginPort: 1}
+	if addr, ok := s.conn.LocalAddr().(*net.TCPAddr); ok {
+		origin.OriginAddr, origin.OriginPort = addr.IP.String(), uint32(addr.Port)
+	}
+	ch, reqs, err := s.conn.OpenChannel("forwarded-tcpip", ssh.Marshal(origin))
+	if err != nil {
+		return nil, err
+	}
+	go ssh.DiscardRequests(reqs)
+	return &sshChannelConn{Channel: ch, local: s.conn.LocalAddr(), remote: s.conn.RemoteAddr()}, nil
+}
+
+// release tears down a forward's tunnel.
+func (s *sshSession) release(f *sshForward) {
+	l := s.l
+	if f.proxy != nil {
+		f.proxy.Stop()
+	}
+	if f.port > 0 && l.portAlloc != nil {
+		l.portAlloc.Release(f.port)
+	}
+
+	if l.hooks != nil {
+		ev := &hooks.DisconnectEvent{
+			Subdomain:  f.subdomain,
+			TunnelType: string(f.tunnelType),
+			RemoteIP:   s.remoteIP,
+			Duration:   time.Since(f.registeredAt),
+			BytesIn:    f.tunnelConn.GetBytesIn(),
+			BytesOut:   f.tunnelConn.GetBytesOut(),
+		}
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), hooks.DefaultWebhookTimeout)
+			defer cancel()
+			l.hooks.OnDisconnect(ctx, ev)
+		}()
+	}
+
+	l.manager.Unregister(f.subdomain)
+	l.logger.Info("SSH tunnel closed",
+		zap.String("subdomain", f.subdomain),
+		zap.String("remote_ip", s.remoteIP),
+	)
+}
+
+func (s *sshSession) close() {
+	s.mu.Lock()
+	s.closed = true
+	forwards := s.forwards
+	s.forwards = nil
+	s.mu.Unlock()
+
+	for _, f := range forwards {
+		s.release(f)
+	}
+	_ = s.conn.Close()
+}
+
+func (s *sshSession) recordAudit(eventType, tunnel string, detail map[string]string) {
+	s.l.audit.Record(audit.Event{
+		Type:   eventType,
+		IP:     s.remoteIP,
+		Tunnel: tunnel,
+		Detail: detail,
+	})
+}
+
+// serveChannels accepts session channels, where tunnel URLs are printed.
+// Visitors travel on channels the server opens.
+func (s *sshSession) serveChannels(chans <-chan ssh.NewChannel) {
+	for nc := range chans {
+		if nc.ChannelType() != "session" {
+			_ = nc.Reject(ssh.UnknownChannelType, "only sessions and remote forwards (-R) are supported")
+			continue
+		}
+		ch, reqs, err := nc.Accept()
+		if err != nil {
+			continue
+		}
+		go s.serveSession(ch, reqs)
+	}
+}
+
+func (s *sshSession) serveSession(ch ssh.Channel, reqs <-chan *ssh.Request) {
+	go func() {
+		for req := range reqs {
+			switch req.Type {
+			case "pty-req", "shell", "exec", "env", "window-change":
+				_ = req.Reply(true, nil)
+			default:
+				_ = req.Reply(false, nil)
+			}
+		}
+	}()
+
+	s.mu.Lock()
+	s.outputs = append(s.outputs, ch)
+	notices := slices.Clone(s.notices)
+	s.mu.Unlock()
+	for _, n := range notices {
+		_, _ = fmt.Fprintf(ch, "%s\r\n", n)
+	}
+
+	// Ctrl-C or Ctrl-D in the terminal ends the connection. Without a
+	// terminal, stdin may be closed right away, which leaves it open.
+	buf := make([]byte, 256)
+	for {
+		n, err := ch.Read(buf)
+		if err != nil {
+			return
+		}
+		if bytes.ContainsAny(buf[:n], "\x03\x04") {
+			_, _ = fmt.Fprint(ch, "Closing tunnels\r\n")
+			_ = s.conn.Close()
+			return
+		}
+	}
+}
+
+// notify prints msg on every session channel, now and later.
+func (s *sshSession) notify(msg string) {
+	s.mu.Lock()
+	s.notices = append(s.notices, msg)
+	outputs := slices.Clone(s.outputs)
+	s.mu.Unlock()
+	for _, ch := range outputs {
+		_, _ = fmt.Fprintf(ch, "%s\r\n", msg)
+	}
+}
+
+// keepalive closes the connection once the client stops answering.
+func (s *sshSession) keepalive() {
+	ticker := time.NewTicker(sshKeepaliveInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		done := make(chan error, 1)
+		go func() {
+			_, _, err := s.conn.SendRequest("keepalive@openssh.com", true, nil)
+			done <- err
+		}()
+		select {
+		case err := <-done:
+			if err != nil {
+				return
+			}
+		case <-time.After(sshKeepaliveInterval):
+			s.l.logger.Info("SSH client stopped responding", zap.String("remote_ip", s.remoteIP))
+			_ = s.conn.Close()
+			return
+		}
+	}
+}
+
+// sshSubdomain returns the subdomain requested by a forward's bind
+// address, or "" for the addresses OpenSSH uses by default.
+func sshSubdomain(bindAddr, tunnelDomain string) string {
+	switch bindAddr {
+	case "", "localhost", "*", "0.0.0.0", "::", "127.0.0.1", "::1":
+		return ""
+	}
+	sub := strings.ToLower(bindAddr)
+	if tunnelDomain != "" {
+		sub = strings.TrimSuffix(sub, "."+strings.ToLower(tunnelDomain))
+	}
+	return sub
+}
+
+// sshChannelConn adapts an SSH channel to net.Conn for the proxies.
+type sshChannelConn struct {
+	ssh.Channel
+	local, remote net.Addr
+
+	mu       sync.Mutex
+	deadline *time.Timer
+}
+
+func (c *sshChannelConn) LocalAddr() net.Addr  { return c.local }
+func (c *sshChannelConn) RemoteAddr() net.Addr { return c.remote }
+
+func (c *sshChannelConn) SetDeadline(t time.Time) error {
+	return c.SetReadDeadline(t)
+}
+
+// SetReadDeadline closes the channel when t passes. SSH channels have no
+// deadlines, and callers only set one to stop waiting for a peer.
+func (c *sshChannelConn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.deadline != nil {
+		c.deadline.Stop()
+		c.deadline = nil
+	}
+	if !t.IsZero() {
+		c.deadline = time.AfterFunc(time.Until(t), func() { _ = c.Channel.Close() })
+	}
+	return nil
+}
+
+func (c *sshChannelConn) SetWriteDeadline(time.Time) error {
+	return nil
+}
+
+func (c *sshChannelConn) Close() error {
+	_ = c.SetReadDeadline(time.Time{})
+	return c.Channel.Close()
+}
+
+// LoadSSHHostKey reads the SSH host key at path, creating an Ed25519 key
+// there if none exists yet.
+func LoadSSHHostKey(path string) (ssh.Signer, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		_, key, genErr := ed25519.GenerateKey(rand.Reader)
+		if genErr != nil {
+			return nil, genErr
+		}
+		block, genErr := ssh.MarshalPrivateKey(key, "drip host key")
+		if genErr != nil {
+			return nil, genErr
+		}
+		data = pem.EncodeToMemory(block)
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(path, data, 0600); err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	}
+
+	signer, err := ssh.ParsePrivateKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SSH host key %s: %w", path, err)
+	}
+	return signer, nil
+}
+
+// LoadSSHAuthorizedKeys reads the public keys of an OpenSSH
+// authorized_keys file.
+func LoadSSHAuthorizedKeys(path string) ([]ssh.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var keys []ssh.PublicKey
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(line))
+		if err != nil {
+			return nil, fmt.Errorf("invalid key on line %d of %s: %w", i+1, path, err)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// DefaultSSHHostKeyPath is where the SSH host key is kept unless
+// configured otherwise.
+func DefaultSSHHostKeyPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(".drip", "ssh_host_ed25519_key")
+	}
+	return filepath.Join(home, ".drip", "ssh_host_ed25519_key")
+}
@@ -0,0 +1,155 @@
+package tcp
+
+import (
+	"context"
+	"io"
+	"net"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/crypto/ssh"
+
+	"drip/internal/server/ports"
+	"drip/internal/server/tunnel"
+)
+
+func TestSSHSubdomain(t *testing.T) {
+	tests := []struct {
+		bindAddr, want string
+	}{
+		{"", ""},
+		{"localhost", ""},
+		{"0.0.0.0", ""},
+		{"MyApp", "myapp"},
+		{"myapp.example.com", "myapp"},
+		{"myapp.other.com", "myapp.other.com"},
+	}
+	for _, tt := range tests {
+		if got := sshSubdomain(tt.bindAddr, "example.com"); got != tt.want {
+			t.Errorf("sshSubdomain(%q) = %q, want %q", tt.bindAddr, got, tt.want)
+		}
+	}
+}
+
+func TestSSHRemoteForward(t *testing.T) {
+	hostKey, err := LoadSSHHostKey(filepath.Join(t.TempDir(), "host_key"))
+	if err != nil {
+		t.Fatalf("LoadSSHHostKey() error = %v", err)
+	}
+	alloc, err := ports.NewAllocator(42000, 42010)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := zap.NewNop()
+	l := NewListener(ListenerConfig{
+		Address:   "127.0.0.1:0",
+		AuthToken: "secret",
+		Manager:   tunnel.NewManager(logger),
+		Logger:    logger,
+		PortAlloc: alloc,
+		Domain:    "example.com",
+	})
+	l.SetBindAddrs([]string{"127.0.0.1"})
+	l.SetSSH(&SSHConfig{Address: "127.0.0.1:0", HostKey: hostKey})
+	if err := l.Start(); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = l.Shutdown(ctx)
+	})
+
+	dial := func(password string) (*ssh.Client, error) {
+		return ssh.Dial("tcp", l.SSHAddr().String(), &ssh.ClientConfig{
+			User:            "tunnel",
+			Auth:            []ssh.AuthMethod{ssh.Password(password)},
+			HostKeyCallback: ssh.FixedHostKey(hostKey.PublicKey()),
+			Timeout:         5 * time.Second,
+		})
+	}
+
+	if _, err := dial("wrong"); err == nil {
+		t.Fatal("Dial() with a wrong token succeeded")
+	}
+
+	client, err := dial("secret")
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer client.Close()
+
+	// Listen asks for port 0, so the reply carries the allocated port.
+	ln, err := client.Listen("tcp", "0.0.0.0:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				_, _ = io.Copy(conn, conn)
+			}()
+		}
+	}()
+
+	port := ln.Addr().(*net.TCPAddr).Port
+	if port < 42000 || port > 42010 {
+		t.Fatalf("allocated port %d, want one in 42000-42010", port)
+	}
+
+	// A new token applies to new logins; the open forward keeps working.
+	l.SetAuthToken("rotated")
+	if _, err := dial("secret"); err == nil {
+		t.Fatal("Dial() with the replaced token succeeded")
+	}
+	rotated, err := dial("rotated")
+	if err != nil {
+		t.Fatalf("Dial() with the new token error = %v", err)
+	}
+	rotated.Close()
+
+	visitor, err := net.DialTimeout("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)), 5*time.Second)
+	if err != nil {
+		t.Fatalf("dial tunnel port: %v", err)
+	}
+	defer visitor.Close()
+	_ = visitor.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := visitor.Write([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(visitor, buf); err != nil || string(buf) != "ping" {
+		t.Fatalf("echo = %q, %v; want ping", buf, err)
+	}
+
+	// Cancelling the forward releases the tunnel and its port.
+	if err := ln.Close(); err != nil {
+		t.Fatalf("cancel forward: %v", err)
+	}
+	if n := l.manager.Count(); n != 0 {
+		t.Errorf("%d tunnels registered after cancel, want 0", n)
+	}
+}
+
+func TestLoadSSHHostKeyPersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys", "host_key")
+	first, err := LoadSSHHostKey(path)
+	if err != nil {
+		t.Fatalf("LoadSSHHostKey() error = %v", err)
+	}
+	second, err := LoadSSHHostKey(path)
+	if err != nil {
+		t.Fatalf("LoadSSHHostKey() second call error = %v", err)
+	}
+	if ssh.FingerprintSHA256(first.PublicKey()) != ssh.FingerprintSHA256(second.PublicKey()) {
+		t.Error("host key changed between loads, want it persisted")
+	}
+}
@@ -0,0 +1,51 @@
+package tcp
+
+import (
+	"io"
+	"net"
+	"time"
+
+	json "github.com/goccy/go-json"
+
+	"drip/internal/shared/constants"
+	"drip/internal/shared/protocol"
+)
+
+// handleStreamStatsWatch keeps the stream open and sends a StreamStats
+// frame for each stream of the tunnel as it ends, until the client closes
+// it or the tunnel goes away.
+func (c *Connection) handleStreamStatsWatch(stream net.Conn, errorSender *protocol.ErrorSender) {
+	if c.tunnelConn == nil {
+		_ = errorSender.SendError(constants.ErrCodeUnsupported, "Tunnel is not registered")
+		return
+	}
+
+	streams, cancel := c.tunnelConn.WatchStreams()
+	defer cancel()
+
+	_ = stream.SetDeadline(time.Time{})
+
+	closed := make(chan struct{})
+	go func() {
+		_, _ = io.Copy(io.Discard, stream)
+		close(closed)
+	}()
+
+	for {
+		select {
+		case stats := <-streams:
+			data, err := json.Marshal(stats)
+			if err != nil {
+				continue
+			}
+			_ = stream.SetWriteDeadline(time.Now().Add(controlStreamTimeout))
+			if err := protocol.WriteFrame(stream, protocol.NewFrame(protocol.FrameTypeStreamStats, data)); err != nil {
+				return
+			}
+		case <-closed:
+			return
+		case <-c.ctx.Done():
+			return
+		}
+	}
+}
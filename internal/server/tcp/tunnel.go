@@ -4,21 +4,56 @@ import (
 	"bufio"
 	"fmt"
 	"net"
+	"sync/atomic"
 
 	"github.com/hashicorp/yamux"
 
 	"drip/internal/shared/mux"
+	"drip/internal/shared/protocol"
 )
 
 type bufferedConn struct {
 	net.Conn
 	reader *bufio.Reader
+
+	// pending counts bytes handed to Write that have not reached the socket
+	// yet. A connection stuck behind a slow client builds up a backlog.
+	pending atomic.Int64
 }
 
 func (c *bufferedConn) Read(p []byte) (int, error) {
 	return c.reader.Read(p)
 }
 
+func (c *bufferedConn) Write(p []byte) (int, error) {
+	c.pending.Add(int64(len(p)))
+	n, err := c.Conn.Write(p)
+	c.pending.Add(-int64(len(p)))
+	return n, err
+}
+
+// NetConn returns the underlying connection.
+func (c *bufferedConn) NetConn() net.Conn {
+	return c.Conn
+}
+
+// Backlog returns the number of bytes currently waiting to be written.
+func (c *bufferedConn) Backlog() int64 {
+	return c.pending.Load()
+}
+
+// muxConfig returns the multiplexer config for a tunnel's sessions. In
+// power-saving mode the group heartbeat, which rests while the tunnel is
+// idle, is the only ping; yamux would wake the client every
+// YamuxKeepAliveInterval.
+func muxConfig(powerSave bool) *yamux.Config {
+	cfg := mux.NewServerConfig()
+	if powerSave {
+		cfg.EnableKeepAlive = false
+	}
+	return cfg
+}
+
 func (c *Connection) handleTCPTunnel(reader *bufio.Reader) error {
 	// Public server acts as yamux Client, client connector acts as yamux Server.
 	bc := &bufferedConn{
@@ -26,14 +61,12 @@ func (c *Connection) handleTCPTunnel(reader *bufio.Reader) error {
 		reader: reader,
 	}
 
-	// Use optimized mux config for server
-	cfg := mux.NewServerConfig()
-
-	session, err := yamux.Client(bc, cfg)
+	session, err := yamux.Client(bc, muxConfig(c.powerSave))
 	if err != nil {
 		return fmt.Errorf("failed to init yamux session: %w", err)
 	}
 	c.session = session
+	go c.serveControlStreams(session)
 
 	// Update lifecycle manager with session
 	if c.lifecycleManager != nil {
@@ -43,30 +76,47 @@ func (c *Connection) handleTCPTunnel(reader *bufio.Reader) error {
 	openStream := session.Open
 	if c.groupManager != nil {
 		if group, ok := c.groupManager.GetGroup(c.tunnelID); ok && group != nil {
-			group.AddSession("primary", session)
+			group.AddSession("primary", session, bc.Backlog)
 			openStream = group.OpenStream
 		}
 	}
 
 	c.proxy = NewProxy(c.ctx, c.port, c.subdomain, openStream, c.tunnelConn, c.logger)
+	c.proxy.SetAcceptProxyProtocol(c.acceptProxyProtocol)
+	c.proxy.SetBindAddrs(c.bindAddrs)
+	c.proxy.SetAcceptLimiter(c.acceptLimiter)
+	c.proxy.SetGeoIP(c.geoip)
 	if c.tunnelConn != nil && c.tunnelConn.HasIPAccessControl() {
 		c.proxy.SetIPAccessCheck(c.tunnelConn.IsIPAllowed)
 	}
+	if c.tunnelConn != nil && c.tunnelConn.HasCountryAccess() {
+		c.proxy.SetCountryAccessCheck(c.tunnelConn.IsCountryAllowed)
+	}
 	if c.tunnelConn != nil {
+		c.proxy.SetPausedCheck(c.tunnelConn.Unavailable)
 		c.proxy.SetLimiter(c.tunnelConn.GetLimiter())
+		c.proxy.SetProxyProtocol(c.tunnelConn.ProxyProtocolEnabled())
+		c.proxy.SetMemoryBudget(c.tunnelConn.MemoryBudget())
 	}
 
 	// Update lifecycle manager with proxy
 	if c.lifecycleManager != nil {
 		c.lifecycleManager.SetProxy(c.proxy)
 	}
+	if c.tunnelConn != nil {
+		c.tunnelConn.SetConnHandler(c.proxy.ServeConn)
+	}
 
-	if err := c.proxy.Start(); err != nil {
-		return fmt.Errorf("failed to start tcp proxy: %w", err)
+	// Private tunnels are only served through ServeConn, as are TLS
+	// tunnels, whose visitors the listener routes by SNI.
+	if c.tunnelConn == nil || (!c.tunnelConn.IsPrivate() && c.tunnelType != protocol.TunnelTypeTLS) {
+		if err := c.proxy.Start(); err != nil {
+			return fmt.Errorf("failed to start tcp proxy: %w", err)
+		}
 	}
 
 	select {
-	case <-c.stopCh:
+	case <-c.ctx.Done():
 		return nil
 	case <-session.CloseChan():
 		return nil
@@ -80,14 +130,12 @@ func (c *Connection) handleHTTPProxyTunnel(reader *bufio.Reader) error {
 		reader: reader,
 	}
 
-	// Use optimized mux config for server
-	cfg := mux.NewServerConfig()
-
-	session, err := yamux.Client(bc, cfg)
+	session, err := yamux.Client(bc, muxConfig(c.powerSave))
 	if err != nil {
 		return fmt.Errorf("failed to init yamux session: %w", err)
 	}
 	c.session = session
+	go c.serveControlStreams(session)
 
 	// Update lifecycle manager with session
 	if c.lifecycleManager != nil {
@@ -97,7 +145,7 @@ func (c *Connection) handleHTTPProxyTunnel(reader *bufio.Reader) error {
 	openStream := session.Open
 	if c.groupManager != nil {
 		if group, ok := c.groupManager.GetGroup(c.tunnelID); ok && group != nil {
-			group.AddSession("primary", session)
+			group.AddSession("primary", session, bc.Backlog)
 			openStream = group.OpenStream
 		}
 	}
@@ -107,7 +155,7 @@ func (c *Connection) handleHTTPProxyTunnel(reader *bufio.Reader) error {
 	}
 
 	select {
-	case <-c.stopCh:
+	case <-c.ctx.Done():
 		return nil
 	case <-session.CloseChan():
 		return nil
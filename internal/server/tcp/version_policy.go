@@ -0,0 +1,56 @@
+package tcp
+
+import (
+	"drip/internal/shared/constants"
+	"drip/internal/shared/protocol"
+)
+
+// VersionPolicy is what the server tells clients about itself at
+// registration and what it requires of them.
+type VersionPolicy struct {
+	ServerVersion    string
+	MinClientVersion string // Oldest client release accepted, empty accepts all
+	UpgradeURL       string // Where too-old clients are sent
+}
+
+// clientTooOld reports whether a client reporting version must upgrade.
+// Clients that send no version predate the check and are older than any
+// minimum; development builds are let through.
+func (p VersionPolicy) clientTooOld(version string) bool {
+	if p.MinClientVersion == "" {
+		return false
+	}
+	if version == "" {
+		return true
+	}
+	cmp, ok := protocol.CompareVersions(version, p.MinClientVersion)
+	return ok && cmp < 0
+}
+
+// tooOldError is the error frame sent to a client that must upgrade.
+func (p VersionPolicy) tooOldError(version string) *protocol.Error {
+	if version == "" {
+		version = "unknown"
+	}
+	err := protocol.Errorf(constants.ErrCodeClientTooOld,
+		"client version %s is no longer supported, this server requires %s or newer", version, p.MinClientVersion)
+	err.MinVersion = p.MinClientVersion
+	err.UpgradeURL = p.UpgradeURL
+	return err
+}
+
+// capabilities lists the features a registered tunnel can use.
+func (c *Connection) capabilities(result *RegistrationResult, tunnelType protocol.TunnelType) []string {
+	caps := []string{protocol.CapabilityTTL, protocol.CapabilityClientState, protocol.CapabilitySchedule, protocol.CapabilityPowerSave, protocol.CapabilityStreamStats}
+	if result.SupportsDataConn {
+		caps = append(caps, protocol.CapabilityDataConn)
+	}
+	if tunnelType == protocol.TunnelTypeTCP {
+		if c.p2pBroker != nil {
+			caps = append(caps, protocol.CapabilityP2P)
+		}
+	} else if tunnelType.IsHTTP() {
+		caps = append(caps, protocol.CapabilityStreamCompression, protocol.CapabilityRequestRules)
+	}
+	return caps
+}
@@ -0,0 +1,25 @@
+package tcp
+
+import "testing"
+
+func TestVersionPolicyClientTooOld(t *testing.T) {
+	tests := []struct {
+		name    string
+		min     string
+		version string
+		want    bool
+	}{
+		{"no minimum", "", "", false},
+		{"older", "v1.2.0", "v1.1.9", true},
+		{"equal", "v1.2.0", "1.2.0", false},
+		{"newer", "v1.2.0", "v1.10.0", false},
+		{"unversioned client", "v1.2.0", "", true},
+		{"dev build", "v1.2.0", "dev", false},
+	}
+	for _, tt := range tests {
+		p := VersionPolicy{MinClientVersion: tt.min}
+		if got := p.clientTooOld(tt.version); got != tt.want {
+			t.Errorf("%s: clientTooOld(%q) = %v, want %v", tt.name, tt.version, got, tt.want)
+		}
+	}
+}
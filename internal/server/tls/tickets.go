@@ -0,0 +1,92 @@
+package tls
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// ticketKeyHistory is how many keys are kept for decryption, including the
+// active one. Tickets issued up to (ticketKeyHistory-1) rotations ago still
+// resume; older ones fall back to a full handshake.
+const ticketKeyHistory = 3
+
+// TicketRotator periodically replaces the session ticket keys of a
+// tls.Config so that a leaked key only exposes a bounded window of sessions.
+type TicketRotator struct {
+	config   *tls.Config
+	interval time.Duration
+	logger   *zap.Logger
+
+	mu   sync.Mutex
+	keys [][32]byte
+
+	stopCh chan struct{}
+	once   sync.Once
+}
+
+// NewTicketRotator installs a fresh ticket key on config and returns a
+// rotator that replaces it every interval once started.
+func NewTicketRotator(config *tls.Config, interval time.Duration, logger *zap.Logger) (*TicketRotator, error) {
+	r := &TicketRotator{
+		config:   config,
+		interval: interval,
+		logger:   logger,
+		stopCh:   make(chan struct{}),
+	}
+	if err := r.rotate(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Start begins rotating keys in the background.
+func (r *TicketRotator) Start() {
+	go func() {
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-r.stopCh:
+				return
+			case <-ticker.C:
+				if err := r.rotate(); err != nil {
+					r.logger.Error("Failed to rotate TLS session ticket key", zap.Error(err))
+				}
+			}
+		}
+	}()
+}
+
+// Stop halts rotation.
+func (r *TicketRotator) Stop() {
+	r.once.Do(func() {
+		close(r.stopCh)
+	})
+}
+
+func (r *TicketRotator) rotate() error {
+	var key [32]byte
+	if _, err := rand.Read(key[:]); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.keys = append([][32]byte{key}, r.keys...)
+	if len(r.keys) > ticketKeyHistory {
+		r.keys = r.keys[:ticketKeyHistory]
+	}
+	// The first key encrypts new tickets; the rest only decrypt.
+	r.config.SetSessionTicketKeys(r.keys)
+
+	r.logger.Debug("Rotated TLS session ticket key",
+		zap.Int("active_keys", len(r.keys)),
+	)
+	return nil
+}
@@ -1,14 +1,19 @@
 package tunnel
 
 import (
+	"crypto/subtle"
 	"net"
+	"net/http"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"drip/internal/server/memlimit"
 	"drip/internal/server/metrics"
+	"drip/internal/shared/httputil"
 	"drip/internal/shared/netutil"
 	"drip/internal/shared/protocol"
+	"drip/internal/shared/schedule"
 	"github.com/gorilla/websocket"
 	"go.uber.org/zap"
 )
@@ -22,20 +27,48 @@ type Connection struct {
 	mu         sync.RWMutex
 	logger     *zap.Logger
 	closed     atomic.Bool
+	paused     atomic.Bool
 	tunnelType protocol.TunnelType
 	openStream func() (net.Conn, error)
+	serveConn  func(net.Conn)
 	remoteIP   string
+	token      string
+	tunnelID   string
 
 	bytesIn           atomic.Int64
 	bytesOut          atomic.Int64
 	activeConnections atomic.Int64
 
 	ipAccessChecker *netutil.IPAccessChecker
+	countryChecker  *netutil.CountryAccessChecker
 	proxyAuth       *protocol.ProxyAuth
+	proxyProtocol   bool
+	private         bool
+	labels          map[string]string
+	clientState     *ClientState
+	requestRules    *httputil.RuleSet
+	visitorLimiter  *VisitorLimiter
+	edgePolicy      *EdgePolicy
+	signingSecret   []byte
+	maxRequestBody  int64
+	requestStore    *RequestStore
+	schedule        *schedule.Schedule
 
 	bandwidth       int64
 	burstMultiplier float64
 	limiter         interface{ IsLimited() bool }
+
+	memBudget *memlimit.Budget
+
+	resumeToken string
+	evict       func()
+
+	// events is the tunnel's history, kept by the Manager across
+	// reconnects.
+	events *EventLog
+
+	// streamWatchers receive the stats of finished streams.
+	streamWatchers streamWatchers
 }
 
 func NewConnection(subdomain string, conn *websocket.Conn, logger *zap.Logger) *Connection {
@@ -128,7 +161,38 @@ func (c *Connection) OpenStream() (net.Conn, error) {
 	if open == nil {
 		return nil, ErrConnectionClosed
 	}
-	return open()
+	stream, err := open()
+	if err != nil {
+		c.RecordEvent(EventStreamError, err.Error())
+	}
+	return stream, err
+}
+
+// SetConnHandler sets how a TCP tunnel serves a consumer connection that
+// did not arrive on its public port, see ServeConn.
+func (c *Connection) SetConnHandler(serve func(net.Conn)) {
+	c.mu.Lock()
+	c.serveConn = serve
+	c.mu.Unlock()
+}
+
+// ServeConn forwards conn through a TCP tunnel as if it had connected to
+// the tunnel's public port, and returns once conn is done. It reports
+// false without touching conn if the tunnel cannot serve it.
+func (c *Connection) ServeConn(conn net.Conn) bool {
+	if c.closed.Load() {
+		return false
+	}
+
+	c.mu.RLock()
+	serve := c.serveConn
+	c.mu.RUnlock()
+
+	if serve == nil {
+		return false
+	}
+	serve(conn)
+	return true
 }
 
 func (c *Connection) AddBytesIn(n int64) {
@@ -189,6 +253,27 @@ func (c *Connection) HasIPAccessControl() bool {
 	return c.ipAccessChecker != nil && c.ipAccessChecker.HasRules()
 }
 
+// SetCountryAccess restricts visitors by country. Callers look up the
+// country themselves, since only the server knows the GeoIP database.
+func (c *Connection) SetCountryAccess(allow, deny []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.countryChecker = netutil.NewCountryAccessChecker(allow, deny)
+}
+
+func (c *Connection) IsCountryAllowed(country string) bool {
+	c.mu.RLock()
+	checker := c.countryChecker
+	c.mu.RUnlock()
+	return checker.IsAllowed(country)
+}
+
+func (c *Connection) HasCountryAccess() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.countryChecker.HasRules()
+}
+
 func (c *Connection) SetProxyAuth(auth *protocol.ProxyAuth) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -218,6 +303,287 @@ func (c *Connection) ValidateProxyAuth(password string) bool {
 	return auth.Password == password
 }
 
+func (c *Connection) SetProxyProtocol(enabled bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.proxyProtocol = enabled
+}
+
+func (c *Connection) ProxyProtocolEnabled() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.proxyProtocol
+}
+
+// SetPrivate marks a TCP tunnel that has no public port and is only
+// reachable through ServeConn.
+func (c *Connection) SetPrivate(private bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.private = private
+}
+
+func (c *Connection) IsPrivate() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.private
+}
+
+// OwnedBy reports whether token is the one the tunnel registered with.
+// Tunnels registered without a token have no owner.
+func (c *Connection) OwnedBy(token string) bool {
+	return c.token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(c.token)) == 1
+}
+
+// SetResumeToken sets the token a reconnecting client presents to take
+// the tunnel over, and evict, which closes the connection serving it.
+func (c *Connection) SetResumeToken(token string, evict func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.resumeToken = token
+	c.evict = evict
+}
+
+// Evict closes the tunnel for a client presenting its resume token, so the
+// client can register it again at once. It reports whether token matched.
+func (c *Connection) Evict(token string) bool {
+	c.mu.RLock()
+	want, evict := c.resumeToken, c.evict
+	c.mu.RUnlock()
+	if want == "" || evict == nil || subtle.ConstantTimeCompare([]byte(token), []byte(want)) != 1 {
+		return false
+	}
+	evict()
+	return true
+}
+
+// SetPaused stops forwarding visitors to the tunnel, or resumes it, while
+// it stays registered.
+func (c *Connection) SetPaused(paused bool) {
+	if c.paused.Swap(paused) == paused {
+		return
+	}
+	if paused {
+		c.RecordEvent(EventPaused, "")
+	} else {
+		c.RecordEvent(EventResumed, "")
+	}
+}
+
+func (c *Connection) IsPaused() bool {
+	return c.paused.Load()
+}
+
+// SetSchedule limits the times the tunnel accepts visitors to the windows
+// of s; outside them it stays registered but turns visitors away.
+func (c *Connection) SetSchedule(s *schedule.Schedule) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.schedule = s
+}
+
+// Schedule returns the tunnel's availability schedule, or nil.
+func (c *Connection) Schedule() *schedule.Schedule {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.schedule
+}
+
+// OutsideSchedule reports whether the tunnel has a schedule and the
+// current time is outside it.
+func (c *Connection) OutsideSchedule() bool {
+	s := c.Schedule()
+	return s != nil && !s.Open(time.Now())
+}
+
+// Unavailable reports whether visitors are turned away, because the
+// tunnel is paused or outside its schedule.
+func (c *Connection) Unavailable() bool {
+	return c.IsPaused() || c.OutsideSchedule()
+}
+
+// RecordEvent adds an event to the tunnel's history, see EventLog.
+func (c *Connection) RecordEvent(typ, detail string) {
+	c.events.Record(typ, detail)
+}
+
+// Events returns the tunnel's recent history, oldest first.
+func (c *Connection) Events() []Event {
+	return c.events.Events()
+}
+
+// LastEvent returns the latest entry of the tunnel's history, or nil.
+func (c *Connection) LastEvent() *Event {
+	return c.events.Last()
+}
+
+// ClientState is what the client last reported about itself in a
+// heartbeat.
+type ClientState struct {
+	protocol.ClientHeartbeat
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// SetClientState stores a heartbeat payload and records the local service
+// going down or coming back in the tunnel's history.
+func (c *Connection) SetClientState(hb protocol.ClientHeartbeat) {
+	c.mu.Lock()
+	prev := c.clientState
+	c.clientState = &ClientState{ClientHeartbeat: hb, UpdatedAt: time.Now()}
+	c.mu.Unlock()
+
+	switch {
+	case !hb.LocalHealthy && (prev == nil || prev.LocalHealthy):
+		c.RecordEvent(EventLocalDown, hb.LocalError)
+	case hb.LocalHealthy && prev != nil && !prev.LocalHealthy:
+		c.RecordEvent(EventLocalUp, "")
+	}
+}
+
+// ClientState returns the client's last reported state, or nil if it
+// sent none.
+func (c *Connection) ClientState() *ClientState {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.clientState
+}
+
+// SetLabels sets the labels the client registered the tunnel with.
+func (c *Connection) SetLabels(labels map[string]string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.labels = labels
+}
+
+// Labels returns the tunnel's labels. The map must not be modified.
+func (c *Connection) Labels() map[string]string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.labels
+}
+
+func (c *Connection) SetRequestRules(rules *httputil.RuleSet) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.requestRules = rules
+}
+
+func (c *Connection) HasRequestRules() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.requestRules != nil
+}
+
+func (c *Connection) IsRequestAllowed(r *http.Request) bool {
+	c.mu.RLock()
+	rules := c.requestRules
+	c.mu.RUnlock()
+	return rules.Allow(r)
+}
+
+func (c *Connection) SetVisitorLimiter(limiter *VisitorLimiter) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.visitorLimiter = limiter
+}
+
+func (c *Connection) GetVisitorLimiter() *VisitorLimiter {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.visitorLimiter
+}
+
+func (c *Connection) SetEdgePolicy(policy *EdgePolicy) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.edgePolicy = policy
+}
+
+// EdgePolicy returns the tunnel's edge TLS policy, or nil.
+func (c *Connection) EdgePolicy() *EdgePolicy {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.edgePolicy
+}
+
+// SetSigningSecret has requests signed with secret before they are
+// forwarded to the tunnel.
+func (c *Connection) SetSigningSecret(secret []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.signingSecret = secret
+}
+
+// SigningSecret returns the secret requests are signed with, or nil.
+func (c *Connection) SigningSecret() []byte {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.signingSecret
+}
+
+// SetMaxRequestBody bounds the body of each request forwarded to the
+// tunnel, as asked for by its client.
+func (c *Connection) SetMaxRequestBody(size int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.maxRequestBody = size
+}
+
+// MaxRequestBody returns the tunnel's own request body limit, or 0.
+func (c *Connection) MaxRequestBody() int64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.maxRequestBody
+}
+
+func (c *Connection) SetRequestStore(store *RequestStore) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.requestStore = store
+}
+
+// RequestStore returns the store the tunnel's requests are kept in, or nil.
+func (c *Connection) RequestStore() *RequestStore {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.requestStore
+}
+
+// SetTunnelID sets the ID of the tunnel's connection group.
+func (c *Connection) SetTunnelID(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.tunnelID = id
+}
+
+// TunnelID returns the ID of the tunnel's connection group, or its
+// subdomain for tunnels without one.
+func (c *Connection) TunnelID() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.tunnelID == "" {
+		return c.Subdomain
+	}
+	return c.tunnelID
+}
+
+// AllowVisitor applies per-visitor rate limiting, if configured.
+func (c *Connection) AllowVisitor(ip string) (bool, time.Duration) {
+	c.mu.RLock()
+	limiter := c.visitorLimiter
+	c.mu.RUnlock()
+
+	if limiter == nil {
+		return true, 0
+	}
+	ok, retryAfter := limiter.Allow(ip)
+	if !ok {
+		c.RecordEvent(EventThrottled, "visitor rate limit exceeded by "+ip)
+		metrics.TunnelVisitorRateLimited.WithLabelValues(c.TunnelID(), c.Subdomain, c.GetTunnelType().String()).Inc()
+	}
+	return ok, retryAfter
+}
+
 func (c *Connection) SetBandwidthWithBurst(bandwidth int64, burstMultiplier float64) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -243,6 +609,12 @@ func (c *Connection) GetLimiter() interface{ IsLimited() bool } {
 	return c.limiter
 }
 
+// MemoryBudget returns the tunnel's share of the server memory budget. It is
+// nil, and never sheds, when no budget is configured.
+func (c *Connection) MemoryBudget() *memlimit.Budget {
+	return c.memBudget
+}
+
 func (c *Connection) StartWritePump() {
 	if c.Conn == nil {
 		go func() {
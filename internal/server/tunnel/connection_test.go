@@ -3,6 +3,7 @@ package tunnel
 import (
 	"testing"
 
+	"drip/internal/shared/protocol"
 	"drip/internal/shared/qos"
 
 	"go.uber.org/zap"
@@ -57,3 +58,61 @@ func TestConnectionBandwidthUnlimited(t *testing.T) {
 		t.Error("Default limiter should be nil")
 	}
 }
+
+func TestConnectionVisitorRateLimit(t *testing.T) {
+	logger := zap.NewNop()
+	conn := NewConnection("test-subdomain", nil, logger)
+
+	if ok, _ := conn.AllowVisitor("203.0.113.1"); !ok {
+		t.Fatal("AllowVisitor() without limiter should allow")
+	}
+
+	conn.SetVisitorLimiter(NewVisitorLimiter(1, 2))
+
+	for i := 0; i < 2; i++ {
+		if ok, _ := conn.AllowVisitor("203.0.113.1"); !ok {
+			t.Fatalf("request %d within burst was rejected", i+1)
+		}
+	}
+
+	ok, retryAfter := conn.AllowVisitor("203.0.113.1")
+	if ok {
+		t.Fatal("request beyond burst should be rejected")
+	}
+	if retryAfter <= 0 {
+		t.Errorf("retryAfter = %v, want > 0", retryAfter)
+	}
+
+	if ok, _ := conn.AllowVisitor("203.0.113.2"); !ok {
+		t.Error("a different visitor IP should have its own bucket")
+	}
+}
+
+func TestConnectionWatchStreams(t *testing.T) {
+	conn := NewConnection("test-subdomain", nil, zap.NewNop())
+
+	streams, cancel := conn.WatchStreams()
+	conn.RecordStream(protocol.StreamStats{StreamID: 3, Method: "POST", BytesIn: 512})
+
+	select {
+	case got := <-streams:
+		if got.StreamID != 3 || got.Method != "POST" || got.BytesIn != 512 {
+			t.Errorf("watched stats = %+v, want stream 3, POST, 512 bytes in", got)
+		}
+	default:
+		t.Fatal("recorded stream was not passed to the watcher")
+	}
+
+	cancel()
+	conn.RecordStream(protocol.StreamStats{StreamID: 5})
+	if len(streams) != 0 {
+		t.Errorf("stream recorded after cancel was passed to the watcher")
+	}
+
+	// A watcher that does not keep up must not hold up streams.
+	_, cancel = conn.WatchStreams()
+	defer cancel()
+	for i := 0; i < 2*streamStatsBuffer; i++ {
+		conn.RecordStream(protocol.StreamStats{StreamID: uint32(i)})
+	}
+}
@@ -0,0 +1,74 @@
+package tunnel
+
+import (
+	"strings"
+
+	"drip/internal/shared/utils"
+)
+
+// Denylist refuses subdomains, requested or generated, that are reserved
+// for the server's own use or offensive. Reserved names match a whole
+// subdomain, so "api" is refused but "my-api" is not. Blocked words match
+// any part of a subdomain split at hyphens and digits, and the parts joined
+// together, so "foo-shit-42" and "s-h-i-t" are refused. Words inside a
+// longer part are not, which keeps names such as "scunthorpe" usable.
+type Denylist struct {
+	reserved map[string]struct{}
+	blocked  map[string]struct{}
+}
+
+// NewDenylist returns a denylist of reserved names and blocked words. With
+// defaults it also holds utils.ReservedSubdomains and a built-in list of
+// English profanity.
+func NewDenylist(reserved, blocked []string, defaults bool) *Denylist {
+	d := &Denylist{
+		reserved: make(map[string]struct{}),
+		blocked:  make(map[string]struct{}),
+	}
+	add := func(set map[string]struct{}, words []string) {
+		for _, w := range words {
+			if w = strings.ToLower(strings.TrimSpace(w)); w != "" {
+				set[w] = struct{}{}
+			}
+		}
+	}
+	if defaults {
+		add(d.reserved, utils.ReservedSubdomains)
+		add(d.blocked, profanity)
+	}
+	add(d.reserved, reserved)
+	add(d.blocked, blocked)
+	return d
+}
+
+// Check returns ErrReservedSubdomain or ErrBlockedSubdomain if subdomain
+// may not be used, nil otherwise.
+func (d *Denylist) Check(subdomain string) error {
+	if d == nil {
+		return nil
+	}
+	subdomain = strings.ToLower(subdomain)
+	if _, ok := d.reserved[subdomain]; ok {
+		return ErrReservedSubdomain
+	}
+	if len(d.blocked) == 0 {
+		return nil
+	}
+	parts := strings.FieldsFunc(subdomain, func(r rune) bool {
+		return r < 'a' || r > 'z'
+	})
+	for _, part := range append(parts, strings.Join(parts, "")) {
+		if _, ok := d.blocked[part]; ok {
+			return ErrBlockedSubdomain
+		}
+	}
+	return nil
+}
+
+// Len returns the number of reserved names and blocked words.
+func (d *Denylist) Len() int {
+	if d == nil {
+		return 0
+	}
+	return len(d.reserved) + len(d.blocked)
+}
@@ -0,0 +1,39 @@
+package tunnel
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestDenylist(t *testing.T) {
+	d := NewDenylist([]string{"Docs"}, []string{"acme"}, true)
+
+	tests := []struct {
+		subdomain string
+		want      error
+	}{
+		{"myapp", nil},
+		{"api", ErrReservedSubdomain},
+		{"my-api", nil},
+		{"docs", ErrReservedSubdomain},
+		{"shit", ErrBlockedSubdomain},
+		{"foo-shit-42", ErrBlockedSubdomain},
+		{"shit42", ErrBlockedSubdomain},
+		{"s-h-i-t", ErrBlockedSubdomain},
+		{"scunthorpe", nil},
+		{"acme-demo", ErrBlockedSubdomain},
+	}
+	for _, tt := range tests {
+		if err := d.Check(tt.subdomain); !errors.Is(err, tt.want) {
+			t.Errorf("Check(%q) = %v, want %v", tt.subdomain, err, tt.want)
+		}
+	}
+
+	bare := NewDenylist(nil, []string{"acme"}, false)
+	if err := bare.Check("api"); err != nil {
+		t.Errorf("without defaults Check(api) = %v, want nil", err)
+	}
+	if err := bare.Check("acme"); !errors.Is(err, ErrBlockedSubdomain) {
+		t.Errorf("without defaults Check(acme) = %v, want %v", err, ErrBlockedSubdomain)
+	}
+}
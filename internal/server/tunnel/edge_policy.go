@@ -0,0 +1,97 @@
+package tunnel
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"drip/internal/shared/protocol"
+)
+
+// maxHSTSMaxAge is the longest HSTS max-age accepted, two years, which is
+// what preload lists ask for.
+const maxHSTSMaxAge = 2 * 365 * 24 * 60 * 60
+
+// EdgePolicy is the edge TLS policy of a tunnel, applied by the public
+// listener to the tunnel's visitors.
+type EdgePolicy struct {
+	hsts      string
+	tls13Only bool
+	clientCAs *x509.CertPool
+}
+
+// NewEdgePolicy checks p and prepares it for the listener.
+func NewEdgePolicy(p *protocol.EdgeTLSPolicy) (*EdgePolicy, error) {
+	if p.HSTSMaxAge < 0 || p.HSTSMaxAge > maxHSTSMaxAge {
+		return nil, fmt.Errorf("HSTS max-age must be between 0 and %d seconds", maxHSTSMaxAge)
+	}
+	ep := &EdgePolicy{tls13Only: p.TLS13Only}
+	if p.HSTSMaxAge > 0 {
+		ep.hsts = fmt.Sprintf("max-age=%d", p.HSTSMaxAge)
+	}
+	if p.ClientCA != "" {
+		ep.clientCAs = x509.NewCertPool()
+		if !ep.clientCAs.AppendCertsFromPEM([]byte(p.ClientCA)) {
+			return nil, errors.New("client CA contains no PEM certificates")
+		}
+	}
+	return ep, nil
+}
+
+// HSTS returns the Strict-Transport-Security header to add to responses,
+// or "".
+func (p *EdgePolicy) HSTS() string {
+	return p.hsts
+}
+
+// RequiresTLS reports whether the policy sets any requirement on the
+// visitor's TLS connection.
+func (p *EdgePolicy) RequiresTLS() bool {
+	return p.tls13Only || p.clientCAs != nil
+}
+
+// TLSConfig returns base with the policy's requirements applied, for
+// handshakes with the tunnel's visitors.
+func (p *EdgePolicy) TLSConfig(base *tls.Config) *tls.Config {
+	cfg := base.Clone()
+	if p.tls13Only {
+		cfg.MinVersion = tls.VersionTLS13
+	}
+	if p.clientCAs != nil {
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+		cfg.ClientCAs = p.clientCAs
+		// Tickets are shared by all tunnels, so one issued after a
+		// certificate check for another tunnel could skip this one's.
+		cfg.SessionTicketsDisabled = true
+	}
+	return cfg
+}
+
+// Satisfied reports whether a request for host over the TLS connection
+// state meets the policy. It fails for a connection set up for another
+// hostname, as browsers reuse HTTP/2 connections across hostnames that
+// share a certificate.
+func (p *EdgePolicy) Satisfied(state *tls.ConnectionState, host string) bool {
+	if !p.RequiresTLS() {
+		return true
+	}
+	if state == nil {
+		return false
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if !strings.EqualFold(state.ServerName, host) {
+		return false
+	}
+	if p.tls13Only && state.Version < tls.VersionTLS13 {
+		return false
+	}
+	if p.clientCAs != nil && len(state.VerifiedChains) == 0 {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,85 @@
+package tunnel
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"drip/internal/shared/protocol"
+)
+
+func testCAPEM(t *testing.T) string {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "visitors"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
+
+func TestEdgePolicy(t *testing.T) {
+	if _, err := NewEdgePolicy(&protocol.EdgeTLSPolicy{ClientCA: "not a certificate"}); err == nil {
+		t.Error("NewEdgePolicy accepted a client CA without certificates")
+	}
+	if _, err := NewEdgePolicy(&protocol.EdgeTLSPolicy{HSTSMaxAge: -1}); err == nil {
+		t.Error("NewEdgePolicy accepted a negative HSTS max-age")
+	}
+
+	hsts, err := NewEdgePolicy(&protocol.EdgeTLSPolicy{HSTSMaxAge: 31536000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hsts.HSTS(); got != "max-age=31536000" {
+		t.Errorf("HSTS() = %q, want max-age=31536000", got)
+	}
+	if hsts.RequiresTLS() || !hsts.Satisfied(nil, "app.example.com") {
+		t.Error("an HSTS-only policy restricts the connection")
+	}
+
+	strict, err := NewEdgePolicy(&protocol.EdgeTLSPolicy{TLS13Only: true, ClientCA: testCAPEM(t)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := strict.TLSConfig(&tls.Config{MinVersion: tls.VersionTLS12})
+	if cfg.MinVersion != tls.VersionTLS13 || cfg.ClientAuth != tls.RequireAndVerifyClientCert || !cfg.SessionTicketsDisabled {
+		t.Errorf("TLSConfig() = MinVersion %x, ClientAuth %v, tickets disabled %v", cfg.MinVersion, cfg.ClientAuth, cfg.SessionTicketsDisabled)
+	}
+
+	verified := [][]*x509.Certificate{{}}
+	tests := []struct {
+		name  string
+		state *tls.ConnectionState
+		host  string
+		want  bool
+	}{
+		{"plain HTTP", nil, "app.example.com", false},
+		{"verified", &tls.ConnectionState{ServerName: "app.example.com", Version: tls.VersionTLS13, VerifiedChains: verified}, "App.example.com:443", true},
+		{"TLS 1.2", &tls.ConnectionState{ServerName: "app.example.com", Version: tls.VersionTLS12, VerifiedChains: verified}, "app.example.com", false},
+		{"no certificate", &tls.ConnectionState{ServerName: "app.example.com", Version: tls.VersionTLS13}, "app.example.com", false},
+		{"other hostname", &tls.ConnectionState{ServerName: "other.example.com", Version: tls.VersionTLS13, VerifiedChains: verified}, "app.example.com", false},
+	}
+	for _, tt := range tests {
+		if got := strict.Satisfied(tt.state, tt.host); got != tt.want {
+			t.Errorf("%s: Satisfied() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -20,4 +20,10 @@ var (
 
 	// ErrReservedSubdomain is returned when trying to use a reserved subdomain
 	ErrReservedSubdomain = errors.New("subdomain is reserved")
+
+	// ErrBlockedSubdomain is returned for a subdomain containing a blocked word
+	ErrBlockedSubdomain = errors.New("subdomain contains a blocked word")
+
+	// ErrInvalidSubdomainStyle is returned for an unknown subdomain style
+	ErrInvalidSubdomainStyle = errors.New("unknown subdomain style")
 )
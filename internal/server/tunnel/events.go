@@ -0,0 +1,141 @@
+package tunnel
+
+import (
+	"sync"
+	"time"
+)
+
+// Event types recorded in a tunnel's history.
+const (
+	EventConnected       = "connected"
+	EventReconnected     = "reconnected"
+	EventDisconnected    = "disconnected"
+	EventHeartbeatMissed = "heartbeat_missed"
+	EventStreamError     = "stream_error"
+	EventThrottled       = "throttled"
+	EventPaused          = "paused"
+	EventResumed         = "resumed"
+	EventLocalDown       = "local_down"
+	EventLocalUp         = "local_up"
+)
+
+const (
+	// DefaultEventHistory is how many events are kept per tunnel.
+	DefaultEventHistory = 64
+
+	// eventHistoryRetention keeps the history of a closed tunnel around,
+	// so it carries on when the client reconnects with the same
+	// subdomain and can still be looked at after it went away.
+	eventHistoryRetention = time.Hour
+
+	// eventRepeatWindow folds repeats of the same event into one entry,
+	// e.g. a visitor being throttled on every request.
+	eventRepeatWindow = time.Minute
+)
+
+// Event is an entry in a tunnel's history. Repeats within a minute are
+// counted instead of recorded again; Last is the time of the latest one.
+type Event struct {
+	Time   time.Time  `json:"time"`
+	Type   string     `json:"type"`
+	Detail string     `json:"detail,omitempty"`
+	Count  int        `json:"count,omitempty"`
+	Last   *time.Time `json:"last,omitempty"`
+}
+
+// EventLog is a bounded ring buffer of a tunnel's recent events. It is
+// safe for concurrent use; a nil EventLog records nothing.
+type EventLog struct {
+	mu       sync.Mutex
+	events   []Event
+	next     int
+	full     bool
+	closedAt time.Time
+}
+
+// NewEventLog creates a log keeping the last size events.
+func NewEventLog(size int) *EventLog {
+	if size <= 0 {
+		size = DefaultEventHistory
+	}
+	return &EventLog{events: make([]Event, size)}
+}
+
+// Record adds an event of type typ.
+func (l *EventLog) Record(typ, detail string) {
+	if l == nil {
+		return
+	}
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if last := l.lastLocked(); last != nil && last.Type == typ && last.Detail == detail && now.Sub(last.Time) < eventRepeatWindow {
+		if last.Count == 0 {
+			last.Count = 1
+		}
+		last.Count++
+		last.Last = &now
+		return
+	}
+
+	l.events[l.next] = Event{Time: now, Type: typ, Detail: detail}
+	l.next = (l.next + 1) % len(l.events)
+	if l.next == 0 {
+		l.full = true
+	}
+}
+
+func (l *EventLog) lastLocked() *Event {
+	if l.next == 0 && !l.full {
+		return nil
+	}
+	return &l.events[(l.next+len(l.events)-1)%len(l.events)]
+}
+
+// Events returns a copy of the recorded events, oldest first.
+func (l *EventLog) Events() []Event {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !l.full {
+		return append([]Event(nil), l.events[:l.next]...)
+	}
+	out := make([]Event, 0, len(l.events))
+	out = append(out, l.events[l.next:]...)
+	return append(out, l.events[:l.next]...)
+}
+
+// Last returns a copy of the latest event, or nil if there is none.
+func (l *EventLog) Last() *Event {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if last := l.lastLocked(); last != nil {
+		e := *last
+		return &e
+	}
+	return nil
+}
+
+// markClosed records when the tunnel went away, or clears it on
+// reconnect when at is zero.
+func (l *EventLog) markClosed(at time.Time) {
+	l.mu.Lock()
+	l.closedAt = at
+	l.mu.Unlock()
+}
+
+// expired reports whether the tunnel has been gone longer than the
+// retention period.
+func (l *EventLog) expired(now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return !l.closedAt.IsZero() && now.Sub(l.closedAt) > eventHistoryRetention
+}
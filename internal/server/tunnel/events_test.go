@@ -0,0 +1,92 @@
+package tunnel
+
+import (
+	"fmt"
+	"testing"
+
+	"drip/internal/shared/protocol"
+
+	"go.uber.org/zap"
+)
+
+func TestEventLog(t *testing.T) {
+	l := NewEventLog(3)
+	if l.Last() != nil {
+		t.Errorf("Last() on an empty log = %v, want nil", l.Last())
+	}
+
+	for i := range 4 {
+		l.Record(EventStreamError, fmt.Sprint(i))
+	}
+	events := l.Events()
+	if len(events) != 3 || events[0].Detail != "1" || events[2].Detail != "3" {
+		t.Errorf("Events() after wrapping = %+v, want details 1, 2, 3", events)
+	}
+
+	l.Record(EventThrottled, "visitor")
+	l.Record(EventThrottled, "visitor")
+	l.Record(EventThrottled, "visitor")
+	last := l.Last()
+	if last == nil || last.Type != EventThrottled || last.Count != 3 || last.Last == nil {
+		t.Errorf("Last() after repeats = %+v, want one throttled event counted 3 times", last)
+	}
+	if n := len(l.Events()); n != 3 {
+		t.Errorf("len(Events()) = %d, want 3", n)
+	}
+
+	var nilLog *EventLog
+	nilLog.Record(EventConnected, "")
+	if nilLog.Events() != nil {
+		t.Error("a nil EventLog should record nothing")
+	}
+}
+
+func TestManagerHistoryAcrossReconnects(t *testing.T) {
+	m := NewManager(zap.NewNop())
+
+	first := NewConnection("demo", nil, zap.NewNop())
+	first.events = m.openHistory("demo", "192.0.2.1")
+	closeHistory(first, "")
+
+	second := NewConnection("demo", nil, zap.NewNop())
+	second.events = m.openHistory("demo", "192.0.2.1")
+
+	events, ok := m.Events("demo")
+	if !ok {
+		t.Fatal("Events(demo) found no history")
+	}
+	var types []string
+	for _, e := range events {
+		types = append(types, e.Type)
+	}
+	want := fmt.Sprint([]string{EventConnected, EventDisconnected, EventReconnected})
+	if fmt.Sprint(types) != want {
+		t.Errorf("history = %v, want %v", types, want)
+	}
+
+	m.pruneHistory()
+	if _, ok := m.Events("demo"); !ok {
+		t.Error("pruneHistory dropped the history of a registered tunnel")
+	}
+}
+
+func TestClientStateRecordsLocalHealth(t *testing.T) {
+	c := NewConnection("demo", nil, zap.NewNop())
+	c.events = NewEventLog(8)
+
+	c.SetClientState(protocol.ClientHeartbeat{Version: "v1.0.0", LocalHealthy: true})
+	c.SetClientState(protocol.ClientHeartbeat{Version: "v1.0.0", LocalError: "connection refused"})
+	c.SetClientState(protocol.ClientHeartbeat{Version: "v1.0.0", LocalError: "connection refused"})
+	c.SetClientState(protocol.ClientHeartbeat{Version: "v1.0.0", LocalHealthy: true})
+
+	var types []string
+	for _, e := range c.Events() {
+		types = append(types, e.Type)
+	}
+	if want := fmt.Sprint([]string{EventLocalDown, EventLocalUp}); fmt.Sprint(types) != want {
+		t.Errorf("history = %v, want %v", types, want)
+	}
+	if st := c.ClientState(); st == nil || st.Version != "v1.0.0" || !st.LocalHealthy {
+		t.Errorf("ClientState() = %+v, want the last heartbeat", st)
+	}
+}
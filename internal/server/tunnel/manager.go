@@ -2,12 +2,16 @@ package tunnel
 
 import (
 	"errors"
+	"fmt"
 	"hash/fnv"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"drip/internal/server/dnspub"
+	"drip/internal/server/memlimit"
 	"drip/internal/server/metrics"
+	"drip/internal/shared/qos"
 	"drip/internal/shared/utils"
 	"github.com/gorilla/websocket"
 	"go.uber.org/zap"
@@ -28,6 +32,7 @@ const (
 var (
 	ErrTooManyTunnels            = errors.New("maximum tunnel limit reached")
 	ErrTooManyPerIP              = errors.New("maximum tunnels per IP reached")
+	ErrTooManyPerToken           = errors.New("maximum tunnels per token reached")
 	ErrRateLimitExceeded         = errors.New("rate limit exceeded, try again later")
 	ErrSubdomainGenerationFailed = errors.New("failed to generate unique subdomain")
 )
@@ -55,9 +60,36 @@ type Manager struct {
 	ipMu        sync.RWMutex
 	tunnelsByIP map[string]int // IP -> tunnel count
 
+	// Per-token tracking, so tenants with tokens of their own cannot take
+	// the whole server
+	maxTunnelsPerToken int
+	tokenBandwidth     qos.Config
+	tokenMu            sync.Mutex
+	tokens             map[string]*tokenUsage
+
 	// Rate limiting
 	rateLimiter *RateLimiter
 
+	memGovernor *memlimit.Governor
+
+	// dns publishes a record for each registered subdomain.
+	dns *dnspub.Publisher
+
+	// denylist refuses reserved and offensive subdomains.
+	denylist *Denylist
+
+	// subdomainStyle names tunnels registered without a custom subdomain
+	// whose client gave no style of its own.
+	subdomainStyle string
+
+	// history holds each subdomain's events, outliving its connection for
+	// eventHistoryRetention.
+	historyMu sync.Mutex
+	history   map[string]*EventLog
+	// requests holds the request stores of subdomains whose tunnels asked
+	// for one, kept as long as their history.
+	requests map[string]*RequestStore
+
 	// Lifecycle
 	stopCh       chan struct{}
 	shutdownOnce sync.Once
@@ -114,7 +146,12 @@ func NewManagerWithConfig(logger *zap.Logger, cfg ManagerConfig) *Manager {
 		maxTunnels:      cfg.MaxTunnels,
 		maxTunnelsPerIP: cfg.MaxTunnelsPerIP,
 		tunnelsByIP:     make(map[string]int),
+		tokens:          make(map[string]*tokenUsage),
 		rateLimiter:     NewRateLimiter(cfg.RateLimit, cfg.RateLimitWindow, logger),
+		denylist:        NewDenylist(nil, nil, true),
+		subdomainStyle:  utils.SubdomainStyleHex,
+		history:         make(map[string]*EventLog),
+		requests:        make(map[string]*RequestStore),
 		stopCh:          make(chan struct{}),
 	}
 
@@ -127,6 +164,111 @@ func NewManagerWithConfig(logger *zap.Logger, cfg ManagerConfig) *Manager {
 	return m
 }
 
+// SetMemoryGovernor gives every tunnel registered afterwards a share of the
+// server memory budget.
+func (m *Manager) SetMemoryGovernor(gov *memlimit.Governor) {
+	m.memGovernor = gov
+}
+
+// SetDNSPublisher publishes a DNS record for every tunnel registered
+// afterwards, and withdraws it once the tunnel goes away.
+func (m *Manager) SetDNSPublisher(p *dnspub.Publisher) {
+	m.dns = p
+}
+
+// SetSubdomainStyle sets the default style of generated subdomains, one of
+// utils.SubdomainStyles.
+func (m *Manager) SetSubdomainStyle(style string) {
+	m.subdomainStyle = style
+}
+
+// SetDenylist replaces the default denylist, see NewDenylist.
+func (m *Manager) SetDenylist(d *Denylist) {
+	m.denylist = d
+}
+
+// SetMaxTunnelsPerToken caps the tunnels registered with one token at a
+// time (0 = unlimited). Tunnels without a token only count against the
+// per-IP limit.
+func (m *Manager) SetMaxTunnelsPerToken(n int) {
+	m.tokenMu.Lock()
+	defer m.tokenMu.Unlock()
+	m.maxTunnelsPerToken = n
+}
+
+// SetTokenBandwidth makes all tunnels of a token share bandwidth bytes per
+// second, see TokenLimiter.
+func (m *Manager) SetTokenBandwidth(bandwidth int64, burst int) {
+	m.tokenMu.Lock()
+	defer m.tokenMu.Unlock()
+	m.tokenBandwidth = qos.Config{Bandwidth: bandwidth, Burst: burst}
+}
+
+// tokenUsage is what the tunnels of one token hold.
+type tokenUsage struct {
+	tunnels int
+	limiter *qos.Limiter
+}
+
+// reserveToken counts a tunnel against token, failing once the token has
+// maxTunnelsPerToken of them.
+func (m *Manager) reserveToken(token string) error {
+	if token == "" {
+		return nil
+	}
+	m.tokenMu.Lock()
+	defer m.tokenMu.Unlock()
+
+	u := m.tokens[token]
+	if u == nil {
+		u = &tokenUsage{}
+		if m.tokenBandwidth.Bandwidth > 0 {
+			u.limiter = qos.NewLimiter(m.tokenBandwidth)
+		}
+		m.tokens[token] = u
+	}
+	if m.maxTunnelsPerToken > 0 && u.tunnels >= m.maxTunnelsPerToken {
+		return fmt.Errorf("%w: the limit is %d", ErrTooManyPerToken, m.maxTunnelsPerToken)
+	}
+	u.tunnels++
+	return nil
+}
+
+// releaseToken undoes reserveToken.
+func (m *Manager) releaseToken(token string) {
+	if token == "" {
+		return
+	}
+	m.tokenMu.Lock()
+	defer m.tokenMu.Unlock()
+
+	if u := m.tokens[token]; u != nil {
+		u.tunnels--
+		if u.tunnels <= 0 {
+			delete(m.tokens, token)
+		}
+	}
+}
+
+// TokenLimiter returns the limiter the tunnels of token share, nil without
+// a token bandwidth or for tunnels without a token.
+func (m *Manager) TokenLimiter(token string) *qos.Limiter {
+	m.tokenMu.Lock()
+	defer m.tokenMu.Unlock()
+
+	if u := m.tokens[token]; u != nil {
+		return u.limiter
+	}
+	return nil
+}
+
+// SubdomainNaming is a client's hint on how to name a tunnel registered
+// without a custom subdomain. The zero value uses the server default.
+type SubdomainNaming struct {
+	Style  string
+	Prefix string
+}
+
 // getShard returns the shard for a given subdomain using FNV-1a hash
 func (m *Manager) getShard(subdomain string) *shard {
 	h := fnv.New32a()
@@ -136,11 +278,27 @@ func (m *Manager) getShard(subdomain string) *shard {
 
 // Register registers a new tunnel connection with IP-based limits
 func (m *Manager) Register(conn *websocket.Conn, customSubdomain string) (string, error) {
-	return m.RegisterWithIP(conn, customSubdomain, "")
+	return m.RegisterWithIP(conn, customSubdomain, "", "", SubdomainNaming{})
 }
 
-// RegisterWithIP registers a new tunnel with IP tracking
-func (m *Manager) RegisterWithIP(conn *websocket.Conn, customSubdomain string, remoteIP string) (string, error) {
+// RegisterWithIP registers a new tunnel with IP and token tracking.
+// Without customSubdomain a subdomain is generated as naming asks.
+func (m *Manager) RegisterWithIP(conn *websocket.Conn, customSubdomain string, remoteIP, token string, naming SubdomainNaming) (string, error) {
+	style, prefix := naming.Style, utils.SanitizeSubdomainPrefix(naming.Prefix)
+	if style == "" {
+		style = m.subdomainStyle
+	}
+	if customSubdomain == "" {
+		if !utils.IsSubdomainStyle(style) {
+			return "", ErrInvalidSubdomainStyle
+		}
+		if style == utils.SubdomainStylePrefix && prefix != "" {
+			if err := m.denylist.Check(prefix); err != nil {
+				return "", err
+			}
+		}
+	}
+
 	// Reserve a global slot atomically using CAS loop
 	for {
 		current := m.tunnelCount.Load()
@@ -209,6 +367,17 @@ func (m *Manager) RegisterWithIP(conn *websocket.Conn, customSubdomain string, r
 		}
 	}
 
+	if err := m.reserveToken(token); err != nil {
+		rollbackPerIP()
+		rollbackGlobal()
+		m.logger.Warn("Per-token tunnel limit reached",
+			zap.String("ip", remoteIP),
+			zap.Error(err),
+		)
+		metrics.TunnelRegistrationFailures.WithLabelValues("max_per_token").Inc()
+		return "", err
+	}
+
 	var subdomain string
 
 	registerSubdomain := func(candidate string) bool {
@@ -222,6 +391,9 @@ func (m *Manager) RegisterWithIP(conn *websocket.Conn, customSubdomain string, r
 
 		tc := NewConnection(candidate, conn, m.logger)
 		tc.remoteIP = remoteIP
+		tc.token = token
+		tc.memBudget = m.memGovernor.NewBudget()
+		tc.events = m.openHistory(candidate, remoteIP)
 		s.tunnels[candidate] = tc
 		s.used[candidate] = true
 		subdomain = candidate
@@ -231,50 +403,41 @@ func (m *Manager) RegisterWithIP(conn *websocket.Conn, customSubdomain string, r
 	if customSubdomain != "" {
 		// Validate custom subdomain
 		if !utils.ValidateSubdomain(customSubdomain) {
+			m.releaseToken(token)
 			rollbackPerIP()
 			rollbackGlobal()
 			return "", ErrInvalidSubdomain
 		}
-		if utils.IsReserved(customSubdomain) {
+		if err := m.denylist.Check(customSubdomain); err != nil {
+			m.releaseToken(token)
 			rollbackPerIP()
 			rollbackGlobal()
-			return "", ErrReservedSubdomain
+			return "", err
 		}
 
 		if !registerSubdomain(customSubdomain) {
+			m.releaseToken(token)
 			rollbackPerIP()
 			rollbackGlobal()
 			return "", ErrSubdomainTaken
 		}
 	} else {
+		// Fall back to longer names once the short ones keep colliding.
 		const maxAttempts = 32
 		registered := false
 
-		for i := 0; i < maxAttempts; i++ {
-			candidate := utils.GenerateSubdomain(6)
-			if utils.IsReserved(candidate) {
-				continue
-			}
-			if registerSubdomain(candidate) {
-				registered = true
-				break
-			}
-		}
-
-		if !registered {
-			for i := 0; i < maxAttempts; i++ {
-				candidate := utils.GenerateSubdomain(8)
-				if utils.IsReserved(candidate) {
+		for _, long := range []bool{false, true} {
+			for i := 0; i < maxAttempts && !registered; i++ {
+				candidate := utils.GenerateSubdomain(style, prefix, long)
+				if m.denylist.Check(candidate) != nil || !utils.ValidateSubdomain(candidate) {
 					continue
 				}
-				if registerSubdomain(candidate) {
-					registered = true
-					break
-				}
+				registered = registerSubdomain(candidate)
 			}
 		}
 
 		if !registered {
+			m.releaseToken(token)
 			rollbackPerIP()
 			rollbackGlobal()
 			return "", ErrSubdomainGenerationFailed
@@ -300,6 +463,8 @@ func (m *Manager) RegisterWithIP(conn *websocket.Conn, customSubdomain string, r
 	metrics.TunnelRegistrations.Inc()
 	metrics.TunnelCount.Set(float64(m.tunnelCount.Load()))
 
+	m.dns.Publish(subdomain)
+
 	return subdomain, nil
 }
 
@@ -314,14 +479,16 @@ func (m *Manager) Unregister(subdomain string) {
 		return
 	}
 
-	remoteIP := tc.remoteIP
+	remoteIP, token := tc.remoteIP, tc.token
 	tc.Close()
 	delete(s.tunnels, subdomain)
 	delete(s.used, subdomain)
+	closeHistory(tc, "")
 	s.mu.Unlock()
 
 	// Update counters
 	m.tunnelCount.Add(-1)
+	m.releaseToken(token)
 	if remoteIP != "" {
 		m.ipMu.Lock()
 		if m.tunnelsByIP[remoteIP] > 0 {
@@ -340,6 +507,7 @@ func (m *Manager) Unregister(subdomain string) {
 		zap.String("subdomain", subdomain),
 		zap.Int64("total_tunnels", m.tunnelCount.Load()),
 	)
+	m.dns.Withdraw(subdomain)
 
 	// Update Prometheus metrics
 	metrics.TunnelCount.Set(float64(m.tunnelCount.Load()))
@@ -394,13 +562,16 @@ func (m *Manager) CleanupStale(timeout time.Duration) int {
 
 		for _, subdomain := range staleSubdomains {
 			if tc, ok := s.tunnels[subdomain]; ok {
-				remoteIP := tc.remoteIP
+				remoteIP, token := tc.remoteIP, tc.token
 				tc.Close()
 				delete(s.tunnels, subdomain)
 				delete(s.used, subdomain)
+				closeHistory(tc, "no activity")
+				m.dns.Withdraw(subdomain)
 
 				// Update counters
 				m.tunnelCount.Add(-1)
+				m.releaseToken(token)
 				if remoteIP != "" {
 					m.ipMu.Lock()
 					if m.tunnelsByIP[remoteIP] > 0 {
@@ -422,6 +593,7 @@ func (m *Manager) CleanupStale(timeout time.Duration) int {
 
 	// Cleanup expired rate limit entries
 	m.rateLimiter.Cleanup()
+	m.pruneHistory()
 
 	if totalCleaned > 0 {
 		m.logger.Info("Cleaned up stale tunnels",
@@ -432,6 +604,114 @@ func (m *Manager) CleanupStale(timeout time.Duration) int {
 	return totalCleaned
 }
 
+// Events returns the recent history of the tunnel on subdomain, oldest
+// first, also for a while after it closed.
+func (m *Manager) Events(subdomain string) ([]Event, bool) {
+	m.historyMu.Lock()
+	l, ok := m.history[subdomain]
+	m.historyMu.Unlock()
+	if !ok {
+		return nil, false
+	}
+	return l.Events(), true
+}
+
+// EventHistory returns the recent history of every tunnel that is
+// registered or closed within the retention period, by subdomain.
+func (m *Manager) EventHistory() map[string][]Event {
+	m.historyMu.Lock()
+	logs := make(map[string]*EventLog, len(m.history))
+	for subdomain, l := range m.history {
+		logs[subdomain] = l
+	}
+	m.historyMu.Unlock()
+
+	history := make(map[string][]Event, len(logs))
+	for subdomain, l := range logs {
+		history[subdomain] = l.Events()
+	}
+	return history
+}
+
+// openHistory returns the event log for a tunnel being registered on
+// subdomain, carrying on the one of an earlier tunnel there.
+func (m *Manager) openHistory(subdomain, remoteIP string) *EventLog {
+	detail := ""
+	if remoteIP != "" {
+		detail = "from " + remoteIP
+	}
+
+	m.historyMu.Lock()
+	defer m.historyMu.Unlock()
+
+	if l, ok := m.history[subdomain]; ok {
+		l.markClosed(time.Time{})
+		l.Record(EventReconnected, detail)
+		return l
+	}
+	l := NewEventLog(DefaultEventHistory)
+	l.Record(EventConnected, detail)
+	m.history[subdomain] = l
+	return l
+}
+
+// OpenRequestStore gives the tunnel on subdomain, registered with owner's
+// token, a store of its last size requests. It carries on the store of an
+// earlier tunnel there only if that tunnel had the same owner; a new owner
+// starts empty. With offline, the store also keeps requests arriving while
+// the tunnel is away. A size of zero drops any store and returns nil.
+func (m *Manager) OpenRequestStore(subdomain, owner string, size int, offline bool) *RequestStore {
+	m.historyMu.Lock()
+	defer m.historyMu.Unlock()
+
+	if size <= 0 {
+		delete(m.requests, subdomain)
+		return nil
+	}
+	if s, ok := m.requests[subdomain]; ok && s.owner == owner {
+		s.reset(size, offline)
+		return s
+	}
+	s := NewRequestStore(size)
+	s.owner = owner
+	s.offline = offline
+	m.requests[subdomain] = s
+	return s
+}
+
+// RequestStore returns the request store of subdomain, also while its
+// tunnel is away.
+func (m *Manager) RequestStore(subdomain string) (*RequestStore, bool) {
+	m.historyMu.Lock()
+	defer m.historyMu.Unlock()
+	s, ok := m.requests[subdomain]
+	return s, ok
+}
+
+// closeHistory records that tc went away and starts the retention period
+// of its history.
+func closeHistory(tc *Connection, reason string) {
+	if tc.events == nil {
+		return
+	}
+	tc.events.Record(EventDisconnected, reason)
+	tc.events.markClosed(time.Now())
+}
+
+// pruneHistory forgets the history of tunnels closed longer than the
+// retention period.
+func (m *Manager) pruneHistory() {
+	now := time.Now()
+	m.historyMu.Lock()
+	defer m.historyMu.Unlock()
+	for subdomain, l := range m.history {
+		if l.expired(now) {
+			delete(m.history, subdomain)
+			delete(m.requests, subdomain)
+		}
+	}
+}
+
 // StartCleanupTask starts a background task to clean up stale connections
 func (m *Manager) StartCleanupTask(interval, timeout time.Duration) {
 	ticker := time.NewTicker(interval)
@@ -0,0 +1,45 @@
+package tunnel
+
+import (
+	"errors"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestManagerTokenLimits(t *testing.T) {
+	m := NewManager(zap.NewNop())
+	defer m.Shutdown()
+	m.SetMaxTunnelsPerToken(2)
+	m.SetTokenBandwidth(1024, 0)
+
+	for _, name := range []string{"alice-one", "alice-two"} {
+		if _, err := m.RegisterWithIP(nil, name, "192.0.2.1", "alice", SubdomainNaming{}); err != nil {
+			t.Fatalf("RegisterWithIP(%s) = %v", name, err)
+		}
+	}
+	if _, err := m.RegisterWithIP(nil, "alice-three", "192.0.2.2", "alice", SubdomainNaming{}); !errors.Is(err, ErrTooManyPerToken) {
+		t.Errorf("third tunnel of a token: err = %v, want %v", err, ErrTooManyPerToken)
+	}
+	if _, ok := m.Get("alice-three"); ok || m.Count() != 2 {
+		t.Errorf("refused tunnel registered anyway, count = %d", m.Count())
+	}
+	if _, err := m.RegisterWithIP(nil, "bob-one", "192.0.2.1", "bob", SubdomainNaming{}); err != nil {
+		t.Errorf("another token: err = %v", err)
+	}
+
+	shared := m.TokenLimiter("alice")
+	if shared == nil || !shared.IsLimited() || m.TokenLimiter("alice") != shared || m.TokenLimiter("bob") == shared {
+		t.Errorf("TokenLimiter() = %v, want one limiter per token", shared)
+	}
+
+	m.Unregister("alice-one")
+	if _, err := m.RegisterWithIP(nil, "alice-three", "192.0.2.2", "alice", SubdomainNaming{}); err != nil {
+		t.Errorf("after Unregister: err = %v", err)
+	}
+	m.Unregister("alice-two")
+	m.Unregister("alice-three")
+	if m.TokenLimiter("alice") != nil {
+		t.Error("TokenLimiter() kept a token without tunnels")
+	}
+}
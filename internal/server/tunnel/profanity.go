@@ -0,0 +1,15 @@
+package tunnel
+
+// profanity is the built-in list of blocked words, see Denylist. Operators
+// extend it with blocked_subdomain_words.
+var profanity = []string{
+	"anal", "anus", "arse", "arsehole", "ass", "asshole", "bastard", "bitch",
+	"bitches", "blowjob", "bollocks", "boner", "boob", "boobs", "bullshit",
+	"butthole", "clit", "cock", "cocks", "crap", "cum", "cunt", "cunts",
+	"dick", "dickhead", "dildo", "dyke", "fag", "faggot", "fuck", "fucked",
+	"fucker", "fucking", "fucks", "handjob", "hentai", "horny", "jizz",
+	"milf", "motherfucker", "nazi", "nigga", "nigger", "nude", "nudes",
+	"orgasm", "penis", "piss", "porn", "porno", "pussy", "rape", "rapist",
+	"retard", "scat", "sex", "sexy", "shit", "shitty", "slut", "sluts",
+	"tits", "titties", "twat", "vagina", "wank", "wanker", "whore", "xxx",
+}
@@ -0,0 +1,198 @@
+package tunnel
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"drip/internal/shared/httputil"
+	"drip/internal/shared/protocol"
+)
+
+const (
+	// maxStoredBody is the largest request body a store keeps. Larger
+	// requests are listed but cannot be replayed.
+	maxStoredBody = 1 << 20
+
+	// requestStoreBudget bounds the bodies a store keeps in total; the
+	// oldest requests make room for new ones.
+	requestStoreBudget = 8 << 20
+)
+
+// ErrStoredRequestNotFound is returned for ids a store does not have.
+var ErrStoredRequestNotFound = errors.New("no stored request with this id")
+
+// ErrStoredRequestTruncated is returned for stored requests whose body
+// was too large to keep.
+var ErrStoredRequestTruncated = errors.New("stored request body was too large to keep")
+
+type storedRequest struct {
+	info       protocol.StoredRequest
+	host       string
+	remoteAddr string
+	header     http.Header
+	body       []byte
+}
+
+// RequestStore keeps the recent requests to a tunnel so they can be sent
+// to it again. The Manager keeps it across reconnects, like the tunnel's
+// history. It is safe for concurrent use.
+type RequestStore struct {
+	mu      sync.Mutex
+	size    int
+	entries []*storedRequest // oldest first
+	bytes   int
+	nextID  int64
+
+	// owner is the token of the tunnel the store was opened for. Only it
+	// may read or replay the stored requests.
+	owner string
+
+	// offline keeps requests arriving while the tunnel is away. It is off
+	// for tunnels with access rules, which are gone along with the tunnel.
+	offline bool
+}
+
+// NewRequestStore creates a store keeping the last size requests.
+func NewRequestStore(size int) *RequestStore {
+	return &RequestStore{size: min(max(size, 1), protocol.MaxRequestStore)}
+}
+
+// Record keeps r. It reads the body ahead of the tunnel, up to the size
+// stores keep, and leaves r able to read all of it. The id of the stored
+// request is returned for SetStatus.
+func (s *RequestStore) Record(r *http.Request, offline bool) (int64, error) {
+	entry := &storedRequest{
+		info: protocol.StoredRequest{
+			Time:    time.Now(),
+			Method:  r.Method,
+			URI:     r.URL.RequestURI(),
+			Offline: offline,
+		},
+		host:       r.Host,
+		remoteAddr: r.RemoteAddr,
+		header:     r.Header.Clone(),
+	}
+	httputil.CleanHopByHopHeaders(entry.header)
+	entry.header.Del(protocol.ReplayHeader)
+
+	if r.Body != nil && r.Body != http.NoBody {
+		buf, err := io.ReadAll(io.LimitReader(r.Body, maxStoredBody+1))
+		if err != nil {
+			return 0, err
+		}
+		if len(buf) > maxStoredBody {
+			entry.info.Truncated = true
+			entry.info.Size = r.ContentLength
+		} else {
+			entry.body = buf
+			entry.info.Size = int64(len(buf))
+		}
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(buf), r.Body), r.Body}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextID++
+	entry.info.ID = s.nextID
+	s.entries = append(s.entries, entry)
+	s.bytes += len(entry.body)
+	s.trimLocked()
+	return entry.info.ID, nil
+}
+
+// SetStatus records the status of the response to stored request id.
+func (s *RequestStore) SetStatus(id int64, status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e := s.findLocked(id); e != nil {
+		e.info.Status = status
+	}
+}
+
+// List describes the stored requests, oldest first.
+func (s *RequestStore) List() []protocol.StoredRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := make([]protocol.StoredRequest, len(s.entries))
+	for i, e := range s.entries {
+		list[i] = e.info
+	}
+	return list
+}
+
+// Request rebuilds stored request id to be sent to the tunnel again,
+// marked with ReplayHeader.
+func (s *RequestStore) Request(ctx context.Context, id int64) (*http.Request, error) {
+	s.mu.Lock()
+	e := s.findLocked(id)
+	s.mu.Unlock()
+	if e == nil {
+		return nil, ErrStoredRequestNotFound
+	}
+	if e.info.Truncated {
+		return nil, ErrStoredRequestTruncated
+	}
+
+	req, err := http.NewRequestWithContext(ctx, e.info.Method, "http://"+e.host+e.info.URI, bytes.NewReader(e.body))
+	if err != nil {
+		return nil, err
+	}
+	req.Host = e.host
+	req.RemoteAddr = e.remoteAddr
+	req.Header = e.header.Clone()
+	req.Header.Set(protocol.ReplayHeader, strconv.FormatInt(id, 10))
+	return req, nil
+}
+
+// Authorized reports whether token may list and replay the stored
+// requests, that is whether it is the token their tunnel registered with.
+func (s *RequestStore) Authorized(token string) bool {
+	s.mu.Lock()
+	owner := s.owner
+	s.mu.Unlock()
+	return owner != "" && subtle.ConstantTimeCompare([]byte(token), []byte(owner)) == 1
+}
+
+// AcceptsOffline reports whether requests arriving while the tunnel is
+// away are kept.
+func (s *RequestStore) AcceptsOffline() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.offline
+}
+
+// reset applies the settings of the tunnel now registered with the store.
+func (s *RequestStore) reset(size int, offline bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.size = min(max(size, 1), protocol.MaxRequestStore)
+	s.offline = offline
+	s.trimLocked()
+}
+
+func (s *RequestStore) trimLocked() {
+	for len(s.entries) > 0 && (len(s.entries) > s.size || s.bytes > requestStoreBudget) {
+		s.bytes -= len(s.entries[0].body)
+		s.entries[0] = nil
+		s.entries = s.entries[1:]
+	}
+}
+
+func (s *RequestStore) findLocked(id int64) *storedRequest {
+	for _, e := range s.entries {
+		if e.info.ID == id {
+			return e
+		}
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package tunnel
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"drip/internal/shared/protocol"
+
+	"go.uber.org/zap"
+)
+
+func TestRequestStore(t *testing.T) {
+	s := NewRequestStore(2)
+
+	for _, body := range []string{"one", "two", "three"} {
+		r := httptest.NewRequest("POST", "http://app.example.com/hook?n=1", strings.NewReader(body))
+		if _, err := s.Record(r, false); err != nil {
+			t.Fatalf("Record() = %v", err)
+		}
+		if got, _ := io.ReadAll(r.Body); string(got) != body {
+			t.Errorf("forwarded body = %q, want %q", got, body)
+		}
+	}
+
+	list := s.List()
+	if len(list) != 2 || list[0].ID != 2 || list[1].ID != 3 {
+		t.Fatalf("List() = %+v, want requests 2 and 3", list)
+	}
+	s.SetStatus(3, 201)
+	if got := s.List()[1].Status; got != 201 {
+		t.Errorf("status = %d, want 201", got)
+	}
+
+	req, err := s.Request(context.Background(), 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(req.Body)
+	if req.Method != "POST" || req.Host != "app.example.com" || req.URL.RequestURI() != "/hook?n=1" || string(body) != "three" {
+		t.Errorf("Request() = %s %s%s %q", req.Method, req.Host, req.URL.RequestURI(), body)
+	}
+	if got := req.Header.Get(protocol.ReplayHeader); got != "3" {
+		t.Errorf("%s = %q, want 3", protocol.ReplayHeader, got)
+	}
+	if _, err := s.Request(context.Background(), 1); !errors.Is(err, ErrStoredRequestNotFound) {
+		t.Errorf("Request(dropped) = %v, want %v", err, ErrStoredRequestNotFound)
+	}
+
+	large := httptest.NewRequest("POST", "/upload", bytes.NewReader(make([]byte, maxStoredBody+1)))
+	id, _ := s.Record(large, true)
+	if got, _ := io.ReadAll(large.Body); len(got) != maxStoredBody+1 {
+		t.Errorf("forwarded %d bytes of a large body, want %d", len(got), maxStoredBody+1)
+	}
+	if _, err := s.Request(context.Background(), id); !errors.Is(err, ErrStoredRequestTruncated) {
+		t.Errorf("Request(large) = %v, want %v", err, ErrStoredRequestTruncated)
+	}
+}
+
+func TestOpenRequestStoreOwner(t *testing.T) {
+	m := NewManager(zap.NewNop())
+	defer m.Shutdown()
+
+	first := m.OpenRequestStore("app", "alice", 10, true)
+	if _, err := first.Record(httptest.NewRequest("POST", "/hook", strings.NewReader("secret")), false); err != nil {
+		t.Fatal(err)
+	}
+	if !first.Authorized("alice") || first.Authorized("bob") || first.Authorized("") {
+		t.Error("store should only authorize the token it was opened for")
+	}
+
+	if again := m.OpenRequestStore("app", "alice", 10, true); again != first || len(again.List()) != 1 {
+		t.Error("the same owner should carry on its store")
+	}
+
+	next := m.OpenRequestStore("app", "bob", 10, true)
+	if next == first || len(next.List()) != 0 {
+		t.Errorf("a new owner got %d stored requests of the previous one", len(next.List()))
+	}
+	if got, _ := m.RequestStore("app"); got.Authorized("alice") {
+		t.Error("the previous owner can still read the store")
+	}
+}
@@ -0,0 +1,72 @@
+package tunnel
+
+import (
+	"sync"
+	"time"
+
+	"drip/internal/shared/netutil"
+	"drip/internal/shared/protocol"
+)
+
+// streamStatsBuffer is how many finished streams a watcher may fall behind
+// by before further ones are dropped for it.
+const streamStatsBuffer = 64
+
+// streamWatchers hands the stats of finished streams to whoever watches
+// them, see Connection.WatchStreams.
+type streamWatchers struct {
+	mu       sync.Mutex
+	watchers map[chan protocol.StreamStats]struct{}
+}
+
+// WatchStreams returns a channel receiving the stats of each stream of the
+// tunnel as it ends, and a function to stop watching. Stats a slow watcher
+// has no room for are dropped rather than holding up the stream.
+func (c *Connection) WatchStreams() (<-chan protocol.StreamStats, func()) {
+	w := &c.streamWatchers
+	ch := make(chan protocol.StreamStats, streamStatsBuffer)
+
+	w.mu.Lock()
+	if w.watchers == nil {
+		w.watchers = make(map[chan protocol.StreamStats]struct{})
+	}
+	w.watchers[ch] = struct{}{}
+	w.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			w.mu.Lock()
+			delete(w.watchers, ch)
+			w.mu.Unlock()
+		})
+	}
+}
+
+// RecordStream passes the stats of a finished stream to the tunnel's
+// watchers.
+func (c *Connection) RecordStream(stats protocol.StreamStats) {
+	w := &c.streamWatchers
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for ch := range w.watchers {
+		select {
+		case ch <- stats:
+		default:
+		}
+	}
+}
+
+// NewStreamStats returns the stats of a stream to the tunnel client that
+// started at start, as counted by sc on the server's end: what the server
+// wrote to the stream came from the visitor.
+func NewStreamStats(sc *netutil.StreamCounter, start time.Time) protocol.StreamStats {
+	return protocol.StreamStats{
+		StreamID:   sc.StreamID(),
+		BytesIn:    sc.BytesWritten(),
+		BytesOut:   sc.BytesRead(),
+		FramesIn:   sc.Writes(),
+		FramesOut:  sc.Reads(),
+		DurationMs: time.Since(start).Milliseconds(),
+	}
+}
@@ -0,0 +1,110 @@
+package tunnel
+
+import (
+	"container/list"
+	"net"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+const (
+	// visitorLimiterMaxEntries caps how many visitors a tunnel tracks; the
+	// least recently seen make room for new ones.
+	visitorLimiterMaxEntries = 10000
+	// visitorLimiterIdleTTL is how long an idle visitor entry is kept.
+	visitorLimiterIdleTTL = 10 * time.Minute
+)
+
+type visitorEntry struct {
+	key      string
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// VisitorLimiter applies a token bucket per visitor IP. IPv6 visitors
+// share a bucket per /64, the smallest block a single host usually gets.
+type VisitorLimiter struct {
+	mu       sync.Mutex
+	visitors map[string]*list.Element // of *visitorEntry
+	lru      *list.List               // most recently seen first
+	rps      rate.Limit
+	burst    int
+}
+
+// NewVisitorLimiter creates a limiter allowing rps requests per second with
+// the given burst for each visitor IP. Burst defaults to ceil(rps).
+func NewVisitorLimiter(rps float64, burst int) *VisitorLimiter {
+	if burst <= 0 {
+		burst = int(rps)
+		if float64(burst) < rps {
+			burst++
+		}
+		if burst < 1 {
+			burst = 1
+		}
+	}
+	return &VisitorLimiter{
+		visitors: make(map[string]*list.Element),
+		lru:      list.New(),
+		rps:      rate.Limit(rps),
+		burst:    burst,
+	}
+}
+
+// Allow reports whether a request from ip may proceed. When it may not,
+// retryAfter is the time until the next token is available.
+func (vl *VisitorLimiter) Allow(ip string) (ok bool, retryAfter time.Duration) {
+	now := time.Now()
+	key := visitorKey(ip)
+
+	vl.mu.Lock()
+	defer vl.mu.Unlock()
+
+	var entry *visitorEntry
+	if el, exists := vl.visitors[key]; exists {
+		entry = el.Value.(*visitorEntry)
+		vl.lru.MoveToFront(el)
+	} else {
+		entry = &visitorEntry{key: key, limiter: rate.NewLimiter(vl.rps, vl.burst)}
+		vl.visitors[key] = vl.lru.PushFront(entry)
+	}
+	entry.lastSeen = now
+	vl.pruneLocked(now)
+
+	r := entry.limiter.ReserveN(now, 1)
+	if delay := r.DelayFrom(now); delay > 0 {
+		r.CancelAt(now)
+		return false, delay
+	}
+	return true, 0
+}
+
+// Limits returns the configured rate and burst.
+func (vl *VisitorLimiter) Limits() (rps float64, burst int) {
+	return float64(vl.rps), vl.burst
+}
+
+// pruneLocked drops idle visitors and, beyond the cap, the least recently
+// seen ones. The list is ordered by lastSeen, so only its back is looked at.
+func (vl *VisitorLimiter) pruneLocked(now time.Time) {
+	for el := vl.lru.Back(); el != nil; el = vl.lru.Back() {
+		entry := el.Value.(*visitorEntry)
+		if vl.lru.Len() <= visitorLimiterMaxEntries && now.Sub(entry.lastSeen) <= visitorLimiterIdleTTL {
+			return
+		}
+		vl.lru.Remove(el)
+		delete(vl.visitors, entry.key)
+	}
+}
+
+// visitorKey returns the bucket of ip: the address itself for IPv4 and
+// its /64 for IPv6.
+func visitorKey(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil || parsed.To4() != nil {
+		return ip
+	}
+	return parsed.Mask(net.CIDRMask(64, 128)).String() + "/64"
+}
@@ -0,0 +1,45 @@
+package tunnel
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestVisitorLimiterIPv6Prefix(t *testing.T) {
+	vl := NewVisitorLimiter(1, 1)
+
+	if ok, _ := vl.Allow("2001:db8:1:2::1"); !ok {
+		t.Fatal("first request was rejected")
+	}
+	if ok, _ := vl.Allow("2001:db8:1:2:ffff::9"); ok {
+		t.Error("another address in the same /64 got its own bucket")
+	}
+	if ok, _ := vl.Allow("2001:db8:1:3::1"); !ok {
+		t.Error("another /64 should have its own bucket")
+	}
+}
+
+func TestVisitorLimiterEvictsLeastRecentlySeen(t *testing.T) {
+	vl := NewVisitorLimiter(1, 1)
+
+	if ok, _ := vl.Allow("198.51.100.1"); !ok {
+		t.Fatal("first request was rejected")
+	}
+	for i := 0; i < visitorLimiterMaxEntries; i++ {
+		vl.Allow(fmt.Sprintf("10.%d.%d.%d", i>>16&0xff, i>>8&0xff, i&0xff))
+	}
+	if n := len(vl.visitors); n != visitorLimiterMaxEntries || vl.lru.Len() != n {
+		t.Fatalf("limiter tracks %d visitors, want %d", n, visitorLimiterMaxEntries)
+	}
+	if _, ok := vl.visitors["198.51.100.1"]; ok {
+		t.Error("the least recently seen visitor was not evicted")
+	}
+
+	// A full table limits newcomers instead of letting them through.
+	if ok, _ := vl.Allow("192.0.2.7"); !ok {
+		t.Fatal("newcomer's first request was rejected")
+	}
+	if ok, _ := vl.Allow("192.0.2.7"); ok {
+		t.Error("newcomer to a full table was not rate limited")
+	}
+}
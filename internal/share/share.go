@@ -0,0 +1,156 @@
+// Package share serves a local app to the local network without a drip
+// server. It runs a server and a client in one process, the way bench
+// does, and exposes the tunnel on a plain HTTP listener, so visitors on
+// the same network go through the same proxy stack as on a public server.
+package share
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+
+	"drip/internal/client/tcp"
+	"drip/internal/server/proxy"
+	servertcp "drip/internal/server/tcp"
+	servertls "drip/internal/server/tls"
+	"drip/internal/server/tunnel"
+	"drip/internal/shared/protocol"
+	"drip/internal/shared/utils"
+)
+
+const (
+	domain    = "share.localhost"
+	subdomain = "share"
+
+	readHeaderTimeout = 10 * time.Second
+)
+
+// Config describes what to share and where.
+type Config struct {
+	LocalHost string      // host of the local app
+	LocalPort int         // port of the local app
+	Listen    string      // address visitors connect to, as host:port
+	Logger    *zap.Logger // nil discards logs
+}
+
+// Share is a running share, see Start.
+type Share struct {
+	addr     net.Addr
+	visitors *http.Server
+	client   tcp.TunnelClient
+	server   *servertcp.Listener
+}
+
+// Start shares the local app in cfg on cfg.Listen. The embedded server
+// only listens on loopback and only takes HTTP tunnels from its own
+// client, which authenticates with a token made up for the purpose.
+func Start(cfg Config) (*Share, error) {
+	logger := cfg.Logger
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	// Claim the visitor address first, it is the part most likely to fail.
+	ln, err := net.Listen("tcp", cfg.Listen)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", cfg.Listen, err)
+	}
+
+	cert, err := servertls.SelfSigned(domain, "*."+domain, "127.0.0.1")
+	if err != nil {
+		_ = ln.Close()
+		return nil, err
+	}
+
+	token := utils.GenerateID()
+	manager := tunnel.NewManager(logger)
+	handler := proxy.NewHandler(proxy.HandlerConfig{
+		Manager:      manager,
+		Logger:       logger,
+		ServerDomain: domain,
+		TunnelDomain: domain,
+	})
+	server := servertcp.NewListener(servertcp.ListenerConfig{
+		Address: "127.0.0.1:0",
+		TLSConfig: &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			MinVersion:   tls.VersionTLS13,
+		},
+		AuthToken:    token,
+		Manager:      manager,
+		Logger:       logger,
+		Domain:       domain,
+		TunnelDomain: domain,
+		HTTPHandler:  handler,
+	})
+	server.SetAllowedTunnelTypes([]string{string(protocol.TunnelTypeHTTP)})
+	if err := server.Start(); err != nil {
+		_ = ln.Close()
+		return nil, err
+	}
+
+	client := tcp.NewTunnelClient(&tcp.ConnectorConfig{
+		ServerAddr: server.Addr().String(),
+		Token:      token,
+		TunnelType: protocol.TunnelTypeHTTP,
+		LocalHost:  cfg.LocalHost,
+		LocalPort:  cfg.LocalPort,
+		Subdomain:  subdomain,
+		Insecure:   true,
+	}, logger)
+	if err := client.Connect(); err != nil {
+		_ = ln.Close()
+		shutdown(server)
+		return nil, fmt.Errorf("failed to connect share client: %w", err)
+	}
+
+	s := &Share{
+		addr: ln.Addr(),
+		visitors: &http.Server{
+			Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				handler.ServeTunnel(w, r, subdomain)
+			}),
+			ReadHeaderTimeout: readHeaderTimeout,
+		},
+		client: client,
+		server: server,
+	}
+	go func() {
+		if err := s.visitors.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("Share listener failed", zap.Error(err))
+		}
+	}()
+	return s, nil
+}
+
+// Addr returns the address visitors connect to.
+func (s *Share) Addr() net.Addr {
+	return s.addr
+}
+
+// URL returns the URL visitors open.
+func (s *Share) URL() string {
+	return "http://" + s.addr.String()
+}
+
+// Close stops taking visitors and shuts the tunnel down.
+func (s *Share) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := s.visitors.Shutdown(ctx)
+	_ = s.client.Close()
+	shutdown(s.server)
+	return err
+}
+
+func shutdown(server *servertcp.Listener) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_ = server.Shutdown(ctx)
+}
@@ -0,0 +1,42 @@
+package share
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func TestShare(t *testing.T) {
+	if testing.Short() {
+		t.Skip("starts a server and client")
+	}
+
+	app := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "app "+r.URL.Path)
+	}))
+	defer app.Close()
+	host, port, _ := net.SplitHostPort(app.Listener.Addr().String())
+	localPort, _ := strconv.Atoi(port)
+
+	s, err := Start(Config{LocalHost: host, LocalPort: localPort, Listen: "127.0.0.1:0"})
+	if err != nil {
+		t.Fatalf("Start() error: %v", err)
+	}
+	defer s.Close()
+
+	// Paths the server would answer itself belong to the app here.
+	for _, path := range []string{"/", "/health"} {
+		resp, err := http.Get(s.URL() + path)
+		if err != nil {
+			t.Fatalf("GET %s: %v", path, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || string(body) != "app "+path {
+			t.Errorf("GET %s = %d %q, want 200 %q", path, resp.StatusCode, body, "app "+path)
+		}
+	}
+}
@@ -0,0 +1,268 @@
+// Package chaos degrades connections on purpose so applications can be
+// tested over a slow or flaky tunnel. It delays what is written to a
+// connection and closes connections at random; reads are left alone, so
+// enabling it on both the client and the server affects both directions.
+package chaos
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// packetSize is the unit WriteDelay is charged per, roughly one TCP
+// segment on an Ethernet link.
+const packetSize = 1400
+
+// queueSize bounds the writes waiting for delivery. Writers block when it
+// is full, so a delayed connection pushes back instead of buffering
+// without limit.
+const queueSize = 256
+
+// Config describes the faults to inject. The zero value injects nothing.
+type Config struct {
+	Latency    time.Duration // added to every write
+	Jitter     time.Duration // random extra delay per write, up to this much
+	WriteDelay time.Duration // added per packetSize bytes written
+	Disconnect time.Duration // mean time before a connection is closed, 0 = never
+}
+
+// Parse reads a comma-separated spec such as
+// "latency=100ms,jitter=20ms,write-delay=1ms,disconnect=30s". An empty
+// spec returns nil.
+func Parse(spec string) (*Config, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return nil, nil
+	}
+
+	cfg := &Config{}
+	for _, part := range strings.Split(spec, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid chaos setting %q: use key=duration", part)
+		}
+		d, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("invalid chaos %s %q: use a duration like 50ms", key, value)
+		}
+		switch strings.TrimSpace(key) {
+		case "latency":
+			cfg.Latency = d
+		case "jitter":
+			cfg.Jitter = d
+		case "write-delay":
+			cfg.WriteDelay = d
+		case "disconnect":
+			cfg.Disconnect = d
+		default:
+			return nil, fmt.Errorf("unknown chaos setting %q (use latency, jitter, write-delay or disconnect)", key)
+		}
+	}
+	return cfg, nil
+}
+
+// String returns the spec Parse accepts for c.
+func (c *Config) String() string {
+	if c == nil {
+		return ""
+	}
+	var parts []string
+	for _, s := range []struct {
+		key string
+		d   time.Duration
+	}{
+		{"latency", c.Latency},
+		{"jitter", c.Jitter},
+		{"write-delay", c.WriteDelay},
+		{"disconnect", c.Disconnect},
+	} {
+		if s.d > 0 {
+			parts = append(parts, s.key+"="+s.d.String())
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// Enabled reports whether c injects any fault.
+func (c *Config) Enabled() bool {
+	return c != nil && (c.Latency > 0 || c.Jitter > 0 || c.WriteDelay > 0 || c.Disconnect > 0)
+}
+
+// Wrap returns conn with c's faults applied, or conn itself when c
+// injects nothing.
+func (c *Config) Wrap(conn net.Conn) net.Conn {
+	if !c.Enabled() {
+		return conn
+	}
+
+	cc := &faultyConn{
+		Conn:    conn,
+		cfg:     *c,
+		queue:   make(chan delivery, queueSize),
+		closeCh: make(chan struct{}),
+	}
+	if c.Latency > 0 || c.Jitter > 0 || c.WriteDelay > 0 {
+		go cc.deliver()
+	}
+	if c.Disconnect > 0 {
+		// Spread lifetimes over 0.5x-1.5x the mean so connections opened
+		// together do not all drop together.
+		lifetime := c.Disconnect/2 + rand.N(c.Disconnect)
+		go cc.dropAfter(lifetime)
+	}
+	return cc
+}
+
+// Listener returns ln with c's faults applied to every accepted connection.
+func (c *Config) Listener(ln net.Listener) net.Listener {
+	if !c.Enabled() {
+		return ln
+	}
+	return &listener{Listener: ln, cfg: c}
+}
+
+type listener struct {
+	net.Listener
+	cfg *Config
+}
+
+func (l *listener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return l.cfg.Wrap(conn), nil
+}
+
+type delivery struct {
+	data []byte
+	due  time.Time
+}
+
+// faultyConn queues writes and hands them to the underlying connection
+// once their delay has passed, keeping them in order.
+type faultyConn struct {
+	net.Conn
+	cfg Config
+
+	writeMu sync.Mutex
+	lastDue time.Time
+
+	queue     chan delivery
+	closeCh   chan struct{}
+	closeOnce sync.Once
+
+	errMu sync.Mutex
+	err   error
+}
+
+func (c *faultyConn) Write(p []byte) (int, error) {
+	if c.cfg.Latency == 0 && c.cfg.Jitter == 0 && c.cfg.WriteDelay == 0 {
+		return c.Conn.Write(p)
+	}
+	if err := c.writeErr(); err != nil {
+		return 0, err
+	}
+
+	delay := c.cfg.Latency
+	if c.cfg.Jitter > 0 {
+		delay += rand.N(c.cfg.Jitter)
+	}
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	// Jitter may not reorder bytes on a stream, so a write is never due
+	// before the one queued ahead of it.
+	due := time.Now().Add(delay)
+	if due.Before(c.lastDue) {
+		due = c.lastDue
+	}
+	c.lastDue = due
+
+	select {
+	case c.queue <- delivery{data: append([]byte(nil), p...), due: due}:
+		return len(p), nil
+	case <-c.closeCh:
+		return 0, net.ErrClosed
+	}
+}
+
+func (c *faultyConn) deliver() {
+	for {
+		var d delivery
+		select {
+		case d = <-c.queue:
+		case <-c.closeCh:
+			return
+		}
+
+		if wait := time.Until(d.due); wait > 0 {
+			select {
+			case <-time.After(wait):
+			case <-c.closeCh:
+				return
+			}
+		}
+
+		for len(d.data) > 0 {
+			n := len(d.data)
+			if c.cfg.WriteDelay > 0 {
+				n = min(n, packetSize)
+			}
+			if _, err := c.Conn.Write(d.data[:n]); err != nil {
+				c.setWriteErr(err)
+				_ = c.Close()
+				return
+			}
+			d.data = d.data[n:]
+
+			if c.cfg.WriteDelay > 0 {
+				select {
+				case <-time.After(c.cfg.WriteDelay):
+				case <-c.closeCh:
+					return
+				}
+			}
+		}
+	}
+}
+
+// dropAfter closes the connection once lifetime has passed, unless it is
+// closed before that.
+func (c *faultyConn) dropAfter(lifetime time.Duration) {
+	t := time.NewTimer(lifetime)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		_ = c.Close()
+	case <-c.closeCh:
+	}
+}
+
+func (c *faultyConn) writeErr() error {
+	c.errMu.Lock()
+	defer c.errMu.Unlock()
+	return c.err
+}
+
+func (c *faultyConn) setWriteErr(err error) {
+	c.errMu.Lock()
+	if c.err == nil {
+		c.err = err
+	}
+	c.errMu.Unlock()
+}
+
+func (c *faultyConn) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		close(c.closeCh)
+		err = c.Conn.Close()
+	})
+	return err
+}
@@ -0,0 +1,94 @@
+package chaos
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    *Config
+		wantErr bool
+	}{
+		{"", nil, false},
+		{"latency=100ms", &Config{Latency: 100 * time.Millisecond}, false},
+		{"latency=50ms, jitter=10ms,write-delay=1ms,disconnect=30s", &Config{
+			Latency:    50 * time.Millisecond,
+			Jitter:     10 * time.Millisecond,
+			WriteDelay: time.Millisecond,
+			Disconnect: 30 * time.Second,
+		}, false},
+		{"latency", nil, true},
+		{"latency=fast", nil, true},
+		{"latency=-1s", nil, true},
+		{"loss=1s", nil, true},
+	}
+
+	for _, tt := range tests {
+		got, err := Parse(tt.spec)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Parse(%q) error = %v, wantErr %v", tt.spec, err, tt.wantErr)
+			continue
+		}
+		if tt.want == nil {
+			if got != nil {
+				t.Errorf("Parse(%q) = %+v, want nil", tt.spec, got)
+			}
+			continue
+		}
+		if got == nil || *got != *tt.want {
+			t.Errorf("Parse(%q) = %+v, want %+v", tt.spec, got, tt.want)
+			continue
+		}
+		if again, _ := Parse(got.String()); *again != *got {
+			t.Errorf("Parse(%q).String() = %q does not round-trip", tt.spec, got.String())
+		}
+	}
+}
+
+func TestWrapDelaysWritesInOrder(t *testing.T) {
+	a, b := net.Pipe()
+	defer b.Close()
+
+	cfg := &Config{Latency: 50 * time.Millisecond, Jitter: 30 * time.Millisecond}
+	conn := cfg.Wrap(a)
+	defer conn.Close()
+
+	want := []byte("0123456789abcdefghij")
+	start := time.Now()
+	go func() {
+		for _, c := range want {
+			_, _ = conn.Write([]byte{c})
+		}
+	}()
+
+	got := make([]byte, len(want))
+	if _, err := io.ReadFull(b, got); err != nil {
+		t.Fatalf("ReadFull() error: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < cfg.Latency {
+		t.Errorf("data arrived after %v, want at least %v", elapsed, cfg.Latency)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("data arrived as %v, want %v", got, want)
+	}
+}
+
+func TestWrapDisconnects(t *testing.T) {
+	a, b := net.Pipe()
+	defer b.Close()
+
+	conn := (&Config{Disconnect: 20 * time.Millisecond}).Wrap(a)
+
+	_ = b.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err := b.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("Read() error = %v, want EOF once the connection is dropped", err)
+	}
+	if _, err := conn.Write([]byte("x")); err == nil {
+		t.Error("Write() succeeded on a dropped connection")
+	}
+}
@@ -43,6 +43,19 @@ const (
 	// HeartbeatTimeout is how long the server waits before considering a connection dead
 	HeartbeatTimeout = 6 * time.Second
 
+	// ClientStateInterval is how often clients report their version,
+	// streams and local service health in a heartbeat payload
+	ClientStateInterval = 30 * time.Second
+
+	// PowerSaveIdleTimeout is how long a tunnel in power-saving mode goes
+	// without streams before both ends stop heartbeats until traffic
+	// returns
+	PowerSaveIdleTimeout = 1 * time.Minute
+
+	// TunnelExpiryWarning is how long before a tunnel's TTL runs out the
+	// server warns the client
+	TunnelExpiryWarning = 5 * time.Minute
+
 	// ==================== Request/Response Timeouts ====================
 
 	// RequestTimeout is the maximum time to wait for a response from the client
@@ -69,7 +82,7 @@ const (
 	DefaultDomain = "tunnel.localhost"
 )
 
-// Error codes
+// Error codes carried in error frames (see protocol.Error)
 const (
 	ErrCodeTunnelNotFound   = "TUNNEL_NOT_FOUND"
 	ErrCodeTimeout          = "TIMEOUT"
@@ -77,4 +90,21 @@ const (
 	ErrCodeInvalidRequest   = "INVALID_REQUEST"
 	ErrCodeAuthFailed       = "AUTH_FAILED"
 	ErrCodeRateLimited      = "RATE_LIMITED"
+	ErrCodeClientTooOld     = "CLIENT_TOO_OLD"
+
+	// Registration
+	ErrCodeTunnelTypeNotAllowed = "TUNNEL_TYPE_NOT_ALLOWED"
+	ErrCodeSubdomainTaken       = "SUBDOMAIN_TAKEN"
+	ErrCodeSubdomainReserved    = "SUBDOMAIN_RESERVED"
+	ErrCodeInvalidSubdomain     = "INVALID_SUBDOMAIN"
+	ErrCodeTunnelLimit          = "TUNNEL_LIMIT"
+	ErrCodePortAllocationFailed = "PORT_ALLOCATION_FAILED"
+	ErrCodeInvalidTTL           = "INVALID_TTL"
+	ErrCodeRegistrationDenied   = "REGISTRATION_DENIED"
+	ErrCodeRegistrationFailed   = "REGISTRATION_FAILED"
+
+	// Control streams
+	ErrCodeUnsupported = "UNSUPPORTED"
+	ErrCodeNoTTL       = "NO_TTL"
+	ErrCodeP2PDisabled = "P2P_DISABLED"
 )
@@ -0,0 +1,311 @@
+// Package e2e encrypts TCP tunnel payloads between two drip clients so the
+// relay server only ever sees ciphertext.
+//
+// Both ends share a secret out of band. The relay sees the handshake, so a
+// guessed secret can be checked against recorded traffic offline; to make
+// each guess expensive the secret is first stretched with scrypt, salted
+// by the exposing side. Each connection then exchanges fresh salts,
+// per-direction AES-256-GCM keys are derived from the stretched key with
+// HKDF, and every record carries a 64-bit sequence number as its nonce, so
+// records cannot be replayed, reordered or truncated mid-record without
+// detection.
+package e2e
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	magic       = "DRE2"
+	keySaltSize = 16
+	saltSize    = 32
+	keySize     = 32
+
+	// scrypt parameters for stretching the secret: about 32MB and tens of
+	// milliseconds per guess.
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+
+	// maxStretchedKeys bounds the cache of stretched secrets.
+	maxStretchedKeys = 16
+
+	// MaxRecordSize is the largest plaintext carried by a single record.
+	MaxRecordSize = 16 * 1024
+
+	// MinSecretLength rejects the shortest passphrases. Stretching only
+	// slows down a relay that records the handshake and guesses offline;
+	// a secret it can guess is still broken, so use a random one.
+	MinSecretLength = 16
+
+	handshakeTimeout = 10 * time.Second
+)
+
+var (
+	// ErrSecretTooShort is returned for secrets below MinSecretLength.
+	ErrSecretTooShort = fmt.Errorf("e2e secret must be at least %d characters", MinSecretLength)
+	// ErrHandshake is returned when the peer does not speak the e2e protocol.
+	ErrHandshake = errors.New("e2e handshake failed: peer is not using end-to-end encryption")
+	// ErrAuth is returned when a record fails authentication, most often
+	// because the two ends use different secrets.
+	ErrAuth = errors.New("e2e record authentication failed: secrets do not match or data was tampered with")
+)
+
+// ValidateSecret checks that secret is long enough to be used.
+func ValidateSecret(secret string) error {
+	if len(secret) < MinSecretLength {
+		return ErrSecretTooShort
+	}
+	return nil
+}
+
+// Client wraps conn as the connecting side (the consumer).
+func Client(conn net.Conn, secret string) (net.Conn, error) {
+	return handshake(conn, secret, true)
+}
+
+// Server wraps conn as the accepting side (the exposing drip client).
+func Server(conn net.Conn, secret string) (net.Conn, error) {
+	return handshake(conn, secret, false)
+}
+
+// processKeySalt salts the secret of connections this process accepts.
+// It is random per process, so stretched secrets cannot be precomputed,
+// yet the stretching only runs once per secret rather than per connection.
+var processKeySalt = func() []byte {
+	salt := make([]byte, keySaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		panic(fmt.Sprintf("crypto/rand failed: %v", err))
+	}
+	return salt
+}()
+
+var stretched struct {
+	sync.Mutex
+	keys map[string][]byte
+}
+
+// stretchSecret returns scrypt(secret, keySalt), computed once per pair.
+func stretchSecret(secret string, keySalt []byte) ([]byte, error) {
+	id := string(keySalt) + secret
+
+	stretched.Lock()
+	key, ok := stretched.keys[id]
+	stretched.Unlock()
+	if ok {
+		return key, nil
+	}
+
+	key, err := scrypt.Key([]byte(secret), keySalt, scryptN, scryptR, scryptP, keySize)
+	if err != nil {
+		return nil, err
+	}
+
+	stretched.Lock()
+	if stretched.keys == nil || len(stretched.keys) >= maxStretchedKeys {
+		stretched.keys = make(map[string][]byte)
+	}
+	stretched.keys[id] = key
+	stretched.Unlock()
+	return key, nil
+}
+
+func handshake(conn net.Conn, secret string, initiator bool) (net.Conn, error) {
+	if err := ValidateSecret(secret); err != nil {
+		return nil, err
+	}
+
+	// The hello is magic, the accepting side's key salt (zeros from the
+	// initiator) and this connection's salt.
+	local := make([]byte, len(magic)+keySaltSize+saltSize)
+	copy(local, magic)
+	if !initiator {
+		copy(local[len(magic):], processKeySalt)
+	}
+	if _, err := rand.Read(local[len(magic)+keySaltSize:]); err != nil {
+		return nil, err
+	}
+
+	_ = conn.SetDeadline(time.Now().Add(handshakeTimeout))
+	defer conn.SetDeadline(time.Time{})
+
+	// Both sides write first; the hello is small enough to never block on
+	// a peer that is itself writing.
+	if _, err := conn.Write(local); err != nil {
+		return nil, err
+	}
+	remote := make([]byte, len(local))
+	if _, err := io.ReadFull(conn, remote); err != nil {
+		return nil, ErrHandshake
+	}
+	if string(remote[:len(magic)]) != magic {
+		return nil, ErrHandshake
+	}
+
+	keySalt := processKeySalt
+	if initiator {
+		keySalt = remote[len(magic) : len(magic)+keySaltSize]
+		if bytes.Equal(keySalt, make([]byte, keySaltSize)) {
+			return nil, ErrHandshake
+		}
+	}
+	key, err := stretchSecret(secret, keySalt)
+	if err != nil {
+		return nil, err
+	}
+
+	clientSalt, serverSalt := local[len(magic)+keySaltSize:], remote[len(magic)+keySaltSize:]
+	if !initiator {
+		clientSalt, serverSalt = serverSalt, clientSalt
+	}
+	salt := append(append([]byte{}, clientSalt...), serverSalt...)
+
+	c2s, err := deriveAEAD(key, salt, "drip e2e client to server")
+	if err != nil {
+		return nil, err
+	}
+	s2c, err := deriveAEAD(key, salt, "drip e2e server to client")
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Conn{Conn: conn}
+	if initiator {
+		c.sealer, c.opener = c2s, s2c
+	} else {
+		c.sealer, c.opener = s2c, c2s
+	}
+	return c, nil
+}
+
+func deriveAEAD(secret, salt []byte, info string) (cipher.AEAD, error) {
+	key, err := hkdf.Key(sha256.New, secret, salt, info, keySize)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Conn is an encrypted net.Conn. Reads and writes may be used from
+// different goroutines concurrently.
+type Conn struct {
+	net.Conn
+
+	sealer cipher.AEAD
+	opener cipher.AEAD
+
+	writeMu  sync.Mutex
+	writeSeq uint64
+	writeBuf []byte
+
+	readMu  sync.Mutex
+	readSeq uint64
+	readBuf []byte
+	pending []byte
+}
+
+// Write encrypts p into one or more records.
+func (c *Conn) Write(p []byte) (int, error) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	written := 0
+	for len(p) > 0 {
+		chunk := p[:min(len(p), MaxRecordSize)]
+
+		var nonce [12]byte
+		binary.BigEndian.PutUint64(nonce[4:], c.writeSeq)
+		c.writeSeq++
+
+		need := 2 + len(chunk) + c.sealer.Overhead()
+		if cap(c.writeBuf) < need {
+			c.writeBuf = make([]byte, need)
+		}
+		buf := c.writeBuf[:2]
+		buf = c.sealer.Seal(buf, nonce[:], chunk, nil)
+		binary.BigEndian.PutUint16(buf[:2], uint16(len(buf)-2))
+
+		if _, err := c.Conn.Write(buf); err != nil {
+			return written, err
+		}
+		written += len(chunk)
+		p = p[len(chunk):]
+	}
+	return written, nil
+}
+
+// Read returns decrypted data, reading a new record when the previous one
+// has been consumed.
+func (c *Conn) Read(p []byte) (int, error) {
+	c.readMu.Lock()
+	defer c.readMu.Unlock()
+
+	if len(c.pending) == 0 {
+		if err := c.readRecord(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, c.pending)
+	c.pending = c.pending[n:]
+	return n, nil
+}
+
+func (c *Conn) readRecord() error {
+	var hdr [2]byte
+	if _, err := io.ReadFull(c.Conn, hdr[:]); err != nil {
+		return err
+	}
+	size := int(binary.BigEndian.Uint16(hdr[:]))
+	if size < c.opener.Overhead() || size > MaxRecordSize+c.opener.Overhead() {
+		return ErrAuth
+	}
+
+	if cap(c.readBuf) < size {
+		c.readBuf = make([]byte, size)
+	}
+	buf := c.readBuf[:size]
+	if _, err := io.ReadFull(c.Conn, buf); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+
+	var nonce [12]byte
+	binary.BigEndian.PutUint64(nonce[4:], c.readSeq)
+	c.readSeq++
+
+	plain, err := c.opener.Open(buf[:0], nonce[:], buf, nil)
+	if err != nil {
+		return ErrAuth
+	}
+	c.pending = plain
+	return nil
+}
+
+// CloseWrite half-closes the underlying connection when supported, and
+// closes it otherwise, so that pipes relying on EOF keep working.
+func (c *Conn) CloseWrite() error {
+	if cw, ok := c.Conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return c.Conn.Close()
+}
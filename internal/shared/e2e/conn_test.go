@@ -0,0 +1,121 @@
+package e2e
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"testing"
+)
+
+const testSecret = "correct horse battery staple"
+
+// tcpPair returns both ends of a loopback TCP connection. net.Pipe is not
+// used because it is unbuffered and both sides write their hello first.
+func tcpPair(t *testing.T) (net.Conn, net.Conn) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		c, _ := ln.Accept()
+		accepted <- c
+	}()
+
+	client, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := <-accepted
+	t.Cleanup(func() {
+		client.Close()
+		server.Close()
+	})
+	return client, server
+}
+
+func handshakePair(t *testing.T, clientSecret, serverSecret string) (net.Conn, net.Conn, error) {
+	t.Helper()
+	rawClient, rawServer := tcpPair(t)
+
+	type result struct {
+		conn net.Conn
+		err  error
+	}
+	serverCh := make(chan result, 1)
+	go func() {
+		c, err := Server(rawServer, serverSecret)
+		serverCh <- result{c, err}
+	}()
+
+	client, err := Client(rawClient, clientSecret)
+	if err != nil {
+		return nil, nil, err
+	}
+	res := <-serverCh
+	return client, res.conn, res.err
+}
+
+func TestRoundTrip(t *testing.T) {
+	client, server, err := handshakePair(t, testSecret, testSecret)
+	if err != nil {
+		t.Fatalf("handshake: %v", err)
+	}
+
+	// Larger than one record to exercise chunking.
+	payload := bytes.Repeat([]byte("drip"), MaxRecordSize)
+	go func() {
+		client.Write(payload)
+		client.(*Conn).CloseWrite()
+	}()
+
+	got, err := io.ReadAll(server)
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	if !bytes.Equal(got, payload) {
+		t.Errorf("received %d bytes, want %d", len(got), len(payload))
+	}
+}
+
+func TestMismatchedSecret(t *testing.T) {
+	client, server, err := handshakePair(t, testSecret, "a different secret value")
+	if err != nil {
+		t.Fatalf("handshake: %v", err)
+	}
+
+	go client.Write([]byte("hello"))
+
+	buf := make([]byte, 16)
+	if _, err := server.Read(buf); !errors.Is(err, ErrAuth) {
+		t.Errorf("Read() error = %v, want ErrAuth", err)
+	}
+}
+
+func TestShortSecret(t *testing.T) {
+	if err := ValidateSecret("short"); !errors.Is(err, ErrSecretTooShort) {
+		t.Errorf("ValidateSecret() = %v, want ErrSecretTooShort", err)
+	}
+}
+
+func TestStretchSecret(t *testing.T) {
+	saltA := bytes.Repeat([]byte{1}, keySaltSize)
+	saltB := bytes.Repeat([]byte{2}, keySaltSize)
+
+	a1, err := stretchSecret(testSecret, saltA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a2, _ := stretchSecret(testSecret, saltA)
+	b, _ := stretchSecret(testSecret, saltB)
+	if !bytes.Equal(a1, a2) {
+		t.Error("the same secret and salt stretched to different keys")
+	}
+	if bytes.Equal(a1, b) {
+		t.Error("the stretched key does not depend on the salt")
+	}
+}
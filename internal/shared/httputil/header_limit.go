@@ -0,0 +1,53 @@
+package httputil
+
+import (
+	"errors"
+	"io"
+)
+
+// DefaultMaxHeaderListSize bounds request and response header blocks when
+// no limit is configured.
+const DefaultMaxHeaderListSize = 256 * 1024
+
+// ErrHeaderListTooLarge is returned while reading a header block that
+// exceeds its limit.
+var ErrHeaderListTooLarge = errors.New("header list too large")
+
+// HeaderLimitReader fails reads once more than a fixed number of bytes is
+// consumed, until Done is called. Placed under the bufio.Reader handed to
+// http.ReadResponse, it bounds the header block the way HTTP/2's
+// SETTINGS_MAX_HEADER_LIST_SIZE does, without limiting the body.
+type HeaderLimitReader struct {
+	r         io.Reader
+	remaining int64
+	done      bool
+}
+
+// NewHeaderLimitReader returns a reader allowing max bytes before Done. A
+// max of zero or less uses DefaultMaxHeaderListSize.
+func NewHeaderLimitReader(r io.Reader, max int) *HeaderLimitReader {
+	if max <= 0 {
+		max = DefaultMaxHeaderListSize
+	}
+	return &HeaderLimitReader{r: r, remaining: int64(max)}
+}
+
+func (l *HeaderLimitReader) Read(p []byte) (int, error) {
+	if l.done {
+		return l.r.Read(p)
+	}
+	if l.remaining <= 0 {
+		return 0, ErrHeaderListTooLarge
+	}
+	if int64(len(p)) > l.remaining {
+		p = p[:l.remaining]
+	}
+	n, err := l.r.Read(p)
+	l.remaining -= int64(n)
+	return n, err
+}
+
+// Done lifts the limit once the header block has been parsed.
+func (l *HeaderLimitReader) Done() {
+	l.done = true
+}
@@ -0,0 +1,48 @@
+package httputil
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestHeaderLimitReader(t *testing.T) {
+	body := strings.Repeat("b", 4096)
+	tests := []struct {
+		name    string
+		header  string
+		wantErr bool
+	}{
+		{"small header", "X-Small: 1\r\n", false},
+		{"header over the limit", "X-Big: " + strings.Repeat("a", 2048) + "\r\n", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw := "HTTP/1.1 200 OK\r\n" + tt.header +
+				"Content-Length: 4096\r\n\r\n" + body
+			limiter := NewHeaderLimitReader(strings.NewReader(raw), 1024)
+
+			resp, err := http.ReadResponse(bufio.NewReader(limiter), nil)
+			if tt.wantErr {
+				if !errors.Is(err, ErrHeaderListTooLarge) {
+					t.Fatalf("ReadResponse() error = %v, want ErrHeaderListTooLarge", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ReadResponse() error = %v", err)
+			}
+			limiter.Done()
+
+			// The body is larger than the limit and must still be readable.
+			got, err := io.ReadAll(resp.Body)
+			if err != nil || string(got) != body {
+				t.Errorf("body read %d bytes, err %v; want %d bytes", len(got), err, len(body))
+			}
+		})
+	}
+}
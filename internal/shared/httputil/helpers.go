@@ -64,6 +64,27 @@ func WriteProxyError(w io.Writer, code int, msg string) {
 	_ = resp.Body.Close()
 }
 
+// WriteRetryLater writes a 503 response asking the visitor to retry after
+// retryAfter seconds.
+func WriteRetryLater(w io.Writer, retryAfter int, msg string) {
+	resp := &http.Response{
+		StatusCode:    http.StatusServiceUnavailable,
+		Status:        "503 Service Unavailable",
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        make(http.Header),
+		Body:          io.NopCloser(strings.NewReader(msg)),
+		ContentLength: int64(len(msg)),
+		Close:         true,
+	}
+	resp.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	resp.Header.Set("Content-Length", fmt.Sprintf("%d", len(msg)))
+	resp.Header.Set("Retry-After", fmt.Sprintf("%d", retryAfter))
+	_ = resp.Write(w)
+	_ = resp.Body.Close()
+}
+
 func WriteLocalServiceUnavailable(w io.Writer, localPort int) {
 	html := fmt.Sprintf(`<!DOCTYPE html>
 <html lang="en">
@@ -0,0 +1,202 @@
+package httputil
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+
+	"drip/internal/shared/protocol"
+)
+
+// MaxRequestRules caps the number of rules a tunnel may install.
+const MaxRequestRules = 64
+
+// RuleSet evaluates request filtering rules in order; the first matching
+// rule decides. When nothing matches, requests are denied if the set
+// contains any allow rule and allowed otherwise.
+type RuleSet struct {
+	rules        []compiledRule
+	defaultAllow bool
+}
+
+type compiledRule struct {
+	allow     bool
+	methods   map[string]bool
+	path      string
+	glob      bool
+	userAgent *regexp.Regexp
+}
+
+// NewRuleSet validates and compiles rules. It returns nil for an empty list.
+func NewRuleSet(rules []protocol.RequestRule) (*RuleSet, error) {
+	if len(rules) == 0 {
+		return nil, nil
+	}
+	if len(rules) > MaxRequestRules {
+		return nil, fmt.Errorf("too many request rules: %d (max %d)", len(rules), MaxRequestRules)
+	}
+
+	rs := &RuleSet{defaultAllow: true}
+	for i, r := range rules {
+		cr := compiledRule{path: r.Path}
+
+		switch strings.ToLower(r.Action) {
+		case "allow":
+			cr.allow = true
+			rs.defaultAllow = false
+		case "deny":
+		default:
+			return nil, fmt.Errorf("rule %d: invalid action %q (must be allow or deny)", i+1, r.Action)
+		}
+
+		if len(r.Methods) > 0 {
+			cr.methods = make(map[string]bool, len(r.Methods))
+			for _, m := range r.Methods {
+				cr.methods[strings.ToUpper(strings.TrimSpace(m))] = true
+			}
+		}
+
+		if r.Path != "" {
+			if !strings.HasPrefix(r.Path, "/") {
+				return nil, fmt.Errorf("rule %d: path %q must start with /", i+1, r.Path)
+			}
+			if strings.Contains(r.Path, "*") {
+				if _, err := path.Match(r.Path, "/"); err != nil {
+					return nil, fmt.Errorf("rule %d: invalid path pattern %q: %w", i+1, r.Path, err)
+				}
+				cr.glob = true
+			}
+		}
+
+		if r.UserAgent != "" {
+			re, err := regexp.Compile("(?i)" + r.UserAgent)
+			if err != nil {
+				return nil, fmt.Errorf("rule %d: invalid user-agent pattern: %w", i+1, err)
+			}
+			cr.userAgent = re
+		}
+
+		if cr.methods == nil && cr.path == "" && cr.userAgent == nil {
+			return nil, fmt.Errorf("rule %d: at least one of method, path or user-agent is required", i+1)
+		}
+
+		rs.rules = append(rs.rules, cr)
+	}
+
+	return rs, nil
+}
+
+// Allow reports whether the request passes the rule set.
+// A nil RuleSet allows everything.
+func (rs *RuleSet) Allow(r *http.Request) bool {
+	if rs == nil {
+		return true
+	}
+	for i := range rs.rules {
+		if rs.rules[i].matches(r) {
+			return rs.rules[i].allow
+		}
+	}
+	return rs.defaultAllow
+}
+
+func (cr *compiledRule) matches(r *http.Request) bool {
+	if cr.methods != nil && !cr.methods[r.Method] {
+		return false
+	}
+	if cr.path != "" {
+		p := cleanPath(r.URL.Path)
+		if cr.glob {
+			if ok, _ := path.Match(cr.path, p); !ok {
+				return false
+			}
+		} else if !hasPathPrefix(p, cr.path) {
+			return false
+		}
+	}
+	if cr.userAgent != nil && !cr.userAgent.MatchString(r.UserAgent()) {
+		return false
+	}
+	return true
+}
+
+// cleanPath resolves "//", "." and ".." in a request path the way the
+// local server will, so "/a/../wp-admin" cannot get past a rule on
+// "/wp-admin". A trailing slash is kept for rules that end in one.
+func cleanPath(p string) string {
+	cleaned := path.Clean("/" + p)
+	if strings.HasSuffix(p, "/") && cleaned != "/" {
+		cleaned += "/"
+	}
+	return cleaned
+}
+
+// hasPathPrefix matches prefix as a whole path segment, so "/admin" covers
+// "/admin" and "/admin/users" but not "/administrator".
+func hasPathPrefix(p, prefix string) bool {
+	if !strings.HasPrefix(p, prefix) {
+		return false
+	}
+	return len(p) == len(prefix) || strings.HasSuffix(prefix, "/") || p[len(prefix)] == '/'
+}
+
+// ParseRequestRule parses the compact rule syntax used by the CLI and
+// config file, e.g. "deny path=/wp-admin", "deny ua=bot|crawler" or
+// "allow method=POST path=/webhook". Multiple methods are comma separated.
+func ParseRequestRule(s string) (protocol.RequestRule, error) {
+	var rule protocol.RequestRule
+
+	fields := strings.Fields(s)
+	if len(fields) < 2 {
+		return rule, fmt.Errorf("invalid rule %q: expected '<allow|deny> key=value...'", s)
+	}
+
+	rule.Action = strings.ToLower(fields[0])
+	if rule.Action != "allow" && rule.Action != "deny" {
+		return rule, fmt.Errorf("invalid rule %q: action must be allow or deny", s)
+	}
+
+	for _, f := range fields[1:] {
+		key, value, ok := strings.Cut(f, "=")
+		if !ok || value == "" {
+			return rule, fmt.Errorf("invalid rule %q: malformed matcher %q", s, f)
+		}
+		switch strings.ToLower(key) {
+		case "method", "methods":
+			for _, m := range strings.Split(value, ",") {
+				if m = strings.TrimSpace(m); m != "" {
+					rule.Methods = append(rule.Methods, strings.ToUpper(m))
+				}
+			}
+		case "path":
+			rule.Path = value
+		case "ua", "user-agent", "user_agent":
+			rule.UserAgent = value
+		default:
+			return rule, fmt.Errorf("invalid rule %q: unknown matcher %q", s, key)
+		}
+	}
+
+	return rule, nil
+}
+
+// ParseRequestRules parses and validates a list of compact rules.
+func ParseRequestRules(specs []string) ([]protocol.RequestRule, error) {
+	if len(specs) == 0 {
+		return nil, nil
+	}
+	rules := make([]protocol.RequestRule, 0, len(specs))
+	for _, s := range specs {
+		rule, err := ParseRequestRule(s)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	if _, err := NewRuleSet(rules); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
@@ -0,0 +1,91 @@
+package httputil
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"drip/internal/shared/protocol"
+)
+
+func TestRuleSetAllow(t *testing.T) {
+	tests := []struct {
+		name   string
+		rules  []string
+		method string
+		path   string
+		ua     string
+		want   bool
+	}{
+		{"no match allows", []string{"deny path=/wp-admin"}, "GET", "/", "", true},
+		{"deny prefix", []string{"deny path=/wp-admin"}, "GET", "/wp-admin/login.php", "", false},
+		{"prefix respects segments", []string{"deny path=/wp-admin"}, "GET", "/wp-admins", "", true},
+		{"deny glob", []string{"deny path=/*.php"}, "GET", "/index.php", "", false},
+		{"deny user agent", []string{"deny ua=bot|crawler"}, "GET", "/", "Mozilla/5.0 (compatible; Googlebot/2.1)", false},
+		{"user agent no match", []string{"deny ua=bot"}, "GET", "/", "curl/8.0", true},
+		{"allow only webhook", []string{"allow method=POST path=/webhook"}, "POST", "/webhook", "", true},
+		{"allow only webhook wrong method", []string{"allow method=POST path=/webhook"}, "GET", "/webhook", "", false},
+		{"allow only webhook other path", []string{"allow method=POST path=/webhook"}, "POST", "/other", "", false},
+		{"first match wins", []string{"allow path=/public", "deny path=/"}, "GET", "/public/a", "", true},
+		{"first match wins deny", []string{"allow path=/public", "deny path=/"}, "GET", "/secret", "", false},
+		{"double slash", []string{"deny path=/wp-admin"}, "GET", "//wp-admin", "", false},
+		{"dot segment", []string{"deny path=/wp-admin"}, "GET", "/./wp-admin", "", false},
+		{"dot dot segment", []string{"deny path=/wp-admin"}, "GET", "/a/../wp-admin/login.php", "", false},
+		{"dot dot above root", []string{"deny path=/wp-admin"}, "GET", "/../../wp-admin", "", false},
+		{"glob after cleaning", []string{"deny path=/*.php"}, "GET", "/x/../index.php", "", false},
+		{"trailing slash prefix", []string{"deny path=/private/"}, "GET", "/private//", "", false},
+		{"cleaning keeps other paths", []string{"deny path=/wp-admin"}, "GET", "/wp-admin/../public", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, err := ParseRequestRules(tt.rules)
+			if err != nil {
+				t.Fatalf("ParseRequestRules(%v) error = %v", tt.rules, err)
+			}
+			rs, err := NewRuleSet(rules)
+			if err != nil {
+				t.Fatalf("NewRuleSet() error = %v", err)
+			}
+
+			req := httptest.NewRequest(tt.method, "/", nil)
+			// Set the path directly: "//wp-admin" would parse as a host.
+			req.URL.Path = tt.path
+			if tt.ua != "" {
+				req.Header.Set("User-Agent", tt.ua)
+			}
+			if got := rs.Allow(req); got != tt.want {
+				t.Errorf("Allow(%s %s) = %v, want %v", tt.method, tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRequestRuleErrors(t *testing.T) {
+	tests := []string{
+		"",
+		"deny",
+		"block path=/x",
+		"deny path",
+		"deny host=example.com",
+		"deny path=relative",
+		"deny ua=(unclosed",
+	}
+
+	for _, spec := range tests {
+		t.Run(spec, func(t *testing.T) {
+			if _, err := ParseRequestRules([]string{spec}); err == nil {
+				t.Errorf("ParseRequestRules(%q) expected error", spec)
+			}
+		})
+	}
+}
+
+func TestNilRuleSetAllows(t *testing.T) {
+	rs, err := NewRuleSet([]protocol.RequestRule{})
+	if err != nil || rs != nil {
+		t.Fatalf("NewRuleSet(empty) = %v, %v; want nil, nil", rs, err)
+	}
+	if !rs.Allow(httptest.NewRequest("GET", "/", nil)) {
+		t.Error("nil RuleSet should allow all requests")
+	}
+}
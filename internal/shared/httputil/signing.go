@@ -0,0 +1,70 @@
+package httputil
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// SignatureHeader carries the server's signature of a forwarded request
+// body, as t=<unix time>,v1=<hex HMAC-SHA256 of "<t>.<body>">. Local apps
+// recompute it with the tunnel's signing secret to check that a request
+// came through drip, and compare t with their clock to refuse replays.
+const SignatureHeader = "X-Drip-Signature"
+
+// MaxSignedBodySize caps the request bodies the server buffers to sign.
+const MaxSignedBodySize = 10 << 20
+
+// MinSigningSecretLength is the shortest signing secret accepted.
+const MinSigningSecretLength = 16
+
+// ErrSignedBodyTooLarge is returned by SignRequest for bodies over
+// MaxSignedBodySize.
+var ErrSignedBodyTooLarge = errors.New("request body too large to sign")
+
+// ValidateSigningSecret checks a tunnel's signing secret.
+func ValidateSigningSecret(secret string) error {
+	if len(secret) < MinSigningSecretLength {
+		return fmt.Errorf("signing secret must be at least %d characters", MinSigningSecretLength)
+	}
+	return nil
+}
+
+// SignRequest reads the body of r, which it replaces with a fixed-length
+// copy, and sets SignatureHeader for it.
+func SignRequest(r *http.Request, secret []byte, now time.Time) error {
+	var body []byte
+	if r.Body != nil && r.Body != http.NoBody {
+		var err error
+		body, err = io.ReadAll(io.LimitReader(r.Body, MaxSignedBodySize+1))
+		_ = r.Body.Close()
+		if err != nil {
+			return err
+		}
+		if len(body) > MaxSignedBodySize {
+			return ErrSignedBodyTooLarge
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		r.ContentLength = int64(len(body))
+		r.TransferEncoding = nil
+	}
+	r.Header.Set(SignatureHeader, Signature(secret, now, body))
+	return nil
+}
+
+// Signature returns the SignatureHeader value for body at time now.
+func Signature(secret []byte, now time.Time, body []byte) string {
+	t := strconv.FormatInt(now.Unix(), 10)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(t))
+	mac.Write([]byte{'.'})
+	mac.Write(body)
+	return "t=" + t + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
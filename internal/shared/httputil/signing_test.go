@@ -0,0 +1,38 @@
+package httputil
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignRequest(t *testing.T) {
+	secret := []byte("whsec_0123456789abcdef")
+	now := time.Unix(1700000000, 0)
+
+	r := httptest.NewRequest("POST", "/hook", strings.NewReader(`{"ok":true}`))
+	r.ContentLength = -1
+	r.TransferEncoding = []string{"chunked"}
+	if err := SignRequest(r, secret, now); err != nil {
+		t.Fatalf("SignRequest() = %v", err)
+	}
+	want := "t=1700000000,v1=c81ee1c6f73100686b8d191f277e82a6e9f768264b55a74491d7407c92347987"
+	if got := r.Header.Get(SignatureHeader); got != want {
+		t.Errorf("signature = %s, want %s", got, want)
+	}
+	if r.ContentLength != 11 || r.TransferEncoding != nil {
+		t.Errorf("ContentLength = %d, TransferEncoding = %v; want a fixed length", r.ContentLength, r.TransferEncoding)
+	}
+	if body, _ := io.ReadAll(r.Body); string(body) != `{"ok":true}` {
+		t.Errorf("forwarded body = %q", body)
+	}
+
+	large := httptest.NewRequest("POST", "/hook", bytes.NewReader(make([]byte, MaxSignedBodySize+1)))
+	if err := SignRequest(large, secret, now); !errors.Is(err, ErrSignedBodyTooLarge) {
+		t.Errorf("SignRequest(large body) = %v, want %v", err, ErrSignedBodyTooLarge)
+	}
+}
@@ -0,0 +1,68 @@
+package httputil
+
+import (
+	"compress/flate"
+	"io"
+)
+
+// StreamEncodingHeader marks a tunnel response whose body was compressed by
+// the client for the hop to the server. The server removes it and decodes
+// the body before anything reaches the visitor.
+const StreamEncodingHeader = "X-Drip-Stream-Encoding"
+
+// StreamEncodingDeflate is raw DEFLATE primed with streamDictionary. Each
+// stream keeps its own 32KB window, so fields repeated across events are
+// sent as back-references after the first message.
+const StreamEncodingDeflate = "deflate-sse1"
+
+// streamDictionary seeds the compressor with tokens common to Server-Sent
+// Events and JSON streams. Changing it requires a new encoding name.
+var streamDictionary = []byte(`{"id":"","type":"","data":{},"event":"",` +
+	`"timestamp":"","status":"","message":"","error":null,"true","false"}` +
+	"\n\nretry: \nid: \nevent: message\nevent: \ndata: {\"\ndata: ")
+
+// StreamCompressor deflates a response body and flushes after every write
+// so event latency is unchanged.
+type StreamCompressor struct {
+	fw *flate.Writer
+}
+
+// NewStreamCompressor returns a compressor writing to w.
+func NewStreamCompressor(w io.Writer) *StreamCompressor {
+	// Levels 1-6 store small flushed writes without matching and drop
+	// their history, which defeats the point for one-line events.
+	fw, _ := flate.NewWriterDict(w, 7, streamDictionary)
+	return &StreamCompressor{fw: fw}
+}
+
+func (c *StreamCompressor) Write(p []byte) (int, error) {
+	n, err := c.fw.Write(p)
+	if err != nil {
+		return n, err
+	}
+	return n, c.fw.Flush()
+}
+
+// Close writes the final block. It does not close the underlying writer.
+func (c *StreamCompressor) Close() error {
+	return c.fw.Close()
+}
+
+type streamDecompressor struct {
+	io.ReadCloser
+	body io.Closer
+}
+
+func (d *streamDecompressor) Close() error {
+	_ = d.ReadCloser.Close()
+	return d.body.Close()
+}
+
+// NewStreamDecompressor decodes a body written by StreamCompressor. Closing
+// it also closes body.
+func NewStreamDecompressor(body io.ReadCloser) io.ReadCloser {
+	return &streamDecompressor{
+		ReadCloser: flate.NewReaderDict(body, streamDictionary),
+		body:       body,
+	}
+}
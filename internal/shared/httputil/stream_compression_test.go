@@ -0,0 +1,37 @@
+package httputil
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"testing"
+)
+
+func TestStreamCompressionRoundTrip(t *testing.T) {
+	var wire bytes.Buffer
+	c := NewStreamCompressor(&wire)
+
+	var want bytes.Buffer
+	for i := 0; i < 100; i++ {
+		event := fmt.Sprintf("event: tick\ndata: {\"id\":%d,\"status\":\"ok\"}\n\n", i)
+		want.WriteString(event)
+		if _, err := c.Write([]byte(event)); err != nil {
+			t.Fatalf("Write() = %v", err)
+		}
+	}
+	if err := c.Close(); err != nil {
+		t.Fatalf("Close() = %v", err)
+	}
+
+	if wire.Len() >= want.Len()/2 {
+		t.Errorf("compressed %d bytes to %d, want under half", want.Len(), wire.Len())
+	}
+
+	got, err := io.ReadAll(NewStreamDecompressor(io.NopCloser(&wire)))
+	if err != nil {
+		t.Fatalf("ReadAll() = %v", err)
+	}
+	if !bytes.Equal(got, want.Bytes()) {
+		t.Errorf("round trip mismatch: got %d bytes, want %d", len(got), want.Len())
+	}
+}
@@ -0,0 +1,47 @@
+package httputil
+
+import (
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// streamingContentTypes lists media types whose responses are consumed
+// incrementally by the client and must not be buffered or time-boxed.
+var streamingContentTypes = map[string]bool{
+	"text/event-stream":         true,
+	"application/x-ndjson":      true,
+	"application/stream+json":   true,
+	"multipart/x-mixed-replace": true,
+}
+
+// IsStreamingContentType reports whether the Content-Type value denotes a
+// long-lived streaming response such as Server-Sent Events.
+func IsStreamingContentType(contentType string) bool {
+	if contentType == "" {
+		return false
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = strings.TrimSpace(strings.SplitN(contentType, ";", 2)[0])
+	}
+	return streamingContentTypes[strings.ToLower(mediaType)]
+}
+
+// IsStreamingResponse reports whether the response should be flushed to the
+// client after every write. This covers recognized streaming content types as
+// well as chunked or otherwise length-less bodies used by long-poll endpoints.
+func IsStreamingResponse(resp *http.Response) bool {
+	if resp == nil {
+		return false
+	}
+	if IsStreamingContentType(resp.Header.Get("Content-Type")) {
+		return true
+	}
+	for _, te := range resp.TransferEncoding {
+		if strings.EqualFold(te, "chunked") {
+			return true
+		}
+	}
+	return resp.ContentLength < 0
+}
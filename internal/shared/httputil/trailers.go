@@ -0,0 +1,62 @@
+package httputil
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// TrailerKeys returns the canonical, comma separated list of trailer names
+// suitable for announcing in a "Trailer" response header.
+func TrailerKeys(trailer http.Header) string {
+	keys := make([]string, 0, len(trailer))
+	for k := range trailer {
+		keys = append(keys, http.CanonicalHeaderKey(k))
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, ", ")
+}
+
+// ChunkedWriter frames a body with HTTP/1.1 chunked transfer encoding so
+// that trailers can be emitted after the last chunk.
+type ChunkedWriter struct {
+	w io.Writer
+}
+
+// NewChunkedWriter returns a ChunkedWriter that writes to w.
+func NewChunkedWriter(w io.Writer) *ChunkedWriter {
+	return &ChunkedWriter{w: w}
+}
+
+// Write writes p as a single chunk. Empty writes are ignored because a
+// zero-length chunk terminates the body.
+func (c *ChunkedWriter) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if _, err := fmt.Fprintf(c.w, "%x\r\n", len(p)); err != nil {
+		return 0, err
+	}
+	n, err := c.w.Write(p)
+	if err != nil {
+		return n, err
+	}
+	if _, err := io.WriteString(c.w, "\r\n"); err != nil {
+		return n, err
+	}
+	return n, nil
+}
+
+// Close writes the terminating chunk followed by the given trailers.
+func (c *ChunkedWriter) Close(trailer http.Header) error {
+	if _, err := io.WriteString(c.w, "0\r\n"); err != nil {
+		return err
+	}
+	if err := trailer.Write(c.w); err != nil {
+		return err
+	}
+	_, err := io.WriteString(c.w, "\r\n")
+	return err
+}
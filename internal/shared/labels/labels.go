@@ -0,0 +1,87 @@
+// Package labels handles the key=value labels tunnels carry, e.g.
+// team=payments, to tell them apart in listings and the server's stats.
+package labels
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// Limits checked by Validate.
+const (
+	MaxLabels      = 32
+	MaxKeyLength   = 63
+	MaxValueLength = 255
+)
+
+var keyRegex = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9._/-]*[A-Za-z0-9])?$`)
+
+// Parse turns key=value pairs into labels. A key given twice keeps its last
+// value.
+func Parse(pairs []string) (map[string]string, error) {
+	if len(pairs) == 0 {
+		return nil, nil
+	}
+	labels := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid label %q: use key=value", pair)
+		}
+		labels[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	if err := Validate(labels); err != nil {
+		return nil, err
+	}
+	return labels, nil
+}
+
+// Validate checks label count, key format and value length. Keys are
+// letters, digits, '.', '_', '/' and '-', starting and ending with a letter
+// or digit; values are printable text.
+func Validate(labels map[string]string) error {
+	if len(labels) > MaxLabels {
+		return fmt.Errorf("too many labels: %d, at most %d", len(labels), MaxLabels)
+	}
+	for key, value := range labels {
+		if len(key) > MaxKeyLength || !keyRegex.MatchString(key) {
+			return fmt.Errorf("invalid label key %q: use up to %d letters, digits, '.', '_', '/' and '-'", key, MaxKeyLength)
+		}
+		if len(value) > MaxValueLength {
+			return fmt.Errorf("label %s is longer than %d characters", key, MaxValueLength)
+		}
+		if strings.IndexFunc(value, func(r rune) bool { return !unicode.IsPrint(r) }) >= 0 {
+			return fmt.Errorf("label %s contains unprintable characters", key)
+		}
+	}
+	return nil
+}
+
+// Match reports whether labels has every key of selector with the same
+// value. An empty selector matches anything.
+func Match(labels, selector map[string]string) bool {
+	for key, want := range selector {
+		if got, ok := labels[key]; !ok || got != want {
+			return false
+		}
+	}
+	return true
+}
+
+// Format renders labels as key=value pairs sorted by key, joined by
+// commas.
+func Format(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	pairs := make([]string, len(keys))
+	for i, key := range keys {
+		pairs[i] = key + "=" + labels[key]
+	}
+	return strings.Join(pairs, ",")
+}
@@ -0,0 +1,56 @@
+package labels
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		pairs   []string
+		want    string
+		wantErr bool
+	}{
+		{nil, "", false},
+		{[]string{"team=payments", "env=dev"}, "env=dev,team=payments", false},
+		{[]string{"env=dev", "env=prod"}, "env=prod", false},
+		{[]string{"example.com/owner=alice"}, "example.com/owner=alice", false},
+		{[]string{"empty="}, "empty=", false},
+		{[]string{"team"}, "", true},
+		{[]string{"=payments"}, "", true},
+		{[]string{"-team=payments"}, "", true},
+		{[]string{"team name=payments"}, "", true},
+		{[]string{strings.Repeat("k", MaxKeyLength+1) + "=v"}, "", true},
+		{[]string{"team=" + strings.Repeat("v", MaxValueLength+1)}, "", true},
+		{[]string{"team=a\nb"}, "", true},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.pairs)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Parse(%q) error = %v, wantErr %v", tt.pairs, err, tt.wantErr)
+			continue
+		}
+		if err == nil && Format(got) != tt.want {
+			t.Errorf("Parse(%q) = %q, want %q", tt.pairs, Format(got), tt.want)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	labels := map[string]string{"team": "payments", "env": "dev"}
+	tests := []struct {
+		selector map[string]string
+		want     bool
+	}{
+		{nil, true},
+		{map[string]string{"team": "payments"}, true},
+		{map[string]string{"team": "payments", "env": "dev"}, true},
+		{map[string]string{"team": "search"}, false},
+		{map[string]string{"owner": ""}, false},
+	}
+	for _, tt := range tests {
+		if got := Match(labels, tt.selector); got != tt.want {
+			t.Errorf("Match(%v) = %v, want %v", tt.selector, got, tt.want)
+		}
+	}
+}
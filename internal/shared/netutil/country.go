@@ -0,0 +1,69 @@
+package netutil
+
+import (
+	"fmt"
+	"strings"
+)
+
+// CountryAccessChecker checks a visitor's country against allow/deny lists
+// of ISO 3166-1 alpha-2 codes.
+type CountryAccessChecker struct {
+	allow map[string]struct{}
+	deny  map[string]struct{}
+}
+
+// NewCountryAccessChecker creates a checker from country code lists. Codes
+// are matched case-insensitively.
+func NewCountryAccessChecker(allow, deny []string) *CountryAccessChecker {
+	toSet := func(codes []string) map[string]struct{} {
+		if len(codes) == 0 {
+			return nil
+		}
+		set := make(map[string]struct{}, len(codes))
+		for _, code := range codes {
+			if code = strings.ToUpper(strings.TrimSpace(code)); code != "" {
+				set[code] = struct{}{}
+			}
+		}
+		return set
+	}
+	return &CountryAccessChecker{allow: toSet(allow), deny: toSet(deny)}
+}
+
+// IsAllowed checks if a visitor from country may connect. country is ""
+// when it is unknown, which passes a deny list but not an allow list.
+func (c *CountryAccessChecker) IsAllowed(country string) bool {
+	if c == nil {
+		return true
+	}
+	country = strings.ToUpper(country)
+	if _, denied := c.deny[country]; denied && country != "" {
+		return false
+	}
+	if len(c.allow) > 0 {
+		_, allowed := c.allow[country]
+		return allowed
+	}
+	return true
+}
+
+// HasRules returns true if any country rules are configured.
+func (c *CountryAccessChecker) HasRules() bool {
+	return c != nil && (len(c.allow) > 0 || len(c.deny) > 0)
+}
+
+// ValidateCountryCodes checks that every code is a two-letter ISO 3166-1
+// alpha-2 country code such as "US" or "de".
+func ValidateCountryCodes(codes []string) error {
+	for _, code := range codes {
+		code = strings.TrimSpace(code)
+		if len(code) != 2 || !isLetter(code[0]) || !isLetter(code[1]) {
+			return fmt.Errorf("invalid country code %q, expected two letters such as US", code)
+		}
+	}
+	return nil
+}
+
+func isLetter(c byte) bool {
+	return ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
@@ -1,6 +1,7 @@
 package netutil
 
 import (
+	"errors"
 	"net"
 	"net/http"
 	"strings"
@@ -25,14 +26,28 @@ func init() {
 }
 
 // ExtractRemoteIP extracts the IP address from a remote address string (host:port format).
+// The zone of a link-local IPv6 address (fe80::1%eth0) is dropped so the
+// result parses as an IP.
 func ExtractRemoteIP(remoteAddr string) string {
 	host, _, err := net.SplitHostPort(remoteAddr)
 	if err != nil {
 		return remoteAddr
 	}
+	if i := strings.IndexByte(host, '%'); i != -1 {
+		host = host[:i]
+	}
 	return host
 }
 
+// StripPort removes the port from a Host header value such as
+// "example.com:8443" or "[::1]:8443". IPv6 literals lose their brackets.
+func StripPort(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		return h
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+}
+
 // IsPrivateIP checks if the given IP is a private/loopback address.
 func IsPrivateIP(ip string) bool {
 	parsedIP := net.ParseIP(ip)
@@ -76,3 +91,55 @@ func ExtractClientIP(r *http.Request) string {
 	// Fall back to remote address
 	return remoteIP
 }
+
+// SetForwardedHeaders records the visitor address on a request that is about
+// to be forwarded to a local service. The remote address is appended to an
+// existing X-Forwarded-For chain only when the direct peer is a trusted
+// (private) proxy; otherwise any client-supplied chain is discarded.
+func SetForwardedHeaders(r *http.Request) {
+	remoteIP := ExtractRemoteIP(r.RemoteAddr)
+	if remoteIP == "" {
+		return
+	}
+
+	if prior := strings.Join(r.Header.Values("X-Forwarded-For"), ", "); prior != "" && IsPrivateIP(remoteIP) {
+		r.Header.Set("X-Forwarded-For", prior+", "+remoteIP)
+	} else {
+		r.Header.Set("X-Forwarded-For", remoteIP)
+	}
+	r.Header.Set("X-Real-IP", ExtractClientIP(r))
+}
+
+// LANIP returns the machine's address on its local network: the source
+// address of the default route if that is private, else the first private
+// IPv4 address of an interface that is up.
+func LANIP() (net.IP, error) {
+	// Dialing UDP sends nothing, it only picks the route.
+	if conn, err := net.Dial("udp4", "192.0.2.1:9"); err == nil {
+		ip := conn.LocalAddr().(*net.UDPAddr).IP
+		_ = conn.Close()
+		if ip.IsPrivate() {
+			return ip, nil
+		}
+	}
+
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.To4() != nil && ipNet.IP.IsPrivate() {
+				return ipNet.IP, nil
+			}
+		}
+	}
+	return nil, errors.New("no private network address found")
+}
@@ -41,6 +41,12 @@ func PipeWithBufferSize(ctx context.Context, a, b io.ReadWriteCloser, bufSize in
 }
 
 // PipeWithCallbacksAndBufferSize is PipeWithCallbacks with a custom buffer size.
+//
+// The multiplexer already demultiplexes each tunnel connection in a single
+// read loop, so the per-stream cost is in the copy loops here. Pipe keeps
+// it low for tunnels with many idle streams: the b -> a direction runs on
+// the calling goroutine, cancellation needs no watcher goroutine, and an
+// idle direction holds a small buffer rather than bufSize (see copyBuffer).
 func PipeWithCallbacksAndBufferSize(ctx context.Context, a, b io.ReadWriteCloser, bufSize int, onAToB func(n int64), onBToA func(n int64)) error {
 	if bufSize <= 0 {
 		bufSize = pool.SizeMedium
@@ -49,9 +55,6 @@ func PipeWithCallbacksAndBufferSize(ctx context.Context, a, b io.ReadWriteCloser
 		bufSize = pool.SizeLarge
 	}
 
-	var wg sync.WaitGroup
-	wg.Add(2)
-
 	stopCh := make(chan struct{})
 	var closeOnce sync.Once
 	closeAll := func() {
@@ -62,37 +65,27 @@ func PipeWithCallbacksAndBufferSize(ctx context.Context, a, b io.ReadWriteCloser
 		})
 	}
 
-	errCh := make(chan error, 2)
+	if ctx != nil {
+		stop := context.AfterFunc(ctx, closeAll)
+		defer stop()
+	}
 
-	go func() {
-		defer wg.Done()
-		err := pipeBuffer(b, a, bufSize, onAToB, stopCh)
-		if err != nil {
-			errCh <- err
-		}
-		closeAll()
-	}()
+	errCh := make(chan error, 2)
+	done := make(chan struct{})
 
 	go func() {
-		defer wg.Done()
-		err := pipeBuffer(a, b, bufSize, onBToA, stopCh)
-		if err != nil {
+		defer close(done)
+		if err := pipeBuffer(b, a, bufSize, onAToB, stopCh); err != nil {
 			errCh <- err
 		}
 		closeAll()
 	}()
 
-	if ctx != nil {
-		go func() {
-			select {
-			case <-ctx.Done():
-				closeAll()
-			case <-stopCh:
-			}
-		}()
+	if err := pipeBuffer(a, b, bufSize, onBToA, stopCh); err != nil {
+		errCh <- err
 	}
-
-	wg.Wait()
+	closeAll()
+	<-done
 
 	select {
 	case err := <-errCh:
@@ -103,11 +96,7 @@ func PipeWithCallbacksAndBufferSize(ctx context.Context, a, b io.ReadWriteCloser
 }
 
 func pipeBuffer(dst io.ReadWriteCloser, src io.ReadWriteCloser, bufSize int, onCopied func(n int64), stopCh <-chan struct{}) error {
-	bufPtr := pool.GetBuffer(bufSize)
-	defer pool.PutBuffer(bufPtr)
-
-	buf := (*bufPtr)[:bufSize]
-	_, err := copyBuffer(dst, src, buf, onCopied, stopCh)
+	_, err := copyBuffer(dst, src, bufSize, onCopied, stopCh)
 
 	if cr, ok := src.(closeReader); ok {
 		_ = cr.CloseRead()
@@ -130,7 +119,21 @@ func pipeBuffer(dst io.ReadWriteCloser, src io.ReadWriteCloser, bufSize int, onC
 	return err
 }
 
-func copyBuffer(dst io.Writer, src io.Reader, buf []byte, onCopied func(n int64), stopCh <-chan struct{}) (written int64, err error) {
+// copyBuffer copies src to dst. It reads into a small pooled buffer and
+// switches to one of bufSize once a read fills the small one, so a stream
+// only holds a large buffer while data is flowing. The large buffer goes
+// back to the pool as soon as a read comes back short again.
+func copyBuffer(dst io.Writer, src io.Reader, bufSize int, onCopied func(n int64), stopCh <-chan struct{}) (written int64, err error) {
+	small := pool.GetBuffer(pool.SizeSmall)
+	defer pool.PutBuffer(small)
+
+	var large *[]byte
+	defer func() {
+		if large != nil {
+			pool.PutBuffer(large)
+		}
+	}()
+
 	for {
 		select {
 		case <-stopCh:
@@ -138,6 +141,11 @@ func copyBuffer(dst io.Writer, src io.Reader, buf []byte, onCopied func(n int64)
 		default:
 		}
 
+		buf := (*small)[:pool.SizeSmall]
+		if large != nil {
+			buf = (*large)[:bufSize]
+		}
+
 		nr, er := src.Read(buf)
 		if nr > 0 {
 			nw, ew := dst.Write(buf[:nr])
@@ -160,5 +168,13 @@ func copyBuffer(dst io.Writer, src io.Reader, buf []byte, onCopied func(n int64)
 			}
 			return written, er
 		}
+
+		switch {
+		case large == nil && nr == len(buf) && bufSize > pool.SizeSmall:
+			large = pool.GetBuffer(bufSize)
+		case large != nil && nr < pool.SizeSmall:
+			pool.PutBuffer(large)
+			large = nil
+		}
 	}
 }
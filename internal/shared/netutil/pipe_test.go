@@ -0,0 +1,76 @@
+package netutil
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"drip/internal/shared/pool"
+)
+
+func TestPipeCopiesBothWays(t *testing.T) {
+	aPeer, a := net.Pipe()
+	b, bPeer := net.Pipe()
+
+	var toB, toA int64
+	done := make(chan error, 1)
+	go func() {
+		done <- PipeWithCallbacksAndBufferSize(context.Background(), a, b, pool.SizeLarge,
+			func(n int64) { toB += n },
+			func(n int64) { toA += n },
+		)
+	}()
+
+	// Large enough to move copyBuffer onto the big buffer and back.
+	upload := bytes.Repeat([]byte("x"), 3*pool.SizeLarge+17)
+	go func() {
+		_, _ = aPeer.Write(upload)
+		_, _ = aPeer.Write([]byte("tail"))
+	}()
+	got := make([]byte, len(upload)+len("tail"))
+	if _, err := io.ReadFull(bPeer, got); err != nil {
+		t.Fatalf("reading a -> b: %v", err)
+	}
+	if !bytes.Equal(got, append(upload, "tail"...)) {
+		t.Error("a -> b data corrupted")
+	}
+
+	go func() { _, _ = bPeer.Write([]byte("reply")) }()
+	reply := make([]byte, len("reply"))
+	if _, err := io.ReadFull(aPeer, reply); err != nil {
+		t.Fatalf("reading b -> a: %v", err)
+	}
+
+	aPeer.Close()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Pipe did not return after one side closed")
+	}
+
+	if toB != int64(len(got)) || toA != int64(len(reply)) {
+		t.Errorf("callbacks counted %d/%d bytes, want %d/%d", toB, toA, len(got), len(reply))
+	}
+}
+
+func TestPipeStopsOnContextCancel(t *testing.T) {
+	_, a := net.Pipe()
+	b, _ := net.Pipe()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		_ = Pipe(ctx, a, b)
+		close(done)
+	}()
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Pipe did not return after the context was canceled")
+	}
+}
@@ -0,0 +1,341 @@
+package netutil
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// proxyV2Signature is the fixed 12-byte preamble of a PROXY protocol v2 header.
+var proxyV2Signature = []byte{0x0D, 0x0A, 0x0D, 0x0A, 0x00, 0x0D, 0x0A, 0x51, 0x55, 0x49, 0x54, 0x0A}
+
+const (
+	proxyV2CmdLocal = 0x20
+	proxyV2CmdProxy = 0x21
+
+	proxyV2FamTCP4 = 0x11
+	proxyV2FamTCP6 = 0x21
+)
+
+// BuildProxyHeaderV2 encodes a HAProxy PROXY protocol v2 header describing a
+// TCP connection from src to dst. If either address is not a TCP address the
+// header uses the LOCAL command so receivers fall back to the socket address.
+func BuildProxyHeaderV2(src, dst net.Addr) []byte {
+	srcTCP, ok1 := src.(*net.TCPAddr)
+	dstTCP, ok2 := dst.(*net.TCPAddr)
+	if !ok1 || !ok2 || srcTCP.IP == nil || dstTCP.IP == nil {
+		hdr := make([]byte, 16)
+		copy(hdr, proxyV2Signature)
+		hdr[12] = proxyV2CmdLocal
+		return hdr
+	}
+
+	src4, dst4 := srcTCP.IP.To4(), dstTCP.IP.To4()
+	if src4 != nil && dst4 != nil {
+		hdr := make([]byte, 16+12)
+		copy(hdr, proxyV2Signature)
+		hdr[12] = proxyV2CmdProxy
+		hdr[13] = proxyV2FamTCP4
+		binary.BigEndian.PutUint16(hdr[14:16], 12)
+		copy(hdr[16:20], src4)
+		copy(hdr[20:24], dst4)
+		binary.BigEndian.PutUint16(hdr[24:26], uint16(srcTCP.Port))
+		binary.BigEndian.PutUint16(hdr[26:28], uint16(dstTCP.Port))
+		return hdr
+	}
+
+	// Mixed or IPv6 addresses are sent as IPv6 (IPv4 becomes v4-mapped).
+	hdr := make([]byte, 16+36)
+	copy(hdr, proxyV2Signature)
+	hdr[12] = proxyV2CmdProxy
+	hdr[13] = proxyV2FamTCP6
+	binary.BigEndian.PutUint16(hdr[14:16], 36)
+	copy(hdr[16:32], srcTCP.IP.To16())
+	copy(hdr[32:48], dstTCP.IP.To16())
+	binary.BigEndian.PutUint16(hdr[48:50], uint16(srcTCP.Port))
+	binary.BigEndian.PutUint16(hdr[50:52], uint16(dstTCP.Port))
+	return hdr
+}
+
+// WriteProxyHeaderV2 writes a PROXY protocol v2 header for src and dst to w.
+func WriteProxyHeaderV2(w io.Writer, src, dst net.Addr) error {
+	_, err := w.Write(BuildProxyHeaderV2(src, dst))
+	return err
+}
+
+// ErrNoProxyHeader is returned when a connection does not start with a
+// PROXY protocol v1 or v2 header.
+var ErrNoProxyHeader = errors.New("missing PROXY protocol header")
+
+const (
+	proxyV1Prefix    = "PROXY "
+	proxyV1MaxLength = 107
+	proxyV2MaxLength = 16 + 4096
+)
+
+// ReadProxyHeader consumes a PROXY protocol v1 or v2 header from br and
+// returns the source and destination addresses it carries. Both addresses
+// are nil for LOCAL/UNKNOWN headers, meaning the socket addresses apply.
+func ReadProxyHeader(br *bufio.Reader) (src, dst net.Addr, err error) {
+	sig, err := br.Peek(len(proxyV2Signature))
+	if err == nil && bytes.Equal(sig, proxyV2Signature) {
+		return readProxyHeaderV2(br)
+	}
+
+	prefix, err := br.Peek(len(proxyV1Prefix))
+	if err != nil {
+		return nil, nil, err
+	}
+	if string(prefix) != proxyV1Prefix {
+		return nil, nil, ErrNoProxyHeader
+	}
+	return readProxyHeaderV1(br)
+}
+
+func readProxyHeaderV1(br *bufio.Reader) (net.Addr, net.Addr, error) {
+	line := make([]byte, 0, proxyV1MaxLength)
+	for {
+		b, err := br.ReadByte()
+		if err != nil {
+			return nil, nil, err
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+		if len(line) >= proxyV1MaxLength {
+			return nil, nil, fmt.Errorf("PROXY v1 header too long")
+		}
+	}
+
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, nil, fmt.Errorf("malformed PROXY v1 header")
+	}
+	fields := strings.Fields(string(line[:len(line)-2]))
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, nil, fmt.Errorf("malformed PROXY v1 header")
+	}
+
+	srcIP, dstIP := net.ParseIP(fields[2]), net.ParseIP(fields[3])
+	srcPort, err1 := strconv.ParseUint(fields[4], 10, 16)
+	dstPort, err2 := strconv.ParseUint(fields[5], 10, 16)
+	if srcIP == nil || dstIP == nil || err1 != nil || err2 != nil {
+		return nil, nil, fmt.Errorf("malformed PROXY v1 addresses")
+	}
+
+	return &net.TCPAddr{IP: srcIP, Port: int(srcPort)},
+		&net.TCPAddr{IP: dstIP, Port: int(dstPort)},
+		nil
+}
+
+func readProxyHeaderV2(br *bufio.Reader) (net.Addr, net.Addr, error) {
+	hdr := make([]byte, 16)
+	if _, err := io.ReadFull(br, hdr); err != nil {
+		return nil, nil, err
+	}
+	if hdr[12]>>4 != 2 {
+		return nil, nil, fmt.Errorf("unsupported PROXY protocol version %d", hdr[12]>>4)
+	}
+
+	length := int(binary.BigEndian.Uint16(hdr[14:16]))
+	if 16+length > proxyV2MaxLength {
+		return nil, nil, fmt.Errorf("PROXY v2 header too long")
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(br, payload); err != nil {
+		return nil, nil, err
+	}
+
+	switch hdr[12] & 0x0F {
+	case 0x0:
+		return nil, nil, nil
+	case 0x1:
+	default:
+		return nil, nil, fmt.Errorf("unsupported PROXY v2 command %d", hdr[12]&0x0F)
+	}
+
+	switch hdr[13] >> 4 {
+	case 0x1:
+		if length < 12 {
+			return nil, nil, fmt.Errorf("short PROXY v2 IPv4 address block")
+		}
+		return &net.TCPAddr{IP: net.IP(payload[0:4]), Port: int(binary.BigEndian.Uint16(payload[8:10]))},
+			&net.TCPAddr{IP: net.IP(payload[4:8]), Port: int(binary.BigEndian.Uint16(payload[10:12]))},
+			nil
+	case 0x2:
+		if length < 36 {
+			return nil, nil, fmt.Errorf("short PROXY v2 IPv6 address block")
+		}
+		return &net.TCPAddr{IP: net.IP(payload[0:16]), Port: int(binary.BigEndian.Uint16(payload[32:34]))},
+			&net.TCPAddr{IP: net.IP(payload[16:32]), Port: int(binary.BigEndian.Uint16(payload[34:36]))},
+			nil
+	default:
+		// AF_UNSPEC / AF_UNIX: keep the socket addresses.
+		return nil, nil, nil
+	}
+}
+
+// ProxyProtoListener wraps a net.Listener and strips a mandatory PROXY
+// protocol header from every accepted connection. Headers are parsed on a
+// separate goroutine per connection so a slow peer cannot stall Accept.
+type ProxyProtoListener struct {
+	net.Listener
+	timeout time.Duration
+
+	conns     chan net.Conn
+	failed    chan struct{}
+	acceptErr error
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewProxyProtoListener starts accepting on ln and returns a listener that
+// yields connections whose RemoteAddr/LocalAddr reflect the PROXY header.
+// Connections without a valid header within timeout are dropped.
+func NewProxyProtoListener(ln net.Listener, timeout time.Duration) *ProxyProtoListener {
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	l := &ProxyProtoListener{
+		Listener: ln,
+		timeout:  timeout,
+		conns:    make(chan net.Conn),
+		failed:   make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go l.acceptLoop()
+	return l
+}
+
+// acceptLoop accepts until the listener is closed. Other errors, such as
+// running out of file descriptors, are retried with a growing delay as
+// net/http.Server does, so the listener outlives a spell of fd pressure.
+func (l *ProxyProtoListener) acceptLoop() {
+	var delay time.Duration
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				l.acceptErr = err
+				close(l.failed)
+				return
+			}
+			if delay == 0 {
+				delay = 5 * time.Millisecond
+			} else {
+				delay = min(delay*2, time.Second)
+			}
+			select {
+			case <-time.After(delay):
+			case <-l.done:
+				return
+			}
+			continue
+		}
+		delay = 0
+		go l.handshake(conn)
+	}
+}
+
+func (l *ProxyProtoListener) handshake(conn net.Conn) {
+	_ = conn.SetReadDeadline(time.Now().Add(l.timeout))
+	br := bufio.NewReaderSize(conn, 256)
+	src, dst, err := ReadProxyHeader(br)
+	if err != nil {
+		_ = conn.Close()
+		return
+	}
+	_ = conn.SetReadDeadline(time.Time{})
+
+	pc := &proxyProtoConn{Conn: conn, reader: br, remote: src, local: dst}
+	select {
+	case l.conns <- pc:
+	case <-l.done:
+		_ = conn.Close()
+	}
+}
+
+// Accept returns the next connection whose PROXY header has been parsed.
+func (l *ProxyProtoListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.failed:
+		return nil, l.acceptErr
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close stops accepting and closes the underlying listener.
+func (l *ProxyProtoListener) Close() error {
+	var err error
+	l.closeOnce.Do(func() {
+		close(l.done)
+		err = l.Listener.Close()
+	})
+	return err
+}
+
+type proxyProtoConn struct {
+	net.Conn
+	reader *bufio.Reader
+	remote net.Addr
+	local  net.Addr
+}
+
+func (c *proxyProtoConn) Read(p []byte) (int, error) {
+	if c.reader != nil {
+		if c.reader.Buffered() > 0 {
+			return c.reader.Read(p)
+		}
+		c.reader = nil
+	}
+	return c.Conn.Read(p)
+}
+
+func (c *proxyProtoConn) RemoteAddr() net.Addr {
+	if c.remote != nil {
+		return c.remote
+	}
+	return c.Conn.RemoteAddr()
+}
+
+func (c *proxyProtoConn) LocalAddr() net.Addr {
+	if c.local != nil {
+		return c.local
+	}
+	return c.Conn.LocalAddr()
+}
+
+// NetConn returns the underlying connection.
+func (c *proxyProtoConn) NetConn() net.Conn {
+	return c.Conn
+}
+
+// UnwrapTCPConn returns the *net.TCPConn beneath wrappers such as tls.Conn
+// or PROXY protocol connections, or nil if there is none.
+func UnwrapTCPConn(conn net.Conn) *net.TCPConn {
+	for conn != nil {
+		switch c := conn.(type) {
+		case *net.TCPConn:
+			return c
+		case interface{ NetConn() net.Conn }:
+			conn = c.NetConn()
+		default:
+			return nil
+		}
+	}
+	return nil
+}
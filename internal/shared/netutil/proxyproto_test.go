@@ -0,0 +1,196 @@
+package netutil
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestProxyHeaderV2RoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		src  *net.TCPAddr
+		dst  *net.TCPAddr
+	}{
+		{"ipv4", &net.TCPAddr{IP: net.ParseIP("203.0.113.7"), Port: 51234}, &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 20000}},
+		{"ipv6", &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 443}, &net.TCPAddr{IP: net.ParseIP("2001:db8::2"), Port: 8443}},
+		{"mixed", &net.TCPAddr{IP: net.ParseIP("198.51.100.2"), Port: 1}, &net.TCPAddr{IP: net.ParseIP("::1"), Port: 2}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := append(BuildProxyHeaderV2(tt.src, tt.dst), "payload"...)
+			br := bufio.NewReader(bytes.NewReader(data))
+
+			src, dst, err := ReadProxyHeader(br)
+			if err != nil {
+				t.Fatalf("ReadProxyHeader() error = %v", err)
+			}
+			gotSrc, gotDst := src.(*net.TCPAddr), dst.(*net.TCPAddr)
+			if !gotSrc.IP.Equal(tt.src.IP) || gotSrc.Port != tt.src.Port {
+				t.Errorf("src = %v, want %v", gotSrc, tt.src)
+			}
+			if !gotDst.IP.Equal(tt.dst.IP) || gotDst.Port != tt.dst.Port {
+				t.Errorf("dst = %v, want %v", gotDst, tt.dst)
+			}
+
+			rest, _ := io.ReadAll(br)
+			if string(rest) != "payload" {
+				t.Errorf("remaining data = %q, want %q", rest, "payload")
+			}
+		})
+	}
+}
+
+func TestBuildProxyHeaderV2(t *testing.T) {
+	sig := string(proxyV2Signature)
+	tests := []struct {
+		name string
+		src  net.Addr
+		dst  net.Addr
+		want []byte
+	}{
+		{
+			"ipv4",
+			&net.TCPAddr{IP: net.ParseIP("203.0.113.7"), Port: 51234},
+			&net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 20000},
+			[]byte(sig + "\x21\x11\x00\x0c" +
+				"\xcb\x00\x71\x07" + "\x0a\x00\x00\x01" +
+				"\xc8\x22" + "\x4e\x20"),
+		},
+		{
+			"mixed",
+			&net.TCPAddr{IP: net.ParseIP("198.51.100.2"), Port: 1},
+			&net.TCPAddr{IP: net.ParseIP("::1"), Port: 2},
+			[]byte(sig + "\x21\x21\x00\x24" +
+				"\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\xff\xff\xc6\x33\x64\x02" +
+				"\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x01" +
+				"\x00\x01" + "\x00\x02"),
+		},
+		{
+			"non-tcp",
+			&net.UnixAddr{Name: "/tmp/drip.sock", Net: "unix"},
+			&net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 20000},
+			[]byte(sig + "\x20\x00\x00\x00"),
+		},
+		{
+			"nil ip",
+			&net.TCPAddr{Port: 1},
+			&net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 2},
+			[]byte(sig + "\x20\x00\x00\x00"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := BuildProxyHeaderV2(tt.src, tt.dst)
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("BuildProxyHeaderV2() = % x, want % x", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadProxyHeaderV1(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		wantSrc string
+		wantErr bool
+	}{
+		{"tcp4", "PROXY TCP4 192.0.2.1 192.0.2.2 5555 443\r\nGET", "192.0.2.1:5555", false},
+		{"tcp6", "PROXY TCP6 2001:db8::1 2001:db8::2 5555 443\r\n", "[2001:db8::1]:5555", false},
+		{"unknown", "PROXY UNKNOWN\r\n", "", false},
+		{"bad port", "PROXY TCP4 192.0.2.1 192.0.2.2 70000 443\r\n", "", true},
+		{"missing crlf", "PROXY TCP4 192.0.2.1 192.0.2.2 1 2\n", "", true},
+		{"too long", "PROXY TCP4 " + strings.Repeat("1", 200) + "\r\n", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src, _, err := ReadProxyHeader(bufio.NewReader(strings.NewReader(tt.input)))
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ReadProxyHeader(%q) expected error", tt.input)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ReadProxyHeader(%q) error = %v", tt.input, err)
+			}
+			got := ""
+			if src != nil {
+				got = src.String()
+			}
+			if got != tt.wantSrc {
+				t.Errorf("src = %q, want %q", got, tt.wantSrc)
+			}
+		})
+	}
+}
+
+func TestReadProxyHeaderMissing(t *testing.T) {
+	_, _, err := ReadProxyHeader(bufio.NewReader(strings.NewReader("GET / HTTP/1.1\r\n\r\n")))
+	if !errors.Is(err, ErrNoProxyHeader) {
+		t.Errorf("error = %v, want ErrNoProxyHeader", err)
+	}
+}
+
+// flakyListener fails its first Accept calls with errs before accepting
+// from the wrapped listener.
+type flakyListener struct {
+	net.Listener
+	errs chan error
+}
+
+func (l *flakyListener) Accept() (net.Conn, error) {
+	select {
+	case err := <-l.errs:
+		return nil, err
+	default:
+		return l.Listener.Accept()
+	}
+}
+
+func TestProxyProtoListenerRetriesAcceptErrors(t *testing.T) {
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	flaky := &flakyListener{Listener: inner, errs: make(chan error, 3)}
+	for range 3 {
+		flaky.errs <- &net.OpError{Op: "accept", Net: "tcp", Err: syscall.EMFILE}
+	}
+	ln := NewProxyProtoListener(flaky, time.Second)
+	defer ln.Close()
+
+	client, err := net.Dial("tcp", inner.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	src := &net.TCPAddr{IP: net.ParseIP("203.0.113.7"), Port: 51234}
+	if err := WriteProxyHeaderV2(client, src, inner.Addr()); err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatalf("Accept() error = %v, want the listener to outlive EMFILE", err)
+	}
+	defer conn.Close()
+	if got := conn.RemoteAddr().String(); got != src.String() {
+		t.Errorf("RemoteAddr() = %s, want %s", got, src)
+	}
+
+	ln.Close()
+	if _, err := ln.Accept(); !errors.Is(err, net.ErrClosed) {
+		t.Errorf("Accept() after Close error = %v, want net.ErrClosed", err)
+	}
+}
@@ -0,0 +1,111 @@
+package netutil
+
+import (
+	"io"
+	"net"
+	"strings"
+
+	"golang.org/x/crypto/cryptobyte"
+)
+
+const (
+	tlsRecordHeaderLen  = 5
+	tlsMaxRecordLen     = 16384
+	tlsRecordHandshake  = 0x16
+	tlsClientHello      = 0x01
+	tlsExtServerName    = 0x0000
+	tlsServerNameHostID = 0x00
+)
+
+// PeekServerName reads the TLS ClientHello at the start of conn and
+// returns the SNI server name it carries, lowercased, along with a conn
+// that replays the bytes read. The name is empty when the client sent
+// none or the first record is not a ClientHello; the returned conn is
+// usable either way, for example to terminate TLS on it afterwards.
+func PeekServerName(conn net.Conn) (string, net.Conn, error) {
+	header := make([]byte, tlsRecordHeaderLen)
+	if n, err := io.ReadFull(conn, header); err != nil {
+		return "", &prefixConn{Conn: conn, prefix: header[:n]}, err
+	}
+	length := int(header[3])<<8 | int(header[4])
+	if header[0] != tlsRecordHandshake || length > tlsMaxRecordLen {
+		return "", &prefixConn{Conn: conn, prefix: header}, nil
+	}
+
+	record := make([]byte, tlsRecordHeaderLen+length)
+	copy(record, header)
+	n, err := io.ReadFull(conn, record[tlsRecordHeaderLen:])
+	record = record[:tlsRecordHeaderLen+n]
+	if err != nil {
+		return "", &prefixConn{Conn: conn, prefix: record}, err
+	}
+	return parseServerName(record[tlsRecordHeaderLen:]), &prefixConn{Conn: conn, prefix: record}, nil
+}
+
+// parseServerName extracts the host_name entry of the server_name
+// extension from a handshake record holding a ClientHello. A ClientHello
+// split across records is not parsed, and yields no name.
+func parseServerName(data []byte) string {
+	s := cryptobyte.String(data)
+	var msgType uint8
+	var hello cryptobyte.String
+	if !s.ReadUint8(&msgType) || msgType != tlsClientHello || !s.ReadUint24LengthPrefixed(&hello) {
+		return ""
+	}
+
+	var sessionID, cipherSuites, compression, extensions cryptobyte.String
+	if !hello.Skip(2+32) || // legacy_version and random
+		!hello.ReadUint8LengthPrefixed(&sessionID) ||
+		!hello.ReadUint16LengthPrefixed(&cipherSuites) ||
+		!hello.ReadUint8LengthPrefixed(&compression) ||
+		!hello.ReadUint16LengthPrefixed(&extensions) {
+		return ""
+	}
+
+	for !extensions.Empty() {
+		var extType uint16
+		var extData cryptobyte.String
+		if !extensions.ReadUint16(&extType) || !extensions.ReadUint16LengthPrefixed(&extData) {
+			return ""
+		}
+		if extType != tlsExtServerName {
+			continue
+		}
+		var names cryptobyte.String
+		if !extData.ReadUint16LengthPrefixed(&names) {
+			return ""
+		}
+		for !names.Empty() {
+			var nameType uint8
+			var name cryptobyte.String
+			if !names.ReadUint8(&nameType) || !names.ReadUint16LengthPrefixed(&name) {
+				return ""
+			}
+			if nameType == tlsServerNameHostID {
+				return strings.ToLower(strings.TrimSuffix(string(name), "."))
+			}
+		}
+		return ""
+	}
+	return ""
+}
+
+// prefixConn replays bytes already read from Conn before reading more.
+type prefixConn struct {
+	net.Conn
+	prefix []byte
+}
+
+func (c *prefixConn) Read(p []byte) (int, error) {
+	if len(c.prefix) > 0 {
+		n := copy(p, c.prefix)
+		c.prefix = c.prefix[n:]
+		return n, nil
+	}
+	return c.Conn.Read(p)
+}
+
+// NetConn returns the underlying connection.
+func (c *prefixConn) NetConn() net.Conn {
+	return c.Conn
+}
@@ -0,0 +1,66 @@
+package netutil
+
+import (
+	"crypto/tls"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestPeekServerName(t *testing.T) {
+	tests := []struct {
+		name       string
+		serverName string
+		want       string
+	}{
+		{"host", "app.example.com", "app.example.com"},
+		{"mixed case", "App.Example.COM", "app.example.com"},
+		{"no sni", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, server := net.Pipe()
+			defer server.Close()
+			go func() {
+				defer client.Close()
+				_ = tls.Client(client, &tls.Config{ServerName: tt.serverName, InsecureSkipVerify: true}).Handshake()
+			}()
+			_ = server.SetDeadline(time.Now().Add(5 * time.Second))
+
+			got, conn, err := PeekServerName(server)
+			if err != nil {
+				t.Fatalf("PeekServerName() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("PeekServerName() = %q, want %q", got, tt.want)
+			}
+
+			// The returned conn replays the ClientHello from its start.
+			header := make([]byte, tlsRecordHeaderLen)
+			if _, err := io.ReadFull(conn, header); err != nil || header[0] != tlsRecordHandshake {
+				t.Errorf("replayed header = %x, %v; want a handshake record", header, err)
+			}
+		})
+	}
+}
+
+func TestPeekServerNameNotTLS(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	const request = "GET / HTTP/1.1\r\nHost: example.com\r\n\r\n"
+	go func() {
+		_, _ = client.Write([]byte(request))
+		_ = client.Close()
+	}()
+
+	got, conn, err := PeekServerName(server)
+	if err != nil || got != "" {
+		t.Fatalf("PeekServerName() = %q, %v; want no name", got, err)
+	}
+	data, err := io.ReadAll(conn)
+	if err != nil || string(data) != request {
+		t.Errorf("replayed %q, %v; want %q", data, err, request)
+	}
+}
@@ -0,0 +1,61 @@
+package netutil
+
+import (
+	"net"
+	"sync/atomic"
+)
+
+// StreamCounter counts the bytes of a single stream and the reads and
+// writes they were moved in. Unlike CountingConn it keeps the totals, so
+// they can be reported once the stream is done.
+type StreamCounter struct {
+	net.Conn
+
+	bytesRead    atomic.Int64
+	bytesWritten atomic.Int64
+	reads        atomic.Int64
+	writes       atomic.Int64
+}
+
+func NewStreamCounter(conn net.Conn) *StreamCounter {
+	return &StreamCounter{Conn: conn}
+}
+
+func (c *StreamCounter) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if n > 0 {
+		c.bytesRead.Add(int64(n))
+		c.reads.Add(1)
+	}
+	return n, err
+}
+
+func (c *StreamCounter) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	if n > 0 {
+		c.bytesWritten.Add(int64(n))
+		c.writes.Add(1)
+	}
+	return n, err
+}
+
+// BytesRead returns the bytes read from the stream so far.
+func (c *StreamCounter) BytesRead() int64 { return c.bytesRead.Load() }
+
+// BytesWritten returns the bytes written to the stream so far.
+func (c *StreamCounter) BytesWritten() int64 { return c.bytesWritten.Load() }
+
+// Reads returns how many reads returned data.
+func (c *StreamCounter) Reads() int64 { return c.reads.Load() }
+
+// Writes returns how many writes sent data.
+func (c *StreamCounter) Writes() int64 { return c.writes.Load() }
+
+// StreamID returns the mux stream ID of the counted stream, or 0 if it is
+// not a mux stream.
+func (c *StreamCounter) StreamID() uint32 {
+	if s, ok := c.Conn.(interface{ StreamID() uint32 }); ok {
+		return s.StreamID()
+	}
+	return 0
+}
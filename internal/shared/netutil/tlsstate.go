@@ -0,0 +1,38 @@
+package netutil
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+)
+
+type tlsStateKey struct{}
+
+// ContextWithTLSState records the TLS state of conn in ctx, for use as
+// http.Server.ConnContext when connections reach the server wrapped, so
+// that net/http does not see a *tls.Conn and leaves Request.TLS nil.
+func ContextWithTLSState(ctx context.Context, conn net.Conn) context.Context {
+	for conn != nil {
+		switch c := conn.(type) {
+		case *tls.Conn:
+			state := c.ConnectionState()
+			return context.WithValue(ctx, tlsStateKey{}, &state)
+		case interface{ NetConn() net.Conn }:
+			conn = c.NetConn()
+		default:
+			return ctx
+		}
+	}
+	return ctx
+}
+
+// RequestTLSState returns the TLS state of the connection r arrived on, or
+// nil for plain HTTP.
+func RequestTLSState(r *http.Request) *tls.ConnectionState {
+	if r.TLS != nil {
+		return r.TLS
+	}
+	state, _ := r.Context().Value(tlsStateKey{}).(*tls.ConnectionState)
+	return state
+}
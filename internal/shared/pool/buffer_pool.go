@@ -1,6 +1,10 @@
 package pool
 
-import "sync"
+import (
+	"math/bits"
+	"sync"
+	"sync/atomic"
+)
 
 const (
 	SizeSmall  = 4 * 1024    // 4KB   - HTTP headers, small messages
@@ -9,53 +13,113 @@ const (
 	SizeXLarge = 1024 * 1024 // 1MB   - Large file transfers, bulk data
 )
 
+// bucketSizes lists the pooled buffer sizes in ascending order.
+var bucketSizes = [...]int{SizeSmall, SizeMedium, SizeLarge, SizeXLarge}
+
+const (
+	// retuneEvery is how many Gets pass between adaptive threshold updates.
+	retuneEvery = 4096
+	// adaptivePercentile is the share of requests the threshold must cover.
+	adaptivePercentile = 0.99
+)
+
+// BucketStats counts activity for one buffer size.
+type BucketStats struct {
+	Size   int
+	Gets   uint64
+	Misses uint64 // Gets that had to allocate a new buffer
+	Drops  uint64 // Puts discarded because the buffer was resized
+}
+
+// Hits returns the Gets served by a recycled buffer.
+func (s BucketStats) Hits() uint64 {
+	return s.Gets - s.Misses
+}
+
+// BufferPoolStats is a snapshot of BufferPool activity. Counters are
+// cumulative.
+type BufferPoolStats struct {
+	Buckets  [len(bucketSizes)]BucketStats
+	Oversize uint64 // Gets larger than the biggest bucket, never pooled
+
+	// AdaptiveThreshold is the largest payload worth taking from the pool.
+	AdaptiveThreshold int
+}
+
+type bucket struct {
+	pool   sync.Pool
+	gets   atomic.Uint64
+	misses atomic.Uint64
+	drops  atomic.Uint64
+}
+
 type BufferPool struct {
-	small  sync.Pool
-	medium sync.Pool
-	large  sync.Pool
-	xlarge sync.Pool
+	buckets [len(bucketSizes)]bucket
+
+	oversize atomic.Uint64
+
+	// sizes is a histogram of requested sizes by power-of-two class. It
+	// is halved on every retune so the threshold follows recent traffic.
+	sizes     [bits.UintSize + 1]atomic.Uint64
+	totalGets atomic.Uint64
+	threshold atomic.Int64
 }
 
 func NewBufferPool() *BufferPool {
-	return &BufferPool{
-		small: sync.Pool{
-			New: func() interface{} {
-				b := make([]byte, SizeSmall)
-				return &b
-			},
-		},
-		medium: sync.Pool{
-			New: func() interface{} {
-				b := make([]byte, SizeMedium)
-				return &b
-			},
-		},
-		large: sync.Pool{
-			New: func() interface{} {
-				b := make([]byte, SizeLarge)
-				return &b
-			},
-		},
-		xlarge: sync.Pool{
-			New: func() interface{} {
-				b := make([]byte, SizeXLarge)
-				return &b
-			},
-		},
+	p := &BufferPool{}
+	for i := range p.buckets {
+		b, size := &p.buckets[i], bucketSizes[i]
+		b.pool.New = func() interface{} {
+			b.misses.Add(1)
+			buf := make([]byte, size)
+			return &buf
+		}
 	}
+	p.threshold.Store(SizeLarge)
+	return p
 }
 
-func (p *BufferPool) Get(size int) *[]byte {
+// sizeClass returns the smallest n with size <= 1<<n.
+func sizeClass(size int) int {
+	if size <= 1 {
+		return 0
+	}
+	return bits.Len(uint(size - 1))
+}
+
+func bucketIndex(size int) int {
 	switch {
 	case size <= SizeSmall:
-		return p.small.Get().(*[]byte)
+		return 0
 	case size <= SizeMedium:
-		return p.medium.Get().(*[]byte)
+		return 1
 	case size <= SizeLarge:
-		return p.large.Get().(*[]byte)
+		return 2
 	default:
-		return p.xlarge.Get().(*[]byte)
+		return 3
+	}
+}
+
+// Get returns a buffer of at least size bytes. Sizes above SizeXLarge are
+// allocated directly.
+func (p *BufferPool) Get(size int) *[]byte {
+	if size < 0 {
+		size = 0
 	}
+	p.sizes[sizeClass(size)].Add(1)
+	if n := p.totalGets.Add(1); n%retuneEvery == 0 {
+		p.retune()
+	}
+
+	if size > SizeXLarge {
+		p.oversize.Add(1)
+		buf := make([]byte, size)
+		return &buf
+	}
+
+	b := &p.buckets[bucketIndex(size)]
+	b.gets.Add(1)
+	return b.pool.Get().(*[]byte)
 }
 
 func (p *BufferPool) Put(buf *[]byte) {
@@ -66,16 +130,83 @@ func (p *BufferPool) Put(buf *[]byte) {
 	size := cap(*buf)
 	*buf = (*buf)[:cap(*buf)]
 
-	switch size {
-	case SizeSmall:
-		p.small.Put(buf)
-	case SizeMedium:
-		p.medium.Put(buf)
-	case SizeLarge:
-		p.large.Put(buf)
-	case SizeXLarge:
-		p.xlarge.Put(buf)
+	for i, bucketSize := range bucketSizes {
+		if size == bucketSize {
+			p.buckets[i].pool.Put(buf)
+			return
+		}
+	}
+	if size > SizeXLarge {
+		// Oversize buffers are left to the GC.
+		return
+	}
+	p.buckets[bucketIndex(size)].drops.Add(1)
+}
+
+// AdaptiveThreshold returns the largest payload size callers should take
+// from the pool. It is the smallest bucket that covers 99% of recently
+// requested sizes, never below SizeMedium, so rare large payloads do not pin
+// big buffers in the pool.
+func (p *BufferPool) AdaptiveThreshold() int {
+	return int(p.threshold.Load())
+}
+
+// retune recomputes the adaptive threshold from the size histogram.
+func (p *BufferPool) retune() {
+	var counts [len(p.sizes)]uint64
+	var total uint64
+	for i := range p.sizes {
+		counts[i] = p.sizes[i].Load()
+		total += counts[i]
+		// Decay so that old traffic patterns fade out.
+		p.sizes[i].Store(counts[i] / 2)
+	}
+	if total == 0 {
+		return
+	}
+
+	want := uint64(float64(total) * adaptivePercentile)
+	var seen uint64
+	for class, c := range counts {
+		seen += c
+		if seen < want {
+			continue
+		}
+		limit := 1 << class
+		threshold := SizeXLarge
+		for _, bucketSize := range bucketSizes {
+			if bucketSize >= limit {
+				threshold = bucketSize
+				break
+			}
+		}
+		if threshold < SizeMedium {
+			threshold = SizeMedium
+		}
+		p.threshold.Store(int64(threshold))
+		return
+	}
+}
+
+// Stats returns a snapshot of the pool counters.
+func (p *BufferPool) Stats() BufferPoolStats {
+	stats := BufferPoolStats{
+		Oversize:          p.oversize.Load(),
+		AdaptiveThreshold: p.AdaptiveThreshold(),
+	}
+	for i := range p.buckets {
+		b := &p.buckets[i]
+		// Misses are counted after gets, so load them first to keep
+		// Hits from underflowing.
+		misses := b.misses.Load()
+		stats.Buckets[i] = BucketStats{
+			Size:   bucketSizes[i],
+			Gets:   b.gets.Load(),
+			Misses: misses,
+			Drops:  b.drops.Load(),
+		}
 	}
+	return stats
 }
 
 var globalBufferPool = NewBufferPool()
@@ -87,3 +218,13 @@ func GetBuffer(size int) *[]byte {
 func PutBuffer(buf *[]byte) {
 	globalBufferPool.Put(buf)
 }
+
+// GetAdaptiveThreshold returns the global pool's adaptive threshold.
+func GetAdaptiveThreshold() int {
+	return globalBufferPool.AdaptiveThreshold()
+}
+
+// GetBufferPoolStats returns the global pool's counters.
+func GetBufferPoolStats() BufferPoolStats {
+	return globalBufferPool.Stats()
+}
@@ -0,0 +1,55 @@
+package pool
+
+import "testing"
+
+func TestBufferPoolStats(t *testing.T) {
+	p := NewBufferPool()
+
+	buf := p.Get(100)
+	if len(*buf) != SizeSmall {
+		t.Fatalf("Get(100) returned %d bytes, want %d", len(*buf), SizeSmall)
+	}
+	p.Put(buf)
+
+	big := p.Get(SizeXLarge + 1)
+	if len(*big) != SizeXLarge+1 {
+		t.Errorf("Get(oversize) returned %d bytes, want %d", len(*big), SizeXLarge+1)
+	}
+	p.Put(big)
+
+	odd := make([]byte, 1000)
+	p.Put(&odd)
+
+	stats := p.Stats()
+	small := stats.Buckets[0]
+	if small.Size != SizeSmall || small.Gets != 1 || small.Misses != 1 || small.Drops != 1 {
+		t.Errorf("small bucket stats = %+v, want 1 get, 1 miss, 1 drop", small)
+	}
+	if stats.Oversize != 1 {
+		t.Errorf("Oversize = %d, want 1", stats.Oversize)
+	}
+}
+
+func TestBufferPoolAdaptiveThreshold(t *testing.T) {
+	tests := []struct {
+		name string
+		size int
+		want int
+	}{
+		{"small payloads use the medium floor", 512, SizeMedium},
+		{"exact bucket size", SizeLarge, SizeLarge},
+		{"between buckets", SizeLarge + 1, SizeXLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewBufferPool()
+			for i := 0; i < retuneEvery; i++ {
+				p.Put(p.Get(tt.size))
+			}
+			if got := p.AdaptiveThreshold(); got != tt.want {
+				t.Errorf("AdaptiveThreshold() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,8 +1,11 @@
 package pool
 
 import (
+	"fmt"
 	"runtime"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // NumCPU returns the number of logical CPUs available
@@ -10,36 +13,140 @@ func NumCPU() int {
 	return runtime.NumCPU()
 }
 
-// WorkerPool is a fixed-size goroutine pool for handling tasks
+// OverloadPolicy decides what Submit does when the queue is full and the
+// pool is already at its maximum size.
+type OverloadPolicy string
+
+const (
+	// OverloadSpawn runs the job in a new goroutine outside the pool.
+	OverloadSpawn OverloadPolicy = "spawn"
+	// OverloadBlock waits for room in the queue.
+	OverloadBlock OverloadPolicy = "block"
+	// OverloadReject refuses the job; Submit returns false.
+	OverloadReject OverloadPolicy = "reject"
+)
+
+// ParseOverloadPolicy validates a policy name. An empty name means spawn.
+func ParseOverloadPolicy(name string) (OverloadPolicy, error) {
+	switch p := OverloadPolicy(name); p {
+	case "":
+		return OverloadSpawn, nil
+	case OverloadSpawn, OverloadBlock, OverloadReject:
+		return p, nil
+	}
+	return "", fmt.Errorf("invalid overload policy %q: use spawn, block or reject", name)
+}
+
+// Config controls the size and overload behaviour of a WorkerPool.
+type Config struct {
+	MinWorkers int
+	MaxWorkers int // MaxWorkers <= MinWorkers disables autoscaling
+	QueueSize  int
+	Policy     OverloadPolicy
+
+	// ScaleUpLatency is the queue wait that triggers adding workers.
+	ScaleUpLatency time.Duration
+	// ScaleInterval is how often queue latency is checked.
+	ScaleInterval time.Duration
+	// IdleTimeout is how long a worker above MinWorkers waits for a job
+	// before exiting.
+	IdleTimeout time.Duration
+}
+
+// Stats is a snapshot of pool activity. Counters are cumulative.
+type Stats struct {
+	Workers      int
+	Busy         int
+	Queued       int
+	QueueLatency time.Duration
+
+	Submitted uint64 // jobs accepted into the queue
+	Rejected  uint64 // jobs refused by the reject policy
+	Fallback  uint64 // jobs run outside the pool by the spawn policy
+}
+
+type queuedJob struct {
+	fn       func()
+	enqueued time.Time
+}
+
+// WorkerPool runs tasks on a bounded set of goroutines that grows while
+// jobs wait in the queue and shrinks back when workers sit idle.
 type WorkerPool struct {
-	workers  int
-	jobQueue chan func()
+	cfg      Config
+	jobQueue chan queuedJob
+	done     chan struct{}
 	wg       sync.WaitGroup
 	once     sync.Once
 	closed   bool
 	mu       sync.RWMutex
+
+	workers atomic.Int32
+	busy    atomic.Int32
+
+	// latency is a moving average of queue wait in nanoseconds;
+	// lastDequeue lets the scaler notice a queue that is not moving at all.
+	latency     atomic.Int64
+	lastDequeue atomic.Int64
+
+	submitted atomic.Uint64
+	rejected  atomic.Uint64
+	fallback  atomic.Uint64
 }
 
 // NewWorkerPool creates a new worker pool with the specified number of workers
 func NewWorkerPool(workers int, queueSize int) *WorkerPool {
-	if workers <= 0 {
-		workers = 50 // Default worker count
+	return NewWorkerPoolWithConfig(Config{
+		MinWorkers: workers,
+		MaxWorkers: workers,
+		QueueSize:  queueSize,
+	})
+}
+
+// NewWorkerPoolWithConfig creates a worker pool that autoscales between
+// cfg.MinWorkers and cfg.MaxWorkers.
+func NewWorkerPoolWithConfig(cfg Config) *WorkerPool {
+	if cfg.MinWorkers <= 0 {
+		cfg.MinWorkers = 50 // Default worker count
 	}
-	if queueSize <= 0 {
-		queueSize = 1000 // Default queue size
+	if cfg.MaxWorkers < cfg.MinWorkers {
+		cfg.MaxWorkers = cfg.MinWorkers
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = 1000 // Default queue size
+	}
+	if cfg.Policy == "" {
+		cfg.Policy = OverloadSpawn
+	}
+	if cfg.ScaleUpLatency <= 0 {
+		cfg.ScaleUpLatency = 50 * time.Millisecond
+	}
+	if cfg.ScaleInterval <= 0 {
+		cfg.ScaleInterval = 100 * time.Millisecond
+	}
+	if cfg.IdleTimeout <= 0 {
+		cfg.IdleTimeout = 30 * time.Second
 	}
 
 	pool := &WorkerPool{
-		workers:  workers,
-		jobQueue: make(chan func(), queueSize),
+		cfg:      cfg,
+		jobQueue: make(chan queuedJob, cfg.QueueSize),
+		done:     make(chan struct{}),
 	}
+	pool.lastDequeue.Store(time.Now().UnixNano())
 
 	// Start worker goroutines
-	for i := 0; i < workers; i++ {
+	for i := 0; i < cfg.MinWorkers; i++ {
+		pool.workers.Add(1)
 		pool.wg.Add(1)
 		go pool.worker()
 	}
 
+	if cfg.MaxWorkers > cfg.MinWorkers {
+		pool.wg.Add(1)
+		go pool.scaleLoop()
+	}
+
 	return pool
 }
 
@@ -47,35 +154,167 @@ func NewWorkerPool(workers int, queueSize int) *WorkerPool {
 func (p *WorkerPool) worker() {
 	defer p.wg.Done()
 
-	for job := range p.jobQueue {
-		if job != nil {
-			job()
+	idle := time.NewTimer(p.cfg.IdleTimeout)
+	defer idle.Stop()
+
+	for {
+		select {
+		case job, ok := <-p.jobQueue:
+			if !ok {
+				p.workers.Add(-1)
+				return
+			}
+			p.run(job)
+			idle.Reset(p.cfg.IdleTimeout)
+		case <-idle.C:
+			if p.retire() {
+				return
+			}
+			idle.Reset(p.cfg.IdleTimeout)
+		}
+	}
+}
+
+func (p *WorkerPool) run(job queuedJob) {
+	now := time.Now()
+	p.lastDequeue.Store(now.UnixNano())
+
+	// Exponential moving average with a 1/8 weight for the new sample.
+	wait := int64(now.Sub(job.enqueued))
+	old := p.latency.Load()
+	p.latency.Store(old + (wait-old)/8)
+
+	p.busy.Add(1)
+	defer p.busy.Add(-1)
+	job.fn()
+}
+
+// retire lets an idle worker exit while the pool is above its minimum size.
+func (p *WorkerPool) retire() bool {
+	for {
+		n := p.workers.Load()
+		if int(n) <= p.cfg.MinWorkers {
+			return false
+		}
+		if p.workers.CompareAndSwap(n, n-1) {
+			return true
 		}
 	}
 }
 
-// Submit submits a job to the worker pool
-// Returns false if the pool is closed or the queue is full
+// grow starts up to n workers without exceeding MaxWorkers.
+func (p *WorkerPool) grow(n int) int {
+	started := 0
+	for started < n {
+		cur := p.workers.Load()
+		if int(cur) >= p.cfg.MaxWorkers {
+			break
+		}
+		if !p.workers.CompareAndSwap(cur, cur+1) {
+			continue
+		}
+		p.wg.Add(1)
+		go p.worker()
+		started++
+	}
+	return started
+}
+
+// scaleLoop adds workers while jobs wait longer than ScaleUpLatency.
+func (p *WorkerPool) scaleLoop() {
+	defer p.wg.Done()
+
+	ticker := time.NewTicker(p.cfg.ScaleInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-ticker.C:
+			queued := len(p.jobQueue)
+			if queued == 0 {
+				continue
+			}
+			if p.queueLatency() > p.cfg.ScaleUpLatency {
+				p.grow(queued)
+			}
+		}
+	}
+}
+
+// queueLatency is the average queue wait, or the time since the queue last
+// moved if that is longer and jobs are waiting.
+func (p *WorkerPool) queueLatency() time.Duration {
+	latency := time.Duration(p.latency.Load())
+	if len(p.jobQueue) > 0 {
+		stalled := time.Since(time.Unix(0, p.lastDequeue.Load()))
+		if stalled > latency {
+			latency = stalled
+		}
+	}
+	return latency
+}
+
+// Submit submits a job to the worker pool. It reports whether the job will
+// run: false means the pool is closed or the job was rejected by the
+// overload policy.
 func (p *WorkerPool) Submit(job func()) bool {
+	return p.SubmitUntil(job, nil)
+}
+
+// SubmitUntil is Submit whose blocking overload policy gives up when stop is
+// closed.
+func (p *WorkerPool) SubmitUntil(job func(), stop <-chan struct{}) bool {
 	if job == nil {
 		return false
 	}
 
 	p.mu.RLock()
+	defer p.mu.RUnlock()
 	if p.closed {
-		p.mu.RUnlock()
 		return false
 	}
-	p.mu.RUnlock()
 
 	// Non-blocking send
-	select {
-	case p.jobQueue <- job:
+	if p.tryEnqueue(job) {
 		return true
+	}
+
+	// Queue is full: add a worker right away rather than waiting for the
+	// scaler, then try once more.
+	if p.grow(1) > 0 && p.tryEnqueue(job) {
+		return true
+	}
+
+	switch p.cfg.Policy {
+	case OverloadBlock:
+		select {
+		case p.jobQueue <- queuedJob{fn: job, enqueued: time.Now()}:
+			p.submitted.Add(1)
+			return true
+		case <-p.done:
+		case <-stop:
+		}
+		p.rejected.Add(1)
+		return false
+	case OverloadReject:
+		p.rejected.Add(1)
+		return false
 	default:
-		// Queue is full, fall back to direct execution
-		// This prevents blocking when pool is overloaded
+		// Run outside the pool so accept loops never stall.
+		p.fallback.Add(1)
 		go job()
+		return true
+	}
+}
+
+func (p *WorkerPool) tryEnqueue(job func()) bool {
+	select {
+	case p.jobQueue <- queuedJob{fn: job, enqueued: time.Now()}:
+		p.submitted.Add(1)
+		return true
+	default:
 		return false
 	}
 }
@@ -95,15 +334,36 @@ func (p *WorkerPool) SubmitWait(job func()) {
 	if p.Submit(wrappedJob) {
 		<-done
 	} else {
-		// Pool is closed or full, execute directly
+		// Pool is closed or the job was rejected, execute directly
 		job()
 	}
 }
 
+// Policy returns the overload policy in effect.
+func (p *WorkerPool) Policy() OverloadPolicy {
+	return p.cfg.Policy
+}
+
+// Stats returns a snapshot of the pool's size and counters.
+func (p *WorkerPool) Stats() Stats {
+	return Stats{
+		Workers:      int(p.workers.Load()),
+		Busy:         int(p.busy.Load()),
+		Queued:       len(p.jobQueue),
+		QueueLatency: p.queueLatency(),
+		Submitted:    p.submitted.Load(),
+		Rejected:     p.rejected.Load(),
+		Fallback:     p.fallback.Load(),
+	}
+}
+
 // Close gracefully shuts down the worker pool
 // It waits for all pending jobs to complete
 func (p *WorkerPool) Close() {
 	p.once.Do(func() {
+		// Wake blocked submitters first: they hold the read lock.
+		close(p.done)
+
 		p.mu.Lock()
 		p.closed = true
 		p.mu.Unlock()
@@ -0,0 +1,131 @@
+package pool
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWorkerPoolOverloadPolicies(t *testing.T) {
+	tests := []struct {
+		policy       OverloadPolicy
+		wantAccepted bool
+		wantRejected uint64
+		wantFallback uint64
+	}{
+		{OverloadSpawn, true, 0, 1},
+		{OverloadReject, false, 1, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			p := NewWorkerPoolWithConfig(Config{
+				MinWorkers: 1,
+				MaxWorkers: 1,
+				QueueSize:  1,
+				Policy:     tt.policy,
+			})
+
+			release := make(chan struct{})
+			var wg sync.WaitGroup
+			block := func() {
+				defer wg.Done()
+				<-release
+			}
+
+			// One job occupies the worker, the next fills the queue.
+			wg.Add(2)
+			p.Submit(block)
+			for p.Stats().Busy != 1 {
+				time.Sleep(time.Millisecond)
+			}
+			p.Submit(block)
+
+			ran := make(chan struct{})
+			accepted := p.Submit(func() { close(ran) })
+			if accepted != tt.wantAccepted {
+				t.Errorf("Submit() = %v, want %v", accepted, tt.wantAccepted)
+			}
+
+			stats := p.Stats()
+			if stats.Rejected != tt.wantRejected || stats.Fallback != tt.wantFallback {
+				t.Errorf("rejected=%d fallback=%d, want %d and %d",
+					stats.Rejected, stats.Fallback, tt.wantRejected, tt.wantFallback)
+			}
+
+			close(release)
+			if accepted {
+				<-ran
+			}
+			wg.Wait()
+			p.Close()
+		})
+	}
+}
+
+func TestWorkerPoolBlockPolicyStops(t *testing.T) {
+	p := NewWorkerPoolWithConfig(Config{
+		MinWorkers: 1,
+		MaxWorkers: 1,
+		QueueSize:  1,
+		Policy:     OverloadBlock,
+	})
+
+	release := make(chan struct{})
+	p.Submit(func() { <-release })
+	for p.Stats().Busy != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	p.Submit(func() {})
+
+	stop := make(chan struct{})
+	result := make(chan bool)
+	go func() { result <- p.SubmitUntil(func() {}, stop) }()
+
+	select {
+	case <-result:
+		t.Fatal("SubmitUntil() returned while the pool was saturated")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(stop)
+	if <-result {
+		t.Error("SubmitUntil() = true after stop was closed, want false")
+	}
+
+	close(release)
+	p.Close()
+}
+
+func TestWorkerPoolAutoscale(t *testing.T) {
+	p := NewWorkerPoolWithConfig(Config{
+		MinWorkers:     1,
+		MaxWorkers:     4,
+		QueueSize:      16,
+		ScaleUpLatency: time.Millisecond,
+		ScaleInterval:  5 * time.Millisecond,
+		IdleTimeout:    20 * time.Millisecond,
+	})
+	defer p.Close()
+
+	release := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		p.Submit(func() { <-release })
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for p.Stats().Busy != 4 {
+		if time.Now().After(deadline) {
+			t.Fatalf("pool did not grow: %+v", p.Stats())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	close(release)
+	for p.Stats().Workers != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("pool did not shrink back to its minimum: %+v", p.Stats())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
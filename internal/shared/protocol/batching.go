@@ -0,0 +1,98 @@
+package protocol
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// tunerAlpha weighs new write latency samples in the tuner's moving
+// average.
+const tunerAlpha = 0.2
+
+// batchTuner picks a FrameWriter's batch size and wait from the latency
+// of its writes and the depth of its queue. At low load every frame is
+// written as soon as it is queued, since waiting for company would only
+// add latency. Once frames queue up faster than they are written, batches
+// double and the writer waits up to about one write's latency for them to
+// fill, which costs little while the connection is the bottleneck anyway.
+// Both stay within the writer's maxBatch and maxBatchWait.
+type batchTuner struct {
+	maxBatch int
+	maxWait  time.Duration
+
+	batch   int
+	wait    time.Duration
+	latency time.Duration // moving average of write latency
+}
+
+func newBatchTuner(maxBatch int, maxWait time.Duration) *batchTuner {
+	t := &batchTuner{maxBatch: max(maxBatch, 1), maxWait: maxWait, batch: 1}
+	tunedWriters.Add(1)
+	tunedBatchSum.Add(1)
+	return t
+}
+
+// observe adjusts the parameters after frames were written in one write
+// that took latency, with queued frames still waiting behind them.
+func (t *batchTuner) observe(frames int, latency time.Duration, queued int) {
+	batch, wait, avg := t.batch, t.wait, t.latency
+
+	if t.latency == 0 {
+		t.latency = latency
+	} else {
+		t.latency += time.Duration(tunerAlpha * float64(latency-t.latency))
+	}
+
+	switch {
+	case queued >= t.batch:
+		t.batch = min(t.batch*2, t.maxBatch)
+		t.wait = min(t.latency, t.maxWait)
+	case queued == 0 && frames <= t.batch/2:
+		t.batch = max(t.batch/2, 1)
+		if t.wait /= 2; t.wait < time.Microsecond {
+			t.wait = 0
+		}
+	}
+
+	tunedBatchSum.Add(int64(t.batch - batch))
+	tunedWaitSum.Add(int64(t.wait - wait))
+	tunedLatencySum.Add(int64(t.latency - avg))
+}
+
+// close removes the tuner from BatchStats.
+func (t *batchTuner) close() {
+	tunedWriters.Add(-1)
+	tunedBatchSum.Add(-int64(t.batch))
+	tunedWaitSum.Add(-int64(t.wait))
+	tunedLatencySum.Add(-int64(t.latency))
+}
+
+var (
+	tunedWriters    atomic.Int64
+	tunedBatchSum   atomic.Int64
+	tunedWaitSum    atomic.Int64
+	tunedLatencySum atomic.Int64
+)
+
+// BatchStats describes the batching chosen by the FrameWriters that tune
+// it, averaged over them.
+type BatchStats struct {
+	Writers      int64
+	BatchSize    float64
+	BatchWait    time.Duration
+	WriteLatency time.Duration
+}
+
+// GetBatchStats returns the current batching of tuned FrameWriters.
+func GetBatchStats() BatchStats {
+	n := tunedWriters.Load()
+	if n <= 0 {
+		return BatchStats{}
+	}
+	return BatchStats{
+		Writers:      n,
+		BatchSize:    float64(tunedBatchSum.Load()) / float64(n),
+		BatchWait:    time.Duration(tunedWaitSum.Load() / n),
+		WriteLatency: time.Duration(tunedLatencySum.Load() / n),
+	}
+}
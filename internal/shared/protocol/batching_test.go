@@ -0,0 +1,85 @@
+package protocol
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBatchTuner(t *testing.T) {
+	tuner := newBatchTuner(8, 2*time.Millisecond)
+	defer tuner.close()
+
+	steps := []struct {
+		name      string
+		frames    int
+		latency   time.Duration
+		queued    int
+		wantBatch int
+		wantWait  time.Duration
+	}{
+		{"idle stays immediate", 1, time.Millisecond, 0, 1, 0},
+		{"backlog grows batch", 1, time.Millisecond, 4, 2, time.Millisecond},
+		{"growth is capped", 2, time.Millisecond, 100, 4, time.Millisecond},
+		{"capped at max batch", 4, time.Millisecond, 100, 8, time.Millisecond},
+		{"wait capped at max wait", 8, 10 * time.Millisecond, 100, 8, 2 * time.Millisecond},
+		{"full batches hold", 8, time.Millisecond, 3, 8, 2 * time.Millisecond},
+		{"light load shrinks", 1, time.Millisecond, 0, 4, time.Millisecond},
+	}
+
+	for _, s := range steps {
+		tuner.observe(s.frames, s.latency, s.queued)
+		if tuner.batch != s.wantBatch || tuner.wait != s.wantWait {
+			t.Errorf("%s: batch %d wait %v, want %d and %v", s.name, tuner.batch, tuner.wait, s.wantBatch, s.wantWait)
+		}
+	}
+
+	if stats := GetBatchStats(); stats.Writers != 1 || stats.BatchSize != 4 {
+		t.Errorf("GetBatchStats() = %+v, want 1 writer with batch 4", stats)
+	}
+}
+
+func TestFrameWriterBatchesInOrder(t *testing.T) {
+	var buf safeBuffer
+	w := NewFrameWriter(&buf)
+	for i := range 100 {
+		if err := w.WriteFrame(NewFrame(FrameTypeHeartbeat, []byte{byte(i)})); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for deadline := time.Now().Add(5 * time.Second); w.QueuedFrames() > 0 && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	w.Close()
+
+	fr := NewFrameReader(bytes.NewReader(buf.Bytes()))
+	for i := range 100 {
+		frame, err := fr.ReadFrame()
+		if err != nil {
+			t.Fatalf("frame %d: %v", i, err)
+		}
+		if len(frame.Payload) != 1 || frame.Payload[0] != byte(i) {
+			t.Errorf("frame %d payload = %v", i, frame.Payload)
+		}
+		frame.Release()
+	}
+}
+
+// safeBuffer is a bytes.Buffer the writer goroutine and the test can share.
+type safeBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *safeBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *safeBuffer) Bytes() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Bytes()
+}
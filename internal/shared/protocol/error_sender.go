@@ -4,7 +4,8 @@ import (
 	"fmt"
 	"net"
 
-	json "github.com/goccy/go-json"
+	"drip/internal/shared/constants"
+
 	"go.uber.org/zap"
 )
 
@@ -24,21 +25,14 @@ func NewErrorSender(conn net.Conn, frameWriter *FrameWriter, logger *zap.Logger)
 	}
 }
 
-// SendError sends an error frame with the given code and message.
-func (e *ErrorSender) SendError(code, message string) error {
-	errMsg := ErrorMessage{
-		Code:    code,
-		Message: message,
-	}
-
-	data, err := json.Marshal(errMsg)
-	if err != nil {
-		e.logger.Error("Failed to marshal error message", zap.Error(err))
-		return fmt.Errorf("failed to marshal error: %w", err)
+// Send sends err as an error frame, with its code if it is an *Error.
+func (e *ErrorSender) Send(err error) error {
+	errFrame, ferr := EncodeError(err)
+	if ferr != nil {
+		e.logger.Error("Failed to marshal error message", zap.Error(ferr))
+		return ferr
 	}
 
-	errFrame := NewFrame(FrameTypeError, data)
-
 	if e.frameWriter == nil {
 		return WriteFrame(e.conn, errFrame)
 	}
@@ -46,23 +40,28 @@ func (e *ErrorSender) SendError(code, message string) error {
 	return e.frameWriter.WriteFrame(errFrame)
 }
 
+// SendError sends an error frame with the given code and message.
+func (e *ErrorSender) SendError(code, message string) error {
+	return e.Send(NewError(code, message))
+}
+
 // SendAuthenticationError sends an authentication failed error.
 func (e *ErrorSender) SendAuthenticationError() error {
-	return e.SendError("authentication_failed", "Invalid authentication token")
+	return e.SendError(constants.ErrCodeAuthFailed, "Invalid authentication token")
 }
 
 // SendRegistrationError sends a registration failed error.
 func (e *ErrorSender) SendRegistrationError(message string) error {
-	return e.SendError("registration_failed", message)
+	return e.SendError(constants.ErrCodeRegistrationFailed, message)
 }
 
 // SendPortAllocationError sends a port allocation failed error.
 func (e *ErrorSender) SendPortAllocationError(message string) error {
-	return e.SendError("port_allocation_failed", message)
+	return e.SendError(constants.ErrCodePortAllocationFailed, message)
 }
 
 // SendTunnelTypeNotAllowedError sends a tunnel type not allowed error.
 func (e *ErrorSender) SendTunnelTypeNotAllowedError(tunnelType string) error {
-	return e.SendError("tunnel_type_not_allowed",
+	return e.SendError(constants.ErrCodeTunnelTypeNotAllowed,
 		fmt.Sprintf("Tunnel type '%s' is not allowed on this server", tunnelType))
 }
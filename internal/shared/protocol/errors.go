@@ -0,0 +1,102 @@
+package protocol
+
+import (
+	"errors"
+	"fmt"
+
+	"drip/internal/shared/constants"
+
+	json "github.com/goccy/go-json"
+)
+
+// ErrFrameTooLarge is returned for frames over the reader's size limit.
+var ErrFrameTooLarge = errors.New("payload too large")
+
+// Error is an error with a code from constants.ErrCode*. It is what error
+// frames carry on the wire, in both directions.
+type Error struct {
+	ErrorMessage
+
+	cause error
+}
+
+// NewError returns an error with the given code and message.
+func NewError(code, message string) *Error {
+	return &Error{ErrorMessage: ErrorMessage{Code: code, Message: message}}
+}
+
+// Errorf is like NewError but formats the message, keeping an error
+// wrapped with %w available to errors.Is and errors.As. Only the message is
+// sent to the peer.
+func Errorf(code, format string, args ...any) *Error {
+	err := fmt.Errorf(format, args...)
+	return &Error{ErrorMessage: ErrorMessage{Code: code, Message: err.Error()}, cause: errors.Unwrap(err)}
+}
+
+func (e *Error) Error() string {
+	return e.Code + " - " + e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.cause
+}
+
+// Is reports whether target is an *Error with the same code, so
+// errors.Is(err, protocol.NewError(code, "")) matches any error with code.
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code
+}
+
+// ErrorCode returns the code of the first *Error in err's chain, or "".
+func ErrorCode(err error) string {
+	var perr *Error
+	if errors.As(err, &perr) {
+		return perr.Code
+	}
+	return ""
+}
+
+// legacyCodes maps the codes sent by servers before the constants.ErrCode*
+// set was introduced.
+var legacyCodes = map[string]string{
+	"authentication_failed":     constants.ErrCodeAuthFailed,
+	"registration_failed":       constants.ErrCodeRegistrationFailed,
+	"registration_denied":       constants.ErrCodeRegistrationDenied,
+	"port_allocation_failed":    constants.ErrCodePortAllocationFailed,
+	"tunnel_type_not_allowed":   constants.ErrCodeTunnelTypeNotAllowed,
+	"invalid_ttl":               constants.ErrCodeInvalidTTL,
+	"invalid_request":           constants.ErrCodeInvalidRequest,
+	"join_failed":               constants.ErrCodeTunnelNotFound,
+	"not_supported":             constants.ErrCodeUnsupported,
+	"unsupported_control_frame": constants.ErrCodeUnsupported,
+	"p2p_unsupported":           constants.ErrCodeUnsupported,
+	"p2p_disabled":              constants.ErrCodeP2PDisabled,
+	"no_ttl":                    constants.ErrCodeNoTTL,
+}
+
+// DecodeError parses the payload of an error frame.
+func DecodeError(payload []byte) *Error {
+	var msg ErrorMessage
+	if err := json.Unmarshal(payload, &msg); err != nil {
+		return Errorf(constants.ErrCodeInvalidRequest, "malformed error frame: %w", err)
+	}
+	if code, ok := legacyCodes[msg.Code]; ok {
+		msg.Code = code
+	}
+	return &Error{ErrorMessage: msg}
+}
+
+// EncodeError returns an error frame for err. Errors without a code are
+// sent as constants.ErrCodeConnectionFailed.
+func EncodeError(err error) (*Frame, error) {
+	var perr *Error
+	if !errors.As(err, &perr) {
+		perr = NewError(constants.ErrCodeConnectionFailed, err.Error())
+	}
+	data, merr := json.Marshal(perr.ErrorMessage)
+	if merr != nil {
+		return nil, fmt.Errorf("failed to marshal error: %w", merr)
+	}
+	return NewFrame(FrameTypeError, data), nil
+}
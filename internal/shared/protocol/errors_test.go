@@ -0,0 +1,50 @@
+package protocol
+
+import (
+	"errors"
+	"io"
+	"testing"
+
+	"drip/internal/shared/constants"
+)
+
+func TestErrorRoundTrip(t *testing.T) {
+	sent := Errorf(constants.ErrCodeInvalidRequest, "failed to read registration frame: %w", io.EOF)
+	if !errors.Is(sent, io.EOF) {
+		t.Error("Errorf() lost the wrapped error")
+	}
+	if !errors.Is(sent, NewError(constants.ErrCodeInvalidRequest, "")) {
+		t.Error("errors.Is() did not match by code")
+	}
+
+	frame, err := EncodeError(sent)
+	if err != nil {
+		t.Fatalf("EncodeError() error = %v", err)
+	}
+	got := DecodeError(frame.Payload)
+	if got.Code != sent.Code || got.Message != sent.Message {
+		t.Errorf("DecodeError() = %v, want %v", got, sent)
+	}
+
+	frame, _ = EncodeError(errors.New("boom"))
+	if code := DecodeError(frame.Payload).Code; code != constants.ErrCodeConnectionFailed {
+		t.Errorf("uncoded error sent as %q, want %q", code, constants.ErrCodeConnectionFailed)
+	}
+}
+
+func TestDecodeErrorLegacyCodes(t *testing.T) {
+	tests := []struct {
+		payload string
+		want    string
+	}{
+		{`{"code":"authentication_failed","message":"Invalid authentication token"}`, constants.ErrCodeAuthFailed},
+		{`{"code":"join_failed","message":"Tunnel not found"}`, constants.ErrCodeTunnelNotFound},
+		{`{"code":"SUBDOMAIN_TAKEN","message":"taken"}`, constants.ErrCodeSubdomainTaken},
+		{`not json`, constants.ErrCodeInvalidRequest},
+	}
+	for _, tt := range tests {
+		if got := DecodeError([]byte(tt.payload)).Code; got != tt.want {
+			t.Errorf("DecodeError(%s).Code = %q, want %q", tt.payload, got, tt.want)
+		}
+	}
+}
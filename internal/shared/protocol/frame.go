@@ -14,20 +14,35 @@ const (
 	// MaxFrameSize limits payload size to prevent memory exhaustion attacks.
 	// 1MB is sufficient for most HTTP requests/responses while limiting DoS impact.
 	MaxFrameSize = 1 * 1024 * 1024 // 1MB (reduced from 10MB)
+	// MaxControlFrameSize limits frames read before authentication and on
+	// control streams, which only ever carry small JSON messages.
+	MaxControlFrameSize = 64 * 1024
 )
 
 // FrameType defines the type of frame
 type FrameType byte
 
 const (
-	FrameTypeRegister       FrameType = 0x01
-	FrameTypeRegisterAck    FrameType = 0x02
-	FrameTypeHeartbeat      FrameType = 0x03
-	FrameTypeHeartbeatAck   FrameType = 0x04
-	FrameTypeClose          FrameType = 0x05
-	FrameTypeError          FrameType = 0x06
-	FrameTypeDataConnect    FrameType = 0x07
-	FrameTypeDataConnectAck FrameType = 0x08
+	FrameTypeRegister         FrameType = 0x01
+	FrameTypeRegisterAck      FrameType = 0x02
+	FrameTypeHeartbeat        FrameType = 0x03
+	FrameTypeHeartbeatAck     FrameType = 0x04
+	FrameTypeClose            FrameType = 0x05
+	FrameTypeError            FrameType = 0x06
+	FrameTypeDataConnect      FrameType = 0x07
+	FrameTypeDataConnectAck   FrameType = 0x08
+	FrameTypeRulesUpdate      FrameType = 0x09
+	FrameTypeRulesUpdateAck   FrameType = 0x0A
+	FrameTypeP2PWatch         FrameType = 0x0B
+	FrameTypeP2POffer         FrameType = 0x0C
+	FrameTypeExpiryWatch      FrameType = 0x0D
+	FrameTypeExpiryNotice     FrameType = 0x0E
+	FrameTypeDrain            FrameType = 0x0F
+	FrameTypeDrainAck         FrameType = 0x10
+	FrameTypePause            FrameType = 0x11
+	FrameTypePauseAck         FrameType = 0x12
+	FrameTypeStreamStatsWatch FrameType = 0x13
+	FrameTypeStreamStats      FrameType = 0x14
 )
 
 // String returns the string representation of frame type
@@ -49,6 +64,30 @@ func (t FrameType) String() string {
 		return "DataConnect"
 	case FrameTypeDataConnectAck:
 		return "DataConnectAck"
+	case FrameTypeRulesUpdate:
+		return "RulesUpdate"
+	case FrameTypeRulesUpdateAck:
+		return "RulesUpdateAck"
+	case FrameTypeP2PWatch:
+		return "P2PWatch"
+	case FrameTypeP2POffer:
+		return "P2POffer"
+	case FrameTypeExpiryWatch:
+		return "ExpiryWatch"
+	case FrameTypeExpiryNotice:
+		return "ExpiryNotice"
+	case FrameTypeDrain:
+		return "Drain"
+	case FrameTypeDrainAck:
+		return "DrainAck"
+	case FrameTypePause:
+		return "Pause"
+	case FrameTypePauseAck:
+		return "PauseAck"
+	case FrameTypeStreamStatsWatch:
+		return "StreamStatsWatch"
+	case FrameTypeStreamStats:
+		return "StreamStats"
 	default:
 		return fmt.Sprintf("Unknown(%d)", t)
 	}
@@ -66,7 +105,7 @@ type Frame struct {
 func WriteFrame(w io.Writer, frame *Frame) error {
 	payloadLen := len(frame.Payload)
 	if payloadLen > MaxFrameSize {
-		return fmt.Errorf("payload too large: %d bytes (max %d)", payloadLen, MaxFrameSize)
+		return fmt.Errorf("%w: %d bytes (max %d)", ErrFrameTooLarge, payloadLen, MaxFrameSize)
 	}
 
 	var header [FrameHeaderSize]byte
@@ -89,7 +128,47 @@ func WriteFrame(w io.Writer, frame *Frame) error {
 	return nil
 }
 
+// writeFrames writes frames with a single write where w supports it, as
+// WriteFrame does for one frame.
+func writeFrames(w io.Writer, frames []*Frame) error {
+	if len(frames) == 1 {
+		return WriteFrame(w, frames[0])
+	}
+
+	headers := make([]byte, FrameHeaderSize*len(frames))
+	bufs := make(net.Buffers, 0, 2*len(frames))
+	for i, frame := range frames {
+		payloadLen := len(frame.Payload)
+		if payloadLen > MaxFrameSize {
+			return fmt.Errorf("%w: %d bytes (max %d)", ErrFrameTooLarge, payloadLen, MaxFrameSize)
+		}
+		header := headers[i*FrameHeaderSize : (i+1)*FrameHeaderSize]
+		binary.BigEndian.PutUint32(header[0:4], uint32(payloadLen))
+		header[4] = byte(frame.Type)
+		bufs = append(bufs, header)
+		if payloadLen > 0 {
+			bufs = append(bufs, frame.Payload)
+		}
+	}
+
+	if _, err := bufs.WriteTo(w); err != nil {
+		return fmt.Errorf("failed to write frames: %w", err)
+	}
+	return nil
+}
+
 func ReadFrame(r io.Reader) (*Frame, error) {
+	return ReadFrameLimit(r, MaxFrameSize)
+}
+
+// ReadFrameLimit reads a frame whose payload may not exceed maxPayload
+// bytes. The length is checked before anything is allocated, so a peer
+// cannot make the reader reserve memory it never sends.
+func ReadFrameLimit(r io.Reader, maxPayload int) (*Frame, error) {
+	if maxPayload > MaxFrameSize {
+		maxPayload = MaxFrameSize
+	}
+
 	// Use stack-allocated array to avoid heap allocation
 	var header [FrameHeaderSize]byte
 	if _, err := io.ReadFull(r, header[:]); err != nil {
@@ -97,8 +176,8 @@ func ReadFrame(r io.Reader) (*Frame, error) {
 	}
 
 	payloadLen := binary.BigEndian.Uint32(header[0:4])
-	if payloadLen > MaxFrameSize {
-		return nil, fmt.Errorf("payload too large: %d bytes (max %d)", payloadLen, MaxFrameSize)
+	if int64(payloadLen) > int64(maxPayload) {
+		return nil, fmt.Errorf("%w: %d bytes (max %d)", ErrFrameTooLarge, payloadLen, maxPayload)
 	}
 
 	frameType := FrameType(header[4])
@@ -107,7 +186,7 @@ func ReadFrame(r io.Reader) (*Frame, error) {
 	var poolBuf *[]byte
 
 	if payloadLen > 0 {
-		if payloadLen > pool.SizeLarge {
+		if int(payloadLen) > pool.GetAdaptiveThreshold() {
 			payload = make([]byte, payloadLen)
 			if _, err := io.ReadFull(r, payload); err != nil {
 				return nil, fmt.Errorf("failed to read payload: %w", err)
@@ -0,0 +1,75 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func TestReadFrameLimit(t *testing.T) {
+	tests := []struct {
+		name       string
+		payloadLen uint32
+		limit      int
+		wantErr    bool
+	}{
+		{"within limit", 16, 64, false},
+		{"at limit", 64, 64, false},
+		{"over limit", 65, 64, true},
+		{"limit capped at MaxFrameSize", MaxFrameSize + 1, MaxFrameSize * 2, true},
+		{"negative limit", 1, -1, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Only the header is sent: an oversized length must be refused
+			// before the payload is read.
+			var header [FrameHeaderSize]byte
+			binary.BigEndian.PutUint32(header[0:4], tt.payloadLen)
+			header[4] = byte(FrameTypeRegister)
+			data := append(header[:], make([]byte, min(int(tt.payloadLen), 64))...)
+
+			frame, err := ReadFrameLimit(bytes.NewReader(data), tt.limit)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ReadFrameLimit() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if frame != nil {
+				frame.Release()
+			}
+		})
+	}
+}
+
+func FuzzReadFrame(f *testing.F) {
+	var buf bytes.Buffer
+	_ = WriteFrame(&buf, NewFrame(FrameTypeRegister, []byte(`{"token":"t"}`)))
+	f.Add(buf.Bytes())
+	f.Add([]byte{0xff, 0xff, 0xff, 0xff, byte(FrameTypeRegister)})
+	f.Add([]byte{0, 0, 0, 0, byte(FrameTypeHeartbeat)})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		frame, err := ReadFrameLimit(bytes.NewReader(data), MaxControlFrameSize)
+		if err != nil {
+			return
+		}
+		defer frame.Release()
+
+		if len(frame.Payload) > MaxControlFrameSize {
+			t.Fatalf("payload of %d bytes exceeds the limit", len(frame.Payload))
+		}
+
+		var out bytes.Buffer
+		if err := WriteFrame(&out, frame); err != nil {
+			t.Fatalf("WriteFrame() = %v", err)
+		}
+		if !bytes.Equal(out.Bytes(), data[:out.Len()]) {
+			t.Fatalf("frame did not round-trip")
+		}
+
+		// Control payloads are decoded straight into these messages.
+		var reg RegisterRequest
+		_ = UnmarshalJSON(frame.Payload, &reg)
+		var rules RulesUpdateRequest
+		_ = UnmarshalJSON(frame.Payload, &rules)
+	})
+}
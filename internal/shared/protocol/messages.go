@@ -1,15 +1,34 @@
 package protocol
 
-import json "github.com/goccy/go-json"
+import (
+	"time"
+
+	json "github.com/goccy/go-json"
+)
 
 type PoolCapabilities struct {
 	MaxDataConns int `json:"max_data_conns"`
 	Version      int `json:"version"`
+
+	// StreamCompression lists body encodings the client can apply to
+	// streaming responses, in order of preference.
+	StreamCompression []string `json:"stream_compression,omitempty"`
+
+	// PowerSave asks the server not to ping the tunnel's sessions while
+	// it carries no streams, leaving dead connections to TCP keepalive,
+	// see CapabilityPowerSave.
+	PowerSave bool `json:"power_save,omitempty"`
 }
 
 type IPAccessControl struct {
 	AllowIPs []string `json:"allow_ips,omitempty"`
 	DenyIPs  []string `json:"deny_ips,omitempty"`
+
+	// AllowCountries and DenyCountries are ISO 3166-1 alpha-2 codes matched
+	// against the visitor's country. They need a GeoIP database on the
+	// server.
+	AllowCountries []string `json:"allow_countries,omitempty"`
+	DenyCountries  []string `json:"deny_countries,omitempty"`
 }
 
 type ProxyAuth struct {
@@ -19,6 +38,37 @@ type ProxyAuth struct {
 	Token    string `json:"token,omitempty"`
 }
 
+// RequestRule is a single edge filtering rule for HTTP tunnels. All set
+// matchers must match for the rule to apply.
+type RequestRule struct {
+	Action    string   `json:"action"`               // "allow" or "deny"
+	Methods   []string `json:"methods,omitempty"`    // HTTP methods, case-insensitive
+	Path      string   `json:"path,omitempty"`       // Path prefix, or glob when it contains '*'
+	UserAgent string   `json:"user_agent,omitempty"` // Regular expression matched against User-Agent
+}
+
+// VisitorRateLimit configures per-visitor-IP token bucket limiting.
+type VisitorRateLimit struct {
+	RPS   float64 `json:"rps"`
+	Burst int     `json:"burst,omitempty"`
+}
+
+// EdgeTLSPolicy sets how the server's public listener treats visitors of
+// an HTTP tunnel. The TLS requirements only hold on servers that terminate
+// TLS themselves.
+type EdgeTLSPolicy struct {
+	// HSTSMaxAge adds Strict-Transport-Security with this max-age, in
+	// seconds, to every response when set.
+	HSTSMaxAge int64 `json:"hsts_max_age,omitempty"`
+
+	// TLS13Only refuses visitors that cannot negotiate TLS 1.3.
+	TLS13Only bool `json:"tls13_only,omitempty"`
+
+	// ClientCA is a PEM bundle of CA certificates; when set, visitors must
+	// present a certificate issued by one of them.
+	ClientCA string `json:"client_ca,omitempty"`
+}
+
 type RegisterRequest struct {
 	Token            string            `json:"token"`
 	CustomSubdomain  string            `json:"custom_subdomain"`
@@ -30,6 +80,62 @@ type RegisterRequest struct {
 	IPAccess         *IPAccessControl  `json:"ip_access,omitempty"`
 	ProxyAuth        *ProxyAuth        `json:"proxy_auth,omitempty"`
 	Bandwidth        int64             `json:"bandwidth,omitempty"`
+	ProxyProtocol    bool              `json:"proxy_protocol,omitempty"`
+	RequestRules     []RequestRule     `json:"request_rules,omitempty"`
+	VisitorRateLimit *VisitorRateLimit `json:"visitor_rate_limit,omitempty"`
+	EdgeTLS          *EdgeTLSPolicy    `json:"edge_tls,omitempty"`
+
+	// SigningSecret has the server sign the body of every request it
+	// forwards with HMAC-SHA256, so the local app can check that requests
+	// came through the tunnel (http/https only).
+	SigningSecret string `json:"signing_secret,omitempty"`
+
+	// RequestStore asks the server to keep the last RequestStore requests
+	// to the tunnel, including those arriving while it reconnects, for
+	// 'drip replay' (http/https only).
+	RequestStore int `json:"request_store,omitempty"`
+
+	// MaxRequestBody bounds the body of each request the server forwards
+	// to the tunnel, in bytes; larger ones get a 413 at the edge. It cannot
+	// raise the server's own limit (http/https only).
+	MaxRequestBody int64 `json:"max_request_body,omitempty"`
+
+	// SubdomainStyle asks for a generated subdomain of this style when
+	// CustomSubdomain is empty: hex, words or prefix, the latter built from
+	// SubdomainPrefix. Empty uses the server default.
+	SubdomainStyle  string `json:"subdomain_style,omitempty"`
+	SubdomainPrefix string `json:"subdomain_prefix,omitempty"`
+
+	// Labels are key=value metadata such as team=payments, shown and
+	// filtered on in the server's stats; see package labels.
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// Private keeps a TCP tunnel off the public ports: no port is
+	// allocated and consumers reach it only with 'drip connect <name>',
+	// authenticated with the server token.
+	Private bool `json:"private,omitempty"`
+
+	// TTL asks the server to tear the tunnel down this many seconds after
+	// registration. Zero keeps it up until the client disconnects.
+	TTL int64 `json:"ttl,omitempty"`
+
+	// Schedule limits the times the tunnel accepts visitors, e.g.
+	// "Mon-Fri 09:00-18:00 Europe/Berlin"; see package schedule. Outside
+	// it the tunnel stays registered, but HTTP visitors get an offline
+	// page and TCP connections are refused.
+	Schedule string `json:"schedule,omitempty"`
+
+	// ResumeToken is the RegisterResponse.ResumeToken of the tunnel the
+	// client is reconnecting. If that tunnel is still registered at
+	// CustomSubdomain, for example because the server has not yet noticed
+	// the old connection drop, the server closes it and hands its
+	// subdomain and port to this registration.
+	ResumeToken string `json:"resume_token,omitempty"`
+
+	// ClientVersion is the release of the client, checked against the
+	// server's minimum; clients that predate it send neither field.
+	ClientVersion   string `json:"client_version,omitempty"`
+	ProtocolVersion int    `json:"protocol_version,omitempty"`
 }
 
 type RegisterResponse struct {
@@ -41,6 +147,25 @@ type RegisterResponse struct {
 	SupportsDataConn bool   `json:"supports_data_conn,omitempty"`
 	RecommendedConns int    `json:"recommended_conns,omitempty"`
 	Bandwidth        int64  `json:"bandwidth,omitempty"`
+
+	// StreamCompression is the encoding the server accepted from
+	// PoolCapabilities.StreamCompression, empty if none.
+	StreamCompression string `json:"stream_compression,omitempty"`
+
+	// ExpiresAt is the Unix time at which the server closes the tunnel,
+	// set only when RegisterRequest.TTL was.
+	ExpiresAt int64 `json:"expires_at,omitempty"`
+
+	// ResumeToken lets the client take this tunnel over when it
+	// reconnects; see RegisterRequest.ResumeToken. Older servers leave it
+	// empty.
+	ResumeToken string `json:"resume_token,omitempty"`
+
+	// ServerVersion, ProtocolVersion and Capabilities describe the server;
+	// older servers leave them empty.
+	ServerVersion   string   `json:"server_version,omitempty"`
+	ProtocolVersion int      `json:"protocol_version,omitempty"`
+	Capabilities    []string `json:"capabilities,omitempty"`
 }
 
 type DataConnectRequest struct {
@@ -55,9 +180,167 @@ type DataConnectResponse struct {
 	Message      string `json:"message,omitempty"`
 }
 
+// RulesUpdateRequest replaces the request filtering rules of a running tunnel.
+type RulesUpdateRequest struct {
+	Rules []RequestRule `json:"rules"`
+}
+
+type RulesUpdateResponse struct {
+	Accepted bool   `json:"accepted"`
+	Message  string `json:"message,omitempty"`
+}
+
+// DrainRequest asks the server to stop opening new streams on some of the
+// tunnel's connections before the client closes them, so streams already
+// in flight can finish. New streams go to the remaining connections.
+type DrainRequest struct {
+	// ConnectionIDs lists data connections by the ID they connected with.
+	ConnectionIDs []string `json:"connection_ids,omitempty"`
+	// All drains every connection, including the primary one, when the
+	// whole tunnel is about to close.
+	All bool `json:"all,omitempty"`
+}
+
+type DrainResponse struct {
+	Accepted bool   `json:"accepted"`
+	Message  string `json:"message,omitempty"`
+}
+
+// PauseRequest pauses or resumes a tunnel. A paused tunnel stays registered
+// but the server answers its HTTP visitors with a 503 page and closes TCP
+// connections instead of forwarding them.
+type PauseRequest struct {
+	Paused bool `json:"paused"`
+}
+
+type PauseResponse struct {
+	Accepted bool   `json:"accepted"`
+	Message  string `json:"message,omitempty"`
+}
+
+// ClientHeartbeat is the payload of a heartbeat frame. Clients send one on
+// a control stream every constants.ClientStateInterval to servers advertising
+// CapabilityClientState, which answer with an empty heartbeat ack.
+type ClientHeartbeat struct {
+	Version       string `json:"version"`
+	OS            string `json:"os"` // GOOS/GOARCH
+	ActiveStreams int64  `json:"active_streams"`
+
+	// LocalHealthy reports whether the local service answers; with several
+	// backends, whether any of them does. LocalError says why not.
+	LocalHealthy    bool   `json:"local_healthy"`
+	LocalError      string `json:"local_error,omitempty"`
+	Backends        int    `json:"backends,omitempty"`
+	HealthyBackends int    `json:"healthy_backends,omitempty"`
+}
+
+// P2POffer is pushed by the server on a P2PWatch stream when a consumer asks
+// for a direct connection to the tunnel.
+type P2POffer struct {
+	ID       string `json:"id"`
+	PeerAddr string `json:"peer_addr"`
+}
+
+// ExpiryNotice is pushed by the server on an ExpiryWatch stream shortly
+// before a tunnel with a TTL is torn down.
+type ExpiryNotice struct {
+	ExpiresAt int64 `json:"expires_at"`
+}
+
+// StreamStats is pushed by the server on a StreamStatsWatch stream when a
+// stream of the tunnel ends. BytesIn is what the visitor sent through it,
+// BytesOut what went back; FramesIn and FramesOut count the writes each
+// direction was carried in. Method, Path and Status are only set for HTTP
+// requests.
+type StreamStats struct {
+	StreamID   uint32 `json:"stream_id"`
+	Method     string `json:"method,omitempty"`
+	Path       string `json:"path,omitempty"`
+	Status     int    `json:"status,omitempty"`
+	RemoteAddr string `json:"remote_addr,omitempty"`
+	BytesIn    int64  `json:"bytes_in"`
+	BytesOut   int64  `json:"bytes_out"`
+	FramesIn   int64  `json:"frames_in"`
+	FramesOut  int64  `json:"frames_out"`
+	DurationMs int64  `json:"duration_ms"`
+}
+
+// ConnectPath is where 'drip connect' asks the server to reach a TCP
+// tunnel by name. The request upgrades to ConnectUpgrade, after which the
+// connection carries the tunnel's raw TCP stream.
+const (
+	ConnectPath    = "/_drip/connect"
+	ConnectUpgrade = "drip-tcp"
+)
+
+// ReplayPath is where 'drip replay' lists the requests a server stored for
+// a tunnel, with GET, and has one sent to the tunnel again, with POST. Both
+// take the tunnel's name in the tunnel parameter and the server token as
+// a bearer token; POST also takes the request's id.
+const ReplayPath = "/_drip/replay"
+
+// ReplayHeader carries the id of a stored request sent again.
+const ReplayHeader = "X-Drip-Replay"
+
+// MaxRequestStore caps how many requests a tunnel may ask the server to
+// keep in RegisterRequest.RequestStore.
+const MaxRequestStore = 100
+
+// StoredRequest describes a request in a tunnel's request store.
+type StoredRequest struct {
+	ID     int64     `json:"id"`
+	Time   time.Time `json:"time"`
+	Method string    `json:"method"`
+	URI    string    `json:"uri"`
+	Size   int64     `json:"size"`
+
+	// Status is the status of the response, 0 if none arrived.
+	Status int `json:"status,omitempty"`
+
+	// Offline marks a request that arrived while the tunnel was away.
+	Offline bool `json:"offline,omitempty"`
+
+	// Truncated marks a request whose body was too large to keep, which
+	// cannot be replayed.
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// ReplayResult answers a replay with the status the tunnel responded
+// with.
+type ReplayResult struct {
+	Status     int   `json:"status"`
+	DurationMs int64 `json:"duration_ms"`
+}
+
+// P2PConnectRequest is sent by a consumer to /_drip/p2p/connect.
+type P2PConnectRequest struct {
+	Port int `json:"port"`
+}
+
+// P2PAnnounceRequest is sent by the exposing client to /_drip/p2p/announce
+// from the socket it will punch from.
+type P2PAnnounceRequest struct {
+	ID string `json:"id"`
+}
+
+// P2PRendezvousResponse returns the peer's observed public address.
+type P2PRendezvousResponse struct {
+	ID       string `json:"id,omitempty"`
+	PeerAddr string `json:"peer_addr"`
+}
+
 type ErrorMessage struct {
 	Code    string `json:"code"`
 	Message string `json:"message"`
+
+	// MinVersion and UpgradeURL accompany ErrCodeClientTooOld.
+	MinVersion string `json:"min_version,omitempty"`
+	UpgradeURL string `json:"upgrade_url,omitempty"`
+
+	// Subdomain is the requested name refused with ErrCodeSubdomainTaken,
+	// ErrCodeSubdomainReserved or ErrCodeInvalidSubdomain, so clients can
+	// ask for another one.
+	Subdomain string `json:"subdomain,omitempty"`
 }
 
 func MarshalJSON(v interface{}) ([]byte, error) {
@@ -0,0 +1,111 @@
+package protocol
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"time"
+)
+
+// frameReaderBufferSize is the read-ahead of a FrameReader: enough for a
+// run of heartbeats and control messages to arrive in one read.
+const frameReaderBufferSize = 16 * 1024
+
+// FrameReader is the reading counterpart of FrameWriter. It reads frames
+// through a read-ahead buffer, so a burst of small frames costs one read
+// from the connection rather than two per frame, and hands out payloads in
+// pooled buffers that Frame.Release returns. Like ReadFrame it is not safe
+// for concurrent use.
+type FrameReader struct {
+	buf        *bufio.Reader
+	conn       interface{ SetReadDeadline(time.Time) error }
+	maxPayload int
+	timeout    time.Duration
+}
+
+// NewFrameReader returns a reader for frames from r. If r can set read
+// deadlines, SetFrameTimeout applies to it. A *bufio.Reader of at least
+// the read-ahead size is used as is.
+func NewFrameReader(r io.Reader) *FrameReader {
+	fr := &FrameReader{
+		buf:        bufio.NewReaderSize(r, frameReaderBufferSize),
+		maxPayload: MaxFrameSize,
+	}
+	fr.conn, _ = r.(interface{ SetReadDeadline(time.Time) error })
+	return fr
+}
+
+// SetMaxFrameSize sets the largest payload the reader accepts; larger
+// frames fail with ErrFrameTooLarge. It is capped at MaxFrameSize.
+func (fr *FrameReader) SetMaxFrameSize(n int) {
+	fr.maxPayload = min(n, MaxFrameSize)
+}
+
+// SetFrameTimeout sets how long a read may wait for the next frame before
+// it fails with a timeout. Zero, the default, leaves the connection's
+// deadline alone.
+func (fr *FrameReader) SetFrameTimeout(d time.Duration) {
+	fr.timeout = d
+}
+
+// ReadFrame reads the next frame.
+func (fr *FrameReader) ReadFrame() (*Frame, error) {
+	if fr.timeout > 0 && fr.conn != nil {
+		if err := fr.conn.SetReadDeadline(time.Now().Add(fr.timeout)); err != nil {
+			return nil, err
+		}
+	}
+	return ReadFrameLimit(fr.buf, fr.maxPayload)
+}
+
+// ReadBatch appends the next frame to frames, waiting for it, and then
+// any frames already read ahead, up to the capacity of frames. It never
+// waits for more than the first frame. An error is only returned if no
+// frame was read; a frame over the size limit is left for the next call
+// to fail on.
+func (fr *FrameReader) ReadBatch(frames []*Frame) ([]*Frame, error) {
+	frame, err := fr.ReadFrame()
+	if err != nil {
+		return frames, err
+	}
+	frames = append(frames, frame)
+
+	for len(frames) < cap(frames) && fr.buffered() {
+		frame, err := ReadFrameLimit(fr.buf, fr.maxPayload)
+		if err != nil {
+			break
+		}
+		frames = append(frames, frame)
+	}
+	return frames, nil
+}
+
+// buffered reports whether a whole frame within the size limit has been
+// read ahead, so reading it will not wait.
+func (fr *FrameReader) buffered() bool {
+	// Peek would wait for the header if it were not all buffered yet.
+	if fr.buf.Buffered() < FrameHeaderSize {
+		return false
+	}
+	header, err := fr.buf.Peek(FrameHeaderSize)
+	if err != nil {
+		return false
+	}
+	payloadLen := binary.BigEndian.Uint32(header[0:4])
+	if int64(payloadLen) > int64(fr.maxPayload) {
+		return false
+	}
+	return fr.buf.Buffered() >= FrameHeaderSize+int(payloadLen)
+}
+
+// Peek returns the next n bytes without consuming them, for telling the
+// frame protocol from other traffic on a shared port.
+func (fr *FrameReader) Peek(n int) ([]byte, error) {
+	return fr.buf.Peek(n)
+}
+
+// Reader returns the buffered reader frames are read from, for handing the
+// connection over to another protocol without losing what was read ahead.
+func (fr *FrameReader) Reader() *bufio.Reader {
+	return fr.buf
+}
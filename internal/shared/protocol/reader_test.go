@@ -0,0 +1,45 @@
+package protocol
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestFrameReaderReadBatch(t *testing.T) {
+	var buf bytes.Buffer
+	for _, payload := range []string{"a", "", "ccc", "dddd"} {
+		_ = WriteFrame(&buf, NewFrame(FrameTypeHeartbeat, []byte(payload)))
+	}
+	// A frame over the limit ends the batch and fails the next read.
+	_ = WriteFrame(&buf, NewFrame(FrameTypeRegister, make([]byte, 65)))
+
+	fr := NewFrameReader(&buf)
+	fr.SetMaxFrameSize(64)
+
+	tests := []struct {
+		name     string
+		max      int
+		payloads []string
+		wantErr  error
+	}{
+		{"capped at capacity", 2, []string{"a", ""}, nil},
+		{"stops before oversized frame", 8, []string{"ccc", "dddd"}, nil},
+		{"oversized frame", 8, nil, ErrFrameTooLarge},
+	}
+	for _, tt := range tests {
+		frames, err := fr.ReadBatch(make([]*Frame, 0, tt.max))
+		if !errors.Is(err, tt.wantErr) {
+			t.Fatalf("%s: ReadBatch() error = %v, want %v", tt.name, err, tt.wantErr)
+		}
+		if len(frames) != len(tt.payloads) {
+			t.Fatalf("%s: ReadBatch() returned %d frames, want %d", tt.name, len(frames), len(tt.payloads))
+		}
+		for i, frame := range frames {
+			if string(frame.Payload) != tt.payloads[i] {
+				t.Errorf("%s: frame %d payload = %q, want %q", tt.name, i, frame.Payload, tt.payloads[i])
+			}
+			frame.Release()
+		}
+	}
+}
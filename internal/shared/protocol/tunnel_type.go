@@ -10,6 +10,9 @@ const (
 	TunnelTypeHTTPS TunnelType = "https"
 	// TunnelTypeTCP is for generic TCP traffic
 	TunnelTypeTCP TunnelType = "tcp"
+	// TunnelTypeTLS is for TLS traffic passed through unterminated,
+	// routed by SNI on the server's shared port
+	TunnelTypeTLS TunnelType = "tls"
 	// TunnelTypeUDP is for UDP traffic (future support)
 	TunnelTypeUDP TunnelType = "udp"
 )
@@ -22,9 +25,15 @@ func (t TunnelType) String() string {
 // IsValid checks if tunnel type is valid
 func (t TunnelType) IsValid() bool {
 	switch t {
-	case TunnelTypeHTTP, TunnelTypeHTTPS, TunnelTypeTCP, TunnelTypeUDP:
+	case TunnelTypeHTTP, TunnelTypeHTTPS, TunnelTypeTCP, TunnelTypeTLS, TunnelTypeUDP:
 		return true
 	default:
 		return false
 	}
 }
+
+// IsHTTP reports whether visitors of the tunnel are HTTP requests, which
+// request rules, rate limits and stream compression apply to.
+func (t TunnelType) IsHTTP() bool {
+	return t == TunnelTypeHTTP || t == TunnelTypeHTTPS
+}
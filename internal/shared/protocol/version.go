@@ -0,0 +1,71 @@
+package protocol
+
+import (
+	"strconv"
+	"strings"
+)
+
+// ProtocolVersion is the revision of the registration handshake. Clients
+// send it in RegisterRequest and servers echo their own in RegisterResponse.
+const ProtocolVersion = 1
+
+// ALPN is the application protocol clients ask for in the TLS handshake
+// of their connections to the server, telling them apart from visitors'
+// HTTPS on the same port.
+const ALPN = "drip/1"
+
+// Capabilities a server advertises in RegisterResponse.Capabilities.
+const (
+	CapabilityDataConn          = "data_conn"
+	CapabilityStreamCompression = "stream_compression"
+	CapabilityTTL               = "ttl"
+	CapabilityRequestRules      = "request_rules"
+	CapabilityP2P               = "p2p"
+	CapabilityClientState       = "client_state"
+	CapabilitySchedule          = "schedule"
+	CapabilityPowerSave         = "power_save"
+	CapabilityStreamStats       = "stream_stats"
+)
+
+// CompareVersions compares two release versions such as "v1.4.2" or
+// "1.4.2-rc1". It returns -1, 0 or 1, and false if either version is not a
+// release number (e.g. "dev" builds). Pre-release suffixes are ignored.
+func CompareVersions(a, b string) (int, bool) {
+	va, ok := parseVersion(a)
+	if !ok {
+		return 0, false
+	}
+	vb, ok := parseVersion(b)
+	if !ok {
+		return 0, false
+	}
+	for i := range va {
+		switch {
+		case va[i] < vb[i]:
+			return -1, true
+		case va[i] > vb[i]:
+			return 1, true
+		}
+	}
+	return 0, true
+}
+
+func parseVersion(s string) ([3]int, bool) {
+	var v [3]int
+	s = strings.TrimPrefix(strings.TrimSpace(s), "v")
+	if i := strings.IndexAny(s, "-+"); i >= 0 {
+		s = s[:i]
+	}
+	parts := strings.Split(s, ".")
+	if len(parts) == 0 || len(parts) > 3 {
+		return v, false
+	}
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return v, false
+		}
+		v[i] = n
+	}
+	return v, true
+}
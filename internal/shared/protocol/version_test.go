@@ -0,0 +1,26 @@
+package protocol
+
+import "testing"
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b   string
+		want   int
+		wantOK bool
+	}{
+		{"v1.2.3", "1.2.3", 0, true},
+		{"v1.2", "v1.2.0", 0, true},
+		{"v1.10.0", "v1.9.9", 1, true},
+		{"v0.9.0", "v1.0.0", -1, true},
+		{"v1.3.0-rc1", "v1.3.0", 0, true},
+		{"dev", "v1.0.0", 0, false},
+		{"v1.0.0", "", 0, false},
+		{"v1.2.3.4", "v1.0.0", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := CompareVersions(tt.a, tt.b)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("CompareVersions(%q, %q) = %d, %v; want %d, %v", tt.a, tt.b, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
@@ -35,6 +35,10 @@ type FrameWriter struct {
 	adaptiveFlush           bool // Enable adaptive flush based on queue depth
 	lowConcurrencyThreshold int  // Queue depth threshold for immediate flush
 
+	// tuner, if set, picks the batch size and wait in place of maxBatch,
+	// maxBatchWait and adaptive flushing.
+	tuner *batchTuner
+
 	// Hooks
 	preWriteHook func(*Frame) // Called right before a frame is written to conn
 
@@ -45,7 +49,7 @@ type FrameWriter struct {
 
 func NewFrameWriter(conn io.Writer) *FrameWriter {
 	w := NewFrameWriterWithConfig(conn, 256, 2*time.Millisecond, 4096)
-	w.EnableAdaptiveFlush(16)
+	w.EnableBatchTuning()
 	return w
 }
 
@@ -83,10 +87,26 @@ func (w *FrameWriter) writeLoop() {
 	}
 	w.mu.Unlock()
 
+	// flushCh fires when a tuned batch has waited long enough.
+	var flushTimer *time.Timer
+	var flushCh <-chan time.Time
+	disarm := func() {
+		if flushTimer != nil {
+			flushTimer.Stop()
+		}
+		flushCh = nil
+	}
+
 	defer func() {
 		if heartbeatTicker != nil {
 			heartbeatTicker.Stop()
 		}
+		disarm()
+		w.mu.Lock()
+		if w.tuner != nil {
+			w.tuner.close()
+		}
+		w.mu.Unlock()
 	}()
 
 	for {
@@ -118,6 +138,23 @@ func (w *FrameWriter) writeLoop() {
 			w.mu.Lock()
 			w.batch = append(w.batch, frame)
 
+			if t := w.tuner; t != nil {
+				switch {
+				case len(w.batch) >= t.batch || (t.wait == 0 && len(w.queue) == 0):
+					w.flushBatchLocked()
+					disarm()
+				case flushCh == nil && t.wait > 0:
+					if flushTimer == nil {
+						flushTimer = time.NewTimer(t.wait)
+					} else {
+						flushTimer.Reset(t.wait)
+					}
+					flushCh = flushTimer.C
+				}
+				w.mu.Unlock()
+				continue
+			}
+
 			shouldFlushNow := len(w.batch) >= w.maxBatch ||
 				(w.adaptiveFlush && len(w.queue) <= w.lowConcurrencyThreshold)
 
@@ -126,6 +163,12 @@ func (w *FrameWriter) writeLoop() {
 			}
 			w.mu.Unlock()
 
+		case <-flushCh:
+			flushCh = nil
+			w.mu.Lock()
+			w.flushBatchLocked()
+			w.mu.Unlock()
+
 		case <-batchTicker.C:
 			w.mu.Lock()
 			if len(w.batch) > 0 {
@@ -164,15 +207,32 @@ func (w *FrameWriter) writeLoop() {
 	}
 }
 
+// flushBatchLocked writes the batch in one write. Caller must hold w.mu.
 func (w *FrameWriter) flushBatchLocked() {
 	if len(w.batch) == 0 {
 		return
 	}
 
-	for _, frame := range w.batch {
-		w.flushFrameLocked(frame)
+	if w.preWriteHook != nil {
+		for _, frame := range w.batch {
+			w.preWriteHook(frame)
+		}
+	}
+
+	start := time.Now()
+	err := writeFrames(w.conn, w.batch)
+	if w.tuner != nil {
+		w.tuner.observe(len(w.batch), time.Since(start), len(w.queue))
+	}
+	if err != nil {
+		w.failLocked(err)
 	}
 
+	for i, frame := range w.batch {
+		w.unmarkQueued(frame)
+		frame.Release()
+		w.batch[i] = nil
+	}
 	w.batch = w.batch[:0]
 }
 
@@ -187,19 +247,24 @@ func (w *FrameWriter) flushFrameLocked(frame *Frame) {
 	}
 
 	if err := WriteFrame(w.conn, frame); err != nil {
-		w.errOnce.Do(func() {
-			w.writeErr = err
-			if w.onWriteError != nil {
-				go w.onWriteError(err)
-			}
-			w.closed = true
-		})
+		w.failLocked(err)
 	}
 
 	w.unmarkQueued(frame)
 	frame.Release()
 }
 
+// failLocked records the first write error. Caller must hold w.mu.
+func (w *FrameWriter) failLocked(err error) {
+	w.errOnce.Do(func() {
+		w.writeErr = err
+		if w.onWriteError != nil {
+			go w.onWriteError(err)
+		}
+		w.closed = true
+	})
+}
+
 func (w *FrameWriter) WriteFrame(frame *Frame) error {
 	return w.WriteFrameWithCancel(frame, nil)
 }
@@ -384,6 +449,27 @@ func (w *FrameWriter) EnableAdaptiveFlush(lowConcurrencyThreshold int) {
 	w.mu.Unlock()
 }
 
+// EnableBatchTuning lets the writer pick its batch size and wait from
+// measured write latency and queue depth, up to the maxBatch and
+// maxBatchWait it was created with. It overrides adaptive flushing.
+func (w *FrameWriter) EnableBatchTuning() {
+	w.mu.Lock()
+	if w.tuner == nil && !w.closed {
+		w.tuner = newBatchTuner(w.maxBatch, w.maxBatchWait)
+	}
+	w.mu.Unlock()
+}
+
+// BatchParams returns the batch size and wait the writer uses.
+func (w *FrameWriter) BatchParams() (int, time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.tuner != nil {
+		return w.tuner.batch, w.tuner.wait
+	}
+	return w.maxBatch, w.maxBatchWait
+}
+
 func (w *FrameWriter) DisableAdaptiveFlush() {
 	w.mu.Lock()
 	w.adaptiveFlush = false
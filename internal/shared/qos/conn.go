@@ -25,14 +25,14 @@ func (c *LimitedConn) Read(b []byte) (n int, err error) {
 		return c.Conn.Read(b)
 	}
 
-	burst := c.limiter.RateLimiter().Burst()
+	burst := c.limiter.burst()
 	if len(b) > burst {
 		b = b[:burst]
 	}
 
 	n, err = c.Conn.Read(b)
 	if n > 0 {
-		if waitErr := c.limiter.RateLimiter().WaitN(c.ctx, n); waitErr != nil {
+		if waitErr := c.limiter.waitN(c.ctx, n); waitErr != nil {
 			if err == nil {
 				err = waitErr
 			}
@@ -46,13 +46,13 @@ func (c *LimitedConn) Write(b []byte) (n int, err error) {
 		return c.Conn.Write(b)
 	}
 
-	burst := c.limiter.RateLimiter().Burst()
+	burst := c.limiter.burst()
 	total := 0
 
 	for len(b) > 0 {
 		chunk := min(len(b), burst)
 
-		if err := c.limiter.RateLimiter().WaitN(c.ctx, chunk); err != nil {
+		if err := c.limiter.waitN(c.ctx, chunk); err != nil {
 			return total, err
 		}
 
@@ -252,3 +252,31 @@ func TestUnlimitedWrite(t *testing.T) {
 		t.Errorf("Unlimited write took too long: %v", dur)
 	}
 }
+
+func TestSharedLimiter(t *testing.T) {
+	shared := NewLimiter(Config{Bandwidth: 10 * 1024, Burst: 1024})
+	a := NewLimiter(Config{Shared: shared})
+	b := NewLimiter(Config{Bandwidth: 1024 * 1024, Shared: shared})
+	if !a.IsLimited() || a.burst() != 1024 || b.burst() != 1024 {
+		t.Fatalf("IsLimited() = %v, burst() = %d, %d; want true, 1024, 1024", a.IsLimited(), a.burst(), b.burst())
+	}
+
+	// Both connections draw from the same 10 KiB/s, so 4 KiB takes about
+	// 300ms after the initial burst rather than half that.
+	start := time.Now()
+	var wg sync.WaitGroup
+	for _, l := range []*Limiter{a, b} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			lc := NewLimitedConn(context.Background(), newMockConn(nil), l)
+			if _, err := lc.Write(make([]byte, 2*1024)); err != nil {
+				t.Errorf("Write failed: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if elapsed := time.Since(start); elapsed < 250*time.Millisecond {
+		t.Errorf("shared limit not enforced, 4 KiB took %v", elapsed)
+	}
+}
@@ -1,16 +1,23 @@
 package qos
 
 import (
+	"context"
+
 	"golang.org/x/time/rate"
 )
 
 type Config struct {
 	Bandwidth int64
 	Burst     int
+
+	// Shared is a limiter this one's traffic also counts against, such as
+	// the bandwidth all tunnels of one token share.
+	Shared *Limiter
 }
 
 type Limiter struct {
 	limiter *rate.Limiter
+	shared  *Limiter
 }
 
 func NewLimiter(cfg Config) *Limiter {
@@ -22,13 +29,46 @@ func NewLimiter(cfg Config) *Limiter {
 		}
 		l.limiter = rate.NewLimiter(rate.Limit(cfg.Bandwidth), burst)
 	}
+	if cfg.Shared.IsLimited() {
+		l.shared = cfg.Shared
+	}
 	return l
 }
 
+// RateLimiter returns the limiter's own rate, nil if only a shared limiter
+// applies.
 func (l *Limiter) RateLimiter() *rate.Limiter {
 	return l.limiter
 }
 
 func (l *Limiter) IsLimited() bool {
-	return l.limiter != nil
+	return l != nil && (l.limiter != nil || l.shared.IsLimited())
+}
+
+// burst returns the largest chunk every applicable limiter allows at once.
+func (l *Limiter) burst() int {
+	burst := 0
+	if l.limiter != nil {
+		burst = l.limiter.Burst()
+	}
+	if l.shared.IsLimited() {
+		if b := l.shared.burst(); burst == 0 || b < burst {
+			burst = b
+		}
+	}
+	return burst
+}
+
+// waitN blocks until n bytes are allowed by the limiter and the one it
+// shares.
+func (l *Limiter) waitN(ctx context.Context, n int) error {
+	if l.limiter != nil {
+		if err := l.limiter.WaitN(ctx, n); err != nil {
+			return err
+		}
+	}
+	if l.shared.IsLimited() {
+		return l.shared.waitN(ctx, n)
+	}
+	return nil
 }
@@ -0,0 +1,80 @@
+package recovery
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// DumpFilePrefix names panic dump files inside the dump directory.
+	DumpFilePrefix = "panic-"
+
+	// maxDumpFiles bounds how many dumps are kept; older ones are pruned.
+	maxDumpFiles = 50
+)
+
+// DefaultCrashDir returns the directory panic dumps are written to when no
+// other location is configured.
+func DefaultCrashDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(".drip", "crashes")
+	}
+	return filepath.Join(home, ".drip", "crashes")
+}
+
+// writeDump stores record as a text file in dir and prunes old dumps.
+func writeDump(dir string, record PanicRecord) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%s%s-%d.txt", DumpFilePrefix,
+		record.Timestamp.UTC().Format("20060102T150405"), record.Timestamp.UnixNano()%1e9)
+	content := fmt.Sprintf("location: %s\ntime: %s\npanic: %v\n\n%s",
+		record.Location, record.Timestamp.Format(time.RFC3339Nano), record.Value, record.Stack)
+
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+		return err
+	}
+	return pruneDumps(dir)
+}
+
+func pruneDumps(dir string) error {
+	dumps, err := ListDumps(dir)
+	if err != nil {
+		return err
+	}
+	for len(dumps) > maxDumpFiles {
+		_ = os.Remove(dumps[0])
+		dumps = dumps[1:]
+	}
+	return nil
+}
+
+// ListDumps returns the panic dump files in dir, oldest first. A missing
+// directory yields no dumps.
+func ListDumps(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var dumps []string
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasPrefix(entry.Name(), DumpFilePrefix) {
+			continue
+		}
+		dumps = append(dumps, filepath.Join(dir, entry.Name()))
+	}
+	// Names embed a sortable UTC timestamp.
+	sort.Strings(dumps)
+	return dumps, nil
+}
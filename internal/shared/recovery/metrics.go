@@ -3,6 +3,7 @@ package recovery
 import (
 	"fmt"
 	"runtime/debug"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -17,6 +18,7 @@ type PanicMetrics struct {
 	mu           sync.Mutex
 	logger       *zap.Logger
 	alerter      Alerter
+	dumpDir      string
 }
 
 type PanicRecord struct {
@@ -41,6 +43,8 @@ func NewPanicMetrics(logger *zap.Logger, alerter Alerter) *PanicMetrics {
 func (pm *PanicMetrics) RecordPanic(location string, panicValue interface{}) {
 	atomic.AddUint64(&pm.totalPanics, 1)
 	metrics.PanicTotal.Inc()
+	metrics.PanicsByLocation.WithLabelValues(metricLocation(location)).Inc()
+	metrics.PanicLastTimestamp.SetToCurrentTime()
 
 	pm.mu.Lock()
 
@@ -58,13 +62,51 @@ func (pm *PanicMetrics) RecordPanic(location string, panicValue interface{}) {
 	}
 
 	shouldAlert := pm.shouldAlertUnlocked()
+	dumpDir := pm.dumpDir
 	pm.mu.Unlock()
 
+	if dumpDir != "" {
+		if err := writeDump(dumpDir, record); err != nil {
+			pm.logger.Warn("Failed to write panic dump", zap.String("dir", dumpDir), zap.Error(err))
+		}
+	}
+
 	if shouldAlert {
 		pm.sendAlert()
 	}
 }
 
+// metricLocation drops the per-instance suffix of names such as
+// "handleConnection-1.2.3.4:5678" so the metric label stays bounded.
+func metricLocation(location string) string {
+	if i := strings.IndexByte(location, '-'); i > 0 {
+		return location[:i]
+	}
+	return location
+}
+
+// SetDumpDir makes every recorded panic also be written to dir, so stacks
+// survive restarts and can be collected by 'drip support-bundle'. An empty
+// dir disables dumps.
+func (pm *PanicMetrics) SetDumpDir(dir string) {
+	pm.mu.Lock()
+	pm.dumpDir = dir
+	pm.mu.Unlock()
+}
+
+// Total returns the number of panics recorded since startup.
+func (pm *PanicMetrics) Total() uint64 {
+	return atomic.LoadUint64(&pm.totalPanics)
+}
+
+// Recent returns a copy of the most recent panics, oldest first.
+func (pm *PanicMetrics) Recent() []PanicRecord {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	return append([]PanicRecord(nil), pm.recentPanics...)
+}
+
 func (pm *PanicMetrics) shouldAlertUnlocked() bool {
 	threshold := time.Now().Add(-5 * time.Minute)
 	count := 0
@@ -0,0 +1,190 @@
+// Package schedule handles tunnel availability schedules such as
+// "Mon-Fri 09:00-18:00 Europe/Berlin": outside its windows the server keeps
+// a tunnel registered but turns its visitors away.
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	// Servers often run in minimal containers without a zoneinfo
+	// database.
+	_ "time/tzdata"
+)
+
+// MaxLength caps the length of a schedule spec.
+const MaxLength = 256
+
+// Schedule is a set of weekly time windows in one time zone.
+type Schedule struct {
+	spec    string
+	loc     *time.Location
+	windows []window
+}
+
+// window is open from start to end, in minutes after midnight, on each of
+// its days. A window whose end is not after its start runs past midnight
+// into the next day.
+type window struct {
+	days       [7]bool
+	start, end int
+}
+
+// Parse reads a schedule: one or more windows separated by ';', each an
+// optional list of days followed by a time range, and an optional IANA
+// time zone at the end (default UTC). Days are names like Mon, ranges like
+// Mon-Fri and lists like Mon,Wed,Fri; without days a window applies daily.
+//
+//	Mon-Fri 09:00-18:00 Europe/Berlin
+//	Mon-Fri 08:00-20:00; Sat 10:00-14:00
+//	22:00-06:00 America/New_York
+func Parse(spec string) (*Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return nil, fmt.Errorf("empty schedule")
+	}
+	if len(spec) > MaxLength {
+		return nil, fmt.Errorf("schedule is longer than %d characters", MaxLength)
+	}
+
+	s := &Schedule{spec: spec, loc: time.UTC}
+	parts := strings.Split(spec, ";")
+	for i, part := range parts {
+		fields := strings.Fields(part)
+		if i == len(parts)-1 && len(fields) > 1 && isZoneName(fields[len(fields)-1]) {
+			// Local would be the server's zone, not the client's.
+			name := fields[len(fields)-1]
+			loc, err := time.LoadLocation(name)
+			if err != nil || name == "Local" {
+				return nil, fmt.Errorf("unknown time zone %q", name)
+			}
+			s.loc = loc
+			fields = fields[:len(fields)-1]
+		}
+
+		w, err := parseWindow(fields)
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule window %q: %w", strings.TrimSpace(part), err)
+		}
+		s.windows = append(s.windows, w)
+	}
+	return s, nil
+}
+
+func parseWindow(fields []string) (window, error) {
+	var w window
+	switch len(fields) {
+	case 1:
+		for d := range w.days {
+			w.days[d] = true
+		}
+	case 2:
+		if err := parseDays(fields[0], &w.days); err != nil {
+			return w, err
+		}
+		fields = fields[1:]
+	default:
+		return w, fmt.Errorf("expected [days] HH:MM-HH:MM")
+	}
+
+	from, to, ok := strings.Cut(fields[0], "-")
+	if !ok {
+		return w, fmt.Errorf("expected a time range like 09:00-18:00")
+	}
+	var err error
+	if w.start, err = parseClock(from, false); err != nil {
+		return w, err
+	}
+	if w.end, err = parseClock(to, true); err != nil {
+		return w, err
+	}
+	if w.start == w.end {
+		return w, fmt.Errorf("window starts and ends at %s", from)
+	}
+	return w, nil
+}
+
+func parseDays(spec string, days *[7]bool) error {
+	for _, item := range strings.Split(spec, ",") {
+		from, to, isRange := strings.Cut(item, "-")
+		first, err := parseDay(from)
+		if err != nil {
+			return err
+		}
+		last := first
+		if isRange {
+			if last, err = parseDay(to); err != nil {
+				return err
+			}
+		}
+		// Ranges may wrap around the week, e.g. Fri-Mon.
+		for d := first; ; d = (d + 1) % 7 {
+			days[d] = true
+			if d == last {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// parseDay reads a day name, full or abbreviated to three letters.
+func parseDay(name string) (int, error) {
+	lower := strings.ToLower(name)
+	for d := range 7 {
+		full := strings.ToLower(time.Weekday(d).String())
+		if lower == full || lower == full[:3] {
+			return d, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown day %q", name)
+}
+
+// parseClock reads HH:MM as minutes after midnight. 24:00 is accepted as
+// the end of a window.
+func parseClock(s string, end bool) (int, error) {
+	hh, mm, ok := strings.Cut(s, ":")
+	h, err1 := strconv.Atoi(hh)
+	m, err2 := strconv.Atoi(mm)
+	if !ok || err1 != nil || err2 != nil || len(mm) != 2 || h < 0 || m < 0 || m > 59 {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", s)
+	}
+	if h > 23 && !(end && h == 24 && m == 0) {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", s)
+	}
+	return h*60 + m, nil
+}
+
+// isZoneName tells a trailing time zone from a time range: zone names
+// start with a letter.
+func isZoneName(field string) bool {
+	c := field[0]
+	return c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z'
+}
+
+// Open reports whether t falls in one of the schedule's windows.
+func (s *Schedule) Open(t time.Time) bool {
+	t = t.In(s.loc)
+	day := int(t.Weekday())
+	prev := (day + 6) % 7
+	minute := t.Hour()*60 + t.Minute()
+	for _, w := range s.windows {
+		if w.start < w.end {
+			if w.days[day] && minute >= w.start && minute < w.end {
+				return true
+			}
+			continue
+		}
+		if (w.days[day] && minute >= w.start) || (w.days[prev] && minute < w.end) {
+			return true
+		}
+	}
+	return false
+}
+
+// String returns the schedule as it was given to Parse.
+func (s *Schedule) String() string {
+	return s.spec
+}
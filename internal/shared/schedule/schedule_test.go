@@ -0,0 +1,65 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"Mon-Fri",
+		"Mon-Fri 09:00",
+		"Mon-Fri 09:00-09:00",
+		"Mon-Fri 9-18",
+		"Mon-Fri 09:00-25:00",
+		"Someday 09:00-18:00",
+		"Mon-Fri 09:00-18:00 Mars/Olympus",
+		"Mon-Fri 09:00-18:00 Local",
+		"Mon 09:00-10:00 UTC; Tue 09:00-10:00",
+	} {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("Parse(%q) accepted an invalid schedule", spec)
+		}
+	}
+}
+
+func TestOpen(t *testing.T) {
+	// 2024-01-01 was a Monday.
+	at := func(day int, clock string) time.Time {
+		tm, err := time.Parse("15:04", clock)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return time.Date(2024, 1, day, tm.Hour(), tm.Minute(), 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		spec string
+		t    time.Time
+		want bool
+	}{
+		{"Mon-Fri 09:00-18:00", at(1, "09:00"), true},
+		{"Mon-Fri 09:00-18:00", at(1, "18:00"), false},
+		{"Mon-Fri 09:00-18:00", at(6, "12:00"), false},
+		{"Mon-Fri 09:00-18:00 Europe/Berlin", at(1, "08:30"), true},
+		{"Mon-Fri 09:00-18:00 Europe/Berlin", at(1, "17:30"), false},
+		{"mon,wed 10:00-11:00; Sat 00:00-24:00", at(3, "10:59"), true},
+		{"mon,wed 10:00-11:00; Sat 00:00-24:00", at(2, "10:30"), false},
+		{"mon,wed 10:00-11:00; Sat 00:00-24:00", at(6, "23:59"), true},
+		{"Fri 22:00-06:00", at(5, "23:00"), true},
+		{"Fri 22:00-06:00", at(6, "05:59"), true},
+		{"Fri 22:00-06:00", at(5, "05:00"), false},
+		{"Fri-Mon 12:00-13:00", at(7, "12:00"), true},
+		{"22:00-06:00", at(3, "03:00"), true},
+	}
+	for _, tt := range tests {
+		s, err := Parse(tt.spec)
+		if err != nil {
+			t.Fatalf("Parse(%q) = %v", tt.spec, err)
+		}
+		if got := s.Open(tt.t); got != tt.want {
+			t.Errorf("%q: Open(%s) = %v, want %v", tt.spec, tt.t.Format("Mon 15:04"), got, tt.want)
+		}
+	}
+}
@@ -13,6 +13,9 @@ type TrafficStats struct {
 	totalRequests     int64
 	activeConnections int64
 
+	queuedRequests   int64
+	rejectedRequests int64
+
 	lastBytesIn  int64
 	lastBytesOut int64
 	lastTime     time.Time
@@ -60,6 +63,16 @@ func (s *TrafficStats) DecActiveConnections() {
 	}
 }
 
+// AddQueued changes the number of requests waiting for the local service.
+func (s *TrafficStats) AddQueued(delta int64) {
+	atomic.AddInt64(&s.queuedRequests, delta)
+}
+
+// AddRejected counts a request turned away because the queue was full.
+func (s *TrafficStats) AddRejected() {
+	atomic.AddInt64(&s.rejectedRequests, 1)
+}
+
 func (s *TrafficStats) GetTotalBytesIn() int64 {
 	return atomic.LoadInt64(&s.totalBytesIn)
 }
@@ -135,6 +148,8 @@ type Snapshot struct {
 	TotalBytes        int64
 	TotalRequests     int64
 	ActiveConnections int64
+	QueuedRequests    int64
+	RejectedRequests  int64
 	SpeedIn           int64
 	SpeedOut          int64
 	Uptime            time.Duration
@@ -156,6 +171,8 @@ func (s *TrafficStats) GetSnapshot() Snapshot {
 		TotalBytes:        totalIn + totalOut,
 		TotalRequests:     atomic.LoadInt64(&s.totalRequests),
 		ActiveConnections: active,
+		QueuedRequests:    atomic.LoadInt64(&s.queuedRequests),
+		RejectedRequests:  atomic.LoadInt64(&s.rejectedRequests),
 		SpeedIn:           speedIn,
 		SpeedOut:          speedOut,
 		Uptime:            time.Since(s.startTime),
@@ -6,6 +6,8 @@ import (
 	"time"
 
 	"github.com/charmbracelet/lipgloss"
+
+	"drip/internal/shared/protocol"
 )
 
 const (
@@ -22,7 +24,7 @@ var (
 
 // TunnelStatus represents the status of a tunnel
 type TunnelStatus struct {
-	Type         string        // "http", "https", "tcp"
+	Type         string        // "http", "https", "tcp", "tls"
 	URL          string        // Public URL
 	LocalAddr    string        // Local address
 	Latency      time.Duration // Current latency
@@ -31,6 +33,11 @@ type TunnelStatus struct {
 	SpeedIn      float64       // Download speed
 	SpeedOut     float64       // Upload speed
 	TotalRequest int64         // Total requests
+	Queued       int64         // Requests waiting for the local service
+	Rejected     int64         // Requests turned away while it was overloaded
+	ExpiresAt    time.Time     // When the server closes the tunnel, zero if no TTL
+	AlertAt      int64         // Session traffic that triggers the bandwidth alert, 0 if none
+	Paused       bool          // Traffic is not forwarded to the local service
 }
 
 // RenderTunnelConnected renders the tunnel connection card
@@ -94,7 +101,7 @@ func RenderTunnelStats(status *TunnelStatus) string {
 	_, _, accent := tunnelVisuals(status.Type)
 
 	requestLabel := "Requests"
-	if status.Type == "tcp" {
+	if status.Type == "tcp" || status.Type == "tls" {
 		requestLabel = "Connections"
 	}
 
@@ -122,13 +129,19 @@ func RenderTunnelStats(status *TunnelStatus) string {
 		Padding(1, 2).
 		Width(tunnelCardWidth)
 
-	body := lipgloss.JoinVertical(
-		lipgloss.Left,
-		header,
-		"",
-		row1,
-		row2,
-	)
+	rows := []string{header, "", row1, row2}
+	if status.Queued > 0 || status.Rejected > 0 {
+		queueStr := fmt.Sprintf("%d waiting  %d rejected", status.Queued, status.Rejected)
+		rows = append(rows, statColumn("Queue", warningStyle.Render(queueStr), 0))
+	}
+	if !status.ExpiresAt.IsZero() {
+		rows = append(rows, statColumn("Expires In", formatCountdown(time.Until(status.ExpiresAt)), 0))
+	}
+	if status.AlertAt > 0 {
+		rows = append(rows, statColumn("Alert", formatAlert(status), 0))
+	}
+
+	body := lipgloss.JoinVertical(lipgloss.Left, rows...)
 
 	return "\n" + card.Render(body) + "\n"
 }
@@ -146,6 +159,19 @@ func RenderConnectionFailed(err error) string {
 	return Error(fmt.Sprintf("Connection failed: %v", err))
 }
 
+// RenderUpgradeRequired renders the message for a server that refuses this
+// client version
+func RenderUpgradeRequired(version, minVersion, upgradeURL string) string {
+	lines := []string{
+		KeyValue("Version", version),
+		KeyValue("Required", minVersion+" or newer"),
+	}
+	if upgradeURL != "" {
+		lines = append(lines, KeyValue("Download", URL(upgradeURL)))
+	}
+	return ErrorBox("Upgrade Required", lines...)
+}
+
 // RenderShuttingDown renders shutdown message
 func RenderShuttingDown() string {
 	return Warning("⏹  Shutting down...")
@@ -156,6 +182,39 @@ func RenderConnectionLost() string {
 	return Error("⚠  Connection lost!")
 }
 
+// RenderExpiryWarning renders the warning that the tunnel's TTL is running out
+func RenderExpiryWarning(expiresAt time.Time) string {
+	return Warning(fmt.Sprintf("⏳ Tunnel expires in %s", formatCountdown(time.Until(expiresAt))))
+}
+
+// RenderTunnelExpired renders the message shown once the TTL has run out
+func RenderTunnelExpired() string {
+	return Warning("⏹  Tunnel expired (TTL reached)")
+}
+
+// RenderStreamStats renders one finished request or connection with what
+// it transferred: up is what the visitor sent, down what came back
+func RenderStreamStats(s protocol.StreamStats) string {
+	var what string
+	if s.Method != "" {
+		status := Success(fmt.Sprint(s.Status))
+		if s.Status >= 400 {
+			status = Error(fmt.Sprint(s.Status))
+		}
+		what = fmt.Sprintf("%s %s %s", s.Method, s.Path, status)
+	} else {
+		what = "Connection from " + s.RemoteAddr
+	}
+	return fmt.Sprintf("  %s  %s",
+		what,
+		Muted(fmt.Sprintf("↑ %s (%d frames)  ↓ %s (%d frames)  %dms",
+			formatBytes(s.BytesIn), s.FramesIn,
+			formatBytes(s.BytesOut), s.FramesOut,
+			s.DurationMs,
+		)),
+	)
+}
+
 // RenderRetrying renders retry message
 func RenderRetrying(interval time.Duration) string {
 	return Muted(fmt.Sprintf("  Retrying in %v...", interval))
@@ -189,6 +248,31 @@ func formatLatency(d time.Duration) string {
 	return style.Render(fmt.Sprintf("%dms", ms))
 }
 
+// formatCountdown formats the time left until expiry, colored as it runs out
+func formatCountdown(d time.Duration) string {
+	if d < 0 {
+		d = 0
+	}
+	text := d.Truncate(time.Second).String()
+	if d < 5*time.Minute {
+		return errorStyle.Render(text)
+	}
+	return warningStyle.Render(text)
+}
+
+// formatAlert shows session traffic against the bandwidth alert threshold
+func formatAlert(status *TunnelStatus) string {
+	total := status.BytesIn + status.BytesOut
+	text := fmt.Sprintf("%s of %s", formatBytes(total), formatBytes(status.AlertAt))
+	if status.Paused {
+		return errorStyle.Render(text + " • paused")
+	}
+	if total >= status.AlertAt {
+		return errorStyle.Render(text)
+	}
+	return warningStyle.Render(text)
+}
+
 // formatBytes formats bytes to human readable format
 func formatBytes(bytes int64) string {
 	const unit = 1024
@@ -245,6 +329,8 @@ func tunnelVisuals(tunnelType string) (string, string, lipgloss.Color) {
 		return "🔒", "HTTPS", lipgloss.Color("#2D8CFF")
 	case "tcp":
 		return "🔌", "TCP", lipgloss.Color("#50E3C2")
+	case "tls":
+		return "🔐", "TLS", lipgloss.Color("#50E3C2")
 	default:
 		return "🌐", strings.ToUpper(tunnelType), lipgloss.Color("#0070F3")
 	}
@@ -1,27 +1,28 @@
 package utils
 
-import "strings"
+import (
+	"errors"
+	"io"
+	"net"
+	"strings"
 
-// IsNetworkError checks if an error message indicates a common network error
-// that should be handled gracefully (not logged as severe errors).
-func IsNetworkError(errStr string) bool {
-	return strings.Contains(errStr, "EOF") ||
-		strings.Contains(errStr, "connection reset by peer") ||
-		strings.Contains(errStr, "broken pipe") ||
-		strings.Contains(errStr, "connection refused") ||
-		strings.Contains(errStr, "use of closed network connection") ||
-		strings.Contains(errStr, "websocket: close")
-}
+	"github.com/gorilla/websocket"
+)
 
-// IsProtocolError checks if an error message indicates a protocol-level error
-// (invalid requests, malformed data, etc.).
-func IsProtocolError(errStr string) bool {
-	return strings.Contains(errStr, "payload too large") ||
-		strings.Contains(errStr, "failed to read registration frame") ||
-		strings.Contains(errStr, "expected register frame") ||
-		strings.Contains(errStr, "failed to parse registration request") ||
-		strings.Contains(errStr, "failed to parse HTTP request") ||
-		strings.Contains(errStr, "tunnel type not allowed")
+// IsNetworkError reports whether err is a common network error, such as
+// the peer going away, that should be handled gracefully (not logged as a
+// severe error).
+func IsNetworkError(err error) bool {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, net.ErrClosed) {
+		return true
+	}
+	for _, errno := range peerGoneErrnos {
+		if errors.Is(err, errno) {
+			return true
+		}
+	}
+	var closeErr *websocket.CloseError
+	return errors.As(err, &closeErr)
 }
 
 // ContainsAny checks if a string contains any of the given substrings.
@@ -0,0 +1,9 @@
+//go:build !windows
+
+package utils
+
+import "syscall"
+
+// peerGoneErrnos are the errors seen when the peer resets or closes a
+// connection mid-write.
+var peerGoneErrnos = []syscall.Errno{syscall.ECONNRESET, syscall.EPIPE, syscall.ECONNREFUSED}
@@ -0,0 +1,7 @@
+package utils
+
+import "syscall"
+
+// peerGoneErrnos are the errors seen when the peer resets or aborts a
+// connection.
+var peerGoneErrnos = []syscall.Errno{syscall.WSAECONNRESET, syscall.WSAECONNABORTED}
@@ -0,0 +1,180 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Log subsystems. Components name their logger after one of these
+// (logger.Named(...)) so their verbosity can be changed independently.
+const (
+	SubsystemProtocol = "protocol"
+	SubsystemProxy    = "proxy"
+	SubsystemAuth     = "auth"
+)
+
+// logLevels holds the runtime-adjustable levels shared by the global logger.
+var logLevels = newLevelRegistry(zapcore.InfoLevel)
+
+func newLevelRegistry(level zapcore.Level) *levelRegistry {
+	r := &levelRegistry{
+		global:     zap.NewAtomicLevelAt(level),
+		subsystems: make(map[string]zapcore.Level),
+	}
+	r.recompute()
+	return r
+}
+
+type levelRegistry struct {
+	global zap.AtomicLevel
+
+	mu         sync.RWMutex
+	subsystems map[string]zapcore.Level
+
+	// min caches the most verbose level in effect anywhere so that
+	// Enabled stays lock-free on the logging hot path.
+	min          atomic.Int32
+	hasOverrides atomic.Bool
+}
+
+// levelFor returns the level for a logger name such as "protocol.auth". The
+// rightmost name segment with its own level wins, so "auth" overrides
+// "protocol"; otherwise the global level applies.
+func (r *levelRegistry) levelFor(name string) zapcore.Level {
+	if name == "" || !r.hasOverrides.Load() {
+		return r.global.Level()
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	parts := strings.Split(name, ".")
+	for i := len(parts) - 1; i >= 0; i-- {
+		if lvl, ok := r.subsystems[parts[i]]; ok {
+			return lvl
+		}
+	}
+	return r.global.Level()
+}
+
+// recompute refreshes the cached minimum level. Callers must hold r.mu.
+func (r *levelRegistry) recompute() {
+	lvl := r.global.Level()
+	for _, l := range r.subsystems {
+		if l < lvl {
+			lvl = l
+		}
+	}
+	r.min.Store(int32(lvl))
+	r.hasOverrides.Store(len(r.subsystems) > 0)
+}
+
+// subsystemCore filters entries by the level of the logger's subsystem. The
+// wrapped core is built at debug level and never filters on its own.
+type subsystemCore struct {
+	zapcore.Core
+}
+
+func (c *subsystemCore) Enabled(lvl zapcore.Level) bool {
+	return int32(lvl) >= logLevels.min.Load()
+}
+
+func (c *subsystemCore) With(fields []zapcore.Field) zapcore.Core {
+	return &subsystemCore{Core: c.Core.With(fields)}
+}
+
+func (c *subsystemCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if ent.Level < logLevels.levelFor(ent.LoggerName) {
+		return ce
+	}
+	return c.Core.Check(ent, ce)
+}
+
+// buildLogger builds config with runtime-adjustable levels starting at level.
+func buildLogger(config zap.Config, level zapcore.Level) (*zap.Logger, error) {
+	logLevels.mu.Lock()
+	logLevels.global.SetLevel(level)
+	logLevels.recompute()
+	logLevels.mu.Unlock()
+
+	config.Level = zap.NewAtomicLevelAt(zapcore.DebugLevel)
+
+	return config.Build(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		return &subsystemCore{Core: core}
+	}))
+}
+
+// SetLogLevel changes the level of subsystem at runtime, or the global level
+// when subsystem is empty. Passing level "reset" for a subsystem makes it
+// follow the global level again.
+func SetLogLevel(subsystem, level string) error {
+	subsystem = strings.ToLower(strings.TrimSpace(subsystem))
+
+	logLevels.mu.Lock()
+	defer logLevels.mu.Unlock()
+
+	if subsystem != "" && strings.EqualFold(level, "reset") {
+		delete(logLevels.subsystems, subsystem)
+		logLevels.recompute()
+		return nil
+	}
+
+	lvl, err := zapcore.ParseLevel(level)
+	if err != nil {
+		return fmt.Errorf("invalid log level %q: use debug, info, warn, error", level)
+	}
+
+	if subsystem == "" {
+		logLevels.global.SetLevel(lvl)
+	} else {
+		logLevels.subsystems[subsystem] = lvl
+	}
+	logLevels.recompute()
+	return nil
+}
+
+// ReplaceLogLevels sets the global level and replaces every subsystem
+// override with those in subsystems, e.g. from a reloaded config file.
+func ReplaceLogLevels(global string, subsystems map[string]string) error {
+	lvl, err := zapcore.ParseLevel(global)
+	if err != nil {
+		return fmt.Errorf("invalid log level %q: use debug, info, warn, error", global)
+	}
+	overrides := make(map[string]zapcore.Level, len(subsystems))
+	for name, level := range subsystems {
+		l, err := zapcore.ParseLevel(level)
+		if err != nil {
+			return fmt.Errorf("invalid log level %q for %s: use debug, info, warn, error", level, name)
+		}
+		overrides[strings.ToLower(strings.TrimSpace(name))] = l
+	}
+
+	logLevels.mu.Lock()
+	defer logLevels.mu.Unlock()
+	logLevels.global.SetLevel(lvl)
+	logLevels.subsystems = overrides
+	logLevels.recompute()
+	return nil
+}
+
+// GetLogLevel returns the global level.
+func GetLogLevel() zapcore.Level {
+	return logLevels.global.Level()
+}
+
+// LogLevels returns the global level and any subsystem overrides.
+func LogLevels() (string, map[string]string) {
+	logLevels.mu.RLock()
+	defer logLevels.mu.RUnlock()
+
+	overrides := make(map[string]string, len(logLevels.subsystems))
+	for name, lvl := range logLevels.subsystems {
+		overrides[name] = lvl.String()
+	}
+	return logLevels.global.Level().String(), overrides
+}
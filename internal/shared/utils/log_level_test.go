@@ -0,0 +1,56 @@
+package utils
+
+import (
+	"testing"
+
+	"go.uber.org/zap/zapcore"
+)
+
+func TestSubsystemLevels(t *testing.T) {
+	saved := logLevels
+	logLevels = newLevelRegistry(zapcore.InfoLevel)
+	defer func() { logLevels = saved }()
+
+	if err := SetLogLevel(SubsystemProtocol, "warn"); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetLogLevel(SubsystemAuth, "debug"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		want zapcore.Level
+	}{
+		{"", zapcore.InfoLevel},
+		{"proxy", zapcore.InfoLevel},
+		{"protocol", zapcore.WarnLevel},
+		{"protocol.auth", zapcore.DebugLevel},
+	}
+	for _, tt := range tests {
+		if got := logLevels.levelFor(tt.name); got != tt.want {
+			t.Errorf("levelFor(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+	if got := zapcore.Level(logLevels.min.Load()); got != zapcore.DebugLevel {
+		t.Errorf("min level = %v, want debug", got)
+	}
+
+	if err := SetLogLevel(SubsystemAuth, "reset"); err != nil {
+		t.Fatal(err)
+	}
+	if got := logLevels.levelFor("protocol.auth"); got != zapcore.WarnLevel {
+		t.Errorf("after reset levelFor(protocol.auth) = %v, want warn", got)
+	}
+	if err := SetLogLevel("", "verbose"); err == nil {
+		t.Error("SetLogLevel accepted an invalid level")
+	}
+
+	if err := ReplaceLogLevels("error", map[string]string{"Proxy": "debug"}); err != nil {
+		t.Fatal(err)
+	}
+	global, overrides := LogLevels()
+	if global != "error" || len(overrides) != 1 || overrides["proxy"] != "debug" {
+		t.Errorf("after ReplaceLogLevels: %s %v, want error and only proxy=debug", global, overrides)
+	}
+}
@@ -13,22 +13,24 @@ var logger *zap.Logger
 // verbose: if true, shows debug level logs; if false, shows error level only
 func InitLogger(verbose bool) error {
 	var config zap.Config
+	var level zapcore.Level
 
 	if verbose {
 		// Verbose mode: show debug and above
 		config = zap.NewDevelopmentConfig()
 		config.EncoderConfig.EncodeLevel = zapcore.CapitalColorLevelEncoder
+		level = zapcore.DebugLevel
 	} else {
 		// Production mode: only show errors
 		config = zap.NewProductionConfig()
-		config.Level = zap.NewAtomicLevelAt(zapcore.ErrorLevel)
+		level = zapcore.ErrorLevel
 	}
 
 	config.OutputPaths = []string{"stdout"}
 	config.ErrorOutputPaths = []string{"stderr"}
 
 	var err error
-	logger, err = config.Build()
+	logger, err = buildLogger(config, level)
 	if err != nil {
 		return err
 	}
@@ -39,11 +41,13 @@ func InitLogger(verbose bool) error {
 // InitServerLogger initializes logger for server with info level by default
 func InitServerLogger(debug bool) error {
 	var config zap.Config
+	level := zapcore.InfoLevel
 
 	if debug {
 		// Debug mode: show all logs
 		config = zap.NewDevelopmentConfig()
 		config.EncoderConfig.EncodeLevel = zapcore.CapitalColorLevelEncoder
+		level = zapcore.DebugLevel
 	} else {
 		// Production mode: show info and above
 		config = zap.NewProductionConfig()
@@ -53,7 +57,7 @@ func InitServerLogger(debug bool) error {
 	config.ErrorOutputPaths = []string{"stderr"}
 
 	var err error
-	logger, err = config.Build()
+	logger, err = buildLogger(config, level)
 	if err != nil {
 		return err
 	}
@@ -2,39 +2,100 @@ package utils
 
 import (
 	"crypto/rand"
+	"encoding/hex"
 	"math/big"
 	"regexp"
+	"slices"
+	"strings"
 )
 
+// Styles of generated subdomains, chosen by the server's --subdomain-style
+// and hinted by clients.
 const (
-	// SubdomainChars defines the allowed characters for subdomain generation
-	SubdomainChars = "abcdefghijklmnopqrstuvwxyz0123456789"
-	// DefaultSubdomainLength is the default length of generated subdomains
-	DefaultSubdomainLength = 6
+	SubdomainStyleHex    = "hex"    // random hex digits, e.g. 3f9a2c7e
+	SubdomainStyleWords  = "words"  // three words, e.g. calm-amber-otter
+	SubdomainStylePrefix = "prefix" // a user prefix and hex digits, e.g. alice-3f9a2c
 )
 
+// SubdomainStyles lists the known styles, the default first.
+var SubdomainStyles = []string{SubdomainStyleHex, SubdomainStyleWords, SubdomainStylePrefix}
+
+// MaxSubdomainPrefixLength leaves room in a DNS label for the random part
+// of a prefixed subdomain.
+const MaxSubdomainPrefixLength = 40
+
 var subdomainRegex = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{1,61}[a-z0-9]$`)
 
-// GenerateSubdomain generates a random subdomain
-func GenerateSubdomain(length int) string {
-	if length <= 0 {
-		length = DefaultSubdomainLength
-	}
+// IsSubdomainStyle reports whether style is one of SubdomainStyles.
+func IsSubdomainStyle(style string) bool {
+	return slices.Contains(SubdomainStyles, style)
+}
 
-	result := make([]byte, length)
-	charsLen := big.NewInt(int64(len(SubdomainChars)))
+// GenerateSubdomain generates a subdomain in style. prefix is only used by
+// SubdomainStylePrefix, which falls back to hex without one. long adds
+// randomness, for retries after collisions with existing tunnels.
+func GenerateSubdomain(style, prefix string, long bool) string {
+	switch style {
+	case SubdomainStyleWords:
+		name := strings.Join([]string{
+			pickWord(subdomainAdjectives),
+			pickWord(subdomainColors),
+			pickWord(subdomainNouns),
+		}, "-")
+		if long {
+			name += "-" + randomHex(4)
+		}
+		return name
+	case SubdomainStylePrefix:
+		if prefix != "" {
+			if long {
+				return prefix + "-" + randomHex(10)
+			}
+			return prefix + "-" + randomHex(6)
+		}
+	}
+	if long {
+		return randomHex(12)
+	}
+	return randomHex(8)
+}
 
-	for i := 0; i < length; i++ {
-		num, err := rand.Int(rand.Reader, charsLen)
-		if err != nil {
-			// Fallback to simple random if crypto/rand fails
-			result[i] = SubdomainChars[i%len(SubdomainChars)]
-			continue
+// SanitizeSubdomainPrefix turns s, e.g. a user name, into a prefix for
+// SubdomainStylePrefix: lower case letters, digits and single hyphens, at
+// most MaxSubdomainPrefixLength long. It returns "" if nothing is left.
+func SanitizeSubdomainPrefix(s string) string {
+	var b strings.Builder
+	hyphen := false
+	for _, r := range strings.ToLower(s) {
+		if ('a' <= r && r <= 'z') || ('0' <= r && r <= '9') {
+			b.WriteRune(r)
+			hyphen = false
+		} else if !hyphen && b.Len() > 0 {
+			b.WriteByte('-')
+			hyphen = true
+		}
+		if b.Len() >= MaxSubdomainPrefixLength {
+			break
 		}
-		result[i] = SubdomainChars[num.Int64()]
 	}
+	return strings.Trim(b.String(), "-")
+}
 
-	return string(result)
+func randomHex(n int) string {
+	buf := make([]byte, (n+1)/2)
+	if _, err := rand.Read(buf); err != nil {
+		// Unreachable on supported platforms; stay unique-ish regardless.
+		return strings.Repeat("0", n)
+	}
+	return hex.EncodeToString(buf)[:n]
+}
+
+func pickWord(words []string) string {
+	n, err := rand.Int(rand.Reader, big.NewInt(int64(len(words))))
+	if err != nil {
+		return words[0]
+	}
+	return words[n.Int64()]
 }
 
 // ValidateSubdomain checks if a subdomain is valid
@@ -45,22 +106,14 @@ func ValidateSubdomain(subdomain string) bool {
 	return subdomainRegex.MatchString(subdomain)
 }
 
-// IsReserved checks if a subdomain is reserved
+// ReservedSubdomains are kept for the server's own use unless the operator
+// drops the default denylist.
+var ReservedSubdomains = []string{
+	"www", "api", "admin", "app", "mail", "ftp", "blog", "shop",
+	"status", "health", "test", "dev", "staging",
+}
+
+// IsReserved checks if a subdomain is one of ReservedSubdomains
 func IsReserved(subdomain string) bool {
-	reserved := map[string]bool{
-		"www":     true,
-		"api":     true,
-		"admin":   true,
-		"app":     true,
-		"mail":    true,
-		"ftp":     true,
-		"blog":    true,
-		"shop":    true,
-		"status":  true,
-		"health":  true,
-		"test":    true,
-		"dev":     true,
-		"staging": true,
-	}
-	return reserved[subdomain]
+	return slices.Contains(ReservedSubdomains, subdomain)
 }
@@ -0,0 +1,56 @@
+package utils
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestGenerateSubdomain(t *testing.T) {
+	tests := []struct {
+		style  string
+		prefix string
+		long   bool
+		want   string
+	}{
+		{SubdomainStyleHex, "", false, `^[0-9a-f]{8}$`},
+		{SubdomainStyleHex, "", true, `^[0-9a-f]{12}$`},
+		{SubdomainStyleWords, "", false, `^[a-z]+-[a-z]+-[a-z]+$`},
+		{SubdomainStyleWords, "", true, `^[a-z]+-[a-z]+-[a-z]+-[0-9a-f]{4}$`},
+		{SubdomainStylePrefix, "alice", false, `^alice-[0-9a-f]{6}$`},
+		{SubdomainStylePrefix, "alice", true, `^alice-[0-9a-f]{10}$`},
+		{SubdomainStylePrefix, "", false, `^[0-9a-f]{8}$`},
+	}
+	for _, tt := range tests {
+		got := GenerateSubdomain(tt.style, tt.prefix, tt.long)
+		if !regexp.MustCompile(tt.want).MatchString(got) || !ValidateSubdomain(got) {
+			t.Errorf("GenerateSubdomain(%q, %q, %v) = %q, want a match for %s", tt.style, tt.prefix, tt.long, got, tt.want)
+		}
+	}
+
+	for _, list := range [][]string{subdomainAdjectives, subdomainColors, subdomainNouns} {
+		for _, word := range list {
+			if IsReserved(word) {
+				t.Errorf("word list contains reserved subdomain %q", word)
+			}
+		}
+	}
+}
+
+func TestSanitizeSubdomainPrefix(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"alice", "alice"},
+		{"Alice.Smith", "alice-smith"},
+		{"  --bob__42--  ", "bob-42"},
+		{"ünïcode", "n-code"},
+		{"...", ""},
+		{"abcdefghijklmnopqrstuvwxyzabcdefghijklmnopqrstuvwxyz", "abcdefghijklmnopqrstuvwxyzabcdefghijklmn"},
+	}
+	for _, tt := range tests {
+		if got := SanitizeSubdomainPrefix(tt.in); got != tt.want {
+			t.Errorf("SanitizeSubdomainPrefix(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package utils
+
+// Word lists for SubdomainStyleWords. They give 64 × 32 × 64 names; keep
+// them short, neutral and free of reserved subdomains.
+var (
+	subdomainAdjectives = []string{
+		"able", "bold", "brave", "brief", "bright", "brisk", "calm", "clean",
+		"clear", "clever", "cool", "cosy", "crisp", "curly", "daring", "eager",
+		"early", "easy", "fair", "fancy", "fast", "fine", "fresh", "gentle",
+		"glad", "grand", "happy", "hardy", "honest", "humble", "jolly", "keen",
+		"kind", "lively", "loyal", "lucky", "merry", "mighty", "modest", "neat",
+		"nimble", "noble", "patient", "plain", "polite", "proud", "quick", "quiet",
+		"rapid", "ready", "witty", "shiny", "silent", "simple", "sleek", "smart",
+		"snappy", "steady", "sunny", "swift", "tidy", "vivid", "warm", "wise",
+	}
+
+	subdomainColors = []string{
+		"amber", "azure", "beige", "black", "blue", "bronze", "brown", "copper",
+		"coral", "cream", "cyan", "gold", "green", "grey", "indigo", "ivory",
+		"jade", "khaki", "lemon", "lilac", "lime", "maroon", "mint", "navy",
+		"olive", "orange", "pearl", "pink", "plum", "ruby", "silver", "teal",
+	}
+
+	subdomainNouns = []string{
+		"badger", "beacon", "bear", "breeze", "brook", "canyon", "cedar", "cloud",
+		"comet", "coyote", "crane", "creek", "dolphin", "dune", "eagle", "falcon",
+		"fern", "finch", "fjord", "forest", "fox", "galaxy", "glacier", "harbor",
+		"hawk", "heron", "island", "koala", "lagoon", "lake", "lantern", "lark",
+		"lemur", "lynx", "maple", "meadow", "meteor", "moon", "moose", "nebula",
+		"oak", "ocean", "orca", "otter", "owl", "panda", "pebble", "pine",
+		"planet", "pond", "prairie", "rabbit", "raven", "reef", "river", "robin",
+		"salmon", "sparrow", "spruce", "summit", "tiger", "valley", "walrus", "willow",
+	}
+)
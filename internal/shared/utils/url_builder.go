@@ -2,6 +2,8 @@ package utils
 
 import (
 	"fmt"
+	"net"
+	"strconv"
 
 	"drip/internal/shared/protocol"
 )
@@ -25,12 +27,18 @@ func (b *TunnelURLBuilder) BuildHTTPURL(subdomain string) string {
 	if b.publicPort == 443 {
 		return fmt.Sprintf("https://%s.%s", subdomain, b.tunnelDomain)
 	}
-	return fmt.Sprintf("https://%s.%s:%d", subdomain, b.tunnelDomain, b.publicPort)
+	return "https://" + net.JoinHostPort(subdomain+"."+b.tunnelDomain, strconv.Itoa(b.publicPort))
 }
 
 // BuildTCPURL builds a TCP tunnel URL.
 func (b *TunnelURLBuilder) BuildTCPURL(port int) string {
-	return fmt.Sprintf("tcp://%s:%d", b.tunnelDomain, port)
+	return "tcp://" + net.JoinHostPort(b.tunnelDomain, strconv.Itoa(port))
+}
+
+// BuildTLSURL builds a TLS passthrough tunnel URL. Its port is always
+// given, as tls:// has no default.
+func (b *TunnelURLBuilder) BuildTLSURL(subdomain string) string {
+	return "tls://" + net.JoinHostPort(subdomain+"."+b.tunnelDomain, strconv.Itoa(b.publicPort))
 }
 
 // BuildURL builds a tunnel URL based on the tunnel type.
@@ -38,5 +46,8 @@ func (b *TunnelURLBuilder) BuildURL(subdomain string, tunnelType protocol.Tunnel
 	if tunnelType == protocol.TunnelTypeHTTP || tunnelType == protocol.TunnelTypeHTTPS {
 		return b.BuildHTTPURL(subdomain)
 	}
+	if tunnelType == protocol.TunnelTypeTLS {
+		return b.BuildTLSURL(subdomain)
+	}
 	return b.BuildTCPURL(port)
 }
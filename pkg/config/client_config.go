@@ -2,10 +2,14 @@ package config
 
 import (
 	"fmt"
+	"maps"
 	"net"
 	"os"
+	"path"
 	"path/filepath"
+	"slices"
 	"strings"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
@@ -13,7 +17,7 @@ import (
 // TunnelConfig holds configuration for a predefined tunnel
 type TunnelConfig struct {
 	Name       string   `yaml:"name"`                  // Tunnel name (required, unique identifier)
-	Type       string   `yaml:"type"`                  // Tunnel type: http, https, tcp (required)
+	Type       string   `yaml:"type"`                  // Tunnel type: http, https, tcp, tls (required)
 	Port       int      `yaml:"port"`                  // Local port to forward (required)
 	Address    string   `yaml:"address,omitempty"`     // Local address (default: 127.0.0.1)
 	Subdomain  string   `yaml:"subdomain,omitempty"`   // Custom subdomain
@@ -23,6 +27,104 @@ type TunnelConfig struct {
 	Auth       string   `yaml:"auth,omitempty"`        // Proxy authentication password (http/https only)
 	AuthBearer string   `yaml:"auth_bearer,omitempty"` // Proxy authentication bearer token (http/https only)
 	Bandwidth  string   `yaml:"bandwidth,omitempty"`   // Bandwidth limit (e.g., 1M, 500K, 1G)
+	Rate       string   `yaml:"rate,omitempty"`        // Cap on traffic in and out enforced by the client (e.g., 1MBps)
+
+	AllowCountries []string `yaml:"allow_countries,omitempty"` // Only allow visitors from these countries, e.g. US, DE (needs a server with a GeoIP database)
+	DenyCountries  []string `yaml:"deny_countries,omitempty"`  // Deny visitors from these countries
+
+	AlertBandwidth string `yaml:"alert_bandwidth,omitempty"` // Warn once a session's traffic passes this size, e.g. 1GB
+	AlertPause     bool   `yaml:"alert_pause,omitempty"`     // Also pause the tunnel when alert_bandwidth is reached
+
+	Backends    []string `yaml:"backends,omitempty"`     // More local addresses (<port|host:port>) to spread traffic over
+	Balance     string   `yaml:"balance,omitempty"`      // How traffic is spread over backends: round-robin (default), least-conn
+	HealthCheck string   `yaml:"health_check,omitempty"` // Path probed on each backend, e.g. /healthz (http/https only)
+	Shadow      string   `yaml:"shadow,omitempty"`       // Local <port|host:port> that gets a copy of every request (http/https only)
+	MaxInFlight int      `yaml:"max_inflight,omitempty"` // Most requests forwarded to the local service at once (http/https only)
+	MaxQueue    int      `yaml:"max_queue,omitempty"`    // Requests that may wait for max_inflight before 503s (default: 100)
+
+	Retries      int           `yaml:"retries,omitempty"`       // Retry a failed dial to the local service this many times
+	RetryBackoff time.Duration `yaml:"retry_backoff,omitempty"` // Wait before the first retry, doubled after each (default: 200ms)
+	RetryMethods []string      `yaml:"retry_methods,omitempty"` // HTTP methods retried (default: GET, HEAD, OPTIONS, PUT, DELETE)
+
+	ProxyProtocol bool          `yaml:"proxy_protocol,omitempty"` // Send PROXY protocol v2 headers to the local service (tcp only)
+	Rules         []string      `yaml:"rules,omitempty"`          // Request filtering rules, e.g. "deny path=/wp-admin" (http/https only)
+	VisitorRPS    float64       `yaml:"visitor_rps,omitempty"`    // Requests per second per visitor IP (http/https only)
+	VisitorBurst  int           `yaml:"visitor_burst,omitempty"`  // Burst size for visitor_rps
+	HSTS          time.Duration `yaml:"hsts,omitempty"`           // Have the server add Strict-Transport-Security with this max-age, e.g. 8760h (http/https only)
+	TLS13Only     bool          `yaml:"tls13_only,omitempty"`     // Have the server refuse visitors that cannot use TLS 1.3 (http/https only)
+	ClientCA      string        `yaml:"client_ca,omitempty"`      // Require visitor certificates issued by the CAs in this PEM bundle (http/https only)
+	SignSecret    string        `yaml:"sign_secret,omitempty"`    // Have the server sign request bodies with this secret in X-Drip-Signature (http/https only)
+	RequestStore  int           `yaml:"request_store,omitempty"`  // Have the server keep the last N requests for 'drip replay', also while the client is away (http/https only)
+	E2EKey        string        `yaml:"e2e_key,omitempty"`        // End-to-end encryption key shared with 'drip connect' consumers (tcp only)
+	P2P           bool          `yaml:"p2p,omitempty"`            // Allow direct peer-to-peer connections from consumers (tcp only)
+	Private       bool          `yaml:"private,omitempty"`        // No public port; reachable only with 'drip connect <name>' (tcp only)
+
+	MaxBody     string `yaml:"max_body,omitempty"`          // Have the server answer requests with larger bodies with a 413, e.g. 10M (http/https only)
+	MaxRespBody string `yaml:"max_response_body,omitempty"` // Answer local responses with larger bodies with a 502, e.g. 100M (http/https only)
+
+	CompressStreams bool          `yaml:"compress_streams,omitempty"`  // Compress SSE and other streaming responses on the way to the server (http/https only)
+	CacheTTL        time.Duration `yaml:"cache_ttl,omitempty"`         // Answer revalidations for unchanged responses locally, e.g. 30s (http/https only)
+	Hooks           []string      `yaml:"hooks,omitempty"`             // Shell commands run as middleware for every request and response (http/https only)
+	Mocks           []*MockConfig `yaml:"mocks,omitempty"`             // Routes answered by the client without contacting the local service (http/https only)
+	RewriteHost     bool          `yaml:"rewrite_host,omitempty"`      // Point redirects and cookie domains for the local address at the public URL (http/https only)
+	RewriteHTML     bool          `yaml:"rewrite_html,omitempty"`      // Also rewrite local links in HTML pages (http/https only)
+	CookieRewrite   []string      `yaml:"cookie_rewrite,omitempty"`    // Set-Cookie attributes to normalize: domain, secure, samesite=<lax|strict|none> (http/https only)
+	CORS            []string      `yaml:"cors,omitempty"`              // Origins allowed to call the tunnel cross-origin, "*" for any (http/https only)
+	LocalCA         string        `yaml:"local_ca,omitempty"`          // Verify the local service against the CAs in this PEM bundle (https only)
+	LocalPin        string        `yaml:"local_pin,omitempty"`         // Require this public key hash from the local service (https only)
+	LocalVerify     bool          `yaml:"local_verify,omitempty"`      // Verify the local service against the system CAs (https only)
+	LocalServerName string        `yaml:"local_server_name,omitempty"` // Host name sent to and verified for the local service (https only)
+	Notify          []string      `yaml:"notify,omitempty"`            // Chat webhooks told when the tunnel goes up or down, e.g. slack:https://hooks.slack.com/...
+	TTL             time.Duration `yaml:"ttl,omitempty"`               // Have the server close the tunnel after this long, e.g. 2h
+	Schedule        string        `yaml:"schedule,omitempty"`          // Only accept visitors in these windows, e.g. "Mon-Fri 09:00-18:00 Europe/Berlin"
+
+	Labels map[string]string `yaml:"labels,omitempty"` // key=value metadata shown by 'drip list' and the server's stats, e.g. team: payments
+}
+
+// MockConfig is a route the client answers itself, e.g. to demo an
+// endpoint the local service does not implement yet.
+type MockConfig struct {
+	Path     string            `yaml:"path"`                // Exact path or glob, e.g. /api/users/* (required)
+	Method   string            `yaml:"method,omitempty"`    // Only this method (default: any)
+	Status   int               `yaml:"status,omitempty"`    // Response status (default: 200)
+	Headers  map[string]string `yaml:"headers,omitempty"`   // Response headers
+	Body     string            `yaml:"body,omitempty"`      // Response body
+	BodyFile string            `yaml:"body_file,omitempty"` // Read the response body from this file instead
+	Delay    time.Duration     `yaml:"delay,omitempty"`     // Wait this long before answering, e.g. 300ms
+}
+
+// isCountryCode reports whether code looks like an ISO 3166-1 alpha-2
+// country code.
+func isCountryCode(code string) bool {
+	if len(code) != 2 {
+		return false
+	}
+	for _, c := range code {
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z') {
+			return false
+		}
+	}
+	return true
+}
+
+// Validate checks if the mock is valid
+func (m *MockConfig) Validate() error {
+	if !strings.HasPrefix(m.Path, "/") {
+		return fmt.Errorf("mock path %q must start with /", m.Path)
+	}
+	if _, err := path.Match(m.Path, "/"); err != nil {
+		return fmt.Errorf("invalid mock path %q: %w", m.Path, err)
+	}
+	if m.Status != 0 && (m.Status < 100 || m.Status > 599) {
+		return fmt.Errorf("invalid status %d for mock %s", m.Status, m.Path)
+	}
+	if m.Body != "" && m.BodyFile != "" {
+		return fmt.Errorf("only one of body or body_file can be set for mock %s", m.Path)
+	}
+	if m.Delay < 0 {
+		return fmt.Errorf("delay must not be negative for mock %s", m.Path)
+	}
+	return nil
 }
 
 // Validate checks if the tunnel configuration is valid
@@ -34,9 +136,10 @@ func (t *TunnelConfig) Validate() error {
 		return fmt.Errorf("tunnel type is required for '%s'", t.Name)
 	}
 	t.Type = strings.ToLower(t.Type)
-	if t.Type != "http" && t.Type != "https" && t.Type != "tcp" {
-		return fmt.Errorf("invalid tunnel type '%s' for '%s': must be http, https, or tcp", t.Type, t.Name)
+	if t.Type != "http" && t.Type != "https" && t.Type != "tcp" && t.Type != "tls" {
+		return fmt.Errorf("invalid tunnel type '%s' for '%s': must be http, https, tcp, or tls", t.Type, t.Name)
 	}
+	isHTTP := t.Type == "http" || t.Type == "https"
 	if t.Port < 1 || t.Port > 65535 {
 		return fmt.Errorf("invalid port %d for '%s': must be between 1 and 65535", t.Port, t.Name)
 	}
@@ -46,6 +149,130 @@ func (t *TunnelConfig) Validate() error {
 			return fmt.Errorf("invalid transport '%s' for '%s': must be auto, tcp, or wss", t.Transport, t.Name)
 		}
 	}
+	if t.Balance != "" && t.Balance != "round-robin" && t.Balance != "least-conn" {
+		return fmt.Errorf("invalid balance '%s' for '%s': must be round-robin or least-conn", t.Balance, t.Name)
+	}
+	if t.HealthCheck != "" {
+		if !isHTTP {
+			return fmt.Errorf("health_check is only supported for http and https tunnels ('%s')", t.Name)
+		}
+		if !strings.HasPrefix(t.HealthCheck, "/") {
+			return fmt.Errorf("health_check for '%s' must be a path starting with /", t.Name)
+		}
+	}
+	if t.MaxInFlight < 0 || t.MaxQueue < 0 {
+		return fmt.Errorf("max_inflight and max_queue must not be negative for '%s'", t.Name)
+	}
+	if t.MaxInFlight > 0 && !isHTTP {
+		return fmt.Errorf("max_inflight is only supported for http and https tunnels ('%s')", t.Name)
+	}
+	if t.Retries < 0 || t.RetryBackoff < 0 {
+		return fmt.Errorf("retries and retry_backoff must not be negative for '%s'", t.Name)
+	}
+	if len(t.RetryMethods) > 0 && !isHTTP {
+		return fmt.Errorf("retry_methods is only supported for http and https tunnels ('%s')", t.Name)
+	}
+	if t.Shadow != "" && !isHTTP {
+		return fmt.Errorf("shadow is only supported for http and https tunnels ('%s')", t.Name)
+	}
+	if t.ProxyProtocol && t.Type != "tcp" && t.Type != "tls" {
+		return fmt.Errorf("proxy_protocol is only supported for tcp and tls tunnels ('%s')", t.Name)
+	}
+	if len(t.Rules) > 0 && !isHTTP {
+		return fmt.Errorf("rules are only supported for http and https tunnels ('%s')", t.Name)
+	}
+	if t.VisitorRPS < 0 || t.VisitorBurst < 0 {
+		return fmt.Errorf("visitor_rps and visitor_burst must not be negative for '%s'", t.Name)
+	}
+	if t.VisitorRPS > 0 && !isHTTP {
+		return fmt.Errorf("visitor_rps is only supported for http and https tunnels ('%s')", t.Name)
+	}
+	if t.HSTS < 0 {
+		return fmt.Errorf("hsts must not be negative for '%s'", t.Name)
+	}
+	if (t.HSTS > 0 || t.TLS13Only || t.ClientCA != "") && !isHTTP {
+		return fmt.Errorf("hsts, tls13_only and client_ca are only supported for http and https tunnels ('%s')", t.Name)
+	}
+	if t.SignSecret != "" && !isHTTP {
+		return fmt.Errorf("sign_secret is only supported for http and https tunnels ('%s')", t.Name)
+	}
+	if t.SignSecret != "" && len(t.SignSecret) < 16 {
+		return fmt.Errorf("sign_secret must be at least 16 characters for '%s'", t.Name)
+	}
+	if t.RequestStore != 0 && !isHTTP {
+		return fmt.Errorf("request_store is only supported for http and https tunnels ('%s')", t.Name)
+	}
+	if (t.MaxBody != "" || t.MaxRespBody != "") && !isHTTP {
+		return fmt.Errorf("max_body and max_response_body are only supported for http and https tunnels ('%s')", t.Name)
+	}
+	if t.RequestStore < 0 || t.RequestStore > 100 {
+		return fmt.Errorf("request_store must be between 0 and 100 for '%s'", t.Name)
+	}
+	if t.CacheTTL < 0 {
+		return fmt.Errorf("cache_ttl must not be negative for '%s'", t.Name)
+	}
+	if t.CacheTTL > 0 && !isHTTP {
+		return fmt.Errorf("cache_ttl is only supported for http and https tunnels ('%s')", t.Name)
+	}
+	if t.TTL < 0 {
+		return fmt.Errorf("ttl must not be negative for '%s'", t.Name)
+	}
+	if len(t.Hooks) > 0 && !isHTTP {
+		return fmt.Errorf("hooks are only supported for http and https tunnels ('%s')", t.Name)
+	}
+	if (t.LocalCA != "" || t.LocalPin != "" || t.LocalVerify || t.LocalServerName != "") && t.Type != "https" {
+		return fmt.Errorf("local_ca, local_pin, local_verify and local_server_name are only supported for https tunnels ('%s')", t.Name)
+	}
+	if len(t.CORS) > 0 && !isHTTP {
+		return fmt.Errorf("cors is only supported for http and https tunnels ('%s')", t.Name)
+	}
+	if (t.RewriteHost || t.RewriteHTML || len(t.CookieRewrite) > 0) && !isHTTP {
+		return fmt.Errorf("rewrite_host, rewrite_html and cookie_rewrite are only supported for http and https tunnels ('%s')", t.Name)
+	}
+	if len(t.Mocks) > 0 && !isHTTP {
+		return fmt.Errorf("mocks are only supported for http and https tunnels ('%s')", t.Name)
+	}
+	for _, m := range t.Mocks {
+		if m == nil {
+			return fmt.Errorf("empty mock for '%s'", t.Name)
+		}
+		if err := m.Validate(); err != nil {
+			return fmt.Errorf("%w ('%s')", err, t.Name)
+		}
+	}
+	for _, code := range slices.Concat(t.AllowCountries, t.DenyCountries) {
+		if !isCountryCode(code) {
+			return fmt.Errorf("invalid country code %q for '%s', expected two letters such as US", code, t.Name)
+		}
+	}
+	if t.AlertPause && t.AlertBandwidth == "" {
+		return fmt.Errorf("alert_pause needs alert_bandwidth ('%s')", t.Name)
+	}
+	if t.CompressStreams && !isHTTP {
+		return fmt.Errorf("compress_streams is only supported for http and https tunnels ('%s')", t.Name)
+	}
+	if t.P2P && t.Type != "tcp" {
+		return fmt.Errorf("p2p is only supported for tcp tunnels ('%s')", t.Name)
+	}
+	if t.Private {
+		if t.Type != "tcp" {
+			return fmt.Errorf("private is only supported for tcp tunnels ('%s')", t.Name)
+		}
+		if t.P2P {
+			return fmt.Errorf("private cannot be combined with p2p ('%s')", t.Name)
+		}
+	}
+	if t.E2EKey != "" {
+		if t.Type != "tcp" {
+			return fmt.Errorf("e2e_key is only supported for tcp tunnels ('%s')", t.Name)
+		}
+		if t.ProxyProtocol {
+			return fmt.Errorf("e2e_key cannot be combined with proxy_protocol ('%s')", t.Name)
+		}
+		if len(t.E2EKey) < 16 {
+			return fmt.Errorf("e2e_key for '%s' must be at least 16 characters", t.Name)
+		}
+	}
 	if t.Auth != "" && t.AuthBearer != "" {
 		return fmt.Errorf("only one of auth or auth_bearer can be set for '%s'", t.Name)
 	}
@@ -54,24 +281,116 @@ func (t *TunnelConfig) Validate() error {
 
 // ClientConfig represents the client configuration
 type ClientConfig struct {
-	Server  string          `yaml:"server"`            // Server address (e.g., tunnel.example.com:443)
-	Token   string          `yaml:"token"`             // Authentication token
-	TLS     bool            `yaml:"tls"`               // Use TLS (always true for production)
+	Server  string    `yaml:"server"`            // Server address (e.g., tunnel.example.com:443)
+	Token   string    `yaml:"token"`             // Authentication token
+	TLS     bool      `yaml:"tls"`               // Use TLS (always true for production)
+	Regions []*Region `yaml:"regions,omitempty"` // Servers of one deployment in several regions; the closest is used
+
+	ServerFingerprint string `yaml:"server_fingerprint,omitempty"` // Pinned server SPKI hash (sha256/<base64>)
+	TokenStore        string `yaml:"token_store,omitempty"`        // "keychain" to read tokens missing here from the system credential store
+	Proxy             string `yaml:"proxy,omitempty"`              // Proxy to reach the server through, or "direct"
+	ProxyPAC          string `yaml:"proxy_pac,omitempty"`          // Proxy auto-config file URL or path
+
 	Tunnels []*TunnelConfig `yaml:"tunnels,omitempty"` // Predefined tunnels
+
+	Profile  string              `yaml:"profile,omitempty"`  // Profile used when --profile is not given
+	Profiles map[string]*Profile `yaml:"profiles,omitempty"` // Named server settings, e.g. staging or self-hosted
+}
+
+// Region is one server of a deployment that runs in several regions. The
+// token and server fingerprint are shared by all regions.
+type Region struct {
+	Name   string `yaml:"name"`   // Region name used with --region (e.g., eu, us-east)
+	Server string `yaml:"server"` // Server address (e.g., eu.tunnel.example.com:443)
+}
+
+// TokenStoreKeychain marks tokens kept in the system credential store,
+// filed under the server address, instead of in the config file.
+const TokenStoreKeychain = "keychain"
+
+// DefaultProfile names the top-level server settings in 'drip profile' and
+// --profile.
+const DefaultProfile = "default"
+
+// Profile holds the server settings and tunnels used with --profile.
+type Profile struct {
+	Server            string    `yaml:"server"`                       // Server address (e.g., staging.example.com:443)
+	Token             string    `yaml:"token,omitempty"`              // Authentication token
+	ServerFingerprint string    `yaml:"server_fingerprint,omitempty"` // Pinned server SPKI hash (sha256/<base64>)
+	Regions           []*Region `yaml:"regions,omitempty"`            // Servers in several regions; the closest is used
+
+	Tunnels []*TunnelConfig `yaml:"tunnels,omitempty"` // Added to the top-level tunnels, replacing any with the same name
 }
 
 // Validate checks if the client configuration is valid
 func (c *ClientConfig) Validate() error {
-	if c.Server == "" {
+	// A config with profiles or regions may leave the top-level server unset.
+	if c.Server != "" || (len(c.Profiles) == 0 && len(c.Regions) == 0) {
+		if err := validateServerAddr(c.Server); err != nil {
+			return err
+		}
+	}
+	if err := validateRegions(c.Regions); err != nil {
+		return err
+	}
+
+	if c.ServerFingerprint != "" {
+		if _, err := ParseFingerprint(c.ServerFingerprint); err != nil {
+			return err
+		}
+	}
+
+	if c.TokenStore != "" && c.TokenStore != TokenStoreKeychain {
+		return fmt.Errorf("invalid token_store '%s': must be %s or empty", c.TokenStore, TokenStoreKeychain)
+	}
+
+	if err := validateTunnels(c.Tunnels); err != nil {
+		return err
+	}
+
+	for name, p := range c.Profiles {
+		if name == "" || name == DefaultProfile {
+			return fmt.Errorf("invalid profile name %q", name)
+		}
+		if p == nil {
+			return fmt.Errorf("profile '%s' is empty", name)
+		}
+		if p.Server != "" || len(p.Regions) == 0 {
+			if err := validateServerAddr(p.Server); err != nil {
+				return fmt.Errorf("profile '%s': %w", name, err)
+			}
+		}
+		if err := validateRegions(p.Regions); err != nil {
+			return fmt.Errorf("profile '%s': %w", name, err)
+		}
+		if p.ServerFingerprint != "" {
+			if _, err := ParseFingerprint(p.ServerFingerprint); err != nil {
+				return fmt.Errorf("profile '%s': %w", name, err)
+			}
+		}
+		if err := validateTunnels(p.Tunnels); err != nil {
+			return fmt.Errorf("profile '%s': %w", name, err)
+		}
+	}
+
+	if c.Profile != "" && c.Profile != DefaultProfile && c.Profiles[c.Profile] == nil {
+		return fmt.Errorf("current profile '%s' is not defined", c.Profile)
+	}
+
+	return nil
+}
+
+func validateServerAddr(addr string) error {
+	if addr == "" {
 		return fmt.Errorf("server address is required")
 	}
 
-	host, port, err := net.SplitHostPort(c.Server)
+	host, port, err := net.SplitHostPort(addr)
 	if err != nil {
 		if strings.Contains(err.Error(), "missing port") {
-			return fmt.Errorf("server address must include port (e.g., example.com:443), got: %s", c.Server)
+			return fmt.Errorf("server address must include port (e.g., example.com:443), got: %s", addr)
 		}
-		return fmt.Errorf("invalid server address format: %s (expected host:port)", c.Server)
+		return fmt.Errorf("invalid server address format: %s (expected host:port)", addr)
 	}
 
 	if host == "" {
@@ -82,9 +401,31 @@ func (c *ClientConfig) Validate() error {
 		return fmt.Errorf("server port is required")
 	}
 
-	// Validate tunnels and check for duplicate names
+	return nil
+}
+
+// validateRegions checks that regions have unique names and valid servers.
+func validateRegions(regions []*Region) error {
 	names := make(map[string]bool)
-	for _, t := range c.Tunnels {
+	for _, r := range regions {
+		if r == nil || r.Name == "" {
+			return fmt.Errorf("region name is required")
+		}
+		if names[r.Name] {
+			return fmt.Errorf("duplicate region name: %s", r.Name)
+		}
+		names[r.Name] = true
+		if err := validateServerAddr(r.Server); err != nil {
+			return fmt.Errorf("region '%s': %w", r.Name, err)
+		}
+	}
+	return nil
+}
+
+// validateTunnels validates each tunnel and checks for duplicate names
+func validateTunnels(tunnels []*TunnelConfig) error {
+	names := make(map[string]bool)
+	for _, t := range tunnels {
 		if err := t.Validate(); err != nil {
 			return err
 		}
@@ -93,10 +434,61 @@ func (c *ClientConfig) Validate() error {
 		}
 		names[t.Name] = true
 	}
-
 	return nil
 }
 
+// WithProfile returns the configuration as seen under profile name: its
+// server settings replace the top-level ones and its tunnels are merged in.
+// An empty name selects the current profile. Without a server of its own, a
+// configuration with regions uses the first region's server, which is also
+// where a keychain token is filed.
+func (c *ClientConfig) WithProfile(name string) (*ClientConfig, error) {
+	if name == "" {
+		name = c.Profile
+	}
+	if name == "" || name == DefaultProfile {
+		if c.Server == "" && len(c.Regions) == 0 {
+			return nil, fmt.Errorf("no default server configured; use --profile (available: %s)", strings.Join(c.ProfileNames(), ", "))
+		}
+		resolved := *c
+		resolved.Profile = DefaultProfile
+		resolved.defaultServerFromRegions()
+		return &resolved, nil
+	}
+
+	p := c.Profiles[name]
+	if p == nil {
+		return nil, fmt.Errorf("profile '%s' not found", name)
+	}
+
+	resolved := *c
+	resolved.Profile = name
+	resolved.Server = p.Server
+	resolved.Token = p.Token
+	resolved.ServerFingerprint = p.ServerFingerprint
+	resolved.Regions = p.Regions
+	resolved.defaultServerFromRegions()
+	resolved.Tunnels = nil
+	for _, t := range c.Tunnels {
+		if !slices.ContainsFunc(p.Tunnels, func(pt *TunnelConfig) bool { return pt.Name == t.Name }) {
+			resolved.Tunnels = append(resolved.Tunnels, t)
+		}
+	}
+	resolved.Tunnels = append(resolved.Tunnels, p.Tunnels...)
+	return &resolved, nil
+}
+
+func (c *ClientConfig) defaultServerFromRegions() {
+	if c.Server == "" && len(c.Regions) > 0 {
+		c.Server = c.Regions[0].Server
+	}
+}
+
+// ProfileNames returns the defined profile names, sorted.
+func (c *ClientConfig) ProfileNames() []string {
+	return slices.Sorted(maps.Keys(c.Profiles))
+}
+
 // GetTunnel returns a tunnel by name
 func (c *ClientConfig) GetTunnel(name string) *TunnelConfig {
 	for _, t := range c.Tunnels {
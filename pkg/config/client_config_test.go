@@ -0,0 +1,100 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestClientConfigWithProfile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	data := `
+server: tunnel.example.com:443
+token: default-token
+server_fingerprint: sha256/47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU=
+tunnels:
+  - name: web
+    type: http
+    port: 3000
+  - name: db
+    type: tcp
+    port: 5432
+profile: staging
+profiles:
+  staging:
+    server: staging.internal:8443
+    token: staging-token
+    tunnels:
+      - name: web
+        type: http
+        port: 4000
+`
+	if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := LoadClientConfig(path)
+	if err != nil {
+		t.Fatalf("LoadClientConfig() error = %v", err)
+	}
+
+	tests := []struct {
+		profile     string
+		wantServer  string
+		wantToken   string
+		wantPin     bool
+		wantWebPort int
+		wantErr     bool
+	}{
+		{"", "staging.internal:8443", "staging-token", false, 4000, false},
+		{"staging", "staging.internal:8443", "staging-token", false, 4000, false},
+		{"default", "tunnel.example.com:443", "default-token", true, 3000, false},
+		{"prod", "", "", false, 0, true},
+	}
+
+	for _, tt := range tests {
+		got, err := cfg.WithProfile(tt.profile)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("WithProfile(%q) error = %v, wantErr %v", tt.profile, err, tt.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if got.Server != tt.wantServer || got.Token != tt.wantToken || (got.ServerFingerprint != "") != tt.wantPin {
+			t.Errorf("WithProfile(%q) = %s %s pin=%q", tt.profile, got.Server, got.Token, got.ServerFingerprint)
+		}
+		if web := got.GetTunnel("web"); web == nil || web.Port != tt.wantWebPort {
+			t.Errorf("WithProfile(%q) web tunnel = %+v, want port %d", tt.profile, web, tt.wantWebPort)
+		}
+		if got.GetTunnel("db") == nil {
+			t.Errorf("WithProfile(%q) lost the top-level db tunnel", tt.profile)
+		}
+	}
+
+	if len(cfg.Tunnels) != 2 || cfg.GetTunnel("web").Port != 3000 {
+		t.Error("WithProfile() modified the loaded config")
+	}
+}
+
+func TestClientConfigProfileValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     ClientConfig
+		wantErr bool
+	}{
+		{"profiles only", ClientConfig{Profiles: map[string]*Profile{"a": {Server: "a.example.com:443"}}}, false},
+		{"no server at all", ClientConfig{}, true},
+		{"profile without port", ClientConfig{Profiles: map[string]*Profile{"a": {Server: "a.example.com"}}}, true},
+		{"reserved name", ClientConfig{Profiles: map[string]*Profile{"default": {Server: "a.example.com:443"}}}, true},
+		{"unknown current", ClientConfig{Server: "x.example.com:443", Profile: "b"}, true},
+		{"regions only", ClientConfig{Regions: []*Region{{Name: "eu", Server: "eu.example.com:443"}, {Name: "us", Server: "us.example.com:443"}}}, false},
+		{"duplicate region", ClientConfig{Regions: []*Region{{Name: "eu", Server: "eu.example.com:443"}, {Name: "eu", Server: "eu2.example.com:443"}}}, true},
+		{"region without port", ClientConfig{Regions: []*Region{{Name: "eu", Server: "eu.example.com"}}}, true},
+		{"profile regions", ClientConfig{Profiles: map[string]*Profile{"a": {Regions: []*Region{{Name: "eu", Server: "eu.example.com:443"}}}}}, false},
+	}
+	for _, tt := range tests {
+		if err := tt.cfg.Validate(); (err != nil) != tt.wantErr {
+			t.Errorf("%s: Validate() error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
@@ -17,34 +18,159 @@ type ServerConfig struct {
 	Domain       string `yaml:"domain"`        // Domain for client connections (e.g., connect.example.com)
 	TunnelDomain string `yaml:"tunnel_domain"` // Domain for tunnel URLs (e.g., example.com for *.example.com)
 
+	// How subdomains are generated for tunnels without one: hex, words or
+	// prefix (a client-supplied prefix and hex digits). Clients may ask for
+	// another style.
+	SubdomainStyle string `yaml:"subdomain_style,omitempty"`
+
+	// Subdomains refused besides the built-in reserved names (www, api,
+	// admin, mail, ...) and profanity list
+	ReservedSubdomains    []string `yaml:"reserved_subdomains,omitempty"`     // Refused as whole names
+	BlockedSubdomainWords []string `yaml:"blocked_subdomain_words,omitempty"` // Refused as any hyphen-separated part of a name
+	NoDefaultDenylist     bool     `yaml:"no_default_denylist,omitempty"`     // Drop the built-in lists
+
 	// TCP tunnel dynamic port allocation
-	TCPPortMin int `yaml:"tcp_port_min"`
-	TCPPortMax int `yaml:"tcp_port_max"`
+	TCPPortMin     int               `yaml:"tcp_port_min"`
+	TCPPortMax     int               `yaml:"tcp_port_max"`
+	TCPPortRanges  []PortRangeConfig `yaml:"tcp_port_ranges,omitempty"`  // Extra named ranges, e.g. low ports for some tokens
+	TCPPortExclude []string          `yaml:"tcp_port_exclude,omitempty"` // Ports or ranges never allocated, e.g. 5432 or 6000-6010
+	TCPBind        []string          `yaml:"tcp_bind,omitempty"`         // IPs TCP tunnel ports listen on, "*" for dual-stack (default: 0.0.0.0)
 
 	// TLS settings
 	TLSEnabled  bool   `yaml:"tls_enabled"`
 	TLSCertFile string `yaml:"tls_cert"`
 	TLSKeyFile  string `yaml:"tls_key"`
 
+	// TLS tuning
+	TLSAllowTLS12     bool          `yaml:"tls_allow_tls12,omitempty"`     // Accept TLS 1.2 from old clients (default: TLS 1.3 only)
+	TLSCurves         []string      `yaml:"tls_curves,omitempty"`          // Key exchange preference, e.g. X25519,P256
+	TLSALPN           []string      `yaml:"tls_alpn,omitempty"`            // HTTP protocols offered to visitors (default: h2, http/1.1); clients always get drip/1
+	TLSTicketRotation time.Duration `yaml:"tls_ticket_rotation,omitempty"` // Session ticket key rotation interval (0 = Go default)
+	TLSDisableTickets bool          `yaml:"tls_disable_tickets,omitempty"` // Disable session resumption entirely
+
+	// Serve visitors over HTTP/3 (QUIC) on the server port in UDP too
+	HTTP3 bool `yaml:"http3,omitempty"`
+
 	// Security
 	AuthToken    string `yaml:"token"`
 	MetricsToken string `yaml:"metrics_token"`
 
 	// Logging
-	Debug bool `yaml:"debug"`
+	Debug     bool              `yaml:"debug"`
+	LogLevel  string            `yaml:"log_level,omitempty"`  // debug, info, warn or error (default: info, or debug with Debug)
+	LogLevels map[string]string `yaml:"log_levels,omitempty"` // Per subsystem (protocol, proxy, auth), overriding LogLevel
 
 	// Performance
 	PprofPort int `yaml:"pprof_port"`
 
+	// Address for /healthz and /readyz probes, e.g. ":9090" (empty = disabled)
+	AdminAddr string `yaml:"admin_addr,omitempty"`
+
+	// Connection worker pool (0 = derive from CPU count)
+	WorkerMin      int    `yaml:"worker_min,omitempty"`      // Workers kept running when idle
+	WorkerMax      int    `yaml:"worker_max,omitempty"`      // Upper bound when autoscaling
+	WorkerQueue    int    `yaml:"worker_queue,omitempty"`    // Connections waiting for a worker
+	WorkerOverload string `yaml:"worker_overload,omitempty"` // When saturated: spawn, block or reject
+
+	// Directory for all state the server writes: the SSH host key, panic
+	// stacks and relative audit log paths go here instead of ~/.drip
+	DataDir string `yaml:"data_dir,omitempty"`
+
+	// Directory for recovered panic stacks (default: ~/.drip/crashes, "none" disables)
+	CrashDir string `yaml:"crash_dir,omitempty"`
+
 	// Allowed transports: "tcp", "wss", or "tcp,wss" (default: "tcp,wss")
 	AllowedTransports []string `yaml:"transports"`
 
-	// Allowed tunnel types: "http", "https", "tcp" (default: all)
+	// Allowed tunnel types: "http", "https", "tcp", "tls" (default: all)
 	AllowedTunnelTypes []string `yaml:"tunnel_types"`
 
 	// Bandwidth limiting
 	Bandwidth       string  `yaml:"bandwidth,omitempty"`
 	BurstMultiplier float64 `yaml:"burst_multiplier,omitempty"`
+
+	// Memory budget for buffered visitor traffic, e.g. 2G ("" or "0" = unlimited)
+	MemLimit     string `yaml:"mem_limit,omitempty"`
+	MemPerTunnel string `yaml:"mem_per_tunnel,omitempty"`
+
+	// Largest request or response header block accepted from visitors and tunnels, e.g. 64K
+	MaxHeaderListSize string `yaml:"max_header_list_size,omitempty"`
+
+	// Largest request body forwarded to a tunnel, e.g. 10M; larger requests get a 413 ("" or "0" = unlimited)
+	MaxRequestBody string `yaml:"max_request_body,omitempty"`
+
+	// Require PROXY protocol (v1/v2) headers from an upstream L4 load balancer
+	ProxyProtocol bool `yaml:"proxy_protocol,omitempty"`
+
+	// Coordinate direct peer-to-peer connections for TCP tunnels
+	P2P bool `yaml:"p2p,omitempty"`
+
+	// Tunnels opened with plain OpenSSH remote forwarding (ssh -R)
+	SSHPort           int    `yaml:"ssh_port,omitempty"`            // Port of the SSH frontend (0 = disabled)
+	SSHHostKey        string `yaml:"ssh_host_key,omitempty"`        // Host private key, created if missing (default: ~/.drip/ssh_host_ed25519_key)
+	SSHAuthorizedKeys string `yaml:"ssh_authorized_keys,omitempty"` // authorized_keys file whose keys need no token
+
+	// Automatic temporary bans for IPs with repeated handshake/protocol failures
+	BanThreshold   int           `yaml:"ban_threshold,omitempty"`    // Failures per minute before a ban (0 = disabled)
+	BanDuration    time.Duration `yaml:"ban_duration,omitempty"`     // First ban length, doubled on each repeat
+	MaxBanDuration time.Duration `yaml:"max_ban_duration,omitempty"` // Upper bound for ban length
+
+	// IPs or CIDR ranges always refused at accept, e.g. 203.0.113.7 or 198.51.100.0/24
+	BannedIPs []string `yaml:"banned_ips,omitempty"`
+
+	// Append-only trail of registrations, auth failures, admin changes, bans and quota refusals
+	AuditLog   string `yaml:"audit_log,omitempty"`   // JSON lines file (empty = disabled)
+	AuditChain bool   `yaml:"audit_chain,omitempty"` // Link events with SHA-256 hashes so edits can be detected
+
+	// MaxMind DB file for visitor countries in metrics, the X-Drip-Country
+	// header and per-tunnel country allow/deny lists
+	GeoIPDB string `yaml:"geoip_db,omitempty"`
+
+	// Connection flood protection at accept (0 = unlimited)
+	MaxConnections int `yaml:"max_connections,omitempty"` // Connections handled at once
+	AcceptRate     int `yaml:"accept_rate,omitempty"`     // New connections per second
+	AcceptBurst    int `yaml:"accept_burst,omitempty"`    // Burst above AcceptRate (default: AcceptRate)
+
+	// Slow client protection on the public HTTP and TCP ports
+	HeaderTimeout       time.Duration `yaml:"header_timeout,omitempty"`         // Time visitors have to send request headers (default: 10s)
+	MinTransferRate     string        `yaml:"min_transfer_rate,omitempty"`      // Slowest request body upload per second after HeaderTimeout, e.g. 1K (empty = fixed 30s read timeout)
+	MaxConnectionsPerIP int           `yaml:"max_connections_per_ip,omitempty"` // Connections one IP holds open at once, tunnel clients included (0 = unlimited)
+
+	// Fair sharing between client tokens on multi-tenant servers (0 = unlimited)
+	MaxTunnelsPerToken int     `yaml:"max_tunnels_per_token,omitempty"` // Tunnels open at once
+	TokenPortShare     float64 `yaml:"token_port_share,omitempty"`      // Share (0-1) of each TCP port range
+	TokenBandwidth     string  `yaml:"token_bandwidth,omitempty"`       // Shared by all tunnels of a token, e.g. 10M
+
+	// Clients older than this release are asked to upgrade, e.g. v0.9.0 (empty = any)
+	MinClientVersion string `yaml:"min_client_version,omitempty"`
+	UpgradeURL       string `yaml:"upgrade_url,omitempty"` // Download page shown to those clients
+
+	// External webhook consulted on tunnel events (register, request, disconnect)
+	HookURL    string   `yaml:"hook_url,omitempty"`
+	HookToken  string   `yaml:"hook_token,omitempty"`
+	HookEvents []string `yaml:"hook_events,omitempty"`
+
+	// Servers that serve each other's HTTP tunnels under their own domains
+	FederationPeers    []string `yaml:"federation_peers,omitempty"`    // Base URLs of the other servers, e.g. https://eu.example.com
+	FederationToken    string   `yaml:"federation_token,omitempty"`    // Shared by every server in the federation
+	FederationInsecure bool     `yaml:"federation_insecure,omitempty"` // Skip TLS verification of peers (testing only)
+
+	// DNS records kept for each tunnel hostname, for tunnel domains without a wildcard record
+	DNSProvider string        `yaml:"dns_provider,omitempty"` // cloudflare, route53 or rfc2136 (empty = disabled)
+	DNSZone     string        `yaml:"dns_zone,omitempty"`     // Zone ID or name (default: found from the tunnel domain)
+	DNSTarget   string        `yaml:"dns_target,omitempty"`   // IPs for A/AAAA records or a hostname for a CNAME (default: the server domain)
+	DNSTTL      time.Duration `yaml:"dns_ttl,omitempty"`      // TTL of the records (default: 1m)
+	DNSServer   string        `yaml:"dns_server,omitempty"`   // Name server taking rfc2136 updates
+	DNSToken    string        `yaml:"dns_token,omitempty"`    // Cloudflare API token, or rfc2136 TSIG key as [algorithm:]name:secret
+}
+
+// PortRangeConfig is a named TCP port range. Tunnels authenticated with
+// one of Tokens allocate their port from it instead of the default range.
+type PortRangeConfig struct {
+	Name   string   `yaml:"name"`
+	Min    int      `yaml:"min"`
+	Max    int      `yaml:"max"`
+	Tokens []string `yaml:"tokens,omitempty"`
 }
 
 // Validate checks if the server configuration is valid
@@ -82,6 +208,80 @@ func (c *ServerConfig) Validate() error {
 	if c.TCPPortMin >= c.TCPPortMax {
 		return fmt.Errorf("TCPPortMin (%d) must be less than TCPPortMax (%d)", c.TCPPortMin, c.TCPPortMax)
 	}
+	seen := map[string]bool{"default": true}
+	for _, r := range c.TCPPortRanges {
+		if r.Name == "" || seen[r.Name] {
+			return fmt.Errorf("TCP port ranges need unique names other than \"default\", got %q", r.Name)
+		}
+		seen[r.Name] = true
+		if r.Min < 1 || r.Max > 65535 || r.Min > r.Max {
+			return fmt.Errorf("invalid TCP port range %s: %d-%d", r.Name, r.Min, r.Max)
+		}
+	}
+
+	if c.WorkerMin < 0 || c.WorkerMax < 0 || c.WorkerQueue < 0 {
+		return fmt.Errorf("worker pool sizes must not be negative")
+	}
+	if c.WorkerMin > 0 && c.WorkerMax > 0 && c.WorkerMax < c.WorkerMin {
+		return fmt.Errorf("worker max (%d) must not be less than worker min (%d)", c.WorkerMax, c.WorkerMin)
+	}
+
+	if c.SSHPort < 0 || c.SSHPort > 65535 {
+		return fmt.Errorf("invalid SSH port %d: must be between 0 and 65535", c.SSHPort)
+	}
+	if c.SSHPort != 0 && c.SSHPort == c.Port {
+		return fmt.Errorf("SSH port %d must differ from the server port", c.SSHPort)
+	}
+
+	if c.BanThreshold < 0 {
+		return fmt.Errorf("invalid ban threshold %d: must not be negative", c.BanThreshold)
+	}
+
+	for _, entry := range c.BannedIPs {
+		if !validIPOrCIDR(entry) {
+			return fmt.Errorf("invalid banned IP %q: expected an IP address or CIDR range", entry)
+		}
+	}
+
+	if c.LogLevel != "" && !validLogLevel(c.LogLevel) {
+		return fmt.Errorf("invalid log level %q: use debug, info, warn or error", c.LogLevel)
+	}
+	for subsystem, level := range c.LogLevels {
+		if !validLogLevel(level) {
+			return fmt.Errorf("invalid log level %q for %s: use debug, info, warn or error", level, subsystem)
+		}
+	}
+
+	if c.MaxConnections < 0 || c.MaxConnectionsPerIP < 0 || c.AcceptRate < 0 || c.AcceptBurst < 0 {
+		return fmt.Errorf("connection limits must not be negative")
+	}
+	if c.HeaderTimeout < 0 {
+		return fmt.Errorf("invalid header timeout %s: must not be negative", c.HeaderTimeout)
+	}
+
+	if c.MaxTunnelsPerToken < 0 {
+		return fmt.Errorf("invalid max tunnels per token %d: must not be negative", c.MaxTunnelsPerToken)
+	}
+	if c.TokenPortShare < 0 || c.TokenPortShare > 1 {
+		return fmt.Errorf("invalid token port share %v: must be between 0 and 1", c.TokenPortShare)
+	}
+
+	if len(c.FederationPeers) > 0 && c.FederationToken == "" {
+		return fmt.Errorf("federation peers require a federation token")
+	}
+
+	switch c.DNSProvider {
+	case "", "cloudflare", "route53":
+	case "rfc2136":
+		if c.DNSServer == "" {
+			return fmt.Errorf("DNS provider rfc2136 requires a DNS server")
+		}
+	default:
+		return fmt.Errorf("invalid DNS provider %q: must be cloudflare, route53 or rfc2136", c.DNSProvider)
+	}
+	if c.DNSTTL < 0 {
+		return fmt.Errorf("invalid DNS TTL %s: must not be negative", c.DNSTTL)
+	}
 
 	// Validate TLS settings
 	if c.TLSEnabled {
@@ -92,10 +292,35 @@ func (c *ServerConfig) Validate() error {
 			return fmt.Errorf("TLS key file is required when TLS is enabled")
 		}
 	}
+	if c.HTTP3 && !c.TLSEnabled {
+		return fmt.Errorf("HTTP/3 requires TLS to be enabled")
+	}
+	if _, err := ParseCurves(c.TLSCurves); err != nil {
+		return err
+	}
+	if c.TLSTicketRotation < 0 {
+		return fmt.Errorf("invalid TLS ticket rotation %s: must not be negative", c.TLSTicketRotation)
+	}
 
 	return nil
 }
 
+// DataPath places a state file setting in DataDir: a relative path is
+// taken relative to it and an empty one becomes name, if name is given.
+// Without a data dir, path is returned unchanged.
+func (c *ServerConfig) DataPath(path, name string) string {
+	if c.DataDir == "" || filepath.IsAbs(path) {
+		return path
+	}
+	if path == "" {
+		if name == "" {
+			return ""
+		}
+		path = name
+	}
+	return filepath.Join(c.DataDir, path)
+}
+
 // LoadTLSConfig loads TLS configuration
 func (c *ServerConfig) LoadTLSConfig() (*tls.Config, error) {
 	if !c.TLSEnabled {
@@ -119,22 +344,70 @@ func (c *ServerConfig) LoadTLSConfig() (*tls.Config, error) {
 		return nil, fmt.Errorf("failed to load certificate: %w", err)
 	}
 
-	// Force TLS 1.3 only
+	curves, err := ParseCurves(c.TLSCurves)
+	if err != nil {
+		return nil, err
+	}
+
+	// TLS 1.3 only unless the TLS 1.2 fallback is explicitly enabled
 	tlsConfig := &tls.Config{
 		Certificates:             []tls.Certificate{cert},
-		MinVersion:               tls.VersionTLS13, // Only TLS 1.3
-		MaxVersion:               tls.VersionTLS13, // Only TLS 1.3
-		PreferServerCipherSuites: true,             // Prefer server cipher suites (ignored in TLS 1.3 but set for consistency)
+		MinVersion:               tls.VersionTLS13,
+		MaxVersion:               tls.VersionTLS13,
+		PreferServerCipherSuites: true, // Prefer server cipher suites (ignored in TLS 1.3 but set for consistency)
 		CipherSuites: []uint16{
 			tls.TLS_AES_128_GCM_SHA256,
 			tls.TLS_AES_256_GCM_SHA384,
 			tls.TLS_CHACHA20_POLY1305_SHA256,
 		},
+		CurvePreferences:       curves,
+		NextProtos:             c.TLSALPN,
+		SessionTicketsDisabled: c.TLSDisableTickets,
+	}
+
+	if c.TLSAllowTLS12 {
+		// Forward-secret AEAD suites only; TLS 1.3 suites are not configurable
+		tlsConfig.MinVersion = tls.VersionTLS12
+		tlsConfig.CipherSuites = append(tlsConfig.CipherSuites,
+			tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+		)
 	}
 
 	return tlsConfig, nil
 }
 
+// ParseCurves converts curve names (case-insensitive) into tls.CurveID values.
+// An empty list returns nil so Go's defaults apply.
+func ParseCurves(names []string) ([]tls.CurveID, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	curves := make([]tls.CurveID, 0, len(names))
+	for _, name := range names {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "x25519mlkem768":
+			curves = append(curves, tls.X25519MLKEM768)
+		case "x25519":
+			curves = append(curves, tls.X25519)
+		case "p256", "p-256", "secp256r1":
+			curves = append(curves, tls.CurveP256)
+		case "p384", "p-384", "secp384r1":
+			curves = append(curves, tls.CurveP384)
+		case "p521", "p-521", "secp521r1":
+			curves = append(curves, tls.CurveP521)
+		default:
+			return nil, fmt.Errorf("unsupported TLS curve %q (supported: X25519MLKEM768, X25519, P256, P384, P521)", name)
+		}
+	}
+	return curves, nil
+}
+
 // GetClientTLSConfig returns TLS config for client connections
 func GetClientTLSConfig(serverName string) *tls.Config {
 	return &tls.Config{
@@ -184,7 +457,8 @@ func DefaultServerConfigPath() string {
 	return filepath.Join(home, ".drip", "server.yaml")
 }
 
-// LoadServerConfig loads server configuration from file
+// LoadServerConfig loads server configuration from file. See
+// ParseServerConfig for the format.
 func LoadServerConfig(path string) (*ServerConfig, error) {
 	if path == "" {
 		path = DefaultServerConfigPath()
@@ -198,12 +472,12 @@ func LoadServerConfig(path string) (*ServerConfig, error) {
 		return nil, fmt.Errorf("failed to read config file: %w", err)
 	}
 
-	var config ServerConfig
-	if err := yaml.Unmarshal(data, &config); err != nil {
+	config, err := ParseServerConfig(data)
+	if err != nil {
 		return nil, fmt.Errorf("failed to parse config file: %w", err)
 	}
 
-	return &config, nil
+	return config, nil
 }
 
 // SaveServerConfig saves server configuration to file
@@ -1,6 +1,7 @@
 package config
 
 import (
+	"crypto/tls"
 	"os"
 	"path/filepath"
 	"testing"
@@ -61,3 +62,54 @@ tcp_port_max: 20000
 		})
 	}
 }
+
+func TestParseCurves(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   []string
+		want    []tls.CurveID
+		wantErr bool
+	}{
+		{name: "empty uses defaults", input: nil, want: nil},
+		{name: "mixed case", input: []string{"x25519", "P-256"}, want: []tls.CurveID{tls.X25519, tls.CurveP256}},
+		{name: "unknown curve", input: []string{"brainpool"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseCurves(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseCurves() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("ParseCurves() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("ParseCurves()[%d] = %v, want %v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestServerConfigDataPath(t *testing.T) {
+	abs := filepath.Join(t.TempDir(), "audit.log")
+	tests := []struct {
+		dataDir, path, name string
+		want                string
+	}{
+		{"", "", "crashes", ""},
+		{"", "audit.log", "", "audit.log"},
+		{"/data", "", "crashes", filepath.Join("/data", "crashes")},
+		{"/data", "", "", ""},
+		{"/data", "logs/audit.log", "", filepath.Join("/data", "logs", "audit.log")},
+		{"/data", abs, "", abs},
+	}
+	for _, tt := range tests {
+		c := &ServerConfig{DataDir: tt.dataDir}
+		if got := c.DataPath(tt.path, tt.name); got != tt.want {
+			t.Errorf("DataDir %q: DataPath(%q, %q) = %q, want %q", tt.dataDir, tt.path, tt.name, got, tt.want)
+		}
+	}
+}
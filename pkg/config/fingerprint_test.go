@@ -0,0 +1,54 @@
+package config
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"testing"
+)
+
+func TestParseFingerprint(t *testing.T) {
+	cert := &x509.Certificate{RawSubjectPublicKeyInfo: []byte("test-key")}
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	hexPin := hex.EncodeToString(sum[:])
+
+	tests := []struct {
+		name    string
+		input   string
+		wantErr bool
+	}{
+		{name: "base64", input: SPKIFingerprint(cert)},
+		{name: "hex", input: hexPin},
+		{name: "hex with colons", input: hexPin[:2] + ":" + hexPin[2:]},
+		{name: "wrong length", input: "abcd", wantErr: true},
+		{name: "empty", input: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pin, err := ParseFingerprint(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseFingerprint() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && string(pin) != string(sum[:]) {
+				t.Errorf("ParseFingerprint() = %x, want %x", pin, sum)
+			}
+		})
+	}
+}
+
+func TestPinnedVerifyConnection(t *testing.T) {
+	good := &x509.Certificate{RawSubjectPublicKeyInfo: []byte("server-key")}
+	bad := &x509.Certificate{RawSubjectPublicKeyInfo: []byte("attacker-key")}
+	pin, _ := ParseFingerprint(SPKIFingerprint(good))
+
+	cfg := GetClientTLSConfigPinned("tunnel.example.com", pin)
+
+	if err := cfg.VerifyConnection(tls.ConnectionState{PeerCertificates: []*x509.Certificate{good}}); err != nil {
+		t.Errorf("matching key rejected: %v", err)
+	}
+	if err := cfg.VerifyConnection(tls.ConnectionState{PeerCertificates: []*x509.Certificate{bad}}); err == nil {
+		t.Error("mismatched key accepted")
+	}
+}
@@ -0,0 +1,79 @@
+package config
+
+import (
+	"net/netip"
+	"reflect"
+	"strings"
+)
+
+// reloadable lists, by YAML key, the settings a running server applies
+// when its config file is reloaded. Changes to any other setting only take
+// effect after a restart.
+var reloadable = map[string]bool{
+	"token":                  true,
+	"metrics_token":          true,
+	"debug":                  true,
+	"log_level":              true,
+	"log_levels":             true,
+	"tcp_port_min":           true,
+	"tcp_port_max":           true,
+	"tcp_port_ranges":        true,
+	"tcp_port_exclude":       true,
+	"token_port_share":       true,
+	"max_connections":        true,
+	"accept_rate":            true,
+	"accept_burst":           true,
+	"max_connections_per_ip": true,
+	"max_tunnels_per_token":  true,
+	"ban_threshold":          true,
+	"ban_duration":           true,
+	"max_ban_duration":       true,
+	"banned_ips":             true,
+	"max_request_body":       true,
+}
+
+// ReloadResult lists, by YAML key, the settings a reload changed.
+type ReloadResult struct {
+	Applied         []string `json:"applied"`
+	RestartRequired []string `json:"restart_required"`
+}
+
+// Reload compares c, the configuration a server runs with, to next, read
+// again from its config file. Changed settings the server can apply at
+// runtime are copied into c; the others keep their running values and are
+// reported as needing a restart.
+func (c *ServerConfig) Reload(next *ServerConfig) ReloadResult {
+	result := ReloadResult{Applied: []string{}, RestartRequired: []string{}}
+
+	cur, nv := reflect.ValueOf(c).Elem(), reflect.ValueOf(next).Elem()
+	for i := 0; i < cur.NumField(); i++ {
+		if reflect.DeepEqual(cur.Field(i).Interface(), nv.Field(i).Interface()) {
+			continue
+		}
+		key, _, _ := strings.Cut(cur.Type().Field(i).Tag.Get("yaml"), ",")
+		if reloadable[key] {
+			cur.Field(i).Set(nv.Field(i))
+			result.Applied = append(result.Applied, key)
+		} else {
+			result.RestartRequired = append(result.RestartRequired, key)
+		}
+	}
+	return result
+}
+
+func validIPOrCIDR(s string) bool {
+	s = strings.TrimSpace(s)
+	if _, err := netip.ParseAddr(s); err == nil {
+		return true
+	}
+	_, err := netip.ParsePrefix(s)
+	return err == nil
+}
+
+func validLogLevel(level string) bool {
+	switch strings.ToLower(level) {
+	case "debug", "info", "warn", "error":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,29 @@
+package config
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestServerConfigReload(t *testing.T) {
+	running := &ServerConfig{Port: 443, Domain: "example.com", AuthToken: "old", TCPPortMin: 20000, TCPPortMax: 20100}
+	next := &ServerConfig{Port: 8443, Domain: "example.com", AuthToken: "new", TCPPortMin: 20000, TCPPortMax: 20200, BannedIPs: []string{"192.0.2.0/24"}}
+
+	result := running.Reload(next)
+	if want := []string{"tcp_port_max", "token", "banned_ips"}; !slices.Equal(result.Applied, want) {
+		t.Errorf("Applied = %v, want %v", result.Applied, want)
+	}
+	if want := []string{"port"}; !slices.Equal(result.RestartRequired, want) {
+		t.Errorf("RestartRequired = %v, want %v", result.RestartRequired, want)
+	}
+	if running.AuthToken != "new" || running.TCPPortMax != 20200 || len(running.BannedIPs) != 1 {
+		t.Errorf("reloadable settings not copied: %+v", running)
+	}
+	if running.Port != 443 {
+		t.Errorf("Port = %d, want the running 443 until a restart", running.Port)
+	}
+
+	if again := running.Reload(next); len(again.Applied) != 0 || !slices.Equal(again.RestartRequired, []string{"port"}) {
+		t.Errorf("second Reload() = %+v, want only port pending", again)
+	}
+}
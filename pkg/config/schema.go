@@ -0,0 +1,216 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ParseServerConfig reads a server config file strictly: unknown settings
+// and values of the wrong type are errors, reported with their line and,
+// for likely typos, the setting that was probably meant. Values may refer
+// to environment variables as ${VAR} or ${VAR:-default}; $$ is a literal $.
+// It does not call Validate.
+func ParseServerConfig(data []byte) (*ServerConfig, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	var config ServerConfig
+	if len(doc.Content) == 0 {
+		return &config, nil
+	}
+
+	var errs []error
+	expandNode(&doc, &errs)
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	checkKeys(doc.Content[0], reflect.TypeOf(config), "", &errs)
+	if err := doc.Decode(&config); err != nil {
+		var typeErr *yaml.TypeError
+		if !errors.As(err, &typeErr) {
+			return nil, err
+		}
+		for _, msg := range typeErr.Errors {
+			errs = append(errs, errors.New(msg))
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return &config, nil
+}
+
+// expandNode replaces environment variable references in the scalar
+// values under n.
+func expandNode(n *yaml.Node, errs *[]error) {
+	if n.Kind != yaml.ScalarNode {
+		for _, c := range n.Content {
+			expandNode(c, errs)
+		}
+		return
+	}
+	if !strings.Contains(n.Value, "$") {
+		return
+	}
+	value, err := expandEnv(n.Value)
+	if err != nil {
+		*errs = append(*errs, fmt.Errorf("line %d: %w", n.Line, err))
+		return
+	}
+	if value != n.Value && n.Style == 0 {
+		// Let an unquoted value's type follow what it expanded to, so
+		// port: ${PORT} reads as a number.
+		n.Tag = ""
+	}
+	n.Value = value
+}
+
+// expandEnv expands ${VAR} and ${VAR:-default} in s. Any other $ is kept
+// as is, except that $$ stands for a single $.
+func expandEnv(s string) (string, error) {
+	var b strings.Builder
+	for {
+		i := strings.IndexByte(s, '$')
+		if i < 0 || i == len(s)-1 {
+			b.WriteString(s)
+			return b.String(), nil
+		}
+		b.WriteString(s[:i])
+		switch s[i+1] {
+		case '$':
+			b.WriteByte('$')
+			s = s[i+2:]
+			continue
+		case '{':
+		default:
+			b.WriteByte('$')
+			s = s[i+1:]
+			continue
+		}
+
+		end := strings.IndexByte(s[i:], '}')
+		if end < 0 {
+			return "", fmt.Errorf("unterminated variable reference in %q", s[i:])
+		}
+		ref := s[i+2 : i+end]
+		name, def, hasDefault := strings.Cut(ref, ":-")
+		if !validEnvName(name) {
+			return "", fmt.Errorf("invalid environment variable name %q", name)
+		}
+		value := os.Getenv(name)
+		switch {
+		case value != "":
+		case hasDefault:
+			value = def
+		default:
+			if _, ok := os.LookupEnv(name); !ok {
+				return "", fmt.Errorf("environment variable %s is not set; use ${%s:-default} for an optional value", name, name)
+			}
+		}
+		b.WriteString(value)
+		s = s[i+end+1:]
+	}
+}
+
+func validEnvName(name string) bool {
+	if name == "" || name[0] >= '0' && name[0] <= '9' {
+		return false
+	}
+	for _, c := range name {
+		if c != '_' && (c < 'A' || c > 'Z') && (c < 'a' || c > 'z') && (c < '0' || c > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// checkKeys reports mapping keys under n that have no field in t, the Go
+// type n decodes into. path names where n is, for messages.
+func checkKeys(n *yaml.Node, t reflect.Type, path string, errs *[]error) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch {
+	case n.Kind == yaml.MappingNode && t.Kind() == reflect.Struct:
+		fields := make(map[string]reflect.Type)
+		var keys []string
+		for i := 0; i < t.NumField(); i++ {
+			key, _, _ := strings.Cut(t.Field(i).Tag.Get("yaml"), ",")
+			if key == "" || key == "-" {
+				continue
+			}
+			fields[key] = t.Field(i).Type
+			keys = append(keys, key)
+		}
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key := n.Content[i]
+			ft, ok := fields[key.Value]
+			if !ok {
+				*errs = append(*errs, unknownKey(key, path, keys))
+				continue
+			}
+			checkKeys(n.Content[i+1], ft, joinPath(path, key.Value), errs)
+		}
+	case n.Kind == yaml.MappingNode && t.Kind() == reflect.Map:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			checkKeys(n.Content[i+1], t.Elem(), joinPath(path, n.Content[i].Value), errs)
+		}
+	case n.Kind == yaml.SequenceNode && (t.Kind() == reflect.Slice || t.Kind() == reflect.Array):
+		for i, c := range n.Content {
+			checkKeys(c, t.Elem(), fmt.Sprintf("%s[%d]", path, i), errs)
+		}
+	}
+}
+
+func unknownKey(key *yaml.Node, path string, known []string) error {
+	msg := fmt.Sprintf("line %d: unknown setting %q", key.Line, key.Value)
+	if path != "" {
+		msg += " in " + path
+	}
+	best, bestDist := "", 3
+	for _, k := range known {
+		if d := editDistance(key.Value, k); d < bestDist {
+			best, bestDist = k, d
+		}
+	}
+	if best != "" {
+		msg += fmt.Sprintf(" (did you mean %q?)", best)
+	}
+	return errors.New(msg)
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// editDistance returns the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
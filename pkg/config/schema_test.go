@@ -0,0 +1,51 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseServerConfig(t *testing.T) {
+	t.Setenv("DRIP_TEST_PORT", "9443")
+	t.Setenv("DRIP_TEST_TOKEN", "s3cret")
+
+	cfg, err := ParseServerConfig([]byte(`
+port: ${DRIP_TEST_PORT}
+domain: ${DRIP_TEST_DOMAIN:-tunnel.example.com}
+token: "${DRIP_TEST_TOKEN}$$x"
+metrics_token: pa$s
+tcp_port_ranges:
+  - name: low
+    min: 1000
+    max: 1100
+`))
+	if err != nil {
+		t.Fatalf("ParseServerConfig() = %v", err)
+	}
+	if cfg.Port != 9443 || cfg.Domain != "tunnel.example.com" || cfg.AuthToken != "s3cret$x" || cfg.MetricsToken != "pa$s" {
+		t.Errorf("got port %d, domain %q, token %q, metrics token %q", cfg.Port, cfg.Domain, cfg.AuthToken, cfg.MetricsToken)
+	}
+
+	tests := []struct {
+		yaml string
+		want []string
+	}{
+		{"tokn: x\n", []string{`line 1: unknown setting "tokn" (did you mean "token"?)`}},
+		{"port: 1\ntcp_port_ranges:\n  - name: low\n    mn: 1\n", []string{`line 4: unknown setting "mn" in tcp_port_ranges[0] (did you mean "min"?)`}},
+		{"port: many\n", []string{"line 1: cannot unmarshal !!str `many` into int"}},
+		{"domain: ${DRIP_TEST_UNSET}\n", []string{"line 1: environment variable DRIP_TEST_UNSET is not set"}},
+		{"foo: 1\nport: many\n", []string{`line 1: unknown setting "foo"`, "line 2: cannot unmarshal"}},
+	}
+	for _, tt := range tests {
+		_, err := ParseServerConfig([]byte(tt.yaml))
+		if err == nil {
+			t.Errorf("ParseServerConfig(%q) accepted an invalid config", tt.yaml)
+			continue
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(err.Error(), want) {
+				t.Errorf("ParseServerConfig(%q) = %v, want it to mention %q", tt.yaml, err, want)
+			}
+		}
+	}
+}